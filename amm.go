@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"math/big"
+)
+
+// bpsDenominator 基点分母
+const bpsDenominator = 10000
+
+// pipsDenominator V3 费率单位（1e-6）的分母；报价路径统一以该单位计算费率，V3/Algebra 的链上费率无需取整
+const pipsDenominator = 1_000_000
+
+// getAmountOut 恒定乘积池的精确输出数量，feePips 单位 1e-6（3000 表示 0.3%）：
+// amountOut = amountIn * (1e6 - feePips) * reserveOut / (reserveIn * 1e6 + amountIn * (1e6 - feePips))，向下取整
+// 整基点的费率（feePips 为 100 的整数倍）时分子分母同乘 100，结果与 UniswapV2Library.getAmountOut 的整数运算逐位一致
+// 输入非正、储备量为空或费率非法（见 validFeePips）时返回 0
+func getAmountOut(amountIn, reserveIn, reserveOut *big.Int, feePips int) *big.Int {
+	if amountIn == nil || reserveIn == nil || reserveOut == nil ||
+		amountIn.Sign() <= 0 || reserveIn.Sign() <= 0 || reserveOut.Sign() <= 0 || !validFeePips(feePips) {
+		return new(big.Int)
+	}
+	amountInWithFee := new(big.Int).Mul(amountIn, big.NewInt(int64(pipsDenominator-feePips)))
+	numerator := new(big.Int).Mul(amountInWithFee, reserveOut)
+	denominator := new(big.Int).Mul(reserveIn, big.NewInt(pipsDenominator))
+	denominator.Add(denominator, amountInWithFee)
+	return numerator.Quo(numerator, denominator)
+}
+
+// getAmountIn 恒定乘积池得到 amountOut 所需的最少输入数量，与 UniswapV2Library.getAmountIn 一致：
+// amountIn = reserveIn * amountOut * 1e6 / ((reserveOut - amountOut) * (1e6 - feePips)) + 1
+// 输出不小于储备量（流动性不足）或参数非法时返回 nil
+func getAmountIn(amountOut, reserveIn, reserveOut *big.Int, feePips int) *big.Int {
+	if amountOut == nil || reserveIn == nil || reserveOut == nil ||
+		amountOut.Sign() <= 0 || reserveIn.Sign() <= 0 || reserveOut.Cmp(amountOut) <= 0 || !validFeePips(feePips) {
+		return nil
+	}
+	numerator := new(big.Int).Mul(reserveIn, amountOut)
+	numerator.Mul(numerator, big.NewInt(pipsDenominator))
+	denominator := new(big.Int).Sub(reserveOut, amountOut)
+	denominator.Mul(denominator, big.NewInt(int64(pipsDenominator-feePips)))
+	amountIn := numerator.Quo(numerator, denominator)
+	return amountIn.Add(amountIn, big.NewInt(1))
+}
+
+// feeRate 扣除手续费后的比例，例如 feePips 为 3000 时返回 0.997
+func feeRate(feePips int) float64 {
+	return float64(pipsDenominator-feePips) / pipsDenominator
+}
+
+// validFeeBps 费率是否在 [0, 10000) 基点内；100% 及以上的费率会让公式的 (10000 - feeBps) 为零或负数，
+// 输出变为 0 或负数，加载配置与池子时即拒绝，不带入报价
+func validFeeBps(feeBps int) bool {
+	return feeBps >= 0 && feeBps < bpsDenominator
+}
+
+// validFeePips 费率是否在 [0, 1e6) 内（单位 1e-6），含义同 validFeeBps
+func validFeePips(feePips int) bool {
+	return feePips >= 0 && feePips < pipsDenominator
+}
+
+// feePercentToBps 将百分比费率（0.3 表示 0.3%）换算为基点
+func feePercentToBps(fee float64) int {
+	return int(math.Round(fee * 100))
+}
+
+// feePipsToBps 将 V3 的 1e-6 单位费率（3000 表示 0.3%）换算为基点，不是整基点的费率四舍五入
+// 只用于展示与按基点配置的阈值比较，报价始终使用 poolDetail.FeePips 保存的原始值
+func feePipsToBps(pips int) int {
+	return (pips + 50) / 100
+}
+
+// feeBpsToPips 将基点换算为 1e-6 单位费率，换算是精确的
+func feeBpsToPips(feeBps int) int {
+	return feeBps * 100
+}
+
+// feePipsToPercent 将 1e-6 单位费率换算为百分比费率，存储中沿用百分比的 fee 字段保留 4 位小数即可无损还原
+func feePipsToPercent(feePips int) float64 {
+	return float64(feePips) / 10000
+}
+
+// feePercentToPips 将百分比费率换算为 1e-6 单位费率
+func feePercentToPips(fee float64) int {
+	return int(math.Round(fee * 10000))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+// TestGetAmountOut 整基点费率与 UniswapV2Library.getAmountOut 的整数运算逐位一致，非整基点的 pips 费率不取整，非法费率返回 0
+func TestGetAmountOut(t *testing.T) {
+	tests := []struct {
+		name       string
+		amountIn   *big.Int
+		reserveIn  *big.Int
+		reserveOut *big.Int
+		feePips    int
+		want       string
+	}{
+		// 2000 * 9970 * 100000 / (100000 * 10000 + 2000 * 9970) = 1955.02，向下取整
+		{name: "small pool", amountIn: big.NewInt(2000), reserveIn: big.NewInt(100000), reserveOut: big.NewInt(100000), feePips: 3000, want: "1955"},
+		// Router02 测试用例：1 ETH 兑换 5/10 的池子
+		{name: "router02 reference", amountIn: units(1, 18), reserveIn: units(5, 18), reserveOut: units(10, 18), feePips: 3000, want: "1662497915624478906"},
+		{name: "pancakeswap fee", amountIn: big.NewInt(2000), reserveIn: big.NewInt(100000), reserveOut: big.NewInt(100000), feePips: 2500, want: "1955"},
+		// Algebra 动态费率 0.045%（450 pips）不是整基点，按基点取整会得到 0.05% 的 998501997253744881
+		{name: "sub-bps fee kept in pips", amountIn: units(1, 18), reserveIn: units(1000, 18), reserveOut: units(1000, 18), feePips: 450, want: "998551897450902949"},
+		// V3 各费率档位：0.01%、0.05%、1%，按 amountIn*(1e6-fee)*reserveOut/(reserveIn*1e6+amountIn*(1e6-fee)) 精确计算
+		{name: "v3 100 pips tier", amountIn: units(1, 18), reserveIn: units(1000, 18), reserveOut: units(1000, 18), feePips: 100, want: "998901198691428440"},
+		{name: "v3 500 pips tier", amountIn: units(1, 18), reserveIn: units(1000, 18), reserveOut: units(1000, 18), feePips: 500, want: "998501997253744881"},
+		{name: "v3 10000 pips tier", amountIn: units(1, 18), reserveIn: units(1000, 18), reserveOut: units(1000, 18), feePips: 10000, want: "989020869339354039"},
+		{name: "zero fee", amountIn: big.NewInt(2000), reserveIn: big.NewInt(100000), reserveOut: big.NewInt(100000), feePips: 0, want: "1960"},
+		{name: "zero input", amountIn: big.NewInt(0), reserveIn: big.NewInt(100000), reserveOut: big.NewInt(100000), feePips: 3000, want: "0"},
+		{name: "fee of 100%", amountIn: big.NewInt(2000), reserveIn: big.NewInt(100000), reserveOut: big.NewInt(100000), feePips: 1000000, want: "0"},
+		{name: "fee above 100%", amountIn: big.NewInt(2000), reserveIn: big.NewInt(100000), reserveOut: big.NewInt(100000), feePips: 1200000, want: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getAmountOut(tt.amountIn, tt.reserveIn, tt.reserveOut, tt.feePips); got.String() != tt.want {
+				t.Fatalf("getAmountOut = %s，期望 %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestGetAmountIn 与 UniswapV2Library.getAmountIn 一致，且与 getAmountOut 互逆：按返回的输入量兑换至少得到目标输出
+func TestGetAmountIn(t *testing.T) {
+	tests := []struct {
+		name       string
+		amountOut  *big.Int
+		reserveIn  *big.Int
+		reserveOut *big.Int
+		feePips    int
+		want       string
+	}{
+		{name: "uniswap reference", amountOut: big.NewInt(1), reserveIn: big.NewInt(100), reserveOut: big.NewInt(100), feePips: 3000, want: "2"},
+		{name: "router02 reference", amountOut: units(1, 18), reserveIn: units(10, 18), reserveOut: units(5, 18), feePips: 3000, want: "2507522567703109328"},
+		{name: "output drains the pool", amountOut: big.NewInt(100), reserveIn: big.NewInt(100), reserveOut: big.NewInt(100), feePips: 3000},
+		{name: "fee of 100%", amountOut: big.NewInt(1), reserveIn: big.NewInt(100), reserveOut: big.NewInt(100), feePips: 1000000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getAmountIn(tt.amountOut, tt.reserveIn, tt.reserveOut, tt.feePips)
+			if tt.want == "" {
+				if got != nil {
+					t.Fatalf("getAmountIn = %s，期望 nil", got)
+				}
+				return
+			}
+			if got == nil || got.String() != tt.want {
+				t.Fatalf("getAmountIn = %v，期望 %s", got, tt.want)
+			}
+			if out := getAmountOut(got, tt.reserveIn, tt.reserveOut, tt.feePips); out.Cmp(tt.amountOut) < 0 {
+				t.Fatalf("投入 %s 只得到 %s，少于目标 %s", got, out, tt.amountOut)
+			}
+		})
+	}
+}
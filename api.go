@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gin-gonic/gin"
+)
+
+// poolTokenView 池子详情接口中的单个代币
+type poolTokenView struct {
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+	TaxBps   int    `json:"tax_bps"`
+	Reserve  string `json:"reserve"`
+	// ReserveHuman 按精度换算后的储备量（例如 "12.0"），精度未知时为最小单位的原始值
+	ReserveHuman string `json:"reserve_human"`
+	// ReserveScaled ReserveHuman 是否已按精度换算，false 表示精度未知、ReserveHuman 为原始值
+	ReserveScaled bool     `json:"reserve_scaled"`
+	Weight        *float64 `json:"weight,omitempty"`
+	// Volume24h 该代币卖入池子的滚动成交量（最小单位），从未统计过成交量时为 "0"
+	Volume24h string `json:"volume_24h"`
+}
+
+// poolView 池子详情接口的响应
+type poolView struct {
+	Address  string `json:"address"`
+	Protocol string `json:"protocol"`
+	// FeePips 池子费率（单位 1e-6），是唯一用于报价的值；Fee（百分比）与 FeeBps（基点，非整基点时四舍五入）由它换算，只用于展示
+	FeePips int     `json:"fee_pips"`
+	Fee     float64 `json:"fee"`
+	FeeBps  int     `json:"fee_bps"`
+	// FeePipsOneForZero 按方向收费的 Algebra v1.9 池子 token1 → token0 方向的费率，两个方向相同时省略
+	FeePipsOneForZero int             `json:"fee_pips_one_for_zero,omitempty"`
+	FeeSource         string          `json:"fee_source"`
+	Active            bool            `json:"active"`
+	Blacklisted       bool            `json:"blacklisted"`
+	Tokens            []poolTokenView `json:"tokens"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+	ReserveUpdatedAt  *time.Time      `json:"last_reserve_update"`
+	// ReserveDiscrepancy getReserves 与代币余额交叉校验不一致（VERIFY_RESERVES 开启时才会检测）
+	ReserveDiscrepancy bool `json:"reserve_discrepancy"`
+	// DiscoveredBlock 首次发现池子的区块，0 表示未知（升级前写入的旧数据）
+	DiscoveredBlock uint64 `json:"discovered_block"`
+	// DiscoveredTx 首次发现池子的交易哈希，未知时省略
+	DiscoveredTx string `json:"discovered_tx,omitempty"`
+}
+
+// newPoolView 组装池子详情，代币元数据通过 lookup 读取（注册表缓存或存储中的代币表），不发起 RPC 调用
+func newPoolView(pool poolDetail, lookup func(common.Address) (tokenMetadata, bool)) poolView {
+	view := poolView{
+		Address:   pool.Address.Hex(),
+		Protocol:  pool.Protocol,
+		FeePips:   pool.FeePips,
+		Fee:       feePipsToPercent(pool.FeePips),
+		FeeBps:    feePipsToBps(pool.FeePips),
+		FeeSource: pool.FeeSource,
+
+		FeePipsOneForZero: pool.FeePipsOneForZero,
+		Active:            pool.Active,
+		Blacklisted:       pool.Blacklisted,
+		Tokens:            make([]poolTokenView, len(pool.Tokens)),
+		CreatedAt:         pool.CreatedAt,
+		UpdatedAt:         pool.UpdatedAt,
+		ReserveUpdatedAt:  pool.ReserveUpdatedAt,
+
+		ReserveDiscrepancy: pool.ReserveDiscrepancy,
+		DiscoveredBlock:    pool.DiscoveredBlock,
+	}
+	if pool.DiscoveredTx != (common.Hash{}) {
+		view.DiscoveredTx = pool.DiscoveredTx.Hex()
+	}
+	volumes := pool.VolumeAt(time.Now())
+	for i, token := range pool.Tokens {
+		item := poolTokenView{Address: token.Hex(), Decimals: decimalsUnknown, Reserve: "0", Volume24h: "0"}
+		if meta, ok := lookup(token); ok {
+			item.Symbol = meta.Symbol
+			item.Decimals = meta.Decimals
+			item.TaxBps = meta.TaxBps
+		}
+		reserve := pool.reserveAt(i)
+		if reserve != nil {
+			item.Reserve = reserve.String()
+		}
+		item.ReserveHuman, item.ReserveScaled = formatUnits(reserve, item.Decimals)
+		if pool.weighted() {
+			weight := pool.Weights[i]
+			item.Weight = &weight
+		}
+		if i < len(volumes) {
+			item.Volume24h = volumes[i].String()
+		}
+		view.Tokens[i] = item
+	}
+	return view
+}
+
+// 池子列表接口的分页参数
+const (
+	defaultPoolPageSize = 100
+	maxPoolPageSize     = 1000
+)
+
+// listPoolsHandler GET /pools?limit=&offset=&order=created_at|updated_at|address&active=true|false
+// 按稳定顺序分页返回池子，默认每页 100 个、最多 1000 个，active=true 时只返回未失效的池子
+func listPoolsHandler(store Store, tokens *TokenRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		opts := ListPoolsOptions{OrderBy: strings.TrimSpace(c.DefaultQuery("order", PoolOrderCreated))}
+		if _, ok := poolOrderClauses[opts.OrderBy]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的排序方式: " + opts.OrderBy + "（可选 created_at、updated_at、address）"})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPoolPageSize)))
+		if err != nil || limit <= 0 || limit > maxPoolPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit 需为 1 到 " + strconv.Itoa(maxPoolPageSize) + " 之间的整数"})
+			return
+		}
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset 需为非负整数"})
+			return
+		}
+		activeOnly, err := strconv.ParseBool(c.DefaultQuery("active", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "active 需为 true 或 false"})
+			return
+		}
+		opts.Limit, opts.Offset, opts.ActiveOnly = limit, offset, activeOnly
+
+		pools, err := store.ListPools(c.Request.Context(), opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		views := make([]poolView, len(pools))
+		for i, pool := range pools {
+			views[i] = newPoolView(pool, tokens.Get)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"pools":  views,
+			"order":  opts.OrderBy,
+			"limit":  limit,
+			"offset": offset,
+		})
+	}
+}
+
+// getPoolHandler GET /pools/:address，地址不区分大小写，返回的地址均为校验和格式
+func getPoolHandler(store Store, tokens *TokenRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.Param("address")
+		address, valid := normalizeAddress(raw)
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "地址格式非法: " + raw})
+			return
+		}
+
+		pool, ok, err := store.GetPool(c.Request.Context(), common.HexToAddress(address))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "池子不存在: " + address})
+			return
+		}
+		c.JSON(http.StatusOK, newPoolView(pool, tokens.Get))
+	}
+}
+
+// poolExportContentTypes 各导出格式的响应 Content-Type
+var poolExportContentTypes = map[string]string{
+	ExportFormatCSV:    "text/csv; charset=utf-8",
+	ExportFormatNDJSON: "application/x-ndjson",
+}
+
+// exportPoolsHandler GET /pools/export?format=csv|ndjson，默认 csv，边读取边写出响应
+// 开始写出后出错只能中断响应，错误记录在日志中
+func exportPoolsHandler(store Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", ExportFormatCSV)))
+		contentType, ok := poolExportContentTypes[format]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的导出格式: " + format + "（可选 csv、ndjson）"})
+			return
+		}
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="pools.`+format+`"`)
+		c.Status(http.StatusOK)
+		if err := store.ExportPools(c.Request.Context(), c.Writer, format); err != nil {
+			log.Printf("导出池子失败: %v", err)
+		}
+	}
+}
+
+// provisionalPoolsHandler GET /pools/provisional，返回内存池中预判、尚未上链确认的池子
+func provisionalPoolsHandler(provisional *ProvisionalPools) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		confirmed, expired := provisional.Counts()
+		c.JSON(http.StatusOK, gin.H{
+			"enabled":   provisional != nil,
+			"pools":     provisional.List(),
+			"confirmed": confirmed,
+			"expired":   expired,
+		})
+	}
+}
+
+// quoteRequest POST /quote 的请求体，amountIn 为最小单位的十进制整数字符串
+type quoteRequest struct {
+	Pool     string `json:"pool"`
+	TokenIn  string `json:"tokenIn"`
+	TokenOut string `json:"tokenOut"`
+	AmountIn string `json:"amountIn"`
+}
+
+// quoteResponse POST /quote 的响应
+type quoteResponse struct {
+	Pool     string `json:"pool"`
+	Protocol string `json:"protocol"`
+	// FeePips 报价使用的费率（单位 1e-6）；Fee 与 FeeBps 由它换算，只用于展示
+	FeePips     int      `json:"feePips"`
+	Fee         float64  `json:"fee"`
+	FeeBps      int      `json:"feeBps"`
+	TokenIn     string   `json:"tokenIn"`
+	TokenOut    string   `json:"tokenOut"`
+	AmountIn    string   `json:"amountIn"`
+	AmountOut   string   `json:"amountOut"`
+	PriceImpact float64  `json:"priceImpact"`
+	Reserves    []string `json:"reserves"`
+	Live        bool     `json:"live"`
+}
+
+// quoteHandler POST /quote[?live=true]，按存储中的储备量（live=true 时通过 RPC 实时读取）计算单个池子的输出数量
+// tokenOut 可省略，两币池默认取另一个代币
+func quoteHandler(store Store, client *ethclient.Client, tokens *TokenRegistry, cfg *AppConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req quoteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求体格式非法: " + err.Error()})
+			return
+		}
+		// 统一为校验和格式，响应中的地址与请求的大小写无关
+		fields := []*string{&req.Pool, &req.TokenIn}
+		if req.TokenOut != "" {
+			fields = append(fields, &req.TokenOut)
+		}
+		for _, field := range fields {
+			normalized, ok := normalizeAddress(*field)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "地址格式非法: " + *field})
+				return
+			}
+			*field = normalized
+		}
+		var tokenOut common.Address
+		if req.TokenOut != "" {
+			tokenOut = common.HexToAddress(req.TokenOut)
+		}
+		amountIn, ok := new(big.Int).SetString(strings.TrimSpace(req.AmountIn), 10)
+		if !ok || amountIn.Sign() <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amountIn 必须为正整数（最小单位）: " + req.AmountIn})
+			return
+		}
+		live, _ := strconv.ParseBool(c.Query("live"))
+
+		ctx := c.Request.Context()
+		pool, found, err := store.GetPool(ctx, common.HexToAddress(req.Pool))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "池子不存在: " + req.Pool})
+			return
+		}
+		if live {
+			reserves, err := FetchPoolReserves(ctx, client, pool, cfg.RPCCallTimeout)
+			if err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": "实时读取储备量失败: " + err.Error()})
+				return
+			}
+			pool.Reserves = reserves
+		}
+
+		quote, err := quotePool(pool, tokens, common.HexToAddress(req.TokenIn), tokenOut, amountIn)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := quoteResponse{
+			Pool:        pool.Address.Hex(),
+			Protocol:    pool.Protocol,
+			FeePips:     pool.FeePips,
+			Fee:         feePipsToPercent(pool.FeePips),
+			FeeBps:      feePipsToBps(pool.FeePips),
+			TokenIn:     req.TokenIn,
+			TokenOut:    quote.TokenOut.Hex(),
+			AmountIn:    amountIn.String(),
+			AmountOut:   quote.AmountOut.String(),
+			PriceImpact: quote.PriceImpact,
+			Reserves:    make([]string, len(pool.Reserves)),
+			Live:        live,
+		}
+		for i, reserve := range pool.Reserves {
+			if reserve != nil {
+				resp.Reserves[i] = reserve.String()
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// refreshReservesHandler POST /pools/refresh-reserves，在后台启动一轮全量刷新并立即返回 202 与任务状态，
+// 进度与结果通过 GET /pools/refresh-reserves 查询；刷新跟随服务的 ctx，客户端断开不影响，服务退出时中止
+// 已有一轮刷新在执行时返回 409 与当前状态
+func refreshReservesHandler(ctx context.Context, refresher *ReserveRefresher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := refresher.StartBackground(ctx)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": status})
+			return
+		}
+		c.JSON(http.StatusAccepted, status)
+	}
+}
+
+// refreshReservesStatusHandler GET /pools/refresh-reserves，返回当前或上一轮全量刷新的状态与统计
+func refreshReservesStatusHandler(refresher *ReserveRefresher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, refresher.Status())
+	}
+}
+
+// blacklistPoolHandler POST /pools/:address/blacklist 拉黑池子，DELETE 解除拉黑；池子不存在时返回 404
+// 标记写入存储，重启后仍然有效；内存中的拉黑集合同时更新，套利发现与池子发现立即生效
+func blacklistPoolHandler(store Store, blacklist *PoolBlacklist, blacklisted bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.Param("address")
+		address, valid := normalizeAddress(raw)
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "地址格式非法: " + raw})
+			return
+		}
+
+		found, err := blacklist.Set(store, common.HexToAddress(address), blacklisted)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "池子不存在: " + address})
+			return
+		}
+		if blacklisted {
+			log.Printf("池子 %s 已拉黑", address)
+		} else {
+			log.Printf("池子 %s 已解除拉黑", address)
+		}
+		c.JSON(http.StatusOK, gin.H{"address": address, "blacklisted": blacklisted})
+	}
+}
+
+// defaultStatsWindow /stats 默认统计的时间范围
+const defaultStatsWindow = 24 * time.Hour
+
+// statsHandler GET /stats?window=24h，返回时间范围内已确认套利机会的总数、平均/最大净利润、
+// 按整点分组的统计与出现次数最多的代币，以及模拟交易账本的盈亏（paper）
+func statsHandler(store Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		window := defaultStatsWindow
+		if windowStr := strings.TrimSpace(c.Query("window")); windowStr != "" {
+			parsed, err := time.ParseDuration(windowStr)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "window 需为正的时长，例如 24h、90m"})
+				return
+			}
+			window = parsed
+		}
+		since := time.Now().Add(-window)
+		stats, err := store.OpportunityStats(c.Request.Context(), since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		paper, err := store.PaperStats(c.Request.Context(), since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"window": window.String(), "stats": stats, "paper": paper})
+	}
+}
+
+// discoverRunHandler POST /discover/run，立即触发一轮套利发现并在该轮结束后返回统计
+// 执行中到达的请求合并到下一轮，客户端断开时不会中断已开始的发现
+func discoverRunHandler(finder *ArbitrageFinder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		summary, err := finder.Trigger(c.Request.Context())
+		if err != nil {
+			if errors.Is(err, errFinderNotRunning) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "等待套利发现完成失败: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// routerDeps HTTP 接口依赖的组件
+type routerDeps struct {
+	store       *ResilientStore
+	conn        *ethclient.Client
+	tokens      *TokenRegistry
+	provisional *ProvisionalPools
+	refresher   *ReserveRefresher
+	blacklist   *PoolBlacklist
+	discoverer  *PoolDiscoverer
+	finder      *ArbitrageFinder
+	arbQueue    *ArbitrageQueue
+	calculator  *ArbitrageCalculator
+	breaker     *CircuitBreaker
+	subscriber  backoffReporter
+}
+
+// newRouter 构建 HTTP 路由：/ping 与 /healthz 不需要密钥，其余接口在配置了 API_KEY 时需要携带密钥，
+// 开启 ENABLE_PPROF 时在同一鉴权分组下挂载 /debug/pprof
+func newRouter(ctx context.Context, cfg *AppConfig, deps routerDeps) *gin.Engine {
+	router := gin.Default()
+	router.Use(corsMiddleware(cfg.CORSOrigins))
+	router.GET("/ping", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "pong",
+		})
+	})
+	router.GET("/healthz", func(c *gin.Context) {
+		storeHealth := deps.store.Health()
+		breakerState := deps.breaker.State()
+		status := "ok"
+		if !storeHealth.Healthy || storeHealth.StalePools || breakerState.Tripped {
+			// 存储熔断期间新池子只在内存中缓冲、池子列表读取失败时使用旧缓存、执行熔断期间不提交交易，
+			// 服务仍可用但处于降级状态
+			status = "degraded"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":           status,
+			"block_lag":        deps.discoverer.BlockLag(),
+			"receipts":         deps.discoverer.ReceiptStats(),
+			"blocks_dropped":   deps.discoverer.BlocksDropped(),
+			"store":            storeHealth,
+			"executor_breaker": breakerState,
+			"arbitrage": gin.H{
+				"queue_dropped": deps.arbQueue.Dropped(),
+				"stale_dropped": deps.calculator.StaleDropped(),
+			},
+			"subscriber": gin.H{
+				"mode":    cfg.SubMode,
+				"backoff": deps.subscriber.BackoffState(),
+			},
+		})
+	})
+
+	// 除 /ping 与 /healthz 外的接口在配置了 API_KEY 时需要携带密钥
+	api := router.Group("/")
+	if cfg.APIKey != "" {
+		api.Use(apiKeyMiddleware(cfg.APIKey))
+	}
+	api.GET("/pools", listPoolsHandler(deps.store, deps.tokens))
+	api.GET("/pools/export", exportPoolsHandler(deps.store))
+	api.GET("/pools/provisional", provisionalPoolsHandler(deps.provisional))
+	api.GET("/pools/:address", getPoolHandler(deps.store, deps.tokens))
+	api.POST("/pools/refresh-reserves", refreshReservesHandler(ctx, deps.refresher))
+	api.GET("/pools/refresh-reserves", refreshReservesStatusHandler(deps.refresher))
+	api.POST("/pools/:address/blacklist", blacklistPoolHandler(deps.store, deps.blacklist, true))
+	api.DELETE("/pools/:address/blacklist", blacklistPoolHandler(deps.store, deps.blacklist, false))
+	api.POST("/quote", quoteHandler(deps.store, deps.conn, deps.tokens, cfg))
+	api.POST("/discover/run", discoverRunHandler(deps.finder))
+	api.GET("/stats", statsHandler(deps.store))
+	// 手动解除执行熔断
+	api.POST("/executor/reset", func(c *gin.Context) {
+		deps.breaker.Reset()
+		c.JSON(http.StatusOK, deps.breaker.State())
+	})
+	// 输出默认值与环境变量合并后实际生效的配置，时长字段以纳秒表示
+	api.GET("/config", func(c *gin.Context) {
+		c.JSON(http.StatusOK, cfg.Redacted())
+	})
+	if cfg.EnablePprof {
+		registerPprofRoutes(api)
+		log.Printf("已开启 /debug/pprof 性能分析接口")
+	}
+	return router
+}
+
+// corsMiddleware 为允许的来源返回 CORS 响应头，并直接响应预检请求
+// 不在白名单中的来源不返回 CORS 头（由浏览器拦截），其预检请求返回 403
+func corsMiddleware(origins []string) gin.HandlerFunc {
+	allowAll := false
+	allowed := make(map[string]struct{}, len(origins))
+	for _, origin := range origins {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[origin] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || len(origins) == 0 {
+			c.Next()
+			return
+		}
+
+		_, ok := allowed[origin]
+		if ok || allowAll {
+			header := c.Writer.Header()
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Add("Vary", "Origin")
+			header.Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key")
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+		} else if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// apiKeyMiddleware 校验 Authorization: Bearer <key> 或 X-API-Key 请求头，缺失或错误时返回 401
+func apiKeyMiddleware(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := c.GetHeader("X-API-Key")
+		if auth := c.GetHeader("Authorization"); provided == "" && strings.HasPrefix(auth, "Bearer ") {
+			provided = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+		if provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(key)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API 密钥缺失或无效"})
+			return
+		}
+		c.Next()
+	}
+}
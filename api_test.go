@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestCORSMiddleware 白名单中的来源返回 CORS 响应头并直接响应预检请求，其他来源不返回 CORS 头、预检返回 403
+func TestCORSMiddleware(t *testing.T) {
+	const allowed = "https://app.example"
+	tests := []struct {
+		name       string
+		origins    []string
+		method     string
+		origin     string
+		wantStatus int
+		wantCORS   bool
+	}{
+		{name: "allowed origin", origins: []string{allowed}, method: http.MethodGet, origin: allowed, wantStatus: http.StatusOK, wantCORS: true},
+		{name: "allowed origin preflight", origins: []string{allowed}, method: http.MethodOptions, origin: allowed, wantStatus: http.StatusNoContent, wantCORS: true},
+		{name: "blocked origin", origins: []string{allowed}, method: http.MethodGet, origin: "https://evil.example", wantStatus: http.StatusOK},
+		{name: "blocked origin preflight", origins: []string{allowed}, method: http.MethodOptions, origin: "https://evil.example", wantStatus: http.StatusForbidden},
+		{name: "wildcard", origins: []string{"*"}, method: http.MethodGet, origin: "https://any.example", wantStatus: http.StatusOK, wantCORS: true},
+		{name: "no origin header", origins: []string{allowed}, method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "cors disabled", method: http.MethodGet, origin: allowed, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newTestRouter(t, &AppConfig{CORSOrigins: tt.origins})
+			req := httptest.NewRequest(tt.method, "/ping", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("返回 %d，期望 %d", w.Code, tt.wantStatus)
+			}
+			gotOrigin := w.Header().Get("Access-Control-Allow-Origin")
+			if tt.wantCORS {
+				if gotOrigin != tt.origin || w.Header().Get("Access-Control-Allow-Methods") == "" || w.Header().Get("Access-Control-Allow-Headers") == "" {
+					t.Fatalf("CORS 响应头 %v，期望允许来源 %s", w.Header(), tt.origin)
+				}
+				return
+			}
+			if gotOrigin != "" || w.Header().Get("Access-Control-Allow-Methods") != "" {
+				t.Fatalf("CORS 响应头 %v，期望不返回", w.Header())
+			}
+		})
+	}
+}
+
+// TestAPIKeyMiddleware 配置了 API_KEY 时接口需要通过 Authorization: Bearer 或 X-API-Key 携带密钥，
+// 缺失或错误返回 401 JSON；/ping 与 /healthz 不需要密钥
+func TestAPIKeyMiddleware(t *testing.T) {
+	const key = "secret"
+	tests := []struct {
+		name       string
+		path       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{name: "missing key", path: "/pools", wantStatus: http.StatusUnauthorized},
+		{name: "wrong x-api-key", path: "/pools", headers: map[string]string{"X-API-Key": "wrong"}, wantStatus: http.StatusUnauthorized},
+		{name: "wrong bearer", path: "/pools", headers: map[string]string{"Authorization": "Bearer wrong"}, wantStatus: http.StatusUnauthorized},
+		{name: "key without bearer scheme", path: "/pools", headers: map[string]string{"Authorization": key}, wantStatus: http.StatusUnauthorized},
+		{name: "valid bearer", path: "/pools", headers: map[string]string{"Authorization": "Bearer " + key}, wantStatus: http.StatusOK},
+		{name: "valid x-api-key", path: "/pools", headers: map[string]string{"X-API-Key": key}, wantStatus: http.StatusOK},
+		{name: "ping bypasses auth", path: "/ping", wantStatus: http.StatusOK},
+		{name: "healthz bypasses auth", path: "/healthz", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newTestRouter(t, &AppConfig{APIKey: key})
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("%s 返回 %d，期望 %d: %s", tt.path, w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusUnauthorized {
+				return
+			}
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error == "" {
+				t.Fatalf("401 响应体 %q 不是带 error 字段的 JSON: %v", w.Body.String(), err)
+			}
+		})
+	}
+}
+
+// TestBlacklistPoolRoundTrip 通过接口拉黑池子后套利发现不再使用它，解除拉黑后重新参与枚举；
+// 前端跨域调用解除拉黑时预检请求允许 DELETE
+func TestBlacklistPoolRoundTrip(t *testing.T) {
+	tokenA, tokenB := testAddr(1), testAddr(2)
+	target := testAddr(11)
+	router, deps := newTestRouter(t, &AppConfig{CORSOrigins: []string{"https://app.example"}, ArbMaxHops: 2, ArbEnumerateWorkers: 1, ArbEnumerateTimeout: time.Minute})
+	for _, pool := range []poolDetail{
+		testPool(testAddr(10), tokenA, tokenB, units(1000, 18), units(1000, 18), 30),
+		testPool(target, tokenA, tokenB, units(1000, 18), units(1100, 18), 30),
+	} {
+		if err := deps.store.InsertPoolIfNotExists(pool); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ops := deps.arbQueue.SubscribeWith(SubscribeOptions{Buffer: 64})
+
+	call := func(method, path string, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// discover 执行一轮套利发现，返回推送的机会中是否有经过 target 的路径
+	discover := func() (paths int, usesTarget bool) {
+		summary := deps.finder.runDiscovery(context.Background())
+		for {
+			select {
+			case op := <-ops:
+				for _, step := range op.Path {
+					if step.Pool.Address == target {
+						usesTarget = true
+					}
+				}
+			default:
+				return summary.Paths, usesTarget
+			}
+		}
+	}
+
+	if w := call(http.MethodOptions, "/pools/"+target.Hex()+"/blacklist", "https://app.example"); w.Code != http.StatusNoContent ||
+		!strings.Contains(w.Header().Get("Access-Control-Allow-Methods"), http.MethodDelete) {
+		t.Fatalf("DELETE 预检返回 %d，允许方法 %q，期望 204 且包含 DELETE", w.Code, w.Header().Get("Access-Control-Allow-Methods"))
+	}
+
+	steps := []struct {
+		name            string
+		method          string
+		address         common.Address
+		wantStatus      int
+		wantBlacklisted bool
+		wantUsed        bool
+	}{
+		{name: "unknown pool", method: http.MethodPost, address: testAddr(99), wantStatus: http.StatusNotFound, wantUsed: true},
+		{name: "blacklist", method: http.MethodPost, address: target, wantStatus: http.StatusOK, wantBlacklisted: true},
+		{name: "un-blacklist", method: http.MethodDelete, address: target, wantStatus: http.StatusOK, wantUsed: true},
+	}
+	for _, step := range steps {
+		if w := call(step.method, "/pools/"+step.address.Hex()+"/blacklist", ""); w.Code != step.wantStatus {
+			t.Fatalf("%s: 返回 %d，期望 %d: %s", step.name, w.Code, step.wantStatus, w.Body.String())
+		}
+		if got := deps.blacklist.Contains(target); got != step.wantBlacklisted {
+			t.Fatalf("%s: 拉黑状态 %v，期望 %v", step.name, got, step.wantBlacklisted)
+		}
+		pool, ok, err := deps.store.GetPool(context.Background(), target)
+		if err != nil || !ok || pool.Blacklisted != step.wantBlacklisted {
+			t.Fatalf("%s: 存储中的拉黑标记 %v (%v, %v)，期望 %v", step.name, pool.Blacklisted, ok, err, step.wantBlacklisted)
+		}
+		// 每轮发现前清除已推送路径的静默期，使解除拉黑后同一路径可以再次推送
+		deps.finder.seenPaths = make(map[string]time.Time)
+		paths, used := discover()
+		if used != step.wantUsed || (step.wantBlacklisted && paths != 0) {
+			t.Fatalf("%s: 枚举 %d 条路径，经过被测池子 %v，期望 %v", step.name, paths, used, step.wantUsed)
+		}
+	}
+}
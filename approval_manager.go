@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// approvalPendingTTL 授权交易提交后超过该时长额度仍不足时视为未上链，允许重新提交
+const approvalPendingTTL = 2 * time.Minute
+
+var (
+	// maxApproval uint256 最大值，EXECUTOR_APPROVE_MAX 开启时按该额度授权
+	maxApproval = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	// unlimitedAllowance 额度不低于 2^255 时视为无限授权：最大额度授权会随使用略微减少，但不会低于该值
+	unlimitedAllowance = new(big.Int).Lsh(big.NewInt(1), 255)
+)
+
+// errApprovalPending 本次执行需要的授权交易已提交但尚未上链，跳过本次执行；不计入执行熔断
+var errApprovalPending = errors.New("授权交易尚未上链，跳过本次执行")
+
+// approvalKey 授权的 (代币, spender) 对
+type approvalKey struct {
+	token   common.Address
+	spender common.Address
+}
+
+// approvalSendFunc 发送调用 to 合约、calldata 为 data 的交易，返回交易哈希
+type approvalSendFunc func(ctx context.Context, to common.Address, data []byte) (common.Hash, error)
+
+// ApprovalManager 执行套利前检查发送账户（owner，即 EOA）对套利执行合约的起始代币授权额度：
+// 执行合约只从账户拉取起始代币，中间代币在合约内部流转，由合约自己授权给路由，账户不需要也不应授权中间代币；
+// 额度不足时提交 approve 交易，本次执行跳过，等授权上链后由后续机会执行。已确认为无限授权的代币缓存在内存中，之后不再查询
+type ApprovalManager struct {
+	caller ethereum.ContractCaller
+	owner  common.Address
+	send   approvalSendFunc
+	cfg    *AppConfig
+	erc20  abi.ABI
+
+	mu       sync.Mutex
+	approved map[approvalKey]struct{}
+	pending  map[approvalKey]time.Time
+}
+
+// NewApprovalManager 创建授权管理器，owner 为发送套利交易的账户
+func NewApprovalManager(caller ethereum.ContractCaller, owner common.Address, send approvalSendFunc, cfg *AppConfig) (*ApprovalManager, error) {
+	return &ApprovalManager{
+		caller:   caller,
+		owner:    owner,
+		send:     send,
+		cfg:      cfg,
+		erc20:    erc20ABI,
+		approved: make(map[approvalKey]struct{}),
+		pending:  make(map[approvalKey]time.Time),
+	}, nil
+}
+
+// Ensure 确认账户对执行合约的起始代币授权额度不低于 amountIn；额度不足时提交授权交易并返回 errApprovalPending
+// 起始代币为原生 BNB 时随交易转入，不需要授权
+func (am *ApprovalManager) Ensure(ctx context.Context, opportunity ArbitrageOpportunity, amountIn *big.Int) error {
+	if len(opportunity.Path) == 0 {
+		return nil
+	}
+	token := common.HexToAddress(opportunity.Path[0].FromToken)
+	if token == nativeToken {
+		return nil
+	}
+	key := approvalKey{token: token, spender: am.cfg.ExecutorContract}
+	if am.isApproved(key) {
+		return nil
+	}
+	allowance, err := am.allowance(ctx, key)
+	if err != nil {
+		return fmt.Errorf("查询代币 %s 对 %s 的授权额度失败: %w", key.token.Hex(), key.spender.Hex(), err)
+	}
+	if allowance.Cmp(unlimitedAllowance) >= 0 {
+		am.markApproved(key)
+		return nil
+	}
+	if allowance.Cmp(amountIn) >= 0 {
+		am.clearPending(key)
+		return nil
+	}
+	if am.isPending(key) {
+		return fmt.Errorf("%w: 代币 %s", errApprovalPending, key.token.Hex())
+	}
+
+	amount := amountIn
+	if am.cfg.ExecutorApproveMax {
+		amount = maxApproval
+	}
+	data, err := am.erc20.Pack("approve", key.spender, amount)
+	if err != nil {
+		return fmt.Errorf("编码 approve 调用失败: %w", err)
+	}
+	txHash, err := am.send(ctx, key.token, data)
+	if err != nil {
+		return fmt.Errorf("提交代币 %s 对 %s 的授权交易失败: %w", key.token.Hex(), key.spender.Hex(), err)
+	}
+	am.markPending(key)
+	log.Printf("代币 %s 对执行合约 %s 的授权额度不足（当前 %s，需要 %s），已提交授权交易 %s，额度 %s",
+		key.token.Hex(), key.spender.Hex(), allowance, amountIn, txHash.Hex(), amount)
+	return fmt.Errorf("%w: 代币 %s", errApprovalPending, key.token.Hex())
+}
+
+// allowance 查询账户对 spender 的授权额度
+func (am *ApprovalManager) allowance(ctx context.Context, key approvalKey) (*big.Int, error) {
+	data, err := am.erc20.Pack("allowance", am.owner, key.spender)
+	if err != nil {
+		return nil, err
+	}
+	callCtx, cancel := withRPCTimeout(ctx, am.cfg.RPCCallTimeout)
+	defer cancel()
+	result, err := am.caller.CallContract(callCtx, ethereum.CallMsg{To: &key.token, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	values, err := am.erc20.Unpack("allowance", result)
+	if err != nil {
+		return nil, err
+	}
+	allowance, ok := values[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("allowance 返回值类型非法")
+	}
+	return allowance, nil
+}
+
+func (am *ApprovalManager) isApproved(key approvalKey) bool {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	_, ok := am.approved[key]
+	return ok
+}
+
+func (am *ApprovalManager) markApproved(key approvalKey) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.approved[key] = struct{}{}
+	delete(am.pending, key)
+}
+
+// isPending 判断该 (代币, spender) 是否有未超过 approvalPendingTTL 的授权交易
+func (am *ApprovalManager) isPending(key approvalKey) bool {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	submittedAt, ok := am.pending[key]
+	return ok && time.Since(submittedAt) < approvalPendingTTL
+}
+
+func (am *ApprovalManager) markPending(key approvalKey) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.pending[key] = time.Now()
+}
+
+func (am *ApprovalManager) clearPending(key approvalKey) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	delete(am.pending, key)
+}
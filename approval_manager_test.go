@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// mockAllowanceCaller 按 (代币, spender) 返回授权额度，记录每次查询的代币、owner 与 spender
+type mockAllowanceCaller struct {
+	allowances map[approvalKey]*big.Int
+
+	mu      sync.Mutex
+	queries []approvalKey
+	owners  []common.Address
+}
+
+func (c *mockAllowanceCaller) CallContract(_ context.Context, msg ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	values, err := erc20ABI.Methods["allowance"].Inputs.Unpack(msg.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	key := approvalKey{token: *msg.To, spender: values[1].(common.Address)}
+	c.mu.Lock()
+	c.queries = append(c.queries, key)
+	c.owners = append(c.owners, values[0].(common.Address))
+	c.mu.Unlock()
+	allowance := c.allowances[key]
+	if allowance == nil {
+		allowance = new(big.Int)
+	}
+	return erc20ABI.Methods["allowance"].Outputs.Pack(allowance)
+}
+
+// TestApprovalManagerEnsure 只检查 EOA 对执行合约的起始代币授权，中间代币从不查询也从不授权
+func TestApprovalManagerEnsure(t *testing.T) {
+	owner, executor, router := testAddr(50), testAddr(51), testAddr(52)
+	start, mid, last := testAddr(1), testAddr(2), testAddr(3)
+	path := func(tokens ...common.Address) []ArbitrageStep {
+		steps := make([]ArbitrageStep, 0, len(tokens)-1)
+		for i := 0; i+1 < len(tokens); i++ {
+			steps = append(steps, ArbitrageStep{
+				Pool:      testPool(testAddr(100+i), tokens[i], tokens[i+1], units(1000, 18), units(1000, 18), 30),
+				FromToken: tokens[i].Hex(),
+				ToToken:   tokens[i+1].Hex(),
+				Protocol:  ProtocolUniswapV2Like,
+				FeePips:   3000,
+			})
+		}
+		return steps
+	}
+	amountIn := units(1, 18)
+
+	tests := []struct {
+		name       string
+		path       []ArbitrageStep
+		allowances map[approvalKey]*big.Int
+		approveMax bool
+		wantErr    error
+		// wantQueries 期望查询的 (代币, spender)
+		wantQueries []approvalKey
+		// wantApproved 期望提交授权的数量，nil 表示不提交
+		wantApproved *big.Int
+	}{
+		{
+			name:        "unlimited start token allowance",
+			path:        path(start, mid, last, start),
+			allowances:  map[approvalKey]*big.Int{{token: start, spender: executor}: maxApproval},
+			wantQueries: []approvalKey{{token: start, spender: executor}},
+		},
+		{
+			name:        "sufficient allowance, intermediates unapproved",
+			path:        path(start, mid, last, start),
+			allowances:  map[approvalKey]*big.Int{{token: start, spender: executor}: amountIn},
+			wantQueries: []approvalKey{{token: start, spender: executor}},
+		},
+		{
+			name:         "insufficient allowance approves exact amount",
+			path:         path(start, mid, start),
+			allowances:   map[approvalKey]*big.Int{{token: start, spender: executor}: big.NewInt(1)},
+			wantErr:      errApprovalPending,
+			wantQueries:  []approvalKey{{token: start, spender: executor}},
+			wantApproved: amountIn,
+		},
+		{
+			name:         "insufficient allowance approves max",
+			path:         path(start, mid, start),
+			approveMax:   true,
+			wantErr:      errApprovalPending,
+			wantQueries:  []approvalKey{{token: start, spender: executor}},
+			wantApproved: maxApproval,
+		},
+		{
+			name: "native start token needs no approval",
+			path: path(nativeToken, mid, nativeToken),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller := &mockAllowanceCaller{allowances: tt.allowances}
+			type approval struct {
+				token   common.Address
+				spender common.Address
+				amount  *big.Int
+			}
+			var sent []approval
+			send := func(_ context.Context, to common.Address, data []byte) (common.Hash, error) {
+				values, err := erc20ABI.Methods["approve"].Inputs.Unpack(data[4:])
+				if err != nil {
+					return common.Hash{}, err
+				}
+				sent = append(sent, approval{token: to, spender: values[0].(common.Address), amount: values[1].(*big.Int)})
+				return common.Hash{1}, nil
+			}
+			cfg := &AppConfig{
+				ExecutorContract:   executor,
+				ExecutorApproveMax: tt.approveMax,
+				ExecRouters:        map[string]routerConfig{ProtocolUniswapV2Like: {Address: router}},
+			}
+			am, err := NewApprovalManager(caller, owner, send, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = am.Ensure(context.Background(), ArbitrageOpportunity{Path: tt.path}, amountIn)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Ensure 返回 %v，期望 %v", err, tt.wantErr)
+			}
+			if len(caller.queries) != len(tt.wantQueries) {
+				t.Fatalf("查询了 %v，期望 %v", caller.queries, tt.wantQueries)
+			}
+			for i, key := range tt.wantQueries {
+				if caller.queries[i] != key || caller.owners[i] != owner {
+					t.Fatalf("第 %d 次查询 owner %s 对 %+v，期望 owner %s 对 %+v", i, caller.owners[i].Hex(), caller.queries[i], owner.Hex(), key)
+				}
+			}
+			if tt.wantApproved == nil {
+				if len(sent) != 0 {
+					t.Fatalf("提交了授权 %+v，期望不提交", sent)
+				}
+				return
+			}
+			if len(sent) != 1 || sent[0].token != start || sent[0].spender != executor || sent[0].amount.Cmp(tt.wantApproved) != 0 {
+				t.Fatalf("提交了授权 %+v，期望起始代币 %s 对执行合约 %s 授权 %s", sent, start.Hex(), executor.Hex(), tt.wantApproved)
+			}
+
+			// 授权交易未上链前再次执行不重复提交
+			if err := am.Ensure(context.Background(), ArbitrageOpportunity{Path: tt.path}, amountIn); !errors.Is(err, errApprovalPending) {
+				t.Fatalf("授权未上链时 Ensure 返回 %v，期望 errApprovalPending", err)
+			}
+			if len(sent) != 1 {
+				t.Fatalf("授权未上链时重复提交了 %d 笔授权", len(sent)-1)
+			}
+		})
+	}
+}
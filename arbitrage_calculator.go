@@ -2,61 +2,506 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"math/big"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
+// optimalInputIterations 黄金分割搜索最优投入量的迭代次数上限，足以把 1e30 量级的区间缩小到最小单位
+const optimalInputIterations = 200
+
+// executionCost 执行一笔套利交易需要付出的成本（USD）
+type executionCost struct {
+	// GasUSD 按每跳 gas 与 gas 价格估算的基础 gas 成本
+	GasUSD float64
+	// PriorityFeeUSD 固定优先费
+	PriorityFeeUSD float64
+	// BribeUSD 按毛利润比例支付的贿赂
+	BribeUSD float64
+}
+
+// Total 执行成本合计
+func (c executionCost) Total() float64 {
+	return c.GasUSD + c.PriorityFeeUSD + c.BribeUSD
+}
+
 // ArbitrageCalculator 负责对套利机会进行精细化计算
 type ArbitrageCalculator struct {
-	queue *ArbitrageQueue
-	cfg   *AppConfig
+	queue     *ArbitrageQueue
+	cfg       *AppConfig
+	store     Store
+	oracle    *PriceOracle
+	gas       *GasOracle
+	tokens    *TokenRegistry
+	simulator *ExecutionSimulator
+	v3Quoter  *V3Quoter
+	executor  Executor
+	breaker   *CircuitBreaker
+	notifier  *MultiNotifier
+	// paper 模拟交易账本，未开启 PAPER_TRADING 时为 nil
+	paper *PaperLedger
+	// stale 因排队超过 ARB_MAX_AGE 而丢弃的机会数量
+	stale atomic.Uint64
 }
 
-// NewArbitrageCalculator 创建套利路径计算者
-func NewArbitrageCalculator(queue *ArbitrageQueue, cfg *AppConfig) *ArbitrageCalculator {
-	return &ArbitrageCalculator{
-		queue: queue,
-		cfg:   cfg,
+// NewArbitrageCalculator 创建套利路径计算者，gas 为 nil 时按 EXEC_GAS_PRICE_GWEI 估算 gas 成本，simulator 为 nil 时跳过模拟执行，
+// v3Quoter 为 nil 时 V3 池子使用近似报价，executor 为 nil 时只记录日志，breaker 为 nil 时不熔断，notifier 为 nil 时不推送通知
+// 开启 PAPER_TRADING 时同时创建模拟交易账本
+func NewArbitrageCalculator(queue *ArbitrageQueue, cfg *AppConfig, store Store, oracle *PriceOracle, gas *GasOracle, tokens *TokenRegistry, simulator *ExecutionSimulator, v3Quoter *V3Quoter, executor Executor, breaker *CircuitBreaker, notifier *MultiNotifier) *ArbitrageCalculator {
+	if executor == nil {
+		executor = LogExecutor{}
+	}
+	if breaker == nil {
+		breaker = NewCircuitBreaker(&AppConfig{})
+	}
+	ac := &ArbitrageCalculator{
+		queue:     queue,
+		cfg:       cfg,
+		store:     store,
+		oracle:    oracle,
+		gas:       gas,
+		tokens:    tokens,
+		simulator: simulator,
+		v3Quoter:  v3Quoter,
+		executor:  executor,
+		breaker:   breaker,
+		notifier:  notifier,
 	}
+	if cfg.PaperTrading {
+		ac.paper = NewPaperLedger(store, ac.requote, cfg)
+	}
+	return ac
 }
 
-// Start 开始处理套利机会
+// Start 开始处理套利机会；ctx 取消后等待模拟交易账本的复核协程记账完成才返回
 func (ac *ArbitrageCalculator) Start(ctx context.Context) {
+	opportunities := ac.queue.Subscribe()
+	defer ac.queue.Unsubscribe(opportunities)
+	if ac.paper != nil {
+		defer ac.paper.Wait()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case opportunity := <-ac.queue.Subscribe():
+		case opportunity, ok := <-opportunities:
+			if !ok {
+				return
+			}
 			ac.handleOpportunity(ctx, opportunity)
 		}
 	}
 }
 
+// StaleDropped 返回因排队超过 ARB_MAX_AGE 而丢弃的机会数量
+func (ac *ArbitrageCalculator) StaleDropped() uint64 {
+	return ac.stale.Load()
+}
+
+// handleOpportunity 精算、模拟并提交一个套利机会；发布后排队超过 ARB_MAX_AGE 的机会所依据的储备量已过时，直接丢弃
 func (ac *ArbitrageCalculator) handleOpportunity(ctx context.Context, opportunity ArbitrageOpportunity) {
-	log.Printf("套利机会入队 (跳数 %d): 初始 %.6f USDT, 估算 %.6f USDT, 路径: %s",
-		len(opportunity.Path), opportunity.InitialAmount, opportunity.EstimatedReturn, formatOpportunityPath(opportunity))
-	detailReturn, profitable := ac.calculateDetailedProfit(ctx, opportunity)
+	if age := time.Since(opportunity.DiscoveredAt); ac.cfg.ArbMaxAge > 0 && !opportunity.DiscoveredAt.IsZero() && age > ac.cfg.ArbMaxAge {
+		dropped := ac.stale.Add(1)
+		log.Printf("丢弃过期套利机会 (stale): 排队 %s 超过 ARB_MAX_AGE %s，累计丢弃 %d 个, 路径: %s",
+			age.Round(time.Millisecond), ac.cfg.ArbMaxAge, dropped, formatOpportunityPath(opportunity))
+		return
+	}
+	logOpportunity(ac.cfg, ac.tokens, ac.oracle, "queued", opportunity, "套利机会入队 (跳数 %d): 初始 %s, 估算 %s, 路径: %s",
+		len(opportunity.Path), ac.formatAmount(opportunity, opportunity.InitialAmount), ac.formatAmount(opportunity, opportunity.EstimatedReturn), formatOpportunityPath(opportunity))
+	refined, profitable, err := ac.calculateDetailedProfit(ctx, opportunity)
+	if err != nil {
+		log.Printf("套利机会精算失败: %v, 路径: %s", err, formatOpportunityPath(opportunity))
+		return
+	}
 	if !profitable {
-		log.Printf("套利机会经精算后无效 (跳数 %d): 初始 %.6f USDT, 估算 %.6f USDT, 路径: %s",
-			len(opportunity.Path), opportunity.InitialAmount, detailReturn, formatOpportunityPath(opportunity))
+		logOpportunity(ac.cfg, ac.tokens, ac.oracle, "rejected", refined, "套利机会经精算后无效 (跳数 %d): 最优投入 %s, 精算 %s, 价格冲击 %s, 执行成本 %.4f USD, 路径: %s",
+			len(refined.Path), ac.formatAmount(refined, refined.InitialAmount), ac.formatAmount(refined, refined.EstimatedReturn),
+			formatPriceImpacts(refined), refined.Cost.Total(), formatOpportunityPath(opportunity))
 		return
 	}
+	// 后续模拟执行与提交都以精算后的最优投入量为准
+	opportunity = refined
+	detailReturn := refined.EstimatedReturn
+
+	logOpportunity(ac.cfg, ac.tokens, ac.oracle, "confirmed", opportunity, "确认套利机会: 起始代币 %s, 跳数 %d, 初始 %s -> 预期 %s, 利润 %s, 价格冲击 %s, gas %.4f USD, 优先费 %.4f USD, 贿赂 %.4f USD, 路径: %s",
+		opportunity.StartToken, len(opportunity.Path), ac.formatAmount(opportunity, opportunity.InitialAmount), ac.formatAmount(opportunity, detailReturn),
+		ac.formatAmount(opportunity, detailReturn-opportunity.InitialAmount), formatPriceImpacts(opportunity),
+		opportunity.Cost.GasUSD, opportunity.Cost.PriorityFeeUSD, opportunity.Cost.BribeUSD, formatOpportunityPath(opportunity))
+	// 统计记录只供 /stats 使用，写入（含瞬时错误重试）放到模拟执行与提交之后，不拖慢提交
+	defer ac.recordOpportunity(opportunity, detailReturn)
+	if ac.paper != nil {
+		unitPrice, priced := ac.profitUSD(opportunity, 1)
+		ac.paper.Record(ctx, opportunity, unitPrice, priced)
+	}
 
-	log.Printf("确认套利机会: 起始代币 %s, 跳数 %d, 初始 %.6f USDT -> 预期 %.6f USDT, 利润 %.6f, 路径: %s",
-		opportunity.StartToken, len(opportunity.Path), opportunity.InitialAmount, detailReturn,
-		detailReturn-opportunity.InitialAmount, formatOpportunityPath(opportunity))
+	if ac.simulator != nil {
+		if err := ac.verifyExecution(ctx, opportunity); err != nil {
+			log.Printf("套利机会模拟执行未通过: %v, 路径: %s", err, formatOpportunityPath(opportunity))
+			return
+		}
+	}
 	ac.submitExecution(ctx, opportunity, detailReturn)
 }
 
-func (ac *ArbitrageCalculator) calculateDetailedProfit(ctx context.Context, opportunity ArbitrageOpportunity) (float64, bool) {
-	// TODO: 在此处实现链下详细计算逻辑，例如结合实时储备、滑点模型等
-	return opportunity.EstimatedReturn, opportunity.EstimatedReturn-opportunity.InitialAmount >= ac.cfg.ArbMinProfit
+// verifyExecution 模拟执行套利路径，模拟输出与估算输出的相对偏差超过容忍度时返回错误
+// 估算输出为 0 时无法计算相对偏差，直接视为未通过
+func (ac *ArbitrageCalculator) verifyExecution(ctx context.Context, opportunity ArbitrageOpportunity) error {
+	if opportunity.EstimatedReturn <= 0 {
+		return fmt.Errorf("估算输出为 %.6f，无法与模拟结果比较", opportunity.EstimatedReturn)
+	}
+	simulated, err := ac.simulator.SimulateExecution(ctx, opportunity)
+	if err != nil {
+		return err
+	}
+
+	simulatedReturn, _ := new(big.Float).SetInt(simulated).Float64()
+	deviation := math.Abs(simulatedReturn-opportunity.EstimatedReturn) / opportunity.EstimatedReturn
+	log.Printf("模拟执行完成: 估算 %.6f, 模拟 %.6f, 偏差 %.2f%%", opportunity.EstimatedReturn, simulatedReturn, deviation*100)
+	if deviation > ac.cfg.ExecSimTolerance {
+		return fmt.Errorf("模拟输出 %.6f 与估算 %.6f 偏差 %.2f%% 超过容忍度 %.2f%%",
+			simulatedReturn, opportunity.EstimatedReturn, deviation*100, ac.cfg.ExecSimTolerance*100)
+	}
+	return nil
+}
+
+// calculateDetailedProfit 使用存储中最新的储备量重新计算套利路径
+// 先按利润最大化搜索最优投入量，再在该投入量下逐跳计算输出与价格冲击，
+// 返回以最优投入量重写的套利机会（InitialAmount、EstimatedReturn、每跳 PriceImpact 与执行成本），
+// 以及扣除价格冲击、gas、优先费与贿赂后的净利润是否达到收益门槛：
+// 起始代币配置了 ARB_MIN_PROFIT_WEI 或没有 USD 价格时按整数比较返回量与 minReturn（投入量 + 执行成本 + 门槛），
+// 否则按 USD 比较净利润与 ArbMinProfit
+func (ac *ArbitrageCalculator) calculateDetailedProfit(ctx context.Context, opportunity ArbitrageOpportunity) (ArbitrageOpportunity, bool, error) {
+	path, err := ac.refreshPath(ctx, opportunity)
+	if err != nil {
+		return opportunity, false, err
+	}
+
+	amountInInt := ac.optimalInput(path, floatToAmount(ac.capitalLimit(opportunity)))
+	amountOutInt, impacts, err := ac.quotePath(path, amountInInt)
+	if err != nil {
+		return opportunity, false, err
+	}
+	amountIn, _ := new(big.Float).SetInt(amountInInt).Float64()
+	amountOut, _ := new(big.Float).SetInt(amountOutInt).Float64()
+
+	refined := opportunity
+	refined.Path = make([]ArbitrageStep, len(opportunity.Path))
+	for i, step := range opportunity.Path {
+		step.Pool = path[i].Pool
+		step.PriceImpact = impacts[i]
+		refined.Path[i] = step
+	}
+	refined.InitialAmount = amountIn
+	refined.EstimatedReturn = amountOut
+
+	if amountOutInt.Cmp(amountInInt) <= 0 {
+		return refined, false, nil
+	}
+	profit, _ := new(big.Float).SetInt(new(big.Int).Sub(amountOutInt, amountInInt)).Float64()
+	grossUSD, priced := ac.profitUSD(refined, profit)
+	if priced {
+		refined.Cost, err = ac.estimateExecutionCost(path, grossUSD)
+		if err != nil {
+			return refined, false, err
+		}
+	}
+	refined.MinReturn = ac.minReturn(refined, amountInInt)
+	if _, ok := ac.minProfitWei(refined); ok || !priced {
+		// 整数门槛不经过浮点换算，恰好达到门槛的机会不会因舍入被拒绝；
+		// 没有 USD 价格时无法扣除以 USD 计的执行成本，与发现阶段一致按代币最小单位数量比较
+		return refined, amountOutInt.Cmp(refined.MinReturn) >= 0, nil
+	}
+	return refined, grossUSD-refined.Cost.Total() >= ac.cfg.ArbMinProfit, nil
+}
+
+// minProfitWei 返回起始代币在 ARB_MIN_PROFIT_WEI 中配置的整数收益门槛，未配置时第二个返回值为 false
+func (ac *ArbitrageCalculator) minProfitWei(opportunity ArbitrageOpportunity) (*big.Int, bool) {
+	wei, ok := ac.cfg.ArbMinProfitWei[common.HexToAddress(opportunity.StartToken)]
+	return wei, ok
+}
+
+// minReturn 链上执行时要求的最少返回量：投入量 amountIn 加上执行成本与收益门槛，均换算为起始代币最小单位并向上取整
+// 价格变化使返回量不足以覆盖成本与收益门槛时交易回滚，只损失 gas，不会以亏损成交；
+// 起始代币配置了 ARB_MIN_PROFIT_WEI 时门槛直接按该整数计，否则按 ARB_MIN_PROFIT 换算；
+// 没有 USD 价格时无法换算成本，与 calculateDetailedProfit 一致按代币最小单位数量加上门槛
+func (ac *ArbitrageCalculator) minReturn(opportunity ArbitrageOpportunity, amountIn *big.Int) *big.Int {
+	unitUSD, priced := ac.profitUSD(opportunity, 1)
+	minReturn := new(big.Int).Set(amountIn)
+	if wei, ok := ac.minProfitWei(opportunity); ok {
+		if priced {
+			minReturn.Add(minReturn, floatToAmount(math.Ceil(opportunity.Cost.Total()/unitUSD)))
+		}
+		return minReturn.Add(minReturn, wei)
+	}
+	margin := ac.cfg.ArbMinProfit
+	if priced {
+		margin = (opportunity.Cost.Total() + ac.cfg.ArbMinProfit) / unitUSD
+	}
+	return minReturn.Add(minReturn, floatToAmount(math.Ceil(margin)))
+}
+
+// estimateExecutionCost 估算执行成本：基础 gas（每跳 gas × gas 价格，包装/解包按 EXEC_WRAP_GAS 计）、固定优先费与按毛利润比例的贿赂
+// gas 价格取 GasOracle 最近一次的实际支付价格，尚未获取到时按 EXEC_GAS_PRICE_GWEI
+// BSC 上 MEV 交易通常需要向验证者额外付费才能被打包，忽略这部分成本会高估净利润
+func (ac *ArbitrageCalculator) estimateExecutionCost(path []graphEdge, grossUSD float64) (executionCost, error) {
+	cost := executionCost{BribeUSD: grossUSD * ac.cfg.ExecBribePercent / 100}
+
+	swaps := 0
+	for _, step := range path {
+		if step.Protocol != ProtocolWrapNative {
+			swaps++
+		}
+	}
+	gas := ac.cfg.ExecGasPerHop*uint64(swaps) + ac.cfg.ExecWrapGas*uint64(wrapCount(path))
+	gasWei := float64(gas) * ac.gasPriceWei()
+	priorityWei := ac.cfg.ExecPriorityFeeBNB * 1e18
+	if gasWei == 0 && priorityWei == 0 {
+		return cost, nil
+	}
+	bnbPrice, ok := ac.oracle.PriceOf(ac.cfg.WrappedNative)
+	if !ok {
+		return cost, fmt.Errorf("WBNB 价格未知，无法估算 gas 与优先费")
+	}
+	cost.GasUSD = gasWei * bnbPrice
+	cost.PriorityFeeUSD = priorityWei * bnbPrice
+	return cost, nil
+}
+
+// gasPriceWei 返回估算执行成本使用的每单位 gas 价格（wei）
+func (ac *ArbitrageCalculator) gasPriceWei() float64 {
+	if ac.gas != nil {
+		if price, ok := ac.gas.Current(); ok {
+			wei, _ := new(big.Float).SetInt(price.Effective()).Float64()
+			return wei
+		}
+	}
+	return ac.cfg.ExecGasPriceGwei * 1e9
+}
+
+// refreshPath 从存储读取路径中每个池子的最新储备量，池子已不在存储中时沿用发现时的快照
+// 开启 V3 精确报价时同时加载 V3 池子沿本跳方向的 tick 数据，加载失败的池子退回近似报价
+func (ac *ArbitrageCalculator) refreshPath(ctx context.Context, opportunity ArbitrageOpportunity) ([]graphEdge, error) {
+	path := make([]graphEdge, 0, len(opportunity.Path))
+	for _, step := range opportunity.Path {
+		pool, ok, err := ac.store.GetPool(ctx, step.Pool.Address)
+		if err != nil {
+			return nil, fmt.Errorf("读取池子 %s 失败: %w", step.Pool.Address.Hex(), err)
+		}
+		if !ok {
+			pool = step.Pool
+		}
+		edge := graphEdge{
+			Pool:      pool,
+			Protocol:  step.Protocol,
+			FeePips:   pool.FeePipsFrom(common.HexToAddress(step.FromToken)),
+			FromToken: common.HexToAddress(step.FromToken),
+			ToToken:   common.HexToAddress(step.ToToken),
+		}
+		if ac.v3Quoter != nil && pool.Protocol == ProtocolUniswapV3 {
+			state, err := ac.v3Quoter.LoadState(ctx, pool.Address, edge.FromToken == pool.Token0())
+			if err != nil {
+				log.Printf("加载 V3 池子 %s 的 tick 数据失败，使用近似报价: %v", pool.Address.Hex(), err)
+			} else {
+				edge.V3 = state
+			}
+		}
+		path = append(path, edge)
+	}
+	return path, nil
+}
+
+// quotePath 按每个池子的 AMM 公式以最小单位的整数逐跳计算输出（含转账税，每跳向下取整），并返回每跳的价格冲击
+// 价格冲击 = 1 - 成交价 / 现货价，包含手续费，数值越大说明该跳越是整条路径的瓶颈；
+// 整数运算与发现阶段的 simulatePath 一致，长路径不会因 float64 误差累积把保本路径算成盈利
+func (ac *ArbitrageCalculator) quotePath(path []graphEdge, amountIn *big.Int) (*big.Int, []float64, error) {
+	impacts := make([]float64, len(path))
+	amount := applyTransferTaxInt(amountIn, ac.tokens.TaxBps(path[0].FromToken))
+	for i, step := range path {
+		out, err := quoteHopInt(step, amount)
+		if err != nil {
+			return nil, nil, err
+		}
+		if spot := spotPrice(step); spot > 0 && amount.Sign() > 0 {
+			rate, _ := new(big.Rat).SetFrac(out, amount).Float64()
+			impacts[i] = 1 - rate/spot
+		}
+		amount = applyTransferTaxInt(out, ac.tokens.TaxBps(step.ToToken))
+	}
+	return amount, impacts, nil
+}
+
+// requote 按存储中的最新储备量重新计算套利路径在 amountIn 下的输出，供模拟交易账本复核
+func (ac *ArbitrageCalculator) requote(ctx context.Context, opportunity ArbitrageOpportunity, amountIn float64) (float64, error) {
+	path, err := ac.refreshPath(ctx, opportunity)
+	if err != nil {
+		return 0, err
+	}
+	out, _, err := ac.quotePath(path, floatToAmount(amountIn))
+	if err != nil {
+		return 0, err
+	}
+	value, _ := new(big.Float).SetInt(out).Float64()
+	return value, nil
+}
+
+// optimalInput 在 (0, min(首跳输入储备量, maxIn)] 内用黄金分割搜索使利润（输出 - 投入）最大的整数投入量，maxIn 为 nil 或不大于 0 时不限制
+// AMM 路径的输出是投入量的凹函数，利润在区间内单峰，黄金分割搜索可以稳定收敛；区间缩小到 2 个最小单位以内时提前结束
+func (ac *ArbitrageCalculator) optimalInput(path []graphEdge, maxIn *big.Int) *big.Int {
+	reserveIn := path[0].Pool.ReserveOf(path[0].FromToken)
+	if reserveIn == nil || reserveIn.Sign() <= 0 {
+		return new(big.Int)
+	}
+	hi := new(big.Int).Set(reserveIn)
+	if maxIn != nil && maxIn.Sign() > 0 && maxIn.Cmp(hi) < 0 {
+		hi.Set(maxIn)
+	}
+	lo, bound := new(big.Int), new(big.Int).Set(hi)
+
+	// profit 返回 nil 表示报价失败，视为负无穷
+	profit := func(amountIn *big.Int) *big.Int {
+		out, _, err := ac.quotePath(path, amountIn)
+		if err != nil {
+			return nil
+		}
+		return out.Sub(out, amountIn)
+	}
+	less := func(a, b *big.Int) bool {
+		if a == nil {
+			return b != nil
+		}
+		return b != nil && a.Cmp(b) < 0
+	}
+	// golden 返回 (hi - lo) × 0.618，黄金分割比按 1e9 精度的有理数计算
+	golden := func() *big.Int {
+		span := new(big.Int).Sub(hi, lo)
+		span.Mul(span, big.NewInt(618_033_989))
+		return span.Quo(span, big.NewInt(1_000_000_000))
+	}
+
+	x1, x2 := new(big.Int).Sub(hi, golden()), new(big.Int).Add(lo, golden())
+	f1, f2 := profit(x1), profit(x2)
+	for i := 0; i < optimalInputIterations && new(big.Int).Sub(hi, lo).Cmp(big.NewInt(2)) > 0; i++ {
+		if less(f1, f2) {
+			lo, x1, f1 = x1, x2, f2
+			x2 = new(big.Int).Add(lo, golden())
+			f2 = profit(x2)
+		} else {
+			hi, x2, f2 = x2, x1, f1
+			x1 = new(big.Int).Sub(hi, golden())
+			f1 = profit(x1)
+		}
+	}
+	mid := new(big.Int).Add(lo, hi)
+	mid.Rsh(mid, 1)
+	// 资金上限小于最优投入量时利润在区间内单调递增，整数取整使搜索停在上限以下几个最小单位，直接比较上限本身
+	if !less(profit(bound), profit(mid)) {
+		return bound
+	}
+	return mid
+}
+
+// capitalLimit 返回以起始代币最小单位计的可投入资金上限：ARB_INITIAL_CAPITAL 按起始代币价格换算，
+// 起始代币没有价格时沿用发现阶段的投入量；返回 0 表示不限制
+func (ac *ArbitrageCalculator) capitalLimit(opportunity ArbitrageOpportunity) float64 {
+	if unitUSD, ok := ac.profitUSD(opportunity, 1); ok && ac.cfg.ArbInitialCapital > 0 {
+		return ac.cfg.ArbInitialCapital / unitUSD
+	}
+	return opportunity.InitialAmount
+}
+
+// profitUSD 将以起始代币数量计的利润换算为 USD
+// 优先使用发现时记录的价格，其次查询预言机，均未知时返回 false，调用方需自行跳过或按代币数量处理
+func (ac *ArbitrageCalculator) profitUSD(opportunity ArbitrageOpportunity, profit float64) (float64, bool) {
+	if opportunity.StartTokenPriceUSD > 0 {
+		return profit * opportunity.StartTokenPriceUSD, true
+	}
+	if price, ok := ac.oracle.PriceOf(common.HexToAddress(opportunity.StartToken)); ok && price > 0 {
+		return profit * price, true
+	}
+	return 0, false
+}
+
+// recordOpportunity 将确认的套利机会写入存储供 /stats 统计，写入失败只记录日志；
+// 起始代币没有 USD 价格时净利润无法以 USD 计，记为 0 会拉低平均值，不写入
+func (ac *ArbitrageCalculator) recordOpportunity(opportunity ArbitrageOpportunity, expectedReturn float64) {
+	grossUSD, priced := ac.profitUSD(opportunity, expectedReturn-opportunity.InitialAmount)
+	if !priced {
+		return
+	}
+	record := OpportunityRecord{
+		StartToken: common.HexToAddress(opportunity.StartToken),
+		ProfitUSD:  grossUSD - opportunity.Cost.Total(),
+		At:         time.Now(),
+	}
+	for _, step := range opportunity.Path {
+		record.Tokens = append(record.Tokens, common.HexToAddress(step.FromToken))
+		record.Pools = append(record.Pools, step.Pool.Address)
+	}
+	if err := ac.store.RecordOpportunity(record); err != nil {
+		log.Printf("记录套利机会失败: %v", err)
+	}
+}
+
+// formatAmount 以起始代币符号与精度格式化数量，并附带 USD 估值
+func (ac *ArbitrageCalculator) formatAmount(opportunity ArbitrageOpportunity, raw float64) string {
+	return formatTokenAmount(ac.tokens, ac.oracle, common.HexToAddress(opportunity.StartToken), raw)
 }
 
 func (ac *ArbitrageCalculator) submitExecution(ctx context.Context, opportunity ArbitrageOpportunity, expectedReturn float64) {
-	// TODO: 实现交易下单逻辑，例如构建多跳交易并提交到区块链
-	log.Printf("提交套利执行（占位）: 起始 %s, 预期收益 %.6f, 路径长度 %d",
-		opportunity.StartToken, expectedReturn, len(opportunity.Path))
+	if !ac.breaker.Allow() {
+		return
+	}
+	txHash, err := ac.executor.Execute(ctx, opportunity, opportunity.InitialAmount)
+	if errors.Is(err, errApprovalPending) {
+		// 等待授权上链不是执行失败，不计入熔断
+		log.Printf("暂缓提交套利执行: %v, 路径: %s", err, formatOpportunityPath(opportunity))
+		return
+	}
+	if err != nil {
+		log.Printf("提交套利执行失败: %v, 路径: %s", err, formatOpportunityPath(opportunity))
+		ac.breaker.RecordFailure(err.Error())
+		return
+	}
+	if txHash == (common.Hash{}) {
+		// 没有广播交易（仅日志模式），无需等待链上结果
+		ac.breaker.RecordSuccess()
+	} else {
+		// 已广播交易的成败由执行器的结果回调上报熔断器
+		log.Printf("套利交易已广播: %s, 起始 %s, 预期收益 %.6f", txHash.Hex(), opportunity.StartToken, expectedReturn)
+	}
+
+	// 起始代币没有价格时净利润按 0 USD 推送，具体数量见消息中的投入与预期
+	grossUSD, _ := ac.profitUSD(opportunity, expectedReturn-opportunity.InitialAmount)
+	profitUSD := grossUSD - opportunity.Cost.Total()
+	payload := newWebhookPayload(opportunity, expectedReturn, profitUSD)
+	tx := "未广播（仅日志模式）"
+	if txHash != (common.Hash{}) {
+		tx = txHash.Hex()
+	}
+	ac.notifier.NotifyAsync(ctx, NotificationEvent{
+		Kind: NotifyOpportunityConfirmed,
+		Message: fmt.Sprintf("起始代币 %s, 跳数 %d, 投入 %s, 预期 %s, 净利润 %.4f USD, 交易 %s, 路径: %s",
+			opportunity.StartToken, len(opportunity.Path), ac.formatAmount(opportunity, opportunity.InitialAmount),
+			ac.formatAmount(opportunity, expectedReturn), profitUSD, tx, formatOpportunityPath(opportunity)),
+		Opportunity: &payload,
+	})
+}
+
+// formatPriceImpacts 按跳输出价格冲击百分比，例如 "0.35% / 1.20%"
+func formatPriceImpacts(opportunity ArbitrageOpportunity) string {
+	items := make([]string, len(opportunity.Path))
+	for i, step := range opportunity.Path {
+		items[i] = fmt.Sprintf("%.2f%%", step.PriceImpact*100)
+	}
+	return strings.Join(items, " / ")
 }
 
 func formatOpportunityPath(opportunity ArbitrageOpportunity) string {
@@ -76,9 +521,9 @@ func formatOpportunityPath(opportunity ArbitrageOpportunity) string {
 		builder.WriteString(" -> ")
 		builder.WriteString(step.ToToken)
 		builder.WriteString(" (token0=")
-		builder.WriteString(step.Pool.Token0.Hex())
+		builder.WriteString(step.Pool.Token0().Hex())
 		builder.WriteString(", token1=")
-		builder.WriteString(step.Pool.Token1.Hex())
+		builder.WriteString(step.Pool.Token1().Hex())
 		builder.WriteString(")")
 	}
 	return builder.String()
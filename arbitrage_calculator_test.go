@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// newTestCalculator 创建使用临时存储、没有模拟器与执行器的计算者
+func newTestCalculator(t *testing.T, cfg *AppConfig) (*ArbitrageCalculator, *PriceOracle) {
+	t.Helper()
+	store := newTestPoolStore(t)
+	oracle := NewPriceOracle(cfg.WrappedNative)
+	return NewArbitrageCalculator(NewArbitrageQueue(16), cfg, store, oracle, nil, NewTokenRegistry(nil, store, cfg), nil, nil, nil, nil, nil), oracle
+}
+
+// edgeOf 返回沿 from -> to 方向经过 pool 的一跳
+func edgeOf(pool poolDetail, from, to common.Address) graphEdge {
+	return graphEdge{Pool: pool, Protocol: pool.Protocol, FeePips: pool.FeePips, FromToken: from, ToToken: to}
+}
+
+// arbPath 返回 tokenA -> tokenB -> tokenA 的两跳路径，两个池子价格相差约 10%，最优投入量约为数十个代币
+func arbPath(tokenA, tokenB common.Address) []graphEdge {
+	cheap := testPool(testAddr(100), tokenA, tokenB, units(1000, 18), units(1100, 18), 30)
+	dear := testPool(testAddr(101), tokenA, tokenB, units(1100, 18), units(1000, 18), 30)
+	return []graphEdge{edgeOf(cheap, tokenA, tokenB), edgeOf(dear, tokenB, tokenA)}
+}
+
+func TestOptimalInputCapitalLimit(t *testing.T) {
+	tokenA, tokenB := testAddr(1), testAddr(2)
+	path := arbPath(tokenA, tokenB)
+	ac, _ := newTestCalculator(t, &AppConfig{})
+	unbounded := ac.optimalInput(path, nil)
+	if unbounded.Cmp(units(10, 18)) < 0 {
+		t.Fatalf("不限资金时最优投入 %s，期望超过 10 个代币", unbounded)
+	}
+
+	tests := []struct {
+		name  string
+		maxIn *big.Int
+		want  *big.Int
+	}{
+		{name: "capital below optimum", maxIn: units(1, 18), want: units(1, 18)},
+		{name: "capital above optimum", maxIn: units(1000, 18), want: unbounded},
+		{name: "capital above reserve", maxIn: units(1, 30), want: unbounded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ac.optimalInput(path, tt.maxIn)
+			diff := new(big.Int).Sub(got, tt.want)
+			if got.Cmp(tt.maxIn) > 0 || diff.Abs(diff).Cmp(big.NewInt(2)) > 0 {
+				t.Fatalf("最优投入 %s，期望 %s（上限 %s）", got, tt.want, tt.maxIn)
+			}
+		})
+	}
+}
+
+func TestCapitalLimit(t *testing.T) {
+	priced, unpriced := testAddr(1), testAddr(2)
+	ac, oracle := newTestCalculator(t, &AppConfig{ArbInitialCapital: 100})
+	oracle.prices[priced] = 2e-18
+
+	tests := []struct {
+		name        string
+		opportunity ArbitrageOpportunity
+		want        float64
+	}{
+		{name: "capital converted by price", opportunity: ArbitrageOpportunity{StartToken: priced.Hex(), InitialAmount: 1}, want: 50e18},
+		{name: "unpriced falls back to discovery input", opportunity: ArbitrageOpportunity{StartToken: unpriced.Hex(), InitialAmount: 3e18}, want: 3e18},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ac.capitalLimit(tt.opportunity); math.Abs(got-tt.want)/tt.want > 1e-9 {
+				t.Fatalf("资金上限 %g，期望 %g", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMinReturn 链上最少返回量 = 投入量 + 执行成本 + 收益门槛，按起始代币单价换算并向上取整；
+// 配置了 ARB_MIN_PROFIT_WEI 的起始代币门槛直接按整数计
+func TestMinReturn(t *testing.T) {
+	tests := []struct {
+		name      string
+		unitUSD   float64
+		cost      executionCost
+		minProfit float64
+		minWei    *big.Int
+		want      int64
+	}{
+		{name: "priced cost and threshold", unitUSD: 0.25, cost: executionCost{GasUSD: 1}, minProfit: 0.5, want: 1006},
+		{name: "fraction rounds up", unitUSD: 0.25, cost: executionCost{GasUSD: 0.25, BribeUSD: 0.05}, want: 1002},
+		{name: "unpriced uses token units", minProfit: 5, want: 1005},
+		{name: "no cost no threshold", unitUSD: 0.25, want: 1000},
+		{name: "wei threshold replaces usd threshold", unitUSD: 0.25, cost: executionCost{GasUSD: 1}, minProfit: 100, minWei: big.NewInt(7), want: 1011},
+		{name: "wei threshold unpriced", minProfit: 100, minWei: big.NewInt(7), want: 1007},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &AppConfig{ArbMinProfit: tt.minProfit}
+			if tt.minWei != nil {
+				cfg.ArbMinProfitWei = map[common.Address]*big.Int{testAddr(1): tt.minWei}
+			}
+			ac, _ := newTestCalculator(t, cfg)
+			opportunity := ArbitrageOpportunity{StartToken: testAddr(1).Hex(), InitialAmount: 1000, StartTokenPriceUSD: tt.unitUSD, Cost: tt.cost}
+			if got := ac.minReturn(opportunity, big.NewInt(1000)); got.Cmp(big.NewInt(tt.want)) != 0 {
+				t.Fatalf("最少返回量 %s，期望 %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestQuotePathLongCycle 长路径逐跳按整数计算，结果与逐跳调用 getAmountOut 逐位一致；
+// 价格完全一致的保本长环在任何投入量下都不盈利，有价差的长环搜索到的最优投入量确实盈利
+func TestQuotePathLongCycle(t *testing.T) {
+	const hops = 12
+	// cycle 返回 hops 跳的环 token0 -> token1 -> ... -> token0，每个池子 1:1，lastOut 为最后一个池子输出侧的储备量
+	cycle := func(feePips int, lastOut *big.Int) []graphEdge {
+		path := make([]graphEdge, hops)
+		for i := range path {
+			from, to := testAddr(1+i), testAddr(1+(i+1)%hops)
+			reserveOut := units(1_000_000, 18)
+			if i == hops-1 {
+				reserveOut = lastOut
+			}
+			pool := testPool(testAddr(100+i), from, to, units(1_000_000, 18), reserveOut, feePipsToBps(feePips))
+			pool.FeePips = feePips
+			path[i] = edgeOf(pool, from, to)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name           string
+		path           []graphEdge
+		wantProfitable bool
+	}{
+		{name: "break-even without fees", path: cycle(0, units(1_000_000, 18))},
+		{name: "break-even with sub-bps fees", path: cycle(1, units(1_000_000, 18))},
+		{name: "one wei of edge is not profit", path: cycle(0, new(big.Int).Add(units(1_000_000, 18), big.NewInt(1)))},
+		{name: "mispriced last hop", path: cycle(100, units(1_010_000, 18)), wantProfitable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ac, _ := newTestCalculator(t, &AppConfig{})
+			for _, amountIn := range []*big.Int{big.NewInt(1), units(1, 18), mustBig(t, "123456789012345678901")} {
+				out, impacts, err := ac.quotePath(tt.path, amountIn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := new(big.Int).Set(amountIn)
+				for _, step := range tt.path {
+					want = getAmountOut(want, step.Pool.ReserveOf(step.FromToken), step.Pool.ReserveOf(step.ToToken), step.FeePips)
+				}
+				if out.Cmp(want) != 0 || len(impacts) != hops {
+					t.Fatalf("投入 %s 输出 %s，逐跳 getAmountOut 为 %s", amountIn, out, want)
+				}
+			}
+
+			amountIn := ac.optimalInput(tt.path, nil)
+			out, _, err := ac.quotePath(tt.path, amountIn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if profitable := out.Cmp(amountIn) > 0; profitable != tt.wantProfitable {
+				t.Fatalf("最优投入 %s 输出 %s，盈利 %v，期望 %v", amountIn, out, profitable, tt.wantProfitable)
+			}
+		})
+	}
+}
+
+// TestRecordOpportunitySkipsUnpriced 起始代币没有 USD 价格的机会不写入统计，避免以 0 USD 拉低平均净利润
+func TestRecordOpportunitySkipsUnpriced(t *testing.T) {
+	tests := []struct {
+		name      string
+		unitUSD   float64
+		wantTotal int64
+		wantUSD   float64
+	}{
+		{name: "priced start token recorded", unitUSD: 0.5, wantTotal: 1, wantUSD: 10},
+		{name: "unpriced start token skipped", wantTotal: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ac, _ := newTestCalculator(t, &AppConfig{})
+			tokenA, tokenB := testAddr(1), testAddr(2)
+			opportunity := ArbitrageOpportunity{
+				StartToken:         tokenA.Hex(),
+				InitialAmount:      100,
+				StartTokenPriceUSD: tt.unitUSD,
+				Path:               []ArbitrageStep{{Pool: testPool(testAddr(100), tokenA, tokenB, nil, nil, 30), FromToken: tokenA.Hex(), ToToken: tokenB.Hex()}},
+			}
+			ac.recordOpportunity(opportunity, 120)
+			stats, err := ac.store.OpportunityStats(context.Background(), time.Now().Add(-time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Total != tt.wantTotal || math.Abs(stats.MaxProfitUSD-tt.wantUSD) > 1e-9 {
+				t.Fatalf("统计 %d 条、最大净利润 %.4f USD，期望 %d 条、%.4f USD", stats.Total, stats.MaxProfitUSD, tt.wantTotal, tt.wantUSD)
+			}
+		})
+	}
+}
+
+// TestCalculateDetailedProfitMinProfitWei 精算按 ARB_MIN_PROFIT_WEI 的整数门槛决定是否执行：
+// 门槛比利润低 1、恰好等于利润时通过，高 1 时拒绝，起始代币有无 USD 价格结果相同；MinReturn 等于投入量加门槛，链上按同一门槛回滚
+func TestCalculateDetailedProfitMinProfitWei(t *testing.T) {
+	tokenA, tokenB := testAddr(1), testAddr(2)
+	path := arbPath(tokenA, tokenB)
+	opportunity := ArbitrageOpportunity{StartToken: tokenA.Hex(), InitialAmount: 1e21}
+	for _, edge := range path {
+		opportunity.Path = append(opportunity.Path, ArbitrageStep{Pool: edge.Pool, FromToken: edge.FromToken.Hex(), ToToken: edge.ToToken.Hex(), Protocol: edge.Protocol, FeePips: edge.FeePips})
+	}
+
+	tests := []struct {
+		name   string
+		priced bool
+		delta  int64
+		want   bool
+	}{
+		{name: "unpriced threshold minus one", delta: -1, want: true},
+		{name: "unpriced threshold equal", delta: 0, want: true},
+		{name: "unpriced threshold plus one", delta: 1, want: false},
+		{name: "priced threshold minus one", priced: true, delta: -1, want: true},
+		{name: "priced threshold equal", priced: true, delta: 0, want: true},
+		{name: "priced threshold plus one", priced: true, delta: 1, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// ARB_MIN_PROFIT 设得极高：配置了整数门槛的起始代币不再使用它
+			cfg := &AppConfig{ArbInitialCapital: 1000, ArbMinProfit: 1e30, ArbMinProfitWei: map[common.Address]*big.Int{tokenA: new(big.Int)}}
+			ac, oracle := newTestCalculator(t, cfg)
+			if tt.priced {
+				oracle.prices[tokenA] = 1e-18
+			}
+			// 门槛为 0 且没有执行成本时 MinReturn 即精算选出的整数投入量，门槛不影响最优投入量
+			base, _, err := ac.calculateDetailedProfit(context.Background(), opportunity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			amountIn := base.MinReturn
+			amountOut, _, err := ac.quotePath(path, amountIn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			profit := new(big.Int).Sub(amountOut, amountIn)
+			if profit.Sign() <= 0 {
+				t.Fatalf("精算利润 %s，期望为正", profit)
+			}
+
+			threshold := new(big.Int).Add(profit, big.NewInt(tt.delta))
+			cfg.ArbMinProfitWei[tokenA] = threshold
+			refined, profitable, err := ac.calculateDetailedProfit(context.Background(), opportunity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if profitable != tt.want {
+				t.Fatalf("利润 %s、门槛 %s 时可执行 %v，期望 %v", profit, threshold, profitable, tt.want)
+			}
+			if want := new(big.Int).Add(amountIn, threshold); refined.MinReturn.Cmp(want) != 0 {
+				t.Fatalf("MinReturn %s，期望投入量加门槛 %s", refined.MinReturn, want)
+			}
+		})
+	}
+}
@@ -2,51 +2,142 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"math/big"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 )
 
+// rawMinReserve 池子代币价格均未知时使用的原始储备量门槛（假设 decimal 为 18，即 1 个代币）
+const rawMinReserve = 1e18
+
+// enumerateCheckInterval 枚举套利环时每探索多少个候选步骤检查一次上下文是否已超时
+const enumerateCheckInterval = 1024
+
+// unpricedProbeDecimals 没有 USD 价格且精度未知的起始代币按 18 位精度计算试探投入量
+const unpricedProbeDecimals = 18
+
 type graphEdge struct {
 	Pool      poolDetail
 	Protocol  string
-	Fee       float64
+	FeePips   int
 	Rate      float64
 	FromToken common.Address
 	ToToken   common.Address
 	FromIndex int
 	ToIndex   int
+	// V3 V3 池子沿本跳方向的 tick 数据，只在计算者开启精确报价时填充
+	V3 *v3PoolState
 }
 
 // ArbitrageFinder 负责发现潜在套利路径
 type ArbitrageFinder struct {
-	store     *PoolStore
-	queue     *ArbitrageQueue
-	cfg       *AppConfig
+	store  Store
+	queue  *ArbitrageQueue
+	cfg    *AppConfig
+	oracle *PriceOracle
+	tokens *TokenRegistry
+	// blacklist 运行时拉黑的池子，不参与枚举；快照中已有的池子在评估套利环时跳过
+	blacklist *PoolBlacklist
 	mu        sync.RWMutex
-	seenPaths map[string]struct{}
+	// seenPaths 已推送路径的规范化键到静默截止时间，跨刷新周期保留，过期后路径可再次推送；
+	// 同时写入存储的 seen_paths 表，启动时从存储恢复，重启后静默期仍然有效
+	seenPaths map[string]time.Time
+	// unpricedStarts 已提示过没有 USD 价格、收益门槛退化为按代币数量比较的起始代币，每个代币只提示一次
+	unpricedStarts sync.Map // common.Address -> struct{}
+
+	opportunitiesPublished atomic.Uint64
+	droppedMissingReserves atomic.Uint64
+	droppedStaleReserves   atomic.Uint64
+	droppedSuspicious      atomic.Uint64
+	// staleTally 本轮因储备量过期跳过的路径按池子计数，轮末汇总为一条日志
+	staleTally staleReserveTally
+
+	// trigger 手动触发发现的信号，容量为 1：本轮开始前到达的多次触发合并为一次执行
+	trigger   chan struct{}
+	waitersMu sync.Mutex
+	waiters   []chan DiscoverySummary
+	running   atomic.Bool
+
+	// updates 发现者推送的池子储备量更新，增量模式下在两次全量枚举之间只重新评估受影响的套利环
+	updates chan PoolUpdated
+	// snapshot 最近一次全量枚举使用的池子索引，只在执行发现的协程中访问
+	snapshot *finderSnapshot
+}
+
+// DiscoverySummary 单轮套利发现的统计
+type DiscoverySummary struct {
+	// Pools 加载到的活跃池子数量
+	Pools int `json:"pools"`
+	// LiquidPools 通过流动性过滤、参与枚举的池子数量
+	LiquidPools int `json:"liquid_pools"`
+	// Paths 枚举到的套利环数量
+	Paths int `json:"paths"`
+	// Profitable 初步盈利并推送到队列的路径数量
+	Profitable int `json:"profitable"`
+	// DroppedMissingReserves 因储备量缺失丢弃的路径数量
+	DroppedMissingReserves uint64 `json:"dropped_missing_reserves"`
+	// DroppedStaleReserves 因池子储备量超过 ARB_MAX_RESERVE_AGE 未更新而跳过的路径数量
+	DroppedStaleReserves uint64 `json:"dropped_stale_reserves"`
+	// StalePools 导致跳过路径最多的前 staleReserveTopPools 个过期池子
+	StalePools []staleReservePool `json:"stale_pools,omitempty"`
+	// DroppedSuspicious 收益超出 ARB_MAX_CYCLE_MULTIPLIER 或单跳偏差超出 ARB_MAX_HOP_DEVIATION 而丢弃的路径数量
+	DroppedSuspicious uint64 `json:"dropped_suspicious"`
+	// PrunedBranches 乐观完成上界达不到收益门槛而剪掉的枚举分支数量
+	PrunedBranches int64 `json:"pruned_branches"`
+	// TimedOut 枚举是否超出 ARB_ENUMERATE_TIMEOUT 而提前结束
+	TimedOut  bool          `json:"timed_out"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	// Error 加载池子失败时的错误信息
+	Error string `json:"error,omitempty"`
 }
 
+// errFinderNotRunning 套利发现者未在运行（例如回放模式），无法处理手动触发
+var errFinderNotRunning = errors.New("套利发现者未运行")
+
 // NewArbitrageFinder 创建套利路径发现者
-func NewArbitrageFinder(store *PoolStore, queue *ArbitrageQueue, cfg *AppConfig) *ArbitrageFinder {
+func NewArbitrageFinder(store Store, queue *ArbitrageQueue, cfg *AppConfig, oracle *PriceOracle, tokens *TokenRegistry, blacklist *PoolBlacklist) *ArbitrageFinder {
 	return &ArbitrageFinder{
 		store:     store,
 		queue:     queue,
 		cfg:       cfg,
-		seenPaths: make(map[string]struct{}),
+		oracle:    oracle,
+		tokens:    tokens,
+		blacklist: blacklist,
+		seenPaths: make(map[string]time.Time),
+		trigger:   make(chan struct{}, 1),
+		updates:   make(chan PoolUpdated, poolUpdateQueueSize),
 	}
 }
 
+// OpportunitiesPublished 返回已推送到套利队列的机会数量
+func (af *ArbitrageFinder) OpportunitiesPublished() uint64 {
+	return af.opportunitiesPublished.Load()
+}
+
+// DroppedMissingReserves 返回因池子储备量缺失而被丢弃的路径数量
+func (af *ArbitrageFinder) DroppedMissingReserves() uint64 {
+	return af.droppedMissingReserves.Load()
+}
+
 // Start 启动套利路径发现流程
 func (af *ArbitrageFinder) Start(ctx context.Context) {
 	ticker := time.NewTicker(af.cfg.ArbReloadInterval)
 	defer ticker.Stop()
 
+	af.running.Store(true)
+	defer af.running.Store(false)
+
+	af.loadSeenPaths(ctx)
 	af.runDiscovery(ctx) // 启动时先执行一次
 
 	for {
@@ -55,73 +146,294 @@ func (af *ArbitrageFinder) Start(ctx context.Context) {
 			return
 		case <-ticker.C:
 			af.runDiscovery(ctx)
+		case <-af.trigger:
+			// 先取走已登记的等待者再执行，执行期间新到达的触发会留到下一轮
+			af.waitersMu.Lock()
+			waiters := af.waiters
+			af.waiters = nil
+			af.waitersMu.Unlock()
+
+			log.Printf("收到手动触发，立即执行套利发现（合并 %d 个请求）", len(waiters))
+			summary := af.runDiscovery(ctx)
+			for _, w := range waiters {
+				w <- summary
+			}
+		case update := <-af.updates:
+			af.runIncremental(ctx, update)
 		}
 	}
 }
 
-func (af *ArbitrageFinder) runDiscovery(ctx context.Context) {
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+// Trigger 请求立即执行一轮套利发现，并等待服务该请求的那一轮结束后返回其统计
+// 执行开始前的多次触发合并为同一轮，不会排队重复执行
+func (af *ArbitrageFinder) Trigger(ctx context.Context) (DiscoverySummary, error) {
+	if !af.running.Load() {
+		return DiscoverySummary{}, errFinderNotRunning
+	}
+
+	done := make(chan DiscoverySummary, 1)
+	af.waitersMu.Lock()
+	af.waiters = append(af.waiters, done)
+	af.waitersMu.Unlock()
+
+	select {
+	case af.trigger <- struct{}{}:
+	default:
+		// 已有待执行的触发，本请求随该轮一起完成
+	}
+
+	select {
+	case summary := <-done:
+		return summary, nil
+	case <-ctx.Done():
+		return DiscoverySummary{}, ctx.Err()
+	}
+}
+
+func (af *ArbitrageFinder) runDiscovery(ctx context.Context) DiscoverySummary {
+	start := time.Now()
+	loadCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	pools, err := af.store.ListPools(ctx)
+	pools, err := af.store.ListPools(loadCtx, ListPoolsOptions{ActiveOnly: true})
 	if err != nil {
 		log.Printf("加载池子数据失败: %v", err)
-		return
+		return DiscoverySummary{StartedAt: start, Duration: time.Since(start), Error: err.Error()}
 	}
 	log.Printf("套利发现者加载到 %d 个池子", len(pools))
 
+	af.oracle.Update(pools)
 	af.buildGraph(pools)
-	af.enumerateCycles()
+
+	// 枚举使用独立的时间预算，与加载池子的超时及刷新周期互不影响
+	enumerateCtx, cancelEnumerate := context.WithTimeout(ctx, af.cfg.ArbEnumerateTimeout)
+	defer cancelEnumerate()
+	summary := af.enumerateCycles(enumerateCtx)
+	summary.StartedAt = start
+	summary.Duration = time.Since(start)
+	return summary
 }
 
 func (af *ArbitrageFinder) buildGraph(pools []poolDetail) {
-	af.mu.Lock()
-	defer af.mu.Unlock()
-	af.seenPaths = make(map[string]struct{})
-	// 新的算法不需要构建索引图，直接使用 pools
+	// 新的算法不需要构建索引图，直接使用 pools；这里只清理已过静默期的路径，避免 seenPaths 无限增长
+	af.pruneSeenPaths(time.Now())
 }
 
-func (af *ArbitrageFinder) enumerateCycles() {
-	pools, err := af.store.ListPools(context.Background())
+// enumerateCycles 枚举套利环并逐条评估，ctx 超时或取消时停止枚举，已找到的路径仍会被处理
+func (af *ArbitrageFinder) enumerateCycles(ctx context.Context) DiscoverySummary {
+	pools, err := af.store.ListPools(ctx, ListPoolsOptions{ActiveOnly: true})
 	if err != nil {
 		log.Printf("加载池子数据失败: %v", err)
-		return
+		return DiscoverySummary{Error: err.Error()}
+	}
+
+	summary := DiscoverySummary{Pools: len(pools)}
+	pools = af.filterLiquidPools(pools)
+	summary.LiquidPools = len(pools)
+	af.sortByVolume(pools)
+	if containsNative(pools) {
+		// 存在以原生 BNB 计价的池子（例如 V4）时加入包装虚拟池子，使原生 BNB 一侧与 WBNB 一侧的池子在路径中间也能连通
+		pools = append(pools, wrapNativePool(af.cfg.WrappedNative))
 	}
+	index := newPoolIndex(pools)
 
 	maxHops := af.cfg.ArbMaxHops
 	if maxHops < 2 {
 		maxHops = 2
 	}
-	// 假设买入 1 个 token0（以最小单位计，例如 1.0 表示 1e18 个 token）
-	// 不需要考虑 USD 价格，直接用 token 数量进行比较
-	initialAmount := 1.0
-	// minProfit 也改为以 token 数量计，例如 0.0 表示只要最终数量 > 初始数量就算盈利
-	minProfit := 0.0
-
-	// 收集所有唯一的 token 地址作为起点
-	tokenSet := make(map[common.Address]struct{})
-	for _, p := range pools {
-		tokenSet[p.Token0] = struct{}{}
-		tokenSet[p.Token1] = struct{}{}
+	tokenSet := af.startTokens(pools)
+	if len(af.cfg.ArbBaseTokens) > 0 {
+		log.Printf("套利环起点限定为 %d 个基础代币", len(tokenSet))
 	}
+	af.snapshot = newFinderSnapshot(index, pools, tokenSet, maxHops, len(af.cfg.ArbBaseTokens) > 0)
 
 	// 统计信息
 	totalPaths := 0
 	profitablePaths := 0
+	droppedBase := af.droppedMissingReserves.Load()
+	staleBase := af.droppedStaleReserves.Load()
+	suspiciousBase := af.droppedSuspicious.Load()
 
-	// 对每个 token 作为起点，查找套利路径
-	for startToken := range tokenSet {
-		var circles []arbitrageCircle
-		af.findArb(pools, startToken, startToken, maxHops, nil, []common.Address{startToken}, &circles)
+	// 起点按地址排序后分发给 ARB_ENUMERATE_WORKERS 个 worker 并行枚举，每个起点的结果写入各自的 channel，
+	// 再按起点顺序依次评估，使评估顺序与 worker 数量无关；handleCircle 只在当前 goroutine 中调用
+	starts := sortedAddresses(tokenSet)
+	results := make([]chan []arbitrageCircle, len(starts))
+	for i := range results {
+		results[i] = make(chan []arbitrageCircle, 1)
+	}
+	jobs := make(chan int, len(starts))
+	for i := range starts {
+		jobs <- i
+	}
+	close(jobs)
+
+	// 理想兑换率图每轮只构建一次，各起点的剪枝上界都基于它计算；构建时已超时则 graph 为 nil，worker 随即放弃全部起点
+	graph, _ := newCycleGraph(ctx, index)
+	af.snapshot.graph = graph
+	var explored, pruned atomic.Int64
+	workers := min(max(af.cfg.ArbEnumerateWorkers, 1), max(len(starts), 1))
+	for w := 0; w < workers; w++ {
+		go func() {
+			steps, cut := 0, 0
+			defer func() {
+				explored.Add(int64(steps))
+				pruned.Add(int64(cut))
+			}()
+			for i := range jobs {
+				// 超时后不再枚举剩余起点，但仍需回填结果，避免评估方阻塞
+				if ctx.Err() != nil {
+					results[i] <- nil
+					continue
+				}
+				results[i] <- af.cyclesFrom(ctx, index, graph, starts[i], maxHops, &steps, &cut)
+			}
+		}()
+	}
+
+	for i := range starts {
+		circles := <-results[i]
 		totalPaths += len(circles)
 		for _, circle := range circles {
-			if af.handleCircle(circle, initialAmount, minProfit) {
+			if af.handleCircle(circle) {
 				profitablePaths++
 			}
 		}
 	}
+	if ctx.Err() != nil {
+		log.Printf("套利环枚举超出时间预算 %s，已探索 %d 个候选步骤、%d 条路径，放弃剩余起点",
+			af.cfg.ArbEnumerateTimeout, explored.Load(), totalPaths)
+		summary.TimedOut = true
+	}
 
-	log.Printf("套利路径统计: 总路径数 %d, 初步盈利路径数 %d", totalPaths, profitablePaths)
+	summary.Paths = totalPaths
+	summary.Profitable = profitablePaths
+	summary.DroppedMissingReserves = af.droppedMissingReserves.Load() - droppedBase
+	summary.DroppedStaleReserves = af.droppedStaleReserves.Load() - staleBase
+	summary.DroppedSuspicious = af.droppedSuspicious.Load() - suspiciousBase
+	summary.PrunedBranches = pruned.Load()
+	summary.StalePools = af.flushStaleReserves()
+	log.Printf("套利路径统计: 总路径数 %d, 初步盈利路径数 %d, 储备量缺失丢弃数 %d, 储备量过期跳过数 %d, 可疑收益丢弃数 %d, 剪枝分支数 %d",
+		summary.Paths, summary.Profitable, summary.DroppedMissingReserves, summary.DroppedStaleReserves, summary.DroppedSuspicious, summary.PrunedBranches)
+	return summary
+}
+
+// cyclesFrom 枚举以 startToken 为起点、不超过 maxHops 跳的全部套利环，只读访问 index 与 graph，可在多个 goroutine 中并发调用
+// 存在原生 BNB 池子时两跳、三跳的快速枚举不处理包装跳与 WBNB 等价闭合，统一使用 findArb；
+// 三种枚举都按 graph 计算的上界剪枝（graph 为 nil 时不剪枝），剪掉的分支数累加到 pruned
+func (af *ArbitrageFinder) cyclesFrom(ctx context.Context, index *poolIndex, graph *cycleGraph, startToken common.Address, maxHops int, explored, pruned *int) []arbitrageCircle {
+	var bounds *cycleBounds
+	if graph != nil {
+		var err error
+		if bounds, err = graph.bounds(ctx, startToken, af.cfg.WrappedNative, maxHops, af.minProfitRatio(startToken)); err != nil {
+			return nil
+		}
+		defer func() { *pruned += bounds.pruned }()
+	}
+
+	var circles []arbitrageCircle
+	if len(index.PoolsByToken(nativeToken)) > 0 {
+		af.findArb(ctx, index, startToken, startToken, maxHops, nil, []common.Address{startToken}, map[common.Address]struct{}{}, 1, bounds, &circles, explored)
+		return circles
+	}
+	switch maxHops {
+	case 2:
+		af.findTwoPoolArbs(ctx, index, startToken, bounds, &circles, explored)
+	case 3:
+		// 与 findArb 一致，三跳上限同时包含两池环
+		af.findTwoPoolArbs(ctx, index, startToken, bounds, &circles, explored)
+		af.findThreePoolArbs(ctx, index, startToken, bounds, &circles, explored)
+	default:
+		af.findArb(ctx, index, startToken, startToken, maxHops, nil, []common.Address{startToken}, map[common.Address]struct{}{}, 1, bounds, &circles, explored)
+	}
+	return circles
+}
+
+// sortedAddresses 返回按地址字节序排列的代币列表
+func sortedAddresses(set map[common.Address]struct{}) []common.Address {
+	addresses := make([]common.Address, 0, len(set))
+	for address := range set {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].Cmp(addresses[j]) < 0 })
+	return addresses
+}
+
+// startTokens 收集所有唯一的 token 地址作为起点；配置了基础代币时只从基础代币出发并回到基础代币，
+// 可盈利的套利几乎都以流动性好的基础资产结算，这样可以大幅缩小搜索空间
+func (af *ArbitrageFinder) startTokens(pools []poolDetail) map[common.Address]struct{} {
+	tokenSet := make(map[common.Address]struct{})
+	if len(af.cfg.ArbBaseTokens) > 0 {
+		for _, token := range af.cfg.ArbBaseTokens {
+			tokenSet[token] = struct{}{}
+			// WBNB 作为基础代币时，原生 BNB 同样可以作为起点
+			if token == af.cfg.WrappedNative && containsNative(pools) {
+				tokenSet[nativeToken] = struct{}{}
+			}
+		}
+		return tokenSet
+	}
+	for _, p := range pools {
+		for _, token := range p.Tokens {
+			tokenSet[token] = struct{}{}
+		}
+	}
+	return tokenSet
+}
+
+// sortByVolume 按滚动成交量（USD）降序稳定排序，成交活跃的池子在代币索引中排在前面，
+// 枚举超出时间预算时优先探索经过这些池子的路径；成交量相同（包括没有成交记录）的池子保持 ListPools 的顺序
+func (af *ArbitrageFinder) sortByVolume(pools []poolDetail) {
+	now := time.Now()
+	volumes := make(map[common.Address]float64, len(pools))
+	for _, pool := range pools {
+		volumes[pool.Address] = af.oracle.VolumeUSD(pool, now)
+	}
+	sort.SliceStable(pools, func(i, j int) bool {
+		return volumes[pools[i].Address] > volumes[pools[j].Address]
+	})
+}
+
+// filterLiquidPools 过滤流动性不足的池子
+// 池子中有代币价格已知时按 USD 总流动性与 ARB_MIN_LIQUIDITY_USD 比较，避免低精度代币的流动池被误杀、
+// 高发行量垃圾币被误收；价格均未知时退化为每个代币原始储备量 >= 1e18 的检查
+// 储备量与代币余额交叉校验不一致的池子报价不可信，直接跳过；
+// 入库不满 ARB_MIN_POOL_AGE 的池子同样跳过（仍然入库），等其经过观察期后再参与枚举；
+// 任一代币储备量为 0 的池子（刚创建或储备量尚未读取到）无法报价，同样跳过，直到储备量更新
+func (af *ArbitrageFinder) filterLiquidPools(pools []poolDetail) []poolDetail {
+	minReserve := big.NewInt(rawMinReserve)
+	now := time.Now()
+	liquid := make([]poolDetail, 0, len(pools))
+	for _, pool := range pools {
+		if !pool.hasReserves() || pool.ReserveDiscrepancy || af.tooYoung(pool, now) || af.blacklist.Contains(pool.Address) {
+			continue
+		}
+		if liquidity, ok := af.oracle.LiquidityUSD(pool); ok {
+			if liquidity >= af.cfg.ArbMinLiquidityUSD {
+				liquid = append(liquid, pool)
+			}
+			continue
+		}
+
+		enough := len(pool.Tokens) >= 2
+		for i := range pool.Tokens {
+			if reserve := pool.reserveAt(i); reserve == nil || reserve.Cmp(minReserve) < 0 {
+				enough = false
+				break
+			}
+		}
+		if enough {
+			liquid = append(liquid, pool)
+		}
+	}
+	return liquid
+}
+
+// tooYoung 判断池子入库时间是否不满 ARB_MIN_POOL_AGE，入库时间未知（未从存储读取）时不限制
+func (af *ArbitrageFinder) tooYoung(pool poolDetail, now time.Time) bool {
+	if af.cfg.ArbMinPoolAge <= 0 || pool.CreatedAt.IsZero() {
+		return false
+	}
+	return now.Sub(pool.CreatedAt) < af.cfg.ArbMinPoolAge
 }
 
 // arbitrageCircle 表示一个套利环
@@ -130,65 +442,181 @@ type arbitrageCircle struct {
 	Path  []common.Address // 路径中的代币列表
 }
 
-// findArb 递归查找套利路径（参考 Python 代码逻辑）
-func (af *ArbitrageFinder) findArb(pairs []poolDetail, tokenIn, tokenOut common.Address, maxHops int,
-	currentPairs []poolDetail, path []common.Address, circles *[]arbitrageCircle) {
-
-	for i := range pairs {
-		pair := pairs[i]
+// closed 判断套利环是否真正闭合：代币数量比池子数量多一个，且首尾为同一资产
+// simulatePath 直接比较最终数量与初始数量，只有首尾资产相同时这种比较才有意义；
+// 原生 BNB 与包装代币 wrapped 按 1:1 视为同一资产，换回起始资产的包装/解包 gas 计入执行成本
+func (c arbitrageCircle) closed(wrapped common.Address) bool {
+	return len(c.Path) == len(c.Route)+1 && sameAsset(c.Path[0], c.Path[len(c.Path)-1], wrapped)
+}
 
-		// 检查 pair 是否包含 tokenIn
-		if pair.Token0 != tokenIn && pair.Token1 != tokenIn {
-			continue
-		}
+// findArb 递归查找套利路径（参考 Python 代码逻辑）
+// 每一层只遍历索引中包含 tokenIn 的池子；explored 累计探索过的候选步骤数，每 enumerateCheckInterval 步检查一次 ctx，超时后立即返回
+// rate 为当前部分路径各跳理想兑换率（现货价 × (1 - 手续费)）的乘积；乘以 bounds 给出的乐观完成上界后仍不超过 1 的分支
+// 即使没有滑点也不可能盈利，直接放弃，不再向下展开，也不记录这样的环；bounds 为 nil 时不剪枝
+// used 为当前路径已经使用的池子地址，递归前加入、返回后移除；同一个池子即使在索引的不同位置重复出现也只能使用一次
+func (af *ArbitrageFinder) findArb(ctx context.Context, index *poolIndex, tokenIn, tokenOut common.Address, maxHops int,
+	currentPairs []poolDetail, path []common.Address, used map[common.Address]struct{}, rate float64, bounds *cycleBounds,
+	circles *[]arbitrageCircle, explored *int) {
 
-		// 检查储备量是否足够（假设 decimal 为 18，储备量需要 >= 1e18）
-		// 简化处理：直接比较 big.Int，如果储备量太小则跳过
-		minReserve := big.NewInt(1e18) // 1 * 10^18
-		if pair.Reserve0 == nil || pair.Reserve0.Cmp(minReserve) < 0 {
+	// 索引中的池子已由 filterLiquidPools 按流动性过滤，这里不再检查储备量
+	for _, pair := range index.PoolsByToken(tokenIn) {
+		wrap := pair.Protocol == ProtocolWrapNative
+		// 包装跳不作为第一跳：从 WBNB 出发先包装为原生 BNB 等价于直接从原生 BNB 出发
+		if wrap && len(currentPairs) == 0 {
 			continue
 		}
-		if pair.Reserve1 == nil || pair.Reserve1.Cmp(minReserve) < 0 {
+		// 同一个池子不能在路径中重复出现，否则 A->B->A 只是在同一池子里来回兑换，净结果为两次手续费的亏损
+		if _, ok := used[pair.Address]; ok {
 			continue
 		}
+		inIdx := pair.TokenIndex(tokenIn)
+
+		// 两币池只有一个输出代币；多币池对除 tokenIn 以外的每个代币各尝试一次
+		for outIdx, tempOut := range pair.Tokens {
+			// 代币列表中重复出现 tokenIn 的池子（数据异常）会得到 tokenIn -> tokenIn 的自兑换，同样跳过
+			if outIdx == inIdx || tempOut == tokenIn {
+				continue
+			}
+
+			*explored++
+			if *explored%enumerateCheckInterval == 0 && ctx.Err() != nil {
+				return
+			}
+
+			// 至少经过两个池子后回到起始资产即为闭环（包括跨 DEX 的两池往返套利），
+			// 原生 BNB 与 WBNB 视为同一资产，因此不会以包装跳结束
+			remaining := maxHops - 1
+			if wrap {
+				// 包装跳没有手续费也没有滑点，不占用跳数
+				remaining = maxHops
+			}
+			newRate := rate * hopIdealRate(pair, tokenIn, tempOut)
+			if !bounds.promising(newRate, tempOut, remaining) {
+				continue
+			}
+
+			newPath := make([]common.Address, len(path))
+			copy(newPath, path)
+			newPath = append(newPath, tempOut)
+
+			newPairs := make([]poolDetail, len(currentPairs))
+			copy(newPairs, currentPairs)
+			newPairs = append(newPairs, pair)
 
-		// 确定输出代币
-		var tempOut common.Address
-		if tokenIn == pair.Token0 {
-			tempOut = pair.Token1
-		} else {
-			tempOut = pair.Token0
+			if sameAsset(tempOut, tokenOut, af.cfg.WrappedNative) && len(newPairs) >= 2 {
+				if !wrap {
+					*circles = append(*circles, arbitrageCircle{
+						Route: newPairs,
+						Path:  newPath,
+					})
+				}
+			} else if remaining > 0 {
+				// 已使用的池子由 used 排除，无需复制剩余池子列表
+				used[pair.Address] = struct{}{}
+				af.findArb(ctx, index, tempOut, tokenOut, remaining, newPairs, newPath, used, newRate, bounds, circles, explored)
+				delete(used, pair.Address)
+			}
 		}
+	}
+}
 
-		newPath := make([]common.Address, len(path))
-		copy(newPath, path)
-		newPath = append(newPath, tempOut)
+// findTwoPoolArbs 枚举 start -> mid -> start 的两池环（同一交易对跨 DEX 往返），
+// 结果与 maxHops=2 的 findArb 相同（同样按 bounds 剪枝、同一个池子不重复使用），但不递归，也只在找到环时才分配切片；
+// 第二个池子直接从 PoolsForPair 取同一交易对的其他池子，不必扫描 mid 的全部池子
+func (af *ArbitrageFinder) findTwoPoolArbs(ctx context.Context, index *poolIndex, start common.Address, bounds *cycleBounds,
+	circles *[]arbitrageCircle, explored *int) {
 
-		newPairs := make([]poolDetail, len(currentPairs))
-		copy(newPairs, currentPairs)
-		newPairs = append(newPairs, pair)
+	for _, first := range index.PoolsByToken(start) {
+		startIdx := first.TokenIndex(start)
+		for midIdx, mid := range first.Tokens {
+			if midIdx == startIdx || mid == start {
+				continue
+			}
+			rate := hopIdealRate(first, start, mid)
+			if !bounds.promising(rate, mid, 1) {
+				continue
+			}
+			for _, second := range index.PoolsForPair(start, mid) {
+				*explored++
+				if *explored%enumerateCheckInterval == 0 && ctx.Err() != nil {
+					return
+				}
+				// 路径已使用的池子只有 first
+				if second.Address == first.Address {
+					continue
+				}
+				if !bounds.promising(rate*hopIdealRate(second, mid, start), start, 0) {
+					continue
+				}
+				*circles = append(*circles, arbitrageCircle{
+					Route: []poolDetail{first, second},
+					Path:  []common.Address{start, mid, start},
+				})
+			}
+		}
+	}
+}
+
+// findThreePoolArbs 枚举 start -> a -> b -> start 的三角环（b 不为 start，三个池子互不相同），
+// 与 findArb 在 maxHops=3 时找到的三池环相同（同样按 bounds 剪枝）；两池环由 findTwoPoolArbs 负责
+// 深度固定为三跳，已使用的池子就是前面的 first、second，直接比较地址，不需要 findArb 的 used 集合
+func (af *ArbitrageFinder) findThreePoolArbs(ctx context.Context, index *poolIndex, start common.Address, bounds *cycleBounds,
+	circles *[]arbitrageCircle, explored *int) {
 
-		// 如果找到闭环且路径长度 > 2
-		if tempOut == tokenOut && len(path) > 2 {
-			*circles = append(*circles, arbitrageCircle{
-				Route: newPairs,
-				Path:  newPath,
-			})
-		} else if maxHops > 1 && len(pairs) > 1 {
-			// 排除当前 pair，递归查找
-			pairsExcludingThis := make([]poolDetail, 0, len(pairs)-1)
-			pairsExcludingThis = append(pairsExcludingThis, pairs[:i]...)
-			pairsExcludingThis = append(pairsExcludingThis, pairs[i+1:]...)
-			af.findArb(pairsExcludingThis, tempOut, tokenOut, maxHops-1, newPairs, newPath, circles)
+	for _, first := range index.PoolsByToken(start) {
+		startIdx := first.TokenIndex(start)
+		for aIdx, a := range first.Tokens {
+			if aIdx == startIdx || a == start {
+				continue
+			}
+			firstRate := hopIdealRate(first, start, a)
+			if !bounds.promising(firstRate, a, 2) {
+				continue
+			}
+			for _, second := range index.PoolsByToken(a) {
+				if second.Address == first.Address {
+					continue
+				}
+				inIdx := second.TokenIndex(a)
+				for bIdx, b := range second.Tokens {
+					if bIdx == inIdx || b == start || b == a {
+						continue
+					}
+					secondRate := firstRate * hopIdealRate(second, a, b)
+					if !bounds.promising(secondRate, b, 1) {
+						continue
+					}
+					for _, third := range index.PoolsByToken(b) {
+						*explored++
+						if *explored%enumerateCheckInterval == 0 && ctx.Err() != nil {
+							return
+						}
+						if third.Address == first.Address || third.Address == second.Address || third.TokenIndex(start) < 0 {
+							continue
+						}
+						if !bounds.promising(secondRate*hopIdealRate(third, b, start), start, 0) {
+							continue
+						}
+						*circles = append(*circles, arbitrageCircle{
+							Route: []poolDetail{first, second, third},
+							Path:  []common.Address{start, a, b, start},
+						})
+					}
+				}
+			}
 		}
 	}
 }
 
-// handleCircle 处理一个套利环，返回是否盈利
-func (af *ArbitrageFinder) handleCircle(circle arbitrageCircle, initialAmount, minProfit float64) bool {
+// handleCircle 处理一个套利环，返回是否盈利；初始投入量与收益门槛按起始代币换算
+func (af *ArbitrageFinder) handleCircle(circle arbitrageCircle) bool {
 	if len(circle.Route) < 2 {
 		return false
 	}
+	if !circle.closed(af.cfg.WrappedNative) {
+		log.Printf("丢弃未闭合的套利路径: 池子数 %d, 代币序列 %v", len(circle.Route), circle.Path)
+		return false
+	}
 
 	// 将 circle 转换为 graphEdge 路径
 	path := make([]graphEdge, 0, len(circle.Route))
@@ -197,7 +625,7 @@ func (af *ArbitrageFinder) handleCircle(circle arbitrageCircle, initialAmount, m
 		fromToken := circle.Path[i]
 		toToken := circle.Path[i+1]
 
-		rate := 1 - pair.Fee/100.0
+		rate := feeRate(pair.FeePipsFrom(fromToken))
 		if rate <= 0 {
 			rate = 1e-6
 		}
@@ -205,7 +633,7 @@ func (af *ArbitrageFinder) handleCircle(circle arbitrageCircle, initialAmount, m
 		path = append(path, graphEdge{
 			Pool:      pair,
 			Protocol:  pair.Protocol,
-			Fee:       pair.Fee,
+			FeePips:   pair.FeePipsFrom(fromToken),
 			Rate:      rate,
 			FromToken: fromToken,
 			ToToken:   toToken,
@@ -217,129 +645,300 @@ func (af *ArbitrageFinder) handleCircle(circle arbitrageCircle, initialAmount, m
 		return false
 	}
 
+	// 枚举快照建立后才被拉黑的池子在下一轮全量枚举前仍在索引中，这里直接跳过
+	for _, pool := range circle.Route {
+		if af.blacklist.Contains(pool.Address) {
+			return false
+		}
+	}
+
+	// 只读代币或转账税未知（按配置）的代币不参与套利，路径数量较多，这里不逐条输出日志
+	for _, token := range circle.Path {
+		if denied, _ := af.tokens.Denied(token); denied {
+			return false
+		}
+	}
+
 	pathDesc := formatPath(path)
+
+	// 储备量长时间未更新的池子模拟结果不可信，跳过整个环；按池子计数，轮末由 flushStaleReserves 汇总输出，
+	// 开启 DEBUG_ARB_DROPS 时逐条输出
+	if pool, age, stale := af.staleReserves(circle.Route, time.Now()); stale {
+		af.droppedStaleReserves.Add(1)
+		af.staleTally.add(pool, age)
+		if af.cfg.DebugArbDrops {
+			log.Printf("跳过储备量过期的套利路径 (跳数 %d): 池子 %s %s，超过 ARB_MAX_RESERVE_AGE %s, 路径: %s",
+				len(path), pool.Hex(), staleReason(age), af.cfg.ArbMaxReserveAge, pathDesc)
+		}
+		return false
+	}
 	// log.Printf("检测到套利环 (跳数 %d): %s", len(path), pathDesc)
 
-	estimated, profitable := af.simulatePath(initialAmount, path, minProfit)
+	// 起始代币价格已知时，按 USD 配置的初始资金和最小收益换算为起始代币数量，
+	// 使收益门槛对任意起始代币都是真实的 USD 值：价值 0.0001 USD 的代币赚 1 个单位达不到 1 USD 的门槛；
+	// 价格未知时无法换算，按 probeAmount 投入 1 个完整代币试探，ARB_MIN_PROFIT 直接按起始代币最小单位数量比较，并提示一次
+	startToken := path[0].FromToken
+	initialAmount, minProfit, startPrice, priceKnown := af.startAmounts(startToken)
+	if !priceKnown {
+		af.warnUnpricedStart(startToken)
+	}
+
+	estimated, profitable, err := af.simulatePath(initialAmount, path, minProfit)
+	if err != nil {
+		// 枚举后池子储备量可能被并发刷新为 0，只丢弃当前路径；数量在每轮统计中输出，开启 DEBUG_ARB_DROPS 时逐条输出
+		af.droppedMissingReserves.Add(1)
+		if af.cfg.DebugArbDrops {
+			log.Printf("丢弃套利路径 (跳数 %d): %v, 路径: %s", len(path), err, pathDesc)
+		}
+		return false
+	}
 	if !profitable {
 		return false
 	}
+	if err := af.checkSanity(path, initialAmount, estimated); err != nil {
+		af.droppedSuspicious.Add(1)
+		if af.cfg.DebugArbDrops {
+			log.Printf("丢弃可疑套利路径 (跳数 %d): %v, 路径: %s", len(path), err, pathDesc)
+		}
+		return false
+	}
 
-	profit := estimated - initialAmount
-	log.Printf("初步可盈利套利 (跳数 %d): 初始 1 个 token -> 最终 %.6f 个 token, 利润 %.6f 个 token, 路径: %s",
-		len(path), estimated, profit, pathDesc)
+	op := convertToOpportunity(path, startToken, initialAmount, estimated)
+	if priceKnown {
+		op.StartTokenPriceUSD = startPrice
+	}
+	logOpportunity(af.cfg, af.tokens, af.oracle, "candidate", op, "初步可盈利套利 (跳数 %d): 初始 %s -> 最终 %s, 利润 %s, 路径: %s",
+		len(path), formatTokenAmount(af.tokens, af.oracle, startToken, initialAmount), formatTokenAmount(af.tokens, af.oracle, startToken, estimated),
+		formatTokenAmount(af.tokens, af.oracle, startToken, estimated-initialAmount), pathDesc)
 
 	af.markPath(pathKey)
-	startToken := path[0].FromToken
-	af.queue.Publish(convertToOpportunity(path, startToken, initialAmount, estimated))
+	af.queue.Publish(op)
+	af.opportunitiesPublished.Add(1)
 	return true
 }
 
+// startAmounts 按起始代币的 USD 价格换算初始投入量与最小收益（起始代币最小单位），并返回价格及其是否已知；
+// 价格未知时投入 probeAmount，最小收益直接取 ARB_MIN_PROFIT
+func (af *ArbitrageFinder) startAmounts(startToken common.Address) (initialAmount, minProfit, price float64, priced bool) {
+	price, priced = af.oracle.PriceOf(startToken)
+	if priced && price > 0 {
+		return af.cfg.ArbInitialCapital / price, af.cfg.ArbMinProfit / price, price, true
+	}
+	return af.probeAmount(startToken), max(0, af.cfg.ArbMinProfit), price, false
+}
+
+// minProfitRatio 返回起始代币的最小收益占初始投入量的比例，与 handleCircle 的收益门槛一致（ARB_MIN_PROFIT_WEI 优先），
+// 用作剪枝上界的比较基准；理想兑换率乘积达不到 1 + 该比例的环即使没有滑点也达不到门槛
+func (af *ArbitrageFinder) minProfitRatio(startToken common.Address) float64 {
+	initialAmount, minProfit, _, _ := af.startAmounts(startToken)
+	if wei, ok := af.cfg.ArbMinProfitWei[startToken]; ok {
+		minProfit, _ = new(big.Float).SetInt(wei).Float64()
+	}
+	if initialAmount <= 0 || minProfit <= 0 {
+		return 0
+	}
+	return minProfit / initialAmount
+}
+
+// probeAmount 返回没有 USD 价格的起始代币的试探投入量：1 个完整代币（10^decimals 个最小单位），
+// 精度未知时按 unpricedProbeDecimals 计；投入 1 个最小单位时每跳向下取整会把任何路径的输出抹成 0
+func (af *ArbitrageFinder) probeAmount(token common.Address) float64 {
+	decimals := unpricedProbeDecimals
+	if meta, ok := af.tokens.Get(token); ok && meta.Decimals > 0 {
+		decimals = meta.Decimals
+	}
+	return math.Pow10(decimals)
+}
+
+// warnUnpricedStart 起始代币没有 USD 价格时提示收益门槛退化为按代币数量比较，
+// 配置了 ARB_MIN_PROFIT_WEI 的代币不使用 ARB_MIN_PROFIT，无需提示
+func (af *ArbitrageFinder) warnUnpricedStart(token common.Address) {
+	if _, ok := af.cfg.ArbMinProfitWei[token]; ok {
+		return
+	}
+	if _, loaded := af.unpricedStarts.LoadOrStore(token, struct{}{}); loaded {
+		return
+	}
+	log.Printf("起始代币 %s 没有 USD 价格，ARB_MIN_PROFIT (%v) 按代币最小单位数量比较", tokenLabel(af.tokens, token), af.cfg.ArbMinProfit)
+}
+
+// staleReserves 返回套利环中第一个储备量超过 ARB_MAX_RESERVE_AGE 未更新的池子及其储备量年龄；
+// 包装虚拟池子没有储备量，不参与判断；从未记录储备量更新时间的池子视为过期，年龄返回 -1
+func (af *ArbitrageFinder) staleReserves(route []poolDetail, now time.Time) (common.Address, time.Duration, bool) {
+	if af.cfg.ArbMaxReserveAge <= 0 {
+		return common.Address{}, 0, false
+	}
+	for _, pool := range route {
+		if pool.Protocol == ProtocolWrapNative {
+			continue
+		}
+		if pool.ReserveUpdatedAt == nil {
+			return pool.Address, -1, true
+		}
+		if age := now.Sub(*pool.ReserveUpdatedAt); age > af.cfg.ArbMaxReserveAge {
+			return pool.Address, age, true
+		}
+	}
+	return common.Address{}, 0, false
+}
+
+// staleReserveTopPools 每轮汇总日志中列出的过期池子数量
+const staleReserveTopPools = 5
+
+// staleReservePool 一轮发现中导致路径被跳过的过期池子
+type staleReservePool struct {
+	Address common.Address `json:"address"`
+	// Paths 因该池子跳过的路径数量
+	Paths int `json:"paths"`
+	// Age 储备量年龄，-1 表示未记录储备量更新时间
+	Age time.Duration `json:"age"`
+}
+
+// staleReserveTally 按池子累计一轮发现中因储备量过期跳过的路径；同一个过期池子往往出现在成百上千条路径中，
+// 逐条输出会刷屏，轮末只输出总数与跳过最多的几个池子
+type staleReserveTally struct {
+	mu    sync.Mutex
+	pools map[common.Address]*staleReservePool
+}
+
+// add 记录一条因 pool 过期而跳过的路径
+func (t *staleReserveTally) add(pool common.Address, age time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pools == nil {
+		t.pools = make(map[common.Address]*staleReservePool)
+	}
+	entry, ok := t.pools[pool]
+	if !ok {
+		entry = &staleReservePool{Address: pool}
+		t.pools[pool] = entry
+	}
+	entry.Paths++
+	entry.Age = age
+}
+
+// drain 返回跳过的路径总数、涉及的池子数与跳过路径最多的前 limit 个池子（数量相同按地址排序），并清空计数
+func (t *staleReserveTally) drain(limit int) (int, int, []staleReservePool) {
+	t.mu.Lock()
+	pools := t.pools
+	t.pools = nil
+	t.mu.Unlock()
+
+	total := 0
+	sorted := make([]staleReservePool, 0, len(pools))
+	for _, entry := range pools {
+		total += entry.Paths
+		sorted = append(sorted, *entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Paths != sorted[j].Paths {
+			return sorted[i].Paths > sorted[j].Paths
+		}
+		return sorted[i].Address.Cmp(sorted[j].Address) < 0
+	})
+	return total, len(sorted), sorted[:min(limit, len(sorted))]
+}
+
+// flushStaleReserves 输出本轮因储备量过期跳过路径的汇总日志，返回跳过最多的池子；本轮没有跳过时不输出
+func (af *ArbitrageFinder) flushStaleReserves() []staleReservePool {
+	total, pools, top := af.staleTally.drain(staleReserveTopPools)
+	if total == 0 {
+		return nil
+	}
+	parts := make([]string, len(top))
+	for i, pool := range top {
+		parts[i] = fmt.Sprintf("%s %d 条 (%s)", pool.Address.Hex(), pool.Paths, staleReason(pool.Age))
+	}
+	log.Printf("本轮跳过储备量过期的套利路径 %d 条，涉及 %d 个池子 (ARB_MAX_RESERVE_AGE %s)，跳过最多的: %s",
+		total, pools, af.cfg.ArbMaxReserveAge, strings.Join(parts, ", "))
+	return top
+}
+
+// staleReason 描述过期池子的储备量年龄，age 为 -1 表示未记录储备量更新时间
+func staleReason(age time.Duration) string {
+	if age < 0 {
+		return "未记录储备量更新时间"
+	}
+	return fmt.Sprintf("储备量已 %s 未更新", age.Truncate(time.Second))
+}
+
 // simulatePath 模拟套利路径，使用实际的 AMM 公式计算
-// 参数 initial 是初始投入的 token0 数量（以最小单位计，例如 1.0 表示 1e18 个 token）
+// 参数 initial 是初始投入的 token0 数量（以最小单位计，例如 1.0 表示 1 wei）
 // 参数 path 是套利路径，每一步都是一个交易对
 // 参数 minProfit 是最小利润要求（以 token 数量计）
-// 返回最终得到的 token0 数量和是否盈利
-// 逻辑：假设买入 1 个 token0，通过路径交换后，如果最终得到的 token0 数量 > 1，则认为有盈利
-func (af *ArbitrageFinder) simulatePath(initial float64, path []graphEdge, minProfit float64) (float64, bool) {
+// 返回最终得到的 token0 数量和是否盈利；某一跳池子缺少储备量时返回错误，调用方只丢弃该路径
+// 精度：初始数量与收益门槛换算为整数后，每跳输出与转账税都按 *big.Int 计算并向下取整（见 quoteHopInt），
+// 与链上合约一样逐跳舍入，跳数再多也不会像 float64 那样累积误差；盈亏判断在整数上进行，最终数量严格大于
+// 初始数量且利润不低于 minProfit 才算盈利，保本的路径不会因舍入被误判为盈利；只有返回的最终数量转换为 float64 用于日志与报告
+func (af *ArbitrageFinder) simulatePath(initial float64, path []graphEdge, minProfit float64) (float64, bool, error) {
 	if len(path) == 0 {
-		return 0, false
+		return 0, false, nil
 	}
 
-	// 假设初始买入 1 个 token0（以最小单位计，例如 1.0 表示 1e18 个 token）
-	// 不需要考虑 USD 价格，直接用 token 数量进行比较
-	amount := initial
+	initialInt := floatToAmount(initial)
+	// 起始代币转入第一个池子时先扣除其转账税
+	amount := applyTransferTaxInt(initialInt, af.tokens.TaxBps(path[0].FromToken))
 
 	// 遍历路径中的每一步，使用实际的 AMM 公式计算
 	for _, step := range path {
-		pool := step.Pool
-
-		// 检查储备量是否有效
-		if pool.Reserve0 == nil || pool.Reserve1 == nil {
-			return 0, false
+		var err error
+		amount, err = quoteHopInt(step, amount)
+		if err != nil {
+			return 0, false, err
 		}
 
-		reserve0 := new(big.Float).SetInt(pool.Reserve0)
-		reserve1 := new(big.Float).SetInt(pool.Reserve1)
+		// 输出代币从池子转出时扣除其转账税（套利合约通常将输出直接转入下一个池子，每跳只转账一次）
+		amount = applyTransferTaxInt(amount, af.tokens.TaxBps(step.ToToken))
 
-		// 检查储备量是否足够
-		if reserve0.Cmp(big.NewFloat(0)) <= 0 || reserve1.Cmp(big.NewFloat(0)) <= 0 {
-			return 0, false
+		if amount.Sign() <= 0 {
+			return 0, false, nil
 		}
+	}
 
-		amountFloat := big.NewFloat(amount)
-
-		// 根据协议类型选择不同的计算公式
-		if pool.Protocol == ProtocolUniswapV2Like {
-			// V2 使用恒定乘积公式: x * y = k
-			// Uniswap V2 标准公式: amountOut = (amountIn * reserveOut * 997) / ((reserveIn * 1000) + (amountIn * 997))
-			// 其中 997/1000 表示扣除 0.3% 手续费
-			var reserveIn, reserveOut *big.Float
-			if step.FromToken == pool.Token0 {
-				reserveIn = reserve0
-				reserveOut = reserve1
-			} else {
-				reserveIn = reserve1
-				reserveOut = reserve0
-			}
-
-			// 计算手续费率（例如 0.3% 手续费 = 997/1000）
-			feeRatio := step.Fee / 100.0          // 例如 0.3 表示 0.3%
-			feeMultiplier := 1000.0 - feeRatio*10 // 例如 0.3% = 997
-			amountInWithFee := new(big.Float).Mul(amountFloat, big.NewFloat(feeMultiplier))
-
-			// 计算输出量: amountOut = (amountIn * 997 * reserveOut) / ((reserveIn * 1000) + (amountIn * 997))
-			numerator := new(big.Float).Mul(amountInWithFee, reserveOut)
-			denominatorPart1 := new(big.Float).Mul(reserveIn, big.NewFloat(1000.0))
-			denominator := new(big.Float).Add(denominatorPart1, amountInWithFee)
-			amountOut := new(big.Float).Quo(numerator, denominator)
-
-			amount, _ = amountOut.Float64()
-		} else if pool.Protocol == ProtocolUniswapV3 || pool.Protocol == ProtocolUniswapV4 {
-			// V3/V4 使用集中流动性模型，计算更复杂
-			// 简化处理：使用类似 V2 的公式，但需要考虑价格范围
-			// 这里使用简化的恒定乘积公式作为近似
-			var reserveIn, reserveOut *big.Float
-			if step.FromToken == pool.Token0 {
-				reserveIn = reserve0
-				reserveOut = reserve1
-			} else {
-				reserveIn = reserve1
-				reserveOut = reserve0
-			}
+	// 利润 = 最终得到的 token0 数量 - 初始投入的 token0 数量
+	profit := new(big.Int).Sub(amount, initialInt)
+	estimated, _ := new(big.Float).SetInt(amount).Float64()
+	return estimated, profit.Sign() > 0 && profit.Cmp(af.minProfitAmount(path[0].FromToken, minProfit)) >= 0, nil
+}
 
-			// V3 手续费通常从合约读取，这里使用配置的费率
-			// V3 手续费单位是 1e-6，例如 3000 表示 0.3%
-			feeRatio := step.Fee / 100.0          // 例如 0.3 表示 0.3%
-			feeMultiplier := 1000.0 - feeRatio*10 // 例如 0.3% = 997
-			amountInWithFee := new(big.Float).Mul(amountFloat, big.NewFloat(feeMultiplier))
+// minProfitAmount 返回起始代币的整数收益门槛：ARB_MIN_PROFIT_WEI 中配置了该代币时直接使用配置值，
+// 边界情况不经过浮点换算；否则使用按 USD 门槛换算出的 minProfit
+func (af *ArbitrageFinder) minProfitAmount(startToken common.Address, minProfit float64) *big.Int {
+	if wei, ok := af.cfg.ArbMinProfitWei[startToken]; ok {
+		return wei
+	}
+	return floatToAmount(minProfit)
+}
 
-			// 简化计算：使用类似 V2 的恒定乘积公式
-			// 注意：V3 的实际计算需要考虑 tick 和流动性分布，这里使用简化公式作为近似
-			numerator := new(big.Float).Mul(amountInWithFee, reserveOut)
-			denominatorPart1 := new(big.Float).Mul(reserveIn, big.NewFloat(1000.0))
-			denominator := new(big.Float).Add(denominatorPart1, amountInWithFee)
-			amountOut := new(big.Float).Quo(numerator, denominator)
+// checkSanity 识别被操纵或数据异常的路径：
+// 收益倍数超过 ArbMaxCycleMultiplier 时几乎一定是储备量数据错误；
+// 任一跳成交价与现货价之比超出 [1/ArbMaxHopDeviation, ArbMaxHopDeviation] 说明投入量远超池子深度或储备量被篡改
+func (af *ArbitrageFinder) checkSanity(path []graphEdge, initial, estimated float64) error {
+	if multiplier := estimated / initial; multiplier > af.cfg.ArbMaxCycleMultiplier {
+		return fmt.Errorf("收益倍数 %.4f 超过上限 %.2f", multiplier, af.cfg.ArbMaxCycleMultiplier)
+	}
 
-			amount, _ = amountOut.Float64()
-		} else {
-			// V1 或其他协议，使用简化的费率扣除
-			feeRatio := step.Fee / 100.0
-			amount = amount * (1 - feeRatio)
+	amount := applyTransferTax(initial, af.tokens.TaxBps(path[0].FromToken))
+	for idx, step := range path {
+		out, err := quoteHop(step, amount)
+		if err != nil {
+			return err
 		}
-
-		// 检查金额是否有效
-		if amount <= 0 {
-			return 0, false
+		spot := spotPrice(step)
+		if spot <= 0 || amount <= 0 {
+			return fmt.Errorf("第 %d 跳池子 %s 现货价格无效", idx+1, step.Pool.Address.Hex())
 		}
+		ratio := (out / amount) / spot
+		if ratio > af.cfg.ArbMaxHopDeviation || ratio < 1/af.cfg.ArbMaxHopDeviation {
+			return fmt.Errorf("第 %d 跳池子 %s 成交价 %.6g 偏离现货价 %.6g 超过 %.1f 倍",
+				idx+1, step.Pool.Address.Hex(), out/amount, spot, af.cfg.ArbMaxHopDeviation)
+		}
+		amount = applyTransferTax(out, af.tokens.TaxBps(step.ToToken))
 	}
-
-	// 计算利润：最终得到的 token0 数量 - 初始投入的 token0 数量
-	// 如果最终数量 > 初始数量，则认为有盈利
-	profit := amount - initial
-	return amount, profit >= minProfit
+	return nil
 }
 
+// convertToOpportunity 将套利环转换为发布到队列的机会，代币地址以校验和格式保存，与存储主键和 JSON 输出一致
 func convertToOpportunity(path []graphEdge, startToken common.Address, initialAmount, estimated float64) ArbitrageOpportunity {
 	steps := make([]ArbitrageStep, 0, len(path))
 	for _, edge := range path {
@@ -348,7 +947,7 @@ func convertToOpportunity(path []graphEdge, startToken common.Address, initialAm
 			FromToken: edge.FromToken.Hex(),
 			ToToken:   edge.ToToken.Hex(),
 			Protocol:  edge.Protocol,
-			Fee:       edge.Fee,
+			FeePips:   edge.FeePips,
 		})
 	}
 	return ArbitrageOpportunity{
@@ -359,19 +958,69 @@ func convertToOpportunity(path []graphEdge, startToken common.Address, initialAm
 	}
 }
 
+// isPathSeen 判断路径是否仍处于 ARB_PATH_COOLDOWN 静默期内
 func (af *ArbitrageFinder) isPathSeen(key string) bool {
 	af.mu.RLock()
 	defer af.mu.RUnlock()
-	_, exists := af.seenPaths[key]
-	return exists
+	until, exists := af.seenPaths[key]
+	return exists && time.Now().Before(until)
 }
 
+// markPath 记录路径已推送，ARB_PATH_COOLDOWN 内不再重复推送；写入存储失败只记录日志，本进程内的去重不受影响
 func (af *ArbitrageFinder) markPath(key string) {
+	if af.cfg.ArbPathCooldown <= 0 {
+		return
+	}
+	until := time.Now().Add(af.cfg.ArbPathCooldown)
+	af.mu.Lock()
+	af.seenPaths[key] = until
+	af.mu.Unlock()
+
+	if err := af.store.MarkPathSeen(key, until); err != nil {
+		log.Printf("记录已推送路径失败: %v", err)
+	}
+}
+
+// loadSeenPaths 从存储恢复仍处于静默期的路径，避免重启后重复推送仍然有效的套利机会
+func (af *ArbitrageFinder) loadSeenPaths(ctx context.Context) {
+	if af.cfg.ArbPathCooldown <= 0 {
+		return
+	}
+	paths, err := af.store.ListSeenPaths(ctx, time.Now())
+	if err != nil {
+		log.Printf("恢复已推送路径失败: %v", err)
+		return
+	}
 	af.mu.Lock()
 	defer af.mu.Unlock()
-	af.seenPaths[key] = struct{}{}
+	for key, until := range paths {
+		af.seenPaths[key] = until
+	}
+	if len(paths) > 0 {
+		log.Printf("从存储恢复 %d 条处于静默期的已推送路径", len(paths))
+	}
 }
 
+// pruneSeenPaths 删除静默期已结束的路径，同时清理存储中的过期记录
+func (af *ArbitrageFinder) pruneSeenPaths(now time.Time) {
+	af.mu.Lock()
+	for key, until := range af.seenPaths {
+		if !now.Before(until) {
+			delete(af.seenPaths, key)
+		}
+	}
+	af.mu.Unlock()
+
+	if _, err := af.store.DeleteExpiredPaths(now); err != nil {
+		log.Printf("清理过期的已推送路径失败: %v", err)
+	}
+}
+
+// hashPath 计算套利环的规范化键，用于去重
+// 规范化方式：保持边的先后顺序，取所有旋转中字典序最小的一种拼接结果。
+// 因此同一个环从任意位置起算（A->B->C->A 与 B->C->A->B）得到相同的键，
+// 而方向相反的环（A->C->B->A）各边的 from/to 不同，得到不同的键；
+// 使用同一组边但顺序不同的环也不会被误判为重复；地址均为校验和格式（与 normalizeAddress 一致），键与地址来源的大小写无关
 func hashPath(path []graphEdge) string {
 	if len(path) == 0 {
 		return ""
@@ -380,8 +1029,15 @@ func hashPath(path []graphEdge) string {
 	for _, edge := range path {
 		items = append(items, edge.Protocol+":"+edge.Pool.Address.Hex()+":"+edge.FromToken.Hex()+"->"+edge.ToToken.Hex())
 	}
-	sort.Strings(items)
-	return strings.Join(items, "|")
+
+	best := ""
+	for offset := range items {
+		rotated := strings.Join(append(append([]string{}, items[offset:]...), items[:offset]...), "|")
+		if offset == 0 || rotated < best {
+			best = rotated
+		}
+	}
+	return best
 }
 
 func formatPath(path []graphEdge) string {
@@ -401,9 +1057,9 @@ func formatPath(path []graphEdge) string {
 		builder.WriteString(" -> ")
 		builder.WriteString(edge.ToToken.Hex())
 		builder.WriteString(" (token0=")
-		builder.WriteString(edge.Pool.Token0.Hex())
+		builder.WriteString(edge.Pool.Token0().Hex())
 		builder.WriteString(", token1=")
-		builder.WriteString(edge.Pool.Token1.Hex())
+		builder.WriteString(edge.Pool.Token1().Hex())
 		builder.WriteString(")")
 	}
 	return builder.String()
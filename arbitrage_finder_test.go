@@ -0,0 +1,781 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// newTestFinder 创建使用临时存储与空预言机的套利发现者，cfg 中未设置的可疑收益阈值取宽松值
+func newTestFinder(t *testing.T, cfg *AppConfig) (*ArbitrageFinder, *PriceOracle) {
+	t.Helper()
+	if cfg.ArbMaxCycleMultiplier == 0 {
+		cfg.ArbMaxCycleMultiplier = 1000
+	}
+	if cfg.ArbMaxHopDeviation == 0 {
+		cfg.ArbMaxHopDeviation = 1000
+	}
+	store := newTestPoolStore(t)
+	oracle := NewPriceOracle(cfg.WrappedNative)
+	finder := NewArbitrageFinder(store, NewArbitrageQueue(64), cfg, oracle, NewTokenRegistry(nil, store, cfg), NewPoolBlacklist())
+	return finder, oracle
+}
+
+// twoPoolCircle 返回 tokenA -> tokenB -> tokenA 的两池套利环
+func twoPoolCircle(first, second poolDetail, tokenA, tokenB common.Address) arbitrageCircle {
+	return arbitrageCircle{Route: []poolDetail{first, second}, Path: []common.Address{tokenA, tokenB, tokenA}}
+}
+
+// captureLog 在 fn 执行期间捕获标准日志输出
+func captureLog(t *testing.T, fn func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(output)
+	fn()
+	return buf.String()
+}
+
+// TestHandleCircleDropLogging 被丢弃的路径总是计数，只有开启 DEBUG_ARB_DROPS 时才逐条输出日志
+func TestHandleCircleDropLogging(t *testing.T) {
+	tokenA, tokenB := testAddr(1), testAddr(2)
+	healthy := testPool(testAddr(100), tokenA, tokenB, units(100, 18), units(100, 18), 30)
+	missing := testPool(testAddr(101), tokenA, tokenB, nil, nil, 30)
+	// 第二个池子价格是第一个的 10 倍，收益倍数远超上限
+	skewed := testPool(testAddr(102), tokenA, tokenB, units(1000, 18), units(100, 18), 30)
+
+	tests := []struct {
+		name           string
+		debug          bool
+		circle         arbitrageCircle
+		wantMissing    uint64
+		wantSuspicious uint64
+		wantLog        string
+	}{
+		{name: "missing reserves counted silently", circle: twoPoolCircle(healthy, missing, tokenA, tokenB), wantMissing: 1},
+		{name: "missing reserves logged in debug", debug: true, circle: twoPoolCircle(healthy, missing, tokenA, tokenB), wantMissing: 1, wantLog: "丢弃套利路径"},
+		{name: "suspicious cycle counted silently", circle: twoPoolCircle(healthy, skewed, tokenA, tokenB), wantSuspicious: 1},
+		{name: "suspicious cycle logged in debug", debug: true, circle: twoPoolCircle(healthy, skewed, tokenA, tokenB), wantSuspicious: 1, wantLog: "丢弃可疑套利路径"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			af, oracle := newTestFinder(t, &AppConfig{DebugArbDrops: tt.debug, ArbMaxCycleMultiplier: 2, ArbInitialCapital: 1})
+			oracle.prices[tokenA] = 1e-18
+			output := captureLog(t, func() {
+				if af.handleCircle(tt.circle) {
+					t.Fatal("路径不应被推送")
+				}
+			})
+			if got := af.droppedMissingReserves.Load(); got != tt.wantMissing {
+				t.Errorf("储备量缺失丢弃 %d，期望 %d", got, tt.wantMissing)
+			}
+			if got := af.droppedSuspicious.Load(); got != tt.wantSuspicious {
+				t.Errorf("可疑收益丢弃 %d，期望 %d", got, tt.wantSuspicious)
+			}
+			for _, marker := range []string{"丢弃套利路径", "丢弃可疑套利路径"} {
+				if logged := strings.Contains(output, marker); logged != (marker == tt.wantLog) {
+					t.Errorf("日志包含 %q = %v，输出: %s", marker, logged, output)
+				}
+			}
+		})
+	}
+}
+
+// TestFilterLiquidPoolsSkipsEmptyReserves 任一代币储备量为 0 或缺失的池子不参与枚举，即使另一侧按 USD 计流动性足够
+func TestFilterLiquidPoolsSkipsEmptyReserves(t *testing.T) {
+	tokenA, tokenB := testAddr(1), testAddr(2)
+	tests := []struct {
+		name string
+		pool poolDetail
+		want bool
+	}{
+		{name: "both reserves", pool: testPool(testAddr(100), tokenA, tokenB, units(10, 18), units(10, 18), 30), want: true},
+		{name: "one side empty", pool: testPool(testAddr(101), tokenA, tokenB, units(1000, 18), big.NewInt(0), 30)},
+		{name: "reserves not loaded", pool: testPool(testAddr(102), tokenA, tokenB, nil, nil, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			af, oracle := newTestFinder(t, &AppConfig{})
+			oracle.prices[tokenA] = 1e-18
+			if got := len(af.filterLiquidPools([]poolDetail{tt.pool})) == 1; got != tt.want {
+				t.Fatalf("池子参与枚举 %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHandleCircleUnpricedProbe 没有 USD 价格的起始代币按 1 个完整代币（10^decimals）试探，
+// 不再投入 1 个最小单位（每跳向下取整后输出为 0，任何路径都不会盈利）
+func TestHandleCircleUnpricedProbe(t *testing.T) {
+	tokenA, tokenB := testAddr(1), testAddr(2)
+	tests := []struct {
+		name        string
+		decimals    int
+		known       bool
+		wantInitial float64
+	}{
+		{name: "six decimals", decimals: 6, known: true, wantInitial: 1e6},
+		{name: "eighteen decimals", decimals: 18, known: true, wantInitial: 1e18},
+		{name: "unknown decimals", wantInitial: 1e18},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			af, _ := newTestFinder(t, &AppConfig{})
+			if tt.known {
+				af.tokens.cache.Store(tokenA, tokenMetadata{Address: tokenA, Decimals: tt.decimals})
+			}
+			if got := af.probeAmount(tokenA); got != tt.wantInitial {
+				t.Fatalf("试探投入量 %g，期望 %g", got, tt.wantInitial)
+			}
+
+			// 两个池子价差约 10%，深度足以让 1 个完整代币的试探量盈利
+			scale := units(1, tt.decimals+12)
+			if !tt.known {
+				scale = units(1, 30)
+			}
+			cheap := testPool(testAddr(100), tokenA, tokenB, scale, new(big.Int).Mul(scale, big.NewInt(11)), 30)
+			dear := testPool(testAddr(101), tokenA, tokenB, new(big.Int).Mul(scale, big.NewInt(11)), new(big.Int).Mul(scale, big.NewInt(10)), 30)
+			cheap.Reserves[1].Quo(cheap.Reserves[1], big.NewInt(10))
+			ch := af.queue.Subscribe()
+			if !af.handleCircle(twoPoolCircle(cheap, dear, tokenA, tokenB)) {
+				t.Fatal("有价差的套利环应被推送")
+			}
+			op := <-ch
+			if op.InitialAmount != tt.wantInitial {
+				t.Fatalf("推送的机会投入量 %g，期望 %g", op.InitialAmount, tt.wantInitial)
+			}
+		})
+	}
+}
+
+// TestHandleCircleStaleReserves 储备量过期或未记录更新时间的池子所在的环被跳过，新鲜的环照常模拟；
+// 跳过的路径只计数，轮末汇总为一条日志，开启 DEBUG_ARB_DROPS 时才逐条输出
+func TestHandleCircleStaleReserves(t *testing.T) {
+	tokenA, tokenB := testAddr(1), testAddr(2)
+	now := time.Now()
+	withUpdatedAt := func(pool poolDetail, updatedAt *time.Time) poolDetail {
+		pool.ReserveUpdatedAt = updatedAt
+		return pool
+	}
+	fresh, old := now.Add(-time.Minute), now.Add(-2*time.Hour)
+	freshA := withUpdatedAt(testPool(testAddr(100), tokenA, tokenB, units(100, 18), units(100, 18), 30), &fresh)
+	freshB := withUpdatedAt(testPool(testAddr(101), tokenA, tokenB, units(100, 18), units(100, 18), 30), &fresh)
+	stale := withUpdatedAt(testPool(testAddr(102), tokenA, tokenB, units(100, 18), units(100, 18), 30), &old)
+	unknown := withUpdatedAt(testPool(testAddr(103), tokenA, tokenB, units(100, 18), units(100, 18), 30), nil)
+
+	tests := []struct {
+		name      string
+		maxAge    time.Duration
+		debug     bool
+		circles   []arbitrageCircle
+		wantStale uint64
+		wantTop   []staleReservePool
+		wantPath  bool
+	}{
+		{name: "fresh pools simulated", maxAge: time.Hour, circles: []arbitrageCircle{twoPoolCircle(freshA, freshB, tokenA, tokenB)}},
+		{name: "limit disabled", circles: []arbitrageCircle{twoPoolCircle(freshA, stale, tokenA, tokenB), twoPoolCircle(unknown, freshB, tokenA, tokenB)}},
+		{
+			name:   "stale pools aggregated",
+			maxAge: time.Hour,
+			circles: []arbitrageCircle{
+				twoPoolCircle(freshA, stale, tokenA, tokenB),
+				twoPoolCircle(freshB, stale, tokenA, tokenB),
+				twoPoolCircle(unknown, freshA, tokenA, tokenB),
+				twoPoolCircle(freshA, freshB, tokenA, tokenB),
+			},
+			wantStale: 3,
+			wantTop:   []staleReservePool{{Address: stale.Address, Paths: 2}, {Address: unknown.Address, Paths: 1, Age: -1}},
+		},
+		{
+			name:      "debug logs each path",
+			maxAge:    time.Hour,
+			debug:     true,
+			circles:   []arbitrageCircle{twoPoolCircle(freshA, stale, tokenA, tokenB)},
+			wantStale: 1,
+			wantTop:   []staleReservePool{{Address: stale.Address, Paths: 1}},
+			wantPath:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			af, oracle := newTestFinder(t, &AppConfig{ArbMaxReserveAge: tt.maxAge, DebugArbDrops: tt.debug, ArbInitialCapital: 1})
+			oracle.prices[tokenA] = 1e-18
+			var top []staleReservePool
+			output := captureLog(t, func() {
+				for _, circle := range tt.circles {
+					af.handleCircle(circle)
+				}
+				top = af.flushStaleReserves()
+			})
+			if got := af.droppedStaleReserves.Load(); got != tt.wantStale {
+				t.Fatalf("储备量过期跳过 %d，期望 %d", got, tt.wantStale)
+			}
+			if len(top) != len(tt.wantTop) {
+				t.Fatalf("过期池子 %+v，期望 %+v", top, tt.wantTop)
+			}
+			for i, want := range tt.wantTop {
+				if top[i].Address != want.Address || top[i].Paths != want.Paths || (top[i].Age < 0) != (want.Age < 0) {
+					t.Fatalf("第 %d 个过期池子 %+v，期望 %+v", i, top[i], want)
+				}
+			}
+			if summarized := strings.Contains(output, "本轮跳过储备量过期的套利路径"); summarized != (tt.wantStale > 0) {
+				t.Fatalf("汇总日志输出 %v，期望 %v，输出: %s", summarized, tt.wantStale > 0, output)
+			}
+			if perPath := strings.Contains(output, "跳过储备量过期的套利路径 (跳数"); perPath != tt.wantPath {
+				t.Fatalf("逐条日志输出 %v，期望 %v，输出: %s", perPath, tt.wantPath, output)
+			}
+			if total, _, _ := af.staleTally.drain(staleReserveTopPools); total != 0 {
+				t.Fatalf("汇总后仍剩余 %d 条计数", total)
+			}
+		})
+	}
+}
+
+// TestStaleReserveTallyDrain 按跳过路径数降序、数量相同按地址排序，只返回前 limit 个池子，总数与池子数按全部池子统计
+func TestStaleReserveTallyDrain(t *testing.T) {
+	tests := []struct {
+		name      string
+		adds      []int
+		limit     int
+		wantTotal int
+		wantPools int
+		wantTop   []common.Address
+	}{
+		{name: "empty", limit: 5},
+		{name: "ordered by paths", adds: []int{1, 2, 2, 3, 3, 3}, limit: 5, wantTotal: 6, wantPools: 3, wantTop: []common.Address{testAddr(3), testAddr(2), testAddr(1)}},
+		{name: "ties ordered by address", adds: []int{2, 1}, limit: 5, wantTotal: 2, wantPools: 2, wantTop: []common.Address{testAddr(1), testAddr(2)}},
+		{name: "limited", adds: []int{1, 2, 2, 3, 3, 3}, limit: 2, wantTotal: 6, wantPools: 3, wantTop: []common.Address{testAddr(3), testAddr(2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tally staleReserveTally
+			for _, n := range tt.adds {
+				tally.add(testAddr(n), time.Hour)
+			}
+			total, pools, top := tally.drain(tt.limit)
+			if total != tt.wantTotal || pools != tt.wantPools || len(top) != len(tt.wantTop) {
+				t.Fatalf("drain = %d, %d, %+v，期望 %d, %d, %v", total, pools, top, tt.wantTotal, tt.wantPools, tt.wantTop)
+			}
+			for i, address := range tt.wantTop {
+				if top[i].Address != address {
+					t.Fatalf("第 %d 个池子 %s，期望 %s", i, top[i].Address.Hex(), address.Hex())
+				}
+			}
+		})
+	}
+}
+
+// TestDiscoveryOrderDeterministic 同一组池子多次运行推送机会的顺序相同：全量枚举与 worker 数量无关，
+// 增量评估与池子更新到达的顺序无关
+func TestDiscoveryOrderDeterministic(t *testing.T) {
+	tokens := []common.Address{testAddr(1), testAddr(2), testAddr(3), testAddr(4)}
+	// 每个交易对两个池子，skewed 为 true 时第二个池子的价格偏离约 10%，两池之间存在套利环
+	pairPools := func(skewed bool) []poolDetail {
+		var pools []poolDetail
+		n := 0
+		for i := range tokens {
+			for j := i + 1; j < len(tokens); j++ {
+				skew := int64(1000)
+				if skewed {
+					skew = 1100
+				}
+				pools = append(pools,
+					testPool(testAddr(100+2*n), tokens[i], tokens[j], units(1000, 18), units(1000, 18), 30),
+					testPool(testAddr(101+2*n), tokens[i], tokens[j], units(1000, 18), units(skew, 18), 30))
+				n++
+			}
+		}
+		return pools
+	}
+	// 增量评估前全部池子价格一致，更新使每个交易对的第二个池子产生价差
+	var updates []PoolUpdated
+	for _, pool := range pairPools(true) {
+		if pool.Reserves[1].Cmp(pool.Reserves[0]) != 0 {
+			updates = append(updates, PoolUpdated{Address: pool.Address, Reserves: pool.Reserves, Block: 1})
+		}
+	}
+
+	run := func(t *testing.T, workers int, incremental bool, order []int) []string {
+		t.Helper()
+		af, _ := newTestFinder(t, &AppConfig{ArbEnumerateWorkers: workers, ArbMaxHops: 3, ArbIncremental: true, ArbEnumerateTimeout: time.Minute})
+		for _, pool := range pairPools(!incremental) {
+			if err := af.store.InsertPoolIfNotExists(pool); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ch := af.queue.SubscribeWith(SubscribeOptions{Buffer: 1024})
+		summary := af.enumerateCycles(context.Background())
+		if incremental {
+			if summary.Profitable != 0 {
+				t.Fatalf("价格一致时全量枚举找到 %d 条盈利路径", summary.Profitable)
+			}
+			for _, i := range order[1:] {
+				af.NotifyPoolUpdated(updates[i])
+			}
+			af.runIncremental(context.Background(), updates[order[0]])
+		}
+
+		var published []string
+		for {
+			select {
+			case op := <-ch:
+				key := op.StartToken
+				for _, step := range op.Path {
+					key += ">" + step.Pool.Address.Hex()
+				}
+				published = append(published, key)
+			default:
+				return published
+			}
+		}
+	}
+
+	identity := make([]int, len(updates))
+	reversed := make([]int, len(updates))
+	for i := range updates {
+		identity[i] = i
+		reversed[i] = len(updates) - 1 - i
+	}
+	interleaved := append(append([]int{}, reversed[len(updates)/2:]...), identity[len(updates)/2:]...)
+
+	tests := []struct {
+		name        string
+		workers     int
+		incremental bool
+		order       []int
+	}{
+		{name: "full enumeration with one worker", workers: 1},
+		{name: "full enumeration with four workers", workers: 4},
+		{name: "full enumeration with eight workers", workers: 8},
+		{name: "incremental in arrival order", workers: 1, incremental: true, order: identity},
+		{name: "incremental in reversed order", workers: 4, incremental: true, order: reversed},
+		{name: "incremental in interleaved order", workers: 8, incremental: true, order: interleaved},
+	}
+	want := map[bool][]string{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := run(t, tt.workers, tt.incremental, tt.order)
+			if len(first) < 2 {
+				t.Fatalf("推送了 %d 个机会，期望多个", len(first))
+			}
+			// 同样的输入再运行一次应得到相同顺序，再与同一模式下前面用例的结果比较
+			if again := run(t, tt.workers, tt.incremental, tt.order); strings.Join(again, ",") != strings.Join(first, ",") {
+				t.Fatalf("两次运行推送顺序不同:\n%v\n%v", first, again)
+			}
+			if prev, ok := want[tt.incremental]; ok && strings.Join(prev, ",") != strings.Join(first, ",") {
+				t.Fatalf("推送顺序 %v，与同一模式下的其他用例 %v 不同", first, prev)
+			}
+			want[tt.incremental] = first
+		})
+	}
+}
+
+// TestHashPath 规范化键与起点无关：同一个环的各种旋转键相同，反向环、经过不同池子的环以及同一组边换序的环键不同
+func TestHashPath(t *testing.T) {
+	tokenA, tokenB, tokenC := testAddr(1), testAddr(2), testAddr(3)
+	pools := map[int]poolDetail{}
+	for _, n := range []int{10, 11, 12, 20, 21, 22} {
+		pools[n] = testPool(testAddr(n), tokenA, tokenB, units(1000, 18), units(1000, 18), 30)
+	}
+	type hop struct {
+		pool     int
+		from, to common.Address
+	}
+	path := func(hops ...hop) []graphEdge {
+		edges := make([]graphEdge, 0, len(hops))
+		for _, h := range hops {
+			edges = append(edges, graphEdge{Pool: pools[h.pool], Protocol: ProtocolUniswapV2Like, FromToken: h.from, ToToken: h.to})
+		}
+		return edges
+	}
+	triangle := path(hop{10, tokenA, tokenB}, hop{11, tokenB, tokenC}, hop{12, tokenC, tokenA})
+
+	tests := []struct {
+		name      string
+		a, b      []graphEdge
+		wantEqual bool
+	}{
+		{name: "identical", a: triangle, b: path(hop{10, tokenA, tokenB}, hop{11, tokenB, tokenC}, hop{12, tokenC, tokenA}), wantEqual: true},
+		{name: "rotated by one", a: triangle, b: path(hop{11, tokenB, tokenC}, hop{12, tokenC, tokenA}, hop{10, tokenA, tokenB}), wantEqual: true},
+		{name: "rotated by two", a: triangle, b: path(hop{12, tokenC, tokenA}, hop{10, tokenA, tokenB}, hop{11, tokenB, tokenC}), wantEqual: true},
+		{name: "reversed", a: triangle, b: path(hop{12, tokenA, tokenC}, hop{11, tokenC, tokenB}, hop{10, tokenB, tokenA})},
+		{name: "disjoint pools on the same tokens", a: triangle, b: path(hop{20, tokenA, tokenB}, hop{21, tokenB, tokenC}, hop{22, tokenC, tokenA})},
+		{name: "one pool differs", a: triangle, b: path(hop{10, tokenA, tokenB}, hop{21, tokenB, tokenC}, hop{12, tokenC, tokenA})},
+		{
+			name: "same edges in another order",
+			a:    path(hop{10, tokenA, tokenB}, hop{11, tokenB, tokenA}, hop{20, tokenA, tokenB}, hop{21, tokenB, tokenA}),
+			b:    path(hop{10, tokenA, tokenB}, hop{21, tokenB, tokenA}, hop{20, tokenA, tokenB}, hop{11, tokenB, tokenA}),
+		},
+		{name: "two-pool round trip rotated", a: path(hop{10, tokenA, tokenB}, hop{11, tokenB, tokenA}), b: path(hop{11, tokenB, tokenA}, hop{10, tokenA, tokenB}), wantEqual: true},
+		{name: "two-pool round trip reversed", a: path(hop{10, tokenA, tokenB}, hop{11, tokenB, tokenA}), b: path(hop{11, tokenA, tokenB}, hop{10, tokenB, tokenA})},
+		{name: "empty paths", wantEqual: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := hashPath(tt.a), hashPath(tt.b)
+			if (a == b) != tt.wantEqual {
+				t.Fatalf("键 %q 与 %q 相同 %v，期望 %v", a, b, a == b, tt.wantEqual)
+			}
+		})
+	}
+}
+
+// TestTwoPoolArbsMatchFindArb 同样的池子、同样的剪枝上界下，findTwoPoolArbs 从每个起点找到的两池环与 maxHops=2 的 findArb 完全相同
+func TestTwoPoolArbsMatchFindArb(t *testing.T) {
+	tests := []struct {
+		name   string
+		pools  []poolDetail
+		prune  bool
+		minWei *big.Int
+	}{
+		{name: "single pair without pruning", pools: boundTestPools()},
+		{name: "dense pools without pruning", pools: denseTestPools()},
+		{name: "dense pools pruned at break-even", pools: denseTestPools(), prune: true},
+		{name: "dense pools pruned above the ideal gain", pools: denseTestPools(), prune: true, minWei: units(5, 16)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tokens := poolTokens(tt.pools)
+			cfg := &AppConfig{}
+			if tt.minWei != nil {
+				cfg.ArbMinProfitWei = make(map[common.Address]*big.Int)
+				for _, token := range tokens {
+					cfg.ArbMinProfitWei[token] = tt.minWei
+				}
+			}
+			af, _ := newTestFinder(t, cfg)
+			index := newPoolIndex(tt.pools)
+			graph, err := newCycleGraph(ctx, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 每次枚举使用各自的上界，剪枝计数互不影响
+			bounds := func(start common.Address) *cycleBounds {
+				if !tt.prune {
+					return nil
+				}
+				b, err := graph.bounds(ctx, start, cfg.WrappedNative, 2, af.minProfitRatio(start))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return b
+			}
+
+			total := 0
+			for _, start := range tokens {
+				var fast, reference []arbitrageCircle
+				var steps int
+				af.findTwoPoolArbs(ctx, index, start, bounds(start), &fast, &steps)
+				af.findArb(ctx, index, start, start, 2, nil, []common.Address{start}, map[common.Address]struct{}{}, 1, bounds(start), &reference, &steps)
+				if fastKeys, referenceKeys := circlePathKeys(fast), circlePathKeys(reference); strings.Join(fastKeys, ",") != strings.Join(referenceKeys, ",") {
+					t.Fatalf("起点 %s: findTwoPoolArbs 找到 %v，findArb 找到 %v", start.Hex(), fastKeys, referenceKeys)
+				}
+				total += len(fast)
+			}
+			if total == 0 {
+				t.Fatal("没有找到任何两池环，比较没有意义")
+			}
+		})
+	}
+}
+
+// TestThreePoolArbsMatchFindArb 同样的池子、同样的剪枝上界下，findThreePoolArbs 找到的三角环与 maxHops=3 的 findArb 中的三池环完全相同，
+// 与 findTwoPoolArbs 合并后与 findArb 的全部结果相同
+func TestThreePoolArbsMatchFindArb(t *testing.T) {
+	tests := []struct {
+		name   string
+		pools  []poolDetail
+		prune  bool
+		minWei *big.Int
+	}{
+		{name: "single triangle without pruning", pools: boundTestPools()},
+		{name: "dense pools without pruning", pools: denseTestPools()},
+		{name: "dense pools pruned at break-even", pools: denseTestPools(), prune: true},
+		{name: "dense pools pruned above the ideal gain", pools: denseTestPools(), prune: true, minWei: units(5, 16)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tokens := poolTokens(tt.pools)
+			cfg := &AppConfig{}
+			if tt.minWei != nil {
+				cfg.ArbMinProfitWei = make(map[common.Address]*big.Int)
+				for _, token := range tokens {
+					cfg.ArbMinProfitWei[token] = tt.minWei
+				}
+			}
+			af, _ := newTestFinder(t, cfg)
+			index := newPoolIndex(tt.pools)
+			graph, err := newCycleGraph(ctx, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bounds := func(start common.Address) *cycleBounds {
+				if !tt.prune {
+					return nil
+				}
+				b, err := graph.bounds(ctx, start, cfg.WrappedNative, 3, af.minProfitRatio(start))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return b
+			}
+
+			total := 0
+			for _, start := range tokens {
+				var two, three, reference []arbitrageCircle
+				var steps int
+				af.findTwoPoolArbs(ctx, index, start, bounds(start), &two, &steps)
+				af.findThreePoolArbs(ctx, index, start, bounds(start), &three, &steps)
+				af.findArb(ctx, index, start, start, 3, nil, []common.Address{start}, map[common.Address]struct{}{}, 1, bounds(start), &reference, &steps)
+
+				var triangles []arbitrageCircle
+				for _, circle := range reference {
+					if len(circle.Route) == 3 {
+						triangles = append(triangles, circle)
+					}
+				}
+				if got, want := circlePathKeys(three), circlePathKeys(triangles); strings.Join(got, ",") != strings.Join(want, ",") {
+					t.Fatalf("起点 %s: findThreePoolArbs 找到 %v，findArb 的三池环为 %v", start.Hex(), got, want)
+				}
+				if got, want := circlePathKeys(append(two, three...)), circlePathKeys(reference); strings.Join(got, ",") != strings.Join(want, ",") {
+					t.Fatalf("起点 %s: 两种快速枚举合并找到 %v，findArb 找到 %v", start.Hex(), got, want)
+				}
+				total += len(three)
+			}
+			if total == 0 {
+				t.Fatal("没有找到任何三角环，比较没有意义")
+			}
+		})
+	}
+}
+
+// TestEnumerateCyclesParallelMatchesSequential 多个 worker 并行枚举与单个 worker 顺序枚举得到同样的统计与同样的推送结果，
+// 两跳、三跳的快速枚举与更多跳数的 findArb 都覆盖
+func TestEnumerateCyclesParallelMatchesSequential(t *testing.T) {
+	run := func(t *testing.T, workers, maxHops int) (DiscoverySummary, []string) {
+		t.Helper()
+		af, _ := newTestFinder(t, &AppConfig{ArbEnumerateWorkers: workers, ArbMaxHops: maxHops, ArbEnumerateTimeout: time.Minute})
+		for _, pool := range denseTestPools() {
+			if err := af.store.InsertPoolIfNotExists(pool); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ch := af.queue.SubscribeWith(SubscribeOptions{Buffer: 4096})
+		summary := af.enumerateCycles(context.Background())
+		var published []string
+		for {
+			select {
+			case op := <-ch:
+				key := op.StartToken
+				for _, step := range op.Path {
+					key += ">" + step.Pool.Address.Hex()
+				}
+				published = append(published, key)
+			default:
+				return summary, published
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		maxHops int
+		workers int
+	}{
+		{name: "two hops with four workers", maxHops: 2, workers: 4},
+		{name: "three hops with two workers", maxHops: 3, workers: 2},
+		{name: "three hops with more workers than start tokens", maxHops: 3, workers: 16},
+		{name: "four hops with four workers", maxHops: 4, workers: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantPublished := run(t, 1, tt.maxHops)
+			if want.Paths == 0 || len(wantPublished) == 0 {
+				t.Fatalf("顺序枚举找到 %d 条路径、推送 %d 个机会，比较没有意义", want.Paths, len(wantPublished))
+			}
+			got, gotPublished := run(t, tt.workers, tt.maxHops)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%d 个 worker 的统计 %+v，顺序枚举为 %+v", tt.workers, got, want)
+			}
+			if strings.Join(gotPublished, ",") != strings.Join(wantPublished, ",") {
+				t.Fatalf("%d 个 worker 推送 %v，顺序枚举推送 %v", tt.workers, gotPublished, wantPublished)
+			}
+		})
+	}
+}
+
+// TestHandleCircleRejectsPoisonedPools 储备量异常（1 wei 对 10^30）或价格溢出的池子构成的环即使模拟结果盈利也不推送，
+// 按收益倍数或单跳偏差被拒绝并计入可疑收益丢弃数；正常的价差环照常推送
+func TestHandleCircleRejectsPoisonedPools(t *testing.T) {
+	tokenA, tokenB := testAddr(1), testAddr(2)
+	healthy := testPool(testAddr(100), tokenA, tokenB, units(1000, 18), units(1000, 18), 30)
+	skewed := testPool(testAddr(101), tokenA, tokenB, units(1000, 18), units(1100, 18), 30)
+	// 1 wei 的 A 对应 10^30 的 B：现货价荒谬，投入的 A 几乎换走全部 B
+	absurd := testPool(testAddr(102), tokenA, tokenB, big.NewInt(1), units(1, 30), 30)
+	// 储备量超出 float64 范围，换算后现货价为 +Inf
+	overflow := testPool(testAddr(103), tokenA, tokenB, big.NewInt(1), new(big.Int).Exp(big.NewInt(10), big.NewInt(400), nil), 30)
+
+	tests := []struct {
+		name          string
+		circle        arbitrageCircle
+		maxMultiplier float64
+		maxDeviation  float64
+		wantPublished bool
+		wantLog       string
+	}{
+		{name: "healthy price gap published", circle: twoPoolCircle(skewed, healthy, tokenA, tokenB), maxMultiplier: 2, maxDeviation: 10, wantPublished: true},
+		{name: "absurd reserves exceed the cycle multiplier", circle: twoPoolCircle(absurd, healthy, tokenA, tokenB), maxMultiplier: 2, maxDeviation: 1e40, wantLog: "收益倍数"},
+		{name: "absurd reserves exceed the hop deviation", circle: twoPoolCircle(absurd, healthy, tokenA, tokenB), maxMultiplier: 1e40, maxDeviation: 10, wantLog: "偏离现货价"},
+		// 收益倍数上限放宽后仍由单跳检查拦截：+Inf 的现货价使成交价与现货价之比为 0
+		{name: "overflowing price exceeds the hop deviation", circle: twoPoolCircle(overflow, healthy, tokenA, tokenB), maxMultiplier: 1e40, maxDeviation: 10, wantLog: "偏离现货价"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			af, oracle := newTestFinder(t, &AppConfig{DebugArbDrops: true, ArbMaxCycleMultiplier: tt.maxMultiplier, ArbMaxHopDeviation: tt.maxDeviation, ArbInitialCapital: 1})
+			oracle.prices[tokenA] = 1e-18
+			ch := af.queue.SubscribeWith(SubscribeOptions{Buffer: 1})
+			var published bool
+			output := captureLog(t, func() { published = af.handleCircle(tt.circle) })
+			if published != tt.wantPublished {
+				t.Fatalf("推送 %v，期望 %v，日志: %s", published, tt.wantPublished, output)
+			}
+			select {
+			case op := <-ch:
+				if !tt.wantPublished {
+					t.Fatalf("可疑路径被推送到队列: %+v", op)
+				}
+			default:
+				if tt.wantPublished {
+					t.Fatal("正常路径没有推送到队列")
+				}
+			}
+			wantSuspicious := uint64(1)
+			if tt.wantPublished {
+				wantSuspicious = 0
+			}
+			if got := af.droppedSuspicious.Load(); got != wantSuspicious {
+				t.Fatalf("可疑收益丢弃 %d，期望 %d，日志: %s", got, wantSuspicious, output)
+			}
+			if !strings.Contains(output, tt.wantLog) {
+				t.Fatalf("日志缺少 %q: %s", tt.wantLog, output)
+			}
+		})
+	}
+}
+
+// gatedStore 在 gate 非空时让 ListPools 先通知 entered 再阻塞到 gate 关闭，用于让发现流程停在一轮执行中
+// calls 累计 ListPools 调用次数
+type gatedStore struct {
+	Store
+	gate    atomic.Pointer[chan struct{}]
+	entered chan struct{}
+	calls   atomic.Int64
+}
+
+func (s *gatedStore) ListPools(ctx context.Context, opts ListPoolsOptions) ([]poolDetail, error) {
+	s.calls.Add(1)
+	if gate := s.gate.Load(); gate != nil {
+		s.entered <- struct{}{}
+		<-*gate
+	}
+	return s.Store.ListPools(ctx, opts)
+}
+
+// TestTriggerDebounce 一轮发现执行期间连续到达的多次触发合并为恰好一轮额外的发现，所有请求拿到该轮的统计
+func TestTriggerDebounce(t *testing.T) {
+	tests := []struct {
+		name  string
+		burst int
+	}{
+		{name: "single trigger", burst: 1},
+		{name: "a few triggers", burst: 5},
+		{name: "many triggers", burst: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			af, _ := newTestFinder(t, &AppConfig{ArbReloadInterval: time.Hour, ArbEnumerateTimeout: time.Minute})
+			store := &gatedStore{Store: af.store, entered: make(chan struct{}, 1)}
+			af.store = store
+
+			output := captureLog(t, func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				stopped := make(chan struct{})
+				go func() {
+					defer close(stopped)
+					af.Start(ctx)
+				}()
+				defer func() {
+					cancel()
+					<-stopped
+				}()
+
+				// 启动时的一轮（加载与枚举各调用一次 ListPools）不再调用 ListPools 后才设置 gate，使第一个触发的那一轮停在执行中
+				waitFor(t, func() bool { return store.calls.Load() >= 2 })
+				gate := make(chan struct{})
+				store.gate.Store(&gate)
+				first := make(chan DiscoverySummary, 1)
+				go func() {
+					summary, err := af.Trigger(ctx)
+					if err != nil {
+						t.Errorf("第一个触发失败: %v", err)
+					}
+					first <- summary
+				}()
+				<-store.entered
+
+				// 本轮执行期间到达的触发全部登记后再放行
+				results := make(chan DiscoverySummary, tt.burst)
+				for i := 0; i < tt.burst; i++ {
+					go func() {
+						summary, err := af.Trigger(ctx)
+						if err != nil {
+							t.Errorf("触发失败: %v", err)
+						}
+						results <- summary
+					}()
+				}
+				waitFor(t, func() bool {
+					af.waitersMu.Lock()
+					defer af.waitersMu.Unlock()
+					return len(af.waiters) == tt.burst
+				})
+				store.gate.Store(nil)
+				close(gate)
+
+				firstSummary := <-first
+				var served DiscoverySummary
+				for i := 0; i < tt.burst; i++ {
+					summary := <-results
+					if i > 0 && !summary.StartedAt.Equal(served.StartedAt) {
+						t.Fatalf("合并的触发拿到不同轮次的统计: %v 与 %v", summary.StartedAt, served.StartedAt)
+					}
+					served = summary
+				}
+				if !served.StartedAt.After(firstSummary.StartedAt) {
+					t.Fatalf("合并的触发由 %v 开始的一轮服务，应晚于第一个触发的一轮 %v", served.StartedAt, firstSummary.StartedAt)
+				}
+				// 留出时间让多余的执行（若有）发生
+				time.Sleep(50 * time.Millisecond)
+			})
+
+			if got := strings.Count(output, "套利发现者加载到"); got != 3 {
+				t.Fatalf("共执行 %d 轮发现，期望启动 1 轮 + 第一个触发 1 轮 + 合并的 %d 个触发 1 轮，日志: %s", got, tt.burst, output)
+			}
+			if !strings.Contains(output, fmt.Sprintf("合并 %d 个请求", tt.burst)) {
+				t.Fatalf("日志中没有合并 %d 个请求的记录: %s", tt.burst, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// poolUpdateQueueSize 套利发现者缓存的池子更新事件数量，队列满时丢弃新事件，由下一次全量枚举兜底
+const poolUpdateQueueSize = 4096
+
+// finderSnapshot 最近一次全量枚举的池子索引，增量模式下按池子更新原地修改
+type finderSnapshot struct {
+	index *poolIndex
+	// graph 与 index 同步更新的理想兑换率图，用于增量搜索剪枝；全量枚举构建它时已超时则为 nil，不剪枝
+	graph   *cycleGraph
+	pools   map[common.Address]poolDetail
+	maxHops int
+	// starts 允许作为套利环起点的代币，为 nil 时任意代币都可作为起点
+	starts map[common.Address]struct{}
+}
+
+func newFinderSnapshot(index *poolIndex, pools []poolDetail, starts map[common.Address]struct{}, maxHops int, baseOnly bool) *finderSnapshot {
+	snapshot := &finderSnapshot{
+		index:   index,
+		pools:   make(map[common.Address]poolDetail, len(pools)),
+		maxHops: maxHops,
+	}
+	if baseOnly {
+		snapshot.starts = starts
+	}
+	for _, pool := range pools {
+		snapshot.pools[pool.Address] = pool
+	}
+	return snapshot
+}
+
+// isStart 判断代币能否作为套利环起点，与全量枚举选取起点的规则一致
+func (s *finderSnapshot) isStart(token common.Address) bool {
+	if s.starts == nil {
+		return true
+	}
+	_, ok := s.starts[token]
+	return ok
+}
+
+// NotifyPoolUpdated 接收发现者的池子更新事件，可直接作为 PoolDiscoverer.OnPoolUpdated 的回调
+// 未开启 ARB_INCREMENTAL 时忽略；不阻塞调用方，队列满时丢弃
+func (af *ArbitrageFinder) NotifyPoolUpdated(update PoolUpdated) {
+	if !af.cfg.ArbIncremental {
+		return
+	}
+	select {
+	case af.updates <- update:
+	default:
+	}
+}
+
+// runIncremental 合并当前积压的池子更新，把新储备量写入最近一次全量枚举的索引，
+// 再只重新评估经过这些池子的套利环；尚未执行过全量枚举时忽略更新
+func (af *ArbitrageFinder) runIncremental(ctx context.Context, first PoolUpdated) DiscoverySummary {
+	start := time.Now()
+	latest := map[common.Address]PoolUpdated{first.Address: first}
+drain:
+	for {
+		select {
+		case update := <-af.updates:
+			if prev, ok := latest[update.Address]; !ok || update.Block >= prev.Block {
+				latest[update.Address] = update
+			}
+		default:
+			break drain
+		}
+	}
+
+	summary := DiscoverySummary{StartedAt: start, Pools: len(latest)}
+	if af.snapshot == nil {
+		return summary
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, af.cfg.ArbEnumerateTimeout)
+	defer cancel()
+
+	// 按池子地址顺序应用更新，与全量枚举按地址排序起点一样，使重新评估与推送的顺序不受 map 遍历顺序影响
+	addresses := make([]common.Address, 0, len(latest))
+	for address := range latest {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].Cmp(addresses[j]) < 0 })
+
+	var affected []poolDetail
+	for _, address := range addresses {
+		if pool, ok := af.applyPoolUpdate(ctx, latest[address]); ok {
+			affected = append(affected, pool)
+		}
+	}
+	summary.LiquidPools = len(affected)
+
+	circles, pruned := af.cyclesThrough(ctx, affected)
+	summary.Paths = len(circles)
+	summary.PrunedBranches = int64(pruned)
+	droppedBase := af.droppedMissingReserves.Load()
+	staleBase := af.droppedStaleReserves.Load()
+	suspiciousBase := af.droppedSuspicious.Load()
+	for _, circle := range circles {
+		// 与全量枚举相同，初始投入量与收益门槛由 handleCircle 按起始代币价格换算
+		if af.handleCircle(circle) {
+			summary.Profitable++
+		}
+	}
+	summary.DroppedMissingReserves = af.droppedMissingReserves.Load() - droppedBase
+	summary.DroppedStaleReserves = af.droppedStaleReserves.Load() - staleBase
+	summary.DroppedSuspicious = af.droppedSuspicious.Load() - suspiciousBase
+	summary.StalePools = af.flushStaleReserves()
+	summary.TimedOut = ctx.Err() != nil
+	summary.Duration = time.Since(start)
+
+	log.Printf("增量评估: 更新池子 %d 个, 参与评估 %d 个, 重新评估路径 %d 条, 初步盈利 %d 条, 储备量缺失丢弃 %d 条, 储备量过期跳过 %d 条, 可疑收益丢弃 %d 条, 剪枝分支 %d 个, 耗时 %v",
+		summary.Pools, summary.LiquidPools, summary.Paths, summary.Profitable, summary.DroppedMissingReserves, summary.DroppedStaleReserves,
+		summary.DroppedSuspicious, summary.PrunedBranches, summary.Duration.Truncate(time.Millisecond))
+	return summary
+}
+
+// applyPoolUpdate 将更新后的储备量写入索引，返回更新后的池子以及它是否仍参与枚举
+// 不在索引中的池子（新发现或此前流动性不足）从存储读取完整信息；流动性不足的池子从索引移除
+func (af *ArbitrageFinder) applyPoolUpdate(ctx context.Context, update PoolUpdated) (poolDetail, bool) {
+	snapshot := af.snapshot
+	pool, indexed := snapshot.pools[update.Address]
+	if !indexed {
+		stored, found, err := af.store.GetPool(ctx, update.Address)
+		if err != nil {
+			log.Printf("读取池子 %s 失败，跳过增量评估: %v", update.Address.Hex(), err)
+			return poolDetail{}, false
+		}
+		if !found || !stored.Active {
+			return poolDetail{}, false
+		}
+		pool = stored
+	}
+	if len(update.Reserves) != len(pool.Tokens) {
+		return poolDetail{}, false
+	}
+	pool.Reserves = update.Reserves
+	// 储备量刚从日志读取，同步更新时间，避免被 ARB_MAX_RESERVE_AGE 误判为过期
+	now := time.Now()
+	pool.ReserveUpdatedAt = &now
+
+	if len(af.filterLiquidPools([]poolDetail{pool})) == 0 {
+		if indexed {
+			delete(snapshot.pools, pool.Address)
+			snapshot.index.Remove(pool)
+			snapshot.graph.remove(pool.Address)
+		}
+		return poolDetail{}, false
+	}
+	snapshot.pools[pool.Address] = pool
+	snapshot.index.Upsert(pool)
+	snapshot.graph.upsert(pool)
+	return pool, true
+}
+
+// cyclesThrough 通过代币索引找出经过指定池子的全部套利环，并按全量枚举的起点规则旋转为以起点代币开始的环
+// 对池子 P 中每个有序代币对 (x, y)，从 y 出发搜索不超过 maxHops-1 跳、到达 x 且不再使用 P 的路径，
+// 与 P 的 x -> y 拼接即为经过 P 的环；同一个环经过多个更新池子时只评估一次
+// 搜索按快照理想兑换率图上回到 x 的上界剪枝，每个 x 的上界在本次调用内只计算一次；返回找到的环与剪掉的分支数
+func (af *ArbitrageFinder) cyclesThrough(ctx context.Context, pools []poolDetail) ([]arbitrageCircle, int) {
+	snapshot := af.snapshot
+	seen := make(map[string]struct{})
+	var result []arbitrageCircle
+	explored := 0
+	boundsByTarget := make(map[common.Address]*cycleBounds)
+	pruned := func() int {
+		total := 0
+		for _, bounds := range boundsByTarget {
+			if bounds != nil {
+				total += bounds.pruned
+			}
+		}
+		return total
+	}
+	for _, pool := range pools {
+		for i, x := range pool.Tokens {
+			bounds, ok := boundsByTarget[x]
+			if !ok && snapshot.graph != nil {
+				// 计算上界时超时则 bounds 为 nil，随后的搜索也会因 ctx 立即结束
+				bounds, _ = snapshot.graph.walkBounds(ctx, x, af.cfg.WrappedNative, snapshot.maxHops-1)
+				boundsByTarget[x] = bounds
+			}
+			for j, y := range pool.Tokens {
+				if i == j {
+					continue
+				}
+				rate := hopIdealRate(pool, x, y)
+				if !bounds.promising(rate, y, snapshot.maxHops-1) {
+					continue
+				}
+				var found []arbitrageCircle
+				used := map[common.Address]struct{}{pool.Address: {}}
+				findWalks(ctx, snapshot.index, y, x, snapshot.maxHops-1, []poolDetail{pool}, []common.Address{x, y}, used, rate, bounds, &found, &explored)
+				for _, circle := range found {
+					for _, rotated := range rotateCircle(circle, snapshot.isStart) {
+						key := circleKey(rotated)
+						if _, ok := seen[key]; ok {
+							continue
+						}
+						seen[key] = struct{}{}
+						result = append(result, rotated)
+					}
+				}
+				if ctx.Err() != nil {
+					log.Printf("增量评估超出时间预算 %s，已找到 %d 条路径", af.cfg.ArbEnumerateTimeout, len(result))
+					return result, pruned()
+				}
+			}
+		}
+	}
+	return result, pruned()
+}
+
+// findWalks 从 tokenIn 出发搜索不超过 maxHops 跳、到达 target 的路径，池子不重复使用（used 为路径已使用的池子，回溯时移除）
+// 与 findArb 不同，到达 target 后仍继续向下搜索：经过 P 的环旋转到其他起点后，x 可能只是途经的代币
+// rate 为当前部分路径的理想兑换率乘积，按 bounds 乐观完成后仍达不到门槛的分支直接放弃；bounds 为 nil 时不剪枝
+func findWalks(ctx context.Context, index *poolIndex, tokenIn, target common.Address, maxHops int,
+	route []poolDetail, path []common.Address, used map[common.Address]struct{}, rate float64, bounds *cycleBounds,
+	walks *[]arbitrageCircle, explored *int) {
+
+	for _, pair := range index.PoolsByToken(tokenIn) {
+		if _, ok := used[pair.Address]; ok {
+			continue
+		}
+		inIdx := pair.TokenIndex(tokenIn)
+		for outIdx, tempOut := range pair.Tokens {
+			if outIdx == inIdx {
+				continue
+			}
+			*explored++
+			if *explored%enumerateCheckInterval == 0 && ctx.Err() != nil {
+				return
+			}
+			newRate := rate * hopIdealRate(pair, tokenIn, tempOut)
+			if !bounds.promising(newRate, tempOut, maxHops-1) {
+				continue
+			}
+
+			newRoute := append(append(make([]poolDetail, 0, len(route)+1), route...), pair)
+			newPath := append(append(make([]common.Address, 0, len(path)+1), path...), tempOut)
+			if tempOut == target {
+				*walks = append(*walks, arbitrageCircle{Route: newRoute, Path: newPath})
+			}
+			if maxHops > 1 {
+				used[pair.Address] = struct{}{}
+				findWalks(ctx, index, tempOut, target, maxHops-1, newRoute, newPath, used, newRate, bounds, walks, explored)
+				delete(used, pair.Address)
+			}
+		}
+	}
+}
+
+// rotateCircle 把闭合的套利环旋转为以每个可作为起点的代币开始的环
+// 全量枚举从起点出发、第一次回到起点即闭合，因此在环中出现多次的代币不能作为起点
+func rotateCircle(circle arbitrageCircle, isStart func(common.Address) bool) []arbitrageCircle {
+	hops := len(circle.Route)
+	occurrences := make(map[common.Address]int, hops)
+	for _, token := range circle.Path[:hops] {
+		occurrences[token]++
+	}
+	var rotated []arbitrageCircle
+	for k := 0; k < hops; k++ {
+		if occurrences[circle.Path[k]] > 1 || !isStart(circle.Path[k]) {
+			continue
+		}
+		route := make([]poolDetail, 0, hops)
+		route = append(route, circle.Route[k:]...)
+		route = append(route, circle.Route[:k]...)
+		path := make([]common.Address, 0, hops+1)
+		path = append(path, circle.Path[k:hops]...)
+		path = append(path, circle.Path[:k+1]...)
+		rotated = append(rotated, arbitrageCircle{Route: route, Path: path})
+	}
+	return rotated
+}
+
+// circleKey 按起点、池子与代币顺序生成套利环的键，不同起点的同一个环得到不同的键
+func circleKey(circle arbitrageCircle) string {
+	var builder strings.Builder
+	for i, pool := range circle.Route {
+		builder.WriteString(circle.Path[i].Hex())
+		builder.WriteString(">")
+		builder.WriteString(pool.Address.Hex())
+		builder.WriteString(">")
+	}
+	builder.WriteString(circle.Path[len(circle.Path)-1].Hex())
+	return builder.String()
+}
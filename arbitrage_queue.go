@@ -1,6 +1,11 @@
 package main
 
-import "sync"
+import (
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // ArbitrageOpportunity 表示潜在的套利路径
 type ArbitrageOpportunity struct {
@@ -8,6 +13,14 @@ type ArbitrageOpportunity struct {
 	StartToken      string
 	InitialAmount   float64
 	EstimatedReturn float64
+	// StartTokenPriceUSD 起始代币每个最小单位的 USD 价格，0 表示价格未知
+	StartTokenPriceUSD float64
+	// Cost 计算者估算的执行成本，发现阶段为零值
+	Cost executionCost
+	// MinReturn 计算者要求链上至少返回的起始代币数量（投入量 + 执行成本 + 收益门槛，最小单位），发现阶段为 nil
+	MinReturn *big.Int
+	// DiscoveredAt 机会发布到队列的时间，计算者据此丢弃排队过久的机会
+	DiscoveredAt time.Time
 }
 
 // ArbitrageStep 表示套利路径中的一步
@@ -16,39 +29,118 @@ type ArbitrageStep struct {
 	FromToken string
 	ToToken   string
 	Protocol  string
-	Fee       float64
+	FeePips   int
+	// PriceImpact 精算时本跳成交价相对池子现货价的偏离（含手续费），0.01 表示 1%
+	PriceImpact float64
 }
 
-// ArbitrageQueue 用于缓存套利机会
+// DropPolicy 订阅者缓冲区已满时的丢弃策略
+type DropPolicy int
+
+const (
+	// DropOldest 丢弃缓冲区中最旧的机会，为新机会腾出空间（默认）
+	DropOldest DropPolicy = iota
+	// DropNewest 丢弃新发布的机会，保留缓冲区中已有的数据
+	DropNewest
+)
+
+// SubscribeOptions 订阅选项
+type SubscribeOptions struct {
+	// Buffer 订阅者缓冲区大小，<= 0 时使用队列默认大小
+	Buffer int
+	// Policy 缓冲区已满时的丢弃策略
+	Policy DropPolicy
+}
+
+// arbitrageSubscriber 单个订阅者
+type arbitrageSubscriber struct {
+	ch     chan ArbitrageOpportunity
+	policy DropPolicy
+}
+
+// ArbitrageQueue 套利机会的广播中心，每个订阅者拥有独立的缓冲区，
+// 发布的机会会复制给所有订阅者，慢消费者只会丢弃自己缓冲区中的数据
 type ArbitrageQueue struct {
-	ch chan ArbitrageOpportunity
-	mu sync.RWMutex
+	mu          sync.Mutex
+	size        int
+	subscribers map[<-chan ArbitrageOpportunity]*arbitrageSubscriber
+	dropped     atomic.Uint64
 }
 
-// NewArbitrageQueue 创建新的套利队列
+// NewArbitrageQueue 创建新的套利队列，size 为订阅者默认缓冲区大小
 func NewArbitrageQueue(size int) *ArbitrageQueue {
+	if size <= 0 {
+		size = 1
+	}
 	return &ArbitrageQueue{
-		ch: make(chan ArbitrageOpportunity, size),
+		size:        size,
+		subscribers: make(map[<-chan ArbitrageOpportunity]*arbitrageSubscriber),
 	}
 }
 
-// Publish 推送新的套利机会，如果队列已满则丢弃最旧的数据
+// Publish 将套利机会推送给所有订阅者，订阅者缓冲区已满时按其丢弃策略处理
+// 发布时记录 DiscoveredAt（调用方已设置时保留原值）
 func (q *ArbitrageQueue) Publish(op ArbitrageOpportunity) {
+	if op.DiscoveredAt.IsZero() {
+		op.DiscoveredAt = time.Now()
+	}
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	select {
-	case q.ch <- op:
-	default:
+	for _, sub := range q.subscribers {
+		select {
+		case sub.ch <- op:
+			continue
+		default:
+		}
+
+		q.dropped.Add(1)
+		if sub.policy == DropNewest {
+			continue
+		}
+		// 发布在锁内串行进行，取出最旧的一个后必然有空位
 		select {
-		case <-q.ch:
+		case <-sub.ch:
 		default:
 		}
-		q.ch <- op
+		sub.ch <- op
 	}
 }
 
-// Subscribe 返回队列的只读 channel
+// Subscribe 使用默认缓冲区大小和「丢弃最旧」策略订阅套利机会
 func (q *ArbitrageQueue) Subscribe() <-chan ArbitrageOpportunity {
-	return q.ch
+	return q.SubscribeWith(SubscribeOptions{})
+}
+
+// SubscribeWith 按指定选项订阅套利机会，每次调用返回一个独立的 channel
+func (q *ArbitrageQueue) SubscribeWith(opts SubscribeOptions) <-chan ArbitrageOpportunity {
+	buffer := opts.Buffer
+	if buffer <= 0 {
+		buffer = q.size
+	}
+	sub := &arbitrageSubscriber{
+		ch:     make(chan ArbitrageOpportunity, buffer),
+		policy: opts.Policy,
+	}
+
+	q.mu.Lock()
+	q.subscribers[sub.ch] = sub
+	q.mu.Unlock()
+	return sub.ch
+}
+
+// Unsubscribe 取消订阅并关闭对应的 channel
+func (q *ArbitrageQueue) Unsubscribe(ch <-chan ArbitrageOpportunity) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if sub, ok := q.subscribers[ch]; ok {
+		delete(q.subscribers, ch)
+		close(sub.ch)
+	}
+}
+
+// Dropped 返回因订阅者缓冲区已满而丢弃的机会总数
+func (q *ArbitrageQueue) Dropped() uint64 {
+	return q.dropped.Load()
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BackoffState 退避状态快照，用于健康检查输出
+type BackoffState struct {
+	// Attempts 连续失败次数，成功后清零
+	Attempts int `json:"attempts"`
+	// CurrentDelay 最近一次计算出的等待时间
+	CurrentDelay time.Duration `json:"current_delay"`
+	// LastFailure 最近一次失败时间
+	LastFailure time.Time `json:"last_failure"`
+}
+
+// backoff 带抖动的指数退避，等待时间从 min 开始翻倍直到 max
+type backoff struct {
+	mu    sync.Mutex
+	min   time.Duration
+	max   time.Duration
+	state BackoffState
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	if min <= 0 {
+		min = time.Second
+	}
+	if max < min {
+		max = min
+	}
+	return &backoff{min: min, max: max}
+}
+
+// Next 记录一次失败并返回本次应等待的时间
+// 使用「等比抖动」：在 [d/2, d] 之间随机取值，避免所有客户端同时重连
+func (b *backoff) Next() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delay := b.min
+	for i := 0; i < b.state.Attempts && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+
+	half := delay / 2
+	delay = half + time.Duration(rand.Int63n(int64(half)+1))
+
+	b.state.Attempts++
+	b.state.CurrentDelay = delay
+	b.state.LastFailure = time.Now()
+	return delay
+}
+
+// Reset 连接稳定后清零退避状态
+func (b *backoff) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state.Attempts = 0
+	b.state.CurrentDelay = 0
+}
+
+// State 返回当前退避状态
+func (b *backoff) State() BackoffState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,31 @@
+package main
+
+import "math"
+
+// balancerMaxInRatio Balancer 加权池单笔输入不能超过输入代币余额的 30%，否则合约回滚
+const balancerMaxInRatio = 0.3
+
+// calcOutGivenIn Balancer 加权池的精确输入报价
+// amountOut = balanceOut * (1 - (balanceIn / (balanceIn + amountIn * (1 - fee))) ^ (weightIn / weightOut))
+// feePips 单位 1e-6（3000 表示 0.3%），权重为归一化权重，超过单笔输入上限或参数非法时返回 0
+func calcOutGivenIn(balanceIn, weightIn, balanceOut, weightOut, amountIn float64, feePips int) float64 {
+	if balanceIn <= 0 || balanceOut <= 0 || weightIn <= 0 || weightOut <= 0 || amountIn <= 0 {
+		return 0
+	}
+	if amountIn > balanceIn*balancerMaxInRatio {
+		return 0
+	}
+
+	amountInAfterFee := amountIn * feeRate(feePips)
+	base := balanceIn / (balanceIn + amountInAfterFee)
+	return balanceOut * (1 - math.Pow(base, weightIn/weightOut))
+}
+
+// weightedSpotPrice 加权池中以 quote 计价的 base 现货价格（不含手续费）
+// price = (balanceQuote / weightQuote) / (balanceBase / weightBase)
+func weightedSpotPrice(balanceBase, weightBase, balanceQuote, weightQuote float64) float64 {
+	if balanceBase <= 0 || weightBase <= 0 || weightQuote <= 0 {
+		return 0
+	}
+	return (balanceQuote / weightQuote) / (balanceBase / weightBase)
+}
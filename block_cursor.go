@@ -0,0 +1,162 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// blockCursor 计算可以持久化的已处理区块游标：游标及之前的区块都已完整处理
+// 区块并发处理、完成顺序不固定，处理不完整（降级跳过回执、获取失败放弃、处理被取消）的区块不会标记完成，
+// 游标停在它之前，重启后的补扫会从这里重新处理；未完成的区块落后最高完成区块达到 window 个时不再等待，
+// 补扫本来也只覆盖最近 MAX_BACKFILL_BLOCKS 个区块；获取失败被放弃（Drop）的区块例外，游标始终停在它之前，
+// 持久化的游标让重启后的补扫重新处理它。window 为 0（不补扫）时游标即最高完成区块
+type blockCursor struct {
+	mu sync.Mutex
+	// next 最低的未完成区块，0 表示尚未初始化
+	next uint64
+	// completed 高于 next 的已完成区块
+	completed map[uint64]struct{}
+	// dropped 获取失败被放弃的区块，超出 window 也不会被游标越过，完成后移除
+	dropped map[uint64]struct{}
+	highest uint64
+	window  uint64
+}
+
+func newBlockCursor(window uint64) *blockCursor {
+	return &blockCursor{completed: make(map[uint64]struct{}), dropped: make(map[uint64]struct{}), window: window}
+}
+
+// Drop 记录获取失败被放弃的区块，游标不再越过它；低于游标的区块以及不补扫（window 为 0）时忽略
+func (c *blockCursor) Drop(number uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.window == 0 || (c.next != 0 && number < c.next) {
+		return
+	}
+	c.dropped[number] = struct{}{}
+}
+
+// lowestDropped 返回最低的放弃区块，调用方需持有 mu
+func (c *blockCursor) lowestDropped() (uint64, bool) {
+	var lowest uint64
+	found := false
+	for number := range c.dropped {
+		if !found || number < lowest {
+			lowest, found = number, true
+		}
+	}
+	return lowest, found
+}
+
+// Init 以已持久化的游标初始化，只在尚未初始化时生效；没有持久化游标时从第一个完成的区块开始
+func (c *blockCursor) Init(last uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next == 0 {
+		c.next = last + 1
+		c.highest = last
+	}
+}
+
+// Complete 标记区块已完整处理，返回当前游标以及游标是否前进；低于游标的区块（例如回放更早的区间）不影响游标
+func (c *blockCursor) Complete(number uint64) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.next == 0 {
+		c.next = number
+	}
+	if number < c.next {
+		return c.next - 1, false
+	}
+	before := c.next
+	c.completed[number] = struct{}{}
+	delete(c.dropped, number)
+	if number > c.highest {
+		c.highest = number
+	}
+
+	if c.window == 0 {
+		clear(c.completed)
+		c.next = c.highest + 1
+	} else if c.highest-c.next >= c.window {
+		skipTo := c.highest - c.window + 1
+		for number := range c.completed {
+			if number < skipTo {
+				delete(c.completed, number)
+			}
+		}
+		// 放弃的区块没有被处理过，游标只能越过到它为止
+		if dropped, ok := c.lowestDropped(); ok && dropped < skipTo {
+			skipTo = dropped
+		}
+		if skipTo > c.next {
+			log.Printf("区块 %d ~ %d 中有未完整处理的区块，已超出补扫窗口 %d，游标不再等待", c.next, skipTo-1, c.window)
+			c.next = skipTo
+		}
+	}
+	for {
+		if _, ok := c.completed[c.next]; !ok {
+			break
+		}
+		delete(c.completed, c.next)
+		c.next++
+	}
+	return c.next - 1, c.next != before
+}
+
+// CompleteRange 标记 [from, to] 内的区块已完整处理，用于日志订阅模式：两个有日志的区块之间没有匹配日志的区块同样已处理
+// from 之前没有未完成的区块时等同于 CompleteThrough(to)；否则逐个标记区间内的区块（超出 window 的部分不再标记），
+// 游标仍停在之前未完成的区块处
+func (c *blockCursor) CompleteRange(from, to uint64) (uint64, bool) {
+	c.mu.Lock()
+	if to < from {
+		defer c.mu.Unlock()
+		if c.next == 0 {
+			return 0, false
+		}
+		return c.next - 1, false
+	}
+	if c.next == 0 || from <= c.next {
+		c.mu.Unlock()
+		return c.CompleteThrough(to)
+	}
+	if c.window > 0 && to-from >= c.window {
+		from = to - c.window + 1
+	}
+	for number := from; number < to; number++ {
+		c.completed[number] = struct{}{}
+	}
+	c.mu.Unlock()
+	return c.Complete(to)
+}
+
+// CompleteThrough 标记 number 及之前的全部区块已完整处理
+// 日志订阅模式按区块顺序处理，没有匹配日志的区块不会出现，收到更高区块的日志即说明之前的区块都已处理；
+// 其中有放弃的区块（补扫时获取失败）时游标停在它之前，它之后的区块逐个标记
+func (c *blockCursor) CompleteThrough(number uint64) (uint64, bool) {
+	c.mu.Lock()
+	before := c.next
+	if c.next != 0 && number >= c.next {
+		through := number
+		if dropped, ok := c.lowestDropped(); ok && dropped >= c.next && dropped < number {
+			through = dropped
+			from := dropped + 1
+			if c.window > 0 && number-from >= c.window {
+				from = number - c.window + 1
+			}
+			for n := from; n < number; n++ {
+				c.completed[n] = struct{}{}
+			}
+		}
+		for n := range c.completed {
+			if n < through {
+				delete(c.completed, n)
+			}
+		}
+		c.next = through
+	}
+	c.mu.Unlock()
+	cursor, advanced := c.Complete(number)
+	return cursor, advanced || (before != 0 && cursor != before-1)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestBlockCursor(t *testing.T) {
+	type step struct {
+		number  uint64
+		through bool
+		// drop 为 true 时以 Drop 登记放弃的区块
+		drop bool
+		// rangeFrom 非 0 时以 CompleteRange(rangeFrom, number) 标记
+		rangeFrom    uint64
+		wantCursor   uint64
+		wantAdvanced bool
+	}
+	tests := []struct {
+		name   string
+		window uint64
+		last   uint64
+		steps  []step
+	}{
+		{name: "in order", window: 100, last: 99, steps: []step{
+			{number: 100, wantCursor: 100, wantAdvanced: true},
+			{number: 101, wantCursor: 101, wantAdvanced: true},
+		}},
+		{name: "out of order waits for the gap", window: 100, last: 99, steps: []step{
+			{number: 102, wantCursor: 99},
+			{number: 101, wantCursor: 99},
+			{number: 100, wantCursor: 102, wantAdvanced: true},
+		}},
+		{name: "incomplete block holds the cursor", window: 100, last: 99, steps: []step{
+			{number: 101, wantCursor: 99},
+			{number: 102, wantCursor: 99},
+			{number: 103, wantCursor: 99},
+		}},
+		{name: "gap beyond window is skipped", window: 3, last: 99, steps: []step{
+			{number: 101, wantCursor: 99},
+			{number: 102, wantCursor: 99},
+			{number: 103, wantCursor: 103, wantAdvanced: true},
+		}},
+		{name: "older blocks do not move the cursor", window: 100, last: 99, steps: []step{
+			{number: 50, wantCursor: 99},
+			{number: 100, wantCursor: 100, wantAdvanced: true},
+		}},
+		{name: "no window tracks the highest block", window: 0, last: 99, steps: []step{
+			{number: 105, wantCursor: 105, wantAdvanced: true},
+			{number: 101, wantCursor: 105},
+		}},
+		{name: "uninitialized starts at first block", window: 100, steps: []step{
+			{number: 500, wantCursor: 500, wantAdvanced: true},
+			{number: 502, wantCursor: 500},
+		}},
+		{name: "complete through fills gaps", window: 100, last: 99, steps: []step{
+			{number: 103, wantCursor: 99},
+			{number: 105, through: true, wantCursor: 105, wantAdvanced: true},
+		}},
+		{name: "range behind the cursor fills through", window: 100, last: 99, steps: []step{
+			{number: 102, rangeFrom: 100, wantCursor: 102, wantAdvanced: true},
+		}},
+		{name: "range after a hole waits for it", window: 100, last: 99, steps: []step{
+			{number: 102, rangeFrom: 100, wantCursor: 102, wantAdvanced: true},
+			{number: 107, rangeFrom: 105, wantCursor: 102},
+			{number: 103, wantCursor: 103, wantAdvanced: true},
+			{number: 104, wantCursor: 107, wantAdvanced: true},
+		}},
+		{name: "empty range keeps the cursor", window: 100, last: 99, steps: []step{
+			{number: 99, rangeFrom: 100, wantCursor: 99},
+		}},
+		{name: "dropped block is not skipped beyond the window", window: 3, last: 99, steps: []step{
+			{number: 100, drop: true, wantCursor: 99},
+			{number: 101, wantCursor: 99},
+			{number: 102, wantCursor: 99},
+			{number: 103, wantCursor: 99},
+			{number: 104, wantCursor: 99},
+			// 补扫完成放弃的区块后，游标按窗口越过其余未完成的区块
+			{number: 100, wantCursor: 104, wantAdvanced: true},
+			{number: 105, wantCursor: 105, wantAdvanced: true},
+		}},
+		{name: "dropped block skips up to itself", window: 3, last: 99, steps: []step{
+			{number: 102, drop: true, wantCursor: 99},
+			{number: 103, wantCursor: 100, wantAdvanced: true},
+			{number: 104, wantCursor: 101, wantAdvanced: true},
+			{number: 105, wantCursor: 101},
+			{number: 106, wantCursor: 101},
+		}},
+		{name: "complete through stops before a dropped block", window: 100, last: 99, steps: []step{
+			{number: 101, drop: true, wantCursor: 99},
+			{number: 105, through: true, wantCursor: 100, wantAdvanced: true},
+			{number: 101, wantCursor: 105, wantAdvanced: true},
+		}},
+		{name: "drop below the cursor is ignored", window: 100, last: 99, steps: []step{
+			{number: 50, drop: true, wantCursor: 99},
+			{number: 100, wantCursor: 100, wantAdvanced: true},
+		}},
+		{name: "no window ignores drops", window: 0, last: 99, steps: []step{
+			{number: 100, drop: true, wantCursor: 99},
+			{number: 101, wantCursor: 101, wantAdvanced: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := newBlockCursor(tt.window)
+			if tt.last > 0 {
+				cursor.Init(tt.last)
+			}
+			for _, s := range tt.steps {
+				complete := cursor.Complete
+				if s.through {
+					complete = cursor.CompleteThrough
+				}
+				if s.rangeFrom > 0 {
+					complete = func(number uint64) (uint64, bool) { return cursor.CompleteRange(s.rangeFrom, number) }
+				}
+				if s.drop {
+					cursor.Drop(s.number)
+					// 空区间不标记任何区块，只返回当前游标
+					complete = func(uint64) (uint64, bool) { return cursor.CompleteRange(1, 0) }
+				}
+				got, advanced := complete(s.number)
+				if got != s.wantCursor || advanced != s.wantAdvanced {
+					t.Fatalf("完成区块 %d 后游标 %d (前进 %v)，期望 %d (前进 %v)", s.number, got, advanced, s.wantCursor, s.wantAdvanced)
+				}
+			}
+		})
+	}
+}
+
+// TestHandleBlockRequeued 重新入队的区块不计入处理延迟；重新入队次数用尽而放弃的区块挡住游标，超出补扫窗口也不会被越过
+func TestHandleBlockRequeued(t *testing.T) {
+	tests := []struct {
+		name        string
+		requeued    int
+		unavailable bool
+		wantSamples uint64
+		wantCursor  uint64
+		wantDropped uint64
+	}{
+		{name: "fresh block records lag", wantSamples: 5, wantCursor: 104},
+		{name: "requeued block skips lag", requeued: 1, wantSamples: 4, wantCursor: 104},
+		{name: "dropped block holds the cursor", requeued: 1, unavailable: true, wantSamples: 4, wantCursor: 100, wantDropped: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := &mockChain{head: 110, blockTime: time.Now().Add(-time.Second), failures: map[uint64]int{}}
+			if tt.unavailable {
+				chain.failures[101] = 1000
+			}
+			pd, _, store := newTestDiscoverer(t, chain, &AppConfig{MaxBackfillBlocks: 2, BlockRequeueAttempts: 1})
+			if err := store.SetLastProcessedBlock(99); err != nil {
+				t.Fatal(err)
+			}
+			pd.loadCursor(context.Background())
+
+			pd.handleBlock(context.Background(), BlockEvent{Number: big.NewInt(100)})
+			pd.handleBlock(context.Background(), BlockEvent{Number: big.NewInt(101), Requeued: tt.requeued})
+			for number := int64(102); number <= 104; number++ {
+				pd.handleBlock(context.Background(), BlockEvent{Number: big.NewInt(number)})
+			}
+
+			if got := pd.BlockLag().Samples; got != tt.wantSamples {
+				t.Fatalf("延迟样本 %d 个，期望 %d 个", got, tt.wantSamples)
+			}
+			if got := pd.BlocksDropped(); got != tt.wantDropped {
+				t.Fatalf("放弃区块 %d 个，期望 %d 个", got, tt.wantDropped)
+			}
+			last, _, err := store.LastProcessedBlock(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last != tt.wantCursor {
+				t.Fatalf("游标 %d，期望 %d", last, tt.wantCursor)
+			}
+		})
+	}
+}
+
+// TestHandleBlockDegradedHoldsCursor 降级模式下跳过回执的区块不算完成，之后完成的区块不会把游标推过它，补扫后游标继续前进
+func TestHandleBlockDegradedHoldsCursor(t *testing.T) {
+	chain := &mockChain{head: 110, blockTime: time.Now()}
+	pd, _, store := newTestDiscoverer(t, chain, &AppConfig{MaxBackfillBlocks: 100})
+	if err := store.SetLastProcessedBlock(99); err != nil {
+		t.Fatal(err)
+	}
+	pd.loadCursor(context.Background())
+
+	cursorOf := func() uint64 {
+		t.Helper()
+		last, _, err := store.LastProcessedBlock(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return last
+	}
+
+	pd.handleBlock(context.Background(), BlockEvent{Number: big.NewInt(100)})
+	pd.lag.SetDegraded(true)
+	pd.handleBlock(context.Background(), BlockEvent{Number: big.NewInt(101)})
+	pd.lag.SetDegraded(false)
+	pd.handleBlock(context.Background(), BlockEvent{Number: big.NewInt(102)})
+	if got := cursorOf(); got != 100 {
+		t.Fatalf("游标 %d，期望停在降级区块 101 之前", got)
+	}
+
+	// 补扫按高度重新处理 101，不受降级模式影响
+	pd.lag.SetDegraded(true)
+	pd.handleBlock(context.Background(), BlockEvent{Number: big.NewInt(101), Replayed: true})
+	if got := cursorOf(); got != 102 {
+		t.Fatalf("补扫后游标 %d，期望 102", got)
+	}
+}
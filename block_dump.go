@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// blockDumpTopN 区块日志统计中最多输出的未匹配 topic0 数量（按出现次数降序）
+const blockDumpTopN = 20
+
+// matchedPoolCreation 建池事件在区块日志统计中的分类名
+const matchedPoolCreation = "PoolCreated"
+
+// matchedSync 储备量同步事件在区块日志统计中的分类名
+const matchedSync = "Sync"
+
+// blockLogStats 单个区块的日志统计，用于排查漏发现的池子
+// 交易回执并发处理，所有方法均可并发调用
+type blockLogStats struct {
+	mu        sync.Mutex
+	txs       int
+	logs      int
+	matched   map[string]int
+	unmatched map[common.Hash]int
+}
+
+func newBlockLogStats(txs int) *blockLogStats {
+	return &blockLogStats{
+		txs:       txs,
+		matched:   make(map[string]int),
+		unmatched: make(map[common.Hash]int),
+	}
+}
+
+// addLogs 累加一笔交易回执中的日志总数（包含没有 topic 的匿名日志）
+// 记录类方法允许 nil 接收者，直接订阅日志时没有区块级统计
+func (s *blockLogStats) addLogs(n int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs += n
+}
+
+// recordMatched 记录一条匹配到协议（或建池事件）的日志
+func (s *blockLogStats) recordMatched(protocol string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.matched[protocol]++
+}
+
+// recordUnmatched 记录一条未匹配任何协议的日志
+func (s *blockLogStats) recordUnmatched(topic0 common.Hash) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unmatched[topic0]++
+}
+
+// Summary 输出 key=value 形式的统计：txs、logs、按协议计数的 matched 与按次数降序的 unmatched topic0
+func (s *blockLogStats) Summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	protocols := make([]string, 0, len(s.matched))
+	for name := range s.matched {
+		protocols = append(protocols, name)
+	}
+	sort.Strings(protocols)
+	matched := make([]string, len(protocols))
+	for i, name := range protocols {
+		matched[i] = fmt.Sprintf("%s:%d", name, s.matched[name])
+	}
+
+	return fmt.Sprintf("txs=%d logs=%d matched={%s} unmatched_total=%d unmatched={%s}",
+		s.txs, s.logs, strings.Join(matched, ","), s.unmatchedTotal(), strings.Join(s.topUnmatched(blockDumpTopN), ","))
+}
+
+// Unmatched 返回未匹配日志总数与出现次数最多的前 n 个 topic0
+func (s *blockLogStats) Unmatched(n int) (int, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unmatchedTotal(), s.topUnmatched(n)
+}
+
+func (s *blockLogStats) unmatchedTotal() int {
+	total := 0
+	for _, count := range s.unmatched {
+		total += count
+	}
+	return total
+}
+
+// topUnmatched 按出现次数降序返回前 n 个未匹配 topic0，次数相同时按 topic 排序保证输出稳定
+func (s *blockLogStats) topUnmatched(n int) []string {
+	topics := make([]common.Hash, 0, len(s.unmatched))
+	for topic := range s.unmatched {
+		topics = append(topics, topic)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		ci, cj := s.unmatched[topics[i]], s.unmatched[topics[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		return topics[i].Hex() < topics[j].Hex()
+	})
+	if len(topics) > n {
+		topics = topics[:n]
+	}
+	items := make([]string, len(topics))
+	for i, topic := range topics {
+		items[i] = fmt.Sprintf("%s:%d", topic.Hex(), s.unmatched[topic])
+	}
+	return items
+}
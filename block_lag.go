@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// blockLagAlpha 指数移动平均的平滑系数，越大越偏向最近的样本
+const blockLagAlpha = 0.2
+
+// BlockLagStats 区块处理延迟统计快照
+type BlockLagStats struct {
+	// LastBlock 最近一次处理完成的区块高度
+	LastBlock uint64 `json:"last_block"`
+	// LastLag 最近一次处理完成时，墙钟时间与区块时间戳之差
+	LastLag time.Duration `json:"last_lag"`
+	// AverageLag 延迟的指数移动平均
+	AverageLag time.Duration `json:"average_lag"`
+	// Samples 已记录的样本数量
+	Samples uint64 `json:"samples"`
+	// Degraded 是否处于跳过回执获取的降级模式
+	Degraded bool `json:"degraded"`
+}
+
+// blockLagTracker 记录每个区块的处理延迟并维护移动平均
+type blockLagTracker struct {
+	mu       sync.RWMutex
+	stats    BlockLagStats
+	avgNanos float64
+}
+
+// Record 记录一个区块的处理延迟，blockTime 为区块时间戳，doneAt 为处理完成时间
+func (t *blockLagTracker) Record(blockNumber uint64, blockTime, doneAt time.Time) time.Duration {
+	lag := doneAt.Sub(blockTime)
+	if lag < 0 {
+		// 节点时钟与本地时钟存在偏差时可能为负，按 0 处理
+		lag = 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stats.Samples == 0 {
+		t.avgNanos = float64(lag)
+	} else {
+		t.avgNanos = blockLagAlpha*float64(lag) + (1-blockLagAlpha)*t.avgNanos
+	}
+	t.stats.Samples++
+	t.stats.LastBlock = blockNumber
+	t.stats.LastLag = lag
+	t.stats.AverageLag = time.Duration(t.avgNanos)
+	return t.stats.AverageLag
+}
+
+// SetDegraded 设置降级模式状态，返回状态是否发生变化
+func (t *blockLagTracker) SetDegraded(degraded bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	changed := t.stats.Degraded != degraded
+	t.stats.Degraded = degraded
+	return changed
+}
+
+// Snapshot 返回当前统计信息的副本
+func (t *blockLagTracker) Snapshot() BlockLagStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.stats
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -11,6 +13,14 @@ import (
 type BlockEvent struct {
 	Number *big.Int
 	Hash   common.Hash
+	// Requeued 因获取区块失败而重新入队的次数
+	Requeued int
+	// Replayed 事件由历史回放或启动补扫产生：历史区块的时间戳远早于当前时间，不计入处理延迟，
+	// 也不受降级模式影响，始终获取回执完整处理
+	Replayed bool
+	// ConfirmedAt CONFIRMATION_DEPTH 大于 0 时，使该区块达到确认深度的链头区块时间戳；
+	// 处理延迟从这里开始计算，等待确认的时间是预期的，不计入延迟。未经确认缓冲的事件为零值
+	ConfirmedAt time.Time
 }
 
 // BlockQueue 内存队列，用于缓存待处理的区块
@@ -42,6 +52,16 @@ func (q *BlockQueue) Publish(event BlockEvent) {
 	}
 }
 
+// PublishWait 将区块事件放入队列，队列已满时阻塞等待而不是丢弃，用于历史回放等不允许丢块的场景
+func (q *BlockQueue) PublishWait(ctx context.Context, event BlockEvent) error {
+	select {
+	case q.ch <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Subscribe 返回一个只读 channel，用于消费区块事件
 func (q *BlockQueue) Subscribe() <-chan BlockEvent {
 	return q.ch
@@ -3,30 +3,51 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"math/big"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// reconnectStableDuration 订阅持续超过该时长才视为稳定，此后断开会重置退避
+const reconnectStableDuration = time.Minute
+
+// keepaliveStallBlocks 链头比最近收到的区块头领先超过该数量时，认为订阅已停止推送
+const keepaliveStallBlocks = 3
+
 // BlockSubscriber 订阅新区块并推送到内存队列
+// CONFIRMATION_DEPTH 大于 0 时区块先进入确认缓冲，链头前进到足够深度后才推送
 type BlockSubscriber struct {
-	wsURL  string
-	client *ethclient.Client
-	queue  *BlockQueue
+	wsURL     string
+	client    *ethclient.Client
+	queue     *BlockQueue
+	backoff   *backoff
+	cfg       *AppConfig
+	confirmed *confirmationBuffer
 }
 
 // NewBlockSubscriber 创建区块订阅器
-func NewBlockSubscriber(wsURL string, client *ethclient.Client, queue *BlockQueue) *BlockSubscriber {
+func NewBlockSubscriber(wsURL string, client *ethclient.Client, queue *BlockQueue, cfg *AppConfig) *BlockSubscriber {
 	return &BlockSubscriber{
-		wsURL:  wsURL,
-		client: client,
-		queue:  queue,
+		wsURL:     wsURL,
+		client:    client,
+		queue:     queue,
+		backoff:   newBackoff(cfg.ReconnectBackoffMin, cfg.ReconnectBackoffMax),
+		cfg:       cfg,
+		confirmed: newConfirmationBuffer(cfg.ConfirmationDepth),
 	}
 }
 
+// BackoffState 返回重连退避状态，用于健康检查
+func (bs *BlockSubscriber) BackoffState() BackoffState {
+	return bs.backoff.State()
+}
+
 // Start 启动订阅流程
 func (bs *BlockSubscriber) Start(ctx context.Context) error {
 	headers := make(chan *types.Header, 16)
@@ -34,15 +55,15 @@ func (bs *BlockSubscriber) Start(ctx context.Context) error {
 	for {
 		sub, err := bs.client.SubscribeNewHead(ctx, headers)
 		if err != nil {
-			log.Printf("订阅区块失败: %v，5秒后重试", err)
-			select {
-			case <-time.After(5 * time.Second):
-				continue
-			case <-ctx.Done():
-				return ctx.Err()
+			delay := bs.backoff.Next()
+			log.Printf("订阅区块失败: %v，%v 后重试", err, delay.Truncate(time.Millisecond))
+			if err := sleepContext(ctx, delay); err != nil {
+				return err
 			}
+			continue
 		}
 
+		subscribedAt := time.Now()
 		if err := bs.loop(ctx, headers, sub); err != nil && !errors.Is(err, context.Canceled) {
 			log.Printf("监听循环错误: %v", err)
 		}
@@ -53,7 +74,26 @@ func (bs *BlockSubscriber) Start(ctx context.Context) error {
 		default:
 		}
 
-		log.Println("尝试重新订阅区块头")
+		if time.Since(subscribedAt) >= reconnectStableDuration {
+			bs.backoff.Reset()
+		}
+		delay := bs.backoff.Next()
+		log.Printf("订阅中断，%v 后尝试重新订阅区块头", delay.Truncate(time.Millisecond))
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext 等待指定时长，ctx 取消时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -62,24 +102,76 @@ type subscription interface {
 	Unsubscribe()
 }
 
+// wsReadLimitMessage gorilla/websocket 在消息超过读取上限时返回的错误信息
+const wsReadLimitMessage = "read limit exceeded"
+
+// subscriptionError 订阅断开的原因；消息超过 WS_MAX_MESSAGE_SIZE 时明确指出，而不是笼统的读取失败，
+// 否则每次重连后遇到同样大的消息都会再次断开，却看不出原因
+func subscriptionError(err error, cfg *AppConfig) error {
+	if err != nil && strings.Contains(err.Error(), wsReadLimitMessage) {
+		return fmt.Errorf("WebSocket 消息超过 WS_MAX_MESSAGE_SIZE 上限 %d 字节，请调大该配置: %w", cfg.WSMaxMessageSize, err)
+	}
+	return err
+}
+
+// dialWebsocket 连接 WebSocket 节点，单条消息大小上限为 WS_MAX_MESSAGE_SIZE
+func dialWebsocket(ctx context.Context, wsURL string, cfg *AppConfig) (*ethclient.Client, error) {
+	client, err := rpc.DialOptions(ctx, wsURL, rpc.WithWebsocketMessageSizeLimit(cfg.WSMaxMessageSize))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
+
+// loop 消费订阅推送的区块头，并按 KeepaliveInterval 主动探测连接
+// 半开的 TCP 连接在链上空闲时可能长时间不报错，只依赖 sub.Err() 会在此期间漏掉区块，
+// 因此定期查询链头高度：查询超时说明连接已死，链头明显领先说明订阅不再推送，两种情况都返回错误以触发重新订阅
 func (bs *BlockSubscriber) loop(ctx context.Context, headers chan *types.Header, sub subscription) error {
 	defer sub.Unsubscribe()
 
+	var keepalive <-chan time.Time
+	if bs.cfg.KeepaliveInterval > 0 {
+		ticker := time.NewTicker(bs.cfg.KeepaliveInterval)
+		defer ticker.Stop()
+		keepalive = ticker.C
+	}
+
+	var lastNumber uint64
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case err := <-sub.Err():
-			return err
+			return subscriptionError(err, bs.cfg)
 		case header := <-headers:
-			if header == nil {
+			if header == nil || header.Number == nil {
 				continue
 			}
+			lastNumber = header.Number.Uint64()
 			bs.handleHeader(header)
+		case <-keepalive:
+			if err := bs.probe(ctx, lastNumber); err != nil {
+				return err
+			}
 		}
 	}
 }
 
+// probe 在 KeepaliveTimeout 内查询链头高度，lastNumber 为最近收到的区块头高度（0 表示尚未收到）
+func (bs *BlockSubscriber) probe(ctx context.Context, lastNumber uint64) error {
+	probeCtx, cancel := context.WithTimeout(ctx, bs.cfg.KeepaliveTimeout)
+	defer cancel()
+
+	head, err := bs.client.BlockNumber(probeCtx)
+	if err != nil {
+		return fmt.Errorf("保活探测失败: %w", err)
+	}
+	if lastNumber > 0 && head > lastNumber+keepaliveStallBlocks {
+		return fmt.Errorf("订阅停止推送: 链头 %d, 最近收到的区块 %d", head, lastNumber)
+	}
+	return nil
+}
+
 func (bs *BlockSubscriber) handleHeader(header *types.Header) {
 	if header == nil {
 		return
@@ -94,7 +186,12 @@ func (bs *BlockSubscriber) handleHeader(header *types.Header) {
 		Number: new(big.Int).Set(number),
 		Hash:   header.Hash(),
 	}
-	bs.queue.Publish(event)
-
 	log.Printf("收到新区块: 高度 %s 哈希 %s", number.String(), event.Hash.Hex())
+
+	for _, ready := range bs.confirmed.Push(event, time.Unix(int64(header.Time), 0)) {
+		if bs.cfg.ConfirmationDepth > 0 {
+			log.Printf("区块 %s 已达到 %d 个确认，开始处理", ready.Number.String(), bs.cfg.ConfirmationDepth)
+		}
+		bs.queue.Publish(ready)
+	}
 }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// mockHeadsService 模拟节点的 eth 命名空间：eth_subscribe("newHeads") 按 reject 决定是否拒绝，
+// 接受时推送一个指定高度的区块头
+type mockHeadsService struct {
+	mu       sync.Mutex
+	calls    int
+	reject   func(call int) bool
+	number   int64
+	rejected int
+}
+
+func (s *mockHeadsService) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	s.mu.Lock()
+	s.calls++
+	call, number := s.calls, s.number
+	if s.reject != nil && s.reject(call) {
+		s.rejected++
+		s.mu.Unlock()
+		return nil, errors.New("re-subscription rejected")
+	}
+	s.mu.Unlock()
+
+	sub := notifier.CreateSubscription()
+	go func() {
+		header := &types.Header{Number: big.NewInt(number), Difficulty: big.NewInt(0)}
+		_ = notifier.Notify(sub.ID, header)
+	}()
+	return sub, nil
+}
+
+// swappableServer 把 WebSocket 请求转发给当前的 rpc.Server，替换时关闭旧服务端的全部连接，模拟节点断线
+type swappableServer struct {
+	mu     sync.Mutex
+	server *rpc.Server
+}
+
+func (ss *swappableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ss.mu.Lock()
+	server := ss.server
+	ss.mu.Unlock()
+	server.WebsocketHandler([]string{"*"}).ServeHTTP(w, r)
+}
+
+func (ss *swappableServer) swap(t *testing.T, service *mockHeadsService) {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	ss.mu.Lock()
+	old := ss.server
+	ss.server = server
+	ss.mu.Unlock()
+	if old != nil {
+		old.Stop()
+	}
+}
+
+// waitBlock 等待队列中出现指定高度的区块
+func waitBlock(t *testing.T, queue *BlockQueue, number int64) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-queue.Subscribe():
+			if event.Number.Int64() == number {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("等待区块 %d 超时", number)
+		}
+	}
+}
+
+// TestBlockSubscriberRetriesRejectedResubscribe 连接断开后第一次重新订阅被节点拒绝时，
+// 订阅器应按退避重试整个订阅流程，之后继续收到区块，而不是停在失败的订阅上
+func TestBlockSubscriberRetriesRejectedResubscribe(t *testing.T) {
+	proxy := &swappableServer{}
+	proxy.swap(t, &mockHeadsService{number: 1})
+	httpServer := httptest.NewServer(proxy)
+	defer httpServer.Close()
+
+	cfg := &AppConfig{ReconnectBackoffMin: 10 * time.Millisecond, ReconnectBackoffMax: 50 * time.Millisecond}
+	client, err := ethclient.Dial("ws" + strings.TrimPrefix(httpServer.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	queue, err := NewBlockQueue(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscriber := NewBlockSubscriber(httpServer.URL, client, queue, cfg)
+	done := make(chan error, 1)
+	go func() { done <- subscriber.Start(ctx) }()
+
+	waitBlock(t, queue, 1)
+
+	// 节点重启：旧连接断开，新节点拒绝第一次重新订阅，之后恢复正常
+	restarted := &mockHeadsService{number: 2, reject: func(call int) bool { return call == 1 }}
+	proxy.swap(t, restarted)
+	waitBlock(t, queue, 2)
+
+	restarted.mu.Lock()
+	calls, rejected := restarted.calls, restarted.rejected
+	restarted.mu.Unlock()
+	if rejected != 1 || calls < 2 {
+		t.Fatalf("重新订阅次数 %d、被拒绝次数 %d，期望被拒绝 1 次后重试成功", calls, rejected)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Start 返回 %v，期望 context.Canceled", err)
+	}
+}
+
+// mockLargeHeadService 模拟节点的 eth 命名空间：eth_subscribe("newHeads") 推送一个 Extra 为 extra 字节的区块头
+type mockLargeHeadService struct {
+	extra int
+}
+
+func (s *mockLargeHeadService) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	go func() {
+		_ = notifier.Notify(sub.ID, largeHeader(s.extra))
+	}()
+	return sub, nil
+}
+
+func largeHeader(extra int) *types.Header {
+	return &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(0), Extra: make([]byte, extra)}
+}
+
+// TestBlockSubscriberMessageSizeLimit 通过进程内 WebSocket 节点推送接近与超过 WS_MAX_MESSAGE_SIZE 的区块头：
+// 未超过上限的消息正常送达，超过上限时订阅断开的原因明确指出 WS_MAX_MESSAGE_SIZE，而不是笼统的读取失败
+func TestBlockSubscriberMessageSizeLimit(t *testing.T) {
+	const limit = 64 * 1024
+	base, err := json.Marshal(largeHeader(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Extra 按十六进制编码，每字节占两个字符；通知外层的 JSON-RPC 信封约 100 字节
+	underLimit := (limit - 256 - len(base)) / 2
+
+	tests := []struct {
+		name      string
+		extra     int
+		wantBlock bool
+	}{
+		{name: "just under the limit", extra: underLimit, wantBlock: true},
+		{name: "over the limit", extra: limit / 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := rpc.NewServer()
+			if err := server.RegisterName("eth", &mockLargeHeadService{extra: tt.extra}); err != nil {
+				t.Fatal(err)
+			}
+			defer server.Stop()
+			httpServer := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+			defer httpServer.Close()
+
+			cfg := &AppConfig{WSMaxMessageSize: limit}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			client, err := dialWebsocket(ctx, "ws"+strings.TrimPrefix(httpServer.URL, "http"), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			queue, err := NewBlockQueue(16)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks := queue.Subscribe()
+
+			headers := make(chan *types.Header, 16)
+			sub, err := client.SubscribeNewHead(ctx, headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan error, 1)
+			go func() { done <- NewBlockSubscriber(httpServer.URL, client, queue, cfg).loop(ctx, headers, sub) }()
+
+			if tt.wantBlock {
+				select {
+				case event := <-blocks:
+					if event.Number.Int64() != 1 {
+						t.Fatalf("收到区块 %s，期望 1", event.Number)
+					}
+				case err := <-done:
+					t.Fatalf("未超过上限的消息未送达，订阅断开: %v", err)
+				}
+				cancel()
+				if err := <-done; !errors.Is(err, context.Canceled) {
+					t.Fatalf("loop 返回 %v，期望 context.Canceled", err)
+				}
+				return
+			}
+			err = <-done
+			if err == nil || !strings.Contains(err.Error(), "超过 WS_MAX_MESSAGE_SIZE") {
+				t.Fatalf("loop 返回 %v，期望指出消息超过 WS_MAX_MESSAGE_SIZE", err)
+			}
+			select {
+			case event := <-blocks:
+				t.Fatalf("超过上限的区块 %s 不应送达", event.Number)
+			default:
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// breakerFailure 一次执行失败的记录
+type breakerFailure struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+}
+
+// CircuitBreakerState 熔断器状态快照，用于健康检查输出
+type CircuitBreakerState struct {
+	// Tripped 是否已熔断，熔断期间拒绝所有执行
+	Tripped bool `json:"tripped"`
+	// TrippedAt 最近一次熔断的时间
+	TrippedAt time.Time `json:"tripped_at"`
+	// ResumeAt 冷却结束、自动恢复执行的时间
+	ResumeAt time.Time `json:"resume_at"`
+	// TripReason 触发最近一次熔断的失败原因
+	TripReason string `json:"trip_reason,omitempty"`
+	// ConsecutiveFailures 时间窗口内的连续失败次数
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// RecentFailures 时间窗口内的连续失败记录
+	RecentFailures []breakerFailure `json:"recent_failures"`
+	// Trips 累计熔断次数
+	Trips uint64 `json:"trips"`
+	// Rejected 熔断期间被拒绝的执行次数
+	Rejected uint64 `json:"rejected"`
+}
+
+// CircuitBreaker 执行熔断器：EXECUTOR_BREAKER_WINDOW 内连续 EXECUTOR_BREAKER_FAILURES 次执行失败或链上回滚后熔断，
+// 拒绝后续执行，直到冷却 EXECUTOR_BREAKER_COOLDOWN 结束或通过 POST /executor/reset 手动恢复
+// 用于在报价错误、路由配置错误等系统性问题下及时止损
+type CircuitBreaker struct {
+	cfg *AppConfig
+
+	mu       sync.Mutex
+	failures []breakerFailure
+	state    CircuitBreakerState
+}
+
+// NewCircuitBreaker 创建执行熔断器
+func NewCircuitBreaker(cfg *AppConfig) *CircuitBreaker {
+	return &CircuitBreaker{cfg: cfg}
+}
+
+// Allow 判断是否允许执行，冷却结束时自动恢复
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !cb.state.Tripped {
+		return true
+	}
+	if !time.Now().Before(cb.state.ResumeAt) {
+		log.Printf("执行熔断冷却结束，恢复套利执行")
+		cb.resetLocked()
+		return true
+	}
+	cb.state.Rejected++
+	log.Printf("!!! 执行熔断中，拒绝套利执行（已拒绝 %d 次）: 熔断原因 %q, %s 后自动恢复，可调用 POST /executor/reset 手动恢复",
+		cb.state.Rejected, cb.state.TripReason, time.Until(cb.state.ResumeAt).Round(time.Second))
+	return false
+}
+
+// RecordSuccess 记录一次成功执行，清空连续失败记录
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.failures = nil
+}
+
+// RecordFailure 记录一次失败执行，窗口内连续失败达到阈值时熔断
+func (cb *CircuitBreaker) RecordFailure(reason string) {
+	if cb.cfg.ExecutorBreakerFailures <= 0 {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	// 超出时间窗口的失败不再计入连续失败
+	kept := cb.failures[:0]
+	for _, failure := range cb.failures {
+		if now.Sub(failure.Time) <= cb.cfg.ExecutorBreakerWindow {
+			kept = append(kept, failure)
+		}
+	}
+	cb.failures = append(kept, breakerFailure{Time: now, Reason: reason})
+
+	if cb.state.Tripped || len(cb.failures) < cb.cfg.ExecutorBreakerFailures {
+		return
+	}
+	cb.state.Tripped = true
+	cb.state.TrippedAt = now
+	cb.state.ResumeAt = now.Add(cb.cfg.ExecutorBreakerCooldown)
+	cb.state.TripReason = reason
+	cb.state.Trips++
+	log.Printf("!!! %s 内连续 %d 次套利执行失败，执行熔断，%s 内拒绝所有执行。最近失败原因:",
+		cb.cfg.ExecutorBreakerWindow, len(cb.failures), cb.cfg.ExecutorBreakerCooldown)
+	for _, failure := range cb.failures {
+		log.Printf("!!!   %s %s", failure.Time.Format(time.RFC3339), failure.Reason)
+	}
+}
+
+// RecordTxResult 记录已广播交易的最终结果，可直接作为 ContractExecutor.OnResult 的回调
+func (cb *CircuitBreaker) RecordTxResult(hash common.Hash, err error) {
+	if err != nil {
+		cb.RecordFailure(err.Error())
+		return
+	}
+	cb.RecordSuccess()
+}
+
+// Reset 手动解除熔断并清空失败记录
+func (cb *CircuitBreaker) Reset() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state.Tripped {
+		log.Printf("执行熔断已被手动解除")
+	}
+	cb.resetLocked()
+}
+
+func (cb *CircuitBreaker) resetLocked() {
+	cb.state.Tripped = false
+	cb.state.ResumeAt = time.Time{}
+	cb.failures = nil
+}
+
+// State 返回熔断器状态快照
+func (cb *CircuitBreaker) State() CircuitBreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	state := cb.state
+	state.ConsecutiveFailures = len(cb.failures)
+	state.RecentFailures = append([]breakerFailure(nil), cb.failures...)
+	return state
+}
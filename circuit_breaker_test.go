@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestCircuitBreaker 窗口内连续失败达到阈值后熔断并拒绝执行，成功清零连续失败，冷却结束或 POST /executor/reset 后恢复；
+// 失败原因按顺序记录在状态中
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		window   time.Duration
+		cooldown time.Duration
+		// events 依次执行：fail:<原因>、tx:<原因>（链上回滚）、success、sleep:<时长>、reset（调用 /executor/reset）
+		events      []string
+		wantTripped bool
+		// wantTrips 累计熔断次数，冷却结束或手动恢复后仍然保留
+		wantTrips  uint64
+		wantReason string
+		wantRecent []string
+	}{
+		{name: "below threshold", failures: 3, events: []string{"fail:a", "fail:b"}, wantRecent: []string{"a", "b"}},
+		{name: "trips at threshold", failures: 3, events: []string{"fail:a", "fail:b", "fail:c"}, wantTripped: true, wantTrips: 1, wantReason: "c", wantRecent: []string{"a", "b", "c"}},
+		{name: "tx reverts count as failures", failures: 2, events: []string{"tx:reverted 1", "tx:reverted 2"}, wantTripped: true, wantTrips: 1, wantReason: "reverted 2", wantRecent: []string{"reverted 1", "reverted 2"}},
+		{name: "success resets the count", failures: 3, events: []string{"fail:a", "fail:b", "success", "fail:c", "fail:d"}, wantRecent: []string{"c", "d"}},
+		{name: "failures outside the window expire", failures: 3, window: 20 * time.Millisecond, events: []string{"fail:a", "fail:b", "sleep:40ms", "fail:c"}, wantRecent: []string{"c"}},
+		{name: "reopens after cooldown", failures: 2, cooldown: 20 * time.Millisecond, events: []string{"fail:a", "fail:b", "sleep:40ms"}, wantTrips: 1},
+		{name: "reopens after reset", failures: 2, events: []string{"fail:a", "fail:b", "reset"}, wantTrips: 1},
+		{name: "disabled", failures: 0, events: []string{"fail:a", "fail:b", "fail:c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &AppConfig{ExecutorBreakerFailures: tt.failures, ExecutorBreakerWindow: time.Hour, ExecutorBreakerCooldown: time.Hour}
+			if tt.window > 0 {
+				cfg.ExecutorBreakerWindow = tt.window
+			}
+			if tt.cooldown > 0 {
+				cfg.ExecutorBreakerCooldown = tt.cooldown
+			}
+			router, deps := newTestRouter(t, cfg)
+			cb := deps.breaker
+
+			for _, event := range tt.events {
+				kind, arg, _ := strings.Cut(event, ":")
+				switch kind {
+				case "fail":
+					cb.RecordFailure(arg)
+				case "tx":
+					cb.RecordTxResult(common.Hash{}, errors.New(arg))
+				case "success":
+					cb.RecordTxResult(common.Hash{}, nil)
+				case "sleep":
+					d, err := time.ParseDuration(arg)
+					if err != nil {
+						t.Fatal(err)
+					}
+					time.Sleep(d)
+				case "reset":
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/executor/reset", nil))
+					if w.Code != http.StatusOK {
+						t.Fatalf("/executor/reset 返回 %d", w.Code)
+					}
+				}
+			}
+
+			// 熔断期间每次执行都被拒绝并计数
+			for i := 1; i <= 2; i++ {
+				if allowed := cb.Allow(); allowed == tt.wantTripped {
+					t.Fatalf("第 %d 次执行允许 %v，期望 %v", i, allowed, !tt.wantTripped)
+				}
+			}
+			state := cb.State()
+			if state.Tripped != tt.wantTripped || state.Trips != tt.wantTrips || (tt.wantTripped && state.TripReason != tt.wantReason) {
+				t.Fatalf("熔断状态 %+v，期望熔断 %v、累计 %d 次、原因 %q", state, tt.wantTripped, tt.wantTrips, tt.wantReason)
+			}
+			if wantRejected := map[bool]uint64{true: 2}[tt.wantTripped]; state.Rejected != wantRejected {
+				t.Fatalf("拒绝 %d 次，期望 %d 次", state.Rejected, wantRejected)
+			}
+			var recent []string
+			for _, failure := range state.RecentFailures {
+				recent = append(recent, failure.Reason)
+			}
+			if !reflect.DeepEqual(recent, tt.wantRecent) || state.ConsecutiveFailures != len(tt.wantRecent) {
+				t.Fatalf("连续失败 %d 次、记录 %v，期望 %v", state.ConsecutiveFailures, recent, tt.wantRecent)
+			}
+		})
+	}
+}
@@ -1,78 +1,598 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net/url"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 const (
 	// defaultBlockQueueSize 区块队列默认容量，防止 backlog 无限增长
 	defaultBlockQueueSize = 1000
+	// defaultLogQueueSize 日志订阅模式下日志队列默认容量
+	defaultLogQueueSize = 10000
 	// defaultSQLitePath 默认的 SQLite 库文件名称
 	defaultSQLitePath = "pools.db"
+	// defaultSQLiteBusyTimeout SQLite 遇到锁冲突时的默认等待时间
+	defaultSQLiteBusyTimeout = 5 * time.Second
+	// defaultSQLiteMaxConns SQLite 默认连接数，单连接时所有访问串行执行
+	defaultSQLiteMaxConns = 1
 	// defaultArbReloadSeconds 套利发现者默认的刷新周期（秒）
 	defaultArbReloadSeconds = 60
+	// defaultArbEnumerateTimeout 单次套利环枚举的时间预算
+	defaultArbEnumerateTimeout = 20 * time.Second
+	// defaultArbPathCooldown 同一套利路径推送后的默认静默时长
+	defaultArbPathCooldown = time.Minute
 	// defaultArbMaxHops 默认的套利路径最大跳数
 	defaultArbMaxHops = 3
 	// defaultArbInitialCapital 默认的套利模拟起始资金（单位：USD）
 	defaultArbInitialCapital = 1.0
 	// defaultArbMinProfit 默认的套利最小收益门槛（单位：USD）
 	defaultArbMinProfit = 0.0
+	// defaultArbMinLiquidityUSD 参与套利的池子最低流动性（单位：USD）
+	defaultArbMinLiquidityUSD = 1000.0
+	// defaultArbMaxHopDeviation 单跳成交价偏离池子现货价的最大倍数
+	defaultArbMaxHopDeviation = 10.0
+	// defaultArbMaxCycleMultiplier 套利环最终数量与初始数量之比的上限，超过视为数据异常
+	defaultArbMaxCycleMultiplier = 2.0
 	// defaultArbQueueSize 套利机会队列默认容量
 	defaultArbQueueSize = 256
+	// defaultArbMaxAge 套利机会从发布到开始精算的最长等待时间（约一个 BSC 区块）
+	defaultArbMaxAge = 3 * time.Second
+	// defaultPaperRecheckDelay 模拟交易确认后等待多久再按最新储备量复核（约一个 BSC 区块）
+	defaultPaperRecheckDelay = 3 * time.Second
+	// defaultBlockLagWarnSeconds 区块处理延迟告警阈值（秒）
+	defaultBlockLagWarnSeconds = 30
+	// defaultBlockRequeueAttempts 区块获取失败后重新入队的默认次数上限
+	defaultBlockRequeueAttempts = 3
+	// defaultBlockRequeueDelay 区块获取失败后第一次重新入队前的等待时间，之后每次翻倍
+	defaultBlockRequeueDelay = 5 * time.Second
+	// defaultReconnectBackoffMin 重连退避的初始等待时间
+	defaultReconnectBackoffMin = time.Second
+	// defaultReconnectBackoffMax 重连退避的最大等待时间
+	defaultReconnectBackoffMax = 30 * time.Second
+	// defaultKeepaliveInterval 订阅连接保活探测周期
+	defaultKeepaliveInterval = 15 * time.Second
+	// defaultKeepaliveTimeout 单次保活探测的超时
+	defaultKeepaliveTimeout = 10 * time.Second
+	// defaultWSMaxMessageSize WebSocket 单条消息的默认大小上限（字节），与 go-ethereum 客户端的默认值一致
+	defaultWSMaxMessageSize = 32 * 1024 * 1024
+	// defaultPoolTTL 池子超过该时长未更新且储备量过低时视为失效
+	defaultPoolTTL = 24 * time.Hour
+	// defaultOpportunityRetention 已确认套利机会记录（/stats 统计数据）的保留时长
+	defaultOpportunityRetention = 30 * 24 * time.Hour
+	// defaultPoolPruneInterval 池子清理任务执行周期
+	defaultPoolPruneInterval = time.Hour
+	// defaultPoolPruneMinReserve 池子清理的储备量阈值（与套利发现的 1e18 储备量要求一致）
+	defaultPoolPruneMinReserve = "1000000000000000000"
+	// defaultV3FeeTiers V3 池子 fee() 不可用时尝试的费率档位（单位 1e-6）：0.01%、0.05%、0.25%（PancakeSwap）、0.3%、1%
+	defaultV3FeeTiers = "100,500,2500,3000,10000"
+	// defaultRPCCallTimeout 单次 RPC 调用超时
+	defaultRPCCallTimeout = 10 * time.Second
+	// defaultExecSimTolerance 模拟执行输出与估算输出允许的相对偏差
+	defaultExecSimTolerance = 0.01
+	// defaultExecGasPerHop 每跳 swap 估算消耗的 gas
+	defaultExecGasPerHop = 150000
+	// defaultExecWrapGas 每次原生 BNB 包装/解包估算消耗的 gas
+	defaultExecWrapGas = 30000
+	// defaultExecGasPriceGwei 估算执行成本使用的 gas 价格（BSC 常见为 1 gwei）
+	defaultExecGasPriceGwei = 1.0
+	// defaultExecutorResubmitTimeout 套利交易未上链时提价重发前的默认等待时间（BSC 出块约 3 秒）
+	defaultExecutorResubmitTimeout = 15 * time.Second
+	// defaultExecutorGasBumpPercent 每次重发默认提高的 gas 价格百分比
+	defaultExecutorGasBumpPercent = 15
+	// defaultExecutorMaxResubmits 同一 nonce 默认最多重发次数
+	defaultExecutorMaxResubmits = 3
+	// defaultExecutorBreakerFailures 默认连续失败多少次后熔断执行
+	defaultExecutorBreakerFailures = 3
+	// defaultExecutorBreakerWindow 默认统计连续失败的时间窗口
+	defaultExecutorBreakerWindow = 10 * time.Minute
+	// defaultExecutorBreakerCooldown 熔断后默认的冷却时间
+	defaultExecutorBreakerCooldown = 30 * time.Minute
+	// defaultWebhookTimeout 单次 webhook 请求超时
+	defaultWebhookTimeout = 5 * time.Second
+	// defaultWebhookRetries webhook 投递失败后的重试次数
+	defaultWebhookRetries = 2
+	// defaultMaxBackfillBlocks 启动时从持久化游标补扫的最大区块数
+	defaultMaxBackfillBlocks = 1000
+	// defaultRPCConcurrency 同时进行的回执请求数量上限
+	defaultRPCConcurrency = 32
+	// defaultReserveRefreshBatchSize 全量刷新储备量时每批处理的池子数量
+	defaultReserveRefreshBatchSize = 100
+	// defaultReserveRefreshBatchDelay 全量刷新储备量时相邻两批之间的间隔
+	defaultReserveRefreshBatchDelay = time.Second
+	// defaultMaxConcurrentBlocks 同时处理的区块数量上限
+	defaultMaxConcurrentBlocks = 4
+	// defaultStoreWriteRetries 存储瞬时错误的默认重试次数
+	defaultStoreWriteRetries = 3
+	// defaultStoreBufferSize 存储不可用时内存缓冲的默认池子数量上限
+	defaultStoreBufferSize = 10000
+	// defaultStoreRecoveryInterval 存储不可用时尝试写回缓冲的默认周期
+	defaultStoreRecoveryInterval = 5 * time.Second
+	// defaultReserveDiscrepancyBps getReserves 与代币余额允许的默认偏差（基点）
+	defaultReserveDiscrepancyBps = 100
 )
 
 // AppConfig 应用配置
 type AppConfig struct {
 	// BlockQueueSize 区块内存队列容量
 	BlockQueueSize int
+	// WatchMempool 是否订阅内存池，从待打包的工厂建池交易中提前预判新池子（很多公共节点不支持）
+	WatchMempool bool
+	// VerifyReserves 解析 V2 池子时是否额外查询两个代币的 balanceOf，与 getReserves 交叉校验
+	VerifyReserves bool
+	// ReserveDiscrepancyBps getReserves 与代币余额的偏差超过该基点数时标记池子储备量异常
+	ReserveDiscrepancyBps int
+	// SubMode 订阅模式，heads（默认，订阅区块头后获取区块与回执）或 logs（按 Swap/建池 Topic 直接订阅日志）
+	SubMode string
+	// LogQueueSize 日志订阅模式下日志内存队列容量
+	LogQueueSize int
 	// SQLitePath 池子信息持久化所使用的 SQLite 文件路径
 	SQLitePath string
+	// SQLiteBusyTimeout SQLite busy_timeout，锁冲突时等待的时长
+	SQLiteBusyTimeout time.Duration
+	// SQLiteCacheSize SQLite cache_size，正数为页数、负数为 KiB，0 表示使用 SQLite 默认值
+	SQLiteCacheSize int
+	// SQLiteSynchronous SQLite synchronous 级别（OFF/NORMAL/FULL/EXTRA），为空时使用 SQLite 默认值
+	SQLiteSynchronous string
+	// SQLiteMaxConns SQLite 连接池大小，大于 1 时读取可并发（WAL 模式），写入仍串行
+	SQLiteMaxConns int
+	// DBDriver 存储驱动，sqlite（默认）或 postgres
+	DBDriver string
+	// DBDSN 数据库连接串，使用 postgres 驱动时必填
+	DBDSN string
 	// ArbReloadInterval 套利发现者刷新池子图的时间间隔
 	ArbReloadInterval time.Duration
+	// ArbEnumerateTimeout 单次套利环枚举的时间预算，超时后放弃剩余路径，避免拖慢下一轮刷新
+	ArbEnumerateTimeout time.Duration
+	// ArbEnumerateWorkers 全量枚举时按起点代币并行搜索套利环的 worker 数量
+	ArbEnumerateWorkers int
+	// ArbPathCooldown 同一套利路径推送后在该时长内不再重复推送，过期后仍盈利则再次推送，0 表示不抑制
+	ArbPathCooldown time.Duration
+	// ArbIncremental 是否开启增量模式：发现者跟踪 V2 Sync 事件更新储备量，套利发现者只重新评估经过储备量变化池子的套利环
+	ArbIncremental bool
 	// ArbMaxHops 套利路径允许的最大跳数
 	ArbMaxHops int
 	// ArbInitialCapital 套利模拟的初始资金（单位：USD）
 	ArbInitialCapital float64
 	// ArbMinProfit 套利机会的最小收益阈值（单位：USD）
 	ArbMinProfit float64
+	// ArbMinProfitWei 按起始代币配置的整数收益门槛（代币最小单位），配置了的起始代币以它代替 ArbMinProfit 与模拟的整数利润比较
+	ArbMinProfitWei map[common.Address]*big.Int
+	// ArbBaseTokens 套利环的起点/终点代币，为空时使用全部代币
+	ArbBaseTokens []common.Address
+	// WrappedNative 原生币的包装代币地址（BSC 为 WBNB），与原生币按 1:1 视为同一资产
+	WrappedNative common.Address
+	// ArbMinLiquidityUSD 参与套利的池子最低总流动性（单位：USD），池子代币价格均未知时退化为原始储备量检查
+	ArbMinLiquidityUSD float64
+	// ArbMinPoolAge 池子入库后需经过该时长才参与套利枚举，新池子常见于骗局或储备量尚不稳定，0 表示不限制
+	ArbMinPoolAge time.Duration
+	// ArbMaxReserveAge 套利环中任一池子的储备量超过该时长未更新时不模拟该环，0 表示不限制
+	ArbMaxReserveAge time.Duration
+	// ArbMaxHopDeviation 单跳成交价与池子现货价之比超出 [1/x, x] 时视为池子被操纵，丢弃整条路径
+	ArbMaxHopDeviation float64
+	// ArbMaxCycleMultiplier 套利环最终数量与初始数量之比的上限，超过时视为储备量数据异常而非真实套利
+	ArbMaxCycleMultiplier float64
 	// ArbQueueSize 套利机会队列容量
 	ArbQueueSize int
+	// ArbMaxAge 套利机会发布后超过该时长才被计算者取出时直接丢弃，0 表示不限制
+	ArbMaxAge time.Duration
+	// ArbLogFormat 套利机会日志格式，text（默认，带代币符号与 USD 估值的文本）或 kv（key=value，便于机器解析）
+	ArbLogFormat string
+	// BlockLagWarnThreshold 区块处理延迟告警阈值，平均延迟超过该值时输出警告
+	BlockLagWarnThreshold time.Duration
+	// BlockLagDegradeEnabled 平均延迟超过阈值时是否进入跳过回执获取的降级模式
+	BlockLagDegradeEnabled bool
+	// BlockRequeueAttempts 区块按哈希与按高度获取都失败后重新入队的次数上限，0 表示不重新入队、直接放弃
+	BlockRequeueAttempts int
+	// BlockRequeueDelay 第一次重新入队前的等待时间，之后每次翻倍
+	BlockRequeueDelay time.Duration
+	// ReconnectBackoffMin 订阅重连退避的初始等待时间
+	ReconnectBackoffMin time.Duration
+	// ReconnectBackoffMax 订阅重连退避的最大等待时间
+	ReconnectBackoffMax time.Duration
+	// KeepaliveInterval 订阅期间主动探测连接的周期，0 表示关闭保活探测
+	KeepaliveInterval time.Duration
+	// KeepaliveTimeout 单次保活探测的超时，超时视为连接已死并强制重新订阅
+	KeepaliveTimeout time.Duration
+	// WSMaxMessageSize WebSocket 连接单条消息的大小上限（字节），0 表示不限制
+	WSMaxMessageSize int64
+	// WSRPCURL WebSocket 节点地址，只用于区块头、日志与内存池订阅
+	WSRPCURL string
+	// HTTPRPCURL HTTP RPC 节点地址，全部请求/响应调用使用；未配置时由 WSRPCURL 换算
+	HTTPRPCURL string
+	// HTTPRPCURLDerived HTTPRPCURL 未配置、由 WSRPCURL 换算而来
+	HTTPRPCURLDerived bool
+	// ProtocolsConfigPath 协议配置 JSON 文件路径，文件中的协议按 Swap Topic 覆盖或追加到内置协议，为空时只使用内置协议
+	ProtocolsConfigPath string
+	// EnabledProtocols 发现池子时只匹配这些协议（按协议名称）的事件，为空时匹配全部协议
+	EnabledProtocols []string
+	// V3FeeTiers V3 池子 fee() 不可用时，通过 Factory.getPool 逐个匹配的费率档位（单位 1e-6）
+	V3FeeTiers []uint32
+	// V3AccurateQuote 精算时是否读取 V3 池子的 tick 数据逐 tick 计算输出，关闭时使用恒定乘积近似（每个池子额外 3 次批量 RPC）
+	V3AccurateQuote bool
+	// RPCCallTimeout 单次 RPC 调用（区块、回执、合约调用）的超时，0 表示只继承父上下文
+	RPCCallTimeout time.Duration
+	// RPCConcurrency 同时进行的回执请求数量上限，避免压垮节点
+	RPCConcurrency int
+	// RPCRateLimit HTTP 节点连接上每秒的 JSON-RPC 调用数上限（批量请求按其中的调用数计），所有组件共用，0 表示不限速
+	RPCRateLimit float64
+	// ReserveRefreshBatchSize 全量刷新储备量时每批处理的池子数量，批内并发不超过 RPCConcurrency
+	ReserveRefreshBatchSize int
+	// ReserveRefreshBatchDelay 全量刷新储备量时相邻两批之间的间隔（带 ±20% 抖动），0 表示批次之间不等待
+	ReserveRefreshBatchDelay time.Duration
+	// MaxConcurrentBlocks 池子发现者同时处理的区块数量上限，达到上限时暂停出队
+	MaxConcurrentBlocks int
+	// StoreWriteRetries 存储遇到 database is locked 等瞬时错误时的重试次数
+	StoreWriteRetries int
+	// StoreBufferSize 存储不可用时内存中最多缓冲的池子数量，超出后丢弃新池子
+	StoreBufferSize int
+	// StoreRecoveryInterval 存储不可用时尝试将缓冲池子写回的周期
+	StoreRecoveryInterval time.Duration
+	// DebugBlockDump 是否为每个处理的区块输出日志统计（按协议匹配数、未匹配的 topic0 及次数）
+	DebugBlockDump bool
+	// DebugArbDrops 是否逐条输出套利发现阶段被丢弃的路径（储备量缺失、可疑收益），关闭时只在每轮统计中输出数量
+	DebugArbDrops bool
+	// ConfirmationDepth 区块在链头之后至少有多少个区块时才处理，0 表示收到区块头立即处理
+	ConfirmationDepth uint64
+	// MaxBackfillBlocks 启动时从上次处理的区块补扫到链头的最大区块数，超出时只补扫最近的区块，0 表示不补扫
+	MaxBackfillBlocks uint64
+	// PoolTTL 池子超过该时长未更新且储备量低于阈值时被清理，0 表示不清理
+	PoolTTL time.Duration
+	// PoolPruneInterval 池子清理任务执行周期，过期套利机会记录按同一周期清理
+	PoolPruneInterval time.Duration
+	// OpportunityRetention opportunities 与 opportunity_tokens 表中记录的保留时长，0 表示不清理
+	OpportunityRetention time.Duration
+	// PoolPruneMinReserve 池子清理的储备量阈值（原始单位），任一侧低于该值视为流动性不足
+	PoolPruneMinReserve *big.Int
+	// PoolPruneMode 清理方式，deactivate（标记失效）或 delete（删除）
+	PoolPruneMode string
+	// PoolFeeOverrides 按池子地址显式指定的费率（基点，环境变量中为百分比），优先于协议默认费率与合约读取的费率
+	PoolFeeOverrides map[common.Address]int
+	// FactoryFeeOverrides 按工厂地址指定的默认费率（基点，环境变量中为百分比），用于费率非 0.3% 的 V2 分叉
+	FactoryFeeOverrides map[common.Address]int
+	// TokenTaxBps 已知转账税代币登记表（代币地址 -> 基点），优先于链上检测结果
+	TokenTaxBps map[common.Address]int
+	// DenyUnknownTaxTokens 是否排除转账税无法确定的代币
+	DenyUnknownTaxTokens bool
+	// ExecSimulate 是否在提交执行前通过 eth_simulateV1 模拟执行套利路径
+	ExecSimulate bool
+	// ExecSimTolerance 模拟输出与估算输出允许的相对偏差，超过时放弃该机会
+	ExecSimTolerance float64
+	// ExecRouters 模拟执行时各协议使用的路由合约（协议名 -> 路由配置）
+	ExecRouters map[string]routerConfig
+	// ExecGasPerHop 每跳 swap 估算消耗的 gas，用于计算基础 gas 成本
+	ExecGasPerHop uint64
+	// ExecWrapGas 每次原生 BNB 包装/解包估算消耗的 gas，包装/解包不按 swap 计 ExecGasPerHop
+	ExecWrapGas uint64
+	// ExecGasPriceGwei 估算执行成本使用的 gas 价格（gwei），GasOracle 尚未获取到链上价格时使用
+	ExecGasPriceGwei float64
+	// GasPriceMode gas 定价模式，auto（默认，按链头区块是否带 baseFee 判断）、legacy 或 eip1559
+	GasPriceMode string
+	// GasPriorityFeeFloorGwei EIP-1559 优先费下限（gwei）
+	GasPriorityFeeFloorGwei float64
+	// GasMaxFeeGwei maxFeePerGas（legacy 为 gasPrice）上限（gwei），0 表示不限，提价重发也不超过该值
+	GasMaxFeeGwei float64
+	// ExecPriorityFeeBNB 每笔套利交易额外支付给验证者的固定优先费（BNB）
+	ExecPriorityFeeBNB float64
+	// ExecBribePercent 按毛利润比例支付给验证者的贿赂（百分比，10 表示 10%）
+	ExecBribePercent float64
+	// ExecutorMode 执行器模式，log（默认，只记录日志）或 contract（签名并发送交易）
+	ExecutorMode string
+	// ExecutorPrivateKey 发送套利交易的账户私钥（十六进制），只在 contract 模式下使用
+	ExecutorPrivateKey string
+	// ExecutorContract 套利执行合约地址
+	ExecutorContract common.Address
+	// ExecutorGasLimit 套利交易的固定 gas 上限，0 表示按 EstimateGas 结果加 20% 余量
+	ExecutorGasLimit uint64
+	// ExecutorResubmitTimeout 交易超过该时长未上链时提价重发，0 表示不重发
+	ExecutorResubmitTimeout time.Duration
+	// ExecutorApproveCheck 发送套利交易前是否检查账户对执行合约的起始代币授权额度，不足时先提交授权交易
+	ExecutorApproveCheck bool
+	// ExecutorApproveMax 授权时是否按 uint256 最大值授权，关闭时只授权本次执行需要的额度
+	ExecutorApproveMax bool
+	// ExecutorGasBumpPercent 每次重发提高 gas 价格的百分比（节点要求至少 10）
+	ExecutorGasBumpPercent int
+	// ExecutorMaxResubmits 同一 nonce 最多重发次数
+	ExecutorMaxResubmits int
+	// ExecutorBreakerFailures 时间窗口内连续失败多少次后熔断执行，0 表示不熔断
+	ExecutorBreakerFailures int
+	// ExecutorBreakerWindow 统计连续失败的时间窗口
+	ExecutorBreakerWindow time.Duration
+	// ExecutorBreakerCooldown 熔断后自动恢复执行前的冷却时间
+	ExecutorBreakerCooldown time.Duration
+	// CORSOrigins 允许跨域访问 HTTP 接口的来源，* 表示任意来源，为空时不返回 CORS 头
+	CORSOrigins []string
+	// APIKey HTTP 接口的访问密钥，为空时不校验（/ping 与 /healthz 始终公开）
+	APIKey string
+	// EnablePprof 是否挂载 /debug/pprof 性能分析接口，与其他接口一样受 APIKey 保护
+	EnablePprof bool
+	// WebhookURL 确认套利机会后推送的 webhook 地址，为空时不推送
+	WebhookURL string
+	// WebhookSecret webhook 请求体 HMAC-SHA256 签名密钥，为空时不签名
+	WebhookSecret string
+	// WebhookTimeout 单次 webhook 请求超时
+	WebhookTimeout time.Duration
+	// WebhookRetries webhook 投递失败后的重试次数
+	WebhookRetries int
+	// TelegramToken Telegram Bot token，与 TelegramChatID 同时配置时推送通知
+	TelegramToken string
+	// TelegramChatID 接收 Telegram 通知的会话 ID
+	TelegramChatID string
+	// NotifyLog 是否将通知事件（确认的套利机会、运行告警）输出到日志
+	NotifyLog bool
+	// PaperTrading 是否将确认的套利机会记入模拟交易账本（paper_trades 表），不影响实际执行
+	PaperTrading bool
+	// PaperRecheckDelay 模拟交易确认后等待该时长再按存储中的最新储备量复核实际收益，0 表示不复核、直接按预期收益记账
+	PaperRecheckDelay time.Duration
+}
+
+// redactedValue 脱敏后敏感配置项的占位值
+const redactedValue = "******"
+
+// Redacted 返回隐藏了敏感信息（webhook 密钥、Telegram token、API 密钥、数据库连接串、执行账户私钥、
+// RPC 与 webhook 地址中的路径和查询参数）的配置副本，用于日志与 /config 输出
+func (cfg *AppConfig) Redacted() AppConfig {
+	redacted := *cfg
+	redacted.WSRPCURL = redactURL(redacted.WSRPCURL)
+	redacted.HTTPRPCURL = redactURL(redacted.HTTPRPCURL)
+	redacted.WebhookURL = redactURL(redacted.WebhookURL)
+	if redacted.APIKey != "" {
+		redacted.APIKey = redactedValue
+	}
+	if redacted.WebhookSecret != "" {
+		redacted.WebhookSecret = redactedValue
+	}
+	if redacted.TelegramToken != "" {
+		redacted.TelegramToken = redactedValue
+	}
+	if redacted.DBDSN != "" {
+		redacted.DBDSN = redactedValue
+	}
+	if redacted.ExecutorPrivateKey != "" {
+		redacted.ExecutorPrivateKey = redactedValue
+	}
+	return redacted
+}
+
+// redactURL 只保留地址的协议与主机：节点服务商常把 API key 放在路径或查询参数里，用户名密码也一并去掉
+// 无法解析的地址整体替换为占位值
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return redactedValue
+	}
+	redacted := parsed.Scheme + "://" + parsed.Host
+	if strings.Trim(parsed.Path, "/") != "" || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil {
+		redacted += "/" + redactedValue
+	}
+	return redacted
+}
+
+// httpURLFromWS 将 WebSocket 节点地址换算为同一节点的 HTTP 地址：wss 换为 https，ws 换为 http，主机、路径与查询参数不变
+func httpURLFromWS(raw string) (string, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	switch parsed.Scheme {
+	case "wss":
+		parsed.Scheme = "https"
+	case "ws":
+		parsed.Scheme = "http"
+	default:
+		return "", fmt.Errorf("WebSocket 地址协议 %q 不是 ws 或 wss", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("WebSocket 地址缺少主机: %s", redactURL(raw))
+	}
+	return parsed.String(), nil
+}
+
+// arbWarnMaxHopsWithoutBase 未设置 ARB_BASE_TOKENS 时跳数超过该值，环枚举数量会急剧膨胀
+const arbWarnMaxHopsWithoutBase = 4
+
+// Warnings 检查单项合法但组合起来很可能配错的配置，返回可读的警告，不阻止启动
+func (cfg *AppConfig) Warnings() []string {
+	var warnings []string
+	if cfg.HTTPRPCURLDerived {
+		warnings = append(warnings, fmt.Sprintf("未配置 HTTP_RPC_URL，使用由 WS_RPC_URL 换算的 %s；节点的 HTTP 与 WebSocket 端点路径不同时请显式配置", redactURL(cfg.HTTPRPCURL)))
+	}
+	if cfg.ArbMinProfit > 0 && cfg.ArbMinProfit >= cfg.ArbInitialCapital {
+		warnings = append(warnings, fmt.Sprintf("ARB_MIN_PROFIT (%v) 不小于 ARB_INITIAL_CAPITAL (%v)，几乎不会有套利机会达到收益门槛", cfg.ArbMinProfit, cfg.ArbInitialCapital))
+	}
+	if cfg.ArbMaxHops > arbWarnMaxHopsWithoutBase && len(cfg.ArbBaseTokens) == 0 {
+		warnings = append(warnings, fmt.Sprintf("ARB_MAX_HOPS=%d 且未设置 ARB_BASE_TOKENS，环枚举数量可能急剧膨胀", cfg.ArbMaxHops))
+	}
+	if cfg.ArbEnumerateTimeout >= cfg.ArbReloadInterval {
+		warnings = append(warnings, fmt.Sprintf("ARB_ENUMERATE_TIMEOUT (%s) 不小于 ARB_RELOAD_INTERVAL (%s)，一轮枚举可能拖到下一轮刷新", cfg.ArbEnumerateTimeout, cfg.ArbReloadInterval))
+	}
+	if cfg.KeepaliveInterval > 0 && cfg.KeepaliveTimeout >= cfg.KeepaliveInterval {
+		warnings = append(warnings, fmt.Sprintf("KEEPALIVE_TIMEOUT (%s) 不小于 KEEPALIVE_INTERVAL (%s)，上一次探测未结束下一次就已开始", cfg.KeepaliveTimeout, cfg.KeepaliveInterval))
+	}
+	if cfg.GasMaxFeeGwei > 0 && cfg.GasMaxFeeGwei < cfg.ExecGasPriceGwei {
+		warnings = append(warnings, fmt.Sprintf("GAS_MAX_FEE_GWEI (%v) 低于 EXEC_GAS_PRICE_GWEI (%v)，收益模型估算的 gas 成本高于实际允许的上限", cfg.GasMaxFeeGwei, cfg.ExecGasPriceGwei))
+	}
+	if cfg.EnablePprof && cfg.APIKey == "" {
+		warnings = append(warnings, "ENABLE_PPROF 已开启但未设置 API_KEY，/debug/pprof 性能分析接口无需密钥即可访问")
+	}
+	return warnings
 }
 
-// LoadConfig 从环境变量加载配置
+// LoadConfig 从环境变量加载配置，所有非法值汇总为一个错误返回（errors.Join，每项一行），
+// 组合可疑但合法的配置只输出警告
 func LoadConfig() (*AppConfig, error) {
+	// 收集全部非法配置后一并返回，避免逐个修改、逐个重启
+	var errs []error
+
 	queueSize := defaultBlockQueueSize
 	if queueSizeEnv := strings.TrimSpace(os.Getenv("BLOCK_QUEUE_SIZE")); queueSizeEnv != "" {
 		parsed, err := strconv.Atoi(queueSizeEnv)
 		if err != nil || parsed <= 0 {
-			return nil, fmt.Errorf("BLOCK_QUEUE_SIZE 非法值: %s", queueSizeEnv)
+			errs = append(errs, fmt.Errorf("BLOCK_QUEUE_SIZE 非法值: %s", queueSizeEnv))
 		}
 		queueSize = parsed
 	}
 
+	subMode := strings.ToLower(strings.TrimSpace(os.Getenv("SUB_MODE")))
+	if subMode == "" {
+		subMode = SubModeHeads
+	}
+	if subMode != SubModeHeads && subMode != SubModeLogs {
+		errs = append(errs, fmt.Errorf("SUB_MODE 非法值: %s（可选 heads、logs）", subMode))
+	}
+
+	watchMempool := false
+	if watchStr := strings.TrimSpace(os.Getenv("WATCH_MEMPOOL")); watchStr != "" {
+		value, err := strconv.ParseBool(watchStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("WATCH_MEMPOOL 非法值: %s", watchStr))
+		}
+		watchMempool = value
+	}
+
+	verifyReserves := false
+	if verifyStr := strings.TrimSpace(os.Getenv("VERIFY_RESERVES")); verifyStr != "" {
+		value, err := strconv.ParseBool(verifyStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("VERIFY_RESERVES 非法值: %s", verifyStr))
+		}
+		verifyReserves = value
+	}
+
+	discrepancyBps := defaultReserveDiscrepancyBps
+	if bpsStr := strings.TrimSpace(os.Getenv("RESERVE_DISCREPANCY_BPS")); bpsStr != "" {
+		value, err := strconv.Atoi(bpsStr)
+		if err != nil || value < 0 {
+			errs = append(errs, fmt.Errorf("RESERVE_DISCREPANCY_BPS 非法值: %s", bpsStr))
+		}
+		discrepancyBps = value
+	}
+
+	logQueueSize := defaultLogQueueSize
+	if sizeStr := strings.TrimSpace(os.Getenv("LOG_QUEUE_SIZE")); sizeStr != "" {
+		parsed, err := strconv.Atoi(sizeStr)
+		if err != nil || parsed <= 0 {
+			errs = append(errs, fmt.Errorf("LOG_QUEUE_SIZE 非法值: %s", sizeStr))
+		}
+		logQueueSize = parsed
+	}
+
 	sqlitePath := strings.TrimSpace(os.Getenv("SQLITE_PATH"))
 	if sqlitePath == "" {
 		sqlitePath = defaultSQLitePath
 	}
 
+	sqliteBusyTimeout := defaultSQLiteBusyTimeout
+	if timeoutStr := strings.TrimSpace(os.Getenv("SQLITE_BUSY_TIMEOUT")); timeoutStr != "" {
+		duration, err := time.ParseDuration(timeoutStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("SQLITE_BUSY_TIMEOUT 非法值: %s", timeoutStr))
+		}
+		sqliteBusyTimeout = duration
+	}
+
+	sqliteCacheSize := 0
+	if cacheStr := strings.TrimSpace(os.Getenv("SQLITE_CACHE_SIZE")); cacheStr != "" {
+		parsed, err := strconv.Atoi(cacheStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SQLITE_CACHE_SIZE 非法值: %s", cacheStr))
+		}
+		sqliteCacheSize = parsed
+	}
+
+	sqliteSynchronous := strings.ToUpper(strings.TrimSpace(os.Getenv("SQLITE_SYNCHRONOUS")))
+	switch sqliteSynchronous {
+	case "", "OFF", "NORMAL", "FULL", "EXTRA":
+	default:
+		errs = append(errs, fmt.Errorf("SQLITE_SYNCHRONOUS 非法值: %s（可选 OFF、NORMAL、FULL、EXTRA）", sqliteSynchronous))
+	}
+
+	sqliteMaxConns := defaultSQLiteMaxConns
+	if connsStr := strings.TrimSpace(os.Getenv("SQLITE_MAX_CONNS")); connsStr != "" {
+		parsed, err := strconv.Atoi(connsStr)
+		if err != nil || parsed <= 0 {
+			errs = append(errs, fmt.Errorf("SQLITE_MAX_CONNS 非法值: %s", connsStr))
+		}
+		sqliteMaxConns = parsed
+	}
+
+	dbDriver := strings.ToLower(strings.TrimSpace(os.Getenv("DB_DRIVER")))
+	if dbDriver == "" {
+		dbDriver = StoreDriverSQLite
+	}
+	if dbDriver != StoreDriverSQLite && dbDriver != StoreDriverPostgres {
+		errs = append(errs, fmt.Errorf("DB_DRIVER 非法值: %s", dbDriver))
+	}
+	dbDSN := strings.TrimSpace(os.Getenv("DB_DSN"))
+	if dbDriver == StoreDriverPostgres && dbDSN == "" {
+		errs = append(errs, fmt.Errorf("DB_DRIVER=postgres 时必须设置 DB_DSN"))
+	}
+
 	reloadInterval := time.Duration(defaultArbReloadSeconds) * time.Second
 	if intervalStr := strings.TrimSpace(os.Getenv("ARB_RELOAD_INTERVAL")); intervalStr != "" {
 		duration, err := time.ParseDuration(intervalStr)
 		if err != nil || duration <= 0 {
-			return nil, fmt.Errorf("ARB_RELOAD_INTERVAL 非法值: %s", intervalStr)
+			errs = append(errs, fmt.Errorf("ARB_RELOAD_INTERVAL 非法值: %s", intervalStr))
 		}
 		reloadInterval = duration
 	}
 
+	enumerateTimeout := defaultArbEnumerateTimeout
+	if timeoutStr := strings.TrimSpace(os.Getenv("ARB_ENUMERATE_TIMEOUT")); timeoutStr != "" {
+		duration, err := time.ParseDuration(timeoutStr)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Errorf("ARB_ENUMERATE_TIMEOUT 非法值: %s", timeoutStr))
+		}
+		enumerateTimeout = duration
+	}
+
+	// 默认每个 CPU 核一个 worker
+	enumerateWorkers := runtime.NumCPU()
+	if workersStr := strings.TrimSpace(os.Getenv("ARB_ENUMERATE_WORKERS")); workersStr != "" {
+		value, err := strconv.Atoi(workersStr)
+		if err != nil || value <= 0 {
+			errs = append(errs, fmt.Errorf("ARB_ENUMERATE_WORKERS 非法值: %s", workersStr))
+		}
+		enumerateWorkers = value
+	}
+
+	pathCooldown := defaultArbPathCooldown
+	if cooldownStr := strings.TrimSpace(os.Getenv("ARB_PATH_COOLDOWN")); cooldownStr != "" {
+		duration, err := time.ParseDuration(cooldownStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("ARB_PATH_COOLDOWN 非法值: %s", cooldownStr))
+		}
+		pathCooldown = duration
+	}
+
+	arbIncremental := false
+	if incrementalStr := strings.TrimSpace(os.Getenv("ARB_INCREMENTAL")); incrementalStr != "" {
+		value, err := strconv.ParseBool(incrementalStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ARB_INCREMENTAL 非法值: %s", incrementalStr))
+		}
+		arbIncremental = value
+	}
+
 	maxHops := defaultArbMaxHops
 	if hopsStr := strings.TrimSpace(os.Getenv("ARB_MAX_HOPS")); hopsStr != "" {
 		parsed, err := strconv.Atoi(hopsStr)
 		if err != nil || parsed < 2 {
-			return nil, fmt.Errorf("ARB_MAX_HOPS 非法值: %s", hopsStr)
+			errs = append(errs, fmt.Errorf("ARB_MAX_HOPS 非法值: %s", hopsStr))
 		}
 		maxHops = parsed
 	}
@@ -81,7 +601,7 @@ func LoadConfig() (*AppConfig, error) {
 	if capitalStr := strings.TrimSpace(os.Getenv("ARB_INITIAL_CAPITAL")); capitalStr != "" {
 		value, err := strconv.ParseFloat(capitalStr, 64)
 		if err != nil || value <= 0 {
-			return nil, fmt.Errorf("ARB_INITIAL_CAPITAL 非法值: %s", capitalStr)
+			errs = append(errs, fmt.Errorf("ARB_INITIAL_CAPITAL 非法值: %s", capitalStr))
 		}
 		initialCapital = value
 	}
@@ -90,27 +610,860 @@ func LoadConfig() (*AppConfig, error) {
 	if profitStr := strings.TrimSpace(os.Getenv("ARB_MIN_PROFIT")); profitStr != "" {
 		value, err := strconv.ParseFloat(profitStr, 64)
 		if err != nil || value < 0 {
-			return nil, fmt.Errorf("ARB_MIN_PROFIT 非法值: %s", profitStr)
+			errs = append(errs, fmt.Errorf("ARB_MIN_PROFIT 非法值: %s", profitStr))
 		}
 		minProfit = value
 	}
 
+	minProfitWei := make(map[common.Address]*big.Int)
+	if weiStr := strings.TrimSpace(os.Getenv("ARB_MIN_PROFIT_WEI")); weiStr != "" {
+		for _, item := range strings.Split(weiStr, ",") {
+			parts := strings.Split(strings.TrimSpace(item), ":")
+			if len(parts) != 2 || !common.IsHexAddress(strings.TrimSpace(parts[0])) {
+				errs = append(errs, fmt.Errorf("ARB_MIN_PROFIT_WEI 非法值: %s", item))
+				continue
+			}
+			wei, ok := new(big.Int).SetString(strings.TrimSpace(parts[1]), 10)
+			if !ok || wei.Sign() < 0 {
+				errs = append(errs, fmt.Errorf("ARB_MIN_PROFIT_WEI 非法值: %s", item))
+				continue
+			}
+			minProfitWei[common.HexToAddress(strings.TrimSpace(parts[0]))] = wei
+		}
+	}
+
+	wrappedNative := common.HexToAddress(WBNBAddressHex)
+	if wrappedStr := strings.TrimSpace(os.Getenv("WRAPPED_NATIVE_ADDRESS")); wrappedStr != "" {
+		if !common.IsHexAddress(wrappedStr) || common.HexToAddress(wrappedStr) == nativeToken {
+			errs = append(errs, fmt.Errorf("WRAPPED_NATIVE_ADDRESS 非法值: %s", wrappedStr))
+		}
+		wrappedNative = common.HexToAddress(wrappedStr)
+	}
+
+	var baseTokens []common.Address
+	if baseStr := strings.TrimSpace(os.Getenv("ARB_BASE_TOKENS")); baseStr != "" {
+		for _, item := range strings.Split(baseStr, ",") {
+			item = strings.TrimSpace(item)
+			if !common.IsHexAddress(item) {
+				errs = append(errs, fmt.Errorf("ARB_BASE_TOKENS 非法值: %s", item))
+				continue
+			}
+			baseTokens = append(baseTokens, common.HexToAddress(item))
+		}
+	}
+
+	minLiquidity := defaultArbMinLiquidityUSD
+	if liquidityStr := strings.TrimSpace(os.Getenv("ARB_MIN_LIQUIDITY_USD")); liquidityStr != "" {
+		value, err := strconv.ParseFloat(liquidityStr, 64)
+		if err != nil || value < 0 {
+			errs = append(errs, fmt.Errorf("ARB_MIN_LIQUIDITY_USD 非法值: %s", liquidityStr))
+		}
+		minLiquidity = value
+	}
+
+	var minPoolAge time.Duration
+	if ageStr := strings.TrimSpace(os.Getenv("ARB_MIN_POOL_AGE")); ageStr != "" {
+		duration, err := time.ParseDuration(ageStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("ARB_MIN_POOL_AGE 非法值: %s", ageStr))
+		}
+		minPoolAge = duration
+	}
+
+	var maxReserveAge time.Duration
+	if ageStr := strings.TrimSpace(os.Getenv("ARB_MAX_RESERVE_AGE")); ageStr != "" {
+		duration, err := time.ParseDuration(ageStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("ARB_MAX_RESERVE_AGE 非法值: %s", ageStr))
+		}
+		maxReserveAge = duration
+	}
+
+	maxHopDeviation := defaultArbMaxHopDeviation
+	if deviationStr := strings.TrimSpace(os.Getenv("ARB_MAX_HOP_DEVIATION")); deviationStr != "" {
+		value, err := strconv.ParseFloat(deviationStr, 64)
+		if err != nil || value <= 1 {
+			errs = append(errs, fmt.Errorf("ARB_MAX_HOP_DEVIATION 非法值: %s", deviationStr))
+		}
+		maxHopDeviation = value
+	}
+
+	maxCycleMultiplier := defaultArbMaxCycleMultiplier
+	if multiplierStr := strings.TrimSpace(os.Getenv("ARB_MAX_CYCLE_MULTIPLIER")); multiplierStr != "" {
+		value, err := strconv.ParseFloat(multiplierStr, 64)
+		if err != nil || value <= 1 {
+			errs = append(errs, fmt.Errorf("ARB_MAX_CYCLE_MULTIPLIER 非法值: %s", multiplierStr))
+		}
+		maxCycleMultiplier = value
+	}
+
 	arbQueueSize := defaultArbQueueSize
 	if queueStr := strings.TrimSpace(os.Getenv("ARB_QUEUE_SIZE")); queueStr != "" {
 		parsed, err := strconv.Atoi(queueStr)
 		if err != nil || parsed <= 0 {
-			return nil, fmt.Errorf("ARB_QUEUE_SIZE 非法值: %s", queueStr)
+			errs = append(errs, fmt.Errorf("ARB_QUEUE_SIZE 非法值: %s", queueStr))
 		}
 		arbQueueSize = parsed
 	}
 
-	return &AppConfig{
-		BlockQueueSize:    queueSize,
-		SQLitePath:        sqlitePath,
-		ArbReloadInterval: reloadInterval,
-		ArbMaxHops:        maxHops,
-		ArbInitialCapital: initialCapital,
-		ArbMinProfit:      minProfit,
-		ArbQueueSize:      arbQueueSize,
-	}, nil
+	arbMaxAge := defaultArbMaxAge
+	if ageStr := strings.TrimSpace(os.Getenv("ARB_MAX_AGE")); ageStr != "" {
+		duration, err := time.ParseDuration(ageStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("ARB_MAX_AGE 非法值: %s", ageStr))
+		}
+		arbMaxAge = duration
+	}
+
+	arbLogFormat := strings.ToLower(strings.TrimSpace(os.Getenv("ARB_LOG_FORMAT")))
+	if arbLogFormat == "" {
+		arbLogFormat = ArbLogFormatText
+	}
+	if arbLogFormat != ArbLogFormatText && arbLogFormat != ArbLogFormatKV {
+		errs = append(errs, fmt.Errorf("ARB_LOG_FORMAT 非法值: %s", arbLogFormat))
+	}
+
+	lagWarn := time.Duration(defaultBlockLagWarnSeconds) * time.Second
+	if lagStr := strings.TrimSpace(os.Getenv("BLOCK_LAG_WARN_THRESHOLD")); lagStr != "" {
+		duration, err := time.ParseDuration(lagStr)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Errorf("BLOCK_LAG_WARN_THRESHOLD 非法值: %s", lagStr))
+		}
+		lagWarn = duration
+	}
+
+	lagDegrade := false
+	if degradeStr := strings.TrimSpace(os.Getenv("BLOCK_LAG_DEGRADE")); degradeStr != "" {
+		value, err := strconv.ParseBool(degradeStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("BLOCK_LAG_DEGRADE 非法值: %s", degradeStr))
+		}
+		lagDegrade = value
+	}
+
+	blockRequeueAttempts := defaultBlockRequeueAttempts
+	if attemptsStr := strings.TrimSpace(os.Getenv("BLOCK_REQUEUE_ATTEMPTS")); attemptsStr != "" {
+		parsed, err := strconv.Atoi(attemptsStr)
+		if err != nil || parsed < 0 {
+			errs = append(errs, fmt.Errorf("BLOCK_REQUEUE_ATTEMPTS 非法值: %s", attemptsStr))
+		}
+		blockRequeueAttempts = parsed
+	}
+
+	blockRequeueDelay := defaultBlockRequeueDelay
+	if delayStr := strings.TrimSpace(os.Getenv("BLOCK_REQUEUE_DELAY")); delayStr != "" {
+		duration, err := time.ParseDuration(delayStr)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Errorf("BLOCK_REQUEUE_DELAY 非法值: %s", delayStr))
+		}
+		blockRequeueDelay = duration
+	}
+
+	backoffMin := defaultReconnectBackoffMin
+	if minStr := strings.TrimSpace(os.Getenv("RECONNECT_BACKOFF_MIN")); minStr != "" {
+		duration, err := time.ParseDuration(minStr)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Errorf("RECONNECT_BACKOFF_MIN 非法值: %s", minStr))
+		}
+		backoffMin = duration
+	}
+
+	backoffMax := defaultReconnectBackoffMax
+	if maxStr := strings.TrimSpace(os.Getenv("RECONNECT_BACKOFF_MAX")); maxStr != "" {
+		duration, err := time.ParseDuration(maxStr)
+		if err != nil || duration < backoffMin {
+			errs = append(errs, fmt.Errorf("RECONNECT_BACKOFF_MAX 非法值: %s", maxStr))
+		}
+		backoffMax = duration
+	}
+
+	keepaliveInterval := defaultKeepaliveInterval
+	if intervalStr := strings.TrimSpace(os.Getenv("KEEPALIVE_INTERVAL")); intervalStr != "" {
+		duration, err := time.ParseDuration(intervalStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("KEEPALIVE_INTERVAL 非法值: %s", intervalStr))
+		}
+		keepaliveInterval = duration
+	}
+
+	keepaliveTimeout := defaultKeepaliveTimeout
+	if timeoutStr := strings.TrimSpace(os.Getenv("KEEPALIVE_TIMEOUT")); timeoutStr != "" {
+		duration, err := time.ParseDuration(timeoutStr)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Errorf("KEEPALIVE_TIMEOUT 非法值: %s", timeoutStr))
+		}
+		keepaliveTimeout = duration
+	}
+
+	wsMaxMessageSize := int64(defaultWSMaxMessageSize)
+	if sizeStr := strings.TrimSpace(os.Getenv("WS_MAX_MESSAGE_SIZE")); sizeStr != "" {
+		parsed, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || parsed < 0 {
+			errs = append(errs, fmt.Errorf("WS_MAX_MESSAGE_SIZE 非法值: %s", sizeStr))
+		}
+		wsMaxMessageSize = parsed
+	}
+
+	wsRPCURL := strings.TrimSpace(os.Getenv("WS_RPC_URL"))
+	if wsRPCURL == "" {
+		wsRPCURL = DefaultBSCWssURL
+	}
+	httpRPCURL := strings.TrimSpace(os.Getenv("HTTP_RPC_URL"))
+	httpRPCURLDerived := false
+	if httpRPCURL == "" {
+		// 订阅与调用指向不同的节点时，收到新区块头后可能读不到该区块；未单独配置时使用同一节点的 HTTP 端点
+		derived, err := httpURLFromWS(wsRPCURL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("未配置 HTTP_RPC_URL，且无法由 WS_RPC_URL 换算: %w", err))
+		}
+		httpRPCURL = derived
+		httpRPCURLDerived = true
+	}
+
+	rpcConcurrency := defaultRPCConcurrency
+	if concurrencyStr := strings.TrimSpace(os.Getenv("RPC_CONCURRENCY")); concurrencyStr != "" {
+		parsed, err := strconv.Atoi(concurrencyStr)
+		if err != nil || parsed <= 0 {
+			errs = append(errs, fmt.Errorf("RPC_CONCURRENCY 非法值: %s", concurrencyStr))
+		}
+		rpcConcurrency = parsed
+	}
+
+	var rpcRateLimit float64
+	if limitStr := strings.TrimSpace(os.Getenv("RPC_RATE_LIMIT")); limitStr != "" {
+		parsed, err := strconv.ParseFloat(limitStr, 64)
+		if err != nil || parsed < 0 || math.IsInf(parsed, 0) {
+			errs = append(errs, fmt.Errorf("RPC_RATE_LIMIT 非法值: %s", limitStr))
+		}
+		rpcRateLimit = parsed
+	}
+
+	refreshBatchSize := defaultReserveRefreshBatchSize
+	if sizeStr := strings.TrimSpace(os.Getenv("RESERVE_REFRESH_BATCH_SIZE")); sizeStr != "" {
+		parsed, err := strconv.Atoi(sizeStr)
+		if err != nil || parsed <= 0 {
+			errs = append(errs, fmt.Errorf("RESERVE_REFRESH_BATCH_SIZE 非法值: %s", sizeStr))
+		}
+		refreshBatchSize = parsed
+	}
+
+	refreshBatchDelay := defaultReserveRefreshBatchDelay
+	if delayStr := strings.TrimSpace(os.Getenv("RESERVE_REFRESH_BATCH_DELAY")); delayStr != "" {
+		duration, err := time.ParseDuration(delayStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("RESERVE_REFRESH_BATCH_DELAY 非法值: %s", delayStr))
+		}
+		refreshBatchDelay = duration
+	}
+
+	maxConcurrentBlocks := defaultMaxConcurrentBlocks
+	if blocksStr := strings.TrimSpace(os.Getenv("MAX_CONCURRENT_BLOCKS")); blocksStr != "" {
+		parsed, err := strconv.Atoi(blocksStr)
+		if err != nil || parsed <= 0 {
+			errs = append(errs, fmt.Errorf("MAX_CONCURRENT_BLOCKS 非法值: %s", blocksStr))
+		}
+		maxConcurrentBlocks = parsed
+	}
+
+	debugBlockDump := false
+	if dumpStr := strings.TrimSpace(os.Getenv("DEBUG_BLOCK_DUMP")); dumpStr != "" {
+		value, err := strconv.ParseBool(dumpStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DEBUG_BLOCK_DUMP 非法值: %s", dumpStr))
+		}
+		debugBlockDump = value
+	}
+
+	debugArbDrops := false
+	if dropsStr := strings.TrimSpace(os.Getenv("DEBUG_ARB_DROPS")); dropsStr != "" {
+		value, err := strconv.ParseBool(dropsStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DEBUG_ARB_DROPS 非法值: %s", dropsStr))
+		}
+		debugArbDrops = value
+	}
+
+	storeRetries := defaultStoreWriteRetries
+	if retriesStr := strings.TrimSpace(os.Getenv("STORE_WRITE_RETRIES")); retriesStr != "" {
+		parsed, err := strconv.Atoi(retriesStr)
+		if err != nil || parsed < 0 {
+			errs = append(errs, fmt.Errorf("STORE_WRITE_RETRIES 非法值: %s", retriesStr))
+		}
+		storeRetries = parsed
+	}
+
+	storeBufferSize := defaultStoreBufferSize
+	if bufferStr := strings.TrimSpace(os.Getenv("STORE_BUFFER_SIZE")); bufferStr != "" {
+		parsed, err := strconv.Atoi(bufferStr)
+		if err != nil || parsed < 0 {
+			errs = append(errs, fmt.Errorf("STORE_BUFFER_SIZE 非法值: %s", bufferStr))
+		}
+		storeBufferSize = parsed
+	}
+
+	storeRecovery := defaultStoreRecoveryInterval
+	if recoveryStr := strings.TrimSpace(os.Getenv("STORE_RECOVERY_INTERVAL")); recoveryStr != "" {
+		duration, err := time.ParseDuration(recoveryStr)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Errorf("STORE_RECOVERY_INTERVAL 非法值: %s", recoveryStr))
+		}
+		storeRecovery = duration
+	}
+
+	maxBackfill := uint64(defaultMaxBackfillBlocks)
+	if backfillStr := strings.TrimSpace(os.Getenv("MAX_BACKFILL_BLOCKS")); backfillStr != "" {
+		parsed, err := strconv.ParseUint(backfillStr, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("MAX_BACKFILL_BLOCKS 非法值: %s", backfillStr))
+		}
+		maxBackfill = parsed
+	}
+
+	var confirmationDepth uint64
+	if depthStr := strings.TrimSpace(os.Getenv("CONFIRMATION_DEPTH")); depthStr != "" {
+		parsed, err := strconv.ParseUint(depthStr, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CONFIRMATION_DEPTH 非法值: %s", depthStr))
+		}
+		confirmationDepth = parsed
+	}
+
+	feeTiersStr := strings.TrimSpace(os.Getenv("V3_FEE_TIERS"))
+	if feeTiersStr == "" {
+		feeTiersStr = defaultV3FeeTiers
+	}
+	var feeTiers []uint32
+	for _, tierStr := range strings.Split(feeTiersStr, ",") {
+		tier, err := strconv.ParseUint(strings.TrimSpace(tierStr), 10, 24)
+		if err != nil || tier == 0 {
+			errs = append(errs, fmt.Errorf("V3_FEE_TIERS 非法值: %s", feeTiersStr))
+			break
+		}
+		feeTiers = append(feeTiers, uint32(tier))
+	}
+
+	rpcCallTimeout := defaultRPCCallTimeout
+	if timeoutStr := strings.TrimSpace(os.Getenv("RPC_CALL_TIMEOUT")); timeoutStr != "" {
+		duration, err := time.ParseDuration(timeoutStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("RPC_CALL_TIMEOUT 非法值: %s", timeoutStr))
+		}
+		rpcCallTimeout = duration
+	}
+
+	poolTTL := defaultPoolTTL
+	if ttlStr := strings.TrimSpace(os.Getenv("POOL_TTL")); ttlStr != "" {
+		duration, err := time.ParseDuration(ttlStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("POOL_TTL 非法值: %s", ttlStr))
+		}
+		poolTTL = duration
+	}
+
+	opportunityRetention := defaultOpportunityRetention
+	if retentionStr := strings.TrimSpace(os.Getenv("OPPORTUNITY_RETENTION")); retentionStr != "" {
+		duration, err := time.ParseDuration(retentionStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("OPPORTUNITY_RETENTION 非法值: %s", retentionStr))
+		}
+		opportunityRetention = duration
+	}
+
+	pruneInterval := defaultPoolPruneInterval
+	if intervalStr := strings.TrimSpace(os.Getenv("POOL_PRUNE_INTERVAL")); intervalStr != "" {
+		duration, err := time.ParseDuration(intervalStr)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Errorf("POOL_PRUNE_INTERVAL 非法值: %s", intervalStr))
+		}
+		pruneInterval = duration
+	}
+
+	pruneMinReserveStr := strings.TrimSpace(os.Getenv("POOL_PRUNE_MIN_RESERVE"))
+	if pruneMinReserveStr == "" {
+		pruneMinReserveStr = defaultPoolPruneMinReserve
+	}
+	pruneMinReserve, ok := new(big.Int).SetString(pruneMinReserveStr, 10)
+	if !ok || pruneMinReserve.Sign() < 0 {
+		errs = append(errs, fmt.Errorf("POOL_PRUNE_MIN_RESERVE 非法值: %s", pruneMinReserveStr))
+	}
+
+	pruneMode := strings.ToLower(strings.TrimSpace(os.Getenv("POOL_PRUNE_MODE")))
+	if pruneMode == "" {
+		pruneMode = PoolPruneModeDeactivate
+	}
+	if pruneMode != PoolPruneModeDeactivate && pruneMode != PoolPruneModeDelete {
+		errs = append(errs, fmt.Errorf("POOL_PRUNE_MODE 非法值: %s", pruneMode))
+	}
+
+	poolFeeOverrides, err := parseFeeOverrides("POOL_FEE_OVERRIDES")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	factoryFeeOverrides, err := parseFeeOverrides("FACTORY_FEE_OVERRIDES")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	tokenTax := make(map[common.Address]int)
+	if taxStr := strings.TrimSpace(os.Getenv("TOKEN_TAX_BPS")); taxStr != "" {
+		for _, item := range strings.Split(taxStr, ",") {
+			parts := strings.Split(strings.TrimSpace(item), ":")
+			if len(parts) != 2 || !common.IsHexAddress(strings.TrimSpace(parts[0])) {
+				errs = append(errs, fmt.Errorf("TOKEN_TAX_BPS 非法值: %s", item))
+				continue
+			}
+			bps, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil || bps < 0 || bps >= 10000 {
+				errs = append(errs, fmt.Errorf("TOKEN_TAX_BPS 非法值: %s", item))
+				continue
+			}
+			tokenTax[common.HexToAddress(strings.TrimSpace(parts[0]))] = bps
+		}
+	}
+
+	denyUnknownTax := false
+	if denyStr := strings.TrimSpace(os.Getenv("TOKEN_DENY_UNKNOWN_TAX")); denyStr != "" {
+		value, err := strconv.ParseBool(denyStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TOKEN_DENY_UNKNOWN_TAX 非法值: %s", denyStr))
+		}
+		denyUnknownTax = value
+	}
+
+	v3AccurateQuote := false
+	if accurateStr := strings.TrimSpace(os.Getenv("V3_ACCURATE_QUOTE")); accurateStr != "" {
+		value, err := strconv.ParseBool(accurateStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("V3_ACCURATE_QUOTE 非法值: %s", accurateStr))
+		}
+		v3AccurateQuote = value
+	}
+
+	execSimulate := false
+	if simulateStr := strings.TrimSpace(os.Getenv("EXEC_SIMULATE")); simulateStr != "" {
+		value, err := strconv.ParseBool(simulateStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("EXEC_SIMULATE 非法值: %s", simulateStr))
+		}
+		execSimulate = value
+	}
+
+	execSimTolerance := defaultExecSimTolerance
+	if toleranceStr := strings.TrimSpace(os.Getenv("EXEC_SIM_TOLERANCE")); toleranceStr != "" {
+		value, err := strconv.ParseFloat(toleranceStr, 64)
+		if err != nil || value < 0 {
+			errs = append(errs, fmt.Errorf("EXEC_SIM_TOLERANCE 非法值: %s", toleranceStr))
+		}
+		execSimTolerance = value
+	}
+
+	execRouters := map[string]routerConfig{
+		ProtocolUniswapV3: {Address: common.HexToAddress(PancakeSwapV3RouterHex), Method: RouterMethodExactInputSingle},
+	}
+	if routersStr := strings.TrimSpace(os.Getenv("EXEC_ROUTERS")); routersStr != "" {
+		// 格式: 协议名=路由地址:方法,...，配置后完全替换默认路由
+		execRouters = make(map[string]routerConfig)
+		for _, item := range strings.Split(routersStr, ",") {
+			protocol, target, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok {
+				errs = append(errs, fmt.Errorf("EXEC_ROUTERS 非法值: %s", item))
+				continue
+			}
+			address, method, ok := strings.Cut(strings.TrimSpace(target), ":")
+			address, method = strings.TrimSpace(address), strings.TrimSpace(method)
+			if !ok || !common.IsHexAddress(address) ||
+				(method != RouterMethodSwapExactTokensForTokens && method != RouterMethodExactInputSingle) {
+				errs = append(errs, fmt.Errorf("EXEC_ROUTERS 非法值: %s", item))
+				continue
+			}
+			execRouters[strings.TrimSpace(protocol)] = routerConfig{Address: common.HexToAddress(address), Method: method}
+		}
+	}
+
+	gasPerHop := uint64(defaultExecGasPerHop)
+	if gasStr := strings.TrimSpace(os.Getenv("EXEC_GAS_PER_HOP")); gasStr != "" {
+		parsed, err := strconv.ParseUint(gasStr, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("EXEC_GAS_PER_HOP 非法值: %s", gasStr))
+		}
+		gasPerHop = parsed
+	}
+
+	wrapGas := uint64(defaultExecWrapGas)
+	if gasStr := strings.TrimSpace(os.Getenv("EXEC_WRAP_GAS")); gasStr != "" {
+		parsed, err := strconv.ParseUint(gasStr, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("EXEC_WRAP_GAS 非法值: %s", gasStr))
+		}
+		wrapGas = parsed
+	}
+
+	gasPriceGwei := defaultExecGasPriceGwei
+	if priceStr := strings.TrimSpace(os.Getenv("EXEC_GAS_PRICE_GWEI")); priceStr != "" {
+		value, err := strconv.ParseFloat(priceStr, 64)
+		if err != nil || value < 0 {
+			errs = append(errs, fmt.Errorf("EXEC_GAS_PRICE_GWEI 非法值: %s", priceStr))
+		}
+		gasPriceGwei = value
+	}
+
+	gasPriceMode := strings.ToLower(strings.TrimSpace(os.Getenv("GAS_PRICE_MODE")))
+	if gasPriceMode == "" {
+		gasPriceMode = GasModeAuto
+	}
+	if gasPriceMode != GasModeAuto && gasPriceMode != GasModeLegacy && gasPriceMode != GasModeEIP1559 {
+		errs = append(errs, fmt.Errorf("GAS_PRICE_MODE 非法值: %s", gasPriceMode))
+	}
+
+	priorityFeeFloor := 0.0
+	if floorStr := strings.TrimSpace(os.Getenv("GAS_PRIORITY_FEE_FLOOR_GWEI")); floorStr != "" {
+		value, err := strconv.ParseFloat(floorStr, 64)
+		if err != nil || value < 0 {
+			errs = append(errs, fmt.Errorf("GAS_PRIORITY_FEE_FLOOR_GWEI 非法值: %s", floorStr))
+		}
+		priorityFeeFloor = value
+	}
+
+	maxFee := 0.0
+	if maxFeeStr := strings.TrimSpace(os.Getenv("GAS_MAX_FEE_GWEI")); maxFeeStr != "" {
+		value, err := strconv.ParseFloat(maxFeeStr, 64)
+		if err != nil || value < 0 {
+			errs = append(errs, fmt.Errorf("GAS_MAX_FEE_GWEI 非法值: %s", maxFeeStr))
+		}
+		maxFee = value
+	}
+	if maxFee > 0 && priorityFeeFloor > maxFee {
+		errs = append(errs, fmt.Errorf("GAS_PRIORITY_FEE_FLOOR_GWEI (%v) 不能大于 GAS_MAX_FEE_GWEI (%v)", priorityFeeFloor, maxFee))
+	}
+
+	priorityFee := 0.0
+	if feeStr := strings.TrimSpace(os.Getenv("EXEC_PRIORITY_FEE_BNB")); feeStr != "" {
+		value, err := strconv.ParseFloat(feeStr, 64)
+		if err != nil || value < 0 {
+			errs = append(errs, fmt.Errorf("EXEC_PRIORITY_FEE_BNB 非法值: %s", feeStr))
+		}
+		priorityFee = value
+	}
+
+	bribePercent := 0.0
+	if bribeStr := strings.TrimSpace(os.Getenv("EXEC_BRIBE_PERCENT")); bribeStr != "" {
+		value, err := strconv.ParseFloat(bribeStr, 64)
+		if err != nil || value < 0 || value > 100 {
+			errs = append(errs, fmt.Errorf("EXEC_BRIBE_PERCENT 非法值: %s", bribeStr))
+		}
+		bribePercent = value
+	}
+
+	executorMode := strings.ToLower(strings.TrimSpace(os.Getenv("EXECUTOR_MODE")))
+	if executorMode == "" {
+		executorMode = ExecutorModeLog
+	}
+	if executorMode != ExecutorModeLog && executorMode != ExecutorModeContract {
+		errs = append(errs, fmt.Errorf("EXECUTOR_MODE 非法值: %s", executorMode))
+	}
+	executorKey := strings.TrimSpace(os.Getenv("EXECUTOR_PRIVATE_KEY"))
+	var executorContract common.Address
+	if contractStr := strings.TrimSpace(os.Getenv("EXECUTOR_CONTRACT")); contractStr != "" {
+		if !common.IsHexAddress(contractStr) {
+			errs = append(errs, fmt.Errorf("EXECUTOR_CONTRACT 非法值: %s", contractStr))
+		}
+		executorContract = common.HexToAddress(contractStr)
+	}
+	if executorMode == ExecutorModeContract && (executorKey == "" || executorContract == (common.Address{})) {
+		errs = append(errs, fmt.Errorf("EXECUTOR_MODE=contract 时必须设置 EXECUTOR_PRIVATE_KEY 与 EXECUTOR_CONTRACT"))
+	}
+
+	var executorGasLimit uint64
+	if gasStr := strings.TrimSpace(os.Getenv("EXECUTOR_GAS_LIMIT")); gasStr != "" {
+		parsed, err := strconv.ParseUint(gasStr, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("EXECUTOR_GAS_LIMIT 非法值: %s", gasStr))
+		}
+		executorGasLimit = parsed
+	}
+
+	resubmitTimeout := defaultExecutorResubmitTimeout
+	if timeoutStr := strings.TrimSpace(os.Getenv("EXECUTOR_RESUBMIT_TIMEOUT")); timeoutStr != "" {
+		duration, err := time.ParseDuration(timeoutStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("EXECUTOR_RESUBMIT_TIMEOUT 非法值: %s", timeoutStr))
+		}
+		resubmitTimeout = duration
+	}
+
+	approveCheck := true
+	if checkStr := strings.TrimSpace(os.Getenv("EXECUTOR_APPROVE_CHECK")); checkStr != "" {
+		value, err := strconv.ParseBool(checkStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("EXECUTOR_APPROVE_CHECK 非法值: %s", checkStr))
+		}
+		approveCheck = value
+	}
+
+	approveMax := true
+	if maxStr := strings.TrimSpace(os.Getenv("EXECUTOR_APPROVE_MAX")); maxStr != "" {
+		value, err := strconv.ParseBool(maxStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("EXECUTOR_APPROVE_MAX 非法值: %s", maxStr))
+		}
+		approveMax = value
+	}
+
+	gasBumpPercent := defaultExecutorGasBumpPercent
+	if bumpStr := strings.TrimSpace(os.Getenv("EXECUTOR_GAS_BUMP_PERCENT")); bumpStr != "" {
+		parsed, err := strconv.Atoi(bumpStr)
+		if err != nil || parsed < 10 {
+			errs = append(errs, fmt.Errorf("EXECUTOR_GAS_BUMP_PERCENT 非法值: %s（替换交易至少提价 10%%）", bumpStr))
+		}
+		gasBumpPercent = parsed
+	}
+
+	maxResubmits := defaultExecutorMaxResubmits
+	if resubmitsStr := strings.TrimSpace(os.Getenv("EXECUTOR_MAX_RESUBMITS")); resubmitsStr != "" {
+		parsed, err := strconv.Atoi(resubmitsStr)
+		if err != nil || parsed < 0 {
+			errs = append(errs, fmt.Errorf("EXECUTOR_MAX_RESUBMITS 非法值: %s", resubmitsStr))
+		}
+		maxResubmits = parsed
+	}
+
+	breakerFailures := defaultExecutorBreakerFailures
+	if failuresStr := strings.TrimSpace(os.Getenv("EXECUTOR_BREAKER_FAILURES")); failuresStr != "" {
+		parsed, err := strconv.Atoi(failuresStr)
+		if err != nil || parsed < 0 {
+			errs = append(errs, fmt.Errorf("EXECUTOR_BREAKER_FAILURES 非法值: %s", failuresStr))
+		}
+		breakerFailures = parsed
+	}
+
+	breakerWindow := defaultExecutorBreakerWindow
+	if windowStr := strings.TrimSpace(os.Getenv("EXECUTOR_BREAKER_WINDOW")); windowStr != "" {
+		duration, err := time.ParseDuration(windowStr)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Errorf("EXECUTOR_BREAKER_WINDOW 非法值: %s", windowStr))
+		}
+		breakerWindow = duration
+	}
+
+	breakerCooldown := defaultExecutorBreakerCooldown
+	if cooldownStr := strings.TrimSpace(os.Getenv("EXECUTOR_BREAKER_COOLDOWN")); cooldownStr != "" {
+		duration, err := time.ParseDuration(cooldownStr)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Errorf("EXECUTOR_BREAKER_COOLDOWN 非法值: %s", cooldownStr))
+		}
+		breakerCooldown = duration
+	}
+
+	var corsOrigins []string
+	if originsStr := strings.TrimSpace(os.Getenv("CORS_ORIGINS")); originsStr != "" {
+		for _, origin := range strings.Split(originsStr, ",") {
+			if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+				corsOrigins = append(corsOrigins, origin)
+			}
+		}
+	}
+
+	var enabledProtocols []string
+	if protocolsStr := strings.TrimSpace(os.Getenv("ENABLED_PROTOCOLS")); protocolsStr != "" {
+		for _, name := range strings.Split(protocolsStr, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				enabledProtocols = append(enabledProtocols, name)
+			}
+		}
+	}
+
+	webhookURL := strings.TrimSpace(os.Getenv("WEBHOOK_URL"))
+
+	webhookTimeout := defaultWebhookTimeout
+	if timeoutStr := strings.TrimSpace(os.Getenv("WEBHOOK_TIMEOUT")); timeoutStr != "" {
+		duration, err := time.ParseDuration(timeoutStr)
+		if err != nil || duration <= 0 {
+			errs = append(errs, fmt.Errorf("WEBHOOK_TIMEOUT 非法值: %s", timeoutStr))
+		}
+		webhookTimeout = duration
+	}
+
+	webhookRetries := defaultWebhookRetries
+	if retriesStr := strings.TrimSpace(os.Getenv("WEBHOOK_RETRIES")); retriesStr != "" {
+		parsed, err := strconv.Atoi(retriesStr)
+		if err != nil || parsed < 0 {
+			errs = append(errs, fmt.Errorf("WEBHOOK_RETRIES 非法值: %s", retriesStr))
+		}
+		webhookRetries = parsed
+	}
+
+	notifyLog := true
+	if logStr := strings.TrimSpace(os.Getenv("NOTIFY_LOG")); logStr != "" {
+		value, err := strconv.ParseBool(logStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("NOTIFY_LOG 非法值: %s", logStr))
+		}
+		notifyLog = value
+	}
+
+	var paperTrading bool
+	if paperStr := strings.TrimSpace(os.Getenv("PAPER_TRADING")); paperStr != "" {
+		value, err := strconv.ParseBool(paperStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("PAPER_TRADING 非法值: %s", paperStr))
+		}
+		paperTrading = value
+	}
+
+	paperRecheckDelay := defaultPaperRecheckDelay
+	if delayStr := strings.TrimSpace(os.Getenv("PAPER_RECHECK_DELAY")); delayStr != "" {
+		duration, err := time.ParseDuration(delayStr)
+		if err != nil || duration < 0 {
+			errs = append(errs, fmt.Errorf("PAPER_RECHECK_DELAY 非法值: %s", delayStr))
+		}
+		paperRecheckDelay = duration
+	}
+
+	var enablePprof bool
+	if pprofStr := strings.TrimSpace(os.Getenv("ENABLE_PPROF")); pprofStr != "" {
+		value, err := strconv.ParseBool(pprofStr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ENABLE_PPROF 非法值: %s", pprofStr))
+		}
+		enablePprof = value
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	cfg := &AppConfig{
+		BlockQueueSize:           queueSize,
+		WatchMempool:             watchMempool,
+		VerifyReserves:           verifyReserves,
+		ReserveDiscrepancyBps:    discrepancyBps,
+		SubMode:                  subMode,
+		LogQueueSize:             logQueueSize,
+		SQLitePath:               sqlitePath,
+		SQLiteBusyTimeout:        sqliteBusyTimeout,
+		SQLiteCacheSize:          sqliteCacheSize,
+		SQLiteSynchronous:        sqliteSynchronous,
+		SQLiteMaxConns:           sqliteMaxConns,
+		DBDriver:                 dbDriver,
+		DBDSN:                    dbDSN,
+		ArbReloadInterval:        reloadInterval,
+		ArbEnumerateTimeout:      enumerateTimeout,
+		ArbEnumerateWorkers:      enumerateWorkers,
+		ArbPathCooldown:          pathCooldown,
+		ArbIncremental:           arbIncremental,
+		ArbMaxHops:               maxHops,
+		ArbInitialCapital:        initialCapital,
+		ArbMinProfit:             minProfit,
+		ArbMinProfitWei:          minProfitWei,
+		ArbBaseTokens:            baseTokens,
+		WrappedNative:            wrappedNative,
+		ArbMinLiquidityUSD:       minLiquidity,
+		ArbMinPoolAge:            minPoolAge,
+		ArbMaxReserveAge:         maxReserveAge,
+		ArbMaxHopDeviation:       maxHopDeviation,
+		ArbMaxCycleMultiplier:    maxCycleMultiplier,
+		ArbQueueSize:             arbQueueSize,
+		ArbMaxAge:                arbMaxAge,
+		ArbLogFormat:             arbLogFormat,
+		BlockLagWarnThreshold:    lagWarn,
+		BlockLagDegradeEnabled:   lagDegrade,
+		BlockRequeueAttempts:     blockRequeueAttempts,
+		BlockRequeueDelay:        blockRequeueDelay,
+		ReconnectBackoffMin:      backoffMin,
+		ReconnectBackoffMax:      backoffMax,
+		KeepaliveInterval:        keepaliveInterval,
+		KeepaliveTimeout:         keepaliveTimeout,
+		WSMaxMessageSize:         wsMaxMessageSize,
+		WSRPCURL:                 wsRPCURL,
+		HTTPRPCURL:               httpRPCURL,
+		HTTPRPCURLDerived:        httpRPCURLDerived,
+		ProtocolsConfigPath:      strings.TrimSpace(os.Getenv("PROTOCOLS_CONFIG_PATH")),
+		EnabledProtocols:         enabledProtocols,
+		V3FeeTiers:               feeTiers,
+		V3AccurateQuote:          v3AccurateQuote,
+		RPCCallTimeout:           rpcCallTimeout,
+		RPCConcurrency:           rpcConcurrency,
+		RPCRateLimit:             rpcRateLimit,
+		ReserveRefreshBatchSize:  refreshBatchSize,
+		ReserveRefreshBatchDelay: refreshBatchDelay,
+		StoreWriteRetries:        storeRetries,
+		StoreBufferSize:          storeBufferSize,
+		StoreRecoveryInterval:    storeRecovery,
+		MaxConcurrentBlocks:      maxConcurrentBlocks,
+		DebugBlockDump:           debugBlockDump,
+		DebugArbDrops:            debugArbDrops,
+		ConfirmationDepth:        confirmationDepth,
+		MaxBackfillBlocks:        maxBackfill,
+		PoolTTL:                  poolTTL,
+		PoolPruneInterval:        pruneInterval,
+		OpportunityRetention:     opportunityRetention,
+		PoolPruneMinReserve:      pruneMinReserve,
+		PoolPruneMode:            pruneMode,
+		PoolFeeOverrides:         poolFeeOverrides,
+		FactoryFeeOverrides:      factoryFeeOverrides,
+		TokenTaxBps:              tokenTax,
+		DenyUnknownTaxTokens:     denyUnknownTax,
+		ExecSimulate:             execSimulate,
+		ExecSimTolerance:         execSimTolerance,
+		ExecRouters:              execRouters,
+		ExecGasPerHop:            gasPerHop,
+		ExecWrapGas:              wrapGas,
+		ExecGasPriceGwei:         gasPriceGwei,
+		GasPriceMode:             gasPriceMode,
+		GasPriorityFeeFloorGwei:  priorityFeeFloor,
+		GasMaxFeeGwei:            maxFee,
+		ExecPriorityFeeBNB:       priorityFee,
+		ExecBribePercent:         bribePercent,
+		ExecutorMode:             executorMode,
+		ExecutorPrivateKey:       executorKey,
+		ExecutorContract:         executorContract,
+		ExecutorGasLimit:         executorGasLimit,
+		ExecutorResubmitTimeout:  resubmitTimeout,
+		ExecutorApproveCheck:     approveCheck,
+		ExecutorApproveMax:       approveMax,
+		ExecutorGasBumpPercent:   gasBumpPercent,
+		ExecutorMaxResubmits:     maxResubmits,
+		ExecutorBreakerFailures:  breakerFailures,
+		ExecutorBreakerWindow:    breakerWindow,
+		ExecutorBreakerCooldown:  breakerCooldown,
+		CORSOrigins:              corsOrigins,
+		APIKey:                   strings.TrimSpace(os.Getenv("API_KEY")),
+		EnablePprof:              enablePprof,
+		WebhookURL:               webhookURL,
+		WebhookSecret:            os.Getenv("WEBHOOK_SECRET"),
+		WebhookTimeout:           webhookTimeout,
+		WebhookRetries:           webhookRetries,
+		TelegramToken:            strings.TrimSpace(os.Getenv("TELEGRAM_TOKEN")),
+		TelegramChatID:           strings.TrimSpace(os.Getenv("TELEGRAM_CHAT_ID")),
+		NotifyLog:                notifyLog,
+		PaperTrading:             paperTrading,
+		PaperRecheckDelay:        paperRecheckDelay,
+	}
+	for _, warning := range cfg.Warnings() {
+		log.Printf("配置警告: %s", warning)
+	}
+	return cfg, nil
+}
+
+// parseFeeOverrides 解析「地址:费率百分比,...」格式的环境变量，例如 0xabc...:0.17 表示 0.17%，换算为基点
+func parseFeeOverrides(name string) (map[common.Address]int, error) {
+	overrides := make(map[common.Address]int)
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return overrides, nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		address, feeStr, ok := strings.Cut(strings.TrimSpace(item), ":")
+		address = strings.TrimSpace(address)
+		if !ok || !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("%s 非法值: %s", name, item)
+		}
+		fee, err := strconv.ParseFloat(strings.TrimSpace(feeStr), 64)
+		// 按换算后的基点检查，99.996 这类四舍五入到 10000 基点的值同样拒绝
+		if err != nil || fee < 0 || !validFeeBps(feePercentToBps(fee)) {
+			return nil, fmt.Errorf("%s 非法值: %s", name, item)
+		}
+		overrides[common.HexToAddress(address)] = feePercentToBps(fee)
+	}
+	return overrides, nil
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math/big"
+	"sort"
+	"time"
+)
+
+// confirmationBuffer 按高度缓存收到的区块头，链头到达 H+depth 时才放出高度 H 的区块
+// 同一高度再次收到区块头（链重组）时覆盖旧记录；depth 为 0 时收到即放出。只在订阅循环中使用，不做并发保护
+type confirmationBuffer struct {
+	depth   uint64
+	pending map[uint64]BlockEvent
+}
+
+func newConfirmationBuffer(depth uint64) *confirmationBuffer {
+	return &confirmationBuffer{depth: depth, pending: make(map[uint64]BlockEvent)}
+}
+
+// Push 登记新的区块头，按高度升序返回已达到确认深度的区块
+// 放出的区块不带哈希，由发现者按高度获取当时规范链上的区块：缓存期间该高度可能已被重组替换，
+// 而节点不保证为重组后的每个高度都推送区块头；headTime 为本次链头的区块时间戳，记为放出区块的 ConfirmedAt
+func (cb *confirmationBuffer) Push(event BlockEvent, headTime time.Time) []BlockEvent {
+	if cb.depth == 0 {
+		return []BlockEvent{event}
+	}
+	number := event.Number.Uint64()
+	cb.pending[number] = event
+	if number < cb.depth {
+		return nil
+	}
+
+	confirmed := number - cb.depth
+	var heights []uint64
+	for height := range cb.pending {
+		if height <= confirmed {
+			heights = append(heights, height)
+		}
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	ready := make([]BlockEvent, 0, len(heights))
+	for _, height := range heights {
+		delete(cb.pending, height)
+		ready = append(ready, BlockEvent{Number: new(big.Int).SetUint64(height), ConfirmedAt: headTime})
+	}
+	return ready
+}
@@ -32,6 +32,33 @@ const (
 	// UniswapV4SwapTopic Uniswap V4 协议的 Swap 事件 Topic（基于当前公开规范）
 	// 对应事件签名: Swap(address sender, bytes32 poolId, int128 amount0, int128 amount1, uint160 sqrtPriceX96, int24 tick)
 	UniswapV4SwapTopic = "0x017b45c007bc4ff26fb88674c8e55e9c705cf8b79157c48987a35b92e5c2cece"
+
+	// BalancerSwapTopic Balancer V2 Vault 的 Swap 事件 Topic（事件由 Vault 而不是池子合约发出）
+	// 对应事件签名: Swap(bytes32 indexed poolId, address indexed tokenIn, address indexed tokenOut, uint256 amountIn, uint256 amountOut)
+	BalancerSwapTopic = "0x2170c741c41531aec20e7c107c24eecfdd15e69c9bb0a8dd37b1840b9e0b207b"
+)
+
+// 工厂合约创建池子事件 Topic
+const (
+	// PairCreatedTopic Uniswap V2 及类似协议 Factory 的 PairCreated 事件 Topic
+	// 对应事件签名: PairCreated(address indexed token0, address indexed token1, address pair, uint256)
+	PairCreatedTopic = "0x0d3648bd0f6ba80134a33ba9275ac585d9d315f0ad8355cddefde31afa28d0e9"
+
+	// PoolCreatedTopic Uniswap V3 及类似协议 Factory 的 PoolCreated 事件 Topic
+	// 对应事件签名: PoolCreated(address indexed token0, address indexed token1, uint24 indexed fee, int24 tickSpacing, address pool)
+	PoolCreatedTopic = "0x783cca1c0412dd0d695e784568c96da2e9c22ff989357a2e8b1d9b2b4e6b7118"
+)
+
+// SyncTopic Uniswap V2 及类似协议 Pair 的 Sync 事件 Topic，每次储备量变化后发出
+// 对应事件签名: Sync(uint112 reserve0, uint112 reserve1)
+const SyncTopic = "0x1c411e9a96e071241c2f21f7726b17ae89e3cab4c78be50e062b03a9fffbbad1"
+
+// 工厂合约建池方法选择器，用于从内存池交易的 calldata 中预判新池子
+const (
+	// CreatePairSelector Uniswap V2 及类似协议 Factory 的 createPair(address tokenA, address tokenB)
+	CreatePairSelector = "0xc9c65396"
+	// CreatePoolSelector Uniswap V3 及类似协议 Factory 的 createPool(address tokenA, address tokenB, uint24 fee)
+	CreatePoolSelector = "0xa1671295"
 )
 
 // 协议名称
@@ -47,15 +74,56 @@ const (
 
 	// ProtocolUniswapV4 Uniswap V4 协议名称
 	ProtocolUniswapV4 = "UniswapV4Swap"
+
+	// ProtocolBalancerWeighted Balancer V2 加权池及其分叉
+	ProtocolBalancerWeighted = "BalancerWeightedSwap"
+
+	// ProtocolWrapNative 原生 BNB 与 WBNB 之间的包装/解包，不是真实的池子，只作为零手续费的一跳参与枚举
+	ProtocolWrapNative = "WrapNative"
 )
 
 // 协议费率
 const (
-	// UniswapV1StaticFee Uniswap V1 及类似协议的费率（默认 0.30%）
-	UniswapV1StaticFee = 0.30
+	// UniswapV1StaticFeeBps Uniswap V1 及类似协议的费率（默认 0.30%，单位基点）
+	UniswapV1StaticFeeBps = 30
 
-	// UniswapV2StaticFee Uniswap V2 及类似协议的基准费率（默认 0.30%）
-	UniswapV2StaticFee = 0.30
+	// UniswapV2StaticFeeBps Uniswap V2 及类似协议的基准费率（默认 0.30%，单位基点）
+	UniswapV2StaticFeeBps = 30
+
+	// PancakeSwapV2StaticFeeBps PancakeSwap V2 的费率（0.25%，单位基点）
+	PancakeSwapV2StaticFeeBps = 25
+
+	// BiswapStaticFeeBps Biswap 的默认费率（0.20%，单位基点）
+	BiswapStaticFeeBps = 20
+)
+
+// 池子费率来源，随池子一起落库便于排查费率异常
+const (
+	// FeeSourceStatic 协议配置中的固定费率
+	FeeSourceStatic = "static"
+
+	// FeeSourceContract 池子合约 fee() 方法返回的费率
+	FeeSourceContract = "contract"
+
+	// FeeSourceEvent 工厂合约 PoolCreated 事件中携带的费率
+	FeeSourceEvent = "event"
+
+	// FeeSourceOverride POOL_FEE_OVERRIDES / FACTORY_FEE_OVERRIDES 中显式配置的费率
+	FeeSourceOverride = "override"
+
+	// FeeSourceFactory fee() 调用失败后，通过 Factory.getPool 匹配费率档位得到的费率
+	FeeSourceFactory = "factory"
+
+	// FeeSourceGlobalState Algebra 类动态费率池子 globalState() 返回的当前费率
+	FeeSourceGlobalState = "global_state"
+)
+
+// 从池子合约读取费率的方法，协议配置的 fee_methods 按顺序列出
+const (
+	// FeeMethodFee Uniswap V3 及多数分叉的静态 fee()
+	FeeMethodFee = "fee"
+	// FeeMethodGlobalState Algebra（QuickSwap、Thena 等）池子的 globalState()，费率随市场波动变化
+	FeeMethodGlobalState = "globalState"
 )
 
 // 合约 ABI JSON 字符串
@@ -82,9 +150,23 @@ const (
 `
 
 	// PairABIJSON Uniswap V2 及类似协议的 Pair 合约 ABI
-	// 包含 token0、token1 和 getReserves 方法
+	// 包含 token0、token1、getReserves、factory 与 swap 方法，以及用于统计成交量的 Swap 事件
 	PairABIJSON = `
 [
+	{
+		"constant": true,
+		"inputs": [],
+		"name": "factory",
+		"outputs": [
+			{
+				"name": "",
+				"type": "address"
+			}
+		],
+		"payable": false,
+		"stateMutability": "view",
+		"type": "function"
+	},
 	{
 		"constant": true,
 		"inputs": [],
@@ -134,14 +216,90 @@ const (
 		"payable": false,
 		"stateMutability": "view",
 		"type": "function"
+	},
+	{
+		"constant": false,
+		"inputs": [
+			{
+				"name": "amount0Out",
+				"type": "uint256"
+			},
+			{
+				"name": "amount1Out",
+				"type": "uint256"
+			},
+			{
+				"name": "to",
+				"type": "address"
+			},
+			{
+				"name": "data",
+				"type": "bytes"
+			}
+		],
+		"name": "swap",
+		"outputs": [],
+		"payable": false,
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"anonymous": false,
+		"inputs": [
+			{
+				"indexed": true,
+				"name": "sender",
+				"type": "address"
+			},
+			{
+				"indexed": false,
+				"name": "amount0In",
+				"type": "uint256"
+			},
+			{
+				"indexed": false,
+				"name": "amount1In",
+				"type": "uint256"
+			},
+			{
+				"indexed": false,
+				"name": "amount0Out",
+				"type": "uint256"
+			},
+			{
+				"indexed": false,
+				"name": "amount1Out",
+				"type": "uint256"
+			},
+			{
+				"indexed": true,
+				"name": "to",
+				"type": "address"
+			}
+		],
+		"name": "Swap",
+		"type": "event"
 	}
 ]
 `
 
 	// UniswapV3ABIJSON Uniswap V3 协议的 Pool 合约 ABI
-	// 包含 token0、token1 和 fee 方法
+	// 包含 token0、token1、fee 和 factory 方法，以及用于统计成交量的 Swap 事件
 	UniswapV3ABIJSON = `
 [
+	{
+		"inputs": [],
+		"name": "factory",
+		"outputs": [
+			{
+				"internalType": "address",
+				"name": "",
+				"type": "address"
+			}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	},
 	{
 		"inputs": [],
 		"name": "token0",
@@ -180,12 +338,275 @@ const (
 		],
 		"stateMutability": "view",
 		"type": "function"
+	},
+	{
+		"anonymous": false,
+		"inputs": [
+			{
+				"indexed": true,
+				"internalType": "address",
+				"name": "sender",
+				"type": "address"
+			},
+			{
+				"indexed": true,
+				"internalType": "address",
+				"name": "recipient",
+				"type": "address"
+			},
+			{
+				"indexed": false,
+				"internalType": "int256",
+				"name": "amount0",
+				"type": "int256"
+			},
+			{
+				"indexed": false,
+				"internalType": "int256",
+				"name": "amount1",
+				"type": "int256"
+			},
+			{
+				"indexed": false,
+				"internalType": "uint160",
+				"name": "sqrtPriceX96",
+				"type": "uint160"
+			},
+			{
+				"indexed": false,
+				"internalType": "uint128",
+				"name": "liquidity",
+				"type": "uint128"
+			},
+			{
+				"indexed": false,
+				"internalType": "int24",
+				"name": "tick",
+				"type": "int24"
+			}
+		],
+		"name": "Swap",
+		"type": "event"
+	}
+]
+`
+
+	// BalancerWeightedABIJSON Balancer V2 Vault 与加权池合约的 ABI
+	// 包含 Vault 的 getPoolTokens 方法与 Swap 事件，以及池子的 getNormalizedWeights、getSwapFeePercentage 方法
+	BalancerWeightedABIJSON = `
+[
+	{
+		"inputs": [
+			{
+				"internalType": "bytes32",
+				"name": "poolId",
+				"type": "bytes32"
+			}
+		],
+		"name": "getPoolTokens",
+		"outputs": [
+			{
+				"internalType": "contract IERC20[]",
+				"name": "tokens",
+				"type": "address[]"
+			},
+			{
+				"internalType": "uint256[]",
+				"name": "balances",
+				"type": "uint256[]"
+			},
+			{
+				"internalType": "uint256",
+				"name": "lastChangeBlock",
+				"type": "uint256"
+			}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "getNormalizedWeights",
+		"outputs": [
+			{
+				"internalType": "uint256[]",
+				"name": "",
+				"type": "uint256[]"
+			}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "getSwapFeePercentage",
+		"outputs": [
+			{
+				"internalType": "uint256",
+				"name": "",
+				"type": "uint256"
+			}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"anonymous": false,
+		"inputs": [
+			{
+				"indexed": true,
+				"internalType": "bytes32",
+				"name": "poolId",
+				"type": "bytes32"
+			},
+			{
+				"indexed": true,
+				"internalType": "contract IERC20",
+				"name": "tokenIn",
+				"type": "address"
+			},
+			{
+				"indexed": true,
+				"internalType": "contract IERC20",
+				"name": "tokenOut",
+				"type": "address"
+			},
+			{
+				"indexed": false,
+				"internalType": "uint256",
+				"name": "amountIn",
+				"type": "uint256"
+			},
+			{
+				"indexed": false,
+				"internalType": "uint256",
+				"name": "amountOut",
+				"type": "uint256"
+			}
+		],
+		"name": "Swap",
+		"type": "event"
+	}
+]
+`
+
+	// UniswapV3FactoryABIJSON Uniswap V3 Factory 合约 ABI
+	// 包含 getPool 方法，用于在池子 fee() 调用失败时反查费率档位
+	UniswapV3FactoryABIJSON = `
+[
+	{
+		"inputs": [
+			{
+				"internalType": "address",
+				"name": "tokenA",
+				"type": "address"
+			},
+			{
+				"internalType": "address",
+				"name": "tokenB",
+				"type": "address"
+			},
+			{
+				"internalType": "uint24",
+				"name": "fee",
+				"type": "uint24"
+			}
+		],
+		"name": "getPool",
+		"outputs": [
+			{
+				"internalType": "address",
+				"name": "",
+				"type": "address"
+			}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	}
+]
+`
+
+	// AlgebraGlobalStateABIJSON Algebra 池子的 globalState 方法 ABI，用于读取动态费率
+	// 各版本 globalState 的前三个返回值都是 price、tick、fee（v1.9 的第三个为 zeroToOne 方向费率，第四个为 oneToZero 方向费率），
+	// 只声明这三个，兼容其余布局差异；v1.9 的第四个返回值由 CallGlobalStateFee 按返回值字数识别后读取
+	AlgebraGlobalStateABIJSON = `
+[
+	{
+		"inputs": [],
+		"name": "globalState",
+		"outputs": [
+			{"internalType": "uint160", "name": "price", "type": "uint160"},
+			{"internalType": "int24", "name": "tick", "type": "int24"},
+			{"internalType": "uint16", "name": "fee", "type": "uint16"}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	}
+]
+`
+
+	// UniswapV3StateABIJSON Uniswap V3 Pool 的状态查询 ABI，用于跨 tick 精确报价
+	// 包含 slot0、liquidity、tickSpacing、tickBitmap 和 ticks 方法；
+	// slot0 与 ticks 只声明前两个返回值，兼容 PancakeSwap V3 等返回值布局不同的分叉
+	UniswapV3StateABIJSON = `
+[
+	{
+		"inputs": [],
+		"name": "slot0",
+		"outputs": [
+			{"internalType": "uint160", "name": "sqrtPriceX96", "type": "uint160"},
+			{"internalType": "int24", "name": "tick", "type": "int24"}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "liquidity",
+		"outputs": [
+			{"internalType": "uint128", "name": "", "type": "uint128"}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "tickSpacing",
+		"outputs": [
+			{"internalType": "int24", "name": "", "type": "int24"}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"internalType": "int16", "name": "wordPosition", "type": "int16"}
+		],
+		"name": "tickBitmap",
+		"outputs": [
+			{"internalType": "uint256", "name": "", "type": "uint256"}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"internalType": "int24", "name": "tick", "type": "int24"}
+		],
+		"name": "ticks",
+		"outputs": [
+			{"internalType": "uint128", "name": "liquidityGross", "type": "uint128"},
+			{"internalType": "int128", "name": "liquidityNet", "type": "int128"}
+		],
+		"stateMutability": "view",
+		"type": "function"
 	}
 ]
 `
 
 	// ERC20ABIJSON ERC20 标准代币合约 ABI
-	// 包含 balanceOf 方法，用于获取代币余额
+	// 包含 balanceOf、decimals、symbol、name、transfer、approve 和 allowance 方法，用于获取余额、代币元数据、模拟转账以及执行前的授权检查
+	// 启动时解析一次为 erc20ABI 供各处复用
 	ERC20ABIJSON = `
 [
 	{
@@ -206,16 +627,334 @@ const (
 		"payable": false,
 		"stateMutability": "view",
 		"type": "function"
+	},
+	{
+		"constant": true,
+		"inputs": [],
+		"name": "decimals",
+		"outputs": [
+			{
+				"name": "",
+				"type": "uint8"
+			}
+		],
+		"payable": false,
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"constant": true,
+		"inputs": [],
+		"name": "symbol",
+		"outputs": [
+			{
+				"name": "",
+				"type": "string"
+			}
+		],
+		"payable": false,
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"constant": true,
+		"inputs": [],
+		"name": "name",
+		"outputs": [
+			{
+				"name": "",
+				"type": "string"
+			}
+		],
+		"payable": false,
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"constant": false,
+		"inputs": [
+			{
+				"name": "_to",
+				"type": "address"
+			},
+			{
+				"name": "_value",
+				"type": "uint256"
+			}
+		],
+		"name": "transfer",
+		"outputs": [
+			{
+				"name": "",
+				"type": "bool"
+			}
+		],
+		"payable": false,
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"constant": false,
+		"inputs": [
+			{
+				"name": "_spender",
+				"type": "address"
+			},
+			{
+				"name": "_value",
+				"type": "uint256"
+			}
+		],
+		"name": "approve",
+		"outputs": [
+			{
+				"name": "",
+				"type": "bool"
+			}
+		],
+		"payable": false,
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"constant": true,
+		"inputs": [
+			{
+				"name": "_owner",
+				"type": "address"
+			},
+			{
+				"name": "_spender",
+				"type": "address"
+			}
+		],
+		"name": "allowance",
+		"outputs": [
+			{
+				"name": "",
+				"type": "uint256"
+			}
+		],
+		"payable": false,
+		"stateMutability": "view",
+		"type": "function"
+	}
+]
+`
+
+	// RouterABIJSON 模拟执行使用的路由合约 ABI
+	// 包含 V2 风格的 swapExactTokensForTokens 与 V3 SwapRouter（带 deadline）的 exactInputSingle 方法
+	RouterABIJSON = `
+[
+	{
+		"inputs": [
+			{
+				"internalType": "uint256",
+				"name": "amountIn",
+				"type": "uint256"
+			},
+			{
+				"internalType": "uint256",
+				"name": "amountOutMin",
+				"type": "uint256"
+			},
+			{
+				"internalType": "address[]",
+				"name": "path",
+				"type": "address[]"
+			},
+			{
+				"internalType": "address",
+				"name": "to",
+				"type": "address"
+			},
+			{
+				"internalType": "uint256",
+				"name": "deadline",
+				"type": "uint256"
+			}
+		],
+		"name": "swapExactTokensForTokens",
+		"outputs": [
+			{
+				"internalType": "uint256[]",
+				"name": "amounts",
+				"type": "uint256[]"
+			}
+		],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{
+				"components": [
+					{
+						"internalType": "address",
+						"name": "tokenIn",
+						"type": "address"
+					},
+					{
+						"internalType": "address",
+						"name": "tokenOut",
+						"type": "address"
+					},
+					{
+						"internalType": "uint24",
+						"name": "fee",
+						"type": "uint24"
+					},
+					{
+						"internalType": "address",
+						"name": "recipient",
+						"type": "address"
+					},
+					{
+						"internalType": "uint256",
+						"name": "deadline",
+						"type": "uint256"
+					},
+					{
+						"internalType": "uint256",
+						"name": "amountIn",
+						"type": "uint256"
+					},
+					{
+						"internalType": "uint256",
+						"name": "amountOutMinimum",
+						"type": "uint256"
+					},
+					{
+						"internalType": "uint160",
+						"name": "sqrtPriceLimitX96",
+						"type": "uint160"
+					}
+				],
+				"internalType": "struct ISwapRouter.ExactInputSingleParams",
+				"name": "params",
+				"type": "tuple"
+			}
+		],
+		"name": "exactInputSingle",
+		"outputs": [
+			{
+				"internalType": "uint256",
+				"name": "amountOut",
+				"type": "uint256"
+			}
+		],
+		"stateMutability": "payable",
+		"type": "function"
+	}
+]
+`
+
+	// ArbitrageExecutorABIJSON 套利执行合约 ABI（EXECUTOR_MODE=contract 时调用）
+	// 合约按 hops 顺序逐跳兑换，最终得到的起始代币少于 minAmountOut 时整体回滚
+	ArbitrageExecutorABIJSON = `
+[
+	{
+		"inputs": [
+			{
+				"internalType": "uint256",
+				"name": "amountIn",
+				"type": "uint256"
+			},
+			{
+				"internalType": "uint256",
+				"name": "minAmountOut",
+				"type": "uint256"
+			},
+			{
+				"components": [
+					{
+						"internalType": "address",
+						"name": "pool",
+						"type": "address"
+					},
+					{
+						"internalType": "address",
+						"name": "tokenIn",
+						"type": "address"
+					},
+					{
+						"internalType": "address",
+						"name": "tokenOut",
+						"type": "address"
+					},
+					{
+						"internalType": "uint8",
+						"name": "kind",
+						"type": "uint8"
+					}
+				],
+				"internalType": "struct ArbitrageExecutor.Hop[]",
+				"name": "hops",
+				"type": "tuple[]"
+			}
+		],
+		"name": "executeArbitrage",
+		"outputs": [
+			{
+				"internalType": "uint256",
+				"name": "amountOut",
+				"type": "uint256"
+			}
+		],
+		"stateMutability": "nonpayable",
+		"type": "function"
 	}
 ]
 `
 )
 
+// 路由合约方法，用于模拟执行时构建 swap calldata
+const (
+	// RouterMethodSwapExactTokensForTokens V2 风格路由的精确输入兑换方法
+	RouterMethodSwapExactTokensForTokens = "swapExactTokensForTokens"
+
+	// RouterMethodExactInputSingle V3 SwapRouter 的单池精确输入兑换方法
+	RouterMethodExactInputSingle = "exactInputSingle"
+)
+
 // 常用地址
 const (
 	// WBNBAddressHex BSC 主网 WBNB 合约地址
 	WBNBAddressHex = "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c"
 
+	// USDTAddressHex BSC 主网 USDT（BEP20，18 位精度）合约地址
+	USDTAddressHex = "0x55d398326f99059fF775485246999027B3197955"
+
+	// BUSDAddressHex BSC 主网 BUSD（18 位精度）合约地址
+	BUSDAddressHex = "0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56"
+
+	// USDCAddressHex BSC 主网 USDC（BEP20，18 位精度）合约地址
+	USDCAddressHex = "0x8AC76a51cc950d9822D68b83fE1Ad97B32Cd580d"
+
+	// TaxProbeRecipientHex 检测转账税时模拟转账的接收地址（普通 EOA 地址，避免命中代币的免税名单）
+	TaxProbeRecipientHex = "0x000000000000000000000000000000000000a11c"
+
+	// SimulationSenderHex 模拟执行时使用的发送者地址，余额通过 state override 注入
+	SimulationSenderHex = "0x000000000000000000000000000000000000517e"
+
+	// PancakeSwapV2RouterHex BSC 主网 PancakeSwap V2 Router 合约地址
+	PancakeSwapV2RouterHex = "0x10ED43C718714eb63d5aA57B78B54704E256024E"
+
+	// PancakeSwapV3RouterHex BSC 主网 PancakeSwap V3 SwapRouter 合约地址
+	PancakeSwapV3RouterHex = "0x1b81D678ffb9C0263b24A97847620C99d213eB14"
+
+	// PancakeSwapV2FactoryHex BSC 主网 PancakeSwap V2 Factory 合约地址
+	PancakeSwapV2FactoryHex = "0xcA143Ce32Fe78f1f7019d7d551a6402fC5350c73"
+
+	// BiswapFactoryHex BSC 主网 Biswap Factory 合约地址
+	BiswapFactoryHex = "0x858E3312ed3A876947EA49d572A7C42DE08af7EE"
+
+	// PancakeSwapV3FactoryHex BSC 主网 PancakeSwap V3 Factory 合约地址
+	PancakeSwapV3FactoryHex = "0x0BFbCF9fa4f9C56B0F40a671Ad40E0805A091865"
+
+	// UniswapV3FactoryHex BSC 主网 Uniswap V3 Factory 合约地址
+	UniswapV3FactoryHex = "0xdB1d10011AD0Ff90774D0C6Bb92e5C5c8b4461F7"
+
 	// UniswapV4PoolManagerHex BSC 主网 Uniswap V4 PoolManager 合约地址（单例架构）
 	// 注意：需要根据实际部署地址更新
 	UniswapV4PoolManagerHex = ""
@@ -224,17 +963,19 @@ const (
 // GetProtocolsConfig 获取协议配置映射
 // 返回配置好的协议映射，key 为 Swap Topic 哈希，value 为协议配置
 // 注意：此函数需要在 ABI 解析完成后调用，因为配置中包含 ABI 指针
-func GetProtocolsConfig(v1ABI, v2ABI, v3ABI *abi.ABI) map[common.Hash]protocolConfig {
+// extra 为配置文件中定义的协议，按 Swap Topic 覆盖内置协议或追加新协议
+// wrapped 为原生币的包装代币地址，V1 交易所持有的原生币一侧以它表示
+func GetProtocolsConfig(wrapped common.Address, v1ABI, v2ABI, v3ABI, balancerABI *abi.ABI, extra ...protocolConfig) map[common.Hash]protocolConfig {
 	configs := map[common.Hash]protocolConfig{}
 
-	wbnbPtr := addressPtr(common.HexToAddress(WBNBAddressHex))
+	wbnbPtr := addressPtr(wrapped)
 
 	// Uniswap V1 (TokenPurchase & EthPurchase)
 	if v1ABI != nil {
 		v1Config := protocolConfig{
 			Name:            ProtocolUniswapV1,
 			ContractABI:     v1ABI,
-			StaticFee:       UniswapV1StaticFee,
+			StaticFeeBps:    UniswapV1StaticFeeBps,
 			FeeFromContract: false,
 			Token0Method:    "tokenAddress",
 			Token1Method:    "",
@@ -256,7 +997,7 @@ func GetProtocolsConfig(v1ABI, v2ABI, v3ABI *abi.ABI) map[common.Hash]protocolCo
 			Name:            ProtocolUniswapV2Like,
 			SwapTopic:       common.HexToHash(UniswapV2SwapTopic),
 			ContractABI:     v2ABI,
-			StaticFee:       UniswapV2StaticFee,
+			StaticFeeBps:    UniswapV2StaticFeeBps,
 			FeeFromContract: false,
 			Token0Method:    "token0",
 			Token1Method:    "token1",
@@ -269,7 +1010,7 @@ func GetProtocolsConfig(v1ABI, v2ABI, v3ABI *abi.ABI) map[common.Hash]protocolCo
 			Name:            ProtocolUniswapV3,
 			SwapTopic:       common.HexToHash(UniswapV3SwapTopic),
 			ContractABI:     v3ABI,
-			StaticFee:       0,
+			StaticFeeBps:    0,
 			FeeFromContract: true,
 			Token0Method:    "token0",
 			Token1Method:    "token1",
@@ -280,16 +1021,50 @@ func GetProtocolsConfig(v1ABI, v2ABI, v3ABI *abi.ABI) map[common.Hash]protocolCo
 			Name:            ProtocolUniswapV4,
 			SwapTopic:       common.HexToHash(UniswapV4SwapTopic),
 			ContractABI:     v3ABI,
-			StaticFee:       0,
+			StaticFeeBps:    0,
 			FeeFromContract: true,
 			Token0Method:    "token0",
 			Token1Method:    "token1",
 		}
 	}
 
+	// Balancer 加权池：Swap 事件由 Vault 发出，代币与费率从 Vault 和池子合约读取
+	if balancerABI != nil {
+		configs[common.HexToHash(BalancerSwapTopic)] = protocolConfig{
+			Name:            ProtocolBalancerWeighted,
+			SwapTopic:       common.HexToHash(BalancerSwapTopic),
+			ContractABI:     balancerABI,
+			StaticFeeBps:    0,
+			FeeFromContract: true,
+		}
+	}
+
+	for _, cfg := range extra {
+		configs[cfg.SwapTopic] = cfg
+	}
+
 	return configs
 }
 
+// factorySpec 受监听工厂合约创建的池子所属协议及默认费率
+type factorySpec struct {
+	// Protocol 协议名称（ProtocolUniswapV2Like 或 ProtocolUniswapV3）
+	Protocol string
+	// FeeBps V2 分叉各自固定的费率（基点）；V3 池子的费率从建池事件或池子合约读取，此处为 0
+	FeeBps int
+}
+
+// GetFactoryProtocols 获取受监听的工厂合约及其创建的池子所属协议与默认费率
+// 返回的映射 key 为工厂合约地址
+func GetFactoryProtocols() map[common.Address]factorySpec {
+	return map[common.Address]factorySpec{
+		common.HexToAddress(PancakeSwapV2FactoryHex): {Protocol: ProtocolUniswapV2Like, FeeBps: PancakeSwapV2StaticFeeBps},
+		common.HexToAddress(BiswapFactoryHex):        {Protocol: ProtocolUniswapV2Like, FeeBps: BiswapStaticFeeBps},
+		common.HexToAddress(PancakeSwapV3FactoryHex): {Protocol: ProtocolUniswapV3},
+		common.HexToAddress(UniswapV3FactoryHex):     {Protocol: ProtocolUniswapV3},
+	}
+}
+
 func addressPtr(addr common.Address) *common.Address {
 	return &addr
 }
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// cycleBoundTolerance 剪枝比较的相对容差，抵消浮点连乘的舍入误差，避免把恰好盈利的环剪掉
+const cycleBoundTolerance = 1e-9
+
+// cycleEdge 池子的一条有向边及其理想兑换率
+type cycleEdge struct {
+	from common.Address
+	to   common.Address
+	rate float64
+}
+
+// cycleGraph 每轮全量枚举开始时从索引构建一次的理想兑换率图：现货价与手续费只在这里计算，
+// 各起点的 cycleBounds 都在它的边列表上逐层递推，不再重复遍历池子；增量模式下随快照中的池子更新
+type cycleGraph struct {
+	edges []cycleEdge
+	// byPool 每个池子的有向边在 edges 中的下标
+	byPool map[common.Address][]int
+	// wrap 包装虚拟池子的两端，没有包装池子时为 nil
+	wrap []common.Address
+}
+
+// newCycleGraph 遍历 index 中全部池子的有向边计算理想兑换率，每 enumerateCheckInterval 条边检查一次 ctx，
+// ctx 取消时返回其错误
+func newCycleGraph(ctx context.Context, index *poolIndex) (*cycleGraph, error) {
+	graph := &cycleGraph{byPool: make(map[common.Address][]int)}
+	checked := 0
+	for _, pools := range index.byToken {
+		for _, pool := range pools {
+			if _, ok := graph.byPool[pool.Address]; ok {
+				continue
+			}
+			graph.upsert(pool)
+			if len(graph.edges)-checked >= enumerateCheckInterval {
+				checked = len(graph.edges)
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+			}
+		}
+	}
+	return graph, nil
+}
+
+// upsert 按池子的当前储备量写入它的全部有向边，已有的边原地更新兑换率；graph 为 nil 时忽略
+func (g *cycleGraph) upsert(pool poolDetail) {
+	if g == nil {
+		return
+	}
+	if pool.Protocol == ProtocolWrapNative {
+		if len(pool.Tokens) == 2 {
+			g.wrap = pool.Tokens
+		}
+		g.byPool[pool.Address] = nil
+		return
+	}
+	if indices, ok := g.byPool[pool.Address]; ok {
+		for _, i := range indices {
+			g.edges[i].rate = hopIdealRate(pool, g.edges[i].from, g.edges[i].to)
+		}
+		return
+	}
+	var indices []int
+	for inIdx, in := range pool.Tokens {
+		for outIdx, out := range pool.Tokens {
+			if outIdx == inIdx || out == in {
+				continue
+			}
+			indices = append(indices, len(g.edges))
+			g.edges = append(g.edges, cycleEdge{from: in, to: out, rate: hopIdealRate(pool, in, out)})
+		}
+	}
+	g.byPool[pool.Address] = indices
+}
+
+// remove 池子退出枚举后把它的边兑换率置 0，不再抬高上界；graph 为 nil 时忽略
+func (g *cycleGraph) remove(address common.Address) {
+	if g == nil {
+		return
+	}
+	for _, i := range g.byPool[address] {
+		g.edges[i].rate = 0
+	}
+}
+
+// cycleBounds 以某个起点代币为终点的乐观完成上界：best[k][t] 为从代币 t 出发、最多再走 k 跳回到起点资产时，
+// 各跳理想兑换率（不考虑滑点）乘积的最大值。计算时不要求池子互不相同，也不考虑转账税，因此只会高估，
+// 用它剪掉的分支不可能包含达到收益门槛的环
+type cycleBounds struct {
+	start   common.Address
+	wrapped common.Address
+	best    []map[common.Address]float64
+	// threshold 乐观完成乘积至少要达到的值：1 + 最小收益占初始投入量的比例
+	threshold float64
+	// walk 为 true 时到达起点资产后路径仍可以继续（findWalks），否则到达即闭环（findArb）
+	walk bool
+	// pruned 被剪掉的分支数，同一个 cycleBounds 只在一个 goroutine 中使用
+	pruned int
+}
+
+// bounds 在图上按跳数逐层计算回到 start 的上界，每层遍历一次全部有向边，每 enumerateCheckInterval 条边检查一次 ctx，
+// ctx 取消时返回其错误；minProfitRatio 为起点的最小收益占初始投入量的比例
+// 包装跳（原生 BNB <-> WBNB）不占用跳数、兑换率为 1，与 findArb 的计数方式一致；以包装跳回到起点资产不算闭环
+func (g *cycleGraph) bounds(ctx context.Context, start, wrapped common.Address, maxHops int, minProfitRatio float64) (*cycleBounds, error) {
+	cb := &cycleBounds{start: start, wrapped: wrapped, threshold: 1 + max(0, minProfitRatio)}
+	if err := g.fill(ctx, cb, maxHops); err != nil {
+		return nil, err
+	}
+	return cb, nil
+}
+
+// walkBounds 为增量模式的 findWalks 计算回到 target 的上界，到达 target 后仍可继续向下搜索；
+// 经过更新池子的环旋转到哪个起点要在找到后才知道，而环的理想兑换率乘积与旋转无关，因此门槛取 1（不计最小收益），只剪掉理想情况下也亏损的分支
+// 包装跳在这里同样不占跳数，比 findWalks 把包装虚拟池子计为一跳更宽松
+func (g *cycleGraph) walkBounds(ctx context.Context, target, wrapped common.Address, maxHops int) (*cycleBounds, error) {
+	cb := &cycleBounds{start: target, wrapped: wrapped, threshold: 1, walk: true}
+	if err := g.fill(ctx, cb, maxHops); err != nil {
+		return nil, err
+	}
+	return cb, nil
+}
+
+// fill 逐层计算 cb.best[0..maxHops]
+func (g *cycleGraph) fill(ctx context.Context, cb *cycleBounds, maxHops int) error {
+	start, wrapped := cb.start, cb.wrapped
+	cb.best = make([]map[common.Address]float64, maxHops+1)
+	cb.best[0] = map[common.Address]float64{}
+	for k := 1; k <= maxHops; k++ {
+		level := make(map[common.Address]float64, len(cb.best[k-1]))
+		for i, edge := range g.edges {
+			if (i+1)%enumerateCheckInterval == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if value := edge.rate * cb.arrive(edge.to, k-1); value > level[edge.from] {
+				level[edge.from] = value
+			}
+		}
+		// 包装跳两端互为一跳之遥且不消耗跳数，取两端的较大值；任一端是起点资产时包装跳不可能出现在可闭合的路径中间，
+		// 但 walk 模式下路径经过起点资产后还能继续，仍然合并
+		if g.wrap != nil {
+			a, b := g.wrap[0], g.wrap[1]
+			if cb.walk || (!sameAsset(a, start, wrapped) && !sameAsset(b, start, wrapped)) {
+				value := max(level[a], level[b])
+				level[a], level[b] = value, value
+			}
+		}
+		cb.best[k] = level
+	}
+	return nil
+}
+
+// arrive 到达 token 且还剩 remaining 跳时的最优完成乘积：到达起点资产即闭环（乘积为 1），否则取 best[remaining]；
+// walk 模式下到达起点资产后还可以继续，取立即闭合与继续搜索两者中的较大值
+func (cb *cycleBounds) arrive(token common.Address, remaining int) float64 {
+	if sameAsset(token, cb.start, cb.wrapped) {
+		if cb.walk {
+			return max(1, cb.best[remaining][token])
+		}
+		return 1
+	}
+	return cb.best[remaining][token]
+}
+
+// promising 判断当前部分路径（理想兑换率乘积 rate）到达 token、还剩 remaining 跳时，乐观完成后是否仍可能达到收益门槛，
+// 不可能时计入 pruned；cb 为 nil 时不剪枝
+func (cb *cycleBounds) promising(rate float64, token common.Address, remaining int) bool {
+	if cb == nil {
+		return true
+	}
+	return cb.check(rate * cb.arrive(token, remaining))
+}
+
+// check 判断乐观完成乘积是否达到 threshold，达不到时计入 pruned
+func (cb *cycleBounds) check(value float64) bool {
+	if value*(1+cycleBoundTolerance) >= cb.threshold {
+		return true
+	}
+	cb.pruned++
+	return false
+}
+
+// hopIdealRate 池子从 from 兑换到 to 的理想兑换率
+func hopIdealRate(pool poolDetail, from, to common.Address) float64 {
+	return idealRate(graphEdge{Pool: pool, Protocol: pool.Protocol, FeePips: pool.FeePipsFrom(from), FromToken: from, ToToken: to})
+}
+
+// idealRate 一跳不考虑滑点的兑换率，是 quoteHopInt 实际输出与输入之比的上界：
+// 按储备量报价的协议为现货价 × (1 - 手续费)，包装跳为 1，按固定比例报价的协议为 1 - 手续费
+func idealRate(step graphEdge) float64 {
+	rate := feeRate(step.FeePips)
+	switch step.Pool.Protocol {
+	case ProtocolWrapNative:
+		return 1
+	case ProtocolUniswapV2Like, ProtocolUniswapV1, ProtocolUniswapV3, ProtocolUniswapV4:
+		return spotPrice(step) * rate
+	case ProtocolBalancerWeighted:
+		if step.Pool.weighted() {
+			return spotPrice(step) * rate
+		}
+	}
+	return rate
+}
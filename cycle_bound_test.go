@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// circleIdealRate 返回套利环各跳理想兑换率的乘积
+func circleIdealRate(circle arbitrageCircle) float64 {
+	rate := 1.0
+	for i, pool := range circle.Route {
+		rate *= idealRate(graphEdge{Pool: pool, Protocol: pool.Protocol, FeePips: pool.FeePipsFrom(circle.Path[i]), FromToken: circle.Path[i], ToToken: circle.Path[i+1]})
+	}
+	return rate
+}
+
+// circleKeys 返回套利环的池子序列，按字典序排列
+func circleKeys(circles []arbitrageCircle) []string {
+	keys := make([]string, 0, len(circles))
+	for _, circle := range circles {
+		pools := make([]string, len(circle.Route))
+		for i, pool := range circle.Route {
+			pools[i] = pool.Address.Hex()
+		}
+		keys = append(keys, strings.Join(pools, ">"))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// circlePathKeys 返回套利环依次经过的代币与池子序列，按字典序排列；多币池中经过同一组池子的不同代币路径键不同
+func circlePathKeys(circles []arbitrageCircle) []string {
+	keys := make([]string, 0, len(circles))
+	for _, circle := range circles {
+		hops := make([]string, 0, len(circle.Route)+len(circle.Path))
+		for i, pool := range circle.Route {
+			hops = append(hops, circle.Path[i].Hex(), pool.Address.Hex())
+		}
+		hops = append(hops, circle.Path[len(circle.Path)-1].Hex())
+		keys = append(keys, strings.Join(hops, ">"))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestCyclesFromPrunesBelowMinProfit 剪枝按最小收益比例比较：理想兑换率乘积达不到 1 + 比例的分支被剪掉并计数，
+// 保留下来的环与不剪枝时达到门槛的环完全相同
+func TestCyclesFromPrunesBelowMinProfit(t *testing.T) {
+	start, tokenB, tokenC := testAddr(1), testAddr(2), testAddr(3)
+	pools := []poolDetail{
+		// start -> pool 11 -> B -> pool 10 -> start 的理想乘积约为 1.1 × 0.997² ≈ 1.093
+		testPool(testAddr(10), start, tokenB, units(1000, 18), units(1000, 18), 30),
+		testPool(testAddr(11), start, tokenB, units(1000, 18), units(1100, 18), 30),
+		testPool(testAddr(12), start, tokenC, units(1000, 18), units(1000, 18), 30),
+		testPool(testAddr(13), tokenC, tokenB, units(1000, 18), units(1000, 18), 30),
+	}
+	tests := []struct {
+		name       string
+		price      float64
+		minProfit  float64
+		capital    float64
+		minWei     *big.Int
+		wantCycle  bool
+		wantPruned bool
+	}{
+		{name: "no threshold keeps the profitable cycle", wantCycle: true, wantPruned: true},
+		{name: "wei threshold below the ideal gain", minWei: units(5, 16), wantCycle: true, wantPruned: true},
+		{name: "wei threshold above the ideal gain", minWei: units(2, 17), wantPruned: true},
+		{name: "usd threshold above the ideal gain", price: 2, capital: 100, minProfit: 20, wantPruned: true},
+		{name: "usd threshold below the ideal gain", price: 2, capital: 100, minProfit: 5, wantCycle: true, wantPruned: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &AppConfig{ArbInitialCapital: tt.capital, ArbMinProfit: tt.minProfit}
+			if tt.minWei != nil {
+				cfg.ArbMinProfitWei = map[common.Address]*big.Int{start: tt.minWei}
+			}
+			af, oracle := newTestFinder(t, cfg)
+			if tt.price > 0 {
+				oracle.prices[start] = tt.price
+			}
+			index := newPoolIndex(pools)
+			graph, err := newCycleGraph(context.Background(), index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var steps, pruned int
+			got := af.cyclesFrom(context.Background(), index, graph, start, 4, &steps, &pruned)
+			var unprunedSteps, unpruned int
+			all := af.cyclesFrom(context.Background(), index, nil, start, 4, &unprunedSteps, &unpruned)
+			if unpruned != 0 {
+				t.Fatalf("不剪枝时计数 %d，期望 0", unpruned)
+			}
+			if (pruned > 0) != tt.wantPruned || (tt.wantPruned && steps >= unprunedSteps) {
+				t.Fatalf("剪枝 %d 个分支、探索 %d 步（不剪枝 %d 步），期望剪枝 %v", pruned, steps, unprunedSteps, tt.wantPruned)
+			}
+
+			threshold := 1 + af.minProfitRatio(start)
+			var want []arbitrageCircle
+			for _, circle := range all {
+				if circleIdealRate(circle) >= threshold {
+					want = append(want, circle)
+				}
+			}
+			gotKeys, wantKeys := circleKeys(got), circleKeys(want)
+			if strings.Join(gotKeys, ",") != strings.Join(wantKeys, ",") {
+				t.Fatalf("剪枝后的环 %v，期望 %v", gotKeys, wantKeys)
+			}
+			if (len(got) > 0) != tt.wantCycle {
+				t.Fatalf("找到 %d 个环，期望找到 %v", len(got), tt.wantCycle)
+			}
+		})
+	}
+}
+
+// TestCycleGraphHonorsContext 构建理想兑换率图与计算上界时检查 ctx，取消后返回错误而不是遍历完全部边
+func TestCycleGraphHonorsContext(t *testing.T) {
+	var pools []poolDetail
+	for i := 0; i < enumerateCheckInterval; i++ {
+		pools = append(pools, testPool(testAddr(100+i), testAddr(1), testAddr(2+i%8), units(1000, 18), units(1000, 18), 30))
+	}
+	index := newPoolIndex(pools)
+	live, err := newCycleGraph(context.Background(), index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		run     func(ctx context.Context) error
+		ctx     context.Context
+		wantErr bool
+	}{
+		{name: "graph with live context", ctx: context.Background(), run: func(ctx context.Context) error { _, err := newCycleGraph(ctx, index); return err }},
+		{name: "graph with cancelled context", ctx: cancelled, wantErr: true, run: func(ctx context.Context) error { _, err := newCycleGraph(ctx, index); return err }},
+		{name: "bounds with live context", ctx: context.Background(), run: func(ctx context.Context) error {
+			_, err := live.bounds(ctx, testAddr(1), common.Address{}, 3, 0)
+			return err
+		}},
+		{name: "bounds with cancelled context", ctx: cancelled, wantErr: true, run: func(ctx context.Context) error {
+			_, err := live.bounds(ctx, testAddr(1), common.Address{}, 3, 0)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(tt.ctx); (err != nil) != tt.wantErr {
+				t.Fatalf("返回 %v，期望出错 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// boundTestPools start/B 两个池子构成一正一反的两池环，start/C、C/B 与它们构成一正一反的三角环
+func boundTestPools() []poolDetail {
+	start, tokenB, tokenC := testAddr(1), testAddr(2), testAddr(3)
+	return []poolDetail{
+		testPool(testAddr(10), start, tokenB, units(1000, 18), units(1000, 18), 30),
+		testPool(testAddr(11), start, tokenB, units(1000, 18), units(1100, 18), 30),
+		testPool(testAddr(12), start, tokenC, units(1000, 18), units(1000, 18), 30),
+		testPool(testAddr(13), tokenC, tokenB, units(1000, 18), units(1000, 18), 30),
+	}
+}
+
+// denseTestPools 四个代币两两之间各有三个价格不同的池子，另有一个包含前三个代币的多币池，
+// 两池环、三角环都有盈利与亏损两种，用于比较不同的枚举实现
+func denseTestPools() []poolDetail {
+	tokens := []common.Address{testAddr(1), testAddr(2), testAddr(3), testAddr(4)}
+	var pools []poolDetail
+	n := 0
+	for i := range tokens {
+		for j := i + 1; j < len(tokens); j++ {
+			pools = append(pools,
+				testPool(testAddr(100+3*n), tokens[i], tokens[j], units(1000, 18), units(1000, 18), 30),
+				testPool(testAddr(101+3*n), tokens[i], tokens[j], units(1000, 18), units(int64(1000+40*(n+1)), 18), 25),
+				testPool(testAddr(102+3*n), tokens[i], tokens[j], units(int64(1000+25*(n+1)), 18), units(1000, 18), 5))
+			n++
+		}
+	}
+	multi := testPool(testAddr(200), tokens[0], tokens[1], units(1000, 18), units(1000, 18), 4)
+	multi.Tokens = append(multi.Tokens, tokens[2])
+	multi.Reserves = append(multi.Reserves, units(1000, 18))
+	multi.Protocol = ProtocolBalancerWeighted
+	return append(pools, multi)
+}
+
+// poolTokens 返回池子涉及的全部代币，按地址排序
+func poolTokens(pools []poolDetail) []common.Address {
+	set := make(map[common.Address]struct{})
+	for _, pool := range pools {
+		for _, token := range pool.Tokens {
+			set[token] = struct{}{}
+		}
+	}
+	return sortedAddresses(set)
+}
+
+// reusesPool 判断套利环是否重复使用了同一个池子
+func reusesPool(circle arbitrageCircle) bool {
+	seen := make(map[common.Address]struct{}, len(circle.Route))
+	for _, pool := range circle.Route {
+		if _, ok := seen[pool.Address]; ok {
+			return true
+		}
+		seen[pool.Address] = struct{}{}
+	}
+	return false
+}
+
+// TestFastPathsPruneLikeFindArb 两跳、三跳的快速枚举与 findArb 使用同样的剪枝上界：不剪枝时找到的环与 findArb 相同，
+// 剪枝后只保留理想兑换率乘积达到门槛的环，池子不重复使用
+func TestFastPathsPruneLikeFindArb(t *testing.T) {
+	start := testAddr(1)
+	tests := []struct {
+		name    string
+		maxHops int
+		minWei  *big.Int
+	}{
+		{name: "two hops without threshold", maxHops: 2},
+		{name: "two hops above the ideal gain", maxHops: 2, minWei: units(2, 17)},
+		{name: "three hops without threshold", maxHops: 3},
+		{name: "three hops below the ideal gain", maxHops: 3, minWei: units(5, 16)},
+		{name: "three hops above the ideal gain", maxHops: 3, minWei: units(2, 17)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &AppConfig{}
+			if tt.minWei != nil {
+				cfg.ArbMinProfitWei = map[common.Address]*big.Int{start: tt.minWei}
+			}
+			af, _ := newTestFinder(t, cfg)
+			index := newPoolIndex(boundTestPools())
+			graph, err := newCycleGraph(context.Background(), index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var steps, pruned int
+			got := af.cyclesFrom(context.Background(), index, graph, start, tt.maxHops, &steps, &pruned)
+			var fastSteps, fastPruned int
+			fast := af.cyclesFrom(context.Background(), index, nil, start, tt.maxHops, &fastSteps, &fastPruned)
+			var reference []arbitrageCircle
+			var referenceSteps int
+			af.findArb(context.Background(), index, start, start, tt.maxHops, nil, []common.Address{start}, map[common.Address]struct{}{}, 1, nil, &reference, &referenceSteps)
+
+			if fastKeys, referenceKeys := circleKeys(fast), circleKeys(reference); strings.Join(fastKeys, ",") != strings.Join(referenceKeys, ",") {
+				t.Fatalf("不剪枝时快速枚举找到 %v，findArb 找到 %v", fastKeys, referenceKeys)
+			}
+			threshold := 1 + af.minProfitRatio(start)
+			var want []arbitrageCircle
+			for _, circle := range reference {
+				if circleIdealRate(circle) >= threshold {
+					want = append(want, circle)
+				}
+			}
+			if gotKeys, wantKeys := circleKeys(got), circleKeys(want); strings.Join(gotKeys, ",") != strings.Join(wantKeys, ",") {
+				t.Fatalf("剪枝后的环 %v，期望 %v", gotKeys, wantKeys)
+			}
+			if len(want) < len(reference) && (pruned == 0 || steps >= fastSteps) {
+				t.Fatalf("剪枝 %d 个分支、探索 %d 步（不剪枝 %d 步），期望剪掉达不到门槛的分支", pruned, steps, fastSteps)
+			}
+			for _, circle := range got {
+				if reusesPool(circle) {
+					t.Fatalf("环 %v 重复使用了池子", circleKeys([]arbitrageCircle{circle}))
+				}
+			}
+		})
+	}
+}
+
+// TestCyclesThroughPrunes 增量搜索按快照理想兑换率图剪枝：保留的环与不剪枝时理想乘积达到 1 的环相同，
+// 快照图随池子更新同步，之前的增量评估更新过的池子不会按旧储备量剪枝
+func TestCyclesThroughPrunes(t *testing.T) {
+	start, tokenB := testAddr(1), testAddr(2)
+	tests := []struct {
+		name    string
+		maxHops int
+		native  bool
+		// earlier 之前的增量评估已应用的更新，只写入快照，不参与本次搜索
+		earlier []PoolUpdated
+		updates []PoolUpdated
+		// wantCircle 剪枝后必须找到的环（池子序列），为空时不检查
+		wantCircle string
+	}{
+		{name: "three hops", maxHops: 3, updates: []PoolUpdated{{Address: testAddr(13), Reserves: []*big.Int{units(1000, 18), units(1000, 18)}}}},
+		{name: "four hops", maxHops: 4, updates: []PoolUpdated{{Address: testAddr(13), Reserves: []*big.Int{units(1000, 18), units(1000, 18)}}}},
+		{
+			name:       "earlier update makes a triangle profitable",
+			maxHops:    3,
+			earlier:    []PoolUpdated{{Address: testAddr(12), Reserves: []*big.Int{units(1000, 18), units(1300, 18)}}},
+			updates:    []PoolUpdated{{Address: testAddr(13), Reserves: []*big.Int{units(1000, 18), units(1000, 18)}}},
+			wantCircle: strings.Join([]string{testAddr(12).Hex(), testAddr(13).Hex(), testAddr(10).Hex()}, ">"),
+		},
+		{name: "native pool with wrap hop", maxHops: 4, native: true, updates: []PoolUpdated{{Address: testAddr(14), Reserves: []*big.Int{units(1000, 18), units(1200, 18)}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &AppConfig{}
+			pools := boundTestPools()
+			if tt.native {
+				cfg.WrappedNative = start
+				pools = append(pools, testPool(testAddr(14), nativeToken, tokenB, units(1000, 18), units(1000, 18), 30), wrapNativePool(start))
+			}
+			af, _ := newTestFinder(t, cfg)
+			index := newPoolIndex(pools)
+			af.snapshot = newFinderSnapshot(index, pools, nil, tt.maxHops, false)
+			graph, err := newCycleGraph(context.Background(), index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			af.snapshot.graph = graph
+
+			for _, update := range tt.earlier {
+				if _, ok := af.applyPoolUpdate(context.Background(), update); !ok {
+					t.Fatalf("池子 %s 更新后不再参与枚举", update.Address.Hex())
+				}
+			}
+			var affected []poolDetail
+			for _, update := range tt.updates {
+				pool, ok := af.applyPoolUpdate(context.Background(), update)
+				if !ok {
+					t.Fatalf("池子 %s 更新后不再参与枚举", update.Address.Hex())
+				}
+				affected = append(affected, pool)
+			}
+			got, pruned := af.cyclesThrough(context.Background(), affected)
+			af.snapshot.graph = nil
+			all, unpruned := af.cyclesThrough(context.Background(), affected)
+			if unpruned != 0 {
+				t.Fatalf("不剪枝时计数 %d，期望 0", unpruned)
+			}
+
+			var want []arbitrageCircle
+			for _, circle := range all {
+				if circleIdealRate(circle)*(1+cycleBoundTolerance) >= 1 {
+					want = append(want, circle)
+				}
+			}
+			gotKeys, wantKeys := circleKeys(got), circleKeys(want)
+			if strings.Join(gotKeys, ",") != strings.Join(wantKeys, ",") {
+				t.Fatalf("剪枝后的环 %v，期望 %v", gotKeys, wantKeys)
+			}
+			if len(want) < len(all) && pruned == 0 {
+				t.Fatalf("不剪枝时有 %d 个环达不到门槛，但没有剪掉任何分支", len(all)-len(want))
+			}
+			if tt.wantCircle != "" && !strings.Contains(strings.Join(gotKeys, ","), tt.wantCircle) {
+				t.Fatalf("剪枝后的环 %v 缺少 %s", gotKeys, tt.wantCircle)
+			}
+			for _, circle := range got {
+				if reusesPool(circle) {
+					t.Fatalf("环 %v 重复使用了池子", circleKeys([]arbitrageCircle{circle}))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// maxBalanceSlotProbe 探测 ERC20 余额 mapping 存储槽时尝试的最大槽位
+const maxBalanceSlotProbe = 20
+
+// simulationDeadline 模拟交易的 deadline 相对当前时间的偏移
+const simulationDeadline = time.Hour
+
+// routerConfig 协议对应的路由合约配置
+type routerConfig struct {
+	Address common.Address
+	// Method 路由方法，swapExactTokensForTokens 或 exactInputSingle
+	Method string
+}
+
+// ExecutionSimulator 通过 eth_simulateV1 在最新状态上模拟执行套利路径
+// 发送者的起始代币余额通过覆盖 ERC20 余额存储槽注入
+//
+// V2 风格的跳直接在路径中的池子上执行：把输入代币转入池子，按池子实际到账数量与储备量计算输出后调用 pair.swap，
+// 与套利合约的执行方式一致；路由合约会按代币对在自身工厂中选择池子，未必是发现套利时使用的池子
+// 其他协议（V3）每一跳依次执行 approve + EXEC_ROUTERS 中配置的路由 swap
+type ExecutionSimulator struct {
+	client       *ethclient.Client
+	cfg          *AppConfig
+	sender       common.Address
+	erc20ABI     abi.ABI
+	routerABI    abi.ABI
+	pairABI      abi.ABI
+	balanceSlots sync.Map // common.Address -> uint64
+}
+
+// NewExecutionSimulator 创建模拟执行器
+func NewExecutionSimulator(client *ethclient.Client, cfg *AppConfig) (*ExecutionSimulator, error) {
+	routerABI, err := abi.JSON(strings.NewReader(RouterABIJSON))
+	if err != nil {
+		return nil, fmt.Errorf("解析路由 ABI 失败: %w", err)
+	}
+	pairABI, err := abi.JSON(strings.NewReader(PairABIJSON))
+	if err != nil {
+		return nil, fmt.Errorf("解析 Pair ABI 失败: %w", err)
+	}
+	return &ExecutionSimulator{
+		client:    client,
+		cfg:       cfg,
+		sender:    common.HexToAddress(SimulationSenderHex),
+		erc20ABI:  erc20ABI,
+		routerABI: routerABI,
+		pairABI:   pairABI,
+	}, nil
+}
+
+// SimulateExecution 模拟执行套利路径，返回最终得到的起始代币数量
+// 某一跳回滚时返回的错误中包含回滚原因
+func (es *ExecutionSimulator) SimulateExecution(ctx context.Context, op ArbitrageOpportunity) (*big.Int, error) {
+	if len(op.Path) == 0 {
+		return nil, fmt.Errorf("套利路径为空")
+	}
+
+	amountIn, _ := new(big.Float).SetFloat64(op.InitialAmount).Int(nil)
+	if amountIn.Sign() <= 0 {
+		return nil, fmt.Errorf("初始数量非法: %.6f", op.InitialAmount)
+	}
+	// 路由合约的 ERC20 兑换无法直接处理原生 BNB，包装/解包只能由套利合约执行
+	for _, step := range op.Path {
+		if step.Protocol == ProtocolWrapNative || common.HexToAddress(step.FromToken) == nativeToken || common.HexToAddress(step.ToToken) == nativeToken {
+			return nil, fmt.Errorf("模拟执行不支持经过原生 BNB 的路径")
+		}
+	}
+
+	startToken := common.HexToAddress(op.StartToken)
+	slot, err := es.balanceSlot(ctx, startToken)
+	if err != nil {
+		return nil, err
+	}
+	overrides := map[common.Address]simulateAccountOverride{
+		startToken: {StateDiff: map[common.Hash]common.Hash{
+			balanceStorageKey(es.sender, slot): common.BigToHash(amountIn),
+		}},
+	}
+
+	deadline := big.NewInt(time.Now().Add(simulationDeadline).Unix())
+	amount := amountIn
+	var calls []simulateCall
+	// 每一跳的输入依赖上一跳的实际输出，因此逐跳追加调用并重新模拟整个前缀
+	for idx, step := range op.Path {
+		if step.Protocol == ProtocolUniswapV2Like {
+			calls, amount, err = es.appendPairSwap(ctx, overrides, calls, step, amount)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 跳: %w", idx+1, err)
+			}
+			continue
+		}
+
+		router, ok := es.cfg.ExecRouters[step.Protocol]
+		if !ok {
+			return nil, fmt.Errorf("协议 %s 未配置路由合约", step.Protocol)
+		}
+
+		fromToken := common.HexToAddress(step.FromToken)
+		approveData, err := es.erc20ABI.Pack("approve", router.Address, amount)
+		if err != nil {
+			return nil, err
+		}
+		swapData, err := es.packSwap(router, step, amount, deadline)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls,
+			simulateCall{From: &es.sender, To: fromToken, Data: approveData},
+			simulateCall{From: &es.sender, To: router.Address, Data: swapData},
+		)
+
+		results, err := es.simulate(ctx, overrides, calls)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSimulated(results); err != nil {
+			return nil, fmt.Errorf("第 %d 跳: %w", idx+1, err)
+		}
+
+		amount, err = es.unpackSwapOutput(router.Method, results[len(results)-1].ReturnData)
+		if err != nil {
+			return nil, fmt.Errorf("解析第 %d 跳输出失败: %w", idx+1, err)
+		}
+	}
+	return amount, nil
+}
+
+// appendPairSwap 在 calls 之后追加直接与 V2 池子交互的一跳，返回追加后的调用序列与本跳发送者实际收到的输出代币数量
+// 先把 amount 转入池子并读取储备量与池子余额，以余额减储备量作为实际输入（扣除转账税后）按 getAmountOut 计算输出，
+// 再调用 swap 把输出发给发送者；本跳输出取发送者 swap 前后的余额差
+func (es *ExecutionSimulator) appendPairSwap(ctx context.Context, overrides map[common.Address]simulateAccountOverride, calls []simulateCall, step ArbitrageStep, amount *big.Int) ([]simulateCall, *big.Int, error) {
+	pool := step.Pool.Address
+	fromToken := common.HexToAddress(step.FromToken)
+	toToken := common.HexToAddress(step.ToToken)
+	transferData, err := es.erc20ABI.Pack("transfer", pool, amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	reservesData, err := es.pairABI.Pack("getReserves")
+	if err != nil {
+		return nil, nil, err
+	}
+	poolBalanceData, err := es.erc20ABI.Pack("balanceOf", pool)
+	if err != nil {
+		return nil, nil, err
+	}
+	senderBalanceData, err := es.erc20ABI.Pack("balanceOf", es.sender)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	calls = append(calls,
+		simulateCall{From: &es.sender, To: fromToken, Data: transferData},
+		simulateCall{To: pool, Data: reservesData},
+		simulateCall{To: fromToken, Data: poolBalanceData},
+		simulateCall{To: toToken, Data: senderBalanceData},
+	)
+	results, err := es.simulate(ctx, overrides, calls)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkSimulated(results); err != nil {
+		return nil, nil, err
+	}
+	n := len(results)
+	reserves, err := es.pairABI.Unpack("getReserves", results[n-3].ReturnData)
+	if err != nil || len(reserves) != 3 {
+		return nil, nil, fmt.Errorf("解析池子 %s 储备量失败: %v", pool.Hex(), err)
+	}
+	poolBalance, err := decodeSimulatedBalance(results[n-2])
+	if err != nil {
+		return nil, nil, err
+	}
+	balanceBefore, err := decodeSimulatedBalance(results[n-1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reserve0, _ := reserves[0].(*big.Int)
+	reserve1, _ := reserves[1].(*big.Int)
+	if reserve0 == nil || reserve1 == nil {
+		return nil, nil, fmt.Errorf("池子 %s 储备量类型异常", pool.Hex())
+	}
+	reserveIn, reserveOut := reserve0, reserve1
+	zeroForOne := fromToken == step.Pool.Token0()
+	if !zeroForOne {
+		reserveIn, reserveOut = reserve1, reserve0
+	}
+	amountIn := new(big.Int).Sub(poolBalance, reserveIn)
+	amountOut := getAmountOut(amountIn, reserveIn, reserveOut, step.FeePips)
+	if amountOut == nil || amountOut.Sign() <= 0 {
+		return nil, nil, fmt.Errorf("池子 %s 实际输入 %s 的输出为 0", pool.Hex(), amountIn)
+	}
+	amount0Out, amount1Out := big.NewInt(0), amountOut
+	if !zeroForOne {
+		amount0Out, amount1Out = amountOut, big.NewInt(0)
+	}
+	swapData, err := es.pairABI.Pack("swap", amount0Out, amount1Out, es.sender, []byte{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	calls = append(calls,
+		simulateCall{From: &es.sender, To: pool, Data: swapData},
+		simulateCall{To: toToken, Data: senderBalanceData},
+	)
+	results, err = es.simulate(ctx, overrides, calls)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkSimulated(results); err != nil {
+		return nil, nil, err
+	}
+	balanceAfter, err := decodeSimulatedBalance(results[len(results)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return calls, new(big.Int).Sub(balanceAfter, balanceBefore), nil
+}
+
+// checkSimulated 任一调用回滚时返回带回滚原因的错误
+func checkSimulated(results []simulateCallResult) error {
+	for callIdx, result := range results {
+		if result.Status == 0 {
+			return fmt.Errorf("模拟第 %d 个调用回滚: %s", callIdx+1, revertReason(result))
+		}
+	}
+	return nil
+}
+
+// packSwap 按路由方法构建单跳 swap calldata，输出代币发送回模拟发送者
+func (es *ExecutionSimulator) packSwap(router routerConfig, step ArbitrageStep, amountIn, deadline *big.Int) ([]byte, error) {
+	fromToken := common.HexToAddress(step.FromToken)
+	toToken := common.HexToAddress(step.ToToken)
+
+	switch router.Method {
+	case RouterMethodSwapExactTokensForTokens:
+		return es.routerABI.Pack(router.Method, amountIn, big.NewInt(0), []common.Address{fromToken, toToken}, es.sender, deadline)
+	case RouterMethodExactInputSingle:
+		params := struct {
+			TokenIn           common.Address
+			TokenOut          common.Address
+			Fee               *big.Int
+			Recipient         common.Address
+			Deadline          *big.Int
+			AmountIn          *big.Int
+			AmountOutMinimum  *big.Int
+			SqrtPriceLimitX96 *big.Int
+		}{
+			TokenIn:   fromToken,
+			TokenOut:  toToken,
+			Fee:       big.NewInt(int64(step.FeePips)),
+			Recipient: es.sender,
+			Deadline:  deadline,
+			AmountIn:  amountIn,
+			// 模拟只关心实际输出，不设置滑点与价格限制
+			AmountOutMinimum:  big.NewInt(0),
+			SqrtPriceLimitX96: big.NewInt(0),
+		}
+		return es.routerABI.Pack(router.Method, params)
+	default:
+		return nil, fmt.Errorf("不支持的路由方法: %s", router.Method)
+	}
+}
+
+// unpackSwapOutput 解析路由 swap 的返回值，得到本跳输出数量
+func (es *ExecutionSimulator) unpackSwapOutput(method string, data []byte) (*big.Int, error) {
+	values, err := es.routerABI.Unpack(method, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 1 {
+		return nil, fmt.Errorf("unexpected %s return length %d", method, len(values))
+	}
+
+	switch v := values[0].(type) {
+	case *big.Int:
+		return v, nil
+	case []*big.Int:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("%s 返回的 amounts 为空", method)
+		}
+		return v[len(v)-1], nil
+	default:
+		return nil, fmt.Errorf("unexpected %s return type %T", method, values[0])
+	}
+}
+
+// simulate 在单个模拟区块内依次执行 calls
+func (es *ExecutionSimulator) simulate(ctx context.Context, overrides map[common.Address]simulateAccountOverride, calls []simulateCall) ([]simulateCallResult, error) {
+	callCtx, cancel := withRPCTimeout(ctx, es.cfg.RPCCallTimeout)
+	defer cancel()
+
+	opts := simulateOpts{
+		BlockStateCalls: []simulateBlock{{
+			StateOverrides: overrides,
+			Calls:          calls,
+		}},
+	}
+	var result []simulateBlockResult
+	if err := es.client.Client().CallContext(callCtx, &result, "eth_simulateV1", opts, "latest"); err != nil {
+		return nil, fmt.Errorf("eth_simulateV1 调用失败: %w", err)
+	}
+	if len(result) != 1 || len(result[0].Calls) != len(calls) {
+		return nil, fmt.Errorf("eth_simulateV1 返回结构异常")
+	}
+	return result[0].Calls, nil
+}
+
+// balanceSlot 探测代币余额 mapping 所在的存储槽（Solidity 布局 keccak256(holder, slot)），结果按代币缓存
+// 做法是逐个槽位覆盖一个特征值，再通过 eth_call 查询 balanceOf 是否返回该值
+func (es *ExecutionSimulator) balanceSlot(ctx context.Context, token common.Address) (uint64, error) {
+	if slot, ok := es.balanceSlots.Load(token); ok {
+		return slot.(uint64), nil
+	}
+
+	balanceData, err := es.erc20ABI.Pack("balanceOf", es.sender)
+	if err != nil {
+		return 0, err
+	}
+	marker := new(big.Int).SetUint64(0x5eed5eed5eed)
+	call := simulateCall{To: token, Data: balanceData}
+
+	for slot := uint64(0); slot <= maxBalanceSlotProbe; slot++ {
+		overrides := map[common.Address]simulateAccountOverride{
+			token: {StateDiff: map[common.Hash]common.Hash{
+				balanceStorageKey(es.sender, slot): common.BigToHash(marker),
+			}},
+		}
+
+		callCtx, cancel := withRPCTimeout(ctx, es.cfg.RPCCallTimeout)
+		var result hexutil.Bytes
+		err := es.client.Client().CallContext(callCtx, &result, "eth_call", call, "latest", overrides)
+		cancel()
+		if err != nil {
+			return 0, fmt.Errorf("探测代币 %s 余额存储槽失败: %w", token.Hex(), err)
+		}
+		if new(big.Int).SetBytes(result).Cmp(marker) == 0 {
+			es.balanceSlots.Store(token, slot)
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("未找到代币 %s 的余额存储槽", token.Hex())
+}
+
+// balanceStorageKey 计算 Solidity mapping(address => uint256) 中 holder 对应的存储位置
+func balanceStorageKey(holder common.Address, slot uint64) common.Hash {
+	return crypto.Keccak256Hash(
+		common.LeftPadBytes(holder.Bytes(), 32),
+		common.LeftPadBytes(new(big.Int).SetUint64(slot).Bytes(), 32),
+	)
+}
+
+// revertReason 从模拟结果中提取回滚原因
+func revertReason(result simulateCallResult) string {
+	if reason, err := abi.UnpackRevert(result.ReturnData); err == nil {
+		return reason
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return result.Error.Message
+	}
+	if len(result.ReturnData) > 0 {
+		return result.ReturnData.String()
+	}
+	return "未知原因"
+}
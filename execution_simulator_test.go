@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// mockPair 模拟 UniswapV2 Pair：swap 按余额与储备量之差计算输入，并按 feeBps 校验恒定乘积
+type mockPair struct {
+	token0, token1     common.Address
+	reserve0, reserve1 *big.Int
+	feeBps             int64
+}
+
+// mockDex 模拟执行需要的链上状态：ERC20 余额（余额 mapping 位于存储槽 0）与若干 V2 池子
+type mockDex struct {
+	sender   common.Address
+	balances map[common.Address]map[common.Address]*big.Int // token -> holder -> balance
+	pairs    map[common.Address]*mockPair
+}
+
+func (d *mockDex) clone() *mockDex {
+	c := &mockDex{sender: d.sender, balances: map[common.Address]map[common.Address]*big.Int{}, pairs: map[common.Address]*mockPair{}}
+	for token, holders := range d.balances {
+		c.balances[token] = map[common.Address]*big.Int{}
+		for holder, balance := range holders {
+			c.balances[token][holder] = new(big.Int).Set(balance)
+		}
+	}
+	for address, pair := range d.pairs {
+		p := *pair
+		p.reserve0, p.reserve1 = new(big.Int).Set(pair.reserve0), new(big.Int).Set(pair.reserve1)
+		c.pairs[address] = &p
+	}
+	return c
+}
+
+func (d *mockDex) balance(token, holder common.Address) *big.Int {
+	if b := d.balances[token][holder]; b != nil {
+		return b
+	}
+	return new(big.Int)
+}
+
+func (d *mockDex) mint(token, holder common.Address, amount *big.Int) {
+	if d.balances[token] == nil {
+		d.balances[token] = map[common.Address]*big.Int{}
+	}
+	d.balances[token][holder] = new(big.Int).Add(d.balance(token, holder), amount)
+}
+
+func (d *mockDex) move(token, from, to common.Address, amount *big.Int) bool {
+	if d.balance(token, from).Cmp(amount) < 0 {
+		return false
+	}
+	if d.balances[token] == nil {
+		d.balances[token] = map[common.Address]*big.Int{}
+	}
+	d.balances[token][from] = new(big.Int).Sub(d.balance(token, from), amount)
+	d.balances[token][to] = new(big.Int).Add(d.balance(token, to), amount)
+	return true
+}
+
+// applyOverrides 把覆盖到发送者余额存储槽（槽 0）的值写入余额
+func (d *mockDex) applyOverrides(overrides map[common.Address]simulateAccountOverride) {
+	for token, override := range overrides {
+		if value, ok := override.StateDiff[balanceStorageKey(d.sender, 0)]; ok {
+			if d.balances[token] == nil {
+				d.balances[token] = map[common.Address]*big.Int{}
+			}
+			d.balances[token][d.sender] = value.Big()
+		}
+	}
+}
+
+func (d *mockDex) call(pairABI abi.ABI, from *common.Address, to common.Address, data []byte) (hexutil.Bytes, bool, error) {
+	if pair, ok := d.pairs[to]; ok {
+		method, err := pairABI.MethodById(data[:4])
+		if err != nil {
+			return nil, false, err
+		}
+		switch method.Name {
+		case "getReserves":
+			out, err := method.Outputs.Pack(pair.reserve0, pair.reserve1, uint32(0))
+			return out, err == nil, err
+		case "swap":
+			args, err := method.Inputs.Unpack(data[4:])
+			if err != nil {
+				return nil, false, err
+			}
+			out0, out1, recipient := args[0].(*big.Int), args[1].(*big.Int), args[2].(common.Address)
+			if !d.move(pair.token0, to, recipient, out0) || !d.move(pair.token1, to, recipient, out1) {
+				return nil, false, nil
+			}
+			bal0, bal1 := d.balance(pair.token0, to), d.balance(pair.token1, to)
+			in0 := new(big.Int).Sub(bal0, new(big.Int).Sub(pair.reserve0, out0))
+			in1 := new(big.Int).Sub(bal1, new(big.Int).Sub(pair.reserve1, out1))
+			adj0 := new(big.Int).Sub(new(big.Int).Mul(bal0, big.NewInt(10000)), new(big.Int).Mul(in0.Abs(in0), big.NewInt(pair.feeBps)))
+			adj1 := new(big.Int).Sub(new(big.Int).Mul(bal1, big.NewInt(10000)), new(big.Int).Mul(in1.Abs(in1), big.NewInt(pair.feeBps)))
+			k := new(big.Int).Mul(new(big.Int).Mul(pair.reserve0, pair.reserve1), big.NewInt(100_000_000))
+			if new(big.Int).Mul(adj0, adj1).Cmp(k) < 0 {
+				return nil, false, nil // K
+			}
+			pair.reserve0, pair.reserve1 = bal0, bal1
+			return nil, true, nil
+		}
+		return nil, false, fmt.Errorf("unexpected pair method %s", method.Name)
+	}
+
+	method, err := erc20ABI.MethodById(data[:4])
+	if err != nil {
+		return nil, false, err
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, false, err
+	}
+	switch method.Name {
+	case "balanceOf":
+		out, err := method.Outputs.Pack(d.balance(to, args[0].(common.Address)))
+		return out, err == nil, err
+	case "transfer":
+		return nil, d.move(to, *from, args[0].(common.Address), args[1].(*big.Int)), nil
+	}
+	return nil, false, fmt.Errorf("unexpected erc20 method %s", method.Name)
+}
+
+// mockDexEth 提供 eth_call（带状态覆盖）与 eth_simulateV1
+type mockDexEth struct {
+	dex     *mockDex
+	pairABI abi.ABI
+}
+
+func (s *mockDexEth) Call(args mockCallArgs, block string, overrides *map[common.Address]simulateAccountOverride) (hexutil.Bytes, error) {
+	state := s.dex.clone()
+	if overrides != nil {
+		state.applyOverrides(*overrides)
+	}
+	out, _, err := state.call(s.pairABI, args.From, *args.To, args.calldata())
+	return out, err
+}
+
+func (s *mockDexEth) SimulateV1(opts simulateOpts, block string) ([]simulateBlockResult, error) {
+	state := s.dex.clone()
+	state.applyOverrides(opts.BlockStateCalls[0].StateOverrides)
+	var results []simulateCallResult
+	for _, call := range opts.BlockStateCalls[0].Calls {
+		out, ok, err := state.call(s.pairABI, call.From, call.To, call.Data)
+		if err != nil {
+			return nil, err
+		}
+		status := hexutil.Uint64(0)
+		if ok {
+			status = 1
+		}
+		results = append(results, simulateCallResult{ReturnData: out, Status: status})
+	}
+	return []simulateBlockResult{{Calls: results}}, nil
+}
+
+func newMockSimulator(t *testing.T, dex *mockDex) *ExecutionSimulator {
+	t.Helper()
+	pairABI, err := abi.JSON(strings.NewReader(PairABIJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &mockDexEth{dex: dex, pairABI: pairABI}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	client := ethclient.NewClient(rpc.DialInProc(server))
+	t.Cleanup(client.Close)
+	simulator, err := NewExecutionSimulator(client, &AppConfig{RPCCallTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return simulator
+}
+
+// TestSimulateExecutionUsesPathPools V2 跳直接在路径给出的池子上成交：同一代币对存在更深的池子时，
+// 结果仍按路径中的池子计算，而不是由路由按代币对另选池子
+func TestSimulateExecutionUsesPathPools(t *testing.T) {
+	sender := common.HexToAddress(SimulationSenderHex)
+	tokenA, tokenB := testAddr(1), testAddr(2)
+	shallowAB, deepAB := testAddr(100), testAddr(101)
+
+	newDex := func() *mockDex {
+		dex := &mockDex{sender: sender, balances: map[common.Address]map[common.Address]*big.Int{}, pairs: map[common.Address]*mockPair{
+			shallowAB: {token0: tokenA, token1: tokenB, reserve0: units(100, 18), reserve1: units(210, 18), feeBps: 25},
+			deepAB:    {token0: tokenA, token1: tokenB, reserve0: units(10_000, 18), reserve1: units(20_000, 18), feeBps: 25},
+		}}
+		// 池子持有的代币余额与储备量一致
+		for address, pair := range dex.pairs {
+			dex.mint(pair.token0, address, pair.reserve0)
+			dex.mint(pair.token1, address, pair.reserve1)
+		}
+		return dex
+	}
+	step := func(pool common.Address, from, to common.Address) ArbitrageStep {
+		dex := newDex()
+		p := dex.pairs[pool]
+		return ArbitrageStep{
+			Pool:      testPool(pool, p.token0, p.token1, p.reserve0, p.reserve1, int(p.feeBps)),
+			FromToken: from.Hex(),
+			ToToken:   to.Hex(),
+			Protocol:  ProtocolUniswapV2Like,
+			FeePips:   feeBpsToPips(int(p.feeBps)),
+		}
+	}
+
+	amountIn := units(1, 18)
+	tests := []struct {
+		name string
+		path []ArbitrageStep
+		want func() *big.Int
+	}{
+		{
+			name: "token0 to token1 on shallow pool",
+			path: []ArbitrageStep{step(shallowAB, tokenA, tokenB)},
+			want: func() *big.Int { return getAmountOut(amountIn, units(100, 18), units(210, 18), 2500) },
+		},
+		{
+			name: "token1 to token0 on deep pool",
+			path: []ArbitrageStep{step(deepAB, tokenB, tokenA)},
+			want: func() *big.Int { return getAmountOut(amountIn, units(20_000, 18), units(10_000, 18), 2500) },
+		},
+		{
+			name: "two hops across both pools",
+			path: []ArbitrageStep{step(shallowAB, tokenA, tokenB), step(deepAB, tokenB, tokenA)},
+			want: func() *big.Int {
+				mid := getAmountOut(amountIn, units(100, 18), units(210, 18), 2500)
+				return getAmountOut(mid, units(20_000, 18), units(10_000, 18), 2500)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := newMockSimulator(t, newDex())
+			initial, _ := new(big.Float).SetInt(amountIn).Float64()
+			got, err := simulator.SimulateExecution(context.Background(), ArbitrageOpportunity{
+				Path:          tt.path,
+				StartToken:    tt.path[0].FromToken,
+				InitialAmount: initial,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.want(); got.Cmp(want) != 0 {
+				t.Fatalf("模拟输出 %s，期望 %s", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyExecutionRejectsZeroEstimate(t *testing.T) {
+	ac := &ArbitrageCalculator{cfg: &AppConfig{ExecSimTolerance: 0.01}}
+	for _, estimate := range []float64{0, -1} {
+		if err := ac.verifyExecution(context.Background(), ArbitrageOpportunity{EstimatedReturn: estimate}); err == nil {
+			t.Fatalf("估算输出 %g 时应返回错误", estimate)
+		}
+	}
+}
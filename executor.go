@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 执行器模式
+const (
+	// ExecutorModeLog 只记录日志，不发送交易（默认）
+	ExecutorModeLog = "log"
+	// ExecutorModeContract 签名并发送调用套利合约的交易
+	ExecutorModeContract = "contract"
+)
+
+// executorGasLimitMarginPercent 估算 gas 后额外预留的百分比，避免状态变化导致 out of gas
+const executorGasLimitMarginPercent = 20
+
+// 套利合约 Hop.kind 取值，与合约内的协议分支一一对应
+const (
+	executorHopUniswapV2 uint8 = iota
+	executorHopUniswapV3
+	executorHopUniswapV4
+	executorHopUniswapV1
+	executorHopBalancerWeighted
+	// executorHopWrapNative 原生 BNB 与 WBNB 之间的包装/解包，合约按方向调用 deposit/withdraw
+	executorHopWrapNative
+)
+
+// executorHopKinds 协议名到合约 Hop.kind 的映射
+var executorHopKinds = map[string]uint8{
+	ProtocolUniswapV2Like:    executorHopUniswapV2,
+	ProtocolUniswapV3:        executorHopUniswapV3,
+	ProtocolUniswapV4:        executorHopUniswapV4,
+	ProtocolUniswapV1:        executorHopUniswapV1,
+	ProtocolBalancerWeighted: executorHopBalancerWeighted,
+	ProtocolWrapNative:       executorHopWrapNative,
+}
+
+// Executor 提交套利交易，返回已广播交易的哈希；optimalInput 为以起始代币最小单位计的投入量
+type Executor interface {
+	Execute(ctx context.Context, opportunity ArbitrageOpportunity, optimalInput float64) (common.Hash, error)
+}
+
+// executorBackend ContractExecutor 依赖的链上接口，*ethclient.Client 满足该接口
+type executorBackend interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error)
+	ethereum.ContractCaller
+	nonceBackend
+}
+
+// NewExecutor 按 EXECUTOR_MODE 创建执行器，gas 为 contract 模式发送交易时的定价来源
+func NewExecutor(client executorBackend, gas *GasOracle, cfg *AppConfig) (Executor, error) {
+	switch cfg.ExecutorMode {
+	case "", ExecutorModeLog:
+		return LogExecutor{}, nil
+	case ExecutorModeContract:
+		return NewContractExecutor(client, gas, cfg)
+	default:
+		return nil, fmt.Errorf("不支持的执行器模式: %s", cfg.ExecutorMode)
+	}
+}
+
+// LogExecutor 只输出日志的执行器，用于观察套利机会而不实际交易
+type LogExecutor struct{}
+
+// Execute 记录将要提交的套利，不发送交易
+func (LogExecutor) Execute(ctx context.Context, opportunity ArbitrageOpportunity, optimalInput float64) (common.Hash, error) {
+	log.Printf("提交套利执行（仅日志）: 起始 %s, 投入 %.6f, 预期收益 %.6f, 路径长度 %d",
+		opportunity.StartToken, optimalInput, opportunity.EstimatedReturn, len(opportunity.Path))
+	return common.Hash{}, nil
+}
+
+// executorHop 套利合约 Hop 结构体，字段名与 ABI 中的 components 对应
+type executorHop struct {
+	Pool     common.Address
+	TokenIn  common.Address
+	TokenOut common.Address
+	Kind     uint8
+}
+
+// ContractExecutor 用 EXECUTOR_PRIVATE_KEY 签名交易调用 EXECUTOR_CONTRACT 的 executeArbitrage
+// nonce 由 NonceManager 分配；交易先 EstimateGas，会回滚的套利不会广播也不占用 nonce
+// 开启 EXECUTOR_APPROVE_CHECK 时，发送前由 ApprovalManager 确认账户已授权执行合约拉取起始代币；gas 定价由 GasOracle 给出
+type ContractExecutor struct {
+	client    executorBackend
+	gas       *GasOracle
+	cfg       *AppConfig
+	abi       abi.ABI
+	key       *ecdsa.PrivateKey
+	from      common.Address
+	contract  common.Address
+	nonces    *NonceManager
+	approvals *ApprovalManager
+
+	mu      sync.Mutex
+	chainID *big.Int
+}
+
+// NewContractExecutor 创建合约执行器，私钥只保存在内存中，不会输出到日志或错误信息
+func NewContractExecutor(client executorBackend, gas *GasOracle, cfg *AppConfig) (*ContractExecutor, error) {
+	executorABI, err := abi.JSON(strings.NewReader(ArbitrageExecutorABIJSON))
+	if err != nil {
+		return nil, fmt.Errorf("解析套利合约 ABI 失败: %w", err)
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(cfg.ExecutorPrivateKey, "0x"))
+	if err != nil {
+		// 不包装原始错误，避免私钥片段出现在日志中
+		return nil, fmt.Errorf("EXECUTOR_PRIVATE_KEY 格式非法")
+	}
+	if cfg.ExecutorContract == (common.Address{}) {
+		return nil, fmt.Errorf("EXECUTOR_MODE=contract 时必须设置 EXECUTOR_CONTRACT")
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	ce := &ContractExecutor{
+		client:   client,
+		gas:      gas,
+		cfg:      cfg,
+		abi:      executorABI,
+		key:      key,
+		from:     from,
+		contract: cfg.ExecutorContract,
+		nonces:   NewNonceManager(client, cfg, from),
+	}
+	if cfg.ExecutorApproveCheck {
+		approvals, err := NewApprovalManager(client, from, ce.sendApproval, cfg)
+		if err != nil {
+			return nil, err
+		}
+		ce.approvals = approvals
+	}
+	return ce, nil
+}
+
+// OnResult 设置已广播交易最终结果（上链成功、回滚或未上链）的回调
+func (ce *ContractExecutor) OnResult(fn txResultFunc) {
+	ce.nonces.OnResult(fn)
+}
+
+// Stop 停止跟踪已广播的交易，停机时调用
+func (ce *ContractExecutor) Stop() {
+	ce.nonces.Stop()
+}
+
+// From 返回发送交易的账户地址
+func (ce *ContractExecutor) From() common.Address {
+	return ce.from
+}
+
+// Execute 构建、签名并广播套利交易，要求最终得到的起始代币不少于 minAmountOut
+func (ce *ContractExecutor) Execute(ctx context.Context, opportunity ArbitrageOpportunity, optimalInput float64) (common.Hash, error) {
+	amountIn, _ := new(big.Float).SetFloat64(optimalInput).Int(nil)
+	if amountIn.Sign() <= 0 {
+		return common.Hash{}, fmt.Errorf("投入量非法: %.6f", optimalInput)
+	}
+	if ce.approvals != nil {
+		if err := ce.approvals.Ensure(ctx, opportunity, amountIn); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	data, err := ce.packExecute(opportunity, amountIn, minAmountOut(opportunity, amountIn))
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	signed, err := ce.send(ctx, ce.contract, data, ce.cfg.ExecutorGasLimit)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("发送套利交易失败: %w", err)
+	}
+
+	log.Printf("已发送套利交易 %s: nonce %d, gas %d, gas 价格上限 %s wei, 投入 %s, 路径长度 %d",
+		signed.Hash().Hex(), signed.Nonce(), signed.Gas(), signed.GasFeeCap(), amountIn, len(opportunity.Path))
+	return signed.Hash(), nil
+}
+
+// sendApproval 发送授权交易，gas 上限按估算结果确定
+func (ce *ContractExecutor) sendApproval(ctx context.Context, token common.Address, data []byte) (common.Hash, error) {
+	signed, err := ce.send(ctx, token, data, 0)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return signed.Hash(), nil
+}
+
+// send 签名并通过 NonceManager 广播调用 to 合约的交易；gasLimit 为 0 时按 EstimateGas 结果加 20% 余量
+func (ce *ContractExecutor) send(ctx context.Context, to common.Address, data []byte, gasLimit uint64) (*types.Transaction, error) {
+	if gasLimit == 0 {
+		callCtx, cancel := withRPCTimeout(ctx, ce.cfg.RPCCallTimeout)
+		estimated, err := ce.client.EstimateGas(callCtx, ethereum.CallMsg{From: ce.from, To: &to, Data: data})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("估算交易 gas 失败（交易可能回滚）: %w", err)
+		}
+		gasLimit = estimated + estimated*executorGasLimitMarginPercent/100
+	}
+
+	price, err := ce.gas.Suggest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	chainID, err := ce.loadChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signer := types.LatestSignerForChainID(chainID)
+	return ce.nonces.Send(ctx, price, func(nonce uint64, price GasPrice) (*types.Transaction, error) {
+		return types.SignTx(price.newTx(chainID, nonce, gasLimit, to, data), signer, ce.key)
+	})
+}
+
+// loadChainID 首次使用时从节点读取链 ID 并缓存
+func (ce *ContractExecutor) loadChainID(ctx context.Context) (*big.Int, error) {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	if ce.chainID != nil {
+		return ce.chainID, nil
+	}
+	callCtx, cancel := withRPCTimeout(ctx, ce.cfg.RPCCallTimeout)
+	defer cancel()
+	chainID, err := ce.client.ChainID(callCtx)
+	if err != nil {
+		return nil, fmt.Errorf("获取链 ID 失败: %w", err)
+	}
+	ce.chainID = chainID
+	return chainID, nil
+}
+
+// minAmountOut 链上要求的最少返回量：计算者给出的 MinReturn（投入量 + 执行成本 + 收益门槛），
+// 价格变化后净利润不足时交易回滚，而不是只保本成交、白付 gas 与贿赂；未精算的机会至少要求不亏损
+func minAmountOut(opportunity ArbitrageOpportunity, amountIn *big.Int) *big.Int {
+	if opportunity.MinReturn != nil && opportunity.MinReturn.Cmp(amountIn) > 0 {
+		return opportunity.MinReturn
+	}
+	return amountIn
+}
+
+// packExecute 将套利路径编码为 executeArbitrage 的 calldata
+func (ce *ContractExecutor) packExecute(opportunity ArbitrageOpportunity, amountIn, minAmountOut *big.Int) ([]byte, error) {
+	if len(opportunity.Path) == 0 {
+		return nil, fmt.Errorf("套利路径为空")
+	}
+	hops := make([]executorHop, len(opportunity.Path))
+	for i, step := range opportunity.Path {
+		kind, ok := executorHopKinds[step.Protocol]
+		if !ok {
+			return nil, fmt.Errorf("套利合约不支持协议 %s", step.Protocol)
+		}
+		hops[i] = executorHop{
+			Pool:     step.Pool.Address,
+			TokenIn:  common.HexToAddress(step.FromToken),
+			TokenOut: common.HexToAddress(step.ToToken),
+			Kind:     kind,
+		}
+	}
+	return ce.abi.Pack("executeArbitrage", amountIn, minAmountOut, hops)
+}
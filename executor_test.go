@@ -0,0 +1,27 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+// TestMinAmountOut 执行时要求的最少返回量取计算者给出的 MinReturn，未精算或低于投入量时至少保本
+func TestMinAmountOut(t *testing.T) {
+	amountIn := big.NewInt(1000)
+	tests := []struct {
+		name      string
+		minReturn *big.Int
+		want      int64
+	}{
+		{name: "refined opportunity", minReturn: big.NewInt(1006), want: 1006},
+		{name: "not refined", want: 1000},
+		{name: "below input", minReturn: big.NewInt(900), want: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minAmountOut(ArbitrageOpportunity{MinReturn: tt.minReturn}, amountIn); got.Cmp(big.NewInt(tt.want)) != 0 {
+				t.Fatalf("最少返回量 %s，期望 %d", got, tt.want)
+			}
+		})
+	}
+}
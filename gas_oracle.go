@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// gas 定价模式
+const (
+	// GasModeAuto 链头区块带 baseFee 时使用 EIP-1559，否则使用 legacy（默认）
+	GasModeAuto = "auto"
+	// GasModeLegacy 始终使用 SuggestGasPrice 的 legacy gas 价格
+	GasModeLegacy = "legacy"
+	// GasModeEIP1559 始终设置 maxFeePerGas / maxPriorityFeePerGas
+	GasModeEIP1559 = "eip1559"
+)
+
+const (
+	// gasOracleRefreshInterval 后台刷新 gas 价格的周期，供收益模型读取
+	gasOracleRefreshInterval = 10 * time.Second
+	// gasFeeHistoryBlocks 估算优先费时参考的最近区块数
+	gasFeeHistoryBlocks = 10
+	// gasTipPercentile 每个区块内取该百分位的优先费，再取各区块的中位数
+	gasTipPercentile = 50
+)
+
+// GasPrice 一笔交易的 gas 定价，Legacy 为 true 时只有 GasPrice 有效，否则使用 TipCap / FeeCap
+type GasPrice struct {
+	Legacy   bool
+	GasPrice *big.Int
+	// BaseFee 下一个区块的基础费用，只用于估算实际支付的价格
+	BaseFee *big.Int
+	// TipCap maxPriorityFeePerGas
+	TipCap *big.Int
+	// FeeCap maxFeePerGas
+	FeeCap *big.Int
+}
+
+// Effective 估算每单位 gas 实际支付的价格：legacy 为 GasPrice，EIP-1559 为 min(baseFee + tip, feeCap)
+func (gp GasPrice) Effective() *big.Int {
+	if gp.Legacy {
+		return gp.GasPrice
+	}
+	effective := new(big.Int).Add(gp.BaseFee, gp.TipCap)
+	if effective.Cmp(gp.FeeCap) > 0 {
+		return gp.FeeCap
+	}
+	return effective
+}
+
+// String 输出便于日志阅读的定价
+func (gp GasPrice) String() string {
+	if gp.Legacy {
+		return fmt.Sprintf("gasPrice %s wei", gp.GasPrice)
+	}
+	return fmt.Sprintf("maxFee %s wei, maxPriorityFee %s wei", gp.FeeCap, gp.TipCap)
+}
+
+// bump 按百分比提高定价用于替换交易（EIP-1559 交易的 tip 与 feeCap 都需提高），
+// 提价后超过 maxFee（nil 表示不限）时返回 false
+func (gp GasPrice) bump(percent int, maxFee *big.Int) (GasPrice, bool) {
+	bumped := gp
+	if gp.Legacy {
+		bumped.GasPrice = bumpGasPrice(gp.GasPrice, percent)
+		return bumped, maxFee == nil || bumped.GasPrice.Cmp(maxFee) <= 0
+	}
+	bumped.TipCap = bumpGasPrice(gp.TipCap, percent)
+	bumped.FeeCap = bumpGasPrice(gp.FeeCap, percent)
+	return bumped, maxFee == nil || bumped.FeeCap.Cmp(maxFee) <= 0
+}
+
+// newTx 按定价构建未签名的交易
+func (gp GasPrice) newTx(chainID *big.Int, nonce, gas uint64, to common.Address, data []byte) *types.Transaction {
+	if gp.Legacy {
+		return types.NewTx(&types.LegacyTx{Nonce: nonce, GasPrice: gp.GasPrice, Gas: gas, To: &to, Data: data})
+	}
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: gp.TipCap,
+		GasFeeCap: gp.FeeCap,
+		Gas:       gas,
+		To:        &to,
+		Data:      data,
+	})
+}
+
+// gasOracleBackend GasOracle 依赖的链上接口，*ethclient.Client 满足该接口
+type gasOracleBackend interface {
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error)
+}
+
+// GasOracle 按 GAS_PRICE_MODE 给出 legacy 或 EIP-1559 定价，执行器发送交易前调用 Suggest 获取最新定价，
+// 收益模型通过 Current 读取后台周期刷新的结果；优先费不低于 GAS_PRIORITY_FEE_FLOOR_GWEI，
+// maxFeePerGas（legacy 为 gasPrice）不超过 GAS_MAX_FEE_GWEI，避免拥堵时多付
+type GasOracle struct {
+	client gasOracleBackend
+	cfg    *AppConfig
+
+	mu      sync.Mutex
+	eip1559 *bool
+	current *GasPrice
+}
+
+// NewGasOracle 创建 gas 价格来源
+func NewGasOracle(client gasOracleBackend, cfg *AppConfig) *GasOracle {
+	return &GasOracle{client: client, cfg: cfg}
+}
+
+// Start 按 gasOracleRefreshInterval 刷新定价，供 Current 读取
+func (g *GasOracle) Start(ctx context.Context) {
+	ticker := time.NewTicker(gasOracleRefreshInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := g.Suggest(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("刷新 gas 价格失败: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Current 返回最近一次获取的定价，尚未成功获取过时返回 false
+func (g *GasOracle) Current() (GasPrice, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.current == nil {
+		return GasPrice{}, false
+	}
+	return *g.current, true
+}
+
+// Suggest 从节点获取最新定价并更新 Current 的结果
+func (g *GasOracle) Suggest(ctx context.Context) (GasPrice, error) {
+	eip1559, err := g.useEIP1559(ctx)
+	if err != nil {
+		return GasPrice{}, err
+	}
+	var price GasPrice
+	if eip1559 {
+		price, err = g.suggestDynamic(ctx)
+	} else {
+		price, err = g.suggestLegacy(ctx)
+	}
+	if err != nil {
+		return GasPrice{}, err
+	}
+
+	g.mu.Lock()
+	g.current = &price
+	g.mu.Unlock()
+	return price, nil
+}
+
+// useEIP1559 按 GAS_PRICE_MODE 判断是否使用 EIP-1559，auto 模式首次调用时按链头区块是否带 baseFee 判断并缓存
+func (g *GasOracle) useEIP1559(ctx context.Context) (bool, error) {
+	switch g.cfg.GasPriceMode {
+	case GasModeLegacy:
+		return false, nil
+	case GasModeEIP1559:
+		return true, nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.eip1559 != nil {
+		return *g.eip1559, nil
+	}
+	callCtx, cancel := withRPCTimeout(ctx, g.cfg.RPCCallTimeout)
+	defer cancel()
+	header, err := g.client.HeaderByNumber(callCtx, nil)
+	if err != nil {
+		return false, fmt.Errorf("获取链头区块失败: %w", err)
+	}
+	eip1559 := header.BaseFee != nil
+	g.eip1559 = &eip1559
+	if eip1559 {
+		log.Printf("链头区块带有 baseFee，gas 定价使用 EIP-1559")
+	} else {
+		log.Printf("链头区块没有 baseFee，gas 定价使用 legacy gasPrice")
+	}
+	return eip1559, nil
+}
+
+// suggestLegacy 使用节点建议的 gas 价格，超过上限时按上限
+func (g *GasOracle) suggestLegacy(ctx context.Context) (GasPrice, error) {
+	callCtx, cancel := withRPCTimeout(ctx, g.cfg.RPCCallTimeout)
+	defer cancel()
+	gasPrice, err := g.client.SuggestGasPrice(callCtx)
+	if err != nil {
+		return GasPrice{}, fmt.Errorf("获取 gas 价格失败: %w", err)
+	}
+	if maxFee := gasMaxFee(g.cfg); maxFee != nil && gasPrice.Cmp(maxFee) > 0 {
+		gasPrice = maxFee
+	}
+	return GasPrice{Legacy: true, GasPrice: gasPrice}, nil
+}
+
+// suggestDynamic 由最近 gasFeeHistoryBlocks 个区块的费用历史估算 EIP-1559 定价：
+// 优先费取各区块 gasTipPercentile 百分位的中位数（费用历史不可用时退回 SuggestGasTipCap），不低于下限；
+// maxFeePerGas = 2 × 下一区块 baseFee + 优先费，可承受连续数个区块的 baseFee 上涨，超过上限时按上限
+func (g *GasOracle) suggestDynamic(ctx context.Context) (GasPrice, error) {
+	callCtx, cancel := withRPCTimeout(ctx, g.cfg.RPCCallTimeout)
+	history, err := g.client.FeeHistory(callCtx, gasFeeHistoryBlocks, nil, []float64{gasTipPercentile})
+	cancel()
+	if err != nil {
+		return GasPrice{}, fmt.Errorf("获取费用历史失败: %w", err)
+	}
+	if len(history.BaseFee) == 0 {
+		return GasPrice{}, fmt.Errorf("费用历史中没有 baseFee")
+	}
+	baseFee := history.BaseFee[len(history.BaseFee)-1]
+	if baseFee == nil {
+		baseFee = big.NewInt(0)
+	}
+
+	tip := medianTip(history.Reward)
+	if tip == nil {
+		callCtx, cancel := withRPCTimeout(ctx, g.cfg.RPCCallTimeout)
+		tip, err = g.client.SuggestGasTipCap(callCtx)
+		cancel()
+		if err != nil {
+			return GasPrice{}, fmt.Errorf("获取优先费失败: %w", err)
+		}
+	}
+	if floor := gweiToWei(g.cfg.GasPriorityFeeFloorGwei); tip.Cmp(floor) < 0 {
+		tip = floor
+	}
+
+	feeCap := new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tip)
+	if maxFee := gasMaxFee(g.cfg); maxFee != nil && feeCap.Cmp(maxFee) > 0 {
+		feeCap = maxFee
+		if tip.Cmp(feeCap) > 0 {
+			tip = feeCap
+		}
+	}
+	return GasPrice{BaseFee: baseFee, TipCap: tip, FeeCap: feeCap}, nil
+}
+
+// gasMaxFee 返回 GAS_MAX_FEE_GWEI 换算的 wei 上限，未配置时返回 nil
+func gasMaxFee(cfg *AppConfig) *big.Int {
+	if cfg.GasMaxFeeGwei <= 0 {
+		return nil
+	}
+	return gweiToWei(cfg.GasMaxFeeGwei)
+}
+
+// medianTip 取各区块优先费的中位数，没有有效数据时返回 nil
+func medianTip(rewards [][]*big.Int) *big.Int {
+	var tips []*big.Int
+	for _, reward := range rewards {
+		if len(reward) > 0 && reward[0] != nil {
+			tips = append(tips, reward[0])
+		}
+	}
+	if len(tips) == 0 {
+		return nil
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+	return new(big.Int).Set(tips[len(tips)/2])
+}
+
+// gweiToWei 将 gwei 换算为 wei
+func gweiToWei(gwei float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(gwei), big.NewFloat(1e9)).Int(nil)
+	return wei
+}
@@ -5,6 +5,8 @@ go 1.24.0
 require (
 	github.com/ethereum/go-ethereum v1.16.7
 	github.com/gin-gonic/gin v1.11.0
+	github.com/lib/pq v1.12.3
+	golang.org/x/time v0.9.0
 	modernc.org/sqlite v1.40.0
 )
 
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// healthAlertInterval 检查运行状态的周期
+	healthAlertInterval = 15 * time.Second
+	// healthAlertReconnectAttempts 订阅连续重连失败达到该次数才视为断开，避免一次短暂重连就告警
+	healthAlertReconnectAttempts = 3
+)
+
+// backoffReporter 区块订阅器与日志订阅器都提供的重连退避状态
+type backoffReporter interface {
+	BackoffState() BackoffState
+}
+
+// HealthAlerter 周期检查 /healthz 中的订阅、执行熔断与存储状态，状态在正常与异常之间切换时推送通知
+// 只在切换时推送一次，异常持续期间不重复推送
+type HealthAlerter struct {
+	notifier   *MultiNotifier
+	store      *ResilientStore
+	breaker    *CircuitBreaker
+	subscriber backoffReporter
+
+	subscriptionDown bool
+	breakerTripped   bool
+	storeDown        bool
+}
+
+// NewHealthAlerter 创建运行告警任务，subscriber 为 nil 时（回放模式）不检查订阅状态
+func NewHealthAlerter(notifier *MultiNotifier, store *ResilientStore, breaker *CircuitBreaker, subscriber backoffReporter) *HealthAlerter {
+	return &HealthAlerter{notifier: notifier, store: store, breaker: breaker, subscriber: subscriber}
+}
+
+// Start 按 healthAlertInterval 检查运行状态
+func (ha *HealthAlerter) Start(ctx context.Context) {
+	ticker := time.NewTicker(healthAlertInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ha.check(ctx)
+		}
+	}
+}
+
+// check 比较当前状态与上一次检查的结果，发生切换时推送通知
+func (ha *HealthAlerter) check(ctx context.Context) {
+	if ha.subscriber != nil {
+		state := ha.subscriber.BackoffState()
+		down := state.Attempts >= healthAlertReconnectAttempts
+		ha.transition(ctx, &ha.subscriptionDown, down,
+			NotificationEvent{Kind: NotifySubscriptionDown, Message: fmt.Sprintf("订阅已断开，连续重连失败 %d 次，下次重试等待 %s", state.Attempts, state.CurrentDelay)},
+			NotificationEvent{Kind: NotifySubscriptionRecovered, Message: "订阅已恢复"})
+	}
+
+	breaker := ha.breaker.State()
+	ha.transition(ctx, &ha.breakerTripped, breaker.Tripped,
+		NotificationEvent{Kind: NotifyBreakerTripped, Message: fmt.Sprintf("执行熔断，%s 自动恢复，原因: %s", breaker.ResumeAt.Format(time.RFC3339), breaker.TripReason)},
+		NotificationEvent{Kind: NotifyBreakerRecovered, Message: "执行熔断已解除"})
+
+	store := ha.store.Health()
+	ha.transition(ctx, &ha.storeDown, !store.Healthy,
+		NotificationEvent{Kind: NotifyStoreDown, Message: fmt.Sprintf("存储熔断，连续写入失败 %d 次，新池子暂存在内存中: %s", store.ConsecutiveFailures, store.LastError)},
+		NotificationEvent{Kind: NotifyStoreRecovered, Message: fmt.Sprintf("存储已恢复，待写回 %d 个池子", store.BufferedPools)})
+}
+
+// transition 状态从正常变为异常时推送 down，从异常恢复时推送 up
+func (ha *HealthAlerter) transition(ctx context.Context, current *bool, next bool, down, up NotificationEvent) {
+	if *current == next {
+		return
+	}
+	*current = next
+	if next {
+		ha.notifier.NotifyAsync(ctx, down)
+	} else {
+		ha.notifier.NotifyAsync(ctx, up)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// LogQueue 内存队列，用于缓存日志订阅推送的待处理日志
+type LogQueue struct {
+	ch chan types.Log
+}
+
+// NewLogQueue 创建新的日志队列
+func NewLogQueue(size int) (*LogQueue, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("log queue size must be positive, current: %d", size)
+	}
+	return &LogQueue{
+		ch: make(chan types.Log, size),
+	}, nil
+}
+
+// Publish 将日志放入队列，队列已满时等待空位直到 ctx 取消
+// 日志模式没有区块可以重新获取，丢弃任何一条日志都会在游标之前留下缺口，因此积压时向订阅端施加背压而不是丢弃
+func (q *LogQueue) Publish(ctx context.Context, lg types.Log) error {
+	select {
+	case q.ch <- lg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe 返回一个只读 channel，用于消费日志
+func (q *LogQueue) Subscribe() <-chan types.Log {
+	return q.ch
+}
+
+// Len 返回当前队列积压的日志数量
+func (q *LogQueue) Len() int {
+	return len(q.ch)
+}
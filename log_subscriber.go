@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// 订阅模式
+const (
+	// SubModeHeads 订阅新区块头，再获取区块与交易回执扫描日志（默认）
+	SubModeHeads = "heads"
+	// SubModeLogs 按 Swap/建池事件 Topic 直接订阅日志，跳过区块与回执获取
+	SubModeLogs = "logs"
+)
+
+// LogSubscriber 按 Topic 过滤订阅日志并推送到日志队列
+// 节点只推送匹配的日志，省去每个区块的区块与回执请求，适合 RPC 配额紧张的场景
+type LogSubscriber struct {
+	client  *ethclient.Client
+	queue   *LogQueue
+	backoff *backoff
+	cfg     *AppConfig
+	topics  []common.Hash
+}
+
+// NewLogSubscriber 创建日志订阅器，topics 为需要订阅的事件 Topic（匹配任一即推送）
+func NewLogSubscriber(client *ethclient.Client, queue *LogQueue, topics []common.Hash, cfg *AppConfig) *LogSubscriber {
+	return &LogSubscriber{
+		client:  client,
+		queue:   queue,
+		backoff: newBackoff(cfg.ReconnectBackoffMin, cfg.ReconnectBackoffMax),
+		cfg:     cfg,
+		topics:  topics,
+	}
+}
+
+// BackoffState 返回重连退避状态，用于健康检查
+func (ls *LogSubscriber) BackoffState() BackoffState {
+	return ls.backoff.State()
+}
+
+// Start 启动订阅流程，订阅中断后按退避策略重新订阅
+func (ls *LogSubscriber) Start(ctx context.Context) error {
+	logs := make(chan types.Log, 256)
+	query := ethereum.FilterQuery{Topics: [][]common.Hash{ls.topics}}
+
+	for {
+		sub, err := ls.client.SubscribeFilterLogs(ctx, query, logs)
+		if err != nil {
+			delay := ls.backoff.Next()
+			log.Printf("订阅日志失败: %v，%v 后重试", err, delay.Truncate(time.Millisecond))
+			if err := sleepContext(ctx, delay); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Printf("已订阅 %d 个事件 Topic 的日志", len(ls.topics))
+
+		subscribedAt := time.Now()
+		if err := ls.loop(ctx, logs, sub); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("日志监听循环错误: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if time.Since(subscribedAt) >= reconnectStableDuration {
+			ls.backoff.Reset()
+		}
+		delay := ls.backoff.Next()
+		log.Printf("日志订阅中断，%v 后尝试重新订阅", delay.Truncate(time.Millisecond))
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// loop 消费订阅推送的日志，并按 KeepaliveInterval 主动探测连接
+// 匹配的日志不一定每个区块都有，因此只以链头查询是否超时判断连接是否存活，不做推送停滞检测
+func (ls *LogSubscriber) loop(ctx context.Context, logs chan types.Log, sub subscription) error {
+	defer sub.Unsubscribe()
+
+	var keepalive <-chan time.Time
+	if ls.cfg.KeepaliveInterval > 0 {
+		ticker := time.NewTicker(ls.cfg.KeepaliveInterval)
+		defer ticker.Stop()
+		keepalive = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return subscriptionError(err, ls.cfg)
+		case lg := <-logs:
+			// 链重组撤销的日志不再处理，已发现的池子仍然存在
+			if lg.Removed || len(lg.Topics) == 0 {
+				continue
+			}
+			if err := ls.queue.Publish(ctx, lg); err != nil {
+				return err
+			}
+		case <-keepalive:
+			if err := ls.probe(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// probe 在 KeepaliveTimeout 内查询链头高度
+func (ls *LogSubscriber) probe(ctx context.Context) error {
+	probeCtx, cancel := context.WithTimeout(ctx, ls.cfg.KeepaliveTimeout)
+	defer cancel()
+
+	if _, err := ls.client.BlockNumber(probeCtx); err != nil {
+		return fmt.Errorf("保活探测失败: %w", err)
+	}
+	return nil
+}
@@ -2,22 +2,48 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/gin-gonic/gin"
 )
 
+// shutdownTimeout 收到退出信号后每个停机阶段（HTTP 服务关闭、订阅协程取消订阅、后台任务退出）的最长等待时间，
+// 超时后继续下一阶段
+const shutdownTimeout = 10 * time.Second
+
+// runWorker 在 wg 中登记并启动后台任务，停机时据此等待任务退出后再关闭连接与存储
+func runWorker(wg *sync.WaitGroup, fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fn()
+	}()
+}
+
+// httpListenAddr 返回 HTTP 服务监听地址，与 gin 的 Run 一致：优先使用 PORT 环境变量，默认 :8080
+func httpListenAddr() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return ":8080"
+}
+
 // initializeApp 初始化应用程序的基础组件
 // 返回配置、区块队列和解析后的 ABI
-func initializeApp() (*AppConfig, *BlockQueue, *abi.ABI, *abi.ABI, *abi.ABI) {
+func initializeApp() (*AppConfig, *BlockQueue, *abi.ABI, *abi.ABI, *abi.ABI, *abi.ABI) {
 	cfg, err := LoadConfig()
 	if err != nil {
-		log.Fatalf("加载配置失败: %v", err)
+		log.Fatalf("加载配置失败:\n%v", err)
 	}
 
 	blockQueue, err := NewBlockQueue(cfg.BlockQueueSize)
@@ -37,17 +63,23 @@ func initializeApp() (*AppConfig, *BlockQueue, *abi.ABI, *abi.ABI, *abi.ABI) {
 	if err != nil {
 		log.Fatalf("解析 V3 ABI 失败: %v", err)
 	}
+	balancerABI, err := abi.JSON(strings.NewReader(BalancerWeightedABIJSON))
+	if err != nil {
+		log.Fatalf("解析 Balancer ABI 失败: %v", err)
+	}
 
-	return cfg, blockQueue, &v1ABI, &v2ABI, &v3ABI
+	return cfg, blockQueue, &v1ABI, &v2ABI, &v3ABI, &balancerABI
 }
 
-// startBlockSubscriber 启动区块订阅器和队列监控
+// startBlockSubscriber 启动区块订阅器和队列监控，返回订阅器以便查询其状态
 // 注意：此函数会启动后台 goroutine，函数返回后 goroutine 会继续在后台运行
-// goroutine 的生命周期由 ctx 控制，当 ctx 被取消时会自动退出
-func startBlockSubscriber(ctx context.Context, wsURL string, conn *ethclient.Client, blockQueue *BlockQueue) {
+// goroutine 的生命周期由 ctx 控制，当 ctx 被取消时会自动退出；订阅协程登记在 wg 中，退出前已取消订阅
+func startBlockSubscriber(ctx context.Context, wg *sync.WaitGroup, wsURL string, conn *ethclient.Client, blockQueue *BlockQueue, cfg *AppConfig) *BlockSubscriber {
 	// 启动区块订阅器（后台 goroutine）
-	subscriber := NewBlockSubscriber(wsURL, conn, blockQueue)
+	subscriber := NewBlockSubscriber(wsURL, conn, blockQueue, cfg)
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		if err := subscriber.Start(ctx); err != nil {
 			log.Printf("订阅器结束: %v", err)
 		}
@@ -66,55 +98,270 @@ func startBlockSubscriber(ctx context.Context, wsURL string, conn *ethclient.Cli
 			}
 		}
 	}()
+
+	return subscriber
+}
+
+// startLogSubscriber 启动日志订阅器、日志消费与队列监控，返回订阅器以便查询其状态
+// 补扫停机期间的区块仍走区块队列，只有实时部分改为直接订阅日志；订阅协程登记在 wg 中，日志消费登记在 workers 中
+func startLogSubscriber(ctx context.Context, wg, workers *sync.WaitGroup, conn *ethclient.Client, discoverer *PoolDiscoverer, cfg *AppConfig) (*LogSubscriber, error) {
+	logQueue, err := NewLogQueue(cfg.LogQueueSize)
+	if err != nil {
+		return nil, err
+	}
+	runWorker(workers, func() { discoverer.StartLogs(ctx, logQueue) })
+
+	subscriber := NewLogSubscriber(conn, logQueue, discoverer.LogTopics(), cfg)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := subscriber.Start(ctx); err != nil {
+			log.Printf("日志订阅器结束: %v", err)
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				log.Printf("当前日志队列积压: %d", logQueue.Len())
+			}
+		}
+	}()
+
+	return subscriber, nil
 }
 
 func main() {
-	ctx, cancel := context.WithCancel(context.Background())
+	replayFrom := flag.Uint64("replay-from", 0, "回放历史区块的起始高度，设置后进入回放模式而不是订阅新区块")
+	replayTo := flag.Uint64("replay-to", 0, "回放历史区块的结束高度（包含），默认回放到当前链头")
+	refreshReserves := flag.Bool("refresh-reserves", false, "从链上重新读取全部池子的储备量并写回存储，完成后退出")
+	flag.Parse()
+
+	// SIGINT / SIGTERM 取消 ctx；停机顺序：关闭 HTTP 服务 → 等待订阅协程取消订阅 → 等待后台任务退出 →
+	// 关闭连接 → 写回缓冲池子并关闭存储（defer 按注册的逆序执行，存储最先注册、最后关闭）
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	wsURL := DefaultBSCWssURL
+	cfg, blockQueue, v1ABI, v2ABI, v3ABI, balancerABI := initializeApp()
+	wsURL := cfg.WSRPCURL
 
-	cfg, blockQueue, v1ABI, v2ABI, v3ABI := initializeApp()
+	// 回放模式使用 HTTP 节点按高度拉取历史区块，不需要 WebSocket 订阅
+	replaying := *replayFrom > 0
 
-	log.Printf("连接 BSC 节点: %+v %+v %+v %+v %+v", cfg, blockQueue, v1ABI, v2ABI, v3ABI)
+	log.Printf("连接 BSC 节点: %+v %+v %+v %+v %+v", cfg.Redacted(), blockQueue, v1ABI, v2ABI, v3ABI)
 
-	conn, err := ethclient.DialContext(ctx, wsURL)
+	baseStore, err := NewStore(cfg)
 	if err != nil {
-		log.Fatalf("连接 BSC 节点失败: %v", err)
+		log.Fatalf("初始化存储失败: %v", err)
 	}
-	defer conn.Close()
+	store := NewResilientStore(baseStore, cfg)
+	defer func() {
+		if err := store.Close(); err != nil {
+			log.Printf("关闭存储失败: %v", err)
+		}
+	}()
 
-	store, err := NewPoolStore(cfg.SQLitePath)
+	// 区块、回执、合约调用等请求/响应调用走 HTTP 连接，订阅单独使用 WebSocket 连接：
+	// 高频订阅推送与大量请求不会在同一条连接上互相阻塞，订阅断开重连期间其他组件的调用也不受影响；
+	// RPC_RATE_LIMIT 对这条连接上全部组件的调用共用一个限额
+	conn, err := dialRateLimitedHTTP(ctx, cfg.HTTPRPCURL, cfg.RPCRateLimit)
 	if err != nil {
-		log.Fatalf("初始化 SQLite 失败: %v", err)
+		log.Fatalf("连接 BSC HTTP 节点失败: %v", err)
+	}
+	defer conn.Close()
+
+	// 后台任务登记在 workers 中；main 返回时先取消 ctx 并等待它们、后台储备量刷新与交易跟踪退出，再关闭连接与存储
+	var workers sync.WaitGroup
+	var contractExecutor *ContractExecutor
+	refresher := NewReserveRefresher(conn, store, cfg)
+	defer func() {
+		cancel()
+		waitTimeout(&workers, shutdownTimeout, "后台任务")
+		refresher.Wait()
+		if contractExecutor != nil {
+			contractExecutor.Stop()
+		}
+	}()
+	runWorker(&workers, func() { store.Start(ctx) })
+
+	if *refreshReserves {
+		result, err := refresher.RefreshAll(ctx)
+		if err != nil {
+			log.Fatalf("刷新储备量失败: %v", err)
+		}
+		log.Printf("储备量刷新结果: %+v", result)
+		return
 	}
-	defer store.Close()
 
 	arbQueue := NewArbitrageQueue(cfg.ArbQueueSize)
+	oracle := NewPriceOracle(cfg.WrappedNative)
+	tokens := NewTokenRegistry(conn, store, cfg)
+	if err := tokens.Load(ctx); err != nil {
+		log.Fatalf("加载代币元数据失败: %v", err)
+	}
+	blacklist := NewPoolBlacklist()
+	if err := blacklist.Load(ctx, store); err != nil {
+		log.Fatalf("加载拉黑池子失败: %v", err)
+	}
+	if n := blacklist.Len(); n > 0 {
+		log.Printf("已加载 %d 个拉黑池子", n)
+	}
+
+	// 1. 发现池子
+	var extraProtocols []protocolConfig
+	if cfg.ProtocolsConfigPath != "" {
+		extraProtocols, err = LoadProtocolsFile(cfg.ProtocolsConfigPath)
+		if err != nil {
+			log.Fatalf("加载协议配置失败: %v", err)
+		}
+		log.Printf("从 %s 加载到 %d 个协议配置", cfg.ProtocolsConfigPath, len(extraProtocols))
+	}
+	protocols, err := FilterProtocols(GetProtocolsConfig(cfg.WrappedNative, v1ABI, v2ABI, v3ABI, balancerABI, extraProtocols...), cfg.EnabledProtocols)
+	if err != nil {
+		log.Fatalf("筛选协议失败: %v", err)
+	}
+	if len(cfg.EnabledProtocols) > 0 {
+		log.Printf("只发现以下协议的池子: %s", strings.Join(cfg.EnabledProtocols, ", "))
+	}
+	discoverer := NewPoolDiscoverer(blockQueue, conn, store, protocols, cfg, tokens, blacklist)
+	// 2. 发现套利机会（回放模式下在回放结束后统一执行一次）
+	finder := NewArbitrageFinder(store, arbQueue, cfg, oracle, tokens, blacklist)
+	if !replaying {
+		// 增量模式下池子储备量变化后只重新评估经过该池子的套利环
+		discoverer.OnPoolUpdated(finder.NotifyPoolUpdated)
+	}
+	var provisional *ProvisionalPools
+	if cfg.WatchMempool && !replaying {
+		provisional = NewProvisionalPools()
+		discoverer.WatchProvisional(provisional)
+		runWorker(&workers, func() { provisional.Start(ctx) })
+	}
+	runWorker(&workers, func() { discoverer.Start(ctx) })
 
-	// 1. 订阅区块
-	startBlockSubscriber(ctx, wsURL, conn, blockQueue)
+	// 清理长期未更新且流动性不足的池子
+	pruner := NewPoolPruner(store, cfg)
+	runWorker(&workers, func() { pruner.Start(ctx) })
 
-	// 2. 发现池子
-	protocols := GetProtocolsConfig(v1ABI, v2ABI, v3ABI)
-	discoverer := NewPoolDiscoverer(blockQueue, conn, store, protocols)
-	go discoverer.Start(ctx)
+	// 3. 计算套利机会
+	var simulator *ExecutionSimulator
+	if cfg.ExecSimulate {
+		simulator, err = NewExecutionSimulator(conn, cfg)
+		if err != nil {
+			log.Fatalf("初始化模拟执行器失败: %v", err)
+		}
+	}
+	var v3Quoter *V3Quoter
+	if cfg.V3AccurateQuote {
+		v3Quoter, err = NewV3Quoter(conn, cfg)
+		if err != nil {
+			log.Fatalf("初始化 V3 精确报价器失败: %v", err)
+		}
+	}
+	gasOracle := NewGasOracle(conn, cfg)
+	runWorker(&workers, func() { gasOracle.Start(ctx) })
+	executor, err := NewExecutor(conn, gasOracle, cfg)
+	if err != nil {
+		log.Fatalf("初始化执行器失败: %v", err)
+	}
+	breaker := NewCircuitBreaker(cfg)
+	if ce, ok := executor.(*ContractExecutor); ok {
+		contractExecutor = ce
+		log.Printf("执行器使用合约模式: 合约 %s, 发送账户 %s", cfg.ExecutorContract.Hex(), contractExecutor.From().Hex())
+		contractExecutor.OnResult(breaker.RecordTxResult)
+	}
+	notifier := NewNotifier(cfg)
+	calculator := NewArbitrageCalculator(arbQueue, cfg, store, oracle, gasOracle, tokens, simulator, v3Quoter, executor, breaker, notifier)
+	runWorker(&workers, func() { calculator.Start(ctx) })
 
-	// 3. 发现套利机会
-	finder := NewArbitrageFinder(store, arbQueue, cfg)
-	go finder.Start(ctx)
+	replayer := NewReplayer(conn, blockQueue, discoverer, finder, pruner, cfg)
+	if replaying {
+		if err := replayer.Run(ctx, *replayFrom, *replayTo); err != nil {
+			log.Fatalf("回放历史区块失败: %v", err)
+		}
+		return
+	}
 
-	// 4. 计算套利机会
-	calculator := NewArbitrageCalculator(arbQueue, cfg)
-	go calculator.Start(ctx)
+	// 4. 补扫停机期间错过的区块后再启动套利发现与新区块订阅，首轮全量枚举基于补扫后的储备量
+	if err := replayer.Backfill(ctx, store); err != nil {
+		log.Printf("补扫停机期间的区块失败: %v", err)
+	}
+	runWorker(&workers, func() { finder.Start(ctx) })
+	wsConn, err := dialWebsocket(ctx, wsURL, cfg)
+	if err != nil {
+		log.Fatalf("连接 BSC WebSocket 节点失败: %v", err)
+	}
+	// 连接在 main 返回时关闭，此前先等待 subscriptions 中的订阅协程退出，确保 eth_unsubscribe 已在连接关闭前发出
+	defer wsConn.Close()
+	var subscriptions sync.WaitGroup
+	var subscriber backoffReporter
+	if cfg.SubMode == SubModeLogs {
+		subscriber, err = startLogSubscriber(ctx, &subscriptions, &workers, wsConn, discoverer, cfg)
+		if err != nil {
+			log.Fatalf("启动日志订阅失败: %v", err)
+		}
+	} else {
+		subscriber = startBlockSubscriber(ctx, &subscriptions, wsURL, wsConn, blockQueue, cfg)
+	}
+	alerter := NewHealthAlerter(notifier, store, breaker, subscriber)
+	runWorker(&workers, func() { alerter.Start(ctx) })
+	if provisional != nil {
+		// 内存池订阅只用于提前预判新池子，失败不影响区块订阅
+		pending := NewPendingSubscriber(wsConn, provisional, cfg)
+		subscriptions.Add(1)
+		go func() {
+			defer subscriptions.Done()
+			if err := pending.Start(ctx); err != nil {
+				log.Printf("内存池订阅器结束: %v", err)
+			}
+		}()
+	}
 
-	router := gin.Default()
-	router.GET("/ping", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "pong",
-		})
+	router := newRouter(ctx, cfg, routerDeps{
+		store:       store,
+		conn:        conn,
+		tokens:      tokens,
+		provisional: provisional,
+		refresher:   refresher,
+		blacklist:   blacklist,
+		discoverer:  discoverer,
+		finder:      finder,
+		arbQueue:    arbQueue,
+		calculator:  calculator,
+		breaker:     breaker,
+		subscriber:  subscriber,
 	})
-	if err := router.Run(); err != nil {
-		log.Fatalf("启动 HTTP 服务器失败: %v", err)
+	srv := &http.Server{Addr: httpListenAddr(), Handler: router}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("启动 HTTP 服务器失败: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("收到退出信号，关闭 HTTP 服务并等待订阅取消与后台任务退出")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("关闭 HTTP 服务失败: %v", err)
+	}
+	cancelShutdown()
+	waitTimeout(&subscriptions, shutdownTimeout, "订阅")
+}
+
+// waitTimeout 等待 wg 完成，超过 timeout 时放弃等待并记录日志，what 描述等待的对象
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration, what string) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("等待%s退出超过 %v，继续停机", what, timeout)
 	}
 }
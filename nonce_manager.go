@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// receiptPollInterval 等待交易上链时查询回执的间隔
+	receiptPollInterval = time.Second
+	// nonceConflictRetries 发送时遇到 nonce 冲突后重新同步并重试的次数
+	nonceConflictRetries = 2
+	// watchGracePeriod 后台跟踪交易的总时限在全部重发等待时间之外额外预留的时间
+	watchGracePeriod = time.Minute
+)
+
+// nonceBackend NonceManager 依赖的链上接口，*ethclient.Client 满足该接口
+type nonceBackend interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// signTxFunc 以指定 nonce 与 gas 定价构建并签名交易，重新提交时以更高的定价再次调用
+type signTxFunc func(nonce uint64, price GasPrice) (*types.Transaction, error)
+
+// txResultFunc 交易最终结果回调，err 为 nil 表示已上链且执行成功，否则为回滚或重发后仍未上链的原因
+type txResultFunc func(hash common.Hash, err error)
+
+// NonceManager 在本地维护账户的下一个 nonce，为并发的交易依次分配
+// 首次使用、发送失败或节点返回 nonce too low 时从 PendingNonceAt 重新同步；
+// 节点的 pending nonce 不计入因缺口排队的交易，因此重新同步后会优先补上失败留下的缺口
+// 交易超过 ExecutorResubmitTimeout 仍未上链时，以相同 nonce 提高 gas 定价重新提交
+type NonceManager struct {
+	client  nonceBackend
+	cfg     *AppConfig
+	account common.Address
+
+	// pollInterval 等待上链时查询回执的间隔
+	pollInterval time.Duration
+
+	mu       sync.Mutex
+	next     uint64
+	synced   bool
+	onResult txResultFunc
+
+	// stopCtx 由 Stop 取消，已广播交易的跟踪协程随之结束；watchers 记录仍在跟踪的协程
+	stopCtx  context.Context
+	stop     context.CancelFunc
+	watchers sync.WaitGroup
+}
+
+// NewNonceManager 创建 nonce 管理器
+func NewNonceManager(client nonceBackend, cfg *AppConfig, account common.Address) *NonceManager {
+	stopCtx, stop := context.WithCancel(context.Background())
+	return &NonceManager{client: client, cfg: cfg, account: account, pollInterval: receiptPollInterval, stopCtx: stopCtx, stop: stop}
+}
+
+// Stop 停止跟踪已广播的交易并等待跟踪协程退出：停机后不再提价重发，也不再上报结果
+func (nm *NonceManager) Stop() {
+	nm.stop()
+	nm.watchers.Wait()
+}
+
+// Next 分配下一个 nonce，并发调用不会得到相同的值
+func (nm *NonceManager) Next(ctx context.Context) (uint64, error) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if !nm.synced {
+		if err := nm.syncLocked(ctx); err != nil {
+			return 0, err
+		}
+	}
+	nonce := nm.next
+	nm.next++
+	return nonce, nil
+}
+
+// OnResult 设置交易最终结果的回调，需在发送交易前设置
+func (nm *NonceManager) OnResult(fn txResultFunc) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	nm.onResult = fn
+}
+
+// report 调用结果回调
+func (nm *NonceManager) report(hash common.Hash, err error) {
+	nm.mu.Lock()
+	fn := nm.onResult
+	nm.mu.Unlock()
+	if fn != nil {
+		fn(hash, err)
+	}
+}
+
+// Resync 标记本地 nonce 失效，下一次分配前从节点重新读取
+func (nm *NonceManager) Resync() {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	nm.synced = false
+}
+
+func (nm *NonceManager) syncLocked(ctx context.Context) error {
+	callCtx, cancel := withRPCTimeout(ctx, nm.cfg.RPCCallTimeout)
+	defer cancel()
+	nonce, err := nm.client.PendingNonceAt(callCtx, nm.account)
+	if err != nil {
+		return fmt.Errorf("获取账户 %s 的 nonce 失败: %w", nm.account.Hex(), err)
+	}
+	nm.next = nonce
+	nm.synced = true
+	return nil
+}
+
+// Send 分配 nonce、签名并广播交易，成功后在后台等待上链并按需提价重发
+// 节点报告 nonce 冲突时重新同步并换用新 nonce 重试；其他发送错误会让下一笔交易前重新同步
+func (nm *NonceManager) Send(ctx context.Context, price GasPrice, sign signTxFunc) (*types.Transaction, error) {
+	for attempt := 0; ; attempt++ {
+		nonce, err := nm.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := sign(nonce, price)
+		if err != nil {
+			// 已分配的 nonce 不会被使用，重新同步以免留下缺口
+			nm.Resync()
+			return nil, fmt.Errorf("签名交易失败: %w", err)
+		}
+
+		callCtx, cancel := withRPCTimeout(ctx, nm.cfg.RPCCallTimeout)
+		err = nm.client.SendTransaction(callCtx, tx)
+		cancel()
+		if err == nil {
+			nm.watchers.Add(1)
+			go func() {
+				defer nm.watchers.Done()
+				nm.watchDetached(tx, price, sign)
+			}()
+			return tx, nil
+		}
+
+		nm.Resync()
+		if isNonceConflict(err) && attempt < nonceConflictRetries {
+			log.Printf("nonce %d 已被使用，从节点重新同步后重试: %v", nonce, err)
+			continue
+		}
+		return nil, err
+	}
+}
+
+// watchDetached 在独立的 ctx 中跟踪交易：发送方的 ctx（例如单次套利处理）结束后交易仍在链上等待，
+// 跟踪不随它取消，只随 Stop 结束；总时限为全部重发的等待时间加 watchGracePeriod，超时仍无结果时按未上链上报
+func (nm *NonceManager) watchDetached(tx *types.Transaction, price GasPrice, sign signTxFunc) {
+	if nm.cfg.ExecutorResubmitTimeout <= 0 {
+		return
+	}
+	timeout := nm.cfg.ExecutorResubmitTimeout*time.Duration(nm.cfg.ExecutorMaxResubmits+1) + watchGracePeriod
+	ctx, cancel := context.WithTimeout(nm.stopCtx, timeout)
+	defer cancel()
+	nm.watch(ctx, tx, price, sign)
+}
+
+// watch 等待交易上链，超时未上链时以相同 nonce 按 ExecutorGasBumpPercent 提高 gas 定价重发，
+// 最多重发 ExecutorMaxResubmits 次，提价后超过 GAS_MAX_FEE_GWEI 时不再重发；
+// 重发返回 nonce too low 说明该 nonce 已有交易上链：查询已发送各版本的回执，是自己的交易则按回执上报，
+// 查不到则是 nonce 被其他交易占用，按未上链上报
+func (nm *NonceManager) watch(ctx context.Context, tx *types.Transaction, price GasPrice, sign signTxFunc) {
+	hashes := []common.Hash{tx.Hash()}
+	for resubmits := 0; ; resubmits++ {
+		receipt, err := nm.waitMined(ctx, hashes, nm.cfg.ExecutorResubmitTimeout)
+		if err != nil && nm.stopCtx.Err() != nil {
+			log.Printf("停机，停止跟踪交易 nonce %d: %s", tx.Nonce(), hashes[len(hashes)-1].Hex())
+			return
+		}
+		if err != nil {
+			nm.report(hashes[len(hashes)-1], fmt.Errorf("跟踪交易 nonce %d 超时: %w", tx.Nonce(), err))
+			return
+		}
+		if receipt != nil {
+			nm.reportReceipt(receipt)
+			return
+		}
+		if resubmits >= nm.cfg.ExecutorMaxResubmits {
+			log.Printf("交易 nonce %d 重发 %d 次后仍未上链，停止重发: %s", tx.Nonce(), resubmits, hashes[len(hashes)-1].Hex())
+			nm.report(hashes[len(hashes)-1], fmt.Errorf("交易 nonce %d 重发 %d 次后仍未上链", tx.Nonce(), resubmits))
+			return
+		}
+
+		bumped, ok := price.bump(nm.cfg.ExecutorGasBumpPercent, gasMaxFee(nm.cfg))
+		if !ok {
+			log.Printf("交易 nonce %d 提价后超过 GAS_MAX_FEE_GWEI，停止重发: %s", tx.Nonce(), hashes[len(hashes)-1].Hex())
+			nm.report(hashes[len(hashes)-1], fmt.Errorf("交易 nonce %d 重发 %d 次后仍未上链，已达 gas 价格上限", tx.Nonce(), resubmits))
+			return
+		}
+		price = bumped
+		replacement, err := sign(tx.Nonce(), price)
+		if err != nil {
+			log.Printf("重新签名交易 nonce %d 失败: %v", tx.Nonce(), err)
+			return
+		}
+		callCtx, cancel := withRPCTimeout(ctx, nm.cfg.RPCCallTimeout)
+		err = nm.client.SendTransaction(callCtx, replacement)
+		cancel()
+		if err != nil {
+			if isNonceTooLow(err) {
+				nm.resolveNonceUsed(ctx, tx.Nonce(), hashes)
+				return
+			}
+			log.Printf("重发交易 nonce %d 失败: %v", tx.Nonce(), err)
+			continue
+		}
+		hashes = append(hashes, replacement.Hash())
+		log.Printf("交易 nonce %d 超过 %s 未上链，提价至 %s 重发: %s",
+			tx.Nonce(), nm.cfg.ExecutorResubmitTimeout, price, replacement.Hash().Hex())
+	}
+}
+
+// resolveNonceUsed 重发时 nonce 已被使用：已上链的交易回执可能尚未被节点索引，在一个重发周期内等待已发送各版本的回执
+func (nm *NonceManager) resolveNonceUsed(ctx context.Context, nonce uint64, hashes []common.Hash) {
+	receipt, err := nm.waitMined(ctx, hashes, nm.cfg.ExecutorResubmitTimeout)
+	if err == nil && receipt != nil {
+		nm.reportReceipt(receipt)
+		return
+	}
+	log.Printf("交易 nonce %d 已被其他交易使用，已发送的 %d 个版本均未上链", nonce, len(hashes))
+	nm.report(hashes[len(hashes)-1], fmt.Errorf("交易 nonce %d 已被其他交易使用，未上链", nonce))
+}
+
+// reportReceipt 按回执状态上报交易结果
+func (nm *NonceManager) reportReceipt(receipt *types.Receipt) {
+	if receipt.Status == types.ReceiptStatusFailed {
+		log.Printf("交易 %s 已上链但执行回滚（区块 %s）", receipt.TxHash.Hex(), receipt.BlockNumber)
+		nm.report(receipt.TxHash, fmt.Errorf("交易 %s 执行回滚", receipt.TxHash.Hex()))
+		return
+	}
+	nm.report(receipt.TxHash, nil)
+}
+
+// waitMined 在 timeout 内轮询回执，返回任一已上链哈希的回执，超时仍未上链时返回 nil
+func (nm *NonceManager) waitMined(ctx context.Context, hashes []common.Hash, timeout time.Duration) (*types.Receipt, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		for _, hash := range hashes {
+			callCtx, cancel := withRPCTimeout(ctx, nm.cfg.RPCCallTimeout)
+			receipt, err := nm.client.TransactionReceipt(callCtx, hash)
+			cancel()
+			if err == nil && receipt != nil {
+				if receipt.TxHash == (common.Hash{}) {
+					receipt.TxHash = hash
+				}
+				return receipt, nil
+			}
+			if err != nil && !errors.Is(err, ethereum.NotFound) {
+				log.Printf("查询交易 %s 回执失败: %v", hash.Hex(), err)
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return nil, nil
+		}
+		if err := sleepContext(ctx, nm.pollInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// bumpGasPrice 按百分比提高 gas 价格，节点要求替换交易至少提价 10%，结果至少比原价高 1 wei
+func bumpGasPrice(gasPrice *big.Int, percent int) *big.Int {
+	bumped := new(big.Int).Mul(gasPrice, big.NewInt(int64(100+percent)))
+	bumped.Quo(bumped, big.NewInt(100))
+	if bumped.Cmp(gasPrice) <= 0 {
+		bumped.Add(gasPrice, big.NewInt(1))
+	}
+	return bumped
+}
+
+// isNonceTooLow 判断节点是否因 nonce 已上链而拒绝交易
+func isNonceTooLow(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "nonce too low")
+}
+
+// isNonceConflict 判断 nonce 是否已被其他交易占用：已上链，或交易池中已有同 nonce 的交易
+// （补齐缺口后重新同步得到的 nonce 可能与缺口之后排队的交易重复）
+func isNonceConflict(err error) bool {
+	if isNonceTooLow(err) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "replacement transaction underpriced")
+}
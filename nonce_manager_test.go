@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// mockNonceBackend 模拟节点：第 i 次 SendTransaction 返回 sendErrs[i]，
+// 成功发送的第 i 个版本在 mined[i] 返回 true 后可以查到成功回执
+type mockNonceBackend struct {
+	mu       sync.Mutex
+	sendErrs map[int]error
+	mined    map[int]func(sends, queries int) bool
+	sends    int
+	queries  int
+	sent     map[common.Hash]int
+}
+
+func (b *mockNonceBackend) PendingNonceAt(context.Context, common.Address) (uint64, error) {
+	return 7, nil
+}
+
+func (b *mockNonceBackend) SendTransaction(_ context.Context, tx *types.Transaction) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	index := b.sends
+	b.sends++
+	if err := b.sendErrs[index]; err != nil {
+		return err
+	}
+	b.sent[tx.Hash()] = index
+	return nil
+}
+
+func (b *mockNonceBackend) TransactionReceipt(_ context.Context, hash common.Hash) (*types.Receipt, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queries++
+	index, ok := b.sent[hash]
+	if !ok || b.mined[index] == nil || !b.mined[index](b.sends, b.queries) {
+		return nil, ethereum.NotFound
+	}
+	return &types.Receipt{TxHash: hash, Status: types.ReceiptStatusSuccessful, BlockNumber: big.NewInt(1)}, nil
+}
+
+// minedNow 该版本一经发送即可查到回执
+func minedNow(int, int) bool { return true }
+
+// TestNonceManagerWatch 后台跟踪不随发送方 ctx 取消；重发返回 nonce too low 时按已发送版本的回执上报
+func TestNonceManagerWatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		sendErrs     map[int]error
+		mined        map[int]func(sends, queries int) bool
+		cancelCaller bool
+		// wantVersion 期望上报的交易版本（第几次成功发送），-1 表示期望上报失败
+		wantVersion int
+		wantErr     bool
+	}{
+		{name: "mined before resubmit", mined: map[int]func(int, int) bool{0: minedNow}, wantVersion: 0},
+		{name: "replacement mined", mined: map[int]func(int, int) bool{1: minedNow}, wantVersion: 1},
+		{
+			name:     "resubmit nonce too low, original mined",
+			sendErrs: map[int]error{1: errors.New("nonce too low")},
+			// 原交易的回执在重发被拒绝后才被节点索引
+			mined:       map[int]func(int, int) bool{0: func(sends, _ int) bool { return sends >= 2 }},
+			wantVersion: 0,
+		},
+		{name: "nonce used by another transaction", sendErrs: map[int]error{1: errors.New("nonce too low")}, wantErr: true},
+		{
+			name:         "caller context cancelled",
+			mined:        map[int]func(int, int) bool{0: func(_, queries int) bool { return queries >= 3 }},
+			cancelCaller: true,
+			wantVersion:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &mockNonceBackend{sendErrs: tt.sendErrs, mined: tt.mined, sent: make(map[common.Hash]int)}
+			cfg := &AppConfig{RPCCallTimeout: time.Second, ExecutorResubmitTimeout: 20 * time.Millisecond, ExecutorMaxResubmits: 2, ExecutorGasBumpPercent: 10}
+			key, err := crypto.GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			nm := NewNonceManager(backend, cfg, crypto.PubkeyToAddress(key.PublicKey))
+			nm.pollInterval = 5 * time.Millisecond
+			type result struct {
+				hash common.Hash
+				err  error
+			}
+			results := make(chan result, 4)
+			nm.OnResult(func(hash common.Hash, err error) { results <- result{hash, err} })
+
+			var versions []common.Hash
+			sign := func(nonce uint64, price GasPrice) (*types.Transaction, error) {
+				tx, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: nonce, GasPrice: price.GasPrice, Gas: 21000}), types.HomesteadSigner{}, key)
+				if err == nil {
+					versions = append(versions, tx.Hash())
+				}
+				return tx, err
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if _, err := nm.Send(ctx, GasPrice{Legacy: true, GasPrice: big.NewInt(1e9)}, sign); err != nil {
+				t.Fatal(err)
+			}
+			if tt.cancelCaller {
+				cancel()
+			}
+
+			select {
+			case got := <-results:
+				if tt.wantErr {
+					if got.err == nil {
+						t.Fatalf("期望上报失败，得到成功 %s", got.hash.Hex())
+					}
+					return
+				}
+				if got.err != nil || got.hash != versions[tt.wantVersion] {
+					t.Fatalf("上报 %s (%v)，期望第 %d 个版本 %s 成功", got.hash.Hex(), got.err, tt.wantVersion, versions[tt.wantVersion].Hex())
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("等待交易结果超时")
+			}
+		})
+	}
+}
+
+// TestNonceManagerStop Stop 结束仍在跟踪的交易且不上报结果，等跟踪协程全部退出后才返回
+func TestNonceManagerStop(t *testing.T) {
+	tests := []struct {
+		name  string
+		sends int
+	}{
+		{name: "no pending transactions"},
+		{name: "pending transactions stop watching", sends: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &mockNonceBackend{sent: make(map[common.Hash]int)}
+			cfg := &AppConfig{RPCCallTimeout: time.Second, ExecutorResubmitTimeout: time.Hour, ExecutorMaxResubmits: 2, ExecutorGasBumpPercent: 10}
+			key, err := crypto.GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			nm := NewNonceManager(backend, cfg, crypto.PubkeyToAddress(key.PublicKey))
+			nm.pollInterval = 5 * time.Millisecond
+			reported := make(chan error, tt.sends)
+			nm.OnResult(func(_ common.Hash, err error) { reported <- err })
+			sign := func(nonce uint64, price GasPrice) (*types.Transaction, error) {
+				return types.SignTx(types.NewTx(&types.LegacyTx{Nonce: nonce, GasPrice: price.GasPrice, Gas: 21000}), types.HomesteadSigner{}, key)
+			}
+			for i := 0; i < tt.sends; i++ {
+				if _, err := nm.Send(context.Background(), GasPrice{Legacy: true, GasPrice: big.NewInt(1e9)}, sign); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stopped := make(chan struct{})
+			go func() {
+				nm.Stop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Stop 等待跟踪协程超时")
+			}
+			select {
+			case err := <-reported:
+				t.Fatalf("停机时上报了交易结果 %v，期望不上报", err)
+			default:
+			}
+		})
+	}
+}
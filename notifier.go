@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 通知事件类型
+const (
+	// NotifyOpportunityConfirmed 确认并提交了套利机会
+	NotifyOpportunityConfirmed = "opportunity_confirmed"
+	// NotifySubscriptionDown 区块/日志订阅断开，正在退避重连
+	NotifySubscriptionDown = "subscription_down"
+	// NotifySubscriptionRecovered 订阅已恢复
+	NotifySubscriptionRecovered = "subscription_recovered"
+	// NotifyBreakerTripped 执行熔断器已熔断
+	NotifyBreakerTripped = "breaker_tripped"
+	// NotifyBreakerRecovered 执行熔断器已恢复
+	NotifyBreakerRecovered = "breaker_recovered"
+	// NotifyStoreDown 存储熔断，新池子暂存在内存中
+	NotifyStoreDown = "store_down"
+	// NotifyStoreRecovered 存储已恢复
+	NotifyStoreRecovered = "store_recovered"
+)
+
+// telegramAPIURL Telegram Bot API 地址，%s 为 bot token
+const telegramAPIURL = "https://api.telegram.org/bot%s/sendMessage"
+
+// NotificationEvent 推送给各通知渠道的事件；Message 为可直接阅读的摘要，Opportunity 只在确认套利机会时设置
+type NotificationEvent struct {
+	Kind        string
+	Message     string
+	Opportunity *webhookPayload
+	Time        time.Time
+}
+
+// Notifier 通知渠道
+type Notifier interface {
+	Notify(ctx context.Context, event NotificationEvent) error
+}
+
+// LogNotifier 将事件输出到标准日志
+type LogNotifier struct{}
+
+// Notify 输出事件摘要
+func (LogNotifier) Notify(ctx context.Context, event NotificationEvent) error {
+	log.Printf("[通知] %s: %s", event.Kind, event.Message)
+	return nil
+}
+
+// telegramMessage Telegram sendMessage 请求体，使用纯文本避免 Markdown 转义问题
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+// TelegramNotifier 通过 Telegram Bot 向 TELEGRAM_CHAT_ID 发送事件摘要
+type TelegramNotifier struct {
+	url    string
+	chatID string
+	client *http.Client
+}
+
+// NewTelegramNotifier 创建 Telegram 推送器，未配置 TELEGRAM_TOKEN 或 TELEGRAM_CHAT_ID 时返回 nil
+func NewTelegramNotifier(cfg *AppConfig) *TelegramNotifier {
+	if cfg.TelegramToken == "" || cfg.TelegramChatID == "" {
+		return nil
+	}
+	return &TelegramNotifier{
+		url:    fmt.Sprintf(telegramAPIURL, cfg.TelegramToken),
+		chatID: cfg.TelegramChatID,
+		client: &http.Client{Timeout: cfg.WebhookTimeout},
+	}
+}
+
+// newTelegramMessage 构建消息：首行为事件类型，其后为摘要
+func newTelegramMessage(chatID string, event NotificationEvent) telegramMessage {
+	return telegramMessage{
+		ChatID:                chatID,
+		Text:                  fmt.Sprintf("[%s]\n%s", event.Kind, event.Message),
+		DisableWebPagePreview: true,
+	}
+}
+
+// Notify 发送消息，Telegram 返回非 2xx 时视为失败；错误信息不包含 bot token
+func (tn *TelegramNotifier) Notify(ctx context.Context, event NotificationEvent) error {
+	body, err := json.Marshal(newTelegramMessage(tn.chatID, event))
+	if err != nil {
+		return fmt.Errorf("序列化 Telegram 消息失败: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tn.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建 Telegram 请求失败")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := tn.client.Do(req)
+	if err != nil {
+		// *url.Error 中带有包含 token 的请求地址，只保留底层错误
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("Telegram 请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Telegram 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MultiNotifier 将事件分发给所有配置的通知渠道，单个渠道失败不影响其他渠道
+type MultiNotifier struct {
+	sinks []Notifier
+}
+
+// NewMultiNotifier 创建多渠道推送器，忽略为 nil 的渠道
+func NewMultiNotifier(sinks ...Notifier) *MultiNotifier {
+	mn := &MultiNotifier{}
+	for _, sink := range sinks {
+		if sink != nil {
+			mn.sinks = append(mn.sinks, sink)
+		}
+	}
+	return mn
+}
+
+// NewNotifier 按配置创建通知渠道：NOTIFY_LOG 开启时输出日志，配置了 WEBHOOK_URL 时推送 webhook，
+// 配置了 TELEGRAM_TOKEN 与 TELEGRAM_CHAT_ID 时推送 Telegram
+func NewNotifier(cfg *AppConfig) *MultiNotifier {
+	var sinks []Notifier
+	if cfg.NotifyLog {
+		sinks = append(sinks, LogNotifier{})
+	}
+	// 具体类型的 nil 指针放进接口后不等于 nil，需要在这里判断
+	if webhook := NewWebhookNotifier(cfg); webhook != nil {
+		sinks = append(sinks, webhook)
+	}
+	if telegram := NewTelegramNotifier(cfg); telegram != nil {
+		sinks = append(sinks, telegram)
+	}
+	return NewMultiNotifier(sinks...)
+}
+
+// Notify 依次投递到每个渠道，返回所有失败渠道的错误（errors.Join），全部成功时返回 nil
+func (mn *MultiNotifier) Notify(ctx context.Context, event NotificationEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	var errs []error
+	for _, sink := range mn.sinks {
+		if err := sink.Notify(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%T: %w", sink, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotifyAsync 在独立 goroutine 中投递，失败只记录日志，不阻塞调用方
+func (mn *MultiNotifier) NotifyAsync(ctx context.Context, event NotificationEvent) {
+	if mn == nil || len(mn.sinks) == 0 {
+		return
+	}
+	go func() {
+		if err := mn.Notify(ctx, event); err != nil {
+			log.Printf("通知 %s 推送失败: %s", event.Kind, strings.ReplaceAll(err.Error(), "\n", "; "))
+		}
+	}()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// ArbLogFormatText 套利机会日志输出为中文文本（默认）
+	ArbLogFormatText = "text"
+	// ArbLogFormatKV 套利机会日志输出为 key=value 格式，便于日志系统解析
+	ArbLogFormatKV = "kv"
+)
+
+// tokenLabel 返回代币符号，符号未知时返回地址
+func tokenLabel(tokens *TokenRegistry, token common.Address) string {
+	if meta, ok := tokens.Get(token); ok && meta.Symbol != "" {
+		return meta.Symbol
+	}
+	return token.Hex()
+}
+
+// humanAmount 按代币精度将最小单位数量换算为代币个数，精度未知时返回 false
+func humanAmount(tokens *TokenRegistry, token common.Address, raw float64) (float64, bool) {
+	meta, ok := tokens.Get(token)
+	if !ok || meta.Decimals == decimalsUnknown {
+		return 0, false
+	}
+	return raw / math.Pow10(meta.Decimals), true
+}
+
+// formatTokenAmount 将最小单位数量格式化为「1.500000 WBNB (≈ 900.0000 USD)」
+// 精度未知时输出最小单位数量，价格未知时省略 USD 部分
+func formatTokenAmount(tokens *TokenRegistry, oracle *PriceOracle, token common.Address, raw float64) string {
+	symbol := tokenLabel(tokens, token)
+	text := fmt.Sprintf("%.0f %s(最小单位)", raw, symbol)
+	if amount, ok := humanAmount(tokens, token, raw); ok {
+		text = fmt.Sprintf("%.6f %s", amount, symbol)
+	}
+	if price, ok := oracle.PriceOf(token); ok {
+		text += fmt.Sprintf(" (≈ %.4f USD)", raw*price)
+	}
+	return text
+}
+
+// opportunityFields 将套利机会格式化为 key=value 形式，数量字段为最小单位，USD 字段价格未知时为 0
+func opportunityFields(tokens *TokenRegistry, oracle *PriceOracle, stage string, opportunity ArbitrageOpportunity) string {
+	startToken := common.HexToAddress(opportunity.StartToken)
+	profit := opportunity.EstimatedReturn - opportunity.InitialAmount
+	pools := make([]string, len(opportunity.Path))
+	for i, step := range opportunity.Path {
+		pools[i] = step.Pool.Address.Hex()
+	}
+	return fmt.Sprintf("opportunity stage=%s start_token=%s symbol=%q hops=%d initial=%.0f initial_usd=%.6f return=%.0f return_usd=%.6f profit=%.0f profit_usd=%.6f cost_usd=%.6f pools=%s",
+		stage, startToken.Hex(), tokenLabel(tokens, startToken), len(opportunity.Path),
+		opportunity.InitialAmount, oracle.ToUSD(startToken, opportunity.InitialAmount),
+		opportunity.EstimatedReturn, oracle.ToUSD(startToken, opportunity.EstimatedReturn),
+		profit, oracle.ToUSD(startToken, profit), opportunity.Cost.Total(), strings.Join(pools, ","))
+}
+
+// logOpportunity 按 ArbLogFormat 输出套利机会日志：kv 格式时输出 opportunityFields，否则输出给定的文本
+func logOpportunity(cfg *AppConfig, tokens *TokenRegistry, oracle *PriceOracle, stage string, opportunity ArbitrageOpportunity, format string, args ...any) {
+	if cfg.ArbLogFormat == ArbLogFormatKV {
+		log.Print(opportunityFields(tokens, oracle, stage, opportunity))
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// opportunityStatsTopTokens 统计中按出现次数返回的代币数量上限
+const opportunityStatsTopTokens = 20
+
+// OpportunityRecord 计算者确认的一次套利机会，写入 opportunities 表供 /stats 统计
+type OpportunityRecord struct {
+	StartToken common.Address
+	// Tokens 套利环经过的代币，重复出现的代币只统计一次
+	Tokens []common.Address
+	Pools  []common.Address
+	// ProfitUSD 扣除执行成本后的预期净利润
+	ProfitUSD float64
+	At        time.Time
+}
+
+// HourlyOpportunityStats 按整点分组的套利机会统计
+type HourlyOpportunityStats struct {
+	Hour         time.Time `json:"hour"`
+	Count        int64     `json:"count"`
+	AvgProfitUSD float64   `json:"avg_profit_usd"`
+	MaxProfitUSD float64   `json:"max_profit_usd"`
+}
+
+// TokenOpportunityStats 单个代币出现在已确认套利环中的次数与平均净利润
+type TokenOpportunityStats struct {
+	Token        string  `json:"token"`
+	Count        int64   `json:"count"`
+	AvgProfitUSD float64 `json:"avg_profit_usd"`
+}
+
+// OpportunityStats 一段时间内已确认套利机会的汇总
+type OpportunityStats struct {
+	Since        time.Time                `json:"since"`
+	Total        int64                    `json:"total"`
+	AvgProfitUSD float64                  `json:"avg_profit_usd"`
+	MaxProfitUSD float64                  `json:"max_profit_usd"`
+	Hourly       []HourlyOpportunityStats `json:"hourly"`
+	TopTokens    []TokenOpportunityStats  `json:"top_tokens"`
+}
+
+// RecordOpportunity 写入一次已确认的套利机会，同时按代币（去重后）写入 opportunity_tokens 供按代币聚合
+func (ps *PoolStore) RecordOpportunity(record OpportunityRecord) error {
+	const insertOpportunity = `
+INSERT INTO opportunities (start_token, hops, tokens, pools, profit_usd, created_at)
+VALUES (?, ?, ?, ?, ?, ?)`
+	const insertToken = `
+INSERT INTO opportunity_tokens (token, profit_usd, created_at)
+VALUES (?, ?, ?)`
+
+	at := record.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	var tokens []common.Address
+	for _, token := range record.Tokens {
+		if indexOfAddress(tokens, token) < 0 {
+			tokens = append(tokens, token)
+		}
+	}
+
+	ps.lock()
+	defer ps.unlock()
+
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(ps.dialect.rebind(insertOpportunity), record.StartToken.Hex(), len(record.Pools),
+		joinAddresses(tokens), joinAddresses(record.Pools), record.ProfitUSD, dbTime(at)); err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if _, err := tx.Exec(ps.dialect.rebind(insertToken), token.Hex(), record.ProfitUSD, dbTime(at)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteOpportunitiesBefore 在同一个事务中删除 before 之前的套利机会及其按代币的记录，返回删除的套利机会数量
+func (ps *PoolStore) DeleteOpportunitiesBefore(ctx context.Context, before time.Time) (int64, error) {
+	ps.lock()
+	defer ps.unlock()
+
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, ps.dialect.rebind(`DELETE FROM opportunities WHERE created_at < ?`), dbTime(before))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, ps.dialect.rebind(`DELETE FROM opportunity_tokens WHERE created_at < ?`), dbTime(before)); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// OpportunityStats 汇总 since 之后确认的套利机会：总数与平均/最大净利润、按整点分组的统计、出现次数最多的代币
+// 三个查询都只按 created_at 范围过滤，走 created_at 索引，不随表的总行数变慢
+func (ps *PoolStore) OpportunityStats(ctx context.Context, since time.Time) (OpportunityStats, error) {
+	const totalStmt = `
+SELECT COUNT(*), COALESCE(AVG(profit_usd), 0), COALESCE(MAX(profit_usd), 0)
+FROM opportunities
+WHERE created_at >= ?`
+	hourlyStmt := `
+SELECT ` + ps.dialect.hourBucket("created_at") + `, COUNT(*), AVG(profit_usd), MAX(profit_usd)
+FROM opportunities
+WHERE created_at >= ?
+GROUP BY 1
+ORDER BY 1`
+	const tokensStmt = `
+SELECT token, COUNT(*), AVG(profit_usd)
+FROM opportunity_tokens
+WHERE created_at >= ?
+GROUP BY token
+ORDER BY COUNT(*) DESC, token
+LIMIT ?`
+
+	ps.rlock()
+	defer ps.runlock()
+
+	stats := OpportunityStats{
+		Since:     since.UTC().Truncate(time.Second),
+		Hourly:    []HourlyOpportunityStats{},
+		TopTokens: []TokenOpportunityStats{},
+	}
+	sinceArg := dbTime(since)
+	if err := ps.db.QueryRowContext(ctx, ps.dialect.rebind(totalStmt), sinceArg).Scan(&stats.Total, &stats.AvgProfitUSD, &stats.MaxProfitUSD); err != nil {
+		return OpportunityStats{}, fmt.Errorf("统计套利机会总数失败: %w", err)
+	}
+
+	rows, err := ps.db.QueryContext(ctx, ps.dialect.rebind(hourlyStmt), sinceArg)
+	if err != nil {
+		return OpportunityStats{}, fmt.Errorf("按小时统计套利机会失败: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			bucket string
+			hourly HourlyOpportunityStats
+		)
+		if err := rows.Scan(&bucket, &hourly.Count, &hourly.AvgProfitUSD, &hourly.MaxProfitUSD); err != nil {
+			return OpportunityStats{}, err
+		}
+		if hourly.Hour, err = time.Parse(time.DateTime, strings.TrimSpace(bucket)); err != nil {
+			return OpportunityStats{}, fmt.Errorf("解析统计时段 %q 失败: %w", bucket, err)
+		}
+		stats.Hourly = append(stats.Hourly, hourly)
+	}
+	if err := rows.Err(); err != nil {
+		return OpportunityStats{}, err
+	}
+
+	tokenRows, err := ps.db.QueryContext(ctx, ps.dialect.rebind(tokensStmt), sinceArg, opportunityStatsTopTokens)
+	if err != nil {
+		return OpportunityStats{}, fmt.Errorf("按代币统计套利机会失败: %w", err)
+	}
+	defer tokenRows.Close()
+	for tokenRows.Next() {
+		var token TokenOpportunityStats
+		if err := tokenRows.Scan(&token.Token, &token.Count, &token.AvgProfitUSD); err != nil {
+			return OpportunityStats{}, err
+		}
+		stats.TopTokens = append(stats.TopTokens, token)
+	}
+	return stats, tokenRows.Err()
+}
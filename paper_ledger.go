@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PaperTrade 模拟交易账本中的一笔记录：按最优投入量成交时的预期收益与复核后的模拟实际收益
+type PaperTrade struct {
+	StartToken common.Address
+	Pools      []common.Address
+	// AmountIn 最优投入量（起始代币最小单位）
+	AmountIn float64
+	// ExpectedOut 确认时按精算储备量计算的预期输出
+	ExpectedOut float64
+	// RealizedOut 复核时按最新储备量计算的输出，未复核时等于 ExpectedOut
+	RealizedOut float64
+	// ExpectedPnLUSD 确认时的预期净利润（已扣除执行成本）
+	ExpectedPnLUSD float64
+	// RealizedPnLUSD 按 RealizedOut 重新计算的模拟实际净利润，可能为负
+	RealizedPnLUSD float64
+	// Rechecked 是否已按最新储备量复核
+	Rechecked bool
+	// Unpriced 起始代币没有 USD 价格，两个 PnL 字段为 0 且不计入 USD 盈亏汇总
+	Unpriced bool
+	At       time.Time
+}
+
+// PaperStats 模拟交易账本的汇总：时间范围内的笔数与盈亏，以及账本开始以来的累计盈亏
+// 起始代币没有 USD 价格的交易计入笔数与 Unpriced，不计入盈利笔数与 USD 盈亏
+type PaperStats struct {
+	Since          time.Time `json:"since"`
+	Trades         int64     `json:"trades"`
+	Rechecked      int64     `json:"rechecked"`
+	Profitable     int64     `json:"profitable"`
+	Unpriced       int64     `json:"unpriced"`
+	ExpectedPnLUSD float64   `json:"expected_pnl_usd"`
+	RealizedPnLUSD float64   `json:"realized_pnl_usd"`
+	// CumulativeTrades、CumulativeUnpriced 与 CumulativePnLUSD 不受时间范围限制
+	CumulativeTrades   int64   `json:"cumulative_trades"`
+	CumulativeUnpriced int64   `json:"cumulative_unpriced"`
+	CumulativePnLUSD   float64 `json:"cumulative_pnl_usd"`
+}
+
+// RecordPaperTrade 写入一笔模拟交易
+func (ps *PoolStore) RecordPaperTrade(trade PaperTrade) error {
+	const insertStmt = `
+INSERT INTO paper_trades (start_token, hops, pools, amount_in, expected_out, realized_out,
+	expected_pnl_usd, realized_pnl_usd, rechecked, unpriced, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	at := trade.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	ps.lock()
+	defer ps.unlock()
+
+	_, err := ps.db.Exec(ps.dialect.rebind(insertStmt), trade.StartToken.Hex(), len(trade.Pools), joinAddresses(trade.Pools),
+		trade.AmountIn, trade.ExpectedOut, trade.RealizedOut, trade.ExpectedPnLUSD, trade.RealizedPnLUSD, trade.Rechecked, trade.Unpriced, dbTime(at))
+	return err
+}
+
+// PaperStats 汇总 since 之后的模拟交易，以及全部模拟交易的累计笔数与模拟实际净利润；USD 盈亏只汇总有价格的交易
+func (ps *PoolStore) PaperStats(ctx context.Context, since time.Time) (PaperStats, error) {
+	const windowStmt = `
+SELECT COUNT(*),
+	COALESCE(SUM(CASE WHEN rechecked THEN 1 ELSE 0 END), 0),
+	COALESCE(SUM(CASE WHEN NOT unpriced AND realized_pnl_usd > 0 THEN 1 ELSE 0 END), 0),
+	COALESCE(SUM(CASE WHEN unpriced THEN 1 ELSE 0 END), 0),
+	COALESCE(SUM(CASE WHEN unpriced THEN 0 ELSE expected_pnl_usd END), 0),
+	COALESCE(SUM(CASE WHEN unpriced THEN 0 ELSE realized_pnl_usd END), 0)
+FROM paper_trades
+WHERE created_at >= ?`
+	const cumulativeStmt = `
+SELECT COUNT(*),
+	COALESCE(SUM(CASE WHEN unpriced THEN 1 ELSE 0 END), 0),
+	COALESCE(SUM(CASE WHEN unpriced THEN 0 ELSE realized_pnl_usd END), 0)
+FROM paper_trades`
+
+	ps.rlock()
+	defer ps.runlock()
+
+	stats := PaperStats{Since: since.UTC().Truncate(time.Second)}
+	if err := ps.db.QueryRowContext(ctx, ps.dialect.rebind(windowStmt), dbTime(since)).Scan(
+		&stats.Trades, &stats.Rechecked, &stats.Profitable, &stats.Unpriced, &stats.ExpectedPnLUSD, &stats.RealizedPnLUSD); err != nil {
+		return PaperStats{}, fmt.Errorf("统计模拟交易失败: %w", err)
+	}
+	if err := ps.db.QueryRowContext(ctx, cumulativeStmt).Scan(&stats.CumulativeTrades, &stats.CumulativeUnpriced, &stats.CumulativePnLUSD); err != nil {
+		return PaperStats{}, fmt.Errorf("统计模拟交易累计盈亏失败: %w", err)
+	}
+	return stats, nil
+}
+
+// paperRequoteFunc 按最新储备量重新计算套利路径在指定投入量下的输出
+type paperRequoteFunc func(ctx context.Context, opportunity ArbitrageOpportunity, amountIn float64) (float64, error)
+
+// PaperLedger 模拟交易账本：不提交任何交易，只把计算者确认的每个套利机会按最优投入量记一笔账
+// 配置了 PAPER_RECHECK_DELAY 时等待约一个区块后按存储中的最新储备量重新报价，用复核后的输出计算模拟实际盈亏，
+// 衡量确认到上链之间储备量变化造成的收益损耗；复核在独立 goroutine 中进行，不阻塞计算者
+type PaperLedger struct {
+	store        Store
+	requote      paperRequoteFunc
+	recheckDelay time.Duration
+	bribePercent float64
+	// rechecks 等待复核的协程，停机时 Wait 等待它们记账后才关闭存储
+	rechecks sync.WaitGroup
+}
+
+// NewPaperLedger 创建模拟交易账本，requote 为 nil 或 PAPER_RECHECK_DELAY 为 0 时不复核
+func NewPaperLedger(store Store, requote paperRequoteFunc, cfg *AppConfig) *PaperLedger {
+	return &PaperLedger{
+		store:        store,
+		requote:      requote,
+		recheckDelay: cfg.PaperRecheckDelay,
+		bribePercent: cfg.ExecBribePercent,
+	}
+}
+
+// Record 为确认的套利机会记一笔模拟交易，unitPriceUSD 为每单位起始代币的 USD 价格；
+// priced 为 false 时起始代币没有 USD 价格，按 Unpriced 记账，只记录投入与输出，不计 USD 盈亏
+func (pl *PaperLedger) Record(ctx context.Context, opportunity ArbitrageOpportunity, unitPriceUSD float64, priced bool) {
+	trade := PaperTrade{
+		StartToken:  common.HexToAddress(opportunity.StartToken),
+		AmountIn:    opportunity.InitialAmount,
+		ExpectedOut: opportunity.EstimatedReturn,
+		RealizedOut: opportunity.EstimatedReturn,
+		Unpriced:    !priced,
+		At:          time.Now(),
+	}
+	for _, step := range opportunity.Path {
+		trade.Pools = append(trade.Pools, step.Pool.Address)
+	}
+	if priced {
+		trade.ExpectedPnLUSD = pl.netPnL(opportunity.Cost, trade.ExpectedOut-trade.AmountIn, unitPriceUSD)
+		trade.RealizedPnLUSD = trade.ExpectedPnLUSD
+	}
+
+	if pl.requote == nil || pl.recheckDelay <= 0 {
+		pl.save(trade)
+		return
+	}
+	pl.rechecks.Add(1)
+	go func() {
+		defer pl.rechecks.Done()
+		// 等待期间退出时按未复核记账，保证每个确认的机会都有记录
+		if err := sleepContext(ctx, pl.recheckDelay); err == nil {
+			out, err := pl.requote(ctx, opportunity, trade.AmountIn)
+			if err != nil {
+				log.Printf("模拟交易复核失败，按预期收益记账: %v, 路径: %s", err, formatOpportunityPath(opportunity))
+			} else {
+				trade.RealizedOut = out
+				if priced {
+					trade.RealizedPnLUSD = pl.netPnL(opportunity.Cost, out-trade.AmountIn, unitPriceUSD)
+				}
+				trade.Rechecked = true
+			}
+		}
+		pl.save(trade)
+	}()
+}
+
+// Wait 等待全部复核协程记账完成；ctx 取消后复核协程不再等待，立即按未复核记账
+func (pl *PaperLedger) Wait() {
+	pl.rechecks.Wait()
+}
+
+// netPnL 将以起始代币计的毛利润换算为 USD 并扣除执行成本；gas 与优先费与收益无关，贿赂按实际毛利润重新计算
+func (pl *PaperLedger) netPnL(cost executionCost, profit, unitPriceUSD float64) float64 {
+	gross := profit * unitPriceUSD
+	net := gross - cost.GasUSD - cost.PriorityFeeUSD
+	if gross > 0 {
+		net -= gross * pl.bribePercent / 100
+	}
+	return net
+}
+
+// save 写入存储，失败只记录日志
+func (pl *PaperLedger) save(trade PaperTrade) {
+	if err := pl.store.RecordPaperTrade(trade); err != nil {
+		log.Printf("记录模拟交易失败: %v", err)
+		return
+	}
+	if trade.Unpriced {
+		log.Printf("模拟交易（起始代币无 USD 价格，不计盈亏）: 起始代币 %s, 投入 %.0f, 预期输出 %.0f, 复核输出 %.0f (已复核 %t)",
+			trade.StartToken.Hex(), trade.AmountIn, trade.ExpectedOut, trade.RealizedOut, trade.Rechecked)
+		return
+	}
+	log.Printf("模拟交易: 起始代币 %s, 投入 %.0f, 预期输出 %.0f, 复核输出 %.0f (已复核 %t), 预期盈亏 %.4f USD, 模拟实际盈亏 %.4f USD",
+		trade.StartToken.Hex(), trade.AmountIn, trade.ExpectedOut, trade.RealizedOut, trade.Rechecked, trade.ExpectedPnLUSD, trade.RealizedPnLUSD)
+}
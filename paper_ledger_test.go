@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestPaperLedgerUnpriced 起始代币没有 USD 价格的模拟交易按 unpriced 记账：计入笔数，不计入盈利笔数与 USD 盈亏
+func TestPaperLedgerUnpriced(t *testing.T) {
+	type record struct {
+		unitPrice float64
+		priced    bool
+		returned  float64
+	}
+	tests := []struct {
+		name           string
+		records        []record
+		wantTrades     int64
+		wantUnpriced   int64
+		wantProfitable int64
+		wantPnLUSD     float64
+	}{
+		{name: "priced only", records: []record{{unitPrice: 2, priced: true, returned: 110}}, wantTrades: 1, wantProfitable: 1, wantPnLUSD: 20},
+		{name: "unpriced only", records: []record{{returned: 1e18}}, wantTrades: 1, wantUnpriced: 1},
+		{
+			name: "unpriced trade does not skew pnl",
+			records: []record{
+				{unitPrice: 2, priced: true, returned: 110},
+				{unitPrice: 2, priced: true, returned: 95},
+				{returned: 1e18},
+			},
+			wantTrades: 3, wantUnpriced: 1, wantProfitable: 1, wantPnLUSD: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestPoolStore(t)
+			ledger := NewPaperLedger(store, nil, &AppConfig{})
+			for _, r := range tt.records {
+				opportunity := ArbitrageOpportunity{StartToken: testAddr(1).Hex(), InitialAmount: 100, EstimatedReturn: r.returned}
+				ledger.Record(context.Background(), opportunity, r.unitPrice, r.priced)
+			}
+			ledger.Wait()
+
+			stats, err := store.PaperStats(context.Background(), time.Now().Add(-time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Trades != tt.wantTrades || stats.Unpriced != tt.wantUnpriced || stats.Profitable != tt.wantProfitable {
+				t.Fatalf("笔数 %d、无价格 %d、盈利 %d，期望 %d、%d、%d",
+					stats.Trades, stats.Unpriced, stats.Profitable, tt.wantTrades, tt.wantUnpriced, tt.wantProfitable)
+			}
+			if stats.ExpectedPnLUSD != tt.wantPnLUSD || stats.RealizedPnLUSD != tt.wantPnLUSD || stats.CumulativePnLUSD != tt.wantPnLUSD {
+				t.Fatalf("预期 %.4f、实际 %.4f、累计 %.4f USD，期望均为 %.4f",
+					stats.ExpectedPnLUSD, stats.RealizedPnLUSD, stats.CumulativePnLUSD, tt.wantPnLUSD)
+			}
+			if stats.CumulativeTrades != tt.wantTrades || stats.CumulativeUnpriced != tt.wantUnpriced {
+				t.Fatalf("累计笔数 %d、累计无价格 %d，期望 %d、%d", stats.CumulativeTrades, stats.CumulativeUnpriced, tt.wantTrades, tt.wantUnpriced)
+			}
+		})
+	}
+}
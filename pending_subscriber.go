@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// provisionalPoolTTL 预判的池子超过该时长仍未在链上确认时丢弃（建池交易可能被替换或一直不上链）
+const provisionalPoolTTL = 10 * time.Minute
+
+// provisionalSweepInterval 定期清理过期预判池子的间隔，没有人查询 /pools/provisional 时集合也不会无限增长
+const provisionalSweepInterval = time.Minute
+
+// provisionalKey 预判池子的唯一键：同一交易对可以在不同工厂、不同 V3 费率档位各建一个池子
+type provisionalKey struct {
+	factory common.Address
+	token0  common.Address
+	token1  common.Address
+	feeTier uint64
+}
+
+// provisionalPool 从内存池中的建池交易预判的池子，链上确认前不写入存储
+type provisionalPool struct {
+	Factory  common.Address `json:"factory"`
+	Protocol string         `json:"protocol"`
+	Token0   common.Address `json:"token0"`
+	Token1   common.Address `json:"token1"`
+	// FeeTier V3 建池时指定的费率档位（单位 1e-6），V2 为 0
+	FeeTier uint64      `json:"fee_tier,omitempty"`
+	TxHash  common.Hash `json:"tx_hash"`
+	SeenAt  time.Time   `json:"seen_at"`
+}
+
+// ProvisionalPools 待确认的预判池子集合，PendingSubscriber 写入，PoolDiscoverer 在收到建池事件时确认
+// 所有方法允许 nil 接收者，未开启 WATCH_MEMPOOL 时为 nil
+type ProvisionalPools struct {
+	mu    sync.Mutex
+	pools map[provisionalKey]provisionalPool
+
+	confirmed atomic.Uint64
+	expired   atomic.Uint64
+}
+
+// NewProvisionalPools 创建预判池子集合
+func NewProvisionalPools() *ProvisionalPools {
+	return &ProvisionalPools{pools: make(map[provisionalKey]provisionalPool)}
+}
+
+// Add 记录预判的池子，已记录过时返回 false
+func (pp *ProvisionalPools) Add(pool provisionalPool) bool {
+	if pp == nil {
+		return false
+	}
+	key := provisionalKey{factory: pool.Factory, token0: pool.Token0, token1: pool.Token1, feeTier: pool.FeeTier}
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if _, ok := pp.pools[key]; ok {
+		return false
+	}
+	pp.pools[key] = pool
+	return true
+}
+
+// Confirm 建池事件上链后移除对应的预判池子，并输出从内存池发现到上链确认的提前量
+func (pp *ProvisionalPools) Confirm(factory, token0, token1 common.Address, feeTier uint64, pool common.Address) {
+	if pp == nil {
+		return
+	}
+	key := provisionalKey{factory: factory, token0: token0, token1: token1, feeTier: feeTier}
+	pp.mu.Lock()
+	provisional, ok := pp.pools[key]
+	delete(pp.pools, key)
+	pp.mu.Unlock()
+	if !ok {
+		return
+	}
+	pp.confirmed.Add(1)
+	log.Printf("预判池子已上链确认 %s (%s %s/%s)，比链上事件提前 %v 发现",
+		pool.Hex(), provisional.Protocol, token0.Hex(), token1.Hex(), time.Since(provisional.SeenAt).Truncate(time.Millisecond))
+}
+
+// Start 每隔 provisionalSweepInterval 丢弃超过 provisionalPoolTTL 的预判池子，直到 ctx 结束
+func (pp *ProvisionalPools) Start(ctx context.Context) {
+	if pp == nil {
+		return
+	}
+	ticker := time.NewTicker(provisionalSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if expired := pp.sweep(now); expired > 0 {
+				log.Printf("丢弃 %d 个超过 %v 未上链确认的预判池子", expired, provisionalPoolTTL)
+			}
+		}
+	}
+}
+
+// sweep 丢弃 now 时已超过 provisionalPoolTTL 的预判池子，返回丢弃数量
+func (pp *ProvisionalPools) sweep(now time.Time) int {
+	cutoff := now.Add(-provisionalPoolTTL)
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	expired := 0
+	for key, pool := range pp.pools {
+		if pool.SeenAt.Before(cutoff) {
+			delete(pp.pools, key)
+			expired++
+		}
+	}
+	pp.expired.Add(uint64(expired))
+	return expired
+}
+
+// List 返回尚未确认的预判池子（按发现时间排序），同时丢弃超过 provisionalPoolTTL 的记录
+func (pp *ProvisionalPools) List() []provisionalPool {
+	if pp == nil {
+		return []provisionalPool{}
+	}
+	pp.sweep(time.Now())
+	pp.mu.Lock()
+	pools := make([]provisionalPool, 0, len(pp.pools))
+	for _, pool := range pp.pools {
+		pools = append(pools, pool)
+	}
+	pp.mu.Unlock()
+	sort.Slice(pools, func(i, j int) bool { return pools[i].SeenAt.Before(pools[j].SeenAt) })
+	return pools
+}
+
+// Counts 返回已上链确认与超时丢弃的预判池子数量
+func (pp *ProvisionalPools) Counts() (confirmed, expired uint64) {
+	if pp == nil {
+		return 0, 0
+	}
+	return pp.confirmed.Load(), pp.expired.Load()
+}
+
+// decodeFactoryCall 解析工厂合约 createPair / createPool 调用的 calldata，
+// 按工厂合约的规则将代币排序为 token0 < token1；V3 的 feeTier 为建池费率档位（单位 1e-6）
+func decodeFactoryCall(data []byte) (token0, token1 common.Address, feeTier uint64, ok bool) {
+	if len(data) < 4+64 {
+		return common.Address{}, common.Address{}, 0, false
+	}
+	selector := data[:4]
+	switch {
+	case bytes.Equal(selector, hexutil.MustDecode(CreatePairSelector)):
+	case bytes.Equal(selector, hexutil.MustDecode(CreatePoolSelector)):
+		if len(data) < 4+96 {
+			return common.Address{}, common.Address{}, 0, false
+		}
+		feeTier = new(big.Int).SetBytes(data[4+64 : 4+96]).Uint64()
+	default:
+		return common.Address{}, common.Address{}, 0, false
+	}
+
+	tokenA := common.BytesToAddress(data[4 : 4+32])
+	tokenB := common.BytesToAddress(data[4+32 : 4+64])
+	if tokenA == tokenB || tokenA == (common.Address{}) || tokenB == (common.Address{}) {
+		return common.Address{}, common.Address{}, 0, false
+	}
+	if tokenA.Cmp(tokenB) > 0 {
+		tokenA, tokenB = tokenB, tokenA
+	}
+	return tokenA, tokenB, feeTier, true
+}
+
+// PendingSubscriber 订阅内存池中的待打包交易，从受监听工厂合约的 createPair / createPool 调用中预判新池子
+// 直接通过 eth_subscribe("newPendingTransactions") 订阅，优先请求完整交易推送；节点不支持时退回只推送哈希的订阅并逐个查询交易，
+// 查询并发受 RPC_CONCURRENCY 限制，饱和时丢弃哈希。预判的池子在建池事件上链前只保存在内存中
+type PendingSubscriber struct {
+	client      *ethclient.Client
+	rpc         *rpc.Client
+	factories   map[common.Address]factorySpec
+	provisional *ProvisionalPools
+	backoff     *backoff
+	cfg         *AppConfig
+	rpcSem      chan struct{}
+}
+
+// NewPendingSubscriber 创建内存池订阅器
+func NewPendingSubscriber(client *ethclient.Client, provisional *ProvisionalPools, cfg *AppConfig) *PendingSubscriber {
+	return &PendingSubscriber{
+		client:      client,
+		rpc:         client.Client(),
+		factories:   GetFactoryProtocols(),
+		provisional: provisional,
+		backoff:     newBackoff(cfg.ReconnectBackoffMin, cfg.ReconnectBackoffMax),
+		cfg:         cfg,
+		rpcSem:      make(chan struct{}, cfg.RPCConcurrency),
+	}
+}
+
+// Start 启动订阅流程，订阅中断后按退避策略重新订阅
+func (ps *PendingSubscriber) Start(ctx context.Context) error {
+	txs := make(chan *types.Transaction, 256)
+	hashes := make(chan common.Hash, 1024)
+
+	for {
+		full := true
+		sub, err := ps.rpc.EthSubscribe(ctx, txs, "newPendingTransactions", true)
+		if err != nil {
+			log.Printf("节点不支持完整交易的内存池订阅，改为订阅交易哈希: %v", err)
+			full = false
+			sub, err = ps.rpc.EthSubscribe(ctx, hashes, "newPendingTransactions")
+		}
+		if err != nil {
+			delay := ps.backoff.Next()
+			log.Printf("订阅内存池失败: %v，%v 后重试", err, delay.Truncate(time.Millisecond))
+			if err := sleepContext(ctx, delay); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Printf("已订阅内存池待打包交易（完整交易推送: %v）", full)
+
+		subscribedAt := time.Now()
+		if err := ps.loop(ctx, txs, hashes, sub); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("内存池监听循环错误: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if time.Since(subscribedAt) >= reconnectStableDuration {
+			ps.backoff.Reset()
+		}
+		delay := ps.backoff.Next()
+		log.Printf("内存池订阅中断，%v 后尝试重新订阅", delay.Truncate(time.Millisecond))
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func (ps *PendingSubscriber) loop(ctx context.Context, txs chan *types.Transaction, hashes chan common.Hash, sub subscription) error {
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return subscriptionError(err, ps.cfg)
+		case tx := <-txs:
+			ps.handleTransaction(tx)
+		case hash := <-hashes:
+			select {
+			case ps.rpcSem <- struct{}{}:
+			default:
+				// 查询已饱和，丢弃该哈希，池子仍会在建池事件上链后被发现
+				continue
+			}
+			go func() {
+				defer func() { <-ps.rpcSem }()
+				callCtx, cancel := withRPCTimeout(ctx, ps.cfg.RPCCallTimeout)
+				defer cancel()
+				tx, _, err := ps.client.TransactionByHash(callCtx, hash)
+				if err == nil {
+					ps.handleTransaction(tx)
+				}
+			}()
+		}
+	}
+}
+
+// handleTransaction 识别调用受监听工厂合约建池方法的交易，记录预判的池子
+func (ps *PendingSubscriber) handleTransaction(tx *types.Transaction) {
+	if tx == nil || tx.To() == nil {
+		return
+	}
+	spec, ok := ps.factories[*tx.To()]
+	if !ok {
+		return
+	}
+	protocol := spec.Protocol
+	token0, token1, feeTier, ok := decodeFactoryCall(tx.Data())
+	if !ok {
+		return
+	}
+	pool := provisionalPool{
+		Factory:  *tx.To(),
+		Protocol: protocol,
+		Token0:   token0,
+		Token1:   token1,
+		FeeTier:  feeTier,
+		TxHash:   tx.Hash(),
+		SeenAt:   time.Now(),
+	}
+	if ps.provisional.Add(pool) {
+		log.Printf("内存池中发现建池交易 %s: 工厂 %s (%s) 代币 %s/%s 费率档位 %d，等待上链确认",
+			tx.Hash().Hex(), pool.Factory.Hex(), protocol, token0.Hex(), token1.Hex(), feeTier)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// mockPendingService 模拟节点的 eth 命名空间：eth_subscribe("newPendingTransactions"[, true]) 推送一笔交易，
+// fullUnsupported 时拒绝完整交易推送，只接受推送哈希的订阅，交易通过 eth_getTransactionByHash 查询
+type mockPendingService struct {
+	tx              *types.Transaction
+	fullUnsupported bool
+
+	mu         sync.Mutex
+	fullSubs   int
+	hashSubs   int
+	hashLookup int
+}
+
+func (s *mockPendingService) NewPendingTransactions(ctx context.Context, fullTx *bool) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	full := fullTx != nil && *fullTx
+	s.mu.Lock()
+	if full {
+		s.fullSubs++
+	} else {
+		s.hashSubs++
+	}
+	s.mu.Unlock()
+	if full && s.fullUnsupported {
+		return nil, errors.New("full pending transactions unsupported")
+	}
+
+	sub := notifier.CreateSubscription()
+	go func() {
+		if full {
+			_ = notifier.Notify(sub.ID, s.tx)
+		} else {
+			_ = notifier.Notify(sub.ID, s.tx.Hash())
+		}
+	}()
+	return sub, nil
+}
+
+func (s *mockPendingService) GetTransactionByHash(hash common.Hash) (*types.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashLookup++
+	if hash != s.tx.Hash() {
+		return nil, nil
+	}
+	return s.tx, nil
+}
+
+// TestPendingSubscriberSubscribe 通过 eth_subscribe 订阅内存池：优先完整交易推送，节点拒绝时退回哈希订阅并查询交易
+func TestPendingSubscriberSubscribe(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory := common.HexToAddress(PancakeSwapV2FactoryHex)
+	tokenA, tokenB := testAddr(2), testAddr(1)
+	data := append(hexutil.MustDecode(CreatePairSelector), common.LeftPadBytes(tokenA.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(tokenB.Bytes(), 32)...)
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: 1, To: &factory, GasPrice: big.NewInt(1e9), Gas: 3000000, Data: data}), types.HomesteadSigner{}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		fullUnsupported bool
+		wantHashSubs    int
+		wantLookups     bool
+	}{
+		{name: "full transactions pushed", wantHashSubs: 0},
+		{name: "falls back to hash subscription", fullUnsupported: true, wantHashSubs: 1, wantLookups: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &mockPendingService{tx: tx, fullUnsupported: tt.fullUnsupported}
+			server := rpc.NewServer()
+			if err := server.RegisterName("eth", service); err != nil {
+				t.Fatal(err)
+			}
+			defer server.Stop()
+			client := ethclient.NewClient(rpc.DialInProc(server))
+			defer client.Close()
+
+			provisional := NewProvisionalPools()
+			cfg := &AppConfig{ReconnectBackoffMin: 10 * time.Millisecond, ReconnectBackoffMax: 50 * time.Millisecond, RPCConcurrency: 4, RPCCallTimeout: time.Second}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- NewPendingSubscriber(client, provisional, cfg).Start(ctx) }()
+
+			deadline := time.After(5 * time.Second)
+			for len(provisional.List()) == 0 {
+				select {
+				case <-deadline:
+					t.Fatal("等待预判池子超时")
+				case <-time.After(5 * time.Millisecond):
+				}
+			}
+			cancel()
+			if err := <-done; !errors.Is(err, context.Canceled) {
+				t.Fatalf("Start 返回 %v，期望 context.Canceled", err)
+			}
+
+			pools := provisional.List()
+			if len(pools) != 1 || pools[0].Factory != factory || pools[0].Token0 != tokenB || pools[0].Token1 != tokenA || pools[0].TxHash != tx.Hash() {
+				t.Fatalf("预判池子 %+v，期望工厂 %s 代币 %s/%s", pools, factory.Hex(), tokenB.Hex(), tokenA.Hex())
+			}
+			service.mu.Lock()
+			defer service.mu.Unlock()
+			if service.fullSubs != 1 || service.hashSubs != tt.wantHashSubs || (service.hashLookup > 0) != tt.wantLookups {
+				t.Fatalf("完整订阅 %d 次、哈希订阅 %d 次、查询交易 %d 次，期望完整订阅 1 次、哈希订阅 %d 次",
+					service.fullSubs, service.hashSubs, service.hashLookup, tt.wantHashSubs)
+			}
+		})
+	}
+}
+
+// TestProvisionalPoolsSweep 定期清理丢弃超过 provisionalPoolTTL 的预判池子，不依赖 List 被调用
+func TestProvisionalPoolsSweep(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		ages        []time.Duration
+		wantExpired int
+		wantLeft    int
+	}{
+		{name: "empty", ages: nil},
+		{name: "all fresh", ages: []time.Duration{0, time.Minute}, wantLeft: 2},
+		{name: "mixed", ages: []time.Duration{time.Minute, provisionalPoolTTL + time.Second}, wantExpired: 1, wantLeft: 1},
+		{name: "all expired", ages: []time.Duration{provisionalPoolTTL + time.Second, time.Hour}, wantExpired: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pp := NewProvisionalPools()
+			for i, age := range tt.ages {
+				pp.Add(provisionalPool{Factory: testAddr(100), Token0: testAddr(1), Token1: testAddr(2), FeeTier: uint64(i), SeenAt: now.Add(-age)})
+			}
+			if got := pp.sweep(now); got != tt.wantExpired {
+				t.Fatalf("丢弃 %d 个，期望 %d 个", got, tt.wantExpired)
+			}
+			if _, expired := pp.Counts(); expired != uint64(tt.wantExpired) {
+				t.Fatalf("expired 计数 %d，期望 %d", expired, tt.wantExpired)
+			}
+			pp.mu.Lock()
+			left := len(pp.pools)
+			pp.mu.Unlock()
+			if left != tt.wantLeft {
+				t.Fatalf("剩余 %d 个，期望 %d 个", left, tt.wantLeft)
+			}
+		})
+	}
+}
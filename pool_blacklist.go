@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PoolBlacklist 运行时拉黑的池子集合，持久化在存储的 blacklisted 列中，启动时从存储加载
+// 套利发现者在过滤池子与评估套利环时、池子发现者在解析日志前查询该集合，拉黑或解除后无需重启立即生效
+type PoolBlacklist struct {
+	mu    sync.RWMutex
+	pools map[common.Address]struct{}
+}
+
+// NewPoolBlacklist 创建空的拉黑集合
+func NewPoolBlacklist() *PoolBlacklist {
+	return &PoolBlacklist{pools: make(map[common.Address]struct{})}
+}
+
+// Load 从存储读取全部被拉黑的池子，替换当前集合
+func (pb *PoolBlacklist) Load(ctx context.Context, store Store) error {
+	pools, err := store.ListPools(ctx, ListPoolsOptions{BlacklistedOnly: true})
+	if err != nil {
+		return fmt.Errorf("读取拉黑池子失败: %w", err)
+	}
+	loaded := make(map[common.Address]struct{}, len(pools))
+	for _, pool := range pools {
+		loaded[pool.Address] = struct{}{}
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.pools = loaded
+	return nil
+}
+
+// Contains 判断池子是否被拉黑，集合为 nil 时视为没有拉黑任何池子
+func (pb *PoolBlacklist) Contains(address common.Address) bool {
+	if pb == nil {
+		return false
+	}
+	pb.mu.RLock()
+	defer pb.mu.RUnlock()
+	_, ok := pb.pools[address]
+	return ok
+}
+
+// Set 先写入存储再更新内存集合，池子不在存储中时返回 false 且不改变集合
+func (pb *PoolBlacklist) Set(store Store, address common.Address, blacklisted bool) (bool, error) {
+	found, err := store.SetPoolBlacklisted(address, blacklisted)
+	if err != nil || !found {
+		return found, err
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if blacklisted {
+		pb.pools[address] = struct{}{}
+	} else {
+		delete(pb.pools, address)
+	}
+	return true, nil
+}
+
+// Len 返回被拉黑的池子数量
+func (pb *PoolBlacklist) Len() int {
+	pb.mu.RLock()
+	defer pb.mu.RUnlock()
+	return len(pb.pools)
+}
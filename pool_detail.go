@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// poolDetail 池子信息，Tokens 与 Reserves（以及加权池的 Weights）按下标一一对应
+// 绝大多数池子只有两个代币，按 token0、token1 排列，可通过 Token0()/Token1() 等方法访问；
+// Curve、Balancer 等多币池包含两个以上代币
+type poolDetail struct {
+	Address common.Address
+	Tokens  []common.Address
+	// FeePips 交易手续费，单位 1e-6（3000 表示 0.3%），是池子费率唯一的表示：
+	// 按基点配置的 V2 分叉费率与存储中的百分比费率在写入时精确换算，V3/Algebra 池子按链上原始值保存（0.045% 等非整基点费率不取整）
+	FeePips int
+	// FeePipsOneForZero token1 → token0 方向的费率（单位 1e-6），只有按方向收费的 Algebra v1.9 池子非 0；
+	// 为 0 时两个方向都使用 FeePips，报价按方向通过 FeePipsFrom 读取
+	FeePipsOneForZero int
+	Protocol          string
+	Reserves          []*big.Int
+	// FeeSource 费率来源（static/contract/global_state/factory/event/override），用于排查费率异常
+	FeeSource string
+	// Weights 加权池中各代币的归一化权重，非加权池为空
+	Weights []float64
+	// ReserveDiscrepancy V2 池子 getReserves 与实际代币余额的偏差超过 RESERVE_DISCREPANCY_BPS，
+	// 通常说明包含 rebase 或转账税代币，储备量不能代表可成交的流动性
+	ReserveDiscrepancy bool
+	// DiscoveredBlock 首次发现池子的日志所在区块，0 表示未知（升级前写入的旧数据）
+	DiscoveredBlock uint64
+	// DiscoveredTx 首次发现池子的日志所在交易，未知时为零哈希
+	DiscoveredTx common.Hash
+
+	// 以下字段只在从存储读取时填充
+	// Active 是否未被清理任务标记为失效
+	Active bool
+	// Blacklisted 是否通过 POST /pools/:address/blacklist 拉黑，拉黑的池子不参与套利，发现者也不再解析
+	Blacklisted bool
+	// CreatedAt 首次写入时间
+	CreatedAt time.Time
+	// UpdatedAt 最近一次写入时间
+	UpdatedAt time.Time
+	// ReserveUpdatedAt 最近一次写入有效储备量的时间，从未获取到有效储备量时为 nil
+	ReserveUpdatedAt *time.Time
+	// Volume24h 按代币计的滚动成交量（卖入池子的数量，按 24 小时时间常数指数衰减），截至 VolumeUpdatedAt；
+	// 从未统计过成交量时两者均为空，当前值通过 VolumeAt 读取
+	Volume24h       []*big.Int
+	VolumeUpdatedAt *time.Time
+}
+
+// FeePipsFrom 返回卖出 tokenIn 时的费率（单位 1e-6）：按方向收费的池子卖出 token1 使用 FeePipsOneForZero，其余情况使用 FeePips
+func (p poolDetail) FeePipsFrom(tokenIn common.Address) int {
+	if p.FeePipsOneForZero != 0 && len(p.Tokens) == 2 && tokenIn == p.Token1() {
+		return p.FeePipsOneForZero
+	}
+	return p.FeePips
+}
+
+// Token0 返回第一个代币，代币不足时返回零地址
+func (p poolDetail) Token0() common.Address {
+	return p.tokenAt(0)
+}
+
+// Token1 返回第二个代币，代币不足时返回零地址
+func (p poolDetail) Token1() common.Address {
+	return p.tokenAt(1)
+}
+
+// Reserve0 返回第一个代币的储备量，未知时返回 nil
+func (p poolDetail) Reserve0() *big.Int {
+	return p.reserveAt(0)
+}
+
+// Reserve1 返回第二个代币的储备量，未知时返回 nil
+func (p poolDetail) Reserve1() *big.Int {
+	return p.reserveAt(1)
+}
+
+// TokenIndex 返回代币在池子中的下标，不存在时返回 -1
+func (p poolDetail) TokenIndex(token common.Address) int {
+	for i, t := range p.Tokens {
+		if t == token {
+			return i
+		}
+	}
+	return -1
+}
+
+// ReserveOf 返回指定代币的储备量，池子不包含该代币或储备量未知时返回 nil
+// 储备量与 Tokens 按链上 token0()/token1() 的顺序一一对应，这里按代币下标取值，不依赖地址大小顺序
+func (p poolDetail) ReserveOf(token common.Address) *big.Int {
+	return p.reserveAt(p.TokenIndex(token))
+}
+
+// WeightOf 返回指定代币的归一化权重，非加权池或不包含该代币时返回 0
+func (p poolDetail) WeightOf(token common.Address) float64 {
+	idx := p.TokenIndex(token)
+	if idx < 0 || idx >= len(p.Weights) {
+		return 0
+	}
+	return p.Weights[idx]
+}
+
+// weighted 是否为加权池（缺少权重的池子按恒定乘积处理）
+func (p poolDetail) weighted() bool {
+	if len(p.Weights) == 0 || len(p.Weights) != len(p.Tokens) {
+		return false
+	}
+	for _, w := range p.Weights {
+		if w <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hasReserves 池子的每个代币都有正的储备量；刚创建或储备量尚未读取到的池子返回 false
+func (p poolDetail) hasReserves() bool {
+	if len(p.Tokens) < 2 || len(p.Reserves) != len(p.Tokens) {
+		return false
+	}
+	for _, reserve := range p.Reserves {
+		if reserve == nil || reserve.Sign() <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (p poolDetail) tokenAt(idx int) common.Address {
+	if idx < 0 || idx >= len(p.Tokens) {
+		return common.Address{}
+	}
+	return p.Tokens[idx]
+}
+
+func (p poolDetail) reserveAt(idx int) *big.Int {
+	if idx < 0 || idx >= len(p.Reserves) {
+		return nil
+	}
+	return p.Reserves[idx]
+}
+
+// sortedTokenProtocols 工厂合约按地址排序代币、保证 token0 < token1 的协议
+var sortedTokenProtocols = map[string]bool{
+	ProtocolUniswapV2Like: true,
+	ProtocolUniswapV3:     true,
+	ProtocolUniswapV4:     true,
+}
+
+// checkTokenOrder 检查池子的 token0 < token1 约定：两个代币相同时返回错误；
+// 协议约定排序但链上顺序相反时只输出警告，储备量仍按链上顺序保存（通常是 ABI 方法名配置错误或分叉合约未遵循约定）
+func checkTokenOrder(pool common.Address, protocol string, token0, token1 common.Address) error {
+	if token0 == token1 {
+		return fmt.Errorf("池子 %s 的 token0 与 token1 相同: %s", pool.Hex(), token0.Hex())
+	}
+	if sortedTokenProtocols[protocol] && token0.Cmp(token1) > 0 {
+		log.Printf("警告: 池子 %s (%s) 的 token0 %s 大于 token1 %s，不符合 token0 < token1 的约定，储备量按链上顺序映射，请确认协议配置",
+			pool.Hex(), protocol, token0.Hex(), token1.Hex())
+	}
+	return nil
+}
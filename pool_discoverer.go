@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -14,81 +18,608 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-type poolDetail struct {
-	Address  common.Address
-	Token0   common.Address
-	Token1   common.Address
-	Fee      float64
-	Protocol string
-	Reserve0 *big.Int // token0 储备量
-	Reserve1 *big.Int // token1 储备量
-}
+const (
+	// unmatchedTopicLogInterval 未开启 DEBUG_BLOCK_DUMP 时输出未匹配 Topic 日志的最小间隔
+	unmatchedTopicLogInterval = time.Minute
+	// unmatchedTopicLogTopN 限频日志中输出的未匹配 Topic 数量
+	unmatchedTopicLogTopN = 5
+)
 
 // PoolDiscoverer 从队列中消费区块，发现新的池子并写入存储
 type PoolDiscoverer struct {
 	queue      *BlockQueue
 	client     *ethclient.Client
-	store      *PoolStore
+	store      Store
 	protocols  map[common.Hash]protocolConfig
+	factories  map[common.Address]factorySpec
 	knownPools *sync.Map
+	// blacklist 运行时拉黑的池子，不再解析，也不应用其 Sync 事件
+	blacklist *PoolBlacklist
+	cfg       *AppConfig
+	tokens    *TokenRegistry
+	lag       blockLagTracker
+	rpcSem    chan struct{}
+	// blockSem 限制同时处理的区块数量，每个区块内部还会按交易并发获取回执
+	blockSem chan struct{}
+	// recent 最近处理过的区块哈希，避免重新订阅、补扫与实时订阅重叠时重复处理同一区块
+	recent *recentBlocks
+	// cursor 计算可持久化的已处理区块游标，未完整处理的区块会挡住游标
+	cursor *blockCursor
+	// onPoolUpdated 池子写入存储且储备量有效时的回调，需在 Start 前设置
+	onPoolUpdated func(PoolUpdated)
+	// provisional 内存池中预判的池子，收到对应建池事件时确认；未开启 WATCH_MEMPOOL 时为 nil
+	provisional *ProvisionalPools
+	// syncPositions 每个池子已应用的最新 Sync 位置，同一区块的回执并发处理，较早的 Sync 晚到时不能覆盖较新的储备量；
+	// 同一池子的更新由 syncState.mu 串行化，syncMu 只保护 map 本身，不同池子的更新互不等待
+	syncMu        sync.Mutex
+	syncPositions map[common.Address]*syncState
+	// syncFloor 已清理位置记录的游标高度，低于它的区块已完整处理，之后再出现的 Sync（回放）不再应用
+	syncFloor atomic.Uint64
+
+	blocksHandled atomic.Uint64
+	// blocksDropped 获取失败且重新入队次数用尽后放弃的区块数量
+	blocksDropped atomic.Uint64
+	poolsRecorded atomic.Uint64
+	// receipts 回执获取的成功、失败次数，失败按错误类型分类
+	receipts receiptStatsTracker
+	// volumes 从 Swap 事件累计的各池子滚动成交量，周期性写回存储
+	volumes *volumeTracker
+	// lastUnmatchedLog 上次输出未匹配 Topic 日志的时间（UnixNano），用于限频
+	lastUnmatchedLog atomic.Int64
+	// workers Start/StartLogs 派生的协程（处理中的区块与日志、重新入队、统计与成交量写回），
+	// Start/StartLogs 返回前等待它们退出，停机时不会在存储关闭后仍有写入
+	workers sync.WaitGroup
 }
 
 // NewPoolDiscoverer 创建池子发现者
-func NewPoolDiscoverer(queue *BlockQueue, client *ethclient.Client, store *PoolStore, protocols map[common.Hash]protocolConfig) *PoolDiscoverer {
+func NewPoolDiscoverer(queue *BlockQueue, client *ethclient.Client, store Store, protocols map[common.Hash]protocolConfig, cfg *AppConfig, tokens *TokenRegistry, blacklist *PoolBlacklist) *PoolDiscoverer {
 	return &PoolDiscoverer{
 		queue:      queue,
 		client:     client,
 		store:      store,
 		protocols:  protocols,
+		factories:  enabledFactories(cfg.EnabledProtocols),
 		knownPools: &sync.Map{},
+		blacklist:  blacklist,
+		cfg:        cfg,
+		tokens:     tokens,
+		rpcSem:     make(chan struct{}, cfg.RPCConcurrency),
+		blockSem:   make(chan struct{}, cfg.MaxConcurrentBlocks),
+		recent:     newRecentBlocks(recentBlocksCapacity),
+		cursor:     newBlockCursor(cfg.MaxBackfillBlocks),
+		volumes:    newVolumeTracker(),
+
+		syncPositions: make(map[common.Address]*syncState),
+	}
+}
+
+// describeReserves 将池子各代币的储备量格式化为「12.0 WBNB / 3400.5 USDT」，精度未知的代币输出最小单位数量
+func (pd *PoolDiscoverer) describeReserves(pool poolDetail) string {
+	parts := make([]string, len(pool.Tokens))
+	for i, token := range pool.Tokens {
+		decimals := decimalsUnknown
+		if meta, ok := pd.tokens.Get(token); ok {
+			decimals = meta.Decimals
+		}
+		amount, scaled := formatUnits(pool.reserveAt(i), decimals)
+		if !scaled {
+			amount += "(最小单位)"
+		}
+		parts[i] = amount + " " + tokenLabel(pd.tokens, token)
+	}
+	return strings.Join(parts, " / ")
+}
+
+// enabledFactories 返回受监听的工厂合约，配置了 ENABLED_PROTOCOLS 时只保留创建所选协议池子的工厂
+func enabledFactories(enabled []string) map[common.Address]factorySpec {
+	factories := GetFactoryProtocols()
+	if len(enabled) == 0 {
+		return factories
+	}
+	for factory, spec := range factories {
+		if !slices.Contains(enabled, spec.Protocol) {
+			delete(factories, factory)
+		}
+	}
+	return factories
+}
+
+// PoolUpdated 池子储备量更新事件：新发现或重新解析的池子写入存储，或 V2 池子的 Sync 事件更新了储备量
+type PoolUpdated struct {
+	Address  common.Address
+	Reserves []*big.Int
+	// Block 触发更新的日志所在区块
+	Block uint64
+}
+
+// OnPoolUpdated 设置池子储备量更新的回调，回调在发现者的处理协程中同步执行，不应阻塞
+func (pd *PoolDiscoverer) OnPoolUpdated(fn func(PoolUpdated)) {
+	pd.onPoolUpdated = fn
+}
+
+// WatchProvisional 设置内存池预判的池子集合，需在 Start 前设置
+func (pd *PoolDiscoverer) WatchProvisional(provisional *ProvisionalPools) {
+	pd.provisional = provisional
+}
+
+// emitPoolUpdated 池子储备量均有效时通知回调，刚创建、尚无流动性的池子不通知
+// 储备量有效后补做建池时跳过的转账税检测，已检测过的代币直接命中缓存
+func (pd *PoolDiscoverer) emitPoolUpdated(ctx context.Context, pool poolDetail, block uint64) {
+	if !pool.hasReserves() {
+		return
+	}
+	for _, token := range pool.Tokens {
+		pd.tokens.Resolve(ctx, token, pool.Address)
+	}
+	if pd.onPoolUpdated == nil {
+		return
 	}
+	pd.onPoolUpdated(PoolUpdated{Address: pool.Address, Reserves: pool.Reserves, Block: block})
+}
+
+// BlocksDropped 返回获取失败且重新入队次数用尽后放弃的区块数量
+func (pd *PoolDiscoverer) BlocksDropped() uint64 {
+	return pd.blocksDropped.Load()
+}
+
+// BlocksHandled 返回已处理完成（含获取失败）的区块数量，重新入队的区块在最后一次处理后才计入
+func (pd *PoolDiscoverer) BlocksHandled() uint64 {
+	return pd.blocksHandled.Load()
+}
+
+// PoolsRecorded 返回成功写入存储的池子数量
+func (pd *PoolDiscoverer) PoolsRecorded() uint64 {
+	return pd.poolsRecorded.Load()
+}
+
+// ReceiptStats 返回回执获取统计，用于判断节点是否在丢回执
+func (pd *PoolDiscoverer) ReceiptStats() ReceiptStats {
+	return pd.receipts.Snapshot()
+}
+
+// BlockLag 返回区块处理延迟统计，用于判断发现者是否跟得上出块
+func (pd *PoolDiscoverer) BlockLag() BlockLagStats {
+	return pd.lag.Snapshot()
 }
 
 // Start 开始消费区块
+// 同时处理的区块达到 MaxConcurrentBlocks 时先等待空位再出队，积压留在队列中形成背压
+// 另起协程按 receiptStatsLogInterval 周期输出回执获取统计；ctx 取消后等待处理中的区块结束才返回
 func (pd *PoolDiscoverer) Start(ctx context.Context) {
+	defer pd.workers.Wait()
+	pd.loadCursor(ctx)
+	pd.spawn(func() { pd.reportReceiptStats(ctx) })
+	pd.spawn(func() { pd.flushVolumes(ctx) })
 	for {
+		select {
+		case <-ctx.Done():
+			return
+		case pd.blockSem <- struct{}{}:
+		}
+
 		select {
 		case <-ctx.Done():
 			return
 		case event := <-pd.queue.Subscribe():
-			go pd.handleBlock(ctx, event)
+			pd.spawn(func() {
+				defer func() { <-pd.blockSem }()
+				pd.handleBlock(ctx, event)
+			})
+		}
+	}
+}
+
+// spawn 在 workers 中登记并启动协程
+func (pd *PoolDiscoverer) spawn(fn func()) {
+	pd.workers.Add(1)
+	go func() {
+		defer pd.workers.Done()
+		fn()
+	}()
+}
+
+// LogTopics 返回日志订阅模式需要订阅的事件 Topic：各协议的 Swap Topic 与工厂合约的建池 Topic，
+// 开启 ARB_INCREMENTAL 时还包括 V2 的 Sync Topic
+func (pd *PoolDiscoverer) LogTopics() []common.Hash {
+	topics := make([]common.Hash, 0, len(pd.protocols)+3)
+	for topic := range pd.protocols {
+		topics = append(topics, topic)
+	}
+	topics = append(topics, common.HexToHash(PairCreatedTopic), common.HexToHash(PoolCreatedTopic))
+	if pd.cfg.ArbIncremental {
+		topics = append(topics, common.HexToHash(SyncTopic))
+	}
+	return topics
+}
+
+// StartLogs 日志订阅模式下消费日志队列，直接从推送的日志解析池子，不再获取区块与回执
+// 与区块模式共用同一套处理：按区块哈希去重（补扫与实时日志重叠的区块只处理一次）、写入失败的区块不推进游标、
+// 每个区块处理完成后记录处理延迟；同一区块的日志并发解析（受 RPCConcurrency 限制），
+// 收到更高区块的日志时等待上一区块解析完成再结算；ctx 取消后等待解析中的日志结束才返回
+func (pd *PoolDiscoverer) StartLogs(ctx context.Context, queue *LogQueue) {
+	defer pd.workers.Wait()
+	pd.loadCursor(ctx)
+	pd.spawn(func() { pd.flushVolumes(ctx) })
+	var (
+		batch *logBatch
+		// settled 已结算的最高区块，与下一个有日志的区块之间的区块没有匹配的日志
+		settled uint64
+	)
+	for {
+		var lg types.Log
+		select {
+		case <-ctx.Done():
+			return
+		case lg = <-queue.Subscribe():
+		}
+
+		if batch == nil || lg.BlockNumber > batch.number {
+			if batch != nil {
+				settled = pd.settleLogBatch(ctx, batch, settled)
+			}
+			batch = newLogBatch(lg)
+		}
+		if !batch.accept(pd.recent, lg) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case pd.rpcSem <- struct{}{}:
+		}
+		batch.wg.Add(1)
+		current := batch
+		pd.spawn(func() {
+			defer current.wg.Done()
+			defer func() { <-pd.rpcSem }()
+			pd.handleStreamedLog(ctx, current, lg)
+		})
+	}
+}
+
+// logKey 唯一标识一条日志
+type logKey struct {
+	tx    common.Hash
+	index uint
+}
+
+// logBatch 日志订阅模式下同一区块高度的日志
+type logBatch struct {
+	number uint64
+	hash   common.Hash
+	time   uint64
+	// claimed 本高度出现过的区块哈希及是否由本批次登记（false 表示已被区块模式或之前的批次处理）
+	claimed map[common.Hash]bool
+	// seen 已接收的日志，节点重复推送的同一条日志只处理一次
+	seen   map[logKey]struct{}
+	wg     sync.WaitGroup
+	failed atomic.Bool
+}
+
+func newLogBatch(lg types.Log) *logBatch {
+	return &logBatch{
+		number:  lg.BlockNumber,
+		hash:    lg.BlockHash,
+		time:    lg.BlockTimestamp,
+		claimed: make(map[common.Hash]bool),
+		seen:    make(map[logKey]struct{}),
+	}
+}
+
+// accept 判断日志是否需要处理：所在区块首次出现时在 recent 中登记哈希，已处理过的区块与重复推送的日志跳过
+func (b *logBatch) accept(recent *recentBlocks, lg types.Log) bool {
+	claimed, ok := b.claimed[lg.BlockHash]
+	if !ok {
+		claimed = recent.Claim(lg.BlockHash)
+		b.claimed[lg.BlockHash] = claimed
+		if !claimed {
+			log.Printf("区块 %d (%s) 已处理，跳过其日志", lg.BlockNumber, lg.BlockHash.Hex())
+		}
+	}
+	if !claimed {
+		return false
+	}
+	key := logKey{tx: lg.TxHash, index: lg.Index}
+	if _, dup := b.seen[key]; dup {
+		return false
+	}
+	b.seen[key] = struct{}{}
+	return true
+}
+
+// handled 批次中是否有由本批次处理的区块；全部是已处理过的区块时与区块模式一样不记录处理延迟
+func (b *logBatch) handled() bool {
+	for _, claimed := range b.claimed {
+		if claimed {
+			return true
 		}
 	}
+	return false
+}
+
+// handleStreamedLog 解析一条推送的日志，新池子写入存储并发出 PoolUpdated；写入失败时标记批次未完整处理
+func (pd *PoolDiscoverer) handleStreamedLog(ctx context.Context, batch *logBatch, lg types.Log) {
+	isNew, pool := pd.inspectLog(ctx, &lg, nil)
+	if !isNew {
+		return
+	}
+	if err := pd.writePool(pool); err != nil {
+		log.Printf("写入池子失败 %s: %v", pool.Address.Hex(), err)
+		batch.failed.Store(true)
+		return
+	}
+	pd.poolsRecorded.Add(1)
+	log.Printf("记录池子 %s 协议 %s（区块 %d）, 储备量 %s", pool.Address.Hex(), pool.Protocol, lg.BlockNumber, pd.describeReserves(pool))
+	pd.emitPoolUpdated(ctx, pool, lg.BlockNumber)
+}
+
+// settleLogBatch 等待批次内的日志解析完成后结算区块，返回新的已结算高度
+// 与区块模式一致：处理被取消或有池子写入失败的区块不标记完成，撤销哈希登记以便补扫重新处理，游标停在它之前；
+// 上一个已结算区块与本区块之间没有日志的区块照常标记完成
+func (pd *PoolDiscoverer) settleLogBatch(ctx context.Context, batch *logBatch, settled uint64) uint64 {
+	batch.wg.Wait()
+	pd.blocksHandled.Add(1)
+
+	complete := ctx.Err() == nil && !batch.failed.Load()
+	if !complete {
+		log.Printf("区块 %d 的日志未完整处理，留待补扫", batch.number)
+		for hash, claimed := range batch.claimed {
+			if claimed {
+				pd.recent.Release(hash)
+			}
+		}
+		pd.saveCursor(pd.cursor.CompleteRange(settled+1, batch.number-1))
+	} else {
+		pd.saveCursor(pd.cursor.CompleteRange(settled+1, batch.number))
+	}
+	if ctx.Err() == nil && batch.handled() {
+		pd.recordLag(batch.number, pd.logBlockTime(ctx, batch))
+	}
+	return batch.number
+}
+
+// logBlockTime 返回批次所在区块的时间戳，节点推送的日志不带 blockTimestamp 时按区块哈希查询区块头
+func (pd *PoolDiscoverer) logBlockTime(ctx context.Context, batch *logBatch) time.Time {
+	if batch.time > 0 {
+		return time.Unix(int64(batch.time), 0)
+	}
+	callCtx, cancel := withRPCTimeout(ctx, pd.cfg.RPCCallTimeout)
+	defer cancel()
+	header, err := pd.client.HeaderByHash(callCtx, batch.hash)
+	if err != nil {
+		log.Printf("获取区块 %d 的区块头失败，不记录处理延迟: %v", batch.number, err)
+		return time.Time{}
+	}
+	return time.Unix(int64(header.Time), 0)
 }
 
 func (pd *PoolDiscoverer) handleBlock(ctx context.Context, event BlockEvent) {
 	start := time.Now()
+	requeued := false
+	defer func() {
+		if !requeued {
+			pd.blocksHandled.Add(1)
+		}
+	}()
 
-	block, err := pd.client.BlockByHash(ctx, event.Hash)
+	// 带哈希的事件在获取区块前去重，节省重复的区块与回执请求
+	if event.Hash != (common.Hash{}) && !pd.recent.Claim(event.Hash) {
+		log.Printf("区块 %s (%s) 已处理，跳过", event.Number.String(), event.Hash.Hex())
+		return
+	}
+
+	// 回放产生的事件没有区块哈希，直接按高度获取
+	var block *types.Block
+	err := errors.New("区块哈希为空")
+	if event.Hash != (common.Hash{}) {
+		block, err = pd.fetchBlock(ctx, func(callCtx context.Context) (*types.Block, error) {
+			return pd.client.BlockByHash(callCtx, event.Hash)
+		})
+	}
 	if err != nil {
-		block, err = pd.client.BlockByNumber(ctx, event.Number)
+		block, err = pd.fetchBlock(ctx, func(callCtx context.Context) (*types.Block, error) {
+			return pd.client.BlockByNumber(callCtx, event.Number)
+		})
 		if err != nil {
+			if event.Hash != (common.Hash{}) {
+				pd.recent.Release(event.Hash)
+			}
 			log.Printf("获取区块失败 %s: %v", event.Number.String(), err)
+			requeued = pd.requeueBlock(ctx, event)
 			return
 		}
 	}
+	// 按高度获取到的区块（回放事件，或按哈希获取失败后回退）在获取后按实际哈希去重
+	if block.Hash() != event.Hash && !pd.recent.Claim(block.Hash()) {
+		log.Printf("区块 %s (%s) 已处理，跳过", event.Number.String(), block.Hash().Hex())
+		return
+	}
 
 	txs := block.Transactions()
 	log.Printf("区块 %s 交易总数: %d", event.Number.String(), len(txs))
 
-	discovered := pd.discoverPoolsFromTransactions(ctx, txs)
-	for _, pool := range discovered {
-		if err := pd.store.InsertPoolIfNotExists(pool); err != nil {
-			log.Printf("写入池子失败 %s: %v", pool.Address.Hex(), err)
-			continue
+	if !event.Replayed && pd.lag.Snapshot().Degraded {
+		// 降级模式下跳过回执获取，优先追上链头；回放与补扫的区块不受影响
+		// 区块未完整处理：不标记完成，游标停在它之前，重启后的补扫会重新处理；
+		// 同时撤销哈希登记，同一进程内的回放也不会把它当作已处理跳过
+		log.Printf("区块 %s 处于降级模式，跳过回执获取，留待补扫", event.Number.String())
+		pd.recent.Release(block.Hash())
+	} else {
+		stats := newBlockLogStats(len(txs))
+		discovered := pd.discoverPoolsFromTransactions(ctx, txs, stats)
+		if ctx.Err() != nil {
+			// 扫描被中断，区块未处理完整，不写入也不推进游标，重启后补扫
+			log.Printf("区块 %s 处理被取消，未扫描完的交易留待补扫", event.Number.String())
+			return
+		}
+		pd.logBlockStats(block.NumberU64(), stats)
+		complete := true
+		for _, pool := range discovered {
+			if err := pd.writePool(pool); err != nil {
+				// 池子既未写入也未缓冲（缓冲区已满），区块不标记完成，重启后的补扫重新发现
+				log.Printf("写入池子失败 %s: %v", pool.Address.Hex(), err)
+				complete = false
+				continue
+			}
+			pd.poolsRecorded.Add(1)
+			log.Printf("记录池子 %s 协议 %s, 储备量 %s", pool.Address.Hex(), pool.Protocol, pd.describeReserves(pool))
+			pd.emitPoolUpdated(ctx, pool, block.NumberU64())
+		}
+		if complete {
+			pd.saveCursor(pd.cursor.Complete(block.NumberU64()))
 		}
-		log.Printf("记录池子 %s 协议 %s", pool.Address.Hex(), pool.Protocol)
 	}
 
+	if !event.Replayed && event.Requeued == 0 {
+		// 历史区块的时间戳远早于当前时间，计入延迟会让补扫立刻触发降级模式；
+		// 重新入队的区块包含了退避等待时间，同样不反映当前的处理延迟
+		pd.recordLag(block.NumberU64(), lagStart(event, time.Unix(int64(block.Time()), 0)))
+	}
 	log.Printf("区块 %s 处理耗时: %v", event.Number.String(), time.Since(start))
 }
 
+// writePool 写入池子；存储不可用时池子被暂存到内存缓冲（ErrBuffered），视为已记录，
+// 套利发现照常使用，存储恢复后自动写回
+func (pd *PoolDiscoverer) writePool(pool poolDetail) error {
+	err := pd.store.InsertPoolIfNotExists(pool)
+	if err == nil || errors.Is(err, ErrBuffered) {
+		pd.volumes.ForgetUnknown(pool.Address)
+	}
+	if errors.Is(err, ErrBuffered) {
+		log.Printf("池子 %s 已暂存到内存缓冲，等待存储恢复后写入", pool.Address.Hex())
+		return nil
+	}
+	return err
+}
+
+// loadCursor 用存储中的已处理区块高度初始化游标，读取失败时从第一个完成的区块开始
+func (pd *PoolDiscoverer) loadCursor(ctx context.Context) {
+	last, ok, err := pd.store.LastProcessedBlock(ctx)
+	if err != nil {
+		log.Printf("读取已处理区块高度失败: %v", err)
+		return
+	}
+	if ok {
+		pd.cursor.Init(last)
+	}
+}
+
+// saveCursor 游标前进时写入存储
+func (pd *PoolDiscoverer) saveCursor(cursor uint64, advanced bool) {
+	if !advanced {
+		return
+	}
+	pd.pruneSyncPositions(cursor)
+	if err := pd.store.SetLastProcessedBlock(cursor); err != nil {
+		log.Printf("记录已处理区块高度失败 %d: %v", cursor, err)
+	}
+}
+
+// fetchBlock 获取区块，每次尝试单独设置 RPC 超时，瞬时错误按 rpcRetryPolicy 重试
+func (pd *PoolDiscoverer) fetchBlock(ctx context.Context, fetch func(context.Context) (*types.Block, error)) (*types.Block, error) {
+	var block *types.Block
+	err := retryDo(ctx, rpcRetryPolicy, func(ctx context.Context) error {
+		callCtx, cancel := withRPCTimeout(ctx, pd.cfg.RPCCallTimeout)
+		defer cancel()
+		var err error
+		block, err = fetch(callCtx)
+		return err
+	})
+	return block, err
+}
+
+// requeueBlock 区块按哈希与按高度获取都失败（每次获取已按 rpcRetryPolicy 重试）后，延迟重新放回区块队列，
+// 等待时间从 BLOCK_REQUEUE_DELAY 开始每次翻倍，节点短暂落后或不可用期间的区块不会直接丢失；
+// 重新入队次数达到 BLOCK_REQUEUE_ATTEMPTS 后放弃并计入 blocksDropped，避免无法获取的区块无限循环；
+// 放弃的区块登记到游标，持久化的游标不会越过它，重启后的补扫会重新处理。返回是否已重新入队
+func (pd *PoolDiscoverer) requeueBlock(ctx context.Context, event BlockEvent) bool {
+	if event.Requeued >= pd.cfg.BlockRequeueAttempts {
+		dropped := pd.blocksDropped.Add(1)
+		pd.cursor.Drop(event.Number.Uint64())
+		log.Printf("区块 %s 已重新入队 %d 次仍获取失败，放弃该区块（累计放弃 %d 个），游标停在它之前，重启后补扫", event.Number.String(), event.Requeued, dropped)
+		return false
+	}
+	delay := pd.cfg.BlockRequeueDelay << event.Requeued
+	event.Requeued++
+	log.Printf("区块 %s 将在 %s 后第 %d 次重新入队", event.Number.String(), delay, event.Requeued)
+	pd.spawn(func() {
+		if err := sleepContext(ctx, delay); err != nil {
+			return
+		}
+		// 等待队列空位而不是挤掉最旧的区块，重新入队不应导致其他区块丢失
+		if err := pd.queue.PublishWait(ctx, event); err != nil {
+			log.Printf("区块 %s 重新入队失败: %v", event.Number.String(), err)
+		}
+	})
+	return true
+}
+
+// lagStart 处理延迟的起点：经确认缓冲的区块从达到确认深度的链头时间戳开始计算，
+// 扣除 CONFIRMATION_DEPTH 带来的预期等待，否则从区块时间戳开始
+func lagStart(event BlockEvent, blockTime time.Time) time.Time {
+	if event.ConfirmedAt.After(blockTime) {
+		return event.ConfirmedAt
+	}
+	return blockTime
+}
+
+// recordLag 记录区块时间戳与处理完成时间之差，并根据平均延迟切换降级模式
+// 区块时间未知（零值）时不记录
+func (pd *PoolDiscoverer) recordLag(number uint64, blockTime time.Time) {
+	if blockTime.IsZero() {
+		return
+	}
+	avg := pd.lag.Record(number, blockTime, time.Now())
+
+	threshold := pd.cfg.BlockLagWarnThreshold
+	if threshold <= 0 {
+		return
+	}
+
+	lagging := avg > threshold
+	if lagging {
+		log.Printf("警告: 区块处理平均延迟 %v 超过阈值 %v", avg.Truncate(time.Millisecond), threshold)
+	}
+	if !pd.cfg.BlockLagDegradeEnabled {
+		return
+	}
+	if pd.lag.SetDegraded(lagging) {
+		if lagging {
+			log.Printf("进入降级模式: 暂停回执获取直到延迟恢复")
+		} else {
+			log.Printf("退出降级模式: 平均延迟 %v 已恢复", avg.Truncate(time.Millisecond))
+		}
+	}
+}
+
+// logBlockStats 输出区块日志统计：开启 DEBUG_BLOCK_DUMP 时每个区块输出完整统计，
+// 否则只按 unmatchedTopicLogInterval 限频输出出现最多的未匹配 Topic
+func (pd *PoolDiscoverer) logBlockStats(number uint64, stats *blockLogStats) {
+	if pd.cfg.DebugBlockDump {
+		log.Printf("区块 %d 日志统计: %s", number, stats.Summary())
+		return
+	}
+
+	total, topics := stats.Unmatched(unmatchedTopicLogTopN)
+	if total == 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := pd.lastUnmatchedLog.Load()
+	if now-last < int64(unmatchedTopicLogInterval) || !pd.lastUnmatchedLog.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf("区块 %d 未匹配的事件 Topic 共 %d 条（每 %v 最多输出一次）: %s", number, total, unmatchedTopicLogInterval, strings.Join(topics, ", "))
+}
+
 // discoverPoolsFromTransactions 并发扫描交易，发现所有新池子
 // 参数 ctx 是上下文，txs 是交易列表
 // 使用 goroutine 并发处理每个交易，获取交易回执并分析日志
 // 根据协议配置的 Swap Topic 筛选出相关的池子日志，并调用合约获取池子信息
-// 返回所有新发现的池子信息列表
-func (pd *PoolDiscoverer) discoverPoolsFromTransactions(ctx context.Context, txs []*types.Transaction) []poolDetail {
+// 返回所有新发现的池子信息列表；ctx 取消时不再发起新的回执请求，进行中的 goroutine 尽快放弃，
+// 本函数不等待它们结束，立即返回已收集到的池子
+func (pd *PoolDiscoverer) discoverPoolsFromTransactions(ctx context.Context, txs []*types.Transaction, stats *blockLogStats) []poolDetail {
 	type poolResult struct {
 		pool poolDetail
 		err  error
@@ -98,53 +629,49 @@ func (pd *PoolDiscoverer) discoverPoolsFromTransactions(ctx context.Context, txs
 	var wg sync.WaitGroup
 
 	for _, tx := range txs {
+		if ctx.Err() != nil {
+			break
+		}
 		wg.Add(1)
 		go func(tx *types.Transaction) {
 			defer wg.Done()
 
-			receipt, err := pd.client.TransactionReceipt(ctx, tx.Hash())
+			// 每次尝试单独占用并发名额，退避等待期间不占用；每次请求都计入回执统计
+			var receipt *types.Receipt
+			err := retryDo(ctx, rpcRetryPolicy, func(ctx context.Context) error {
+				select {
+				case pd.rpcSem <- struct{}{}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				callCtx, cancel := withRPCTimeout(ctx, pd.cfg.RPCCallTimeout)
+				var err error
+				receipt, err = pd.client.TransactionReceipt(callCtx, tx.Hash())
+				cancel()
+				<-pd.rpcSem
+				// 整体退出时的取消不是节点问题，不计入统计
+				if ctx.Err() == nil {
+					pd.receipts.Record(err)
+				}
+				return err
+			})
 			if err != nil {
 				return
 			}
 
+			stats.addLogs(len(receipt.Logs))
 			for _, lg := range receipt.Logs {
-				if len(lg.Topics) == 0 {
-					continue
+				if ctx.Err() != nil {
+					return
 				}
-
-				topic0 := lg.Topics[0].Hex()
-				cfg, ok := pd.protocols[lg.Topics[0]]
-				if !ok {
-					// V4 可能使用与 V3 相同的事件签名（因为池子结构类似）
-					// 尝试使用 V3 的配置来处理 V4 事件
-					v3TopicHash := common.HexToHash(UniswapV3SwapTopic)
-					if lg.Topics[0] == v3TopicHash {
-						// 检查是否是 V4 池子（可能需要通过地址或其他方式判断）
-						// 暂时也当作 V3 处理，后续可以根据实际需求区分
-						v3Cfg, v3Ok := pd.protocols[v3TopicHash]
-						if v3Ok {
-							cfg = v3Cfg
-							ok = true
-						}
-					}
-					if !ok {
-						// 调试：记录未匹配的事件 Topic（限制频率，避免日志过多）
-						// 只记录以 0x01 或 0x02 开头的，可能是 V4 相关
-						if len(topic0) >= 4 && (topic0[2:4] == "01" || topic0[2:4] == "02" || topic0[2:4] == "c4") {
-							log.Printf("未匹配的事件 Topic: %s, 地址: %s, 区块: %s", topic0, lg.Address.Hex(), receipt.BlockNumber.String())
-						}
-						continue
+				if isNew, poolInfo := pd.inspectLog(ctx, lg, stats); isNew {
+					// 一笔交易可能发现多个池子，缓冲区写满且收集方已因取消退出时不能阻塞
+					select {
+					case poolChan <- poolResult{pool: poolInfo}:
+					case <-ctx.Done():
+						return
 					}
 				}
-
-				isNew, poolInfo, err := pd.inspectPool(ctx, lg, cfg)
-				if err != nil {
-					continue
-				}
-
-				if isNew {
-					poolChan <- poolResult{pool: poolInfo}
-				}
 			}
 		}(tx)
 	}
@@ -155,22 +682,173 @@ func (pd *PoolDiscoverer) discoverPoolsFromTransactions(ctx context.Context, txs
 	}()
 
 	var discovered []poolDetail
-	for result := range poolChan {
-		if result.err == nil {
-			discovered = append(discovered, result.pool)
+	for {
+		select {
+		case result, ok := <-poolChan:
+			if !ok {
+				return discovered
+			}
+			if result.err == nil {
+				discovered = append(discovered, result.pool)
+			}
+		case <-ctx.Done():
+			return discovered
 		}
 	}
+}
+
+// inspectLog 按日志的事件类型解析池子，返回是否为新池子；stats 为 nil 时不统计
+func (pd *PoolDiscoverer) inspectLog(ctx context.Context, lg *types.Log, stats *blockLogStats) (bool, poolDetail) {
+	if len(lg.Topics) == 0 {
+		return false, poolDetail{}
+	}
+
+	// 工厂合约的建池事件直接携带代币对，新池子无需等到第一笔 Swap 才被发现
+	if pd.isPoolCreation(lg) {
+		stats.recordMatched(matchedPoolCreation)
+		isNew, poolInfo, err := pd.inspectCreatedPool(ctx, lg)
+		return err == nil && isNew, poolInfo
+	}
+
+	if pd.cfg.ArbIncremental && lg.Topics[0] == common.HexToHash(SyncTopic) {
+		stats.recordMatched(matchedSync)
+		pd.applySync(ctx, lg)
+		return false, poolDetail{}
+	}
+
+	cfg, ok := pd.protocols[lg.Topics[0]]
+	if !ok {
+		// V4 可能使用与 V3 相同的事件签名（因为池子结构类似）
+		// 尝试使用 V3 的配置来处理 V4 事件
+		v3TopicHash := common.HexToHash(UniswapV3SwapTopic)
+		if lg.Topics[0] == v3TopicHash {
+			// 检查是否是 V4 池子（可能需要通过地址或其他方式判断）
+			// 暂时也当作 V3 处理，后续可以根据实际需求区分
+			v3Cfg, v3Ok := pd.protocols[v3TopicHash]
+			if v3Ok {
+				cfg = v3Cfg
+				ok = true
+			}
+		}
+		if !ok {
+			stats.recordUnmatched(lg.Topics[0])
+			return false, poolDetail{}
+		}
+	}
+	stats.recordMatched(cfg.Name)
+	pd.recordSwapVolume(ctx, lg, cfg)
+
+	isNew, poolInfo, err := pd.inspectPool(ctx, lg, cfg)
+	return err == nil && isNew, poolInfo
+}
+
+// applySync 用 V2 池子 Sync 事件携带的储备量更新已记录的池子，并发出 PoolUpdated
+// 只更新存储中已有的两币 V2 池子，未记录的池子等到 Swap 事件时按常规路径发现
+func (pd *PoolDiscoverer) applySync(ctx context.Context, lg *types.Log) {
+	if len(lg.Data) < 64 {
+		return
+	}
+	reserve0 := new(big.Int).SetBytes(lg.Data[:32])
+	reserve1 := new(big.Int).SetBytes(lg.Data[32:64])
+	position := lg.BlockNumber<<32 | uint64(lg.Index)
+	if pd.blacklist.Contains(lg.Address) {
+		return
+	}
 
-	return discovered
+	if lg.BlockNumber < pd.syncFloor.Load() {
+		return
+	}
+
+	state := pd.lockSyncState(lg.Address)
+	defer state.mu.Unlock()
+	if position <= state.position.Load() {
+		return
+	}
+
+	pool, found, err := pd.store.GetPool(ctx, lg.Address)
+	if err != nil {
+		log.Printf("读取池子 %s 失败，跳过 Sync 更新: %v", lg.Address.Hex(), err)
+		return
+	}
+	if !found || pool.Protocol != ProtocolUniswapV2Like || len(pool.Tokens) != 2 {
+		return
+	}
+	pool.Reserves = []*big.Int{reserve0, reserve1}
+	if err := pd.writePool(pool); err != nil {
+		log.Printf("更新池子 %s 储备量失败: %v", lg.Address.Hex(), err)
+		return
+	}
+	state.position.Store(position)
+	pd.emitPoolUpdated(ctx, pool, lg.BlockNumber)
+}
+
+// syncPruneBlocks 游标每前进多少个区块清理一次 Sync 位置记录
+const syncPruneBlocks = 100
+
+// syncState 单个池子的 Sync 位置（区块高度 << 32 | 日志序号）
+type syncState struct {
+	mu       sync.Mutex
+	position atomic.Uint64
+	// pruned 已从 syncPositions 中移除，持有者需重新获取
+	pruned bool
+}
+
+// lockSyncState 获取并锁定池子的 Sync 状态；拿到锁时状态已被清理则重新获取
+func (pd *PoolDiscoverer) lockSyncState(pool common.Address) *syncState {
+	for {
+		pd.syncMu.Lock()
+		state, ok := pd.syncPositions[pool]
+		if !ok {
+			state = &syncState{}
+			pd.syncPositions[pool] = state
+		}
+		pd.syncMu.Unlock()
+
+		state.mu.Lock()
+		if !state.pruned {
+			return state
+		}
+		state.mu.Unlock()
+	}
+}
+
+// pruneSyncPositions 游标前进后清理最新 Sync 位于游标及之前的池子记录：这些区块已完整处理，
+// 之后出现的同区块 Sync 只可能来自回放，由 syncFloor 直接拒绝，不需要再逐池比较位置；正在更新的池子留待下次清理
+func (pd *PoolDiscoverer) pruneSyncPositions(cursor uint64) {
+	floor := pd.syncFloor.Load()
+	if cursor < floor+syncPruneBlocks {
+		return
+	}
+	pd.syncFloor.Store(cursor + 1)
+
+	pd.syncMu.Lock()
+	defer pd.syncMu.Unlock()
+	for pool, state := range pd.syncPositions {
+		if state.position.Load()>>32 > cursor || !state.mu.TryLock() {
+			continue
+		}
+		state.pruned = true
+		delete(pd.syncPositions, pool)
+		state.mu.Unlock()
+	}
 }
 
 // inspectPool 检查并解析池子信息
-func (pd *PoolDiscoverer) inspectPool(ctx context.Context, lg *types.Log, cfg protocolConfig) (bool, poolDetail, error) {
+func (pd *PoolDiscoverer) inspectPool(ctx context.Context, lg *types.Log, cfg protocolConfig) (_ bool, _ poolDetail, err error) {
+	if cfg.Name == ProtocolBalancerWeighted {
+		return pd.inspectBalancerPool(ctx, lg, cfg)
+	}
+
 	poolAddr := lg.Address.Hex()
 
-	if _, exists := pd.knownPools.Load(poolAddr); exists {
+	if !pd.claimPool(poolAddr) {
 		return false, poolDetail{}, nil
 	}
+	defer func() {
+		if err != nil {
+			pd.knownPools.Delete(poolAddr)
+		}
+	}()
 
 	if cfg.ContractABI == nil {
 		return false, poolDetail{}, fmt.Errorf("协议 %s 未配置 ABI", cfg.Name)
@@ -188,12 +866,11 @@ func (pd *PoolDiscoverer) inspectPool(ctx context.Context, lg *types.Log, cfg pr
 	}
 
 	var token0, token1 common.Address
-	var err error
 
 	if cfg.FixedToken0 != nil {
 		token0 = *cfg.FixedToken0
 	} else if token0Method != "" {
-		token0, err = CallTokenAddress(ctx, contract, token0Method)
+		token0, err = CallTokenAddress(ctx, contract, token0Method, pd.cfg.RPCCallTimeout)
 		if err != nil {
 			return false, poolDetail{}, err
 		}
@@ -202,56 +879,393 @@ func (pd *PoolDiscoverer) inspectPool(ctx context.Context, lg *types.Log, cfg pr
 	if cfg.FixedToken1 != nil {
 		token1 = *cfg.FixedToken1
 	} else if token1Method != "" {
-		token1, err = CallTokenAddress(ctx, contract, token1Method)
+		token1, err = CallTokenAddress(ctx, contract, token1Method, pd.cfg.RPCCallTimeout)
 		if err != nil {
 			return false, poolDetail{}, err
 		}
 	}
 
-	poolFee := cfg.StaticFee
-	if cfg.FeeFromContract {
-		poolFee, err = CallPoolFee(ctx, contract)
+	// 固定代币（例如 V1 的 WBNB）不是从合约读取的，不适用 token0 < token1 约定
+	if cfg.FixedToken0 == nil && cfg.FixedToken1 == nil {
+		if err := checkTokenOrder(lg.Address, cfg.Name, token0, token1); err != nil {
+			return false, poolDetail{}, err
+		}
+	}
+
+	// 费率统一以 1e-6 为单位处理，V3/Algebra 合约返回的值原样保存，不取整到基点；
+	// feePipsOneForZero 只有按方向收费的 Algebra v1.9 池子非 0
+	feePips, feeSource := feeBpsToPips(cfg.StaticFeeBps), FeeSourceStatic
+	feePipsOneForZero := 0
+	if fee, ok := pd.cfg.PoolFeeOverrides[lg.Address]; ok {
+		feePips, feeSource = feeBpsToPips(fee), FeeSourceOverride
+	} else if cfg.FeeFromContract {
+		feePips, feePipsOneForZero, feeSource, err = pd.resolvePoolFee(ctx, contract, cfg.feeMethods(), lg.Address, token0, token1)
 		if err != nil {
 			return false, poolDetail{}, err
 		}
+	} else if fee, source, ok := pd.factoryFee(ctx, contract); ok {
+		feePips, feeSource = feeBpsToPips(fee), source
+	}
+	if !validFeePips(feePips) || !validFeePips(feePipsOneForZero) {
+		return false, poolDetail{}, fmt.Errorf("池子 %s 费率 %d/%d（1e-6）非法（%s）", lg.Address.Hex(), feePips, feePipsOneForZero, feeSource)
 	}
 
 	// 获取储备量
 	var reserve0, reserve1 *big.Int
+	var discrepancy bool
 	if cfg.Name == ProtocolUniswapV2Like {
 		// V2 协议使用 getReserves 方法
-		reserve0, reserve1, err = CallGetReserves(ctx, contract)
+		reserve0, reserve1, err = CallGetReserves(ctx, contract, pd.cfg.RPCCallTimeout)
 		if err != nil {
 			// 如果获取储备量失败，使用默认值 0
 			reserve0 = big.NewInt(0)
 			reserve1 = big.NewInt(0)
+		} else if pd.cfg.VerifyReserves {
+			discrepancy = pd.reservesDiverge(ctx, lg.Address, token0, token1, lg.BlockNumber)
 		}
-	} else if cfg.Name == ProtocolUniswapV3 || cfg.Name == ProtocolUniswapV4 {
-		// V3/V4 协议通过 ERC20 balanceOf 获取池子合约的代币余额
-		poolAddr := lg.Address
-		reserve0, err = CallERC20BalanceOf(ctx, pd.client, token0, poolAddr)
-		if err != nil {
-			reserve0 = big.NewInt(0)
+	} else if cfg.Name == ProtocolUniswapV1 {
+		// V1 交易所合约直接持有原生 BNB 与代币，token1 固定为 WBNB，原生 BNB 余额即 WBNB 一侧的储备量
+		reserve0, reserve1 = pd.fetchV1Reserves(ctx, lg.Address, token0)
+	} else {
+		// V3/V4 以及配置文件中的协议通过 ERC20 balanceOf 获取池子合约的代币余额，两个查询合并为一次批量请求
+		reserve0, reserve1 = big.NewInt(0), big.NewInt(0)
+		balances, errs, err := BatchBalanceOf(ctx, pd.client, []BalanceQuery{
+			{Token: token0, Owner: lg.Address},
+			{Token: token1, Owner: lg.Address},
+		}, pd.cfg.RPCCallTimeout)
+		if err == nil {
+			if errs[0] == nil {
+				reserve0 = balances[0]
+			}
+			if errs[1] == nil {
+				reserve1 = balances[1]
+			}
 		}
-		reserve1, err = CallERC20BalanceOf(ctx, pd.client, token1, poolAddr)
-		if err != nil {
-			reserve1 = big.NewInt(0)
+	}
+
+	// 首次遇到的代币检测其精度、符号和转账税，以池子作为模拟转账的持有者
+	pd.tokens.Resolve(ctx, token0, lg.Address)
+	pd.tokens.Resolve(ctx, token1, lg.Address)
+
+	return true, poolDetail{
+		Address:   lg.Address,
+		Tokens:    []common.Address{token0, token1},
+		FeePips:   feePips,
+		Protocol:  cfg.Name,
+		Reserves:  []*big.Int{reserve0, reserve1},
+		FeeSource: feeSource,
+
+		FeePipsOneForZero: feePipsOneForZero,
+
+		ReserveDiscrepancy: discrepancy,
+		DiscoveredBlock:    lg.BlockNumber,
+		DiscoveredTx:       lg.TxHash,
+	}, nil
+}
+
+// reservesDiverge 在日志所在区块 block 的状态上，用一次批量请求同时查询 getReserves 与池子持有的两个代币余额并比较，
+// 任一侧偏差超过 RESERVE_DISCREPANCY_BPS 时返回 true；任一查询失败时不做判断
+// 两侧取自同一区块，避免 latest 在两次查询之间前进造成误报；
+// 余额略高于储备量是正常的（有人直接转入代币但尚未 sync），偏差过大通常意味着 rebase 或转账税代币
+func (pd *PoolDiscoverer) reservesDiverge(ctx context.Context, pool, token0, token1 common.Address, block uint64) bool {
+	reservesCall, err := v2PairABI.Pack("getReserves")
+	if err != nil {
+		return false
+	}
+	balanceCall, err := erc20ABI.Pack("balanceOf", pool)
+	if err != nil {
+		return false
+	}
+	results, errs, err := batchCallAt(ctx, pd.client, []batchCall{
+		{To: pool, Data: reservesCall},
+		{To: token0, Data: balanceCall},
+		{To: token1, Data: balanceCall},
+	}, new(big.Int).SetUint64(block), pd.cfg.RPCCallTimeout)
+	if err != nil || errs[0] != nil {
+		return false
+	}
+	reserve0, reserve1, err := unpackReserves(results[0], nil)
+	if err != nil {
+		return false
+	}
+	balances := make([]*big.Int, 2)
+	for i := range balances {
+		if balances[i], err = unpackBalance(results[i+1], errs[i+1]); err != nil {
+			return false
 		}
-	} else {
-		// V1 暂时不支持储备量获取，设为 0
-		reserve0 = big.NewInt(0)
-		reserve1 = big.NewInt(0)
 	}
+	reserves := []*big.Int{reserve0, reserve1}
+	for i, balance := range balances {
+		if exceedsBps(balance, reserves[i], pd.cfg.ReserveDiscrepancyBps) {
+			log.Printf("池子 %s 在区块 %d 储备量与代币余额不一致: 代币 %s getReserves=%s balanceOf=%s，超过 %d 基点，标记为储备量异常",
+				pool.Hex(), block, []common.Address{token0, token1}[i].Hex(), reserves[i], balance, pd.cfg.ReserveDiscrepancyBps)
+			return true
+		}
+	}
+	return false
+}
 
-	pd.knownPools.Store(poolAddr, true)
+// exceedsBps 判断 actual 相对 expected 的偏差是否超过 bps 基点；expected 为 0 时只要 actual 非 0 即视为超过
+func exceedsBps(actual, expected *big.Int, bps int) bool {
+	diff := new(big.Int).Sub(actual, expected)
+	diff.Abs(diff)
+	// |actual - expected| * 10000 > expected * bps
+	lhs := diff.Mul(diff, big.NewInt(10000))
+	rhs := new(big.Int).Mul(expected, big.NewInt(int64(bps)))
+	return lhs.Cmp(rhs) > 0
+}
+
+// isPoolCreation 判断日志是否为受监听工厂合约发出的 PairCreated/PoolCreated 事件
+func (pd *PoolDiscoverer) isPoolCreation(lg *types.Log) bool {
+	if _, ok := pd.factories[lg.Address]; !ok {
+		return false
+	}
+	return lg.Topics[0] == common.HexToHash(PairCreatedTopic) || lg.Topics[0] == common.HexToHash(PoolCreatedTopic)
+}
+
+// inspectCreatedPool 从工厂合约的建池事件中解析池子信息
+// PairCreated: topic1/topic2 为 token0/token1，data 前 32 字节为池子地址；
+// PoolCreated: topic1/topic2 为 token0/token1，topic3 为费率（单位 1e-6），data 第二个 32 字节为池子地址。
+// 刚创建的池子还没有流动性，储备量记为 0，后续 Swap 时再由常规路径补齐
+func (pd *PoolDiscoverer) inspectCreatedPool(ctx context.Context, lg *types.Log) (bool, poolDetail, error) {
+	spec := pd.factories[lg.Address]
+	protocol := spec.Protocol
+
+	var (
+		pool      common.Address
+		feePips   int
+		feeSource string
+	)
+	switch lg.Topics[0] {
+	case common.HexToHash(PairCreatedTopic):
+		if len(lg.Topics) < 3 || len(lg.Data) < 32 {
+			return false, poolDetail{}, fmt.Errorf("PairCreated 事件格式异常: %s", lg.TxHash.Hex())
+		}
+		pool = common.BytesToAddress(lg.Data[:32])
+		feePips, feeSource = feeBpsToPips(UniswapV2StaticFeeBps), FeeSourceStatic
+		if factoryFee, source, ok := pd.factoryDefaultFee(lg.Address); ok {
+			feePips, feeSource = feeBpsToPips(factoryFee), source
+		}
+	case common.HexToHash(PoolCreatedTopic):
+		if len(lg.Topics) < 4 || len(lg.Data) < 64 {
+			return false, poolDetail{}, fmt.Errorf("PoolCreated 事件格式异常: %s", lg.TxHash.Hex())
+		}
+		pool = common.BytesToAddress(lg.Data[32:64])
+		feeTier := new(big.Int).SetBytes(lg.Topics[3].Bytes())
+		feePips, feeSource = pipsDenominator, FeeSourceEvent
+		if feeTier.IsInt64() && feeTier.Int64() < pipsDenominator {
+			feePips = int(feeTier.Int64())
+		}
+	default:
+		return false, poolDetail{}, fmt.Errorf("未知的建池事件 %s", lg.Topics[0].Hex())
+	}
+
+	if !pd.claimPool(pool.Hex()) {
+		return false, poolDetail{}, nil
+	}
+	if override, ok := pd.cfg.PoolFeeOverrides[pool]; ok {
+		feePips, feeSource = feeBpsToPips(override), FeeSourceOverride
+	}
+	if !validFeePips(feePips) {
+		pd.knownPools.Delete(pool.Hex())
+		return false, poolDetail{}, fmt.Errorf("池子 %s 费率 %d（1e-6）非法（%s）", pool.Hex(), feePips, feeSource)
+	}
+
+	token0 := common.BytesToAddress(lg.Topics[1].Bytes())
+	token1 := common.BytesToAddress(lg.Topics[2].Bytes())
+	if err := checkTokenOrder(pool, protocol, token0, token1); err != nil {
+		pd.knownPools.Delete(pool.Hex())
+		return false, poolDetail{}, err
+	}
+	var feeTier uint64
+	if len(lg.Topics) > 3 {
+		feeTier = new(big.Int).SetBytes(lg.Topics[3].Bytes()).Uint64()
+	}
+	pd.provisional.Confirm(lg.Address, token0, token1, feeTier, pool)
+	// 新池子没有储备量，模拟转账无从检测转账税，这里只登记精度与符号，首次出现储备量时再检测
+	pd.tokens.Register(ctx, token0)
+	pd.tokens.Register(ctx, token1)
+	log.Printf("工厂 %s 创建新池子 %s (%s)", lg.Address.Hex(), pool.Hex(), protocol)
 
 	return true, poolDetail{
-		Address:  lg.Address,
-		Token0:   token0,
-		Token1:   token1,
-		Fee:      poolFee,
-		Protocol: cfg.Name,
-		Reserve0: reserve0,
-		Reserve1: reserve1,
+		Address:   pool,
+		Tokens:    []common.Address{token0, token1},
+		FeePips:   feePips,
+		Protocol:  protocol,
+		Reserves:  []*big.Int{big.NewInt(0), big.NewInt(0)},
+		FeeSource: feeSource,
+
+		DiscoveredBlock: lg.BlockNumber,
+		DiscoveredTx:    lg.TxHash,
 	}, nil
 }
+
+// inspectBalancerPool 解析 Balancer 加权池
+// Swap 事件由 Vault 发出：topic1 为 poolId（前 20 字节即池子地址），池子中的全部代币、余额从 Vault 读取，
+// 代币顺序与 Vault 返回的顺序一致（Balancer 要求注册时按地址升序）
+func (pd *PoolDiscoverer) inspectBalancerPool(ctx context.Context, lg *types.Log, cfg protocolConfig) (_ bool, _ poolDetail, err error) {
+	if len(lg.Topics) < 2 {
+		return false, poolDetail{}, fmt.Errorf("Balancer Swap 事件 topic 数量不足: %d", len(lg.Topics))
+	}
+	if cfg.ContractABI == nil {
+		return false, poolDetail{}, fmt.Errorf("协议 %s 未配置 ABI", cfg.Name)
+	}
+
+	poolID := lg.Topics[1]
+	poolAddress := common.BytesToAddress(poolID[:common.AddressLength])
+	if !pd.claimPool(poolAddress.Hex()) {
+		return false, poolDetail{}, nil
+	}
+	defer func() {
+		if err != nil {
+			pd.knownPools.Delete(poolAddress.Hex())
+		}
+	}()
+
+	vault := bind.NewBoundContract(lg.Address, *cfg.ContractABI, pd.client, pd.client, pd.client)
+	pool := bind.NewBoundContract(poolAddress, *cfg.ContractABI, pd.client, pd.client, pd.client)
+
+	tokens, balances, err := CallBalancerPoolTokens(ctx, vault, poolID, pd.cfg.RPCCallTimeout)
+	if err != nil {
+		return false, poolDetail{}, err
+	}
+	weights, err := CallNormalizedWeights(ctx, pool, pd.cfg.RPCCallTimeout)
+	if err != nil {
+		// 没有 getNormalizedWeights 的池子（例如稳定池）不是加权池
+		return false, poolDetail{}, fmt.Errorf("获取池子 %s 权重失败: %w", poolAddress.Hex(), err)
+	}
+	if len(weights) != len(tokens) {
+		return false, poolDetail{}, fmt.Errorf("池子 %s 权重数量 %d 与代币数量 %d 不一致", poolAddress.Hex(), len(weights), len(tokens))
+	}
+	fee, err := CallSwapFeePercentage(ctx, pool, pd.cfg.RPCCallTimeout)
+	if err != nil {
+		return false, poolDetail{}, err
+	}
+	if !validFeePips(feePercentToPips(fee)) {
+		return false, poolDetail{}, fmt.Errorf("池子 %s 费率 %v%% 非法", poolAddress.Hex(), fee)
+	}
+
+	if len(tokens) < 2 {
+		return false, poolDetail{}, fmt.Errorf("池子 %s 代币数量不足: %d", poolAddress.Hex(), len(tokens))
+	}
+
+	detail := poolDetail{
+		Address:   poolAddress,
+		Tokens:    tokens,
+		FeePips:   feePercentToPips(fee),
+		Protocol:  cfg.Name,
+		Reserves:  balances,
+		FeeSource: FeeSourceContract,
+		Weights:   make([]float64, len(weights)),
+
+		DiscoveredBlock: lg.BlockNumber,
+		DiscoveredTx:    lg.TxHash,
+	}
+	for i, weight := range weights {
+		detail.Weights[i], _ = new(big.Float).Quo(new(big.Float).SetInt(weight), big.NewFloat(1e18)).Float64()
+	}
+
+	for _, token := range tokens {
+		pd.tokens.Resolve(ctx, token, poolAddress)
+	}
+	return true, detail, nil
+}
+
+// fetchV1Reserves 读取 V1 交易所的代币余额与原生 BNB 余额，失败的一侧按 0 处理
+func (pd *PoolDiscoverer) fetchV1Reserves(ctx context.Context, exchange, token common.Address) (*big.Int, *big.Int) {
+	tokenReserve, err := CallERC20BalanceOf(ctx, pd.client, token, exchange, pd.cfg.RPCCallTimeout)
+	if err != nil {
+		tokenReserve = big.NewInt(0)
+	}
+
+	callCtx, cancel := withRPCTimeout(ctx, pd.cfg.RPCCallTimeout)
+	defer cancel()
+	nativeReserve, err := pd.client.BalanceAt(callCtx, exchange, nil)
+	if err != nil {
+		nativeReserve = big.NewInt(0)
+	}
+	return tokenReserve, nativeReserve
+}
+
+// claimPool 原子地登记池子，返回 false 表示池子已被登记（已知或正在被其他 goroutine 解析）或已被拉黑
+// 同一区块内多笔交易命中同一个新池子时，只有第一个登记成功的 goroutine 执行链上解析；
+// 解析失败时调用方需删除登记，以便后续事件重试
+func (pd *PoolDiscoverer) claimPool(poolAddr string) bool {
+	if pd.blacklist.Contains(common.HexToAddress(poolAddr)) {
+		return false
+	}
+	_, loaded := pd.knownPools.LoadOrStore(poolAddr, true)
+	return !loaded
+}
+
+// factoryFee 读取 V2 池子的 factory()，工厂配置了默认费率或是已知费率的受监听工厂时返回该费率
+// 未配置任何工厂费率、也没有受监听的 V2 工厂时不发起调用
+func (pd *PoolDiscoverer) factoryFee(ctx context.Context, contract *bind.BoundContract) (int, string, bool) {
+	if len(pd.cfg.FactoryFeeOverrides) == 0 && len(pd.factories) == 0 {
+		return 0, "", false
+	}
+	factory, err := CallTokenAddress(ctx, contract, "factory", pd.cfg.RPCCallTimeout)
+	if err != nil {
+		return 0, "", false
+	}
+	return pd.factoryDefaultFee(factory)
+}
+
+// factoryDefaultFee 返回 V2 工厂所建池子的默认费率：FACTORY_FEE_OVERRIDES 优先，其次是受监听工厂的已知费率
+func (pd *PoolDiscoverer) factoryDefaultFee(factory common.Address) (int, string, bool) {
+	if override, ok := pd.cfg.FactoryFeeOverrides[factory]; ok {
+		return override, FeeSourceOverride, true
+	}
+	if spec, ok := pd.factories[factory]; ok && spec.FeeBps > 0 {
+		return spec.FeeBps, FeeSourceStatic, true
+	}
+	return 0, "", false
+}
+
+// resolvePoolFee 获取 V3 类池子的费率（单位 1e-6），按 methods 顺序调用池子的费率方法（fee()、Algebra 的 globalState()），
+// 第一个成功的结果即为池子费率；globalState 的费率是动态的，记录的是发现池子时的值
+// 第二个返回值是 token1 → token0 方向的费率，只有按方向收费的 Algebra v1.9 池子且两个方向不同时非 0
+// 全部方法都失败时读取池子的 factory，按配置的费率档位逐个调用 getPool，返回地址与当前池子一致的档位即为该池子的费率
+func (pd *PoolDiscoverer) resolvePoolFee(ctx context.Context, contract *bind.BoundContract, methods []string, pool, token0, token1 common.Address) (int, int, string, error) {
+	var failures []string
+	for _, method := range methods {
+		var (
+			fee, reverse int
+			source       string
+			err          error
+		)
+		switch method {
+		case FeeMethodFee:
+			fee, err = CallPoolFee(ctx, contract, pd.cfg.RPCCallTimeout)
+			source = FeeSourceContract
+		case FeeMethodGlobalState:
+			fee, reverse, err = CallGlobalStateFee(ctx, contract, pd.cfg.RPCCallTimeout)
+			if reverse == fee {
+				reverse = 0
+			}
+			source = FeeSourceGlobalState
+		default:
+			err = fmt.Errorf("不支持的费率方法")
+		}
+		if err == nil {
+			return fee, reverse, source, nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", method, err))
+	}
+	feeErr := strings.Join(failures, "; ")
+
+	factory, err := CallTokenAddress(ctx, contract, "factory", pd.cfg.RPCCallTimeout)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("读取费率失败（%s），获取 factory 失败: %w", feeErr, err)
+	}
+	for _, tier := range pd.cfg.V3FeeTiers {
+		candidate, err := CallFactoryGetPool(ctx, pd.client, factory, token0, token1, tier, pd.cfg.RPCCallTimeout)
+		if err != nil {
+			return 0, 0, "", err
+		}
+		if candidate == pool {
+			return int(tier), 0, FeeSourceFactory, nil
+		}
+	}
+	return 0, 0, "", fmt.Errorf("读取费率失败（%s），factory %s 中未匹配到费率档位", feeErr, factory.Hex())
+}
@@ -0,0 +1,704 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// pairCreatedLog 构造工厂合约发出的 PairCreated 事件
+func pairCreatedLog(factory, token0, token1, pool common.Address) *types.Log {
+	data := append(common.LeftPadBytes(pool.Bytes(), 32), common.LeftPadBytes(big.NewInt(1).Bytes(), 32)...)
+	return &types.Log{
+		Address: factory,
+		Topics:  []common.Hash{common.HexToHash(PairCreatedTopic), common.BytesToHash(token0.Bytes()), common.BytesToHash(token1.Bytes())},
+		Data:    data,
+	}
+}
+
+// poolCreatedLog 构造 V3 工厂合约发出的 PoolCreated 事件，feePips 单位 1e-6
+func poolCreatedLog(factory, token0, token1, pool common.Address, feePips int64) *types.Log {
+	data := append(common.LeftPadBytes(big.NewInt(10).Bytes(), 32), common.LeftPadBytes(pool.Bytes(), 32)...)
+	return &types.Log{
+		Address: factory,
+		Topics: []common.Hash{
+			common.HexToHash(PoolCreatedTopic), common.BytesToHash(token0.Bytes()), common.BytesToHash(token1.Bytes()),
+			common.BigToHash(big.NewInt(feePips)),
+		},
+		Data: data,
+	}
+}
+
+// TestInspectCreatedPoolFee 建池事件按工厂取费率：Biswap 0.2%、PancakeSwap V2 0.25%，
+// FACTORY_FEE_OVERRIDES 优先，V3 从事件读取；100% 及以上的费率拒绝
+func TestInspectCreatedPoolFee(t *testing.T) {
+	token0, token1, pool := testAddr(1), testAddr(2), testAddr(100)
+	biswap := common.HexToAddress(BiswapFactoryHex)
+	pancakeV2 := common.HexToAddress(PancakeSwapV2FactoryHex)
+	pancakeV3 := common.HexToAddress(PancakeSwapV3FactoryHex)
+
+	tests := []struct {
+		name      string
+		overrides map[common.Address]int
+		log       *types.Log
+		wantFee   int
+		// wantFeePips 为 0 时期望 wantFee 精确换算的值
+		wantFeePips int
+		wantSource  string
+		wantErr     bool
+	}{
+		{name: "biswap", log: pairCreatedLog(biswap, token0, token1, pool), wantFee: BiswapStaticFeeBps, wantSource: FeeSourceStatic},
+		{name: "pancakeswap v2", log: pairCreatedLog(pancakeV2, token0, token1, pool), wantFee: PancakeSwapV2StaticFeeBps, wantSource: FeeSourceStatic},
+		{name: "factory override wins", overrides: map[common.Address]int{biswap: 10}, log: pairCreatedLog(biswap, token0, token1, pool), wantFee: 10, wantSource: FeeSourceOverride},
+		{name: "v3 fee from event", log: poolCreatedLog(pancakeV3, token0, token1, pool, 2500), wantFee: 25, wantSource: FeeSourceEvent},
+		{name: "v3 sub-bps fee kept in pips", log: poolCreatedLog(pancakeV3, token0, token1, pool, 450), wantFee: 5, wantFeePips: 450, wantSource: FeeSourceEvent},
+		{name: "v3 fee of 100% rejected", log: poolCreatedLog(pancakeV3, token0, token1, pool, 1_000_000), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pd, _, _ := newTestDiscoverer(t, &mockChain{}, &AppConfig{FactoryFeeOverrides: tt.overrides})
+			isNew, detail, err := pd.inspectCreatedPool(context.Background(), tt.log)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("费率非法的池子应被拒绝，得到费率 %d pips", detail.FeePips)
+				}
+				return
+			}
+			if err != nil || !isNew {
+				t.Fatalf("解析建池事件失败: new=%v err=%v", isNew, err)
+			}
+			wantPips := tt.wantFeePips
+			if wantPips == 0 {
+				wantPips = feeBpsToPips(tt.wantFee)
+			}
+			if detail.Address != pool || detail.FeePips != wantPips || detail.FeeSource != tt.wantSource {
+				t.Fatalf("池子 %s 费率 %d pips (%s)，期望 %s 费率 %d pips (%s)", detail.Address.Hex(), detail.FeePips, detail.FeeSource, pool.Hex(), wantPips, tt.wantSource)
+			}
+			if feePipsToBps(detail.FeePips) != tt.wantFee {
+				t.Fatalf("展示费率 %d bps，期望 %d bps", feePipsToBps(detail.FeePips), tt.wantFee)
+			}
+		})
+	}
+}
+
+// TestEmitPoolUpdatedProbesFundedPools 建池时跳过的转账税检测在池子首次出现储备量时补做，空池子不检测；
+// 每个代币的检测包含买入、卖出两次模拟
+func TestEmitPoolUpdatedProbesFundedPools(t *testing.T) {
+	token0, token1, pool := testAddr(1), testAddr(2), testAddr(100)
+	tests := []struct {
+		name            string
+		reserves        []*big.Int
+		wantSimulations int
+		wantUpdates     int
+	}{
+		{name: "empty pool", reserves: []*big.Int{big.NewInt(0), big.NewInt(0)}},
+		{name: "funded pool", reserves: []*big.Int{units(1000, 18), units(1000, 18)}, wantSimulations: 4, wantUpdates: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pd, _, store := newTestDiscoverer(t, &mockChain{}, &AppConfig{})
+			token := &mockTaxToken{pool: pool, balances: map[common.Address]*big.Int{pool: units(1000, 18)}}
+			pd.tokens = newMockTokenRegistry(t, token)
+			pd.tokens.store = store
+			updates := 0
+			pd.OnPoolUpdated(func(PoolUpdated) { updates++ })
+
+			pd.tokens.Register(context.Background(), token0)
+			pd.tokens.Register(context.Background(), token1)
+			pd.emitPoolUpdated(context.Background(), testPool(pool, token0, token1, tt.reserves[0], tt.reserves[1], 30), 1)
+			if token.simulations != tt.wantSimulations || updates != tt.wantUpdates {
+				t.Fatalf("检测 %d 次、通知 %d 次，期望检测 %d 次、通知 %d 次", token.simulations, updates, tt.wantSimulations, tt.wantUpdates)
+			}
+		})
+	}
+}
+
+// rejectPoolStore 写入指定池子时返回错误，模拟缓冲区已满等无法记录池子的情况
+type rejectPoolStore struct {
+	Store
+	reject common.Address
+}
+
+func (s rejectPoolStore) InsertPoolIfNotExists(pool poolDetail) error {
+	if pool.Address == s.reject {
+		return errors.New("buffer full")
+	}
+	return s.Store.InsertPoolIfNotExists(pool)
+}
+
+// streamedLog 构造订阅推送的建池日志，每个区块高度对应一个固定的区块哈希
+func streamedLog(number uint64, pool common.Address) types.Log {
+	lg := *pairCreatedLog(common.HexToAddress(PancakeSwapV2FactoryHex), testAddr(1), testAddr(2), pool)
+	lg.BlockNumber = number
+	lg.BlockHash = common.BigToHash(new(big.Int).SetUint64(number))
+	lg.TxHash = common.BytesToHash(pool.Bytes())
+	lg.BlockTimestamp = uint64(time.Now().Unix())
+	return lg
+}
+
+// TestStartLogs 日志模式与区块模式共用去重、游标与延迟统计：已处理的区块跳过，写入失败的区块挡住游标并撤销登记，
+// 两个有日志的区块之间的区块视为已处理
+func TestStartLogs(t *testing.T) {
+	tests := []struct {
+		name string
+		// blocks 按顺序推送的区块高度，第 i 个区块包含池子 testAddr(100+i) 的建池日志；最后一个区块不会结算
+		blocks      []uint64
+		claimed     uint64
+		reject      uint64
+		wantCursor  uint64
+		wantSkipped uint64
+		wantSamples uint64
+	}{
+		{name: "consecutive blocks", blocks: []uint64{100, 101, 102}, wantCursor: 101, wantSamples: 2},
+		{name: "blocks without logs are settled", blocks: []uint64{100, 105, 106}, wantCursor: 105, wantSamples: 2},
+		{name: "already handled block is skipped", blocks: []uint64{100, 101, 102}, claimed: 100, wantCursor: 101, wantSkipped: 100, wantSamples: 1},
+		{name: "failed write holds the cursor", blocks: []uint64{100, 101, 102, 103}, reject: 101, wantCursor: 100, wantSamples: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pd, _, store := newTestDiscoverer(t, &mockChain{}, &AppConfig{MaxBackfillBlocks: 100})
+			if err := store.SetLastProcessedBlock(99); err != nil {
+				t.Fatal(err)
+			}
+			poolOf := func(number uint64) common.Address {
+				for i, block := range tt.blocks {
+					if block == number {
+						return testAddr(100 + i)
+					}
+				}
+				return common.Address{}
+			}
+			if tt.reject > 0 {
+				pd.store = rejectPoolStore{Store: store, reject: poolOf(tt.reject)}
+			}
+			if tt.claimed > 0 {
+				pd.recent.Claim(streamedLog(tt.claimed, common.Address{}).BlockHash)
+			}
+
+			queue, err := NewLogQueue(16)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go pd.StartLogs(ctx, queue)
+			for _, number := range tt.blocks {
+				if err := queue.Publish(ctx, streamedLog(number, poolOf(number))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			settled := uint64(len(tt.blocks) - 1)
+			deadline := time.Now().Add(5 * time.Second)
+			for pd.BlocksHandled() < settled {
+				if time.Now().After(deadline) {
+					t.Fatalf("已结算 %d 个区块，期望 %d 个", pd.BlocksHandled(), settled)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			if cursor, _, err := store.LastProcessedBlock(ctx); err != nil || cursor != tt.wantCursor {
+				t.Fatalf("游标 %d (%v)，期望 %d", cursor, err, tt.wantCursor)
+			}
+			if samples := pd.lag.Snapshot().Samples; samples != tt.wantSamples {
+				t.Fatalf("记录处理延迟 %d 次，期望 %d 次", samples, tt.wantSamples)
+			}
+			for _, number := range tt.blocks[:settled] {
+				_, found, err := store.GetPool(ctx, poolOf(number))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := number != tt.wantSkipped && number != tt.reject; found != want {
+					t.Fatalf("区块 %d 的池子记录状态 %v，期望 %v", number, found, want)
+				}
+			}
+			if tt.reject > 0 && !pd.recent.Claim(streamedLog(tt.reject, common.Address{}).BlockHash) {
+				t.Fatalf("写入失败的区块 %d 应撤销哈希登记，以便补扫重新处理", tt.reject)
+			}
+		})
+	}
+}
+
+// syncLog 构造 V2 池子的 Sync 事件
+func syncLog(pool common.Address, block uint64, index uint, reserve0, reserve1 int64) *types.Log {
+	data := append(common.LeftPadBytes(big.NewInt(reserve0).Bytes(), 32), common.LeftPadBytes(big.NewInt(reserve1).Bytes(), 32)...)
+	return &types.Log{Address: pool, Topics: []common.Hash{common.HexToHash(SyncTopic)}, Data: data, BlockNumber: block, Index: index}
+}
+
+// TestApplySyncOrdering 较早的 Sync 晚到时不覆盖较新的储备量；游标前进后清理位置记录，低于游标的回放 Sync 不再应用
+func TestApplySyncOrdering(t *testing.T) {
+	pool := testAddr(100)
+	pd, _, store := newTestDiscoverer(t, &mockChain{}, &AppConfig{})
+	if err := store.InsertPoolIfNotExists(testPool(pool, testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name        string
+		cursor      uint64
+		block       uint64
+		index       uint
+		reserve     int64
+		wantReserve int64
+	}{
+		{name: "first sync", block: 200, index: 1, reserve: 10, wantReserve: 10},
+		{name: "earlier sync arrives late", block: 200, index: 0, reserve: 5, wantReserve: 10},
+		{name: "newer block", block: 201, reserve: 20, wantReserve: 20},
+		{name: "replayed sync below the cursor", cursor: 300, block: 250, reserve: 7, wantReserve: 20},
+		{name: "sync above the cursor", block: 301, reserve: 30, wantReserve: 30},
+	}
+	for _, step := range steps {
+		if step.cursor > 0 {
+			pd.saveCursor(step.cursor, true)
+			if n := len(pd.syncPositions); n != 0 {
+				t.Fatalf("%s: 游标前进后仍有 %d 条 Sync 位置记录", step.name, n)
+			}
+		}
+		pd.applySync(context.Background(), syncLog(pool, step.block, step.index, step.reserve, step.reserve))
+		got, _, err := store.GetPool(context.Background(), pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Reserves[0].Int64() != step.wantReserve {
+			t.Fatalf("%s: 储备量 %s，期望 %d", step.name, got.Reserves[0], step.wantReserve)
+		}
+	}
+}
+
+// blockingPoolStore 读取指定池子时阻塞到 release 关闭
+type blockingPoolStore struct {
+	Store
+	block   common.Address
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s blockingPoolStore) GetPool(ctx context.Context, address common.Address) (poolDetail, bool, error) {
+	if address == s.block {
+		close(s.entered)
+		<-s.release
+	}
+	return s.Store.GetPool(ctx, address)
+}
+
+// TestApplySyncLocksPerPool 一个池子的 Sync 更新卡在存储读取上时，其他池子的更新不受影响
+func TestApplySyncLocksPerPool(t *testing.T) {
+	slow, fast := testAddr(100), testAddr(101)
+	pd, _, store := newTestDiscoverer(t, &mockChain{}, &AppConfig{})
+	for _, pool := range []common.Address{slow, fast} {
+		if err := store.InsertPoolIfNotExists(testPool(pool, testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocking := blockingPoolStore{Store: store, block: slow, entered: make(chan struct{}), release: make(chan struct{})}
+	pd.store = blocking
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		pd.applySync(context.Background(), syncLog(slow, 200, 0, 10, 10))
+	}()
+	<-blocking.entered
+
+	fastDone := make(chan struct{})
+	go func() {
+		defer close(fastDone)
+		pd.applySync(context.Background(), syncLog(fast, 200, 1, 20, 20))
+	}()
+	select {
+	case <-fastDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("其他池子的 Sync 更新被阻塞")
+	}
+	close(blocking.release)
+	<-slowDone
+}
+
+// mockPairState 池子在某个区块的 getReserves 结果与两个代币的余额
+type mockPairState struct {
+	reserves [2]int64
+	balances [2]int64
+}
+
+// mockPairEth 按 eth_call 的区块参数返回池子在该区块的状态，failToken 的 balanceOf 调用返回错误
+type mockPairEth struct {
+	pool, token0, token1 common.Address
+	states               map[string]mockPairState
+	failToken            common.Address
+
+	mu     sync.Mutex
+	blocks []string
+}
+
+func (s *mockPairEth) Call(args mockCallArgs, block string) (hexutil.Bytes, error) {
+	s.mu.Lock()
+	s.blocks = append(s.blocks, block)
+	s.mu.Unlock()
+	state, ok := s.states[block]
+	if !ok {
+		return nil, fmt.Errorf("unknown block %s", block)
+	}
+	if args.To == nil {
+		return nil, errors.New("missing to")
+	}
+	switch *args.To {
+	case s.pool:
+		return v2PairABI.Methods["getReserves"].Outputs.Pack(big.NewInt(state.reserves[0]), big.NewInt(state.reserves[1]), uint32(0))
+	case s.failToken:
+		return nil, errors.New("execution reverted")
+	case s.token0:
+		return erc20ABI.Methods["balanceOf"].Outputs.Pack(big.NewInt(state.balances[0]))
+	case s.token1:
+		return erc20ABI.Methods["balanceOf"].Outputs.Pack(big.NewInt(state.balances[1]))
+	}
+	return nil, fmt.Errorf("unknown contract %s", args.To.Hex())
+}
+
+// TestReservesDiverge 储备量与余额在日志所在区块的同一状态上比较，latest 的变化不影响判断
+func TestReservesDiverge(t *testing.T) {
+	pool, token0, token1 := testAddr(100), testAddr(1), testAddr(2)
+	const logBlock = 50
+	// latest 上有人直接转入了大量代币但尚未 sync，若在 latest 上查询余额会误报
+	latest := mockPairState{reserves: [2]int64{1000, 1000}, balances: [2]int64{5000, 1000}}
+	tests := []struct {
+		name      string
+		atLog     mockPairState
+		failToken common.Address
+		want      bool
+	}{
+		{name: "consistent at log block", atLog: mockPairState{reserves: [2]int64{1000, 1000}, balances: [2]int64{1005, 1000}}},
+		{name: "diverged at log block", atLog: mockPairState{reserves: [2]int64{1000, 1000}, balances: [2]int64{1000, 2000}}, want: true},
+		{name: "balance query failed", atLog: mockPairState{reserves: [2]int64{1000, 1000}, balances: [2]int64{1000, 2000}}, failToken: token1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &mockPairEth{
+				pool: pool, token0: token0, token1: token1, failToken: tt.failToken,
+				states: map[string]mockPairState{"latest": latest, hexutil.EncodeUint64(logBlock): tt.atLog},
+			}
+			server := rpc.NewServer()
+			if err := server.RegisterName("eth", service); err != nil {
+				t.Fatal(err)
+			}
+			defer server.Stop()
+			client := ethclient.NewClient(rpc.DialInProc(server))
+			defer client.Close()
+			pd := &PoolDiscoverer{client: client, cfg: &AppConfig{RPCCallTimeout: time.Second, ReserveDiscrepancyBps: 100}}
+
+			if got := pd.reservesDiverge(context.Background(), pool, token0, token1, logBlock); got != tt.want {
+				t.Fatalf("reservesDiverge 返回 %v，期望 %v", got, tt.want)
+			}
+			service.mu.Lock()
+			defer service.mu.Unlock()
+			for _, block := range service.blocks {
+				if block != hexutil.EncodeUint64(logBlock) {
+					t.Fatalf("查询了区块 %s，期望全部在日志所在区块 %s 查询", block, hexutil.EncodeUint64(logBlock))
+				}
+			}
+			if len(service.blocks) != 3 {
+				t.Fatalf("发出 %d 个 eth_call，期望 3 个", len(service.blocks))
+			}
+		})
+	}
+}
+
+// TestHandleBlockLagExcludesConfirmationDelay 经确认缓冲放出的区块从达到确认深度的链头时间戳开始计算延迟，
+// 等待 CONFIRMATION_DEPTH 个区块的时间不计入延迟，也不触发降级
+func TestHandleBlockLagExcludesConfirmationDelay(t *testing.T) {
+	blockTime := time.Now().Add(-30 * time.Second).Truncate(time.Second)
+	tests := []struct {
+		name  string
+		depth uint64
+		// headDelay 确认链头相对区块时间戳的延后
+		headDelay    time.Duration
+		wantMinLag   time.Duration
+		wantMaxLag   time.Duration
+		wantDegraded bool
+	}{
+		{name: "no confirmation depth", depth: 0, wantMinLag: 30 * time.Second, wantMaxLag: time.Hour, wantDegraded: true},
+		{name: "confirmation wait excluded", depth: 10, headDelay: 30 * time.Second, wantMaxLag: 5 * time.Second},
+		{name: "head time before block time ignored", depth: 10, headDelay: -time.Minute, wantMinLag: 30 * time.Second, wantMaxLag: time.Hour, wantDegraded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := &mockChain{head: 100, blockTime: blockTime}
+			cfg := &AppConfig{BlockLagWarnThreshold: 10 * time.Second, BlockLagDegradeEnabled: true}
+			pd, _, _ := newTestDiscoverer(t, chain, cfg)
+
+			buffer := newConfirmationBuffer(tt.depth)
+			buffer.Push(BlockEvent{Number: big.NewInt(100)}, blockTime)
+			ready := buffer.Push(BlockEvent{Number: big.NewInt(int64(100 + tt.depth))}, blockTime.Add(tt.headDelay))
+			if len(ready) == 0 || ready[0].Number.Uint64() != 100 {
+				t.Fatalf("确认缓冲放出 %v，期望区块 100", ready)
+			}
+			pd.handleBlock(context.Background(), ready[0])
+
+			lag := pd.BlockLag()
+			if lag.Samples != 1 || lag.LastLag < tt.wantMinLag || lag.LastLag > tt.wantMaxLag || lag.Degraded != tt.wantDegraded {
+				t.Fatalf("延迟 %v（样本 %d）、降级 %v，期望在 [%v, %v] 内、降级 %v",
+					lag.LastLag, lag.Samples, lag.Degraded, tt.wantMinLag, tt.wantMaxLag, tt.wantDegraded)
+			}
+		})
+	}
+}
+
+// mockAlgebraPoolEth 模拟池子的 eth_call：fee 非 nil 时 fee() 返回该值，否则回滚；globalState() 返回 state 中的各个字，
+// 其余调用（factory() 等）回滚
+type mockAlgebraPoolEth struct {
+	fee   *big.Int
+	state []int64
+}
+
+func (s *mockAlgebraPoolEth) Call(args mockCallArgs, block string) (hexutil.Bytes, error) {
+	data := args.calldata()
+	v3ABI := mustParseABI(UniswapV3ABIJSON)
+	switch {
+	case len(data) >= 4 && string(data[:4]) == string(v3ABI.Methods["fee"].ID) && s.fee != nil:
+		return common.LeftPadBytes(s.fee.Bytes(), 32), nil
+	case len(data) >= 4 && string(data[:4]) == string(algebraGlobalStateABI.Methods["globalState"].ID) && s.state != nil:
+		var out []byte
+		for _, word := range s.state {
+			out = append(out, common.LeftPadBytes(big.NewInt(word).Bytes(), 32)...)
+		}
+		return out, nil
+	}
+	return nil, errors.New("execution reverted")
+}
+
+// TestResolvePoolFeeAlgebra 只提供 globalState() 的 Algebra 池子按 1e-6 原样记录费率；
+// v1.9 的 8 字返回值按方向记录 feeZto/feeOtz，两个方向相同时不单独记录反方向费率
+func TestResolvePoolFeeAlgebra(t *testing.T) {
+	const price, tick = 1 << 40, 100
+	tests := []struct {
+		name        string
+		fee         *big.Int
+		state       []int64
+		wantFee     int
+		wantReverse int
+		wantSource  string
+		wantErr     bool
+	}{
+		{name: "static fee", fee: big.NewInt(500), wantFee: 500, wantSource: FeeSourceContract},
+		{name: "algebra v1", state: []int64{price, tick, 2737, 12, 0, 0, 1}, wantFee: 2737, wantSource: FeeSourceGlobalState},
+		{name: "algebra integral", state: []int64{price, tick, 3000, 0, 0, 1}, wantFee: 3000, wantSource: FeeSourceGlobalState},
+		{name: "algebra v1.9 directional", state: []int64{price, tick, 1234, 567, 12, 0, 0, 1}, wantFee: 1234, wantReverse: 567, wantSource: FeeSourceGlobalState},
+		{name: "algebra v1.9 equal fees", state: []int64{price, tick, 500, 500, 12, 0, 0, 1}, wantFee: 500, wantSource: FeeSourceGlobalState},
+		{name: "reverse fee out of range", state: []int64{price, tick, 500, pipsDenominator, 12, 0, 0, 1}, wantErr: true},
+		{name: "no fee method", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := rpc.NewServer()
+			if err := server.RegisterName("eth", &mockAlgebraPoolEth{fee: tt.fee, state: tt.state}); err != nil {
+				t.Fatal(err)
+			}
+			defer server.Stop()
+			client := ethclient.NewClient(rpc.DialInProc(server))
+			defer client.Close()
+			pd := &PoolDiscoverer{client: client, cfg: &AppConfig{RPCCallTimeout: time.Second}}
+			pool := testAddr(100)
+			contract := bind.NewBoundContract(pool, mustParseABI(UniswapV3ABIJSON), client, client, client)
+
+			fee, reverse, source, err := pd.resolvePoolFee(context.Background(), contract, defaultFeeMethods, pool, testAddr(1), testAddr(2))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("期望出错，得到费率 %d/%d (%s)", fee, reverse, source)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fee != tt.wantFee || reverse != tt.wantReverse || source != tt.wantSource {
+				t.Fatalf("费率 %d/%d (%s)，期望 %d/%d (%s)", fee, reverse, source, tt.wantFee, tt.wantReverse, tt.wantSource)
+			}
+		})
+	}
+}
+
+// TestEnabledProtocols ENABLED_PROTOCOLS 只保留所选协议的 Swap Topic 与建池工厂：未启用协议的 Swap 日志与建池事件不匹配、不解析，
+// 启用协议的照常处理；名称不属于任何协议时报错
+func TestEnabledProtocols(t *testing.T) {
+	v1ABI, v2ABI := mustParseABI(UniswapV1ExchangeABIJSON), mustParseABI(PairABIJSON)
+	v3ABI, balancerABI := mustParseABI(UniswapV3ABIJSON), mustParseABI(BalancerWeightedABIJSON)
+	token0, token1 := testAddr(1), testAddr(2)
+	v2Created, v3Created := testAddr(100), testAddr(101)
+	v2Swap := v2SwapLog(testAddr(102), 1000, 900)
+	v3Swap := &types.Log{Address: testAddr(103), Topics: []common.Hash{common.HexToHash(UniswapV3SwapTopic)}}
+	pairCreated := pairCreatedLog(common.HexToAddress(PancakeSwapV2FactoryHex), token0, token1, v2Created)
+	poolCreated := poolCreatedLog(common.HexToAddress(PancakeSwapV3FactoryHex), token0, token1, v3Created, 2500)
+
+	tests := []struct {
+		name        string
+		enabled     []string
+		wantErr     bool
+		wantMatched map[string]int
+		// wantCreated 建池事件解析出的新池子
+		wantCreated []common.Address
+		wantTopics  []string
+	}{
+		{
+			name:        "all protocols by default",
+			wantMatched: map[string]int{ProtocolUniswapV2Like: 1, ProtocolUniswapV3: 1, matchedPoolCreation: 2},
+			wantCreated: []common.Address{v2Created, v3Created},
+			wantTopics:  []string{UniswapV2SwapTopic, UniswapV3SwapTopic},
+		},
+		{
+			name:        "v3 only ignores v2 swaps and factories",
+			enabled:     []string{ProtocolUniswapV3},
+			wantMatched: map[string]int{ProtocolUniswapV3: 1, matchedPoolCreation: 1},
+			wantCreated: []common.Address{v3Created},
+			wantTopics:  []string{UniswapV3SwapTopic},
+		},
+		{
+			name:        "v2 only ignores v3 swaps and factories",
+			enabled:     []string{ProtocolUniswapV2Like},
+			wantMatched: map[string]int{ProtocolUniswapV2Like: 1, matchedPoolCreation: 1},
+			wantCreated: []common.Address{v2Created},
+			wantTopics:  []string{UniswapV2SwapTopic},
+		},
+		{name: "unknown protocol rejected", enabled: []string{"UniswapV9Swap"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protocols, err := FilterProtocols(GetProtocolsConfig(common.Address{}, &v1ABI, &v2ABI, &v3ABI, &balancerABI), tt.enabled)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("筛选协议返回 %v，期望出错 %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			pd, _, _ := newTestDiscoverer(t, &mockChain{}, &AppConfig{EnabledProtocols: tt.enabled})
+			pd.protocols = protocols
+
+			topics := make(map[common.Hash]bool)
+			for _, topic := range pd.LogTopics() {
+				topics[topic] = true
+			}
+			for _, topic := range []string{UniswapV2SwapTopic, UniswapV3SwapTopic} {
+				if want := slices.Contains(tt.wantTopics, topic); topics[common.HexToHash(topic)] != want {
+					t.Fatalf("订阅 Topic %s = %v，期望 %v", topic, !want, want)
+				}
+			}
+
+			stats := newBlockLogStats(0)
+			var created []common.Address
+			for _, lg := range []*types.Log{v2Swap, v3Swap, pairCreated, poolCreated} {
+				if isNew, pool := pd.inspectLog(context.Background(), lg, stats); isNew {
+					created = append(created, pool.Address)
+				}
+			}
+			if !maps.Equal(stats.matched, tt.wantMatched) {
+				t.Fatalf("匹配的日志 %v，期望 %v（未匹配 %v）", stats.matched, tt.wantMatched, stats.unmatched)
+			}
+			if !slices.Equal(created, tt.wantCreated) {
+				t.Fatalf("解析出新池子 %v，期望 %v", created, tt.wantCreated)
+			}
+		})
+	}
+}
+
+// mockClaimEth 统计对池子的链上解析次数：每次解析的第一个调用阻塞到 gate 关闭，随后返回错误使解析失败
+type mockClaimEth struct {
+	gate        chan struct{}
+	inspections atomic.Int64
+}
+
+func (s *mockClaimEth) Call(args mockCallArgs, block string) (hexutil.Bytes, error) {
+	if bytes.Equal(args.calldata(), v2PairABI.Methods["token0"].ID) {
+		s.inspections.Add(1)
+	}
+	<-s.gate
+	return nil, errors.New("execution reverted")
+}
+
+// TestInspectPoolClaim 同一个池子的多个事件并发到达时只有登记成功的 goroutine 发起链上解析，其余直接返回；
+// 解析失败后撤销登记，之后的事件重新解析；已知或已拉黑的池子不解析
+func TestInspectPoolClaim(t *testing.T) {
+	pool := testAddr(100)
+	tests := []struct {
+		name        string
+		events      int
+		known       bool
+		blacklisted bool
+		// wantInspections 并发事件触发的解析次数，之后再到达一个事件时失败的解析会重试一次
+		wantInspections int64
+		wantRetry       bool
+	}{
+		{name: "single event", events: 1, wantInspections: 1, wantRetry: true},
+		{name: "concurrent events inspect once", events: 64, wantInspections: 1, wantRetry: true},
+		{name: "known pool skipped", events: 16, known: true},
+		{name: "blacklisted pool skipped", events: 16, blacklisted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &mockClaimEth{gate: make(chan struct{})}
+			server := rpc.NewServer()
+			if err := server.RegisterName("eth", service); err != nil {
+				t.Fatal(err)
+			}
+			defer server.Stop()
+			client := ethclient.NewClient(rpc.DialInProc(server))
+			defer client.Close()
+			pd, _, store := newTestDiscoverer(t, &mockChain{}, &AppConfig{})
+			pd.client = client
+			if tt.known {
+				pd.knownPools.Store(pool.Hex(), true)
+			}
+			if tt.blacklisted {
+				if err := store.InsertPoolIfNotExists(testPool(pool, testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := pd.blacklist.Set(store, pool, true); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := protocolConfig{Name: ProtocolUniswapV2Like, ContractABI: &v2PairABI}
+
+			// 所有事件同时开始；登记成功的那一次停在链上调用中，其余事件返回后再放行
+			start := make(chan struct{})
+			var returned atomic.Int64
+			var wg sync.WaitGroup
+			for i := 0; i < tt.events; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					pd.inspectPool(context.Background(), v2SwapLog(pool, 1000, 900), cfg)
+					returned.Add(1)
+				}()
+			}
+			close(start)
+			waitFor(t, func() bool { return returned.Load() >= int64(tt.events)-tt.wantInspections })
+			close(service.gate)
+			wg.Wait()
+			if got := service.inspections.Load(); got != tt.wantInspections {
+				t.Fatalf("%d 个并发事件触发 %d 次解析，期望 %d 次", tt.events, got, tt.wantInspections)
+			}
+
+			pd.inspectPool(context.Background(), v2SwapLog(pool, 1000, 900), cfg)
+			want := tt.wantInspections
+			if tt.wantRetry {
+				want++
+			}
+			if got := service.inspections.Load(); got != want {
+				t.Fatalf("之后的事件使解析次数变为 %d，期望 %d（失败后重试 %v）", got, want, tt.wantRetry)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 池子导出格式
+const (
+	// ExportFormatCSV 带表头的 CSV，多币池的代币、符号、储备量、权重与成交量以分号分隔
+	ExportFormatCSV = "csv"
+	// ExportFormatNDJSON 每行一个 JSON 对象，字段与 GET /pools/:address 的响应一致
+	ExportFormatNDJSON = "ndjson"
+)
+
+// exportPageSize 导出时每次查询读取的池子数量，每页读完即释放读锁，写出期间不阻塞写入
+const exportPageSize = 1000
+
+// poolExportCSVHeader CSV 导出的表头
+var poolExportCSVHeader = []string{
+	"address", "protocol", "fee", "fee_bps", "fee_pips", "fee_pips_one_for_zero", "fee_source", "active", "blacklisted",
+	"tokens", "symbols", "reserves", "weights",
+	"created_at", "updated_at", "last_reserve_update", "reserve_discrepancy", "volume_24h",
+	"discovered_block", "discovered_tx",
+}
+
+// ExportPools 按 format（csv/ndjson）将全部池子（包括已失效的池子）按地址顺序写入 w，不把结果集整体加载到内存
+// 按地址分页读取（每页 exportPageSize 个），只在读取一页时持有读锁，向慢速客户端写出期间 SQLite 的写入不会被阻塞；
+// 各页在不同时刻读取，导出期间写入的池子可能出现在后续页中，不保证是同一时刻的快照
+// 代币符号来自代币表，尚未检测到元数据的代币符号为空
+func (ps *PoolStore) ExportPools(ctx context.Context, w io.Writer, format string) error {
+	return ps.exportPools(ctx, w, format, exportPageSize)
+}
+
+func (ps *PoolStore) exportPools(ctx context.Context, w io.Writer, format string, pageSize int) error {
+	var write func(pool poolView) error
+	flush := func() error { return nil }
+	switch format {
+	case ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(poolExportCSVHeader); err != nil {
+			return err
+		}
+		write = func(pool poolView) error { return cw.Write(poolCSVRecord(pool)) }
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case ExportFormatNDJSON:
+		encoder := json.NewEncoder(w)
+		write = func(pool poolView) error { return encoder.Encode(pool) }
+	default:
+		return fmt.Errorf("不支持的导出格式: %s（可选 csv、ndjson）", format)
+	}
+
+	metas, err := ps.ListTokens(ctx)
+	if err != nil {
+		return fmt.Errorf("读取代币元数据失败: %w", err)
+	}
+	byAddress := make(map[common.Address]tokenMetadata, len(metas))
+	for _, meta := range metas {
+		byAddress[meta.Address] = meta
+	}
+	lookup := func(token common.Address) (tokenMetadata, bool) {
+		meta, ok := byAddress[token]
+		return meta, ok
+	}
+
+	after := ""
+	for {
+		page, err := ps.exportPage(ctx, after, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, pool := range page {
+			if err := write(newPoolView(pool, lookup)); err != nil {
+				return err
+			}
+		}
+		if len(page) < pageSize {
+			return flush()
+		}
+		after = page[len(page)-1].Address.Hex()
+	}
+}
+
+// exportPage 读取地址大于 after 的下一页池子，读完后释放读锁
+func (ps *PoolStore) exportPage(ctx context.Context, after string, pageSize int) ([]poolDetail, error) {
+	ps.rlock()
+	defer ps.runlock()
+
+	rows, err := ps.db.QueryContext(ctx, ps.dialect.rebind(`SELECT `+poolColumns+` FROM pools WHERE id > ? ORDER BY id LIMIT ?`), after, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := make([]poolDetail, 0, pageSize)
+	for rows.Next() {
+		pool, err := scanPool(rows)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, pool)
+	}
+	return page, rows.Err()
+}
+
+// poolCSVRecord 将池子转换为一行 CSV，列顺序与 poolExportCSVHeader 一致
+func poolCSVRecord(pool poolView) []string {
+	addresses := make([]string, len(pool.Tokens))
+	symbols := make([]string, len(pool.Tokens))
+	reserves := make([]string, len(pool.Tokens))
+	volumes := make([]string, len(pool.Tokens))
+	var weights []string
+	for i, token := range pool.Tokens {
+		addresses[i] = token.Address
+		symbols[i] = token.Symbol
+		reserves[i] = token.Reserve
+		volumes[i] = token.Volume24h
+		if token.Weight != nil {
+			weights = append(weights, strconv.FormatFloat(*token.Weight, 'f', -1, 64))
+		}
+	}
+	reserveUpdatedAt := ""
+	if pool.ReserveUpdatedAt != nil {
+		reserveUpdatedAt = pool.ReserveUpdatedAt.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		pool.Address,
+		pool.Protocol,
+		strconv.FormatFloat(pool.Fee, 'f', -1, 64),
+		strconv.Itoa(pool.FeeBps),
+		strconv.Itoa(pool.FeePips),
+		strconv.Itoa(pool.FeePipsOneForZero),
+		pool.FeeSource,
+		strconv.FormatBool(pool.Active),
+		strconv.FormatBool(pool.Blacklisted),
+		strings.Join(addresses, ";"),
+		strings.Join(symbols, ";"),
+		strings.Join(reserves, ";"),
+		strings.Join(weights, ";"),
+		pool.CreatedAt.UTC().Format(time.RFC3339),
+		pool.UpdatedAt.UTC().Format(time.RFC3339),
+		reserveUpdatedAt,
+		strconv.FormatBool(pool.ReserveDiscrepancy),
+		strings.Join(volumes, ";"),
+		strconv.FormatUint(pool.DiscoveredBlock, 10),
+		pool.DiscoveredTx,
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// tokenPair 与顺序无关的代币对键，较小的地址在前
+type tokenPair [2]common.Address
+
+// newTokenPair 构建代币对键，(a, b) 与 (b, a) 得到相同的键
+func newTokenPair(a, b common.Address) tokenPair {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return tokenPair{a, b}
+}
+
+// poolPairs 返回池子包含的全部代币对，多币池的任意两个代币都构成一个交易对
+func poolPairs(pool poolDetail) []tokenPair {
+	var pairs []tokenPair
+	for i := 0; i < len(pool.Tokens); i++ {
+		for j := i + 1; j < len(pool.Tokens); j++ {
+			if pool.Tokens[i] != pool.Tokens[j] {
+				pairs = append(pairs, newTokenPair(pool.Tokens[i], pool.Tokens[j]))
+			}
+		}
+	}
+	return pairs
+}
+
+// poolIndex 池子列表的内存快照，按代币与代币对建立倒排索引
+// 枚举套利环时每一层递归只需要包含当前输入代币的池子，避免反复线性扫描全部池子；
+// 按代币对可以直接取出同一交易对在不同 DEX、不同协议上的全部池子，即两池往返套利的候选
+type poolIndex struct {
+	byToken map[common.Address][]poolDetail
+	byPair  map[tokenPair][]poolDetail
+}
+
+// newPoolIndex 为池子列表建立代币与代币对索引，多币池会出现在其每个代币、每个代币对的列表中
+// 每个列表保持输入顺序（ListPools 的稳定排序），同一份池子数据的枚举顺序可复现
+func newPoolIndex(pools []poolDetail) *poolIndex {
+	idx := &poolIndex{
+		byToken: make(map[common.Address][]poolDetail),
+		byPair:  make(map[tokenPair][]poolDetail),
+	}
+	for _, pool := range pools {
+		for _, token := range pool.Tokens {
+			idx.byToken[token] = append(idx.byToken[token], pool)
+		}
+		for _, pair := range poolPairs(pool) {
+			idx.byPair[pair] = append(idx.byPair[pair], pool)
+		}
+	}
+	return idx
+}
+
+// PoolsByToken 返回包含指定代币的全部池子，返回的切片不应被修改
+func (idx *poolIndex) PoolsByToken(token common.Address) []poolDetail {
+	return idx.byToken[token]
+}
+
+// PoolsForPair 返回同时包含 token0 与 token1 的全部池子（跨协议、跨 DEX），与两个代币的先后顺序无关；
+// 返回的切片不应被修改
+func (idx *poolIndex) PoolsForPair(token0, token1 common.Address) []poolDetail {
+	return idx.byPair[newTokenPair(token0, token1)]
+}
+
+// Upsert 用新的池子数据替换索引中同地址的池子，不存在时加入索引
+// 替换时原地修改各代币的列表，调用方需保证没有并发读取
+func (idx *poolIndex) Upsert(pool poolDetail) {
+	for _, token := range pool.Tokens {
+		pools := idx.byToken[token]
+		replaced := false
+		for i := range pools {
+			if pools[i].Address == pool.Address {
+				pools[i] = pool
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			idx.byToken[token] = append(pools, pool)
+		}
+	}
+	for _, pair := range poolPairs(pool) {
+		pools := idx.byPair[pair]
+		replaced := false
+		for i := range pools {
+			if pools[i].Address == pool.Address {
+				pools[i] = pool
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			idx.byPair[pair] = append(pools, pool)
+		}
+	}
+}
+
+// Remove 从索引中移除池子
+func (idx *poolIndex) Remove(pool poolDetail) {
+	for _, token := range pool.Tokens {
+		pools := idx.byToken[token]
+		for i := range pools {
+			if pools[i].Address == pool.Address {
+				// 复制而不是原地删除，避免影响调用方仍持有的旧切片
+				kept := make([]poolDetail, 0, len(pools)-1)
+				kept = append(kept, pools[:i]...)
+				idx.byToken[token] = append(kept, pools[i+1:]...)
+				break
+			}
+		}
+	}
+	for _, pair := range poolPairs(pool) {
+		pools := idx.byPair[pair]
+		for i := range pools {
+			if pools[i].Address == pool.Address {
+				kept := make([]poolDetail, 0, len(pools)-1)
+				kept = append(kept, pools[:i]...)
+				idx.byPair[pair] = append(kept, pools[i+1:]...)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// randomPools 生成 n 个连接 tokens 个代币的两币池，同一 seed 得到相同的池子
+func randomPools(n, tokens int, seed int64) []poolDetail {
+	rng := rand.New(rand.NewSource(seed))
+	pools := make([]poolDetail, 0, n)
+	for i := 0; i < n; i++ {
+		a := rng.Intn(tokens)
+		b := (a + 1 + rng.Intn(tokens-1)) % tokens
+		reserve := units(int64(100+rng.Intn(900)), 18)
+		pools = append(pools, testPool(common.BigToAddress(big.NewInt(int64(1_000_000+i))), testAddr(a), testAddr(b), reserve, new(big.Int).Set(reserve), 25))
+	}
+	return pools
+}
+
+// fullScanArb 引入代币索引之前的枚举方式：每一层都线性扫描全部池子，用作对照
+func fullScanArb(pools []poolDetail, tokenIn, tokenOut common.Address, maxHops int, route []poolDetail, path []common.Address,
+	used map[common.Address]struct{}, circles *[]arbitrageCircle) {
+	for _, pool := range pools {
+		inIdx := pool.TokenIndex(tokenIn)
+		if inIdx < 0 {
+			continue
+		}
+		if _, ok := used[pool.Address]; ok {
+			continue
+		}
+		for outIdx, out := range pool.Tokens {
+			if outIdx == inIdx || out == tokenIn {
+				continue
+			}
+			newRoute := append(append([]poolDetail{}, route...), pool)
+			newPath := append(append([]common.Address{}, path...), out)
+			if out == tokenOut && len(newRoute) >= 2 {
+				*circles = append(*circles, arbitrageCircle{Route: newRoute, Path: newPath})
+			} else if maxHops > 1 {
+				used[pool.Address] = struct{}{}
+				fullScanArb(pools, out, tokenOut, maxHops-1, newRoute, newPath, used, circles)
+				delete(used, pool.Address)
+			}
+		}
+	}
+}
+
+// routeKeys 返回每个套利环经过的池子序列，用于比较两种枚举的结果
+func routeKeys(circles []arbitrageCircle) map[string]int {
+	keys := make(map[string]int, len(circles))
+	for _, circle := range circles {
+		key := ""
+		for _, pool := range circle.Route {
+			key += pool.Address.Hex()
+		}
+		keys[key]++
+	}
+	return keys
+}
+
+func indexedArb(af *ArbitrageFinder, index *poolIndex, start common.Address, maxHops int) []arbitrageCircle {
+	var circles []arbitrageCircle
+	explored := 0
+	af.findArb(context.Background(), index, start, start, maxHops, nil, []common.Address{start}, map[common.Address]struct{}{}, 1, nil, &circles, &explored)
+	return circles
+}
+
+// TestFindArbMatchesFullScan 按代币索引枚举与全量扫描得到相同的套利环
+func TestFindArbMatchesFullScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		pools   int
+		tokens  int
+		maxHops int
+	}{
+		{name: "two hops", pools: 200, tokens: 20, maxHops: 2},
+		{name: "three hops", pools: 200, tokens: 20, maxHops: 3},
+		{name: "four hops sparse", pools: 60, tokens: 20, maxHops: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pools := randomPools(tt.pools, tt.tokens, 1)
+			af, _ := newTestFinder(t, &AppConfig{})
+			start := testAddr(0)
+
+			indexed := indexedArb(af, newPoolIndex(pools), start, tt.maxHops)
+			var scanned []arbitrageCircle
+			fullScanArb(pools, start, start, tt.maxHops, nil, []common.Address{start}, map[common.Address]struct{}{}, &scanned)
+
+			if len(indexed) == 0 || len(indexed) != len(scanned) {
+				t.Fatalf("索引枚举 %d 个环，全量扫描 %d 个", len(indexed), len(scanned))
+			}
+			want := routeKeys(scanned)
+			for key, count := range routeKeys(indexed) {
+				if want[key] != count {
+					t.Fatalf("路径 %s 在索引枚举中出现 %d 次，全量扫描 %d 次", key, count, want[key])
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkFindArb 5000 个池子、三跳上限下从一个起点枚举套利环：按代币索引只遍历包含当前代币的池子，全量扫描每层遍历全部池子
+func BenchmarkFindArb(b *testing.B) {
+	pools := randomPools(5000, 200, 1)
+	start := testAddr(0)
+	af := &ArbitrageFinder{cfg: &AppConfig{}}
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if len(indexedArb(af, newPoolIndex(pools), start, 3)) == 0 {
+				b.Fatal("没有找到套利环")
+			}
+		}
+	})
+	b.Run("full_scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var circles []arbitrageCircle
+			fullScanArb(pools, start, start, 3, nil, []common.Address{start}, map[common.Address]struct{}{}, &circles)
+			if len(circles) == 0 {
+				b.Fatal("没有找到套利环")
+			}
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// 池子清理模式
+const (
+	// PoolPruneModeDeactivate 将失效池子标记为 inactive，保留记录以便恢复（默认）
+	PoolPruneModeDeactivate = "deactivate"
+	// PoolPruneModeDelete 直接删除失效池子
+	PoolPruneModeDelete = "delete"
+)
+
+// PoolPruner 定期清理长时间未更新且流动性过低的池子，避免套利发现者每次加载大量死池子；
+// 同时按 OPPORTUNITY_RETENTION 清理过期的套利机会记录，避免统计表无限增长
+type PoolPruner struct {
+	store Store
+	cfg   *AppConfig
+	// paused 未恢复的 Pause 调用次数，大于 0 时跳过清理
+	paused atomic.Int32
+}
+
+// NewPoolPruner 创建池子清理任务
+func NewPoolPruner(store Store, cfg *AppConfig) *PoolPruner {
+	return &PoolPruner{
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Start 启动定期清理，POOL_TTL 与 OPPORTUNITY_RETENTION 都为 0 时不执行
+func (pp *PoolPruner) Start(ctx context.Context) {
+	if pp.cfg.PoolTTL <= 0 {
+		log.Printf("池子清理未启用 (POOL_TTL=0)")
+	}
+	if pp.cfg.PoolTTL <= 0 && pp.cfg.OpportunityRetention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(pp.cfg.PoolPruneInterval)
+	defer ticker.Stop()
+
+	pp.prune(ctx) // 启动时先执行一次
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pp.prune(ctx)
+		}
+	}
+}
+
+// Pause 暂停清理直到调用返回的恢复函数，可嵌套调用；暂停期间到期的清理直接跳过，不会在恢复后补做
+func (pp *PoolPruner) Pause() (resume func()) {
+	pp.paused.Add(1)
+	var once atomic.Bool
+	return func() {
+		if once.CompareAndSwap(false, true) {
+			pp.paused.Add(-1)
+		}
+	}
+}
+
+func (pp *PoolPruner) prune(ctx context.Context) {
+	pp.pruneOpportunities(ctx, time.Now())
+	if pp.cfg.PoolTTL == 0 {
+		// 只开启了套利机会记录清理
+		return
+	}
+	if pp.paused.Load() > 0 {
+		log.Printf("历史区块回放中，跳过本轮池子清理")
+		return
+	}
+	before := time.Now().Add(-pp.cfg.PoolTTL)
+
+	var (
+		affected int64
+		err      error
+	)
+	if pp.cfg.PoolPruneMode == PoolPruneModeDelete {
+		affected, err = pp.store.DeleteStalePools(ctx, before, pp.cfg.PoolPruneMinReserve)
+	} else {
+		affected, err = pp.store.DeactivateStalePools(ctx, before, pp.cfg.PoolPruneMinReserve)
+	}
+	if err != nil {
+		log.Printf("清理失效池子失败: %v", err)
+		return
+	}
+	log.Printf("清理失效池子 (%s): %d 个，条件: %v 前未更新且储备量低于 %s",
+		pp.cfg.PoolPruneMode, affected, before.Format(time.RFC3339), pp.cfg.PoolPruneMinReserve.String())
+}
+
+// pruneOpportunities 删除早于 OPPORTUNITY_RETENTION 的套利机会记录，不受回放暂停影响
+func (pp *PoolPruner) pruneOpportunities(ctx context.Context, now time.Time) {
+	if pp.cfg.OpportunityRetention <= 0 {
+		return
+	}
+	before := now.Add(-pp.cfg.OpportunityRetention)
+	deleted, err := pp.store.DeleteOpportunitiesBefore(ctx, before)
+	if err != nil {
+		log.Printf("清理过期套利机会记录失败: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("清理过期套利机会记录: %d 条，条件: %v 前确认", deleted, before.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestPruneOpportunities 按 OPPORTUNITY_RETENTION 删除过期的套利机会及其按代币的记录，保留期内的记录不受影响
+func TestPruneOpportunities(t *testing.T) {
+	now := time.Now()
+	ages := []time.Duration{time.Hour, 47 * time.Hour, 49 * time.Hour, 30 * 24 * time.Hour}
+	tests := []struct {
+		name      string
+		retention time.Duration
+		wantLeft  int64
+	}{
+		{name: "disabled keeps everything", retention: 0, wantLeft: 4},
+		{name: "two days", retention: 48 * time.Hour, wantLeft: 2},
+		{name: "shorter than every record", retention: time.Minute, wantLeft: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestPoolStore(t)
+			for i, age := range ages {
+				record := OpportunityRecord{StartToken: testAddr(1), Tokens: []common.Address{testAddr(1), testAddr(2 + i)}, ProfitUSD: 1, At: now.Add(-age)}
+				if err := store.RecordOpportunity(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			NewPoolPruner(store, &AppConfig{OpportunityRetention: tt.retention}).pruneOpportunities(context.Background(), now)
+
+			count := func(table string) int64 {
+				var n int64
+				if err := store.db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+					t.Fatal(err)
+				}
+				return n
+			}
+			if got := count("opportunities"); got != tt.wantLeft {
+				t.Fatalf("opportunities 剩余 %d 条，期望 %d 条", got, tt.wantLeft)
+			}
+			// 每个机会经过两个代币，按代币的记录同步删除
+			if got := count("opportunity_tokens"); got != 2*tt.wantLeft {
+				t.Fatalf("opportunity_tokens 剩余 %d 条，期望 %d 条", got, 2*tt.wantLeft)
+			}
+		})
+	}
+}
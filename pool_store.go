@@ -4,42 +4,59 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log"
+	"math"
 	"math/big"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	_ "modernc.org/sqlite"
 )
 
-// PoolStore 负责池子信息的持久化
+// PoolStore 负责池子信息的持久化，SQLite 与 Postgres 共用同一套实现，差异由 dialect 描述
 type PoolStore struct {
 	db *sql.DB
-	mu sync.Mutex
+	// mu 串行化方言下写操作独占、读操作共享；单连接时读操作仍由连接池排队
+	mu      sync.RWMutex
+	dialect sqlDialect
+}
+
+// SQLiteOptions SQLite 连接参数
+// synchronous=NORMAL 在 WAL 模式下只在检查点时 fsync，写入明显更快，但断电可能丢失最近提交的事务（不会损坏库文件）；
+// 多连接时读取可与写入并发，但每个连接各自占用 cache_size 的页缓存
+type SQLiteOptions struct {
+	// BusyTimeout 锁冲突时的等待时长
+	BusyTimeout time.Duration
+	// CacheSize 页缓存大小，正数为页数、负数为 KiB，0 表示不设置
+	CacheSize int
+	// Synchronous 同步级别，为空时不设置
+	Synchronous string
+	// MaxConns 连接池大小，小于 1 时按 1 处理
+	MaxConns int
 }
 
 // NewPoolStore 创建池子存储，path 为空时默认使用 pools.db
-func NewPoolStore(path string) (*PoolStore, error) {
+func NewPoolStore(path string, opts SQLiteOptions) (*PoolStore, error) {
 	if path == "" {
 		path = defaultSQLitePath
 	}
-
-	dsn := path
-	if !strings.HasPrefix(path, "file:") {
-		// 设置 busy_timeout 和 WAL，提高并发写入能力
-		dsn = fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	if opts.MaxConns < 1 {
+		opts.MaxConns = 1
 	}
 
-	db, err := sql.Open("sqlite", dsn)
+	db, err := sql.Open("sqlite", sqliteDSN(path, opts))
 	if err != nil {
 		return nil, fmt.Errorf("打开数据库失败: %w", err)
 	}
 
-	// 使用单连接模式，避免驱动在内部创建多个连接导致锁冲突
-	db.SetMaxOpenConns(1)
-	db.SetMaxIdleConns(1)
+	// 默认单连接，避免驱动在内部创建多个连接导致锁冲突；多连接时写入由 mu 串行化，读取可在 WAL 下并发
+	db.SetMaxOpenConns(opts.MaxConns)
+	db.SetMaxIdleConns(opts.MaxConns)
 
-	store := &PoolStore{db: db}
+	store := &PoolStore{db: db, dialect: sqliteDialect}
 	if err := store.init(); err != nil {
 		db.Close()
 		return nil, err
@@ -48,6 +65,26 @@ func NewPoolStore(path string) (*PoolStore, error) {
 	return store, nil
 }
 
+// sqliteDSN 将连接参数拼接为 _pragma 查询参数，驱动会在每个新连接上执行，多连接时各连接设置一致
+// path 以 file: 开头时视为完整 DSN 原样使用
+func sqliteDSN(path string, opts SQLiteOptions) string {
+	if strings.HasPrefix(path, "file:") {
+		return path
+	}
+	// 设置 busy_timeout 和 WAL，提高并发写入能力
+	pragmas := []string{
+		fmt.Sprintf("busy_timeout(%d)", opts.BusyTimeout.Milliseconds()),
+		"journal_mode(WAL)",
+	}
+	if opts.Synchronous != "" {
+		pragmas = append(pragmas, fmt.Sprintf("synchronous(%s)", opts.Synchronous))
+	}
+	if opts.CacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("cache_size(%d)", opts.CacheSize))
+	}
+	return fmt.Sprintf("file:%s?_pragma=%s", path, strings.Join(pragmas, "&_pragma="))
+}
+
 func (ps *PoolStore) init() error {
 	const createTable = `
 CREATE TABLE IF NOT EXISTS pools (
@@ -55,58 +92,575 @@ CREATE TABLE IF NOT EXISTS pools (
 	protocol TEXT NOT NULL,
 	token0 TEXT NOT NULL,
 	token1 TEXT NOT NULL,
-	fee REAL NOT NULL,
+	fee DOUBLE PRECISION NOT NULL,
+	fee_one_for_zero_pips INTEGER NOT NULL DEFAULT 0,
+	fee_source TEXT NOT NULL DEFAULT '',
+	tokens TEXT NOT NULL DEFAULT '',
+	reserves TEXT NOT NULL DEFAULT '',
+	weights TEXT NOT NULL DEFAULT '',
 	reserve0 TEXT NOT NULL DEFAULT '0',
 	reserve1 TEXT NOT NULL DEFAULT '0',
-	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	last_reserve_update {{DATETIME}},
+	reserve_discrepancy {{BOOL}} NOT NULL DEFAULT FALSE,
+	volume_24h TEXT NOT NULL DEFAULT '',
+	volume_updated_at {{DATETIME}},
+	discovered_block BIGINT NOT NULL DEFAULT 0,
+	discovered_tx TEXT NOT NULL DEFAULT '',
+	active {{BOOL}} NOT NULL DEFAULT TRUE,
+	blacklisted {{BOOL}} NOT NULL DEFAULT FALSE,
+	created_at {{DATETIME}} NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{DATETIME}} NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+	const createTokensTable = `
+CREATE TABLE IF NOT EXISTS tokens (
+	address TEXT PRIMARY KEY,
+	symbol TEXT NOT NULL DEFAULT '',
+	decimals INTEGER NOT NULL DEFAULT -1,
+	tax_bps INTEGER NOT NULL DEFAULT 0,
+	tax_known {{BOOL}} NOT NULL DEFAULT FALSE,
+	read_only {{BOOL}} NOT NULL DEFAULT FALSE,
+	updated_at {{DATETIME}} NOT NULL DEFAULT CURRENT_TIMESTAMP
 );`
 
-	ps.mu.Lock()
-	defer ps.mu.Unlock()
+	const createMetaTable = `
+CREATE TABLE IF NOT EXISTS meta (
+	name TEXT PRIMARY KEY,
+	value TEXT NOT NULL,
+	updated_at {{DATETIME}} NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+
+	// seen_paths 记录套利发现者已推送路径的静默截止时间，重启后恢复 ARB_PATH_COOLDOWN 去重
+	const createSeenPathsTable = `
+CREATE TABLE IF NOT EXISTS seen_paths (
+	path_key TEXT PRIMARY KEY,
+	expires_at {{DATETIME}} NOT NULL
+);`
+
+	// opportunities 记录计算者确认的套利机会，opportunity_tokens 按代币展开，供 /stats 按时间范围聚合
+	const createOpportunitiesTable = `
+CREATE TABLE IF NOT EXISTS opportunities (
+	start_token TEXT NOT NULL,
+	hops INTEGER NOT NULL,
+	tokens TEXT NOT NULL DEFAULT '',
+	pools TEXT NOT NULL DEFAULT '',
+	profit_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+	created_at {{DATETIME}} NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+	const createOpportunityTokensTable = `
+CREATE TABLE IF NOT EXISTS opportunity_tokens (
+	token TEXT NOT NULL,
+	profit_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+	created_at {{DATETIME}} NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+	// paper_trades 模拟交易账本，只在开启 PAPER_TRADING 时写入
+	const createPaperTradesTable = `
+CREATE TABLE IF NOT EXISTS paper_trades (
+	start_token TEXT NOT NULL,
+	hops INTEGER NOT NULL,
+	pools TEXT NOT NULL DEFAULT '',
+	amount_in DOUBLE PRECISION NOT NULL DEFAULT 0,
+	expected_out DOUBLE PRECISION NOT NULL DEFAULT 0,
+	realized_out DOUBLE PRECISION NOT NULL DEFAULT 0,
+	expected_pnl_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+	realized_pnl_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+	rechecked {{BOOL}} NOT NULL DEFAULT FALSE,
+	unpriced {{BOOL}} NOT NULL DEFAULT FALSE,
+	created_at {{DATETIME}} NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+	const createOpportunityIndexes = `CREATE INDEX IF NOT EXISTS idx_opportunities_created_at ON opportunities (created_at);`
+	const createOpportunityTokenIndexes = `CREATE INDEX IF NOT EXISTS idx_opportunity_tokens_created_at ON opportunity_tokens (created_at, token);`
+	const createPaperTradeIndexes = `CREATE INDEX IF NOT EXISTS idx_paper_trades_created_at ON paper_trades (created_at);`
+
+	ps.lock()
+	defer ps.unlock()
+
+	for _, stmt := range []string{createTable, createTokensTable, createMetaTable, createSeenPathsTable,
+		createOpportunitiesTable, createOpportunityTokensTable, createOpportunityIndexes, createOpportunityTokenIndexes,
+		createPaperTradesTable, createPaperTradeIndexes} {
+		if _, err := ps.db.Exec(ps.dialect.schema(stmt)); err != nil {
+			return err
+		}
+	}
+
+	// 兼容旧版本创建的表，补齐新增的列
+	if err := ps.ensureColumn("pools", "last_reserve_update", "{{DATETIME}}"); err != nil {
+		return err
+	}
+	if err := ps.ensureColumn("pools", "active", "{{BOOL}} NOT NULL DEFAULT TRUE"); err != nil {
+		return err
+	}
+	if err := ps.ensureColumn("pools", "fee_source", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ps.ensureColumn("pools", "reserve_discrepancy", "{{BOOL}} NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err := ps.ensureColumn("pools", "volume_updated_at", "{{DATETIME}}"); err != nil {
+		return err
+	}
+	if err := ps.ensureColumn("pools", "discovered_block", "BIGINT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ps.ensureColumn("pools", "blacklisted", "{{BOOL}} NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err := ps.ensureColumn("pools", "fee_one_for_zero_pips", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ps.ensureColumn("paper_trades", "unpriced", "{{BOOL}} NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	for _, column := range []string{"tokens", "reserves", "weights", "volume_24h", "discovered_tx"} {
+		if err := ps.ensureColumn("pools", column, "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+
+	if err := ps.widenFeeColumn(); err != nil {
+		return err
+	}
+	if err := ps.dropLegacyWeightColumns(); err != nil {
+		return err
+	}
+
+	// 旧版本只有 token0/token1、reserve0/reserve1 两列，迁移为数组列
+	const backfillArrays = `
+UPDATE pools SET
+	tokens = token0 || ',' || token1,
+	reserves = reserve0 || ',' || reserve1
+WHERE tokens = '';`
+	if _, err := ps.db.Exec(backfillArrays); err != nil {
+		return fmt.Errorf("迁移池子代币列失败: %w", err)
+	}
+	return ps.normalizeAddressKeys()
+}
+
+// widenFeeColumn 将旧版本 Postgres 中单精度（REAL）的 fee 列改为 DOUBLE PRECISION，调用方已持有锁
+// 单精度只有约 7 位有效数字，0.3 读回为 0.30000001，换算费率时可能落到相邻的基点；迁移时按 6 位小数取整去掉该误差
+// SQLite 的 REAL 本身就是 8 字节浮点数，无需迁移
+func (ps *PoolStore) widenFeeColumn() error {
+	if ps.dialect.name != StoreDriverPostgres {
+		return nil
+	}
+	var dataType string
+	err := ps.db.QueryRow(`SELECT data_type FROM information_schema.columns WHERE table_name = 'pools' AND column_name = 'fee' AND table_schema = current_schema()`).Scan(&dataType)
+	if err != nil {
+		return fmt.Errorf("读取 fee 列类型失败: %w", err)
+	}
+	if dataType != "real" {
+		return nil
+	}
+	if _, err := ps.db.Exec(`ALTER TABLE pools ALTER COLUMN fee TYPE DOUBLE PRECISION USING round(fee::numeric, 6)::double precision`); err != nil {
+		return fmt.Errorf("迁移 fee 列为 DOUBLE PRECISION 失败: %w", err)
+	}
+	log.Printf("已将 pools.fee 列迁移为 DOUBLE PRECISION")
+	return nil
+}
 
-	_, err := ps.db.Exec(createTable)
+// normalizeAddressKeys 将旧数据中非校验和格式的池子与代币地址统一为校验和格式，
+// 查询总是以 common.Address.Hex() 作为键，大小写不一致的记录会查不到；调用方已持有锁
+// 校验和格式的记录已经存在时（旧版本先写入小写地址，新版本又写入了同一地址），以校验和格式的记录为准，
+// 合并小写记录的拉黑标记后删除小写记录，避免同一地址在导出和统计中出现两次；全部改动在同一个事务中完成
+func (ps *PoolStore) normalizeAddressKeys() error {
+	rows, err := ps.db.Query(`SELECT id, token0, token1, tokens, blacklisted FROM pools`)
+	if err != nil {
+		return fmt.Errorf("读取池子地址失败: %w", err)
+	}
+	type poolKeys struct {
+		id, token0, token1, tokens string
+		blacklisted                bool
+	}
+	var stale []poolKeys
+	for rows.Next() {
+		var keys poolKeys
+		if err := rows.Scan(&keys.id, &keys.token0, &keys.token1, &keys.tokens, &keys.blacklisted); err != nil {
+			rows.Close()
+			return fmt.Errorf("读取池子地址失败: %w", err)
+		}
+		if keys.id != common.HexToAddress(keys.id).Hex() || keys.tokens != joinAddresses(splitAddresses(keys.tokens)) ||
+			keys.token0 != common.HexToAddress(keys.token0).Hex() || keys.token1 != common.HexToAddress(keys.token1).Hex() {
+			stale = append(stale, keys)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("读取池子地址失败: %w", err)
+	}
+
+	tokenRows, err := ps.db.Query(`SELECT address FROM tokens`)
+	if err != nil {
+		return fmt.Errorf("读取代币地址失败: %w", err)
+	}
+	var staleTokens []string
+	for tokenRows.Next() {
+		var address string
+		if err := tokenRows.Scan(&address); err != nil {
+			tokenRows.Close()
+			return fmt.Errorf("读取代币地址失败: %w", err)
+		}
+		if address != common.HexToAddress(address).Hex() {
+			staleTokens = append(staleTokens, address)
+		}
+	}
+	tokenRows.Close()
+	if err := tokenRows.Err(); err != nil {
+		return fmt.Errorf("读取代币地址失败: %w", err)
+	}
+	if len(stale) == 0 && len(staleTokens) == 0 {
+		return nil
+	}
+
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	exists := func(query, key string) (bool, error) {
+		var count int
+		if err := tx.QueryRow(ps.dialect.rebind(query), key).Scan(&count); err != nil {
+			return false, err
+		}
+		return count > 0, nil
+	}
+	var merged int
+	for _, keys := range stale {
+		id := common.HexToAddress(keys.id).Hex()
+		if id != keys.id {
+			duplicate, err := exists(`SELECT COUNT(*) FROM pools WHERE id = ?`, id)
+			if err != nil {
+				return fmt.Errorf("规范化池子 %s 的地址失败: %w", keys.id, err)
+			}
+			if duplicate {
+				if keys.blacklisted {
+					if _, err := tx.Exec(ps.dialect.rebind(`UPDATE pools SET blacklisted = TRUE WHERE id = ?`), id); err != nil {
+						return fmt.Errorf("合并池子 %s 的拉黑标记失败: %w", keys.id, err)
+					}
+				}
+				if _, err := tx.Exec(ps.dialect.rebind(`DELETE FROM pools WHERE id = ?`), keys.id); err != nil {
+					return fmt.Errorf("删除重复池子 %s 失败: %w", keys.id, err)
+				}
+				merged++
+				continue
+			}
+		}
+		if _, err := tx.Exec(ps.dialect.rebind(`UPDATE pools SET id = ?, token0 = ?, token1 = ?, tokens = ? WHERE id = ?`),
+			id, common.HexToAddress(keys.token0).Hex(), common.HexToAddress(keys.token1).Hex(),
+			joinAddresses(splitAddresses(keys.tokens)), keys.id); err != nil {
+			return fmt.Errorf("规范化池子 %s 的地址失败: %w", keys.id, err)
+		}
+	}
+
+	for _, address := range staleTokens {
+		normalized := common.HexToAddress(address).Hex()
+		duplicate, err := exists(`SELECT COUNT(*) FROM tokens WHERE address = ?`, normalized)
+		if err != nil {
+			return fmt.Errorf("规范化代币 %s 的地址失败: %w", address, err)
+		}
+		if duplicate {
+			if _, err := tx.Exec(ps.dialect.rebind(`DELETE FROM tokens WHERE address = ?`), address); err != nil {
+				return fmt.Errorf("删除重复代币 %s 失败: %w", address, err)
+			}
+			merged++
+			continue
+		}
+		if _, err := tx.Exec(ps.dialect.rebind(`UPDATE tokens SET address = ? WHERE address = ?`), normalized, address); err != nil {
+			return fmt.Errorf("规范化代币 %s 的地址失败: %w", address, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交地址规范化失败: %w", err)
+	}
+
+	log.Printf("已将 %d 个池子、%d 个代币的地址统一为校验和格式，其中 %d 条与已有的校验和格式记录重复，已合并删除",
+		len(stale), len(staleTokens), merged)
+	return nil
+}
+
+// lock 在需要串行化的方言（SQLite）下加锁，Postgres 依赖连接池并发访问
+func (ps *PoolStore) lock() {
+	if ps.dialect.serialized {
+		ps.mu.Lock()
+	}
+}
+
+func (ps *PoolStore) unlock() {
+	if ps.dialect.serialized {
+		ps.mu.Unlock()
+	}
+}
+
+// rlock 只读操作加共享锁，可与其他读操作并发，但会等待进行中的写操作
+func (ps *PoolStore) rlock() {
+	if ps.dialect.serialized {
+		ps.mu.RLock()
+	}
+}
+
+func (ps *PoolStore) runlock() {
+	if ps.dialect.serialized {
+		ps.mu.RUnlock()
+	}
+}
+
+// ensureColumn 检查表中是否存在指定列，不存在时追加，调用方需持有锁
+func (ps *PoolStore) ensureColumn(table, column, definition string) error {
+	definition = ps.dialect.schema(definition)
+	if ps.dialect.name == StoreDriverPostgres {
+		_, err := ps.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, column, definition))
+		return err
+	}
+
+	exists, err := ps.hasColumn(table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = ps.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	return err
 }
 
+// dropLegacyWeightColumns 删除早期版本加权池使用的 weight0/weight1 两列，调用方需持有锁
+// 多币池改为在 weights 列中按代币顺序保存全部权重后这两列不再读写；删除前把仍只存在于旧列中的权重迁移到 weights
+func (ps *PoolStore) dropLegacyWeightColumns() error {
+	exists, err := ps.hasColumn("pools", "weight0")
+	if err != nil || !exists {
+		return err
+	}
+	rows, err := ps.db.Query(`SELECT id, weight0, weight1 FROM pools WHERE weights = '' AND (weight0 > 0 OR weight1 > 0)`)
+	if err != nil {
+		return fmt.Errorf("读取旧权重列失败: %w", err)
+	}
+	legacy := make(map[string][]float64)
+	for rows.Next() {
+		var (
+			id               string
+			weight0, weight1 float64
+		)
+		if err := rows.Scan(&id, &weight0, &weight1); err != nil {
+			rows.Close()
+			return fmt.Errorf("读取旧权重列失败: %w", err)
+		}
+		legacy[id] = []float64{weight0, weight1}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("读取旧权重列失败: %w", err)
+	}
+	for id, weights := range legacy {
+		if _, err := ps.db.Exec(ps.dialect.rebind(`UPDATE pools SET weights = ? WHERE id = ?`), joinFloats(weights), id); err != nil {
+			return fmt.Errorf("迁移池子 %s 的权重失败: %w", id, err)
+		}
+	}
+	for _, column := range []string{"weight0", "weight1"} {
+		if _, err := ps.db.Exec(fmt.Sprintf("ALTER TABLE pools DROP COLUMN %s", column)); err != nil {
+			return fmt.Errorf("删除旧权重列 %s 失败: %w", column, err)
+		}
+	}
+	log.Printf("已删除 pools.weight0/weight1 旧权重列，迁移 %d 个池子的权重", len(legacy))
+	return nil
+}
+
+// hasColumn 判断表中是否存在指定列，调用方需持有锁
+func (ps *PoolStore) hasColumn(table, column string) (bool, error) {
+	if ps.dialect.name == StoreDriverPostgres {
+		var count int
+		err := ps.db.QueryRow(`SELECT COUNT(*) FROM information_schema.columns WHERE table_name = $1 AND column_name = $2 AND table_schema = current_schema()`, table, column).Scan(&count)
+		return count > 0, err
+	}
+
+	rows, err := ps.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
 // InsertPoolIfNotExists 如果池子不存在则插入，如果已存在则更新储备量
+// 重复写入是幂等的：created_at 保持首次写入时间；只有新储备量均非零时才覆盖旧值，
+// 避免 RPC 临时失败被吞成 0 后抹掉已有的有效储备数据
+// 费率、按方向收费池子的 token1 → token0 方向费率（fee_one_for_zero_pips，单位 1e-6）与费率来源总是以最新一次解析为准，使新增的费率覆盖配置在重启后生效
+// reserve_discrepancy 与储备量一起更新，只在写入有效储备量时以最新一次校验结果为准
+// 池子 id 与代币列均为校验和格式（与 normalizeAddress 一致），旧数据在 init 时统一迁移
+// discovered_block/discovered_tx 记录首次发现池子的区块与交易，之后的写入不会改变；旧数据为空时以下一次发现补齐
+// tokens/reserves/weights 以逗号分隔保存全部代币，token0/token1、reserve0/reserve1 保存前两个代币，供两币池查询与清理条件使用
 func (ps *PoolStore) InsertPoolIfNotExists(pool poolDetail) error {
 	const insertStmt = `
-INSERT INTO pools (id, protocol, token0, token1, fee, reserve0, reserve1, created_at, updated_at)
-VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+INSERT INTO pools (id, protocol, token0, token1, fee, fee_one_for_zero_pips, fee_source, tokens, reserves, weights, reserve0, reserve1, last_reserve_update, reserve_discrepancy, discovered_block, discovered_tx, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CASE WHEN CAST(? AS {{BOOL}}) THEN CURRENT_TIMESTAMP ELSE NULL END, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 ON CONFLICT(id) DO UPDATE SET
-	reserve0 = excluded.reserve0,
-	reserve1 = excluded.reserve1,
+	reserve0 = CASE WHEN excluded.last_reserve_update IS NOT NULL THEN excluded.reserve0 ELSE pools.reserve0 END,
+	reserve1 = CASE WHEN excluded.last_reserve_update IS NOT NULL THEN excluded.reserve1 ELSE pools.reserve1 END,
+	reserves = CASE WHEN excluded.last_reserve_update IS NOT NULL THEN excluded.reserves ELSE pools.reserves END,
+	last_reserve_update = CASE WHEN excluded.last_reserve_update IS NOT NULL THEN CURRENT_TIMESTAMP ELSE pools.last_reserve_update END,
+	reserve_discrepancy = CASE WHEN excluded.last_reserve_update IS NOT NULL THEN excluded.reserve_discrepancy ELSE pools.reserve_discrepancy END,
+	discovered_block = CASE WHEN pools.discovered_block = 0 THEN excluded.discovered_block ELSE pools.discovered_block END,
+	discovered_tx = CASE WHEN pools.discovered_block = 0 THEN excluded.discovered_tx ELSE pools.discovered_tx END,
+	fee = excluded.fee,
+	fee_one_for_zero_pips = excluded.fee_one_for_zero_pips,
+	fee_source = excluded.fee_source,
+	active = TRUE,
 	updated_at = CURRENT_TIMESTAMP;
 `
 
-	ps.mu.Lock()
-	defer ps.mu.Unlock()
+	ps.lock()
+	defer ps.unlock()
 
-	reserve0Str := "0"
-	reserve1Str := "0"
-	if pool.Reserve0 != nil {
-		reserve0Str = pool.Reserve0.String()
+	reserves := make([]string, len(pool.Tokens))
+	hasReserves := len(pool.Tokens) >= 2
+	for i := range reserves {
+		reserves[i] = "0"
+		if reserve := pool.reserveAt(i); reserve != nil {
+			reserves[i] = reserve.String()
+		}
+		if reserves[i] == "0" {
+			hasReserves = false
+		}
 	}
-	if pool.Reserve1 != nil {
-		reserve1Str = pool.Reserve1.String()
+	reserve0Str, reserve1Str := "0", "0"
+	if len(reserves) >= 2 {
+		reserve0Str, reserve1Str = reserves[0], reserves[1]
 	}
 
-	_, err := ps.db.Exec(insertStmt, pool.Address.Hex(), pool.Protocol, pool.Token0.Hex(), pool.Token1.Hex(), pool.Fee, reserve0Str, reserve1Str)
+	discoveredTx := ""
+	if pool.DiscoveredTx != (common.Hash{}) {
+		discoveredTx = pool.DiscoveredTx.Hex()
+	}
+
+	_, err := ps.db.Exec(ps.dialect.rebind(ps.dialect.schema(insertStmt)), pool.Address.Hex(), pool.Protocol, pool.Token0().Hex(), pool.Token1().Hex(), feePipsToPercent(pool.FeePips), pool.FeePipsOneForZero, pool.FeeSource,
+		joinAddresses(pool.Tokens), strings.Join(reserves, ","), joinFloats(pool.Weights), reserve0Str, reserve1Str, hasReserves, pool.ReserveDiscrepancy,
+		int64(pool.DiscoveredBlock), discoveredTx)
 	return err
 }
 
-// ListPools 返回数据库中所有池子信息
-func (ps *PoolStore) ListPools(ctx context.Context) ([]poolDetail, error) {
-	const selectStmt = `
-SELECT id, protocol, token0, token1, fee, reserve0, reserve1
-FROM pools;
-`
+// UpdatePoolVolume 写入池子按代币计的滚动成交量及其计算时间，不改变 updated_at；池子不存在时不做任何事
+func (ps *PoolStore) UpdatePoolVolume(address common.Address, volumes []*big.Int, at time.Time) error {
+	const updateStmt = `
+UPDATE pools SET volume_24h = ?, volume_updated_at = ?
+WHERE id = ?`
 
-	ps.mu.Lock()
-	defer ps.mu.Unlock()
+	parts := make([]string, len(volumes))
+	for i, volume := range volumes {
+		parts[i] = volume.String()
+	}
 
-	rows, err := ps.db.QueryContext(ctx, selectStmt)
+	ps.lock()
+	defer ps.unlock()
+
+	_, err := ps.db.Exec(ps.dialect.rebind(updateStmt), strings.Join(parts, ","), at.UTC(), address.Hex())
+	return err
+}
+
+// UpdatePoolReserves 覆盖池子的储备量并更新 last_reserve_update，用于从链上重新读取储备量后修正旧数据
+// 与 InsertPoolIfNotExists 不同，零储备量也会写入（读取失败由调用方跳过），且不改变 updated_at 与 active，
+// 不影响失效池子的清理判断；池子不存在时不做任何事
+func (ps *PoolStore) UpdatePoolReserves(address common.Address, reserves []*big.Int) error {
+	const updateStmt = `
+UPDATE pools SET reserves = ?, reserve0 = ?, reserve1 = ?, last_reserve_update = CURRENT_TIMESTAMP
+WHERE id = ?`
+
+	parts := make([]string, len(reserves))
+	for i, reserve := range reserves {
+		parts[i] = "0"
+		if reserve != nil {
+			parts[i] = reserve.String()
+		}
+	}
+	reserve0Str, reserve1Str := "0", "0"
+	if len(parts) >= 2 {
+		reserve0Str, reserve1Str = parts[0], parts[1]
+	}
+
+	ps.lock()
+	defer ps.unlock()
+
+	_, err := ps.db.Exec(ps.dialect.rebind(updateStmt), strings.Join(parts, ","), reserve0Str, reserve1Str, address.Hex())
+	return err
+}
+
+// SetPoolBlacklisted 设置或清除池子的拉黑标记，不改变 updated_at 与 active；池子不存在时返回 false
+func (ps *PoolStore) SetPoolBlacklisted(address common.Address, blacklisted bool) (bool, error) {
+	const updateStmt = `
+UPDATE pools SET blacklisted = ?
+WHERE id = ?`
+
+	ps.lock()
+	defer ps.unlock()
+
+	result, err := ps.db.Exec(ps.dialect.rebind(updateStmt), blacklisted, address.Hex())
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// poolColumns 读取池子时查询的列，与 scanPool 的扫描顺序一致
+const poolColumns = `id, protocol, fee, fee_one_for_zero_pips, fee_source, tokens, reserves, weights, active, created_at, updated_at, last_reserve_update, reserve_discrepancy, volume_24h, volume_updated_at, discovered_block, discovered_tx, blacklisted`
+
+// ListPools 返回数据库中的池子信息，opts.ActiveOnly 为 true 时跳过已失效的池子，opts.BlacklistedOnly 为 true 时只返回被拉黑的池子
+// 结果按 opts.OrderBy 排序（默认入库时间），排序键相同时按地址排序，因此多次查询与分页的顺序稳定
+func (ps *PoolStore) ListPools(ctx context.Context, opts ListPoolsOptions) ([]poolDetail, error) {
+	orderBy, ok := poolOrderClauses[opts.OrderBy]
+	if !ok {
+		return nil, fmt.Errorf("不支持的排序方式: %s", opts.OrderBy)
+	}
+	if opts.Limit < 0 || opts.Offset < 0 {
+		return nil, fmt.Errorf("分页参数非法: limit=%d offset=%d", opts.Limit, opts.Offset)
+	}
+
+	selectStmt := `
+SELECT ` + poolColumns + `
+FROM pools`
+	var conditions []string
+	if opts.ActiveOnly {
+		conditions = append(conditions, "active = TRUE")
+	}
+	if opts.BlacklistedOnly {
+		conditions = append(conditions, "blacklisted = TRUE")
+	}
+	if len(conditions) > 0 {
+		selectStmt += `
+WHERE ` + strings.Join(conditions, " AND ")
+	}
+	selectStmt += `
+ORDER BY ` + orderBy
+	var args []any
+	if opts.Limit > 0 || opts.Offset > 0 {
+		// SQLite 不支持只带 OFFSET 不带 LIMIT，不限制数量时传入最大值（两种方言都接受）
+		limit := int64(opts.Limit)
+		if limit == 0 {
+			limit = math.MaxInt64
+		}
+		selectStmt += `
+LIMIT ? OFFSET ?`
+		args = append(args, limit, opts.Offset)
+	}
+
+	ps.rlock()
+	defer ps.runlock()
+
+	rows, err := ps.db.QueryContext(ctx, ps.dialect.rebind(selectStmt), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -114,50 +668,234 @@ FROM pools;
 
 	var pools []poolDetail
 	for rows.Next() {
-		var (
-			id       string
-			protocol string
-			token0   string
-			token1   string
-			fee      float64
-			reserve0 string
-			reserve1 string
-		)
-		if err := rows.Scan(&id, &protocol, &token0, &token1, &fee, &reserve0, &reserve1); err != nil {
+		pool, err := scanPool(rows)
+		if err != nil {
 			return nil, err
 		}
+		pools = append(pools, pool)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return pools, nil
+}
 
-		reserve0Big := big.NewInt(0)
-		reserve1Big := big.NewInt(0)
-		if reserve0 != "" && reserve0 != "0" {
-			var ok bool
-			reserve0Big, ok = reserve0Big.SetString(reserve0, 10)
-			if !ok {
-				reserve0Big = big.NewInt(0)
-			}
-		}
-		if reserve1 != "" && reserve1 != "0" {
-			var ok bool
-			reserve1Big, ok = reserve1Big.SetString(reserve1, 10)
-			if !ok {
-				reserve1Big = big.NewInt(0)
+// GetPool 按地址读取单个池子（包括已失效的池子），不存在时第二个返回值为 false
+func (ps *PoolStore) GetPool(ctx context.Context, address common.Address) (poolDetail, bool, error) {
+	const selectStmt = `
+SELECT ` + poolColumns + `
+FROM pools
+WHERE id = ?`
+
+	ps.rlock()
+	defer ps.runlock()
+
+	pool, err := scanPool(ps.db.QueryRowContext(ctx, ps.dialect.rebind(selectStmt), address.Hex()))
+	if err == sql.ErrNoRows {
+		return poolDetail{}, false, nil
+	}
+	if err != nil {
+		return poolDetail{}, false, err
+	}
+	return pool, true, nil
+}
+
+// scanPool 将一行 poolColumns 解析为 poolDetail
+func scanPool(row interface{ Scan(dest ...any) error }) (poolDetail, error) {
+	var (
+		id        string
+		protocol  string
+		fee       float64
+		feeOtz    int
+		feeSource string
+		tokens    string
+		reserves  string
+		weights   string
+		active    bool
+		createdAt time.Time
+		updatedAt time.Time
+		reserveAt sql.NullTime
+		mismatch  bool
+		volumes   string
+		volumeAt  sql.NullTime
+		block     int64
+		txHash    string
+		blocked   bool
+	)
+	if err := row.Scan(&id, &protocol, &fee, &feeOtz, &feeSource, &tokens, &reserves, &weights, &active, &createdAt, &updatedAt, &reserveAt, &mismatch, &volumes, &volumeAt, &block, &txHash, &blocked); err != nil {
+		return poolDetail{}, err
+	}
+
+	pool := poolDetail{
+		Address:   common.HexToAddress(id),
+		Tokens:    splitAddresses(tokens),
+		FeePips:   feePercentToPips(fee),
+		Protocol:  protocol,
+		FeeSource: feeSource,
+		Weights:   splitFloats(weights),
+
+		FeePipsOneForZero: feeOtz,
+		Active:            active,
+		CreatedAt:         createdAt,
+		UpdatedAt:         updatedAt,
+
+		Blacklisted:        blocked,
+		ReserveDiscrepancy: mismatch,
+		DiscoveredBlock:    uint64(block),
+		DiscoveredTx:       common.HexToHash(txHash),
+	}
+	if reserveAt.Valid {
+		pool.ReserveUpdatedAt = &reserveAt.Time
+	}
+	// 储备量缺失或无法解析时按 0 处理，与代币数量保持一致
+	pool.Reserves = splitAmounts(reserves, len(pool.Tokens))
+	if volumeAt.Valid {
+		pool.Volume24h = splitAmounts(volumes, len(pool.Tokens))
+		pool.VolumeUpdatedAt = &volumeAt.Time
+	}
+	return pool, nil
+}
+
+// splitAmounts 解析逗号分隔的整数列表，结果长度固定为 n，缺失或无法解析的项按 0 处理
+func splitAmounts(value string, n int) []*big.Int {
+	parts := strings.Split(value, ",")
+	amounts := make([]*big.Int, n)
+	for i := range amounts {
+		amounts[i] = big.NewInt(0)
+		if i < len(parts) {
+			if amount, ok := new(big.Int).SetString(parts[i], 10); ok {
+				amounts[i] = amount
 			}
 		}
+	}
+	return amounts
+}
+
+// joinAddresses 将地址列表序列化为逗号分隔的字符串
+func joinAddresses(addresses []common.Address) string {
+	parts := make([]string, len(addresses))
+	for i, address := range addresses {
+		parts[i] = address.Hex()
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitAddresses(value string) []common.Address {
+	if value == "" {
+		return nil
+	}
+	parts := strings.Split(value, ",")
+	addresses := make([]common.Address, len(parts))
+	for i, part := range parts {
+		addresses[i] = common.HexToAddress(part)
+	}
+	return addresses
+}
+
+// joinFloats 将权重列表序列化为逗号分隔的字符串
+func joinFloats(values []float64) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitFloats(value string) []float64 {
+	if value == "" {
+		return nil
+	}
+	parts := strings.Split(value, ",")
+	values := make([]float64, len(parts))
+	for i, part := range parts {
+		values[i], _ = strconv.ParseFloat(part, 64)
+	}
+	return values
+}
+
+// staleCondition 失效池子的判定条件：超过 TTL 未更新，且任一侧储备量低于阈值
+const staleCondition = `updated_at < ? AND (CAST(reserve0 AS {{NUMERIC}}) < ? OR CAST(reserve1 AS {{NUMERIC}}) < ?)`
+
+// DeleteStalePools 删除 before 之前未更新且储备量低于 minReserve 的池子，返回删除数量
+func (ps *PoolStore) DeleteStalePools(ctx context.Context, before time.Time, minReserve *big.Int) (int64, error) {
+	return ps.pruneStalePools(ctx, `DELETE FROM pools WHERE `+staleCondition, before, minReserve)
+}
+
+// DeactivateStalePools 将 before 之前未更新且储备量低于 minReserve 的池子标记为失效，返回标记数量
+// 失效池子在再次被发现并写入有效储备量时自动恢复
+func (ps *PoolStore) DeactivateStalePools(ctx context.Context, before time.Time, minReserve *big.Int) (int64, error) {
+	return ps.pruneStalePools(ctx, `UPDATE pools SET active = FALSE WHERE active = TRUE AND `+staleCondition, before, minReserve)
+}
 
-		pools = append(pools, poolDetail{
-			Address:  common.HexToAddress(id),
-			Token0:   common.HexToAddress(token0),
-			Token1:   common.HexToAddress(token1),
-			Fee:      fee,
-			Protocol: protocol,
-			Reserve0: reserve0Big,
-			Reserve1: reserve1Big,
-		})
+func (ps *PoolStore) pruneStalePools(ctx context.Context, stmt string, before time.Time, minReserve *big.Int) (int64, error) {
+	threshold := 0.0
+	if minReserve != nil {
+		threshold, _ = new(big.Float).SetInt(minReserve).Float64()
+	}
+
+	ps.lock()
+	defer ps.unlock()
+
+	result, err := ps.db.ExecContext(ctx, ps.dialect.rebind(ps.dialect.schema(stmt)), dbTime(before), threshold, threshold)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// UpsertToken 写入或更新代币元数据
+func (ps *PoolStore) UpsertToken(meta tokenMetadata) error {
+	const upsertStmt = `
+INSERT INTO tokens (address, symbol, decimals, tax_bps, tax_known, read_only, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(address) DO UPDATE SET
+	symbol = excluded.symbol,
+	decimals = excluded.decimals,
+	tax_bps = excluded.tax_bps,
+	tax_known = excluded.tax_known,
+	read_only = excluded.read_only,
+	updated_at = CURRENT_TIMESTAMP;
+`
+
+	ps.lock()
+	defer ps.unlock()
+
+	_, err := ps.db.Exec(ps.dialect.rebind(upsertStmt), meta.Address.Hex(), meta.Symbol, meta.Decimals, meta.TaxBps, meta.TaxKnown, meta.ReadOnly)
+	return err
+}
+
+// ListTokens 返回数据库中所有代币元数据
+func (ps *PoolStore) ListTokens(ctx context.Context) ([]tokenMetadata, error) {
+	const selectStmt = `
+SELECT address, symbol, decimals, tax_bps, tax_known, read_only
+FROM tokens;
+`
+
+	ps.rlock()
+	defer ps.runlock()
+
+	rows, err := ps.db.QueryContext(ctx, selectStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []tokenMetadata
+	for rows.Next() {
+		var (
+			address string
+			meta    tokenMetadata
+		)
+		if err := rows.Scan(&address, &meta.Symbol, &meta.Decimals, &meta.TaxBps, &meta.TaxKnown, &meta.ReadOnly); err != nil {
+			return nil, err
+		}
+		meta.Address = common.HexToAddress(address)
+		tokens = append(tokens, meta)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return pools, nil
+	return tokens, nil
 }
 
 // Close 关闭数据库
@@ -167,3 +905,104 @@ func (ps *PoolStore) Close() error {
 	}
 	return nil
 }
+
+// metaLastProcessedBlock meta 表中记录已处理区块高度的键
+const metaLastProcessedBlock = "last_processed_block"
+
+// LastProcessedBlock 返回已处理的最大区块高度，尚未记录时第二个返回值为 false
+func (ps *PoolStore) LastProcessedBlock(ctx context.Context) (uint64, bool, error) {
+	const selectStmt = `SELECT value FROM meta WHERE name = ?`
+
+	ps.rlock()
+	defer ps.runlock()
+
+	var value string
+	err := ps.db.QueryRowContext(ctx, ps.dialect.rebind(selectStmt), metaLastProcessedBlock).Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("解析已处理区块高度失败: %w", err)
+	}
+	return number, true, nil
+}
+
+// SetLastProcessedBlock 记录已处理的区块高度，只会向前推进
+// 区块由多个 goroutine 并发处理、完成顺序不固定，较早完成的高区块不会被随后完成的低区块覆盖
+func (ps *PoolStore) SetLastProcessedBlock(number uint64) error {
+	const upsertStmt = `
+INSERT INTO meta (name, value, updated_at)
+VALUES (?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(name) DO UPDATE SET
+	value = excluded.value,
+	updated_at = CURRENT_TIMESTAMP
+WHERE CAST(meta.value AS {{NUMERIC}}) < CAST(excluded.value AS {{NUMERIC}});
+`
+
+	ps.lock()
+	defer ps.unlock()
+
+	_, err := ps.db.Exec(ps.dialect.rebind(ps.dialect.schema(upsertStmt)), metaLastProcessedBlock, strconv.FormatUint(number, 10))
+	return err
+}
+
+// MarkPathSeen 记录套利路径的静默截止时间，已存在时覆盖
+func (ps *PoolStore) MarkPathSeen(key string, until time.Time) error {
+	const upsertStmt = `
+INSERT INTO seen_paths (path_key, expires_at)
+VALUES (?, ?)
+ON CONFLICT(path_key) DO UPDATE SET
+	expires_at = excluded.expires_at;
+`
+
+	ps.lock()
+	defer ps.unlock()
+
+	_, err := ps.db.Exec(ps.dialect.rebind(upsertStmt), key, dbTime(until))
+	return err
+}
+
+// ListSeenPaths 返回静默截止时间晚于 now 的路径
+func (ps *PoolStore) ListSeenPaths(ctx context.Context, now time.Time) (map[string]time.Time, error) {
+	const selectStmt = `SELECT path_key, expires_at FROM seen_paths WHERE expires_at > ?`
+
+	ps.rlock()
+	defer ps.runlock()
+
+	rows, err := ps.db.QueryContext(ctx, ps.dialect.rebind(selectStmt), dbTime(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := make(map[string]time.Time)
+	for rows.Next() {
+		var (
+			key   string
+			until time.Time
+		)
+		if err := rows.Scan(&key, &until); err != nil {
+			return nil, err
+		}
+		paths[key] = until
+	}
+	return paths, rows.Err()
+}
+
+// DeleteExpiredPaths 删除静默截止时间不晚于 now 的路径，返回删除的数量
+func (ps *PoolStore) DeleteExpiredPaths(now time.Time) (int64, error) {
+	const deleteStmt = `DELETE FROM seen_paths WHERE expires_at <= ?`
+
+	ps.lock()
+	defer ps.unlock()
+
+	result, err := ps.db.Exec(ps.dialect.rebind(deleteStmt), dbTime(now))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	// postgresMaxOpenConns Postgres 连接池最大连接数
+	postgresMaxOpenConns = 16
+	// postgresMaxIdleConns Postgres 连接池最大空闲连接数
+	postgresMaxIdleConns = 4
+)
+
+// NewPostgresPoolStore 创建基于 Postgres 的池子存储
+// 与 SQLite 版本共用查询逻辑，但不使用进程内全局锁，由连接池并发执行读写
+func NewPostgresPoolStore(dsn string) (*PoolStore, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("使用 Postgres 存储时必须配置 DB_DSN")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+	db.SetMaxOpenConns(postgresMaxOpenConns)
+	db.SetMaxIdleConns(postgresMaxIdleConns)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("连接 Postgres 失败: %w", err)
+	}
+
+	store := &PoolStore{db: db, dialect: postgresDialect}
+	if err := store.init(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestPoolStoreFeeRoundTrip 费率写入存储后按原基点读回，不因浮点列精度落到相邻的基点
+func TestPoolStoreFeeRoundTrip(t *testing.T) {
+	store := newTestPoolStore(t)
+	for i, feeBps := range []int{1, 4, 5, 10, 17, 25, 30, 100, 250, 9999} {
+		pool := testPool(testAddr(100+i), testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), feeBps)
+		if err := store.InsertPoolIfNotExists(pool); err != nil {
+			t.Fatal(err)
+		}
+		got, ok, err := store.GetPool(context.Background(), pool.Address)
+		if err != nil || !ok {
+			t.Fatalf("读取池子失败: %v", err)
+		}
+		if got.FeePips != feeBpsToPips(feeBps) {
+			t.Errorf("费率 %d bps 读回为 %d pips", feeBps, got.FeePips)
+		}
+	}
+}
+
+// TestPoolStoreFeePipsRoundTrip V3/Algebra 的 1e-6 单位费率写入存储后原样读回，不取整到基点
+func TestPoolStoreFeePipsRoundTrip(t *testing.T) {
+	store := newTestPoolStore(t)
+	tests := []struct {
+		name    string
+		feePips int
+		wantBps int
+	}{
+		{name: "one pip", feePips: 1, wantBps: 0},
+		{name: "algebra dynamic fee", feePips: 450, wantBps: 5},
+		{name: "odd dynamic fee", feePips: 2999, wantBps: 30},
+		{name: "standard tier", feePips: 3000, wantBps: 30},
+		{name: "largest valid fee", feePips: 999_999, wantBps: 10000},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := testPool(testAddr(100+i), testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), feePipsToBps(tt.feePips))
+			pool.FeePips = tt.feePips
+			if err := store.InsertPoolIfNotExists(pool); err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := store.GetPool(context.Background(), pool.Address)
+			if err != nil || !ok {
+				t.Fatalf("读取池子失败: %v", err)
+			}
+			if got.FeePips != tt.feePips || feePipsToBps(got.FeePips) != tt.wantBps {
+				t.Fatalf("读回 %d pips / %d bps，期望 %d pips / %d bps", got.FeePips, feePipsToBps(got.FeePips), tt.feePips, tt.wantBps)
+			}
+		})
+	}
+}
+
+// TestPoolStoreDirectionalFee 按方向收费的 Algebra v1.9 池子两个方向的费率写入存储后原样读回，报价按卖出的代币选用
+func TestPoolStoreDirectionalFee(t *testing.T) {
+	store := newTestPoolStore(t)
+	token0, token1 := testAddr(1), testAddr(2)
+	tests := []struct {
+		name        string
+		feePips     int
+		reversePips int
+		wantFrom0   int
+		wantFrom1   int
+	}{
+		{name: "symmetric", feePips: 3000, wantFrom0: 3000, wantFrom1: 3000},
+		{name: "directional", feePips: 1234, reversePips: 567, wantFrom0: 1234, wantFrom1: 567},
+		{name: "zero for one free", feePips: 0, reversePips: 100, wantFrom0: 0, wantFrom1: 100},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := testPool(testAddr(100+i), token0, token1, big.NewInt(1), big.NewInt(1), feePipsToBps(tt.feePips))
+			pool.FeePips = tt.feePips
+			pool.FeePipsOneForZero = tt.reversePips
+			if err := store.InsertPoolIfNotExists(pool); err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := store.GetPool(context.Background(), pool.Address)
+			if err != nil || !ok {
+				t.Fatalf("读取池子失败: %v", err)
+			}
+			if got.FeePipsOneForZero != tt.reversePips {
+				t.Fatalf("反方向费率读回 %d，期望 %d", got.FeePipsOneForZero, tt.reversePips)
+			}
+			if from0, from1 := got.FeePipsFrom(token0), got.FeePipsFrom(token1); from0 != tt.wantFrom0 || from1 != tt.wantFrom1 {
+				t.Fatalf("卖出 token0/token1 的费率 %d/%d，期望 %d/%d", from0, from1, tt.wantFrom0, tt.wantFrom1)
+			}
+		})
+	}
+}
+
+// TestPoolStoreDropsLegacyWeightColumns 早期版本的 weight0/weight1 列在启动时删除，仍只存在于旧列中的权重迁移到 weights
+func TestPoolStoreDropsLegacyWeightColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const legacySchema = `
+CREATE TABLE pools (
+	id TEXT PRIMARY KEY,
+	protocol TEXT NOT NULL,
+	token0 TEXT NOT NULL,
+	token1 TEXT NOT NULL,
+	fee REAL NOT NULL,
+	fee_source TEXT NOT NULL DEFAULT '',
+	weight0 REAL NOT NULL DEFAULT 0,
+	weight1 REAL NOT NULL DEFAULT 0,
+	reserve0 TEXT NOT NULL DEFAULT '0',
+	reserve1 TEXT NOT NULL DEFAULT '0',
+	last_reserve_update DATETIME,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+	weighted, plain := testAddr(100), testAddr(101)
+	token0, token1 := testAddr(1), testAddr(2)
+	for _, stmt := range []string{
+		legacySchema,
+		fmt.Sprintf(`INSERT INTO pools (id, protocol, token0, token1, fee, weight0, weight1, reserve0, reserve1) VALUES ('%s', '%s', '%s', '%s', 0.3, 0.8, 0.2, '10', '20')`,
+			weighted.Hex(), ProtocolBalancerWeighted, token0.Hex(), token1.Hex()),
+		fmt.Sprintf(`INSERT INTO pools (id, protocol, token0, token1, fee, reserve0, reserve1) VALUES ('%s', '%s', '%s', '%s', 0.3, '10', '20')`,
+			plain.Hex(), ProtocolUniswapV2Like, token0.Hex(), token1.Hex()),
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	store, err := NewPoolStore(path, SQLiteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, column := range []string{"weight0", "weight1"} {
+		exists, err := store.hasColumn("pools", column)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Fatalf("旧列 %s 未删除", column)
+		}
+	}
+	tests := []struct {
+		pool common.Address
+		want []float64
+	}{
+		{weighted, []float64{0.8, 0.2}},
+		{plain, nil},
+	}
+	for _, tt := range tests {
+		pool, ok, err := store.GetPool(context.Background(), tt.pool)
+		if err != nil || !ok {
+			t.Fatalf("读取池子 %s 失败: %v", tt.pool.Hex(), err)
+		}
+		if !slices.Equal(pool.Weights, tt.want) {
+			t.Errorf("池子 %s 权重 %v，期望 %v", tt.pool.Hex(), pool.Weights, tt.want)
+		}
+	}
+
+	// 再次打开时旧列已不存在，迁移不再执行
+	store.Close()
+	reopened, err := NewPoolStore(path, SQLiteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+}
+
+// insertingWriter 第一次写出时同步写入一个新池子：导出若在写出期间仍持有读锁，写入会一直等待
+type insertingWriter struct {
+	strings.Builder
+	store    *PoolStore
+	pool     poolDetail
+	inserted bool
+}
+
+func (w *insertingWriter) Write(p []byte) (int, error) {
+	if !w.inserted {
+		w.inserted = true
+		done := make(chan error, 1)
+		go func() { done <- w.store.InsertPoolIfNotExists(w.pool) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				return 0, err
+			}
+		case <-time.After(5 * time.Second):
+			return 0, fmt.Errorf("导出写出期间写入被阻塞")
+		}
+	}
+	return w.Builder.Write(p)
+}
+
+// TestExportPoolsPaged 分页导出覆盖全部池子且不重复，写出期间不持有读锁
+func TestExportPoolsPaged(t *testing.T) {
+	tests := []struct {
+		name     string
+		pools    int
+		pageSize int
+	}{
+		{name: "empty", pools: 0, pageSize: 2},
+		{name: "partial page", pools: 3, pageSize: 5},
+		{name: "exact pages", pools: 4, pageSize: 2},
+		{name: "several pages", pools: 7, pageSize: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestPoolStore(t)
+			for i := 0; i < tt.pools; i++ {
+				if err := store.InsertPoolIfNotExists(testPool(testAddr(100+i), testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 写出期间插入的池子地址大于已有池子，可能出现在后续页中
+			late := testPool(testAddr(900), testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)
+			w := &insertingWriter{store: store, pool: late}
+			if err := store.exportPools(context.Background(), w, ExportFormatNDJSON, tt.pageSize); err != nil {
+				t.Fatal(err)
+			}
+
+			seen := make(map[string]bool)
+			for _, line := range strings.Split(strings.TrimSpace(w.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				var view poolView
+				if err := json.Unmarshal([]byte(line), &view); err != nil {
+					t.Fatal(err)
+				}
+				if seen[view.Address] {
+					t.Fatalf("池子 %s 重复导出", view.Address)
+				}
+				seen[view.Address] = true
+			}
+			for i := 0; i < tt.pools; i++ {
+				if !seen[testAddr(100+i).Hex()] {
+					t.Fatalf("池子 %s 未导出", testAddr(100+i).Hex())
+				}
+			}
+		})
+	}
+}
+
+// TestNormalizeAddressKeys 小写地址的池子与代币统一为校验和格式；校验和格式的记录已存在时合并拉黑标记并删除小写重复记录
+func TestNormalizeAddressKeys(t *testing.T) {
+	pool, other := testAddr(100), testAddr(101)
+	lower := strings.ToLower(pool.Hex())
+	tests := []struct {
+		name string
+		// canonical 同时存在校验和格式的池子与代币
+		canonical bool
+		// blacklistLower 小写重复记录被拉黑
+		blacklistLower  bool
+		wantBlacklisted bool
+		wantSymbol      string
+	}{
+		{name: "lowercase only is renamed", wantSymbol: "LOW"},
+		{name: "duplicate lowercase is removed", canonical: true, wantSymbol: "CANON"},
+		{name: "duplicate keeps lowercase blacklist", canonical: true, blacklistLower: true, wantBlacklisted: true, wantSymbol: "CANON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestPoolStore(t)
+			ctx := context.Background()
+			// 旧版本写入的小写记录：先按其他地址写入再把主键改成小写
+			if err := store.InsertPoolIfNotExists(testPool(other, testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.UpsertToken(tokenMetadata{Address: other, Symbol: "LOW", Decimals: 18}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.db.Exec(`UPDATE pools SET id = ?, blacklisted = ? WHERE id = ?`, lower, tt.blacklistLower, other.Hex()); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.db.Exec(`UPDATE tokens SET address = ? WHERE address = ?`, lower, other.Hex()); err != nil {
+				t.Fatal(err)
+			}
+			if tt.canonical {
+				if err := store.InsertPoolIfNotExists(testPool(pool, testAddr(1), testAddr(2), big.NewInt(5), big.NewInt(5), 30)); err != nil {
+					t.Fatal(err)
+				}
+				if err := store.UpsertToken(tokenMetadata{Address: pool, Symbol: "CANON", Decimals: 18}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := store.normalizeAddressKeys(); err != nil {
+				t.Fatal(err)
+			}
+
+			var rows int
+			if err := store.db.QueryRow(`SELECT COUNT(*) FROM pools WHERE lower(id) = ?`, lower).Scan(&rows); err != nil {
+				t.Fatal(err)
+			}
+			if rows != 1 {
+				t.Fatalf("同一地址剩余 %d 条池子记录，期望 1 条", rows)
+			}
+			got, ok, err := store.GetPool(ctx, pool)
+			if err != nil || !ok {
+				t.Fatalf("按校验和地址读取池子失败: %v %v", ok, err)
+			}
+			if got.Blacklisted != tt.wantBlacklisted {
+				t.Fatalf("拉黑标记 %v，期望 %v", got.Blacklisted, tt.wantBlacklisted)
+			}
+			tokens, err := store.ListTokens(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tokens) != 1 || tokens[0].Address != pool || tokens[0].Symbol != tt.wantSymbol {
+				t.Fatalf("代币 %+v，期望只剩 %s (%s)", tokens, pool.Hex(), tt.wantSymbol)
+			}
+		})
+	}
+}
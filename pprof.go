@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerPprofRoutes 在 group 下挂载 net/http/pprof 的性能分析接口：
+// /debug/pprof/ 为索引，/debug/pprof/profile 采集 CPU，/debug/pprof/heap、goroutine 等命名 profile 由索引处理器按路径分发
+// 只注册 /debug/pprof 前缀下的路由，不影响其他接口；未开启 ENABLE_PPROF 时不调用，这些路径返回 404
+func registerPprofRoutes(group *gin.RouterGroup) {
+	debug := group.Group("/debug/pprof")
+	debug.GET("/*name", func(c *gin.Context) {
+		switch c.Param("name") {
+		case "/cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "/profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "/symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "/trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			pprof.Index(c.Writer, c.Request)
+		}
+	})
+	debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPprofRoutes 开启 ENABLE_PPROF 时 /debug/pprof/ 索引可访问且与其他接口一样需要 API 密钥，未开启时返回 404
+func TestPprofRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		enable     bool
+		apiKey     string
+		header     string
+		wantStatus int
+	}{
+		{name: "disabled", wantStatus: http.StatusNotFound},
+		{name: "disabled with key", apiKey: "secret", header: "secret", wantStatus: http.StatusNotFound},
+		{name: "enabled without api key configured", enable: true, wantStatus: http.StatusOK},
+		{name: "enabled missing key", enable: true, apiKey: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "enabled wrong key", enable: true, apiKey: "secret", header: "wrong", wantStatus: http.StatusUnauthorized},
+		{name: "enabled valid key", enable: true, apiKey: "secret", header: "secret", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newTestRouter(t, &AppConfig{EnablePprof: tt.enable, APIKey: tt.apiKey})
+			req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("/debug/pprof/ 返回 %d，期望 %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(w.Body.String(), "goroutine") {
+				t.Fatalf("/debug/pprof/ 未返回 profile 索引: %s", w.Body.String())
+			}
+		})
+	}
+}
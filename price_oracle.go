@@ -0,0 +1,188 @@
+package main
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// stablecoinUnit 稳定币最小单位与 1 USD 的换算（BSC 上 USDT/BUSD/USDC 均为 18 位精度）
+const stablecoinUnit = 1e18
+
+// PriceOracle 基于已存储的池子储备量推导代币的 USD 价格
+// 价格单位为「每个最小单位代币价值多少 USD」，与 simulatePath 中使用的原始数量保持一致，
+// 因此无需知道代币精度即可完成换算
+type PriceOracle struct {
+	mu      sync.RWMutex
+	prices  map[common.Address]float64
+	stables map[common.Address]struct{}
+	wbnb    common.Address
+}
+
+// NewPriceOracle 创建价格预言机，默认以 USDT/BUSD/USDC 作为稳定币锚点，wrapped（WBNB）作为二级锚点
+func NewPriceOracle(wrapped common.Address) *PriceOracle {
+	stables := map[common.Address]struct{}{
+		common.HexToAddress(USDTAddressHex): {},
+		common.HexToAddress(BUSDAddressHex): {},
+		common.HexToAddress(USDCAddressHex): {},
+	}
+	return &PriceOracle{
+		prices:  make(map[common.Address]float64),
+		stables: stables,
+		wbnb:    wrapped,
+	}
+}
+
+// Update 根据最新的池子列表重新计算价格缓存
+// 计算顺序：稳定币按 1 USD 锚定 -> WBNB 取与稳定币之间最深的池子 -> 其余代币取与稳定币或 WBNB 之间最深的池子
+// 先按代币建立池子下标索引，每个代币只遍历包含它的池子，整体复杂度与池子数量线性相关
+func (po *PriceOracle) Update(pools []poolDetail) {
+	byToken := indexPoolsByToken(pools)
+	prices := make(map[common.Address]float64, len(po.stables)+1)
+	for stable := range po.stables {
+		prices[stable] = 1 / stablecoinUnit
+	}
+
+	// WBNB 只从稳定币池子推导，避免被小币池子带偏
+	if price, ok := deepestPrice(pools, byToken[po.wbnb], po.wbnb, prices); ok {
+		prices[po.wbnb] = price
+		// 原生 BNB 与 WBNB 按 1:1 兑换，价格相同
+		prices[nativeToken] = price
+	}
+
+	anchors := make(map[common.Address]float64, len(prices))
+	for token, price := range prices {
+		anchors[token] = price
+	}
+
+	for token, candidates := range byToken {
+		if _, ok := anchors[token]; ok {
+			continue
+		}
+		if price, ok := deepestPrice(pools, candidates, token, anchors); ok {
+			prices[token] = price
+		}
+	}
+
+	po.mu.Lock()
+	po.prices = prices
+	po.mu.Unlock()
+}
+
+// indexPoolsByToken 返回代币到包含该代币的池子下标列表的映射
+func indexPoolsByToken(pools []poolDetail) map[common.Address][]int {
+	byToken := make(map[common.Address][]int)
+	for i, p := range pools {
+		for _, token := range p.Tokens {
+			byToken[token] = append(byToken[token], i)
+		}
+	}
+	return byToken
+}
+
+// deepestPrice 在 candidates 指向的池子中，从 token 与锚定代币同池的池子里选出锚定侧 USD 深度最大的一个，并据此计算 token 价格
+func deepestPrice(pools []poolDetail, candidates []int, token common.Address, anchors map[common.Address]float64) (float64, bool) {
+	bestDepth := 0.0
+	bestPrice := 0.0
+	for _, idx := range candidates {
+		p := pools[idx]
+		tokenIdx := p.TokenIndex(token)
+		if tokenIdx < 0 {
+			continue
+		}
+		tokenReserve := p.reserveAt(tokenIdx)
+		if tokenReserve == nil || tokenReserve.Sign() <= 0 {
+			continue
+		}
+
+		// 多币池中 token 可能与多个锚定代币同池，逐个比较
+		for anchorIdx, anchor := range p.Tokens {
+			anchorPrice, ok := anchors[anchor]
+			anchorReserve := p.reserveAt(anchorIdx)
+			if anchorIdx == tokenIdx || !ok || anchorReserve == nil || anchorReserve.Sign() <= 0 {
+				continue
+			}
+
+			tokenAmount, _ := new(big.Float).SetInt(tokenReserve).Float64()
+			anchorAmount, _ := new(big.Float).SetInt(anchorReserve).Float64()
+			depth := anchorAmount * anchorPrice
+			if depth > bestDepth {
+				bestDepth = depth
+				bestPrice = depth / tokenAmount
+				if p.weighted() {
+					// 加权池现货价格需要按权重修正，80/20 池子的储备量之比并不等于价格
+					bestPrice = weightedSpotPrice(tokenAmount, p.Weights[tokenIdx], anchorAmount, p.Weights[anchorIdx]) * anchorPrice
+				}
+			}
+		}
+	}
+	return bestPrice, bestDepth > 0
+}
+
+// LiquidityUSD 估算池子的总流动性（USD），池子中没有任何代币价格已知时返回 false
+// 只有部分代币有价格时按已知部分外推：加权池按已知代币的权重占比，其余池子按各代币价值相等
+func (po *PriceOracle) LiquidityUSD(pool poolDetail) (float64, bool) {
+	pricedValue := 0.0
+	pricedWeight := 0.0
+	pricedCount := 0
+	for i, token := range pool.Tokens {
+		price, ok := po.PriceOf(token)
+		reserve := pool.reserveAt(i)
+		if !ok || reserve == nil {
+			continue
+		}
+		amount, _ := new(big.Float).SetInt(reserve).Float64()
+		pricedValue += amount * price
+		pricedCount++
+		if pool.weighted() {
+			pricedWeight += pool.Weights[i]
+		}
+	}
+	if pricedCount == 0 {
+		return 0, false
+	}
+
+	if pool.weighted() && pricedWeight > 0 {
+		return pricedValue / pricedWeight, true
+	}
+	return pricedValue * float64(len(pool.Tokens)) / float64(pricedCount), true
+}
+
+// VolumeUSD 估算池子在 now 时刻的滚动成交量（USD），价格未知的代币不计入，没有成交量记录时返回 0
+// 每笔兑换只累计卖入池子的一侧，因此各代币成交量之和即为总成交额
+func (po *PriceOracle) VolumeUSD(pool poolDetail, now time.Time) float64 {
+	total := 0.0
+	for i, volume := range pool.VolumeAt(now) {
+		amount, _ := new(big.Float).SetInt(volume).Float64()
+		total += po.ToUSD(pool.Tokens[i], amount)
+	}
+	return total
+}
+
+// PriceOf 返回代币每个最小单位的 USD 价格，未知时返回 false
+func (po *PriceOracle) PriceOf(token common.Address) (float64, bool) {
+	po.mu.RLock()
+	defer po.mu.RUnlock()
+	price, ok := po.prices[token]
+	return price, ok
+}
+
+// ToUSD 将以最小单位计的代币数量换算为 USD，价格未知时返回 0
+func (po *PriceOracle) ToUSD(token common.Address, amount float64) float64 {
+	price, ok := po.PriceOf(token)
+	if !ok {
+		return 0
+	}
+	return amount * price
+}
+
+// FromUSD 将 USD 金额换算为以最小单位计的代币数量，价格未知时返回 false
+func (po *PriceOracle) FromUSD(token common.Address, usd float64) (float64, bool) {
+	price, ok := po.PriceOf(token)
+	if !ok || price <= 0 {
+		return 0, false
+	}
+	return usd / price, true
+}
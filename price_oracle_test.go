@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestPriceOracleUpdate(t *testing.T) {
+	usdt := common.HexToAddress(USDTAddressHex)
+	wbnb := testAddr(1)
+	cake := testAddr(2)
+	orphan := testAddr(3)
+	other := testAddr(4)
+
+	tests := []struct {
+		name  string
+		pools []poolDetail
+		token common.Address
+		want  float64 // 每个最小单位的 USD 价格，0 表示无价格
+	}{
+		{
+			name:  "stable anchored at 1 USD",
+			pools: nil,
+			token: usdt,
+			want:  1 / stablecoinUnit,
+		},
+		{
+			name:  "wbnb from stable pool",
+			pools: []poolDetail{testPool(testAddr(100), wbnb, usdt, units(10, 18), units(6000, 18), 25)},
+			token: wbnb,
+			want:  600 / stablecoinUnit,
+		},
+		{
+			name: "token priced through wbnb",
+			pools: []poolDetail{
+				testPool(testAddr(100), wbnb, usdt, units(10, 18), units(6000, 18), 25),
+				testPool(testAddr(101), cake, wbnb, units(300, 18), units(1, 18), 25),
+			},
+			token: cake,
+			want:  2 / stablecoinUnit,
+		},
+		{
+			name: "deepest anchor pool wins",
+			pools: []poolDetail{
+				testPool(testAddr(100), cake, usdt, units(1, 18), units(5, 18), 25),
+				testPool(testAddr(101), cake, usdt, units(1000, 18), units(3000, 18), 25),
+			},
+			token: cake,
+			want:  3 / stablecoinUnit,
+		},
+		{
+			name:  "token without anchor pool is unpriced",
+			pools: []poolDetail{testPool(testAddr(100), orphan, other, units(1, 18), units(1, 18), 25)},
+			token: orphan,
+			want:  0,
+		},
+		{
+			name:  "empty reserves are ignored",
+			pools: []poolDetail{testPool(testAddr(100), cake, usdt, big.NewInt(0), units(1, 18), 25)},
+			token: cake,
+			want:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oracle := NewPriceOracle(wbnb)
+			oracle.Update(tt.pools)
+			got, ok := oracle.PriceOf(tt.token)
+			if tt.want == 0 {
+				if ok {
+					t.Fatalf("期望无价格，得到 %g", got)
+				}
+				return
+			}
+			if !ok || math.Abs(got-tt.want)/tt.want > 1e-9 {
+				t.Fatalf("价格 %g (ok=%v)，期望 %g", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestArbitrageCalculatorProfitUSD(t *testing.T) {
+	start := testAddr(1)
+	oracle := NewPriceOracle(testAddr(2))
+	oracle.prices[start] = 2e-18
+
+	tests := []struct {
+		name        string
+		opportunity ArbitrageOpportunity
+		profit      float64
+		want        float64
+		wantOK      bool
+	}{
+		{"discovery price preferred", ArbitrageOpportunity{StartToken: start.Hex(), StartTokenPriceUSD: 1e-18}, 5e18, 5, true},
+		{"oracle price fallback", ArbitrageOpportunity{StartToken: start.Hex()}, 5e18, 10, true},
+		{"unpriced start token", ArbitrageOpportunity{StartToken: testAddr(3).Hex()}, 5e18, 0, false},
+	}
+	ac := &ArbitrageCalculator{oracle: oracle}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ac.profitUSD(tt.opportunity, tt.profit)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("profitUSD = (%g, %v)，期望 (%g, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// BenchmarkPriceOracleUpdate 5000 个池子下的价格更新耗时，按代币索引后每个代币只遍历自己的池子
+func BenchmarkPriceOracleUpdate(b *testing.B) {
+	usdt := common.HexToAddress(USDTAddressHex)
+	wbnb := testAddr(0)
+	pools := []poolDetail{testPool(testAddr(1), wbnb, usdt, units(10, 18), units(6000, 18), 25)}
+	for i := 0; i < 5000; i++ {
+		token := common.BigToAddress(big.NewInt(int64(1_000_000 + i)))
+		pools = append(pools, testPool(common.BigToAddress(big.NewInt(int64(2_000_000+i))), token, wbnb, units(int64(i+1), 18), units(1, 18), 25))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		oracle := NewPriceOracle(wbnb)
+		oracle.Update(pools)
+		if _, ok := oracle.PriceOf(pools[len(pools)-1].Tokens[0]); !ok {
+			b.Fatal("代币未定价")
+		}
+	}
+}
@@ -1,8 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 // protocolConfig 定义协议相关配置
@@ -10,10 +18,180 @@ type protocolConfig struct {
 	Name            string
 	SwapTopic       common.Hash
 	ContractABI     *abi.ABI
-	StaticFee       float64
+	StaticFeeBps    int
 	FeeFromContract bool
-	Token0Method    string
-	Token1Method    string
-	FixedToken0     *common.Address
-	FixedToken1     *common.Address
+	// FeeMethods FeeFromContract 时按顺序尝试的费率方法（FeeMethodFee、FeeMethodGlobalState），为空时使用 defaultFeeMethods
+	FeeMethods   []string
+	Token0Method string
+	Token1Method string
+	FixedToken0  *common.Address
+	FixedToken1  *common.Address
+}
+
+// protocolFileEntry 协议配置文件中的单个协议
+// abi 可以是内联的 ABI 数组，也可以是 ABI JSON 字符串；abi_file 为 ABI 文件路径（相对路径以配置文件所在目录为基准），二者择一
+type protocolFileEntry struct {
+	Name      string          `json:"name"`
+	SwapTopic string          `json:"swap_topic"`
+	ABI       json.RawMessage `json:"abi"`
+	ABIFile   string          `json:"abi_file"`
+	// StaticFee 静态费率百分比（0.3 表示 0.3%），加载时换算为基点
+	StaticFee       float64 `json:"static_fee"`
+	FeeFromContract bool    `json:"fee_from_contract"`
+	// FeeMethods 读取费率的方法链，例如 ["fee", "globalState"]
+	FeeMethods   []string `json:"fee_methods"`
+	Token0Method string   `json:"token0_method"`
+	Token1Method string   `json:"token1_method"`
+	FixedToken0  string   `json:"fixed_token0"`
+	FixedToken1  string   `json:"fixed_token1"`
+}
+
+// FilterProtocols 只保留名称在 enabled 中的协议（ENABLED_PROTOCOLS），enabled 为空时原样返回
+// enabled 中的名称不属于任何协议时返回错误，避免拼写错误导致静默地不再发现任何池子
+func FilterProtocols(protocols map[common.Hash]protocolConfig, enabled []string) (map[common.Hash]protocolConfig, error) {
+	if len(enabled) == 0 {
+		return protocols, nil
+	}
+	known := make(map[string]bool, len(protocols))
+	for _, cfg := range protocols {
+		known[cfg.Name] = true
+	}
+	allowed := make(map[string]bool, len(enabled))
+	for _, name := range enabled {
+		if !known[name] {
+			return nil, fmt.Errorf("ENABLED_PROTOCOLS 中的协议 %s 不存在", name)
+		}
+		allowed[name] = true
+	}
+
+	filtered := make(map[common.Hash]protocolConfig, len(protocols))
+	for topic, cfg := range protocols {
+		if allowed[cfg.Name] {
+			filtered[topic] = cfg
+		}
+	}
+	return filtered, nil
+}
+
+// LoadProtocolsFile 从 JSON 文件加载协议配置，文件内容为 protocolFileEntry 数组
+// 每个协议的 Swap Topic 必须是 32 字节哈希，ABI 必须能正确解析
+func LoadProtocolsFile(path string) ([]protocolConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取协议配置文件失败: %w", err)
+	}
+	var entries []protocolFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("解析协议配置文件失败: %w", err)
+	}
+
+	configs := make([]protocolConfig, 0, len(entries))
+	for idx, entry := range entries {
+		cfg, err := entry.toProtocolConfig(filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("协议配置第 %d 项（%s）非法: %w", idx+1, entry.Name, err)
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+func (entry protocolFileEntry) toProtocolConfig(baseDir string) (protocolConfig, error) {
+	if strings.TrimSpace(entry.Name) == "" {
+		return protocolConfig{}, fmt.Errorf("缺少 name")
+	}
+	topic, err := hexutil.Decode(strings.TrimSpace(entry.SwapTopic))
+	if err != nil || len(topic) != common.HashLength {
+		return protocolConfig{}, fmt.Errorf("swap_topic 必须是 32 字节哈希: %s", entry.SwapTopic)
+	}
+
+	abiJSON, err := entry.abiJSON(baseDir)
+	if err != nil {
+		return protocolConfig{}, err
+	}
+	contractABI, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		return protocolConfig{}, fmt.Errorf("解析 ABI 失败: %w", err)
+	}
+
+	if !validFeeBps(feePercentToBps(entry.StaticFee)) {
+		return protocolConfig{}, fmt.Errorf("static_fee 必须在 [0, 100) 之间: %v", entry.StaticFee)
+	}
+
+	cfg := protocolConfig{
+		Name:            strings.TrimSpace(entry.Name),
+		SwapTopic:       common.BytesToHash(topic),
+		ContractABI:     &contractABI,
+		StaticFeeBps:    feePercentToBps(entry.StaticFee),
+		FeeFromContract: entry.FeeFromContract,
+		Token0Method:    entry.Token0Method,
+		Token1Method:    entry.Token1Method,
+	}
+	for _, method := range entry.FeeMethods {
+		method = strings.TrimSpace(method)
+		if !isFeeMethod(method) {
+			return protocolConfig{}, fmt.Errorf("fee_methods 不支持的方法: %s（可选 %s、%s）", method, FeeMethodFee, FeeMethodGlobalState)
+		}
+		cfg.FeeMethods = append(cfg.FeeMethods, method)
+	}
+	for _, fixed := range []struct {
+		value  string
+		target **common.Address
+		field  string
+	}{
+		{entry.FixedToken0, &cfg.FixedToken0, "fixed_token0"},
+		{entry.FixedToken1, &cfg.FixedToken1, "fixed_token1"},
+	} {
+		if fixed.value == "" {
+			continue
+		}
+		if !common.IsHexAddress(fixed.value) {
+			return protocolConfig{}, fmt.Errorf("%s 不是合法地址: %s", fixed.field, fixed.value)
+		}
+		*fixed.target = addressPtr(common.HexToAddress(fixed.value))
+	}
+	return cfg, nil
+}
+
+// defaultFeeMethods 未配置 fee_methods 时的费率方法链：先调用静态 fee()，回滚时再尝试 Algebra 的 globalState()
+// V3 Swap 事件与 Algebra 的签名相同，两类池子都会按 V3 协议被发现
+var defaultFeeMethods = []string{FeeMethodFee, FeeMethodGlobalState}
+
+// feeMethods 返回协议读取费率的方法链
+func (cfg protocolConfig) feeMethods() []string {
+	if len(cfg.FeeMethods) > 0 {
+		return cfg.FeeMethods
+	}
+	return defaultFeeMethods
+}
+
+func isFeeMethod(method string) bool {
+	return method == FeeMethodFee || method == FeeMethodGlobalState
+}
+
+// abiJSON 返回协议的 ABI JSON 文本，优先使用内联 abi
+func (entry protocolFileEntry) abiJSON(baseDir string) (string, error) {
+	raw := bytes.TrimSpace(entry.ABI)
+	switch {
+	case len(raw) > 0 && raw[0] == '"':
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return "", fmt.Errorf("解析 abi 字符串失败: %w", err)
+		}
+		return text, nil
+	case len(raw) > 0:
+		return string(raw), nil
+	case entry.ABIFile != "":
+		path := entry.ABIFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("读取 ABI 文件失败: %w", err)
+		}
+		return string(data), nil
+	default:
+		return "", fmt.Errorf("缺少 abi 或 abi_file")
+	}
 }
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// quoteHop 按池子协议对应的 AMM 公式计算单跳输出数量（不含转账税）
+// 池子缺少本跳输入、输出代币的储备量，或已加载 tick 数据的 V3 池子输入量超出 tick 范围时返回错误
+func quoteHop(step graphEdge, amount float64) (float64, error) {
+	pool := step.Pool
+	if pool.Protocol == ProtocolWrapNative {
+		// 包装/解包按 1:1 兑换，没有储备量
+		return amount, nil
+	}
+
+	// 检查储备量是否有效（多币池只关心本跳输入、输出两个代币的储备量）
+	reserveInInt, reserveOutInt := pool.ReserveOf(step.FromToken), pool.ReserveOf(step.ToToken)
+	if reserveInInt == nil || reserveInInt.Sign() <= 0 {
+		return 0, fmt.Errorf("池子 %s 缺少 %s 的储备量", pool.Address.Hex(), step.FromToken.Hex())
+	}
+	if reserveOutInt == nil || reserveOutInt.Sign() <= 0 {
+		return 0, fmt.Errorf("池子 %s 缺少 %s 的储备量", pool.Address.Hex(), step.ToToken.Hex())
+	}
+
+	// 已加载 tick 数据时逐 tick 精确计算；输入量超出已加载范围时报价不可信，返回错误由调用方丢弃该路径，
+	// 不退回恒定乘积近似：以池子余额作虚拟储备量会严重高估集中流动性池子对大额输入的输出
+	// （黄金分割搜索会反复调用，这里不输出日志）
+	if step.V3 != nil {
+		out, err := step.V3.quote(amount, step.FeePips)
+		if err != nil {
+			return 0, fmt.Errorf("池子 %s: %w", pool.Address.Hex(), err)
+		}
+		return out, nil
+	}
+
+	switch {
+	case pool.Protocol == ProtocolUniswapV2Like || pool.Protocol == ProtocolUniswapV1:
+		// V1 的 getInputPrice 与 V2 的 getAmountOut 是同一个公式，V1 固定收取 0.3% 手续费
+		return constantProductOut(amount, reserveInInt, reserveOutInt, step.FeePips), nil
+	case pool.Protocol == ProtocolUniswapV3 || pool.Protocol == ProtocolUniswapV4:
+		// V3/V4 是集中流动性模型，未加载 tick 数据时以池子余额作为虚拟储备量，用恒定乘积公式近似
+		return constantProductOut(amount, reserveInInt, reserveOutInt, step.FeePips), nil
+	case pool.Protocol == ProtocolBalancerWeighted && pool.weighted():
+		// 加权池使用 Balancer 的 calcOutGivenIn，权重不是 50/50 时与恒定乘积公式差异很大
+		balanceIn, _ := new(big.Float).SetInt(reserveInInt).Float64()
+		balanceOut, _ := new(big.Float).SetInt(reserveOutInt).Float64()
+		return calcOutGivenIn(balanceIn, pool.WeightOf(step.FromToken), balanceOut, pool.WeightOf(step.ToToken), amount, step.FeePips), nil
+	default:
+		// 未知协议没有报价公式，使用简化的费率扣除
+		return amount * feeRate(step.FeePips), nil
+	}
+}
+
+// quoteHopInt 以最小单位的整数计算单跳输出数量（不含转账税），结果向下取整
+// 恒定乘积池（V1/V2，以及未加载 tick 数据的 V3/V4 近似）直接使用 getAmountOut，与合约的整数运算逐位一致；
+// 已加载 tick 数据的 V3 与 Balancer 加权池的公式本身依赖浮点（开方、幂运算），单跳内按 float64 计算后向下取整，
+// 误差不超过该跳输出的 float64 相对精度（约 1e-16），不会跨跳累积放大
+func quoteHopInt(step graphEdge, amount *big.Int) (*big.Int, error) {
+	pool := step.Pool
+	if pool.Protocol == ProtocolWrapNative {
+		return new(big.Int).Set(amount), nil
+	}
+
+	reserveIn, reserveOut := pool.ReserveOf(step.FromToken), pool.ReserveOf(step.ToToken)
+	if reserveIn == nil || reserveIn.Sign() <= 0 {
+		return nil, fmt.Errorf("池子 %s 缺少 %s 的储备量", pool.Address.Hex(), step.FromToken.Hex())
+	}
+	if reserveOut == nil || reserveOut.Sign() <= 0 {
+		return nil, fmt.Errorf("池子 %s 缺少 %s 的储备量", pool.Address.Hex(), step.ToToken.Hex())
+	}
+
+	if step.V3 != nil || (pool.Protocol == ProtocolBalancerWeighted && pool.weighted()) {
+		amountF, _ := new(big.Float).SetInt(amount).Float64()
+		out, err := quoteHop(step, amountF)
+		if err != nil {
+			return nil, err
+		}
+		return floatToAmount(out), nil
+	}
+
+	switch pool.Protocol {
+	case ProtocolUniswapV2Like, ProtocolUniswapV1, ProtocolUniswapV3, ProtocolUniswapV4:
+		return getAmountOut(amount, reserveIn, reserveOut, step.FeePips), nil
+	default:
+		out := new(big.Int).Mul(amount, big.NewInt(int64(pipsDenominator-step.FeePips)))
+		return out.Quo(out, big.NewInt(pipsDenominator)), nil
+	}
+}
+
+// floatToAmount 将以最小单位计的 float64 数量向下取整为整数，非正数与 NaN 返回 0
+func floatToAmount(amount float64) *big.Int {
+	if !(amount > 0) || math.IsInf(amount, 0) {
+		return new(big.Int)
+	}
+	value, _ := new(big.Float).SetFloat64(amount).Int(nil)
+	return value
+}
+
+// constantProductOut 以最小单位计的 float64 数量调用 getAmountOut，输入向下取整为整数后按合约整数运算计算
+// 只供仍以 float64 计算的调用方（可疑路径检查）使用；已持有整数数量的调用方（路径模拟、精算、报价接口）直接使用 quoteHopInt
+// feePips 单位 1e-6，例如 3000 表示 0.3%
+func constantProductOut(amount float64, reserveIn, reserveOut *big.Int, feePips int) float64 {
+	amountIn, _ := new(big.Float).SetFloat64(amount).Int(nil)
+	amountOut, _ := new(big.Float).SetInt(getAmountOut(amountIn, reserveIn, reserveOut, feePips)).Float64()
+	return amountOut
+}
+
+// spotPrice 本跳的池子现货价格（每单位输入代币可换得的输出代币，不含手续费与滑点）
+func spotPrice(step graphEdge) float64 {
+	if step.V3 != nil {
+		return step.V3.spotPrice()
+	}
+	if step.Pool.Protocol == ProtocolWrapNative {
+		return 1
+	}
+	reserveIn, reserveOut := step.Pool.ReserveOf(step.FromToken), step.Pool.ReserveOf(step.ToToken)
+	if reserveIn == nil || reserveOut == nil || reserveIn.Sign() <= 0 {
+		return 0
+	}
+	balanceIn, _ := new(big.Float).SetInt(reserveIn).Float64()
+	balanceOut, _ := new(big.Float).SetInt(reserveOut).Float64()
+	if step.Pool.weighted() {
+		return weightedSpotPrice(balanceIn, step.Pool.WeightOf(step.FromToken), balanceOut, step.Pool.WeightOf(step.ToToken))
+	}
+	return balanceOut / balanceIn
+}
+
+// applyTransferTax 扣除转账税，taxBps 为基点
+func applyTransferTax(amount float64, taxBps int) float64 {
+	if taxBps <= 0 {
+		return amount
+	}
+	return amount * float64(10000-taxBps) / 10000
+}
+
+// applyTransferTaxInt 以整数扣除转账税，与代币合约按基点计税一样向下取整
+func applyTransferTaxInt(amount *big.Int, taxBps int) *big.Int {
+	if taxBps <= 0 {
+		return amount
+	}
+	taxed := new(big.Int).Mul(amount, big.NewInt(int64(bpsDenominator-taxBps)))
+	return taxed.Quo(taxed, big.NewInt(bpsDenominator))
+}
+
+// poolQuote 单个池子的报价结果
+type poolQuote struct {
+	TokenOut common.Address
+	// AmountOut 扣除转账税后的输出数量（最小单位）
+	AmountOut *big.Int
+	// PriceImpact 1 - 成交价 / 现货价，包含手续费
+	PriceImpact float64
+}
+
+// quotePool 计算在池子中用 amountIn 个 tokenIn 可换得的 tokenOut 数量，与套利路径模拟使用同一套整数公式（quoteHopInt）并扣除转账税
+// tokenOut 为零地址时取两币池中的另一个代币，多币池必须指定
+func quotePool(pool poolDetail, tokens *TokenRegistry, tokenIn, tokenOut common.Address, amountIn *big.Int) (poolQuote, error) {
+	if pool.TokenIndex(tokenIn) < 0 {
+		return poolQuote{}, fmt.Errorf("池子 %s 不包含代币 %s", pool.Address.Hex(), tokenIn.Hex())
+	}
+	if tokenOut == (common.Address{}) {
+		if len(pool.Tokens) != 2 {
+			return poolQuote{}, fmt.Errorf("池子 %s 包含 %d 个代币，需要指定输出代币", pool.Address.Hex(), len(pool.Tokens))
+		}
+		tokenOut = pool.Token0()
+		if tokenOut == tokenIn {
+			tokenOut = pool.Token1()
+		}
+	}
+	if tokenOut == tokenIn || pool.TokenIndex(tokenOut) < 0 {
+		return poolQuote{}, fmt.Errorf("池子 %s 不包含输出代币 %s", pool.Address.Hex(), tokenOut.Hex())
+	}
+
+	step := graphEdge{Pool: pool, Protocol: pool.Protocol, FeePips: pool.FeePipsFrom(tokenIn), FromToken: tokenIn, ToToken: tokenOut}
+	amount := applyTransferTaxInt(amountIn, tokens.TaxBps(tokenIn))
+	out, err := quoteHopInt(step, amount)
+	if err != nil {
+		return poolQuote{}, err
+	}
+
+	quote := poolQuote{TokenOut: tokenOut, AmountOut: applyTransferTaxInt(out, tokens.TaxBps(tokenOut))}
+	if spot := spotPrice(step); spot > 0 && amount.Sign() > 0 {
+		// 价格冲击只用于展示，成交价按整数比值换算为 float64
+		price, _ := new(big.Rat).SetFrac(out, amount).Float64()
+		quote.PriceImpact = 1 - price/spot
+	}
+	return quote, nil
+}
+
+// FetchPoolReserves 通过 RPC 读取池子的实时储备量，与池子发现时的读取方式一致：
+// V2 调用 getReserves，V3/V4 与配置文件中的协议查询池子持有的代币余额，V1 为代币余额与原生 BNB 余额
+// Balancer 池子需要 poolId 才能查询 Vault，暂不支持
+func FetchPoolReserves(ctx context.Context, client *ethclient.Client, pool poolDetail, timeout time.Duration) ([]*big.Int, error) {
+	switch pool.Protocol {
+	case ProtocolUniswapV2Like:
+		contract := bind.NewBoundContract(pool.Address, v2PairABI, client, client, client)
+		reserve0, reserve1, err := CallGetReserves(ctx, contract, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return []*big.Int{reserve0, reserve1}, nil
+	case ProtocolBalancerWeighted, ProtocolWrapNative:
+		return nil, fmt.Errorf("协议 %s 不支持实时读取储备量", pool.Protocol)
+	case ProtocolUniswapV1:
+		tokenReserve, err := CallERC20BalanceOf(ctx, client, pool.Token0(), pool.Address, timeout)
+		if err != nil {
+			return nil, err
+		}
+		callCtx, cancel := withRPCTimeout(ctx, timeout)
+		defer cancel()
+		nativeReserve, err := client.BalanceAt(callCtx, pool.Address, nil)
+		if err != nil {
+			return nil, fmt.Errorf("查询原生余额失败: %w", err)
+		}
+		return []*big.Int{tokenReserve, nativeReserve}, nil
+	default:
+		// V3/V4 与配置文件中的协议以池子持有的代币余额作为储备量
+		queries := make([]BalanceQuery, len(pool.Tokens))
+		for i, token := range pool.Tokens {
+			queries[i] = BalanceQuery{Token: token, Owner: pool.Address}
+		}
+		balances, errs, err := BatchBalanceOf(ctx, client, queries, timeout)
+		if err != nil {
+			return nil, err
+		}
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+		}
+		return balances, nil
+	}
+}
+
+// BatchPoolReserves 通过一次 JSON-RPC 批量请求读取多个池子的实时储备量，读取方式与 FetchPoolReserves 一致：
+// V2 池子批量 getReserves，V3/V4 与配置文件中的协议批量查询池子持有的代币余额；
+// V1 池子需要额外查询原生余额，不在批量请求中，退回 FetchPoolReserves 逐个读取
+// 返回与 pools 一一对应的储备量和错误列表，单个池子失败只体现在对应的错误中；整批请求失败时返回 error
+func BatchPoolReserves(ctx context.Context, client *ethclient.Client, pools []poolDetail, timeout time.Duration) ([][]*big.Int, []error, error) {
+	reserves := make([][]*big.Int, len(pools))
+	errs := make([]error, len(pools))
+	reservesCall, err := v2PairABI.Pack("getReserves")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var calls []batchCall
+	// first[i] 为池子 i 的第一个调用在 calls 中的下标，-1 表示不在批量请求中
+	first := make([]int, len(pools))
+	for i, pool := range pools {
+		first[i] = -1
+		switch pool.Protocol {
+		case ProtocolUniswapV2Like:
+			first[i] = len(calls)
+			calls = append(calls, batchCall{To: pool.Address, Data: reservesCall})
+		case ProtocolUniswapV1:
+			reserves[i], errs[i] = FetchPoolReserves(ctx, client, pool, timeout)
+		case ProtocolBalancerWeighted, ProtocolWrapNative:
+			errs[i] = fmt.Errorf("协议 %s 不支持实时读取储备量", pool.Protocol)
+		default:
+			balanceCall, err := erc20ABI.Pack("balanceOf", pool.Address)
+			if err != nil {
+				return nil, nil, err
+			}
+			first[i] = len(calls)
+			for _, token := range pool.Tokens {
+				calls = append(calls, batchCall{To: token, Data: balanceCall})
+			}
+		}
+	}
+	if len(calls) == 0 {
+		return reserves, errs, nil
+	}
+
+	results, callErrs, err := batchCallAt(ctx, client, calls, nil, timeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("批量读取储备量失败: %w", err)
+	}
+	for i, pool := range pools {
+		at := first[i]
+		if at < 0 {
+			continue
+		}
+		if pool.Protocol == ProtocolUniswapV2Like {
+			reserve0, reserve1, err := unpackReserves(results[at], callErrs[at])
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			reserves[i] = []*big.Int{reserve0, reserve1}
+			continue
+		}
+		balances := make([]*big.Int, len(pool.Tokens))
+		for j := range pool.Tokens {
+			if balances[j], err = unpackBalance(results[at+j], callErrs[at+j]); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		reserves[i] = balances
+	}
+	return reserves, errs, nil
+}
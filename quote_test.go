@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestFetchPoolReservesByProtocol 配置文件中的协议与 V3 一样以池子持有的代币余额作为储备量，Balancer 与包装虚拟池子不支持
+func TestFetchPoolReservesByProtocol(t *testing.T) {
+	pool := testAddr(100)
+	token := &mockTaxToken{pool: pool, balances: map[common.Address]*big.Int{pool: units(42, 18)}}
+	client := newMockTokenRegistry(t, token).client
+
+	tests := []struct {
+		name     string
+		protocol string
+		wantErr  bool
+	}{
+		{name: "config file protocol", protocol: "CustomAMM"},
+		{name: "uniswap v3", protocol: ProtocolUniswapV3},
+		{name: "balancer", protocol: ProtocolBalancerWeighted, wantErr: true},
+		{name: "wrap native", protocol: ProtocolWrapNative, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detail := testPool(pool, testAddr(1), testAddr(2), nil, nil, 30)
+			detail.Protocol = tt.protocol
+			if supportsLiveReserves(tt.protocol) == tt.wantErr {
+				t.Fatalf("supportsLiveReserves(%s) 与 FetchPoolReserves 不一致", tt.protocol)
+			}
+			reserves, err := FetchPoolReserves(context.Background(), client, detail, time.Second)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("期望返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, reserve := range reserves {
+				if reserve.Cmp(units(42, 18)) != 0 {
+					t.Fatalf("储备量 %d = %s，期望池子余额 %s", i, reserve, units(42, 18))
+				}
+			}
+		})
+	}
+}
+
+// TestQuoteHopV3TickRange 已加载 tick 数据的 V3 池子在范围内精确报价，超出范围时返回错误而不是退回恒定乘积近似
+func TestQuoteHopV3TickRange(t *testing.T) {
+	tokenA, tokenB := testAddr(1), testAddr(2)
+	pool := testPool(testAddr(100), tokenA, tokenB, units(1000, 18), units(1000, 18), 30)
+	pool.Protocol = ProtocolUniswapV3
+	// 价格 1（tick 0），只加载到 tick -60：流动性 1e21 下约 3e18 的 token0 输入即可把价格推过边界
+	state := &v3PoolState{
+		SqrtPriceX96: new(big.Int).Lsh(big.NewInt(1), 96),
+		Liquidity:    mustBig(t, "1000000000000000000000"),
+		TickSpacing:  60,
+		ZeroForOne:   true,
+		Boundary:     -60,
+	}
+	step := graphEdge{Pool: pool, Protocol: pool.Protocol, FeePips: 3000, FromToken: tokenA, ToToken: tokenB, V3: state}
+
+	tests := []struct {
+		name    string
+		amount  float64
+		wantErr bool
+	}{
+		{name: "within loaded ticks", amount: 1e18},
+		{name: "beyond loaded ticks", amount: 1e20, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := quoteHop(step, tt.amount)
+			if tt.wantErr {
+				if !errors.Is(err, errV3TicksExhausted) {
+					t.Fatalf("输出 %g, 错误 %v，期望 errV3TicksExhausted", out, err)
+				}
+				if _, err := quoteHopInt(step, floatToAmount(tt.amount)); !errors.Is(err, errV3TicksExhausted) {
+					t.Fatalf("整数报价错误 %v，期望 errV3TicksExhausted", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			exact, _ := state.quote(tt.amount, 3000)
+			if out != exact || out <= 0 || out >= tt.amount {
+				t.Fatalf("输出 %g，期望精确报价 %g", out, exact)
+			}
+		})
+	}
+}
+
+// TestQuotePoolExactInteger 报价接口全程按整数计算，大额输入的结果与 getAmountOut 逐位一致，转账税按基点向下取整
+func TestQuotePoolExactInteger(t *testing.T) {
+	token0, token1, pool := testAddr(1), testAddr(2), testAddr(100)
+	// 超过 float64 的 53 位有效精度，经浮点往返会丢失末尾数位
+	big0, _ := new(big.Int).SetString("123456789012345678901234567", 10)
+	tests := []struct {
+		name     string
+		amountIn *big.Int
+		taxBps   int
+		want     *big.Int
+	}{
+		{name: "small amount", amountIn: big.NewInt(2000), want: big.NewInt(1955)},
+		{name: "amount beyond float precision", amountIn: big0, want: getAmountOut(big0, units(1_000_000_000, 18), units(1_000_000_000, 18), 3000)},
+		{name: "output tax", amountIn: big.NewInt(2000), taxBps: 1000, want: big.NewInt(1759)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reserve := big.NewInt(100000)
+			if tt.amountIn.Cmp(reserve) > 0 {
+				reserve = units(1_000_000_000, 18)
+			}
+			tokens := NewTokenRegistry(nil, nil, &AppConfig{})
+			tokens.cache.Store(token1, tokenMetadata{Address: token1, TaxBps: tt.taxBps})
+			quote, err := quotePool(testPool(pool, token0, token1, reserve, reserve, 30), tokens, token0, common.Address{}, tt.amountIn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quote.TokenOut != token1 || quote.AmountOut.Cmp(tt.want) != 0 {
+				t.Fatalf("输出 %s %s，期望 %s %s", quote.TokenOut.Hex(), quote.AmountOut, token1.Hex(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// receiptStatsLogInterval 输出回执获取统计摘要的周期
+const receiptStatsLogInterval = time.Minute
+
+// 回执获取失败的错误分类
+const (
+	receiptErrTimeout     = "timeout"
+	receiptErrNotFound    = "not_found"
+	receiptErrRateLimited = "rate_limited"
+	receiptErrOther       = "other"
+)
+
+// ReceiptStats 回执获取统计快照，用于区分节点丢回执与链上确实没有新池子
+type ReceiptStats struct {
+	Attempts    uint64 `json:"attempts"`
+	Successes   uint64 `json:"successes"`
+	Failures    uint64 `json:"failures"`
+	Timeouts    uint64 `json:"timeouts"`
+	NotFound    uint64 `json:"not_found"`
+	RateLimited uint64 `json:"rate_limited"`
+	Other       uint64 `json:"other"`
+}
+
+// sub 返回两次快照之间的增量
+func (s ReceiptStats) sub(prev ReceiptStats) ReceiptStats {
+	return ReceiptStats{
+		Attempts:    s.Attempts - prev.Attempts,
+		Successes:   s.Successes - prev.Successes,
+		Failures:    s.Failures - prev.Failures,
+		Timeouts:    s.Timeouts - prev.Timeouts,
+		NotFound:    s.NotFound - prev.NotFound,
+		RateLimited: s.RateLimited - prev.RateLimited,
+		Other:       s.Other - prev.Other,
+	}
+}
+
+// receiptStatsTracker 并发安全的回执获取计数器
+type receiptStatsTracker struct {
+	attempts    atomic.Uint64
+	successes   atomic.Uint64
+	timeouts    atomic.Uint64
+	notFound    atomic.Uint64
+	rateLimited atomic.Uint64
+	other       atomic.Uint64
+}
+
+// Record 记录一次回执获取的结果，err 为 nil 表示成功
+func (t *receiptStatsTracker) Record(err error) {
+	t.attempts.Add(1)
+	if err == nil {
+		t.successes.Add(1)
+		return
+	}
+	switch classifyReceiptError(err) {
+	case receiptErrTimeout:
+		t.timeouts.Add(1)
+	case receiptErrNotFound:
+		t.notFound.Add(1)
+	case receiptErrRateLimited:
+		t.rateLimited.Add(1)
+	default:
+		t.other.Add(1)
+	}
+}
+
+// Snapshot 返回当前计数
+func (t *receiptStatsTracker) Snapshot() ReceiptStats {
+	stats := ReceiptStats{
+		Attempts:    t.attempts.Load(),
+		Successes:   t.successes.Load(),
+		Timeouts:    t.timeouts.Load(),
+		NotFound:    t.notFound.Load(),
+		RateLimited: t.rateLimited.Load(),
+		Other:       t.other.Load(),
+	}
+	stats.Failures = stats.Timeouts + stats.NotFound + stats.RateLimited + stats.Other
+	return stats
+}
+
+// classifyReceiptError 将回执获取错误归类为超时、未找到、限流或其他
+// 限流既可能是 HTTP 429，也可能是节点返回的 JSON-RPC 错误（不同服务商的错误码与文案不一致，按文案兜底）
+func classifyReceiptError(err error) string {
+	if errors.Is(err, ethereum.NotFound) {
+		return receiptErrNotFound
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return receiptErrTimeout
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return receiptErrRateLimited
+	}
+	message := strings.ToLower(err.Error())
+	for _, keyword := range []string{"rate limit", "too many requests", "limit exceeded", "429"} {
+		if strings.Contains(message, keyword) {
+			return receiptErrRateLimited
+		}
+	}
+	if strings.Contains(message, "timeout") || strings.Contains(message, "timed out") {
+		return receiptErrTimeout
+	}
+	return receiptErrOther
+}
+
+// reportReceiptStats 按 receiptStatsLogInterval 输出上一周期的回执获取统计，周期内没有请求时不输出
+func (pd *PoolDiscoverer) reportReceiptStats(ctx context.Context) {
+	ticker := time.NewTicker(receiptStatsLogInterval)
+	defer ticker.Stop()
+
+	prev := pd.receipts.Snapshot()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := pd.receipts.Snapshot()
+		delta := current.sub(prev)
+		prev = current
+		if delta.Attempts == 0 {
+			continue
+		}
+		log.Printf("最近 %v 回执获取: 请求 %d, 成功 %d, 失败 %d (%.1f%%; 超时 %d, 未找到 %d, 限流 %d, 其他 %d)",
+			receiptStatsLogInterval, delta.Attempts, delta.Successes, delta.Failures,
+			float64(delta.Failures)/float64(delta.Attempts)*100, delta.Timeouts, delta.NotFound, delta.RateLimited, delta.Other)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// recentBlocksCapacity 去重时记住的最近区块哈希数量，足以覆盖重新订阅与补扫重叠的范围
+const recentBlocksCapacity = 1024
+
+// recentBlocks 有界的最近处理区块哈希集合，超出容量时淘汰最早登记的哈希
+// 以哈希而非高度为键：链重组后同一高度的新区块哈希不同，仍会被处理
+type recentBlocks struct {
+	mu    sync.Mutex
+	order []common.Hash
+	next  int
+	seen  map[common.Hash]struct{}
+}
+
+func newRecentBlocks(capacity int) *recentBlocks {
+	return &recentBlocks{
+		order: make([]common.Hash, capacity),
+		seen:  make(map[common.Hash]struct{}, capacity),
+	}
+}
+
+// Claim 登记区块哈希，返回 false 表示该区块已处理过（或正在被处理）
+func (r *recentBlocks) Claim(hash common.Hash) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.seen[hash]; ok {
+		return false
+	}
+	if evicted := r.order[r.next]; evicted != (common.Hash{}) {
+		delete(r.seen, evicted)
+	}
+	r.order[r.next] = hash
+	r.next = (r.next + 1) % len(r.order)
+	r.seen[hash] = struct{}{}
+	return true
+}
+
+// Release 撤销登记，区块获取失败时调用，以便后续同一区块的事件重试
+func (r *recentBlocks) Release(hash common.Hash) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.seen, hash)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// replayPollInterval 回放时等待区块处理完成的轮询间隔
+const replayPollInterval = 50 * time.Millisecond
+
+// Replayer 按高度区间回放历史区块，将合成的区块事件写入队列，复用发现者的区块处理流程
+type Replayer struct {
+	client     *ethclient.Client
+	queue      *BlockQueue
+	discoverer *PoolDiscoverer
+	finder     *ArbitrageFinder
+	// pruner 回放期间暂停的池子清理任务，为 nil 时不暂停
+	pruner *PoolPruner
+	cfg    *AppConfig
+}
+
+// NewReplayer 创建历史区块回放器，回放期间暂停 pruner，避免按墙钟时间判断的清理把回放中刚写入历史储备量的池子当作失效池子
+func NewReplayer(client *ethclient.Client, queue *BlockQueue, discoverer *PoolDiscoverer, finder *ArbitrageFinder, pruner *PoolPruner, cfg *AppConfig) *Replayer {
+	return &Replayer{
+		client:     client,
+		queue:      queue,
+		discoverer: discoverer,
+		finder:     finder,
+		pruner:     pruner,
+		cfg:        cfg,
+	}
+}
+
+// Backfill 从存储中记录的已处理区块高度补扫到当前链头，补扫深度不超过 MaxBackfillBlocks
+// 补扫期间链头仍在前进，因此循环到追上链头为止，再由调用方切换到实时订阅
+// 没有游标（首次启动）或未开启补扫时直接返回
+func (r *Replayer) Backfill(ctx context.Context, store Store) error {
+	if r.cfg.MaxBackfillBlocks == 0 {
+		return nil
+	}
+	last, ok, err := store.LastProcessedBlock(ctx)
+	if err != nil {
+		return fmt.Errorf("读取已处理区块高度失败: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	from := last + 1
+	for {
+		callCtx, cancel := withRPCTimeout(ctx, r.cfg.RPCCallTimeout)
+		head, err := r.client.BlockNumber(callCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("获取链头高度失败: %w", err)
+		}
+		// 只补扫已达到确认深度的区块，其余区块由实时订阅在确认后处理
+		if head < r.cfg.ConfirmationDepth {
+			return nil
+		}
+		head -= r.cfg.ConfirmationDepth
+		if from > head {
+			return nil
+		}
+		if head-from+1 > r.cfg.MaxBackfillBlocks {
+			capped := head - r.cfg.MaxBackfillBlocks + 1
+			log.Printf("距上次处理的区块 %d 已落后 %d 个区块，仅补扫最近 %d 个（跳过 %d ~ %d）",
+				last, head-last, r.cfg.MaxBackfillBlocks, from, capped-1)
+			from = capped
+		}
+		if err := r.Run(ctx, from, head); err != nil {
+			return err
+		}
+		from = head + 1
+	}
+}
+
+// Run 回放 [from, to] 区间内的区块，to 为 0 时回放到当前链头
+// 所有区块处理完成后执行一次套利发现，并输出区间内发现的池子与套利机会汇总
+func (r *Replayer) Run(ctx context.Context, from, to uint64) error {
+	if to == 0 {
+		callCtx, cancel := withRPCTimeout(ctx, r.cfg.RPCCallTimeout)
+		head, err := r.client.BlockNumber(callCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("获取链头高度失败: %w", err)
+		}
+		to = head
+	}
+	if to < from {
+		return fmt.Errorf("回放区间非法: %d > %d", from, to)
+	}
+
+	if r.pruner != nil {
+		resume := r.pruner.Pause()
+		defer resume()
+	}
+
+	start := time.Now()
+	total := to - from + 1
+	handledBase := r.discoverer.BlocksHandled()
+	poolsBase := r.discoverer.PoolsRecorded()
+	opportunitiesBase := r.finder.OpportunitiesPublished()
+	log.Printf("开始回放区块 %d ~ %d，共 %d 个", from, to, total)
+
+	inflightLimit := uint64(r.cfg.RPCConcurrency)
+	var published uint64
+	for number := from; number <= to; number++ {
+		// 在途区块数量不超过 RPC 并发上限，避免一次性拉起整个区间
+		for published-(r.discoverer.BlocksHandled()-handledBase) >= inflightLimit {
+			if err := sleepContext(ctx, replayPollInterval); err != nil {
+				return err
+			}
+		}
+
+		event := BlockEvent{Number: new(big.Int).SetUint64(number), Replayed: true}
+		if err := r.queue.PublishWait(ctx, event); err != nil {
+			return err
+		}
+		published++
+		if published%100 == 0 {
+			log.Printf("回放进度: %d/%d", published, total)
+		}
+	}
+
+	for r.discoverer.BlocksHandled()-handledBase < total {
+		if err := sleepContext(ctx, replayPollInterval); err != nil {
+			return err
+		}
+	}
+
+	r.finder.runDiscovery(ctx)
+
+	log.Printf("回放完成: 区块 %d ~ %d 共 %d 个, 发现池子 %d 个, 套利机会 %d 个, 耗时 %v",
+		from, to, total,
+		r.discoverer.PoolsRecorded()-poolsBase,
+		r.finder.OpportunitiesPublished()-opportunitiesBase,
+		time.Since(start))
+	return nil
+}
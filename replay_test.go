@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// TestHandleBlockReplayedSkipsLagAndDegrade 回放与补扫的区块不计入处理延迟，降级模式下也完整处理并推进游标
+func TestHandleBlockReplayedSkipsLagAndDegrade(t *testing.T) {
+	tests := []struct {
+		name         string
+		replayed     bool
+		degraded     bool
+		wantSamples  uint64
+		wantDegraded bool
+		wantCursor   bool
+	}{
+		{name: "live block records lag and degrades", wantSamples: 1, wantDegraded: true, wantCursor: true},
+		{name: "live block while degraded skips receipts", degraded: true, wantSamples: 1, wantDegraded: true},
+		{name: "replayed block skips lag", replayed: true, wantCursor: true},
+		{name: "replayed block ignores degrade mode", replayed: true, degraded: true, wantDegraded: true, wantCursor: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 区块时间戳在一小时前，实时处理必然超过延迟阈值
+			chain := &mockChain{head: 100, blockTime: time.Now().Add(-time.Hour)}
+			cfg := &AppConfig{BlockLagWarnThreshold: time.Second, BlockLagDegradeEnabled: true}
+			pd, _, store := newTestDiscoverer(t, chain, cfg)
+			pd.lag.SetDegraded(tt.degraded)
+
+			pd.handleBlock(context.Background(), BlockEvent{Number: big.NewInt(100), Replayed: tt.replayed})
+
+			lag := pd.BlockLag()
+			if lag.Samples != tt.wantSamples || lag.Degraded != tt.wantDegraded {
+				t.Fatalf("延迟样本 %d、降级 %v，期望 %d、%v", lag.Samples, lag.Degraded, tt.wantSamples, tt.wantDegraded)
+			}
+			_, ok, err := store.LastProcessedBlock(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantCursor {
+				t.Fatalf("游标已写入 %v，期望 %v", ok, tt.wantCursor)
+			}
+		})
+	}
+}
+
+// TestPoolPrunerPause 暂停期间跳过清理，所有恢复函数调用后继续清理，重复调用恢复函数不会多次递减
+func TestPoolPrunerPause(t *testing.T) {
+	store := newTestPoolStore(t)
+	pool := testPool(testAddr(100), testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)
+	if err := store.InsertPoolIfNotExists(pool); err != nil {
+		t.Fatal(err)
+	}
+	pp := NewPoolPruner(store, &AppConfig{PoolTTL: -time.Hour, PoolPruneMode: PoolPruneModeDelete, PoolPruneMinReserve: big.NewInt(1000)})
+
+	resumeA := pp.Pause()
+	resumeB := pp.Pause()
+	resumeA()
+	resumeA()
+	pp.prune(context.Background())
+	if _, ok, _ := store.GetPool(context.Background(), pool.Address); !ok {
+		t.Fatal("暂停期间池子被清理")
+	}
+
+	resumeB()
+	pp.prune(context.Background())
+	if _, ok, _ := store.GetPool(context.Background(), pool.Address); ok {
+		t.Fatal("恢复后应清理失效池子")
+	}
+}
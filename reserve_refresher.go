@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	// reserveRefreshProgressEvery 全量刷新储备量时每处理多少个池子输出一次进度
+	reserveRefreshProgressEvery = 500
+	// reserveRefreshPoolsPerRequest 全量刷新时合并到同一次 JSON-RPC 批量请求中的池子数量，
+	// 每个池子占 1 到数个 eth_call，控制在常见节点的批量上限以内
+	reserveRefreshPoolsPerRequest = 50
+)
+
+// errReserveRefreshRunning 已有一轮全量刷新在执行
+var errReserveRefreshRunning = errors.New("储备量全量刷新正在执行")
+
+// ReserveRefreshResult 一轮全量刷新储备量的统计
+type ReserveRefreshResult struct {
+	// Total 存储中的池子数量
+	Total int `json:"total"`
+	// Updated 已写入链上最新储备量的池子数量
+	Updated int `json:"updated"`
+	// Failed 读取或写入储备量失败的池子数量
+	Failed int `json:"failed"`
+	// Skipped 协议不支持实时读取储备量（Balancer、包装虚拟池子）而跳过的池子数量
+	Skipped int `json:"skipped"`
+}
+
+// reserveBatchFetchFunc 通过一次 RPC 批量请求读取多个池子的实时储备量，返回与 pools 一一对应的储备量和错误
+type reserveBatchFetchFunc func(ctx context.Context, pools []poolDetail) ([][]*big.Int, []error, error)
+
+// ReserveRefreshStatus 后台全量刷新任务的状态，Result 在执行过程中实时累加
+type ReserveRefreshStatus struct {
+	Running    bool                 `json:"running"`
+	StartedAt  *time.Time           `json:"started_at,omitempty"`
+	FinishedAt *time.Time           `json:"finished_at,omitempty"`
+	Result     ReserveRefreshResult `json:"result"`
+	// Error 上一轮刷新中止的原因，正常完成时为空
+	Error string `json:"error,omitempty"`
+}
+
+// ReserveRefresher 对存储中的全部池子重新读取链上储备量并覆盖旧值，
+// 用于修正储备量读取问题修复前写入的过期或为 0 的数据；读取方式与 BatchPoolReserves 一致，同一时间只允许一轮刷新
+// 池子打乱顺序后按 RESERVE_REFRESH_BATCH_SIZE 分批，批内每 reserveRefreshPoolsPerRequest 个池子合并为一次 JSON-RPC 批量请求，
+// 并发请求数不超过 RPC_CONCURRENCY，批次之间等待 RESERVE_REFRESH_BATCH_DELAY（带抖动），
+// 使节点看到平稳的请求流而不是数千个池子同时发起的突发请求
+type ReserveRefresher struct {
+	store Store
+	fetch reserveBatchFetchFunc
+	cfg   *AppConfig
+
+	mu     sync.Mutex
+	status ReserveRefreshStatus
+	// jobs 后台刷新协程，停机时 Wait 等待它们写完当前批次
+	jobs sync.WaitGroup
+}
+
+// NewReserveRefresher 创建储备量刷新任务
+func NewReserveRefresher(client *ethclient.Client, store Store, cfg *AppConfig) *ReserveRefresher {
+	fetch := func(ctx context.Context, pools []poolDetail) ([][]*big.Int, []error, error) {
+		return BatchPoolReserves(ctx, client, pools, cfg.RPCCallTimeout)
+	}
+	return &ReserveRefresher{store: store, fetch: fetch, cfg: cfg}
+}
+
+// Status 返回当前或上一轮刷新的状态
+func (rr *ReserveRefresher) Status() ReserveRefreshStatus {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return rr.status
+}
+
+// RefreshAll 立即对全部池子（包括已被标记为失效的池子）执行一轮刷新并等待完成，不考虑上次更新时间
+// 已有一轮刷新在执行时返回 errReserveRefreshRunning
+func (rr *ReserveRefresher) RefreshAll(ctx context.Context) (ReserveRefreshResult, error) {
+	if !rr.begin() {
+		return ReserveRefreshResult{}, errReserveRefreshRunning
+	}
+	return rr.run(ctx)
+}
+
+// StartBackground 在后台启动一轮全量刷新并立即返回启动时的状态，进度通过 Status 查询；ctx 取消时中止刷新
+// 已有一轮刷新在执行时返回当前状态和 errReserveRefreshRunning
+func (rr *ReserveRefresher) StartBackground(ctx context.Context) (ReserveRefreshStatus, error) {
+	if !rr.begin() {
+		return rr.Status(), errReserveRefreshRunning
+	}
+	status := rr.Status()
+	rr.jobs.Add(1)
+	go func() {
+		defer rr.jobs.Done()
+		if _, err := rr.run(ctx); err != nil {
+			log.Printf("储备量全量刷新中止: %v", err)
+		}
+	}()
+	return status, nil
+}
+
+// Wait 等待后台刷新协程退出，ctx 取消后刷新在当前批次写完后中止
+func (rr *ReserveRefresher) Wait() {
+	rr.jobs.Wait()
+}
+
+// begin 标记一轮刷新开始并重置状态，已有一轮在执行时返回 false
+func (rr *ReserveRefresher) begin() bool {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if rr.status.Running {
+		return false
+	}
+	now := time.Now()
+	rr.status = ReserveRefreshStatus{Running: true, StartedAt: &now}
+	return true
+}
+
+// finish 记录本轮刷新结束
+func (rr *ReserveRefresher) finish(err error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	now := time.Now()
+	rr.status.Running = false
+	rr.status.FinishedAt = &now
+	if err != nil {
+		rr.status.Error = err.Error()
+	}
+}
+
+// run 执行一轮刷新，调用方已通过 begin 占用
+func (rr *ReserveRefresher) run(ctx context.Context) (result ReserveRefreshResult, err error) {
+	defer func() {
+		rr.finish(err)
+		result = rr.Status().Result
+	}()
+
+	pools, err := rr.store.ListPools(ctx, ListPoolsOptions{})
+	if err != nil {
+		return ReserveRefreshResult{}, fmt.Errorf("读取池子列表失败: %w", err)
+	}
+	log.Printf("开始全量刷新 %d 个池子的储备量", len(pools))
+
+	var processed int
+	rr.mu.Lock()
+	rr.status.Result.Total = len(pools)
+	rr.mu.Unlock()
+	record := func(update func(*ReserveRefreshResult)) {
+		rr.mu.Lock()
+		defer rr.mu.Unlock()
+		update(&rr.status.Result)
+		processed++
+		if processed%reserveRefreshProgressEvery == 0 {
+			r := rr.status.Result
+			log.Printf("储备量刷新进度: %d/%d, 更新 %d, 失败 %d, 跳过 %d",
+				processed, r.Total, r.Updated, r.Failed, r.Skipped)
+		}
+	}
+
+	var live []poolDetail
+	for _, pool := range pools {
+		if !supportsLiveReserves(pool.Protocol) {
+			record(func(r *ReserveRefreshResult) { r.Skipped++ })
+			continue
+		}
+		live = append(live, pool)
+	}
+	// 存储按入库时间返回，同一时期、同一协议的池子相邻；打乱后每批混合不同的池子，请求分布更均匀
+	rand.Shuffle(len(live), func(i, j int) { live[i], live[j] = live[j], live[i] })
+
+	concurrency := rr.cfg.RPCConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	batchSize := rr.cfg.ReserveRefreshBatchSize
+	if batchSize <= 0 {
+		batchSize = len(live)
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for start := 0; start < len(live); start += batchSize {
+		if start > 0 {
+			if err := sleepContext(ctx, jitterDelay(rr.cfg.ReserveRefreshBatchDelay)); err != nil {
+				return ReserveRefreshResult{}, err
+			}
+		}
+		batch := live[start:min(start+batchSize, len(live))]
+		for from := 0; from < len(batch); from += reserveRefreshPoolsPerRequest {
+			select {
+			case <-ctx.Done():
+				wg.Wait()
+				return ReserveRefreshResult{}, ctx.Err()
+			case sem <- struct{}{}:
+			}
+			wg.Add(1)
+			go func(group []poolDetail) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				rr.refreshGroup(ctx, group, record)
+			}(batch[from:min(from+reserveRefreshPoolsPerRequest, len(batch))])
+		}
+		// 等本批全部完成再进入下一批，批次间隔才能真正拉开请求
+		wg.Wait()
+	}
+
+	r := rr.Status().Result
+	log.Printf("储备量全量刷新完成: 共 %d 个池子, 更新 %d, 失败 %d, 跳过 %d",
+		r.Total, r.Updated, r.Failed, r.Skipped)
+	return r, nil
+}
+
+// refreshGroup 用一次批量请求读取一组池子的储备量并逐个写回存储
+func (rr *ReserveRefresher) refreshGroup(ctx context.Context, group []poolDetail, record func(func(*ReserveRefreshResult))) {
+	reserves, errs, err := rr.fetch(ctx, group)
+	if err != nil {
+		log.Printf("批量读取 %d 个池子的储备量失败: %v", len(group), err)
+		for range group {
+			record(func(r *ReserveRefreshResult) { r.Failed++ })
+		}
+		return
+	}
+	for i, pool := range group {
+		if err := rr.write(pool, reserves[i], errs[i]); err != nil {
+			log.Printf("刷新池子 %s 的储备量失败: %v", pool.Address.Hex(), err)
+			record(func(r *ReserveRefreshResult) { r.Failed++ })
+			continue
+		}
+		record(func(r *ReserveRefreshResult) { r.Updated++ })
+	}
+}
+
+// write 校验单个池子读取到的储备量并写回存储
+func (rr *ReserveRefresher) write(pool poolDetail, reserves []*big.Int, fetchErr error) error {
+	if fetchErr != nil {
+		return fetchErr
+	}
+	if len(reserves) != len(pool.Tokens) {
+		return fmt.Errorf("储备量数量 %d 与代币数量 %d 不一致", len(reserves), len(pool.Tokens))
+	}
+	return rr.store.UpdatePoolReserves(pool.Address, reserves)
+}
+
+// jitterDelay 在 [0.8d, 1.2d] 之间随机取值，避免多个实例的批次对齐
+func jitterDelay(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	spread := int64(d) * 2 / 5
+	return d - time.Duration(spread/2) + time.Duration(rand.Int63n(spread+1))
+}
+
+// supportsLiveReserves 判断 FetchPoolReserves 是否支持该协议：Balancer 余额记在 Vault 中，包装虚拟池子没有储备量，
+// 其余协议（包括配置文件中的协议）都可以读取
+func supportsLiveReserves(protocol string) bool {
+	switch protocol {
+	case ProtocolBalancerWeighted, ProtocolWrapNative:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+)
+
+// mockReservesEth 模拟节点的 eth_call：V2 池子返回 reserves 中的储备量，代币合约返回 balances 中的余额，
+// revert 中的地址调用失败
+type mockReservesEth struct {
+	reserves map[common.Address][2]*big.Int
+	balances map[common.Address]map[common.Address]*big.Int
+	revert   map[common.Address]bool
+}
+
+func (s *mockReservesEth) Call(args mockCallArgs, block string) (hexutil.Bytes, error) {
+	to := *args.To
+	if s.revert[to] {
+		return nil, errors.New("execution reverted")
+	}
+	data := args.calldata()
+	if reserves, ok := s.reserves[to]; ok {
+		return v2PairABI.Methods["getReserves"].Outputs.Pack(reserves[0], reserves[1], uint32(0))
+	}
+	values, err := erc20ABI.Methods["balanceOf"].Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, err
+	}
+	balance := s.balances[to][values[0].(common.Address)]
+	if balance == nil {
+		balance = new(big.Int)
+	}
+	return erc20ABI.Methods["balanceOf"].Outputs.Pack(balance)
+}
+
+// TestBatchPoolReserves 一次 HTTP 请求内批量读取多种协议池子的储备量，单个池子失败不影响其他池子
+func TestBatchPoolReserves(t *testing.T) {
+	token0, token1 := testAddr(1), testAddr(2)
+	v2, v2Reverted, v3, balancer := testAddr(10), testAddr(11), testAddr(12), testAddr(13)
+	service := &mockReservesEth{
+		reserves: map[common.Address][2]*big.Int{v2: {big.NewInt(100), big.NewInt(200)}},
+		balances: map[common.Address]map[common.Address]*big.Int{
+			token0: {v3: big.NewInt(300)},
+			token1: {v3: big.NewInt(400)},
+		},
+		revert: map[common.Address]bool{v2Reverted: true},
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	var requests atomic.Int32
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		server.ServeHTTP(w, r)
+	}))
+	defer httpServer.Close()
+	client, err := ethclient.Dial(httpServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	withProtocol := func(pool poolDetail, protocol string) poolDetail {
+		pool.Protocol = protocol
+		return pool
+	}
+	tests := []struct {
+		name         string
+		pools        []poolDetail
+		want         [][]int64
+		wantErr      []bool
+		wantRequests int32
+	}{
+		{
+			name: "mixed protocols in one request",
+			pools: []poolDetail{
+				testPool(v2, token0, token1, nil, nil, 30),
+				withProtocol(testPool(v3, token0, token1, nil, nil, 30), ProtocolUniswapV3),
+				testPool(v2Reverted, token0, token1, nil, nil, 30),
+				withProtocol(testPool(balancer, token0, token1, nil, nil, 30), ProtocolBalancerWeighted),
+			},
+			want:         [][]int64{{100, 200}, {300, 400}, nil, nil},
+			wantErr:      []bool{false, false, true, true},
+			wantRequests: 1,
+		},
+		{
+			name:         "unsupported only sends nothing",
+			pools:        []poolDetail{withProtocol(testPool(balancer, token0, token1, nil, nil, 30), ProtocolWrapNative)},
+			want:         [][]int64{nil},
+			wantErr:      []bool{true},
+			wantRequests: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			reserves, errs, err := BatchPoolReserves(context.Background(), client, tt.pools, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Fatalf("发送了 %d 次 HTTP 请求，期望 %d 次", got, tt.wantRequests)
+			}
+			for i := range tt.pools {
+				if (errs[i] != nil) != tt.wantErr[i] {
+					t.Fatalf("池子 %d 错误 %v，期望出错 %v", i, errs[i], tt.wantErr[i])
+				}
+				if len(reserves[i]) != len(tt.want[i]) {
+					t.Fatalf("池子 %d 储备量 %v，期望 %v", i, reserves[i], tt.want[i])
+				}
+				for j, want := range tt.want[i] {
+					if reserves[i][j].Int64() != want {
+						t.Fatalf("池子 %d 储备量 %v，期望 %v", i, reserves[i], tt.want[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestRefreshReservesHandler POST 在后台启动刷新并立即返回 202，执行中重复触发返回 409，GET 返回进度与最终结果；
+// 每次批量读取的池子数量不超过 reserveRefreshPoolsPerRequest
+func TestRefreshReservesHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name        string
+		pools       int
+		batchErr    error
+		poolErr     bool
+		wantUpdated int
+		wantFailed  int
+	}{
+		{name: "all updated", pools: reserveRefreshPoolsPerRequest + 5, wantUpdated: reserveRefreshPoolsPerRequest + 5},
+		{name: "batch request fails", pools: 3, batchErr: errors.New("rpc down"), wantFailed: 3},
+		{name: "single pool fails", pools: 3, poolErr: true, wantUpdated: 2, wantFailed: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestPoolStore(t)
+			failing := testAddr(1000)
+			for i := 0; i < tt.pools; i++ {
+				address := testAddr(1000 + i)
+				if err := store.InsertPoolIfNotExists(testPool(address, testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			release := make(chan struct{})
+			var (
+				mu       sync.Mutex
+				maxGroup int
+			)
+			fetch := func(ctx context.Context, pools []poolDetail) ([][]*big.Int, []error, error) {
+				<-release
+				mu.Lock()
+				maxGroup = max(maxGroup, len(pools))
+				mu.Unlock()
+				if tt.batchErr != nil {
+					return nil, nil, tt.batchErr
+				}
+				reserves := make([][]*big.Int, len(pools))
+				errs := make([]error, len(pools))
+				for i, pool := range pools {
+					if tt.poolErr && pool.Address == failing {
+						errs[i] = errors.New("execution reverted")
+						continue
+					}
+					reserves[i] = []*big.Int{big.NewInt(7), big.NewInt(8)}
+				}
+				return reserves, errs, nil
+			}
+			refresher := &ReserveRefresher{store: store, fetch: fetch, cfg: &AppConfig{RPCConcurrency: 2}}
+			router := gin.New()
+			router.POST("/pools/refresh-reserves", refreshReservesHandler(context.Background(), refresher))
+			router.GET("/pools/refresh-reserves", refreshReservesStatusHandler(refresher))
+			call := func(method string) (int, ReserveRefreshStatus) {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(method, "/pools/refresh-reserves", nil))
+				var status ReserveRefreshStatus
+				if method == http.MethodGet || w.Code == http.StatusAccepted {
+					if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+						t.Fatal(err)
+					}
+				}
+				return w.Code, status
+			}
+
+			if code, status := call(http.MethodPost); code != http.StatusAccepted || !status.Running || status.StartedAt == nil {
+				t.Fatalf("首次触发返回 %d %+v，期望 202 且 running", code, status)
+			}
+			if code, _ := call(http.MethodPost); code != http.StatusConflict {
+				t.Fatalf("执行中重复触发返回 %d，期望 409", code)
+			}
+			if _, status := call(http.MethodGet); !status.Running {
+				t.Fatalf("执行中状态 %+v，期望 running", status)
+			}
+			close(release)
+			waitDone := func() ReserveRefreshStatus {
+				deadline := time.After(5 * time.Second)
+				for {
+					if _, status := call(http.MethodGet); !status.Running {
+						return status
+					}
+					select {
+					case <-deadline:
+						t.Fatal("等待后台刷新完成超时")
+					case <-time.After(5 * time.Millisecond):
+					}
+				}
+			}
+
+			status := waitDone()
+			want := ReserveRefreshResult{Total: tt.pools, Updated: tt.wantUpdated, Failed: tt.wantFailed}
+			if status.Result != want || status.FinishedAt == nil || status.Error != "" {
+				t.Fatalf("刷新完成状态 %+v，期望结果 %+v", status, want)
+			}
+			if maxGroup > reserveRefreshPoolsPerRequest {
+				t.Fatalf("单次批量读取 %d 个池子，超过 %d", maxGroup, reserveRefreshPoolsPerRequest)
+			}
+			if tt.wantUpdated > 0 {
+				pool, ok, err := store.GetPool(context.Background(), testAddr(1001))
+				if err != nil || !ok || pool.Reserves[0].Int64() != 7 || pool.Reserves[1].Int64() != 8 {
+					t.Fatalf("池子储备量 %v (%v, %v)，期望 [7 8]", pool.Reserves, ok, err)
+				}
+			}
+			if code, _ := call(http.MethodPost); code != http.StatusAccepted {
+				t.Fatalf("上一轮完成后再次触发返回 %d，期望 202", code)
+			}
+			waitDone()
+		})
+	}
+}
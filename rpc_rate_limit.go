@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/time/rate"
+)
+
+// rpcRateLimitTransport 对 HTTP 节点连接上的全部 JSON-RPC 调用共享一个令牌桶限速：
+// 单个调用消耗 1 个令牌，批量请求按其中的调用数量消耗令牌（节点与服务商通常按调用而不是按 HTTP 请求计费限流），
+// 所有组件（池子发现、储备量刷新、计算者、执行者）共用同一条 HTTP 连接，因此共用同一个限额
+type rpcRateLimitTransport struct {
+	limiter *rate.Limiter
+	next    http.RoundTripper
+}
+
+// newRPCRateLimitTransport 创建限速的 HTTP transport，callsPerSecond 为每秒调用数上限，
+// burst 为允许的突发调用数，不小于 1
+func newRPCRateLimitTransport(callsPerSecond float64, burst int, next http.RoundTripper) *rpcRateLimitTransport {
+	return &rpcRateLimitTransport{limiter: rate.NewLimiter(rate.Limit(callsPerSecond), max(burst, 1)), next: next}
+}
+
+func (t *rpcRateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	calls := 1
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			calls = countRPCCalls(body)
+			body.Close()
+		}
+	}
+	// 批量请求的调用数可能超过 burst，按 burst 分段等待
+	for calls > 0 {
+		n := min(calls, t.limiter.Burst())
+		if err := t.limiter.WaitN(req.Context(), n); err != nil {
+			return nil, fmt.Errorf("等待 RPC 限速令牌失败: %w", err)
+		}
+		calls -= n
+	}
+	return t.next.RoundTrip(req)
+}
+
+// countRPCCalls 返回请求体中 JSON-RPC 调用的数量：批量请求为数组长度，其余按 1 个计
+func countRPCCalls(body io.Reader) int {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return 1
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		return 1
+	}
+	var batch []json.RawMessage
+	if err := json.Unmarshal(data, &batch); err != nil || len(batch) == 0 {
+		return 1
+	}
+	return len(batch)
+}
+
+// dialRateLimitedHTTP 连接 HTTP 节点，callsPerSecond 大于 0 时对该连接上的全部调用限速，
+// 允许的突发量为 1 秒的额度
+func dialRateLimitedHTTP(ctx context.Context, url string, callsPerSecond float64) (*ethclient.Client, error) {
+	if callsPerSecond <= 0 {
+		return ethclient.DialContext(ctx, url)
+	}
+	transport := newRPCRateLimitTransport(callsPerSecond, int(callsPerSecond), http.DefaultTransport)
+	client, err := rpc.DialOptions(ctx, url, rpc.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
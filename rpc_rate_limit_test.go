@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// mockBlockNumberEth 模拟节点的 eth_blockNumber
+type mockBlockNumberEth struct{}
+
+func (mockBlockNumberEth) BlockNumber() hexutil.Uint64 { return 100 }
+
+func TestCountRPCCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "single call", body: `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`, want: 1},
+		{name: "batch", body: ` [{"id":1},{"id":2},{"id":3}]`, want: 3},
+		{name: "empty batch", body: `[]`, want: 1},
+		{name: "malformed", body: `[{"id":1}`, want: 1},
+		{name: "empty body", body: ``, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countRPCCalls(strings.NewReader(tt.body)); got != tt.want {
+				t.Fatalf("countRPCCalls = %d，期望 %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRPCRateLimitTransport 同一连接上的单个调用与批量请求共用限额，批量请求按其中的调用数消耗令牌
+func TestRPCRateLimitTransport(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", mockBlockNumberEth{}); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	const callsPerSecond = 100
+	tests := []struct {
+		name  string
+		batch bool
+		calls int
+	}{
+		{name: "single calls", calls: 11},
+		{name: "one batch", batch: true, calls: 11},
+		{name: "batch larger than burst", batch: true, calls: 21},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newRPCRateLimitTransport(callsPerSecond, 1, http.DefaultTransport)
+			client, err := rpc.DialOptions(context.Background(), httpServer.URL, rpc.WithHTTPClient(&http.Client{Transport: transport}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			start := time.Now()
+			if tt.batch {
+				batch := make([]rpc.BatchElem, tt.calls)
+				for i := range batch {
+					batch[i] = rpc.BatchElem{Method: "eth_blockNumber", Result: new(hexutil.Uint64)}
+				}
+				if err := client.BatchCall(batch); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				for i := 0; i < tt.calls; i++ {
+					var number hexutil.Uint64
+					if err := client.Call(&number, "eth_blockNumber"); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			// 突发量为 1，其余每个调用等待 1/callsPerSecond 秒
+			want := time.Duration(tt.calls-1) * time.Second / callsPerSecond
+			if elapsed := time.Since(start); elapsed < want*9/10 {
+				t.Fatalf("%d 个调用耗时 %s，期望按每秒 %d 个限速至少 %s", tt.calls, elapsed, callsPerSecond, want)
+			}
+		})
+	}
+}
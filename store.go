@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 支持的存储驱动
+const (
+	// StoreDriverSQLite 本地 SQLite 文件（默认）
+	StoreDriverSQLite = "sqlite"
+	// StoreDriverPostgres Postgres 数据库，使用真实连接池，适合多组件并发写入
+	StoreDriverPostgres = "postgres"
+)
+
+// Store 池子与代币元数据的持久化接口
+type Store interface {
+	InsertPoolIfNotExists(pool poolDetail) error
+	ListPools(ctx context.Context, opts ListPoolsOptions) ([]poolDetail, error)
+	GetPool(ctx context.Context, address common.Address) (poolDetail, bool, error)
+	ExportPools(ctx context.Context, w io.Writer, format string) error
+	DeleteStalePools(ctx context.Context, before time.Time, minReserve *big.Int) (int64, error)
+	DeactivateStalePools(ctx context.Context, before time.Time, minReserve *big.Int) (int64, error)
+	UpdatePoolVolume(address common.Address, volumes []*big.Int, at time.Time) error
+	UpdatePoolReserves(address common.Address, reserves []*big.Int) error
+	SetPoolBlacklisted(address common.Address, blacklisted bool) (bool, error)
+	UpsertToken(meta tokenMetadata) error
+	ListTokens(ctx context.Context) ([]tokenMetadata, error)
+	LastProcessedBlock(ctx context.Context) (uint64, bool, error)
+	SetLastProcessedBlock(number uint64) error
+	MarkPathSeen(key string, until time.Time) error
+	ListSeenPaths(ctx context.Context, now time.Time) (map[string]time.Time, error)
+	DeleteExpiredPaths(now time.Time) (int64, error)
+	RecordOpportunity(record OpportunityRecord) error
+	DeleteOpportunitiesBefore(ctx context.Context, before time.Time) (int64, error)
+	OpportunityStats(ctx context.Context, since time.Time) (OpportunityStats, error)
+	RecordPaperTrade(trade PaperTrade) error
+	PaperStats(ctx context.Context, since time.Time) (PaperStats, error)
+	Close() error
+}
+
+// 池子列表的排序方式，同一排序键的池子再按地址排序，保证多次查询的顺序一致
+const (
+	// PoolOrderCreated 按入库时间排序（默认）
+	PoolOrderCreated = "created_at"
+	// PoolOrderUpdated 按最近一次写入时间排序
+	PoolOrderUpdated = "updated_at"
+	// PoolOrderAddress 按池子地址排序
+	PoolOrderAddress = "address"
+)
+
+// poolOrderClauses 排序方式对应的 ORDER BY 子句
+var poolOrderClauses = map[string]string{
+	"":               "created_at, id",
+	PoolOrderCreated: "created_at, id",
+	PoolOrderUpdated: "updated_at, id",
+	PoolOrderAddress: "id",
+}
+
+// ListPoolsOptions 查询池子列表的可选条件
+type ListPoolsOptions struct {
+	// ActiveOnly 只返回未被清理任务标记为失效的池子
+	ActiveOnly bool
+	// BlacklistedOnly 只返回被拉黑的池子
+	BlacklistedOnly bool
+	// OrderBy 排序方式（PoolOrderCreated / PoolOrderUpdated / PoolOrderAddress），为空时按入库时间
+	OrderBy string
+	// Limit 最多返回的池子数量，0 表示不限制
+	Limit int
+	// Offset 按排序跳过的池子数量，与 Limit 配合分页
+	Offset int
+}
+
+// NewStore 根据配置创建存储
+func NewStore(cfg *AppConfig) (Store, error) {
+	switch cfg.DBDriver {
+	case "", StoreDriverSQLite:
+		return NewPoolStore(cfg.SQLitePath, SQLiteOptions{
+			BusyTimeout: cfg.SQLiteBusyTimeout,
+			CacheSize:   cfg.SQLiteCacheSize,
+			Synchronous: cfg.SQLiteSynchronous,
+			MaxConns:    cfg.SQLiteMaxConns,
+		})
+	case StoreDriverPostgres:
+		return NewPostgresPoolStore(cfg.DBDSN)
+	default:
+		return nil, fmt.Errorf("不支持的存储驱动: %s", cfg.DBDriver)
+	}
+}
+
+// sqlDialect 描述不同数据库之间的 SQL 差异，查询语句统一使用 ? 占位符书写
+type sqlDialect struct {
+	name string
+	// serialized 是否需要在进程内串行化所有访问（SQLite 单连接模式）
+	serialized bool
+	// datetimeType 时间列类型
+	datetimeType string
+	// boolType 布尔列类型
+	boolType string
+	// numericType 将 TEXT 存储的大整数转换为可比较数值时使用的类型
+	numericType string
+}
+
+var (
+	sqliteDialect = sqlDialect{
+		name:         StoreDriverSQLite,
+		serialized:   true,
+		datetimeType: "DATETIME",
+		boolType:     "INTEGER",
+		numericType:  "REAL",
+	}
+	postgresDialect = sqlDialect{
+		name:         StoreDriverPostgres,
+		serialized:   false,
+		datetimeType: "TIMESTAMP",
+		boolType:     "BOOLEAN",
+		numericType:  "NUMERIC",
+	}
+)
+
+// rebind 将 ? 占位符转换为当前方言的占位符（Postgres 使用 $1、$2 ...）
+func (d sqlDialect) rebind(query string) string {
+	if d.name != StoreDriverPostgres {
+		return query
+	}
+	var builder strings.Builder
+	index := 0
+	for _, ch := range query {
+		if ch == '?' {
+			index++
+			builder.WriteString("$")
+			builder.WriteString(strconv.Itoa(index))
+			continue
+		}
+		builder.WriteRune(ch)
+	}
+	return builder.String()
+}
+
+// schema 替换语句中的 {{DATETIME}}、{{BOOL}}、{{NUMERIC}} 类型占位
+func (d sqlDialect) schema(ddl string) string {
+	return strings.NewReplacer("{{DATETIME}}", d.datetimeType, "{{BOOL}}", d.boolType, "{{NUMERIC}}", d.numericType).Replace(ddl)
+}
+
+// hourBucket 返回将时间列截断到整点的表达式，结果为 "2006-01-02 15:00:00" 格式的 UTC 文本
+func (d sqlDialect) hourBucket(column string) string {
+	if d.name == StoreDriverPostgres {
+		return "to_char(date_trunc('hour', " + column + "), 'YYYY-MM-DD HH24:00:00')"
+	}
+	return "strftime('%Y-%m-%d %H:00:00', " + column + ")"
+}
+
+// dbTime 将时间格式化为与 CURRENT_TIMESTAMP 一致的 UTC 文本，SQLite 按文本比较、Postgres 隐式转换为 TIMESTAMP
+func dbTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// storeBreakerThreshold 连续写入失败多少次后熔断，熔断期间新池子直接进入内存缓冲
+	storeBreakerThreshold = 5
+	// storeRetryBackoffMin 瞬时错误重试的初始等待时间
+	storeRetryBackoffMin = 50 * time.Millisecond
+	// storeRetryBackoffMax 瞬时错误重试的最大等待时间
+	storeRetryBackoffMax = time.Second
+	// storeCloseFlushTimeout Close 写回缓冲池子的最长时间
+	storeCloseFlushTimeout = 10 * time.Second
+)
+
+// StoreHealth 存储健康状态快照，用于健康检查输出
+type StoreHealth struct {
+	// Healthy 熔断器是否处于关闭状态
+	Healthy bool `json:"healthy"`
+	// ConsecutiveFailures 连续写入失败次数
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// BufferedPools 等待存储恢复后写入的池子数量
+	BufferedPools int `json:"buffered_pools"`
+	// DroppedPools 缓冲区已满而丢弃的池子数量
+	DroppedPools uint64 `json:"dropped_pools"`
+	// LastError 最近一次失败的错误信息
+	LastError string `json:"last_error,omitempty"`
+	// LastFailure 最近一次失败时间
+	LastFailure time.Time `json:"last_failure"`
+	// StalePools 最近一次读取池子列表失败，套利发现正在使用缓存的旧列表
+	StalePools bool `json:"stale_pools"`
+	// PoolsCachedAt StalePools 时所用缓存列表的读取时间
+	PoolsCachedAt time.Time `json:"pools_cached_at,omitempty"`
+}
+
+// cachedPools 最近一次成功读取的池子列表及读取时间
+type cachedPools struct {
+	pools []poolDetail
+	at    time.Time
+}
+
+// ResilientStore 在 Store 之上增加瞬时错误重试、熔断与池子缓冲：
+// 写入遇到 SQLITE_BUSY 等瞬时错误时按退避重试；连续失败达到阈值后熔断，
+// 熔断期间发现的池子暂存在内存中（按地址去重，保留最新储备量），由 Start 周期性尝试写回；
+// 读取池子列表失败时返回最近一次成功的结果并在健康状态中标记 StalePools，避免整轮套利发现被跳过
+// 重试等待随 Start 的 ctx 取消而中止，停机时不会卡在退避中
+type ResilientStore struct {
+	Store
+	cfg *AppConfig
+	// ctx 没有调用方 ctx 的写操作重试时使用，Start 退出时取消
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	health    StoreHealth
+	buffer    map[common.Address]poolDetail
+	lastPools map[ListPoolsOptions]cachedPools
+}
+
+// NewResilientStore 包装存储
+func NewResilientStore(store Store, cfg *AppConfig) *ResilientStore {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ResilientStore{
+		Store:     store,
+		cfg:       cfg,
+		ctx:       ctx,
+		cancel:    cancel,
+		health:    StoreHealth{Healthy: true},
+		buffer:    make(map[common.Address]poolDetail),
+		lastPools: make(map[ListPoolsOptions]cachedPools),
+	}
+}
+
+// Start 熔断或有缓冲池子时，按 StoreRecoveryInterval 周期尝试写回缓冲区；ctx 取消后进行中的重试不再等待
+func (rs *ResilientStore) Start(ctx context.Context) {
+	ticker := time.NewTicker(rs.cfg.StoreRecoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			rs.cancel()
+			return
+		case <-ticker.C:
+			rs.flush()
+		}
+	}
+}
+
+// Close 最后一次写回缓冲的池子（熔断期间同样尝试），再关闭底层存储；
+// 应在所有写入方退出后调用，仍未写回的池子数量记录到日志
+func (rs *ResilientStore) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), storeCloseFlushTimeout)
+	rs.flushContext(ctx)
+	cancel()
+	rs.cancel()
+	if remaining := rs.Health().BufferedPools; remaining > 0 {
+		log.Printf("关闭存储时仍有 %d 个缓冲池子未能写回，已丢弃", remaining)
+	}
+	return rs.Store.Close()
+}
+
+// Health 返回存储健康状态
+func (rs *ResilientStore) Health() StoreHealth {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	health := rs.health
+	health.BufferedPools = len(rs.buffer)
+	return health
+}
+
+// ErrBuffered 池子未写入存储，已暂存到内存缓冲，存储恢复后写回；数据尚未落盘，进程退出前未写回的池子会丢失
+var ErrBuffered = errors.New("池子已暂存到内存缓冲，等待存储恢复后写入")
+
+// InsertPoolIfNotExists 写入池子，重试后仍失败或已熔断时缓冲到内存并返回 ErrBuffered，
+// 缓冲区已满导致池子被丢弃时返回 errStoreBufferFull
+func (rs *ResilientStore) InsertPoolIfNotExists(pool poolDetail) error {
+	if rs.open() {
+		return rs.bufferPool(pool)
+	}
+	if err := rs.write(func() error { return rs.Store.InsertPoolIfNotExists(pool) }); err != nil {
+		log.Printf("写入池子 %s 失败，暂存到内存缓冲: %v", pool.Address.Hex(), err)
+		return rs.bufferPool(pool)
+	}
+	return nil
+}
+
+// ListPools 读取池子列表，失败时返回同一查询条件下最近一次成功的结果，并在健康状态中标记 StalePools 与缓存时间
+// 只缓存不分页的查询，分页请求来自接口调用方，失败时直接返回错误
+func (rs *ResilientStore) ListPools(ctx context.Context, opts ListPoolsOptions) ([]poolDetail, error) {
+	var pools []poolDetail
+	err := rs.retry(ctx, func() error {
+		var err error
+		pools, err = rs.Store.ListPools(ctx, opts)
+		return err
+	})
+
+	if opts.Limit > 0 || opts.Offset > 0 {
+		return pools, err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if err != nil {
+		cached, ok := rs.lastPools[opts]
+		if !ok {
+			return nil, err
+		}
+		rs.health.StalePools = true
+		rs.health.PoolsCachedAt = cached.at
+		log.Printf("读取池子列表失败，使用 %s 前读取的 %d 个池子: %v", time.Since(cached.at).Round(time.Second), len(cached.pools), err)
+		return cached.pools, nil
+	}
+	rs.lastPools[opts] = cachedPools{pools: pools, at: time.Now()}
+	rs.health.StalePools = false
+	rs.health.PoolsCachedAt = time.Time{}
+	return pools, nil
+}
+
+// UpdatePoolVolume 写入池子滚动成交量，瞬时错误时重试
+func (rs *ResilientStore) UpdatePoolVolume(address common.Address, volumes []*big.Int, at time.Time) error {
+	return rs.write(func() error { return rs.Store.UpdatePoolVolume(address, volumes, at) })
+}
+
+// UpdatePoolReserves 覆盖池子储备量，瞬时错误时重试
+func (rs *ResilientStore) UpdatePoolReserves(address common.Address, reserves []*big.Int) error {
+	return rs.write(func() error { return rs.Store.UpdatePoolReserves(address, reserves) })
+}
+
+// SetPoolBlacklisted 设置或清除池子的拉黑标记，瞬时错误时重试
+func (rs *ResilientStore) SetPoolBlacklisted(address common.Address, blacklisted bool) (bool, error) {
+	var found bool
+	err := rs.write(func() error {
+		var err error
+		found, err = rs.Store.SetPoolBlacklisted(address, blacklisted)
+		return err
+	})
+	return found, err
+}
+
+// RecordOpportunity 写入已确认的套利机会，瞬时错误时重试；只用于统计，失败时不缓冲
+func (rs *ResilientStore) RecordOpportunity(record OpportunityRecord) error {
+	return rs.write(func() error { return rs.Store.RecordOpportunity(record) })
+}
+
+// DeleteOpportunitiesBefore 删除过期的套利机会记录，瞬时错误时重试
+func (rs *ResilientStore) DeleteOpportunitiesBefore(ctx context.Context, before time.Time) (int64, error) {
+	var count int64
+	err := rs.writeContext(ctx, func() error {
+		var err error
+		count, err = rs.Store.DeleteOpportunitiesBefore(ctx, before)
+		return err
+	})
+	return count, err
+}
+
+// RecordPaperTrade 写入模拟交易，瞬时错误时重试；失败时不缓冲
+func (rs *ResilientStore) RecordPaperTrade(trade PaperTrade) error {
+	return rs.write(func() error { return rs.Store.RecordPaperTrade(trade) })
+}
+
+// UpsertToken 写入代币元数据，瞬时错误时重试
+func (rs *ResilientStore) UpsertToken(meta tokenMetadata) error {
+	return rs.write(func() error { return rs.Store.UpsertToken(meta) })
+}
+
+// SetLastProcessedBlock 记录已处理的区块高度，瞬时错误时重试
+func (rs *ResilientStore) SetLastProcessedBlock(number uint64) error {
+	return rs.write(func() error { return rs.Store.SetLastProcessedBlock(number) })
+}
+
+// MarkPathSeen 记录路径的静默截止时间，瞬时错误时重试
+func (rs *ResilientStore) MarkPathSeen(key string, until time.Time) error {
+	return rs.write(func() error { return rs.Store.MarkPathSeen(key, until) })
+}
+
+// DeleteExpiredPaths 删除静默期已结束的路径，瞬时错误时重试
+func (rs *ResilientStore) DeleteExpiredPaths(now time.Time) (int64, error) {
+	var count int64
+	err := rs.write(func() error {
+		var err error
+		count, err = rs.Store.DeleteExpiredPaths(now)
+		return err
+	})
+	return count, err
+}
+
+// DeleteStalePools 删除失效池子，瞬时错误时重试
+func (rs *ResilientStore) DeleteStalePools(ctx context.Context, before time.Time, minReserve *big.Int) (int64, error) {
+	var count int64
+	err := rs.writeContext(ctx, func() error {
+		var err error
+		count, err = rs.Store.DeleteStalePools(ctx, before, minReserve)
+		return err
+	})
+	return count, err
+}
+
+// DeactivateStalePools 标记失效池子，瞬时错误时重试
+func (rs *ResilientStore) DeactivateStalePools(ctx context.Context, before time.Time, minReserve *big.Int) (int64, error) {
+	var count int64
+	err := rs.writeContext(ctx, func() error {
+		var err error
+		count, err = rs.Store.DeactivateStalePools(ctx, before, minReserve)
+		return err
+	})
+	return count, err
+}
+
+// write 执行写操作并据结果更新熔断状态；读操作只重试，不影响熔断（只读文件系统上读仍可成功）
+func (rs *ResilientStore) write(fn func() error) error {
+	return rs.writeContext(rs.ctx, fn)
+}
+
+// writeContext 与 write 相同，重试等待随 ctx 取消而中止
+func (rs *ResilientStore) writeContext(ctx context.Context, fn func() error) error {
+	err := rs.retry(ctx, fn)
+	rs.record(err)
+	return err
+}
+
+// retry 执行 fn，遇到瞬时错误时按退避重试 StoreWriteRetries 次；等待期间 ctx 取消时返回最后一次的错误
+func (rs *ResilientStore) retry(ctx context.Context, fn func() error) error {
+	b := newBackoff(storeRetryBackoffMin, storeRetryBackoffMax)
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(); err == nil || !isTransientStoreError(err) || attempt >= rs.cfg.StoreWriteRetries {
+			return err
+		}
+		if sleepContext(ctx, b.Next()) != nil {
+			return err
+		}
+	}
+}
+
+// record 根据操作结果更新连续失败次数与熔断状态
+func (rs *ResilientStore) record(err error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err == nil {
+		if !rs.health.Healthy {
+			log.Printf("存储已恢复，熔断关闭")
+		}
+		rs.health.Healthy = true
+		rs.health.ConsecutiveFailures = 0
+		return
+	}
+	rs.health.ConsecutiveFailures++
+	rs.health.LastError = err.Error()
+	rs.health.LastFailure = time.Now()
+	if rs.health.Healthy && rs.health.ConsecutiveFailures >= storeBreakerThreshold {
+		rs.health.Healthy = false
+		log.Printf("存储连续失败 %d 次，熔断开启，新池子暂存到内存缓冲（上限 %d）", rs.health.ConsecutiveFailures, rs.cfg.StoreBufferSize)
+	}
+}
+
+func (rs *ResilientStore) open() bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return !rs.health.Healthy
+}
+
+// bufferPool 将池子放入内存缓冲并返回 ErrBuffered，已缓冲的池子用最新数据覆盖
+func (rs *ResilientStore) bufferPool(pool poolDetail) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, ok := rs.buffer[pool.Address]; !ok && len(rs.buffer) >= rs.cfg.StoreBufferSize {
+		rs.health.DroppedPools++
+		return errStoreBufferFull
+	}
+	rs.buffer[pool.Address] = pool
+	return ErrBuffered
+}
+
+// flush 将缓冲的池子写回存储，遇到错误时停止，剩余池子留待下一轮
+// 熔断期间用第一个池子作为探测，写入成功即关闭熔断
+func (rs *ResilientStore) flush() {
+	rs.flushContext(rs.ctx)
+}
+
+// flushContext 与 flush 相同，重试等待随 ctx 取消而中止
+func (rs *ResilientStore) flushContext(ctx context.Context) {
+	rs.mu.Lock()
+	pending := make([]poolDetail, 0, len(rs.buffer))
+	for _, pool := range rs.buffer {
+		pending = append(pending, pool)
+	}
+	rs.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	flushed := 0
+	for _, pool := range pending {
+		if err := rs.writeContext(ctx, func() error { return rs.Store.InsertPoolIfNotExists(pool) }); err != nil {
+			log.Printf("写回缓冲池子失败，剩余 %d 个待下一轮重试: %v", len(pending)-flushed, err)
+			break
+		}
+		rs.mu.Lock()
+		// 写回期间同一池子可能再次被缓冲（储备量更新），只删除已写回的版本
+		if buffered, ok := rs.buffer[pool.Address]; ok && samePoolSnapshot(buffered, pool) {
+			delete(rs.buffer, pool.Address)
+		}
+		rs.mu.Unlock()
+		flushed++
+	}
+	if flushed > 0 {
+		log.Printf("已将 %d 个缓冲池子写回存储", flushed)
+	}
+}
+
+// samePoolSnapshot 判断两个池子快照的储备量是否相同
+func samePoolSnapshot(a, b poolDetail) bool {
+	if len(a.Reserves) != len(b.Reserves) || a.FeePips != b.FeePips || a.FeePipsOneForZero != b.FeePipsOneForZero {
+		return false
+	}
+	for i := range a.Reserves {
+		if (a.Reserves[i] == nil) != (b.Reserves[i] == nil) {
+			return false
+		}
+		if a.Reserves[i] != nil && a.Reserves[i].Cmp(b.Reserves[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// errStoreBufferFull 存储不可用且内存缓冲已满，池子被丢弃
+var errStoreBufferFull = errors.New("存储不可用且内存缓冲已满")
+
+// isTransientStoreError 判断是否为可重试的瞬时错误（SQLite 锁冲突、Postgres 连接中断等）
+func isTransientStoreError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range []string{"database is locked", "sqlite_busy", "database table is locked", "connection refused", "connection reset", "bad connection", "broken pipe"} {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
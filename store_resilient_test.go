@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+// errTestLocked 被 isTransientStoreError 视为瞬时错误
+var errTestLocked = errors.New("database is locked")
+
+// flakyStore 在 fail 为 true 时让写入池子与读取池子列表返回 errTestLocked，并统计调用次数
+type flakyStore struct {
+	Store
+	mu    sync.Mutex
+	fail  bool
+	calls int
+}
+
+func (fs *flakyStore) setFail(fail bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.fail = fail
+}
+
+func (fs *flakyStore) attempt() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.calls++
+	if fs.fail {
+		return errTestLocked
+	}
+	return nil
+}
+
+func (fs *flakyStore) InsertPoolIfNotExists(pool poolDetail) error {
+	if err := fs.attempt(); err != nil {
+		return err
+	}
+	return fs.Store.InsertPoolIfNotExists(pool)
+}
+
+func (fs *flakyStore) ListPools(ctx context.Context, opts ListPoolsOptions) ([]poolDetail, error) {
+	if err := fs.attempt(); err != nil {
+		return nil, err
+	}
+	return fs.Store.ListPools(ctx, opts)
+}
+
+func newTestResilientStore(t *testing.T, cfg *AppConfig) (*ResilientStore, *flakyStore) {
+	t.Helper()
+	flaky := &flakyStore{Store: newTestPoolStore(t)}
+	if cfg.StoreRecoveryInterval == 0 {
+		cfg.StoreRecoveryInterval = time.Hour
+	}
+	rs := NewResilientStore(flaky, cfg)
+	t.Cleanup(rs.cancel)
+	return rs, flaky
+}
+
+// TestResilientStoreRetryHonorsContext 重试等待随 ctx 取消而中止，不再按退避睡满全部重试次数
+func TestResilientStoreRetryHonorsContext(t *testing.T) {
+	tests := []struct {
+		name      string
+		retries   int
+		cancel    bool
+		wantCalls int
+	}{
+		{name: "live context retries", retries: 2, wantCalls: 3},
+		{name: "cancelled context stops after first attempt", retries: 100, cancel: true, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, flaky := newTestResilientStore(t, &AppConfig{StoreWriteRetries: tt.retries, StoreBufferSize: 10})
+			flaky.setFail(true)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			start := time.Now()
+			if _, err := rs.ListPools(ctx, ListPoolsOptions{}); !errors.Is(err, errTestLocked) {
+				t.Fatalf("ListPools 返回 %v，期望 %v", err, errTestLocked)
+			}
+			if flaky.calls != tt.wantCalls {
+				t.Fatalf("调用存储 %d 次，期望 %d 次", flaky.calls, tt.wantCalls)
+			}
+			if elapsed := time.Since(start); tt.cancel && elapsed > time.Second {
+				t.Fatalf("ctx 已取消仍等待了 %v", elapsed)
+			}
+		})
+	}
+
+	// Start 退出后，没有调用方 ctx 的写操作同样不再等待退避
+	rs, flaky := newTestResilientStore(t, &AppConfig{StoreWriteRetries: 100, StoreBufferSize: 10})
+	flaky.setFail(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rs.Start(ctx)
+	pool := testPool(testAddr(100), testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)
+	if err := rs.InsertPoolIfNotExists(pool); !errors.Is(err, ErrBuffered) {
+		t.Fatalf("InsertPoolIfNotExists 返回 %v，期望 ErrBuffered", err)
+	}
+	if flaky.calls != 1 {
+		t.Fatalf("Start 退出后写入重试了 %d 次，期望只尝试 1 次", flaky.calls)
+	}
+}
+
+// TestResilientStoreInsertReportsBuffering 写入成功返回 nil，暂存到内存缓冲返回 ErrBuffered，缓冲区已满返回 errStoreBufferFull
+func TestResilientStoreInsertReportsBuffering(t *testing.T) {
+	tests := []struct {
+		name         string
+		fail         bool
+		bufferSize   int
+		want         error
+		wantBuffered int
+		wantDropped  int
+	}{
+		{name: "healthy store writes through", bufferSize: 10},
+		{name: "failed write is buffered", fail: true, bufferSize: 10, want: ErrBuffered, wantBuffered: 1},
+		{name: "full buffer drops the pool", fail: true, bufferSize: 0, want: errStoreBufferFull, wantDropped: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, flaky := newTestResilientStore(t, &AppConfig{StoreBufferSize: tt.bufferSize})
+			flaky.setFail(tt.fail)
+			pool := testPool(testAddr(100), testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)
+
+			err := rs.InsertPoolIfNotExists(pool)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("InsertPoolIfNotExists 返回 %v，期望 %v", err, tt.want)
+			}
+			health := rs.Health()
+			if health.BufferedPools != tt.wantBuffered || health.DroppedPools != uint64(tt.wantDropped) {
+				t.Fatalf("缓冲 %d 个、丢弃 %d 个，期望缓冲 %d 个、丢弃 %d 个",
+					health.BufferedPools, health.DroppedPools, tt.wantBuffered, tt.wantDropped)
+			}
+		})
+	}
+}
+
+// TestResilientStoreFlagsStalePools 读取池子列表失败时返回缓存并标记过期，恢复后清除标记
+func TestResilientStoreFlagsStalePools(t *testing.T) {
+	rs, flaky := newTestResilientStore(t, &AppConfig{StoreBufferSize: 10})
+	pool := testPool(testAddr(100), testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)
+	if err := rs.InsertPoolIfNotExists(pool); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name      string
+		fail      bool
+		wantPools int
+		wantStale bool
+	}{
+		{name: "fresh read", wantPools: 1},
+		{name: "failed read serves the cache", fail: true, wantPools: 1, wantStale: true},
+		{name: "recovered read clears the flag", wantPools: 1},
+	}
+	for _, step := range steps {
+		flaky.setFail(step.fail)
+		pools, err := rs.ListPools(context.Background(), ListPoolsOptions{})
+		if err != nil {
+			t.Fatalf("%s: ListPools 返回错误 %v", step.name, err)
+		}
+		health := rs.Health()
+		if len(pools) != step.wantPools || health.StalePools != step.wantStale {
+			t.Fatalf("%s: 返回 %d 个池子、stale_pools=%v，期望 %d 个、%v",
+				step.name, len(pools), health.StalePools, step.wantPools, step.wantStale)
+		}
+		if health.StalePools == health.PoolsCachedAt.IsZero() {
+			t.Fatalf("%s: pools_cached_at=%v 与 stale_pools=%v 不一致", step.name, health.PoolsCachedAt, health.StalePools)
+		}
+	}
+}
+
+// TestResilientStoreCloseFlushesBuffer Close 先写回缓冲的池子（熔断开启时同样尝试）再关闭底层存储，写回失败的池子不会阻止关闭
+func TestResilientStoreCloseFlushesBuffer(t *testing.T) {
+	tests := []struct {
+		name          string
+		pools         int
+		failOnClose   bool
+		wantOpen      bool
+		wantPersisted bool
+	}{
+		{name: "recovered store persists buffered pools", pools: 2, wantPersisted: true},
+		{name: "open breaker still flushes on close", pools: storeBreakerThreshold, wantOpen: true, wantPersisted: true},
+		{name: "store still failing keeps closing", pools: 2, failOnClose: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, flaky := newTestResilientStore(t, &AppConfig{StoreBufferSize: 10})
+			closing := &closeTrackingStore{Store: flaky}
+			rs.Store = closing
+			flaky.setFail(true)
+			for i := 0; i < tt.pools; i++ {
+				pool := testPool(testAddr(100+i), testAddr(1), testAddr(2), big.NewInt(1), big.NewInt(1), 30)
+				if err := rs.InsertPoolIfNotExists(pool); !errors.Is(err, ErrBuffered) {
+					t.Fatalf("InsertPoolIfNotExists 返回 %v，期望 ErrBuffered", err)
+				}
+			}
+			if open := !rs.Health().Healthy; open != tt.wantOpen {
+				t.Fatalf("熔断开启 %v，期望 %v", open, tt.wantOpen)
+			}
+
+			flaky.setFail(tt.failOnClose)
+			if err := rs.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !closing.closed {
+				t.Fatal("底层存储未关闭")
+			}
+			wantBuffered := 0
+			if !tt.wantPersisted {
+				wantBuffered = tt.pools
+			}
+			if got := rs.Health().BufferedPools; got != wantBuffered {
+				t.Fatalf("关闭后剩余缓冲 %d 个，期望 %d 个", got, wantBuffered)
+			}
+			for i := 0; i < tt.pools; i++ {
+				_, found, err := flaky.Store.GetPool(context.Background(), testAddr(100+i))
+				if err != nil || found != tt.wantPersisted {
+					t.Fatalf("池子 %d 落盘 %v (%v)，期望 %v", i, found, err, tt.wantPersisted)
+				}
+			}
+		})
+	}
+}
+
+// closeTrackingStore 记录 Close 调用，底层测试存储由 newTestPoolStore 的清理函数关闭
+type closeTrackingStore struct {
+	Store
+	closed bool
+}
+
+func (s *closeTrackingStore) Close() error {
+	s.closed = true
+	return nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// volumeDecayWindow 滚动成交量指数衰减的时间常数：成交速率稳定时，衰减累计值等于最近 24 小时的成交量
+	volumeDecayWindow = 24 * time.Hour
+	// volumeFlushInterval 内存中累计的成交量写回存储的周期
+	volumeFlushInterval = time.Minute
+	// volumeUnknownPoolTTL 存储中不存在的池子在该时长内不再查询：大量未收录池子的 Swap 日志不应每条都查一次数据库
+	volumeUnknownPoolTTL = 5 * time.Minute
+	// volumeUnknownPoolLimit 未知池子缓存的条目上限，超过时先清理过期条目，仍超过则整体清空
+	volumeUnknownPoolLimit = 100_000
+)
+
+// swapAmount 单笔兑换中卖入池子的一侧，Amount 为正数，Index 为池子代币下标，同时表示兑换方向
+// （两币池中 Index 为 0 即 zeroForOne）；事件只携带代币地址时（Balancer）Index 为 -1
+type swapAmount struct {
+	Index  int
+	Token  common.Address
+	Amount *big.Int
+}
+
+// swapVolume 从 Swap 事件解码出的一笔兑换，成交量只按卖入池子的一侧计
+type swapVolume struct {
+	Pool   common.Address
+	Inputs []swapAmount
+}
+
+// decodeSwapVolume 按协议 ABI 中的 Swap 事件定义解码日志，返回卖入池子的数量
+// 按参数名识别三种布局：V2 的 amount0In/amount1In、
+// V3 的有符号 amount0/amount1（以池子视角计：正数为流入池子即卖入的一侧，负数为流出池子，不计入成交量）、
+// Balancer Vault 的 tokenIn/amountIn（池子地址为 poolId 前 20 字节）；
+// ABI 中没有该事件或布局无法识别时返回 false
+func decodeSwapVolume(cfg protocolConfig, lg *types.Log) (swapVolume, bool) {
+	if cfg.ContractABI == nil || len(lg.Topics) == 0 {
+		return swapVolume{}, false
+	}
+	event, err := cfg.ContractABI.EventByID(lg.Topics[0])
+	if err != nil {
+		return swapVolume{}, false
+	}
+	values := make(map[string]any)
+	if err := event.Inputs.UnpackIntoMap(values, lg.Data); err != nil {
+		return swapVolume{}, false
+	}
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(values, indexed, lg.Topics[1:]); err != nil {
+		return swapVolume{}, false
+	}
+	amount := func(name string) *big.Int {
+		value, _ := values[name].(*big.Int)
+		return value
+	}
+
+	swap := swapVolume{Pool: lg.Address}
+	addInput := func(index int, token common.Address, value *big.Int) {
+		if value != nil && value.Sign() > 0 {
+			swap.Inputs = append(swap.Inputs, swapAmount{Index: index, Token: token, Amount: new(big.Int).Set(value)})
+		}
+	}
+	switch {
+	case amount("amount0In") != nil && amount("amount1In") != nil:
+		addInput(0, common.Address{}, amount("amount0In"))
+		addInput(1, common.Address{}, amount("amount1In"))
+	case amount("amount0") != nil && amount("amount1") != nil:
+		// 有符号数量只有正数一侧是卖入，addInput 跳过流出池子的负数
+		addInput(0, common.Address{}, amount("amount0"))
+		addInput(1, common.Address{}, amount("amount1"))
+	case amount("amountIn") != nil:
+		poolID, okID := values["poolId"].([32]byte)
+		tokenIn, okToken := values["tokenIn"].(common.Address)
+		if !okID || !okToken {
+			return swapVolume{}, false
+		}
+		swap.Pool = common.BytesToAddress(poolID[:common.AddressLength])
+		addInput(-1, tokenIn, amount("amountIn"))
+	default:
+		return swapVolume{}, false
+	}
+	return swap, len(swap.Inputs) > 0
+}
+
+// decayVolumes 将 at 时刻的成交量按 volumeDecayWindow 指数衰减到 now
+func decayVolumes(volumes []*big.Int, at, now time.Time) []*big.Int {
+	factor := 1.0
+	if elapsed := now.Sub(at); elapsed > 0 {
+		factor = math.Exp(-elapsed.Seconds() / volumeDecayWindow.Seconds())
+	}
+	decayed := make([]*big.Int, len(volumes))
+	for i, volume := range volumes {
+		if volume == nil {
+			decayed[i] = big.NewInt(0)
+			continue
+		}
+		decayed[i], _ = new(big.Float).Mul(new(big.Float).SetInt(volume), big.NewFloat(factor)).Int(nil)
+	}
+	return decayed
+}
+
+// VolumeAt 返回池子在 now 时刻各代币的滚动成交量，从未统计过成交量时返回 nil
+func (p poolDetail) VolumeAt(now time.Time) []*big.Int {
+	if p.VolumeUpdatedAt == nil {
+		return nil
+	}
+	return decayVolumes(p.Volume24h, *p.VolumeUpdatedAt, now)
+}
+
+// poolVolume 内存中单个池子的滚动成交量，dirty 表示有尚未写回存储的成交
+type poolVolume struct {
+	tokens  []common.Address
+	volumes []*big.Int
+	at      time.Time
+	dirty   bool
+}
+
+// volumeTracker 在内存中累计各池子的滚动成交量，按 volumeFlushInterval 批量写回存储，
+// 避免每条 Swap 日志都读写一次数据库；池子首次出现成交时从存储加载已有的成交量，
+// 存储中不存在的池子记入 unknown，volumeUnknownPoolTTL 内不再查询
+type volumeTracker struct {
+	mu    sync.Mutex
+	pools map[common.Address]*poolVolume
+	// unknown 存储中不存在的池子及其过期时间
+	unknown map[common.Address]time.Time
+}
+
+func newVolumeTracker() *volumeTracker {
+	return &volumeTracker{pools: make(map[common.Address]*poolVolume), unknown: make(map[common.Address]time.Time)}
+}
+
+// IsUnknown 判断池子是否在 now 时仍处于未知池子缓存中
+func (vt *volumeTracker) IsUnknown(pool common.Address, now time.Time) bool {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	expiresAt, ok := vt.unknown[pool]
+	if !ok {
+		return false
+	}
+	if !now.Before(expiresAt) {
+		delete(vt.unknown, pool)
+		return false
+	}
+	return true
+}
+
+// MarkUnknown 记录存储中不存在的池子，volumeUnknownPoolTTL 内不再查询
+func (vt *volumeTracker) MarkUnknown(pool common.Address, now time.Time) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	if len(vt.unknown) >= volumeUnknownPoolLimit {
+		for address, expiresAt := range vt.unknown {
+			if !now.Before(expiresAt) {
+				delete(vt.unknown, address)
+			}
+		}
+		if len(vt.unknown) >= volumeUnknownPoolLimit {
+			clear(vt.unknown)
+		}
+	}
+	vt.unknown[pool] = now.Add(volumeUnknownPoolTTL)
+}
+
+// ForgetUnknown 池子写入存储后移除其未知记录，之后的成交立即开始统计
+func (vt *volumeTracker) ForgetUnknown(pool common.Address) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	delete(vt.unknown, pool)
+}
+
+// Add 累计一笔兑换，池子尚未加载时返回 false，调用方应先调用 Load
+func (vt *volumeTracker) Add(swap swapVolume, now time.Time) bool {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	entry, ok := vt.pools[swap.Pool]
+	if !ok {
+		return false
+	}
+	entry.volumes = decayVolumes(entry.volumes, entry.at, now)
+	entry.at = now
+	for _, input := range swap.Inputs {
+		index := input.Index
+		if index < 0 {
+			index = indexOfAddress(entry.tokens, input.Token)
+		}
+		if index < 0 || index >= len(entry.volumes) {
+			continue
+		}
+		entry.volumes[index].Add(entry.volumes[index], input.Amount)
+		entry.dirty = true
+	}
+	return true
+}
+
+// Load 登记从存储读取的池子及其已有的成交量，已登记的池子不会被覆盖
+func (vt *volumeTracker) Load(pool poolDetail, now time.Time) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	if _, ok := vt.pools[pool.Address]; ok {
+		return
+	}
+	volumes := pool.VolumeAt(now)
+	if volumes == nil {
+		volumes = make([]*big.Int, len(pool.Tokens))
+		for i := range volumes {
+			volumes[i] = big.NewInt(0)
+		}
+	}
+	vt.pools[pool.Address] = &poolVolume{tokens: pool.Tokens, volumes: volumes, at: now}
+}
+
+// takeDirty 返回有未写回成交的池子快照并清除其标记
+func (vt *volumeTracker) takeDirty() map[common.Address]poolVolume {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	dirty := make(map[common.Address]poolVolume)
+	for address, entry := range vt.pools {
+		if !entry.dirty {
+			continue
+		}
+		volumes := make([]*big.Int, len(entry.volumes))
+		for i, volume := range entry.volumes {
+			volumes[i] = new(big.Int).Set(volume)
+		}
+		dirty[address] = poolVolume{volumes: volumes, at: entry.at}
+		entry.dirty = false
+	}
+	return dirty
+}
+
+// markDirty 写回失败时恢复标记，由下一次刷新重试
+func (vt *volumeTracker) markDirty(address common.Address) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	if entry, ok := vt.pools[address]; ok {
+		entry.dirty = true
+	}
+}
+
+func indexOfAddress(addresses []common.Address, target common.Address) int {
+	for i, address := range addresses {
+		if address == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// recordSwapVolume 解码 Swap 日志并累计到对应池子的滚动成交量，池子尚未写入存储时忽略这笔兑换
+// 存储中不存在的池子进入未知池子缓存，缓存期内的 Swap 日志不再查询存储；查询出错时不缓存
+func (pd *PoolDiscoverer) recordSwapVolume(ctx context.Context, lg *types.Log, cfg protocolConfig) {
+	swap, ok := decodeSwapVolume(cfg, lg)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if pd.volumes.Add(swap, now) || pd.volumes.IsUnknown(swap.Pool, now) {
+		return
+	}
+	pool, found, err := pd.store.GetPool(ctx, swap.Pool)
+	if err != nil {
+		return
+	}
+	if !found {
+		pd.volumes.MarkUnknown(swap.Pool, now)
+		return
+	}
+	pd.volumes.Load(pool, now)
+	pd.volumes.Add(swap, now)
+}
+
+// flushVolumes 按 volumeFlushInterval 将累计的成交量写回存储，ctx 取消时最后写回一次
+func (pd *PoolDiscoverer) flushVolumes(ctx context.Context) {
+	ticker := time.NewTicker(volumeFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			pd.writeVolumes()
+			return
+		case <-ticker.C:
+			pd.writeVolumes()
+		}
+	}
+}
+
+// writeVolumes 将有变化的成交量写回存储，失败的池子重新标记待写回
+func (pd *PoolDiscoverer) writeVolumes() {
+	dirty := pd.volumes.takeDirty()
+	failed := 0
+	for address, entry := range dirty {
+		if err := pd.store.UpdatePoolVolume(address, entry.volumes, entry.at); err != nil {
+			pd.volumes.markDirty(address)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Printf("写回 %d 个池子的成交量时 %d 个失败，下一周期重试", len(dirty), failed)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// countingStore 统计 GetPool 的调用次数
+type countingStore struct {
+	Store
+	lookups atomic.Int64
+}
+
+func (cs *countingStore) GetPool(ctx context.Context, address common.Address) (poolDetail, bool, error) {
+	cs.lookups.Add(1)
+	return cs.Store.GetPool(ctx, address)
+}
+
+// v2SwapLog 构造 V2 交易对的 Swap 事件：卖入 amount0In 个 token0，买出 amount1Out 个 token1
+func v2SwapLog(pool common.Address, amount0In, amount1Out int64) *types.Log {
+	data, err := v2PairABI.Events["Swap"].Inputs.NonIndexed().Pack(big.NewInt(amount0In), big.NewInt(0), big.NewInt(0), big.NewInt(amount1Out))
+	if err != nil {
+		panic(err)
+	}
+	return &types.Log{
+		Address: pool,
+		Topics:  []common.Hash{common.HexToHash(UniswapV2SwapTopic), common.BytesToHash(testAddr(60).Bytes()), common.BytesToHash(testAddr(61).Bytes())},
+		Data:    data,
+	}
+}
+
+// TestVolumeTrackerUnknownPools 未知池子缓存在 volumeUnknownPoolTTL 内生效，过期或写入存储后失效
+func TestVolumeTrackerUnknownPools(t *testing.T) {
+	now := time.Now()
+	pool := testAddr(100)
+	tests := []struct {
+		name   string
+		at     time.Duration
+		forget bool
+		want   bool
+	}{
+		{name: "just marked", at: 0, want: true},
+		{name: "within ttl", at: volumeUnknownPoolTTL - time.Second, want: true},
+		{name: "expired", at: volumeUnknownPoolTTL, want: false},
+		{name: "forgotten after write", at: time.Second, forget: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vt := newVolumeTracker()
+			vt.MarkUnknown(pool, now)
+			if tt.forget {
+				vt.ForgetUnknown(pool)
+			}
+			if got := vt.IsUnknown(pool, now.Add(tt.at)); got != tt.want {
+				t.Fatalf("IsUnknown = %v，期望 %v", got, tt.want)
+			}
+			if vt.IsUnknown(testAddr(101), now) {
+				t.Fatal("未标记的池子不应视为未知")
+			}
+		})
+	}
+}
+
+// TestRecordSwapVolumeNegativeCache 存储中不存在的池子只查询一次，池子写入存储后立即开始统计成交量
+func TestRecordSwapVolumeNegativeCache(t *testing.T) {
+	pd, _, store := newTestDiscoverer(t, &mockChain{}, &AppConfig{})
+	counting := &countingStore{Store: store}
+	pd.store = counting
+	cfg := protocolConfig{Name: ProtocolUniswapV2Like, ContractABI: &v2PairABI}
+	pool := testPool(testAddr(100), testAddr(1), testAddr(2), big.NewInt(1000), big.NewInt(1000), 30)
+
+	const swapIn = 1_000_000_000
+	steps := []struct {
+		name        string
+		write       bool
+		swaps       int
+		wantLookups int64
+		wantTracked bool
+	}{
+		{name: "unknown pool looked up once", swaps: 3, wantLookups: 1},
+		{name: "written pool is loaded on next swap", write: true, swaps: 2, wantLookups: 2, wantTracked: true},
+	}
+	for _, step := range steps {
+		if step.write {
+			if err := pd.writePool(pool); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < step.swaps; i++ {
+			pd.recordSwapVolume(context.Background(), v2SwapLog(pool.Address, swapIn, 9), cfg)
+		}
+		if got := counting.lookups.Load(); got != step.wantLookups {
+			t.Fatalf("%s: GetPool 调用 %d 次，期望 %d 次", step.name, got, step.wantLookups)
+		}
+		dirty := pd.volumes.takeDirty()
+		entry, tracked := dirty[pool.Address]
+		if tracked != step.wantTracked {
+			t.Fatalf("%s: 成交量已统计 %v，期望 %v", step.name, tracked, step.wantTracked)
+		}
+		// 两次累计之间按时间衰减，允许极小的误差
+		if want := int64(swapIn * step.swaps); tracked && (entry.volumes[0].Int64() > want || entry.volumes[0].Int64() < want-want/1000) {
+			t.Fatalf("%s: token0 成交量 %s，期望约 %d", step.name, entry.volumes[0], want)
+		}
+	}
+}
+
+// TestDecodeSwapVolume 按事件布局解码卖入池子的数量：V3 的有符号数量中正数一侧为卖入，决定兑换方向，负数一侧不计入
+func TestDecodeSwapVolume(t *testing.T) {
+	v3ABI := mustParseABI(UniswapV3ABIJSON)
+	v3Cfg := protocolConfig{Name: ProtocolUniswapV3, ContractABI: &v3ABI}
+	v2Cfg := protocolConfig{Name: ProtocolUniswapV2Like, ContractABI: &v2PairABI}
+	pool := testAddr(100)
+	v3SwapLog := func(amount0, amount1 *big.Int) *types.Log {
+		sqrtPrice, _ := new(big.Int).SetString("79228162514264337593543950336", 10)
+		data, err := v3ABI.Events["Swap"].Inputs.NonIndexed().Pack(amount0, amount1, sqrtPrice, big.NewInt(1e18), big.NewInt(-276324))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &types.Log{
+			Address: pool,
+			Topics:  []common.Hash{common.HexToHash(UniswapV3SwapTopic), common.BytesToHash(testAddr(60).Bytes()), common.BytesToHash(testAddr(61).Bytes())},
+			Data:    data,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		cfg       protocolConfig
+		log       *types.Log
+		wantOK    bool
+		wantIndex int
+		wantIn    *big.Int
+	}{
+		{
+			name:      "v3 token1 in, token0 out",
+			cfg:       v3Cfg,
+			log:       v3SwapLog(mustBig(t, "-1234567890123456789"), mustBig(t, "2500000000000000000000")),
+			wantOK:    true,
+			wantIndex: 1,
+			wantIn:    mustBig(t, "2500000000000000000000"),
+		},
+		{
+			name:      "v3 token0 in, token1 out",
+			cfg:       v3Cfg,
+			log:       v3SwapLog(mustBig(t, "1000000000000000000"), mustBig(t, "-1999000000000000000000")),
+			wantOK:    true,
+			wantIndex: 0,
+			wantIn:    mustBig(t, "1000000000000000000"),
+		},
+		{
+			name:   "v3 nothing sold in",
+			cfg:    v3Cfg,
+			log:    v3SwapLog(mustBig(t, "-1"), mustBig(t, "-1")),
+			wantOK: false,
+		},
+		{
+			name:      "v2 token0 in",
+			cfg:       v2Cfg,
+			log:       v2SwapLog(pool, 500, 480),
+			wantOK:    true,
+			wantIndex: 0,
+			wantIn:    big.NewInt(500),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			swap, ok := decodeSwapVolume(tt.cfg, tt.log)
+			if ok != tt.wantOK {
+				t.Fatalf("解码结果 %v，期望 %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if swap.Pool != pool || len(swap.Inputs) != 1 {
+				t.Fatalf("解码出 %+v，期望池子 %s 恰好一侧卖入", swap, pool.Hex())
+			}
+			if in := swap.Inputs[0]; in.Index != tt.wantIndex || in.Amount.Cmp(tt.wantIn) != 0 {
+				t.Fatalf("卖入代币下标 %d 数量 %s，期望下标 %d 数量 %s", in.Index, in.Amount, tt.wantIndex, tt.wantIn)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+)
+
+// testAddr 返回测试用的确定性地址，n 不同则地址不同
+func testAddr(n int) common.Address {
+	return common.BigToAddress(big.NewInt(int64(0x1000 + n)))
+}
+
+// testPool 创建两币 V2 池子，储备量按 tokens 顺序给出
+func testPool(address common.Address, token0, token1 common.Address, reserve0, reserve1 *big.Int, feeBps int) poolDetail {
+	return poolDetail{
+		Address:  address,
+		Tokens:   []common.Address{token0, token1},
+		Reserves: []*big.Int{reserve0, reserve1},
+		FeePips:  feeBpsToPips(feeBps),
+		Protocol: ProtocolUniswapV2Like,
+		Active:   true,
+	}
+}
+
+// units 返回 n × 10^decimals
+func units(n int64, decimals int) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+}
+
+// mustBig 解析十进制整数，解析失败时终止测试
+func mustBig(t *testing.T, s string) *big.Int {
+	t.Helper()
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("非法整数 %q", s)
+	}
+	return v
+}
+
+// newTestPoolStore 在临时目录创建 SQLite 存储，测试结束时关闭
+func newTestPoolStore(t *testing.T) *PoolStore {
+	t.Helper()
+	store, err := NewPoolStore(filepath.Join(t.TempDir(), "pools.db"), SQLiteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// mockChain 模拟节点的区块数据：按高度返回空区块，failures 中的高度按剩余次数返回错误
+type mockChain struct {
+	mu        sync.Mutex
+	head      uint64
+	blockTime time.Time
+	failures  map[uint64]int
+}
+
+func (c *mockChain) header(number uint64) *types.Header {
+	return &types.Header{
+		Number:      new(big.Int).SetUint64(number),
+		Time:        uint64(c.blockTime.Unix()),
+		Difficulty:  big.NewInt(0),
+		TxHash:      types.EmptyTxsHash,
+		UncleHash:   types.EmptyUncleHash,
+		ReceiptHash: types.EmptyReceiptsHash,
+		GasLimit:    30_000_000,
+	}
+}
+
+func (c *mockChain) block(number uint64) (map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures[number] > 0 {
+		c.failures[number]--
+		return nil, fmt.Errorf("block %d unavailable", number)
+	}
+	raw, err := json.Marshal(c.header(number))
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	fields["transactions"] = []interface{}{}
+	fields["uncles"] = []interface{}{}
+	return fields, nil
+}
+
+// mockChainEth 提供 eth_blockNumber、eth_getBlockByNumber 与 eth_getBlockByHash
+type mockChainEth struct {
+	chain *mockChain
+}
+
+func (s *mockChainEth) BlockNumber() hexutil.Uint64 {
+	s.chain.mu.Lock()
+	defer s.chain.mu.Unlock()
+	return hexutil.Uint64(s.chain.head)
+}
+
+func (s *mockChainEth) GetBlockByNumber(number hexutil.Uint64, full bool) (map[string]interface{}, error) {
+	return s.chain.block(uint64(number))
+}
+
+func (s *mockChainEth) GetBlockByHash(hash common.Hash, full bool) (map[string]interface{}, error) {
+	s.chain.mu.Lock()
+	head := s.chain.head
+	s.chain.mu.Unlock()
+	for number := uint64(0); number <= head; number++ {
+		if s.chain.header(number).Hash() == hash {
+			return s.chain.block(number)
+		}
+	}
+	return nil, fmt.Errorf("unknown block %s", hash.Hex())
+}
+
+// newMockChainClient 返回连接到进程内模拟节点的客户端
+func newMockChainClient(t *testing.T, chain *mockChain) *ethclient.Client {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &mockChainEth{chain: chain}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	client := ethclient.NewClient(rpc.DialInProc(server))
+	t.Cleanup(client.Close)
+	return client
+}
+
+// newTestDiscoverer 创建连接模拟节点与临时存储、没有任何协议的发现者
+func newTestDiscoverer(t *testing.T, chain *mockChain, cfg *AppConfig) (*PoolDiscoverer, *BlockQueue, *PoolStore) {
+	t.Helper()
+	if cfg.RPCConcurrency == 0 {
+		cfg.RPCConcurrency = 4
+	}
+	if cfg.MaxConcurrentBlocks == 0 {
+		cfg.MaxConcurrentBlocks = 4
+	}
+	if cfg.RPCCallTimeout == 0 {
+		cfg.RPCCallTimeout = time.Second
+	}
+	queue, err := NewBlockQueue(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newTestPoolStore(t)
+	client := newMockChainClient(t, chain)
+	tokens := NewTokenRegistry(client, store, cfg)
+	return NewPoolDiscoverer(queue, client, store, map[common.Hash]protocolConfig{}, cfg, tokens, NewPoolBlacklist()), queue, store
+}
+
+// newTestRouter 使用临时存储构建完整的 HTTP 路由，套利发现者、池子发现者与路由共用同一个拉黑集合
+func newTestRouter(t *testing.T, cfg *AppConfig) (*gin.Engine, routerDeps) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	if cfg.ArbMaxCycleMultiplier == 0 {
+		cfg.ArbMaxCycleMultiplier = 1000
+	}
+	if cfg.ArbMaxHopDeviation == 0 {
+		cfg.ArbMaxHopDeviation = 1000
+	}
+	discoverer, blocks, base := newTestDiscoverer(t, &mockChain{}, cfg)
+	store := NewResilientStore(base, cfg)
+	arbQueue := NewArbitrageQueue(64)
+	deps := routerDeps{
+		store:       store,
+		tokens:      discoverer.tokens,
+		provisional: NewProvisionalPools(),
+		refresher:   NewReserveRefresher(nil, store, cfg),
+		blacklist:   discoverer.blacklist,
+		discoverer:  discoverer,
+		finder:      NewArbitrageFinder(store, arbQueue, cfg, NewPriceOracle(cfg.WrappedNative), discoverer.tokens, discoverer.blacklist),
+		arbQueue:    arbQueue,
+		calculator:  &ArbitrageCalculator{},
+		breaker:     NewCircuitBreaker(cfg),
+		subscriber:  NewBlockSubscriber("", nil, blocks, cfg),
+	}
+	return newRouter(context.Background(), cfg, deps), deps
+}
+
+// waitFor 轮询 cond 直到返回 true，5 秒内未满足则终止测试
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待条件满足超时")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// decimalsUnknown 表示代币精度未能获取
+const decimalsUnknown = -1
+
+// taxProbeDivisor 检测转账税时从池子余额中取出的比例（1/1000），避免触发单笔转账上限
+const taxProbeDivisor = 1000
+
+// taxProbeRetryInterval 转账税检测失败（节点报错、持有者余额为零等）后再次检测前的等待时间，
+// 失败结果不会永久缓存，池子有了流动性或节点恢复后可以补测
+const taxProbeRetryInterval = 30 * time.Minute
+
+// tokenMetadata 代币元数据
+type tokenMetadata struct {
+	Address  common.Address
+	Symbol   string
+	Decimals int
+	// TaxBps 转账税，单位为基点（500 表示 5%）
+	TaxBps int
+	// TaxKnown 转账税是否已确定（来自配置或模拟转账成功）
+	TaxKnown bool
+	// ReadOnly 池子无法转出该代币（模拟转账回滚），通常是貔貅盘
+	ReadOnly bool
+}
+
+// TokenRegistry 维护代币元数据缓存，首次遇到代币时检测其精度、符号与转账税
+type TokenRegistry struct {
+	client *ethclient.Client
+	store  Store
+	cfg    *AppConfig
+	cache  sync.Map // common.Address -> tokenMetadata
+	// probeRetryAt 转账税检测失败的代币下次允许重新检测的时间
+	probeRetryAt sync.Map // common.Address -> time.Time
+}
+
+// NewTokenRegistry 创建代币元数据注册表
+func NewTokenRegistry(client *ethclient.Client, store Store, cfg *AppConfig) *TokenRegistry {
+	return &TokenRegistry{
+		client: client,
+		store:  store,
+		cfg:    cfg,
+	}
+}
+
+// Load 从存储中加载已知代币元数据到缓存
+func (tr *TokenRegistry) Load(ctx context.Context) error {
+	tokens, err := tr.store.ListTokens(ctx)
+	if err != nil {
+		return err
+	}
+	for _, meta := range tokens {
+		tr.cache.Store(meta.Address, tr.applyConfiguredTax(meta))
+	}
+	log.Printf("代币注册表加载到 %d 个代币", len(tokens))
+	return nil
+}
+
+// Get 从缓存读取代币元数据，不会发起 RPC 调用
+func (tr *TokenRegistry) Get(token common.Address) (tokenMetadata, bool) {
+	value, ok := tr.cache.Load(token)
+	if !ok {
+		return tokenMetadata{}, false
+	}
+	return value.(tokenMetadata), true
+}
+
+// TaxBps 返回代币转账税（基点），未知时返回 0
+func (tr *TokenRegistry) TaxBps(token common.Address) int {
+	meta, ok := tr.Get(token)
+	if !ok {
+		return 0
+	}
+	return meta.TaxBps
+}
+
+// Denied 判断代币是否应被排除在套利之外，并返回原因
+func (tr *TokenRegistry) Denied(token common.Address) (bool, string) {
+	// 原生 BNB 不是合约代币，没有转账税
+	if token == nativeToken {
+		return false, ""
+	}
+	meta, ok := tr.Get(token)
+	if ok && meta.ReadOnly {
+		return true, "只读代币（池子无法转出）"
+	}
+	if tr.cfg.DenyUnknownTaxTokens && (!ok || !meta.TaxKnown) {
+		return true, "转账税未知"
+	}
+	return false, ""
+}
+
+// Resolve 返回代币元数据，缓存未命中时通过链上调用检测并落库
+// holder 为持有该代币的地址（通常是发现它的池子），用于模拟转账检测转账税；
+// 转账税检测失败的代币在 taxProbeRetryInterval 之后再次遇到时重新检测
+func (tr *TokenRegistry) Resolve(ctx context.Context, token, holder common.Address) tokenMetadata {
+	meta, ok := tr.Get(token)
+	if ok && (meta.TaxKnown || !tr.probeDue(token)) {
+		return meta
+	}
+
+	if !ok {
+		meta = tr.fetchMetadata(ctx, token)
+	}
+
+	taxBps, readOnly, err := tr.probeTransferTax(ctx, token, holder)
+	if err != nil {
+		log.Printf("检测代币 %s 转账税失败，%s 后重试: %v", token.Hex(), taxProbeRetryInterval, err)
+		tr.probeRetryAt.Store(token, time.Now().Add(taxProbeRetryInterval))
+	} else {
+		tr.probeRetryAt.Delete(token)
+		meta.TaxBps = taxBps
+		meta.ReadOnly = readOnly
+		meta.TaxKnown = true
+		if taxBps > 0 || readOnly {
+			log.Printf("检测到特殊代币 %s(%s): 转账税 %d bps, 只读 %v", token.Hex(), meta.Symbol, taxBps, readOnly)
+		}
+	}
+
+	meta = tr.applyConfiguredTax(meta)
+	if err := tr.store.UpsertToken(meta); err != nil {
+		log.Printf("写入代币元数据失败 %s: %v", token.Hex(), err)
+	}
+	tr.cache.Store(token, meta)
+	return meta
+}
+
+// Register 只读取并登记代币的精度与符号，不检测转账税，已登记的代币直接返回缓存
+// 用于刚创建、尚无流动性的池子：此时模拟转账必然失败，转账税留到池子有储备量后由 Resolve 检测
+func (tr *TokenRegistry) Register(ctx context.Context, token common.Address) tokenMetadata {
+	if meta, ok := tr.Get(token); ok {
+		return meta
+	}
+	meta := tr.applyConfiguredTax(tr.fetchMetadata(ctx, token))
+	if err := tr.store.UpsertToken(meta); err != nil {
+		log.Printf("写入代币元数据失败 %s: %v", token.Hex(), err)
+	}
+	tr.cache.Store(token, meta)
+	return meta
+}
+
+// fetchMetadata 通过链上调用读取代币的精度与符号，调用失败的字段保持未知
+func (tr *TokenRegistry) fetchMetadata(ctx context.Context, token common.Address) tokenMetadata {
+	meta := tokenMetadata{Address: token, Decimals: decimalsUnknown}
+	if decimals, err := CallERC20Decimals(ctx, tr.client, token, tr.cfg.RPCCallTimeout); err == nil {
+		meta.Decimals = int(decimals)
+	}
+	if symbol, err := CallERC20Symbol(ctx, tr.client, token, tr.cfg.RPCCallTimeout); err == nil {
+		meta.Symbol = symbol
+	}
+	return meta
+}
+
+// probeDue 转账税未知的代币是否到了可以重新检测的时间；本次运行中尚未检测过的代币（例如从存储加载的）立即可测
+func (tr *TokenRegistry) probeDue(token common.Address) bool {
+	value, ok := tr.probeRetryAt.Load(token)
+	return !ok || !time.Now().Before(value.(time.Time))
+}
+
+// applyConfiguredTax 配置中登记的转账税优先于检测结果
+func (tr *TokenRegistry) applyConfiguredTax(meta tokenMetadata) tokenMetadata {
+	if bps, ok := tr.cfg.TokenTaxBps[meta.Address]; ok {
+		meta.TaxBps = bps
+		meta.TaxKnown = true
+	}
+	return meta
+}
+
+// simulateCall eth_simulateV1 的单笔调用
+type simulateCall struct {
+	From *common.Address `json:"from,omitempty"`
+	To   common.Address  `json:"to"`
+	Data hexutil.Bytes   `json:"data"`
+}
+
+// simulateAccountOverride eth_simulateV1 / eth_call 的账户状态覆盖
+type simulateAccountOverride struct {
+	StateDiff map[common.Hash]common.Hash `json:"stateDiff,omitempty"`
+}
+
+type simulateBlock struct {
+	StateOverrides map[common.Address]simulateAccountOverride `json:"stateOverrides,omitempty"`
+	Calls          []simulateCall                             `json:"calls"`
+}
+
+type simulateOpts struct {
+	BlockStateCalls []simulateBlock `json:"blockStateCalls"`
+	Validation      bool            `json:"validation"`
+}
+
+type simulateCallResult struct {
+	ReturnData hexutil.Bytes  `json:"returnData"`
+	Status     hexutil.Uint64 `json:"status"`
+	Error      *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type simulateBlockResult struct {
+	Calls []simulateCallResult `json:"calls"`
+}
+
+// probeTransferTax 通过 eth_simulateV1 在同一个模拟区块内模拟一买一卖，按余额差计算转账税：
+// 买入为 holder（池子）转出少量代币给探测地址，卖出为探测地址把实际到账的数量转回 holder，
+// 两个方向都以转账前后收款方余额之差作为到账数量，不依赖收款方原有余额；返回买卖两个方向中较高的税率
+// 任一方向转账回滚时视为只读代币（买得进卖不出的貔貅盘）；节点不支持 eth_simulateV1 或 holder 无余额时返回错误
+func (tr *TokenRegistry) probeTransferTax(ctx context.Context, token, holder common.Address) (int, bool, error) {
+	balance, err := CallERC20BalanceOf(ctx, tr.client, token, holder, tr.cfg.RPCCallTimeout)
+	if err != nil {
+		return 0, false, err
+	}
+	amount := new(big.Int).Div(balance, big.NewInt(taxProbeDivisor))
+	if amount.Sign() <= 0 {
+		return 0, false, fmt.Errorf("持有者 %s 余额不足以模拟转账", holder.Hex())
+	}
+
+	recipient := common.HexToAddress(TaxProbeRecipientHex)
+	buy, err := tr.simulateTransfer(ctx, token, holder, recipient, amount)
+	if err != nil {
+		return 0, false, fmt.Errorf("模拟买入: %w", err)
+	}
+	if buy.reverted {
+		return 0, true, nil
+	}
+	if buy.received.Sign() <= 0 {
+		return taxBpsOf(amount, buy.received), false, nil
+	}
+
+	// 卖出在买入之后的状态上执行：先重放买入，再把到账数量转回池子
+	sell, err := tr.simulateTransfer(ctx, token, recipient, holder, buy.received, simulateCall{From: &holder, To: token, Data: buy.transferData})
+	if err != nil {
+		return 0, false, fmt.Errorf("模拟卖出: %w", err)
+	}
+	if sell.reverted {
+		return 0, true, nil
+	}
+	return max(taxBpsOf(amount, buy.received), taxBpsOf(buy.received, sell.received)), false, nil
+}
+
+// simulatedTransfer 一次模拟转账的结果
+type simulatedTransfer struct {
+	// transferData 本次转账的 calldata，供后续模拟重放
+	transferData []byte
+	// received 收款方余额增加量
+	received *big.Int
+	// reverted 转账是否回滚
+	reverted bool
+}
+
+// simulateTransfer 在 before 调用之后的状态上模拟 from 向 to 转账 amount，返回收款方转账前后的余额差
+func (tr *TokenRegistry) simulateTransfer(ctx context.Context, token, from, to common.Address, amount *big.Int, before ...simulateCall) (simulatedTransfer, error) {
+	transferData, err := erc20ABI.Pack("transfer", to, amount)
+	if err != nil {
+		return simulatedTransfer{}, err
+	}
+	balanceData, err := erc20ABI.Pack("balanceOf", to)
+	if err != nil {
+		return simulatedTransfer{}, err
+	}
+
+	calls := append(append([]simulateCall{}, before...),
+		simulateCall{To: token, Data: balanceData},
+		simulateCall{From: &from, To: token, Data: transferData},
+		simulateCall{To: token, Data: balanceData},
+	)
+	opts := simulateOpts{BlockStateCalls: []simulateBlock{{Calls: calls}}}
+	callCtx, cancel := withRPCTimeout(ctx, tr.cfg.RPCCallTimeout)
+	defer cancel()
+	var result []simulateBlockResult
+	if err := tr.client.Client().CallContext(callCtx, &result, "eth_simulateV1", opts, "latest"); err != nil {
+		return simulatedTransfer{}, fmt.Errorf("eth_simulateV1 调用失败: %w", err)
+	}
+	if len(result) != 1 || len(result[0].Calls) != len(calls) {
+		return simulatedTransfer{}, fmt.Errorf("eth_simulateV1 返回结构异常")
+	}
+
+	results := result[0].Calls[len(before):]
+	for _, r := range result[0].Calls[:len(before)] {
+		if r.Status == 0 {
+			return simulatedTransfer{}, fmt.Errorf("模拟前置调用失败")
+		}
+	}
+	if results[1].Status == 0 {
+		return simulatedTransfer{transferData: transferData, reverted: true}, nil
+	}
+	balanceBefore, err := decodeSimulatedBalance(results[0])
+	if err != nil {
+		return simulatedTransfer{}, err
+	}
+	balanceAfter, err := decodeSimulatedBalance(results[2])
+	if err != nil {
+		return simulatedTransfer{}, err
+	}
+	received := new(big.Int).Sub(balanceAfter, balanceBefore)
+	if received.Sign() < 0 {
+		received.SetInt64(0)
+	}
+	return simulatedTransfer{transferData: transferData, received: received}, nil
+}
+
+// decodeSimulatedBalance 解析模拟 balanceOf 调用的返回值
+func decodeSimulatedBalance(result simulateCallResult) (*big.Int, error) {
+	if result.Status == 0 {
+		return nil, fmt.Errorf("模拟 balanceOf 失败")
+	}
+	values, err := erc20ABI.Unpack("balanceOf", result.ReturnData)
+	if err != nil || len(values) != 1 {
+		return nil, fmt.Errorf("解析模拟 balanceOf 结果失败: %v", err)
+	}
+	balance, ok := values[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("unexpected balanceOf return type %T", values[0])
+	}
+	return balance, nil
+}
+
+// taxBpsOf 按发送量与到账量计算转账税（基点），到账不少于发送量时为 0
+func taxBpsOf(sent, received *big.Int) int {
+	if received.Cmp(sent) >= 0 {
+		return 0
+	}
+	lost := new(big.Int).Sub(sent, received)
+	return int(new(big.Int).Div(new(big.Int).Mul(lost, big.NewInt(bpsDenominator)), sent).Int64())
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// mockTaxToken 模拟带买卖转账税的 ERC20：从 pool 转出按 buyBps 扣税，转入 pool 按 sellBps 扣税
+type mockTaxToken struct {
+	pool       common.Address
+	balances   map[common.Address]*big.Int
+	buyBps     int64
+	sellBps    int64
+	revertBuy  bool
+	revertSell bool
+	// simulateErr 非空时 eth_simulateV1 直接返回该错误
+	simulateErr error
+	simulations int
+}
+
+// mockTokenEth 提供 eth_call 与 eth_simulateV1 的 eth 命名空间
+type mockTokenEth struct {
+	token *mockTaxToken
+}
+
+type mockCallArgs struct {
+	From  *common.Address `json:"from"`
+	To    *common.Address `json:"to"`
+	Input hexutil.Bytes   `json:"input"`
+	Data  hexutil.Bytes   `json:"data"`
+}
+
+// calldata ethclient 以 input 字段发送调用数据，直接构造的调用使用 data 字段
+func (a mockCallArgs) calldata() []byte {
+	if len(a.Input) > 0 {
+		return a.Input
+	}
+	return a.Data
+}
+
+func (s *mockTokenEth) Call(args mockCallArgs, block string) (hexutil.Bytes, error) {
+	return s.token.balanceOfCall(s.token.balances, args.calldata())
+}
+
+func (s *mockTokenEth) SimulateV1(opts simulateOpts, block string) ([]simulateBlockResult, error) {
+	s.token.simulations++
+	if s.token.simulateErr != nil {
+		return nil, s.token.simulateErr
+	}
+	state := make(map[common.Address]*big.Int, len(s.token.balances))
+	for k, v := range s.token.balances {
+		state[k] = new(big.Int).Set(v)
+	}
+	var results []simulateCallResult
+	for _, call := range opts.BlockStateCalls[0].Calls {
+		method, err := erc20ABI.MethodById(call.Data[:4])
+		if err != nil {
+			return nil, err
+		}
+		switch method.Name {
+		case "balanceOf":
+			out, err := s.token.balanceOfCall(state, call.Data)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, simulateCallResult{ReturnData: out, Status: 1})
+		case "transfer":
+			args, err := method.Inputs.Unpack(call.Data[4:])
+			if err != nil {
+				return nil, err
+			}
+			ok := s.token.transfer(state, *call.From, args[0].(common.Address), args[1].(*big.Int))
+			status := hexutil.Uint64(0)
+			if ok {
+				status = 1
+			}
+			results = append(results, simulateCallResult{Status: status})
+		}
+	}
+	return []simulateBlockResult{{Calls: results}}, nil
+}
+
+func (tok *mockTaxToken) balanceOfCall(state map[common.Address]*big.Int, data []byte) (hexutil.Bytes, error) {
+	args, err := erc20ABI.Methods["balanceOf"].Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, err
+	}
+	balance := state[args[0].(common.Address)]
+	if balance == nil {
+		balance = new(big.Int)
+	}
+	return erc20ABI.Methods["balanceOf"].Outputs.Pack(balance)
+}
+
+func (tok *mockTaxToken) transfer(state map[common.Address]*big.Int, from, to common.Address, amount *big.Int) bool {
+	taxBps := int64(0)
+	switch {
+	case from == tok.pool && tok.revertBuy, to == tok.pool && tok.revertSell:
+		return false
+	case from == tok.pool:
+		taxBps = tok.buyBps
+	case to == tok.pool:
+		taxBps = tok.sellBps
+	}
+	if state[from] == nil || state[from].Cmp(amount) < 0 {
+		return false
+	}
+	received := new(big.Int).Div(new(big.Int).Mul(amount, big.NewInt(10000-taxBps)), big.NewInt(10000))
+	state[from] = new(big.Int).Sub(state[from], amount)
+	if state[to] == nil {
+		state[to] = new(big.Int)
+	}
+	state[to] = new(big.Int).Add(state[to], received)
+	return true
+}
+
+// newMockTokenRegistry 返回连接到进程内模拟节点的代币注册表
+func newMockTokenRegistry(t *testing.T, token *mockTaxToken) *TokenRegistry {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &mockTokenEth{token: token}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	client := ethclient.NewClient(rpc.DialInProc(server))
+	t.Cleanup(client.Close)
+	return NewTokenRegistry(client, nil, &AppConfig{RPCCallTimeout: time.Second})
+}
+
+func TestProbeTransferTax(t *testing.T) {
+	pool := testAddr(1)
+	recipient := common.HexToAddress(TaxProbeRecipientHex)
+	tests := []struct {
+		name         string
+		token        mockTaxToken
+		wantBps      int
+		wantReadOnly bool
+	}{
+		{name: "no tax", wantBps: 0},
+		{name: "buy tax", token: mockTaxToken{buyBps: 500}, wantBps: 500},
+		{name: "sell tax only", token: mockTaxToken{sellBps: 1000}, wantBps: 1000},
+		{name: "higher of buy and sell", token: mockTaxToken{buyBps: 300, sellBps: 800}, wantBps: 800},
+		{name: "buy reverts", token: mockTaxToken{revertBuy: true}, wantReadOnly: true},
+		{name: "honeypot sell reverts", token: mockTaxToken{buyBps: 100, revertSell: true}, wantReadOnly: true},
+		{
+			// 探测地址原本就有余额时按余额差计算，不能把原有余额算作到账
+			name:    "recipient with prior balance",
+			token:   mockTaxToken{buyBps: 500, balances: map[common.Address]*big.Int{recipient: units(7, 18)}},
+			wantBps: 500,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			token.pool = pool
+			if token.balances == nil {
+				token.balances = map[common.Address]*big.Int{}
+			}
+			token.balances[pool] = units(1000, 18)
+			tr := newMockTokenRegistry(t, &token)
+
+			bps, readOnly, err := tr.probeTransferTax(context.Background(), testAddr(2), pool)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bps != tt.wantBps || readOnly != tt.wantReadOnly {
+				t.Fatalf("转账税 %d bps、只读 %v，期望 %d bps、只读 %v", bps, readOnly, tt.wantBps, tt.wantReadOnly)
+			}
+		})
+	}
+}
+
+// TestResolveRetriesFailedTaxProbe 检测失败的结果只在 taxProbeRetryInterval 内有效，过期后重新检测
+func TestResolveRetriesFailedTaxProbe(t *testing.T) {
+	pool, tokenAddr := testAddr(1), testAddr(2)
+	token := &mockTaxToken{pool: pool, balances: map[common.Address]*big.Int{pool: units(1000, 18)}, buyBps: 200, simulateErr: errors.New("method not supported")}
+	tr := newMockTokenRegistry(t, token)
+	tr.store = newTestPoolStore(t)
+
+	if meta := tr.Resolve(context.Background(), tokenAddr, pool); meta.TaxKnown {
+		t.Fatal("检测失败时不应标记转账税已知")
+	}
+	token.simulateErr = nil
+	if meta := tr.Resolve(context.Background(), tokenAddr, pool); meta.TaxKnown || token.simulations != 1 {
+		t.Fatalf("重试间隔内不应再次检测，检测次数 %d", token.simulations)
+	}
+
+	// 模拟重试时间已到
+	tr.probeRetryAt.Store(tokenAddr, time.Now().Add(-time.Second))
+	meta := tr.Resolve(context.Background(), tokenAddr, pool)
+	if !meta.TaxKnown || meta.TaxBps != 200 {
+		t.Fatalf("重试后转账税 %d bps (known=%v)，期望 200 bps", meta.TaxBps, meta.TaxKnown)
+	}
+}
+
+// TestRegisterDefersTaxProbe 登记代币只读取元数据，不发起转账税检测；之后的 Resolve 再检测
+func TestRegisterDefersTaxProbe(t *testing.T) {
+	pool, tokenAddr := testAddr(1), testAddr(2)
+	token := &mockTaxToken{pool: pool, balances: map[common.Address]*big.Int{pool: units(1000, 18)}, buyBps: 200}
+	tr := newMockTokenRegistry(t, token)
+	tr.store = newTestPoolStore(t)
+
+	if meta := tr.Register(context.Background(), tokenAddr); meta.TaxKnown || token.simulations != 0 {
+		t.Fatalf("登记时不应检测转账税，检测次数 %d (known=%v)", token.simulations, meta.TaxKnown)
+	}
+	meta := tr.Resolve(context.Background(), tokenAddr, pool)
+	if !meta.TaxKnown || meta.TaxBps != 200 || token.simulations != 2 {
+		t.Fatalf("Resolve 后转账税 %d bps (known=%v)，模拟次数 %d，期望买入、卖出各模拟一次得到 200 bps", meta.TaxBps, meta.TaxKnown, token.simulations)
+	}
+}
@@ -2,16 +2,67 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"math/big"
+	"net"
+	"net/http"
 	"strings"
+	"time"
 
+	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// erc20ABI 解析后的 ERC20 ABI；余额、元数据与授权查询按池子、按代币频繁调用，只在启动时解析一次，各处共用只读实例
+var erc20ABI = mustParseABI(ERC20ABIJSON)
+
+// v2PairABI 解析后的 V2 交易对 ABI，用于在批量请求中打包 getReserves
+var v2PairABI = mustParseABI(PairABIJSON)
+
+// mustParseABI 解析编译期确定的 ABI 常量，格式错误属于代码缺陷，直接 panic
+func mustParseABI(abiJSON string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		panic(fmt.Sprintf("解析 ABI 失败: %v", err))
+	}
+	return parsed
+}
+
+// formatUnits 将最小单位的整数数量按精度格式化为十进制字符串，例如 12000000000000000000 与 18 位精度得到 "12.0"
+// 使用整数运算，不丢失精度；小数部分去掉末尾的 0 但至少保留一位。精度未知（小于 0）时原样返回整数并返回 false
+func formatUnits(raw *big.Int, decimals int) (string, bool) {
+	if raw == nil {
+		raw = new(big.Int)
+	}
+	if decimals < 0 {
+		return raw.String(), false
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	abs := new(big.Int).Abs(raw)
+	whole, frac := new(big.Int).QuoRem(abs, unit, new(big.Int))
+
+	fraction := "0"
+	if decimals > 0 {
+		fraction = strings.TrimRight(fmt.Sprintf("%0*s", decimals, frac.String()), "0")
+		if fraction == "" {
+			fraction = "0"
+		}
+	}
+	text := whole.String() + "." + fraction
+	if raw.Sign() < 0 {
+		text = "-" + text
+	}
+	return text, true
+}
+
 // HexToUint64 将十六进制字符串转换为 uint64
 // 参数 hexStr 必须是 "0x" 开头的十六进制字符串
 // 返回转换后的 uint64 值
@@ -36,12 +87,115 @@ func HexToBigInt(hexStr string) (*big.Int, error) {
 	return number, nil
 }
 
+// normalizeAddress 将任意大小写、可省略 0x 前缀的地址字符串转换为 EIP-55 校验和格式
+// 存储主键、套利路径去重键与 JSON 输出中的地址都使用该格式（即 common.Address.Hex()），保证同一地址只有一种字符串表示
+// 返回 false 表示不是合法的 20 字节十六进制地址
+func normalizeAddress(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if !common.IsHexAddress(raw) {
+		return "", false
+	}
+	return common.HexToAddress(raw).Hex(), true
+}
+
+// withRPCTimeout 为单次 RPC 调用派生带超时的上下文，避免个别请求挂起时占住处理协程
+// timeout <= 0 时不额外设置超时，仅继承父上下文
+func withRPCTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// RetryPolicy RPC 调用的重试策略
+type RetryPolicy struct {
+	// MaxAttempts 最多尝试次数（包括第一次），<= 1 时不重试
+	MaxAttempts int
+	// MinDelay、MaxDelay 两次尝试之间退避等待的初始值与上限，等待时间按 backoff 翻倍并带抖动
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// Retryable 判断错误是否值得重试，为 nil 时使用 isRetryableRPCError
+	Retryable func(error) bool
+}
+
+// rpcRetryPolicy 合约调用、回执与区块获取共用的重试策略：限流、超时与连接错误最多再试两次
+var rpcRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinDelay:    200 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+// retryDo 执行 fn，返回可重试的错误时按 policy 退避后重试；成功、错误不可重试、次数用尽或 ctx 结束时返回最后一次的结果
+// 每次尝试的超时由 fn 自行设置（通常在 fn 内调用 withRPCTimeout），单次超时不会耗尽整体预算
+func retryDo(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = isRetryableRPCError
+	}
+	b := newBackoff(policy.MinDelay, policy.MaxDelay)
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		if sleepContext(ctx, b.Next()) != nil {
+			return err
+		}
+	}
+}
+
+// isRetryableRPCError 判断 RPC 错误是否为瞬时错误：限流、超时与连接中断可以重试；
+// 合约执行回滚、合约不存在、解码失败、记录不存在等重试也不会改变结果的错误以及调用方主动取消不重试
+func isRetryableRPCError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ethereum.NotFound) || errors.Is(err, bind.ErrNoCode) {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	// eth_call 回滚时节点返回的错误文案都以 execution reverted 开头
+	for _, keyword := range []string{"execution reverted", "invalid opcode", "out of gas", "abi:", "no contract code"} {
+		if strings.Contains(message, keyword) {
+			return false
+		}
+	}
+
+	switch classifyReceiptError(err) {
+	case receiptErrTimeout, receiptErrRateLimited:
+		return true
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	for _, keyword := range []string{"connection refused", "connection reset", "broken pipe", "eof", "no such host", "bad gateway", "service unavailable"} {
+		if strings.Contains(message, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// callContract 调用合约的只读方法，每次尝试单独设置 timeout 超时，瞬时错误按 rpcRetryPolicy 重试
+func callContract(ctx context.Context, contract *bind.BoundContract, timeout time.Duration, method string, args ...interface{}) ([]interface{}, error) {
+	var raw []interface{}
+	err := retryDo(ctx, rpcRetryPolicy, func(ctx context.Context) error {
+		callCtx, cancel := withRPCTimeout(ctx, timeout)
+		defer cancel()
+		raw = nil
+		return contract.Call(&bind.CallOpts{Context: callCtx}, &raw, method, args...)
+	})
+	return raw, err
+}
+
 // CallTokenAddress 调用合约的 token0 或 token1 方法，获取代币地址
-// 参数 ctx 是上下文，contract 是绑定的合约实例，method 是方法名（"token0" 或 "token1"）
+// 参数 ctx 是上下文，contract 是绑定的合约实例，method 是方法名（"token0" 或 "token1"），timeout 是单次调用超时
 // 返回代币地址，如果调用失败则返回错误
-func CallTokenAddress(ctx context.Context, contract *bind.BoundContract, method string) (common.Address, error) {
-	var raw []interface{}
-	if err := contract.Call(&bind.CallOpts{Context: ctx}, &raw, method); err != nil {
+func CallTokenAddress(ctx context.Context, contract *bind.BoundContract, method string, timeout time.Duration) (common.Address, error) {
+	raw, err := callContract(ctx, contract, timeout, method)
+	if err != nil {
 		return common.Address{}, err
 	}
 	if len(raw) != 1 {
@@ -61,12 +215,11 @@ func CallTokenAddress(ctx context.Context, contract *bind.BoundContract, method
 }
 
 // CallPoolFee 调用合约的 fee 方法，获取池子费率
-// 参数 ctx 是上下文，contract 是绑定的合约实例
-// 返回费率百分比（例如 0.3 表示 0.3%），如果调用失败则返回错误
-// 注意：Uniswap V3 的 fee 返回单位为 1e-6，需要除以 1e4 转换为百分比
-func CallPoolFee(ctx context.Context, contract *bind.BoundContract) (float64, error) {
-	var raw []interface{}
-	if err := contract.Call(&bind.CallOpts{Context: ctx}, &raw, "fee"); err != nil {
+// 参数 ctx 是上下文，contract 是绑定的合约实例，timeout 是单次调用超时
+// 返回 1e-6 单位的费率（例如 3000 表示 0.3%），与 Uniswap V3 的 fee 返回值一致，不做取整，如果调用失败则返回错误
+func CallPoolFee(ctx context.Context, contract *bind.BoundContract, timeout time.Duration) (int, error) {
+	raw, err := callContract(ctx, contract, timeout, "fee")
+	if err != nil {
 		return 0, err
 	}
 	if len(raw) != 1 {
@@ -89,17 +242,68 @@ func CallPoolFee(ctx context.Context, contract *bind.BoundContract) (float64, er
 		return 0, fmt.Errorf("unexpected fee return type %T", raw[0])
 	}
 
-	// Uniswap V3 fee 返回单位为 1e-6，换算为百分比需除以 1e4
-	return float64(feeValue) / 1e4, nil
+	if feeValue >= pipsDenominator {
+		return 0, fmt.Errorf("fee %d 超出范围", feeValue)
+	}
+	return int(feeValue), nil
+}
+
+// algebraGlobalStateABI 解析后的 Algebra globalState ABI
+var algebraGlobalStateABI = mustParseABI(AlgebraGlobalStateABIJSON)
+
+// algebraDirectionalStateWords Algebra v1.9（Thena 等）globalState 的返回值字数：
+// price、tick、feeZto、feeOtz、timepointIndex、communityFeeToken0、communityFeeToken1、unlocked；
+// v1 返回 7 个字（第四个是 timepointIndex），Integral 返回 6 个字，两者只有一个两个方向共用的费率
+const algebraDirectionalStateWords = 8
+
+// CallGlobalStateFee 调用 Algebra 池子的 globalState 方法，读取当前的动态费率
+// 参数 ctx 是上下文，contract 是绑定到池子地址的合约实例（只使用其地址与客户端），timeout 是单次调用超时
+// 返回 1e-6 单位的 token0→token1 与 token1→token0 方向费率（与 Uniswap V3 单位相同）；
+// 按返回值字数区分版本，只有 v1.9 按方向收费，其余版本两个方向返回同一个值，调用失败或费率越界时返回错误
+func CallGlobalStateFee(ctx context.Context, contract *bind.BoundContract, timeout time.Duration) (int, int, error) {
+	input, err := algebraGlobalStateABI.Pack("globalState")
+	if err != nil {
+		return 0, 0, err
+	}
+	var raw []byte
+	err = retryDo(ctx, rpcRetryPolicy, func(ctx context.Context) error {
+		callCtx, cancel := withRPCTimeout(ctx, timeout)
+		defer cancel()
+		raw, err = contract.CallRaw(&bind.CallOpts{Context: callCtx}, input)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	values, err := algebraGlobalStateABI.Unpack("globalState", raw)
+	if err != nil {
+		return 0, 0, fmt.Errorf("解析 globalState 返回值失败: %w", err)
+	}
+	fee, ok := values[2].(uint16)
+	if !ok {
+		return 0, 0, fmt.Errorf("unexpected globalState fee type %T", values[2])
+	}
+	zeroForOne, oneForZero := int(fee), int(fee)
+	if len(raw) == algebraDirectionalStateWords*32 {
+		reverse := new(big.Int).SetBytes(raw[3*32 : 4*32])
+		if !reverse.IsInt64() || reverse.Int64() > math.MaxUint16 {
+			return 0, 0, fmt.Errorf("globalState feeOtz %s 超出 uint16", reverse)
+		}
+		oneForZero = int(reverse.Int64())
+	}
+	if zeroForOne >= pipsDenominator || oneForZero >= pipsDenominator {
+		return 0, 0, fmt.Errorf("globalState 费率 %d/%d 超出范围", zeroForOne, oneForZero)
+	}
+	return zeroForOne, oneForZero, nil
 }
 
 // CallGetReserves 调用合约的 getReserves 方法，获取池子储备量
-// 参数 ctx 是上下文，contract 是绑定的合约实例
+// 参数 ctx 是上下文，contract 是绑定的合约实例，timeout 是单次调用超时
 // 返回 reserve0、reserve1 和 blockTimestampLast，如果调用失败则返回错误
 // 注意：此方法适用于 Uniswap V2 及类似协议的 Pair 合约
-func CallGetReserves(ctx context.Context, contract *bind.BoundContract) (*big.Int, *big.Int, error) {
-	var raw []interface{}
-	if err := contract.Call(&bind.CallOpts{Context: ctx}, &raw, "getReserves"); err != nil {
+func CallGetReserves(ctx context.Context, contract *bind.BoundContract, timeout time.Duration) (*big.Int, *big.Int, error) {
+	raw, err := callContract(ctx, contract, timeout, "getReserves")
+	if err != nil {
 		return nil, nil, err
 	}
 	if len(raw) != 3 {
@@ -133,21 +337,14 @@ func CallGetReserves(ctx context.Context, contract *bind.BoundContract) (*big.In
 }
 
 // CallERC20BalanceOf 调用 ERC20 合约的 balanceOf 方法，获取指定地址的代币余额
-// 参数 ctx 是上下文，client 是以太坊客户端，tokenAddr 是代币合约地址，ownerAddr 是持有者地址
+// 参数 ctx 是上下文，client 是以太坊客户端，tokenAddr 是代币合约地址，ownerAddr 是持有者地址，timeout 是单次调用超时
 // 返回代币余额（*big.Int），如果调用失败则返回错误
-func CallERC20BalanceOf(ctx context.Context, client *ethclient.Client, tokenAddr, ownerAddr common.Address) (*big.Int, error) {
-	// 解析 ERC20 ABI
-	erc20ABI, err := abi.JSON(strings.NewReader(ERC20ABIJSON))
-	if err != nil {
-		return nil, fmt.Errorf("解析 ERC20 ABI 失败: %w", err)
-	}
-
-	// 使用 bind.NewBoundContract 绑定合约
+func CallERC20BalanceOf(ctx context.Context, client *ethclient.Client, tokenAddr, ownerAddr common.Address, timeout time.Duration) (*big.Int, error) {
 	contract := bind.NewBoundContract(tokenAddr, erc20ABI, client, client, client)
 
 	// 调用 balanceOf 方法
-	var raw []interface{}
-	if err := contract.Call(&bind.CallOpts{Context: ctx}, &raw, "balanceOf", ownerAddr); err != nil {
+	raw, err := callContract(ctx, contract, timeout, "balanceOf", ownerAddr)
+	if err != nil {
 		return nil, fmt.Errorf("调用 balanceOf 失败: %w", err)
 	}
 
@@ -170,3 +367,290 @@ func CallERC20BalanceOf(ctx context.Context, client *ethclient.Client, tokenAddr
 
 	return balance, nil
 }
+
+// BalanceQuery 批量查询余额时的单个请求：owner 持有的 token 余额
+type BalanceQuery struct {
+	Token common.Address
+	Owner common.Address
+}
+
+// BatchBalanceOf 通过 JSON-RPC 批量请求一次性查询多个 balanceOf，减少逐个调用的往返开销
+// 参数 ctx 是上下文，client 是以太坊客户端，queries 是查询列表，timeout 是整批请求的超时
+// 返回与 queries 一一对应的余额和错误列表，单个查询失败只体现在对应的错误中；整批请求失败时返回 error
+func BatchBalanceOf(ctx context.Context, client *ethclient.Client, queries []BalanceQuery, timeout time.Duration) ([]*big.Int, []error, error) {
+	return BatchBalanceOfAt(ctx, client, queries, nil, timeout)
+}
+
+// BatchBalanceOfAt 与 BatchBalanceOf 相同，但在指定区块的状态上查询；block 为 nil 时查询最新区块
+func BatchBalanceOfAt(ctx context.Context, client *ethclient.Client, queries []BalanceQuery, block *big.Int, timeout time.Duration) ([]*big.Int, []error, error) {
+	if len(queries) == 0 {
+		return nil, nil, nil
+	}
+
+	calls := make([]batchCall, len(queries))
+	for i, query := range queries {
+		data, err := erc20ABI.Pack("balanceOf", query.Owner)
+		if err != nil {
+			return nil, nil, err
+		}
+		calls[i] = batchCall{To: query.Token, Data: data}
+	}
+	results, callErrs, err := batchCallAt(ctx, client, calls, block, timeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("批量调用 balanceOf 失败: %w", err)
+	}
+
+	balances := make([]*big.Int, len(queries))
+	errs := make([]error, len(queries))
+	for i := range queries {
+		balances[i], errs[i] = unpackBalance(results[i], callErrs[i])
+	}
+	return balances, errs, nil
+}
+
+// unpackBalance 解析单个 balanceOf 调用的返回数据
+func unpackBalance(result hexutil.Bytes, callErr error) (*big.Int, error) {
+	if callErr != nil {
+		return nil, fmt.Errorf("调用 balanceOf 失败: %w", callErr)
+	}
+	values, err := erc20ABI.Unpack("balanceOf", result)
+	if err != nil || len(values) != 1 {
+		return nil, fmt.Errorf("解析 balanceOf 结果失败: %v", err)
+	}
+	balance, ok := values[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("unexpected balanceOf return type %T", values[0])
+	}
+	return balance, nil
+}
+
+// unpackReserves 解析单个 getReserves 调用的返回数据
+func unpackReserves(result hexutil.Bytes, callErr error) (*big.Int, *big.Int, error) {
+	if callErr != nil {
+		return nil, nil, fmt.Errorf("调用 getReserves 失败: %w", callErr)
+	}
+	values, err := v2PairABI.Unpack("getReserves", result)
+	if err != nil || len(values) != 3 {
+		return nil, nil, fmt.Errorf("解析 getReserves 结果失败: %v", err)
+	}
+	reserve0, ok0 := values[0].(*big.Int)
+	reserve1, ok1 := values[1].(*big.Int)
+	if !ok0 || !ok1 {
+		return nil, nil, fmt.Errorf("unexpected getReserves return types %T, %T", values[0], values[1])
+	}
+	return reserve0, reserve1, nil
+}
+
+// batchCall 批量 eth_call 中的单个调用
+type batchCall struct {
+	To   common.Address
+	Data []byte
+}
+
+// batchCallAt 在同一个区块的状态上通过一次 JSON-RPC 批量请求执行多个 eth_call，block 为 nil 时使用 latest
+// 返回与 calls 一一对应的返回数据和错误列表；整批请求失败时返回 error
+func batchCallAt(ctx context.Context, client *ethclient.Client, calls []batchCall, block *big.Int, timeout time.Duration) ([]hexutil.Bytes, []error, error) {
+	blockArg := "latest"
+	if block != nil {
+		blockArg = hexutil.EncodeBig(block)
+	}
+	results := make([]hexutil.Bytes, len(calls))
+	batch := make([]rpc.BatchElem, len(calls))
+	for i, call := range calls {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args: []interface{}{
+				map[string]interface{}{"to": call.To, "data": hexutil.Bytes(call.Data)},
+				blockArg,
+			},
+			Result: &results[i],
+		}
+	}
+
+	ctx, cancel := withRPCTimeout(ctx, timeout)
+	defer cancel()
+	if err := client.Client().BatchCallContext(ctx, batch); err != nil {
+		return nil, nil, err
+	}
+	errs := make([]error, len(calls))
+	for i, elem := range batch {
+		errs[i] = elem.Error
+	}
+	return results, errs, nil
+}
+
+// CallERC20Decimals 调用 ERC20 合约的 decimals 方法，获取代币精度
+// 参数 ctx 是上下文，client 是以太坊客户端，tokenAddr 是代币合约地址，timeout 是单次调用超时
+// 返回代币精度，如果调用失败则返回错误
+func CallERC20Decimals(ctx context.Context, client *ethclient.Client, tokenAddr common.Address, timeout time.Duration) (uint8, error) {
+	contract := bind.NewBoundContract(tokenAddr, erc20ABI, client, client, client)
+
+	raw, err := callContract(ctx, contract, timeout, "decimals")
+	if err != nil {
+		return 0, fmt.Errorf("调用 decimals 失败: %w", err)
+	}
+	if len(raw) != 1 {
+		return 0, fmt.Errorf("unexpected decimals return length %d", len(raw))
+	}
+
+	switch v := raw[0].(type) {
+	case uint8:
+		return v, nil
+	case *big.Int:
+		return uint8(v.Uint64()), nil
+	default:
+		return 0, fmt.Errorf("unexpected decimals return type %T", raw[0])
+	}
+}
+
+// CallERC20Symbol 调用 ERC20 合约的 symbol 方法，获取代币符号
+// 参数 ctx 是上下文，client 是以太坊客户端，tokenAddr 是代币合约地址，timeout 是单次调用超时
+// 返回代币符号，如果调用失败（例如返回 bytes32 的非标准代币）则返回错误
+func CallERC20Symbol(ctx context.Context, client *ethclient.Client, tokenAddr common.Address, timeout time.Duration) (string, error) {
+	contract := bind.NewBoundContract(tokenAddr, erc20ABI, client, client, client)
+
+	raw, err := callContract(ctx, contract, timeout, "symbol")
+	if err != nil {
+		return "", fmt.Errorf("调用 symbol 失败: %w", err)
+	}
+	if len(raw) != 1 {
+		return "", fmt.Errorf("unexpected symbol return length %d", len(raw))
+	}
+
+	symbol, ok := raw[0].(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected symbol return type %T", raw[0])
+	}
+	return symbol, nil
+}
+
+// CallERC20Name 调用 ERC20 合约的 name 方法，获取代币名称
+// 参数 ctx 是上下文，client 是以太坊客户端，tokenAddr 是代币合约地址，timeout 是单次调用超时
+// 返回代币名称，如果调用失败（例如返回 bytes32 的非标准代币）则返回错误
+func CallERC20Name(ctx context.Context, client *ethclient.Client, tokenAddr common.Address, timeout time.Duration) (string, error) {
+	contract := bind.NewBoundContract(tokenAddr, erc20ABI, client, client, client)
+
+	raw, err := callContract(ctx, contract, timeout, "name")
+	if err != nil {
+		return "", fmt.Errorf("调用 name 失败: %w", err)
+	}
+	if len(raw) != 1 {
+		return "", fmt.Errorf("unexpected name return length %d", len(raw))
+	}
+
+	name, ok := raw[0].(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected name return type %T", raw[0])
+	}
+	return name, nil
+}
+
+// CallERC20Allowance 调用 ERC20 合约的 allowance 方法，获取 owner 授权给 spender 的额度
+// 参数 ctx 是上下文，client 是以太坊客户端，tokenAddr 是代币合约地址，timeout 是单次调用超时
+// 返回授权额度，如果调用失败则返回错误
+func CallERC20Allowance(ctx context.Context, client *ethclient.Client, tokenAddr, owner, spender common.Address, timeout time.Duration) (*big.Int, error) {
+	contract := bind.NewBoundContract(tokenAddr, erc20ABI, client, client, client)
+
+	raw, err := callContract(ctx, contract, timeout, "allowance", owner, spender)
+	if err != nil {
+		return nil, fmt.Errorf("调用 allowance 失败: %w", err)
+	}
+	if len(raw) != 1 {
+		return nil, fmt.Errorf("unexpected allowance return length %d", len(raw))
+	}
+
+	allowance, ok := raw[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("unexpected allowance return type %T", raw[0])
+	}
+	return allowance, nil
+}
+
+// v3FactoryABI 解析后的 Uniswap V3 Factory ABI，费率方法全部失败时按档位匹配池子使用
+var v3FactoryABI = mustParseABI(UniswapV3FactoryABIJSON)
+
+// CallFactoryGetPool 调用 Uniswap V3 Factory 的 getPool 方法，获取指定代币对和费率档位对应的池子地址
+// 参数 ctx 是上下文，client 是以太坊客户端，factoryAddr 是 Factory 合约地址，feeTier 是费率档位（单位 1e-6），timeout 是单次调用超时
+// 返回池子地址，不存在时为零地址，如果调用失败则返回错误
+func CallFactoryGetPool(ctx context.Context, client *ethclient.Client, factoryAddr, token0, token1 common.Address, feeTier uint32, timeout time.Duration) (common.Address, error) {
+	contract := bind.NewBoundContract(factoryAddr, v3FactoryABI, client, client, client)
+
+	raw, err := callContract(ctx, contract, timeout, "getPool", token0, token1, big.NewInt(int64(feeTier)))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("调用 getPool 失败: %w", err)
+	}
+	if len(raw) != 1 {
+		return common.Address{}, fmt.Errorf("unexpected getPool return length %d", len(raw))
+	}
+
+	pool, ok := raw[0].(common.Address)
+	if !ok {
+		return common.Address{}, fmt.Errorf("unexpected getPool return type %T", raw[0])
+	}
+	return pool, nil
+}
+
+// CallBalancerPoolTokens 调用 Balancer Vault 的 getPoolTokens 方法，获取池子的代币列表与余额
+// 参数 ctx 是上下文，vault 是绑定的 Vault 合约实例，poolID 是池子 ID，timeout 是单次调用超时
+// 返回代币地址列表和对应余额，两者顺序一致，如果调用失败则返回错误
+func CallBalancerPoolTokens(ctx context.Context, vault *bind.BoundContract, poolID common.Hash, timeout time.Duration) ([]common.Address, []*big.Int, error) {
+	raw, err := callContract(ctx, vault, timeout, "getPoolTokens", poolID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw) != 3 {
+		return nil, nil, fmt.Errorf("unexpected getPoolTokens return length %d", len(raw))
+	}
+
+	tokens, ok := raw[0].([]common.Address)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected getPoolTokens tokens type %T", raw[0])
+	}
+	balances, ok := raw[1].([]*big.Int)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected getPoolTokens balances type %T", raw[1])
+	}
+	if len(tokens) != len(balances) {
+		return nil, nil, fmt.Errorf("getPoolTokens 代币数量 %d 与余额数量 %d 不一致", len(tokens), len(balances))
+	}
+	return tokens, balances, nil
+}
+
+// CallNormalizedWeights 调用 Balancer 加权池的 getNormalizedWeights 方法
+// 参数 ctx 是上下文，contract 是绑定的池子合约实例，timeout 是单次调用超时
+// 返回按 1e18 归一化的权重列表（顺序与 getPoolTokens 一致），如果调用失败则返回错误
+func CallNormalizedWeights(ctx context.Context, contract *bind.BoundContract, timeout time.Duration) ([]*big.Int, error) {
+	raw, err := callContract(ctx, contract, timeout, "getNormalizedWeights")
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 1 {
+		return nil, fmt.Errorf("unexpected getNormalizedWeights return length %d", len(raw))
+	}
+
+	weights, ok := raw[0].([]*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("unexpected getNormalizedWeights return type %T", raw[0])
+	}
+	return weights, nil
+}
+
+// CallSwapFeePercentage 调用 Balancer 池子的 getSwapFeePercentage 方法
+// 参数 ctx 是上下文，contract 是绑定的池子合约实例，timeout 是单次调用超时
+// 返回费率百分比（例如 0.3 表示 0.3%），合约返回值以 1e18 表示 100%，如果调用失败则返回错误
+func CallSwapFeePercentage(ctx context.Context, contract *bind.BoundContract, timeout time.Duration) (float64, error) {
+	raw, err := callContract(ctx, contract, timeout, "getSwapFeePercentage")
+	if err != nil {
+		return 0, err
+	}
+	if len(raw) != 1 {
+		return 0, fmt.Errorf("unexpected getSwapFeePercentage return length %d", len(raw))
+	}
+
+	fee, ok := raw[0].(*big.Int)
+	if !ok {
+		return 0, fmt.Errorf("unexpected getSwapFeePercentage return type %T", raw[0])
+	}
+	percent, _ := new(big.Float).Quo(new(big.Float).SetInt(fee), big.NewFloat(1e16)).Float64()
+	return percent, nil
+}
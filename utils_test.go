@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// TestIsRetryableRPCError 限流、超时、5xx 与连接错误可以重试，合约回滚、记录不存在、解码失败与主动取消不重试
+func TestIsRetryableRPCError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil},
+		{name: "execution reverted", err: errors.New("execution reverted")},
+		{name: "wrapped revert with reason", err: fmt.Errorf("调用失败: %w", errors.New("execution reverted: K"))},
+		{name: "out of gas", err: errors.New("out of gas")},
+		{name: "abi decode", err: errors.New("abi: cannot unmarshal tuple")},
+		{name: "not found", err: ethereum.NotFound},
+		{name: "no code", err: bind.ErrNoCode},
+		{name: "cancelled", err: context.Canceled},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: true},
+		{name: "http 429", err: rpc.HTTPError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "http 503", err: rpc.HTTPError{StatusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "http 400", err: rpc.HTTPError{StatusCode: http.StatusBadRequest}},
+		{name: "rate limit message", err: errors.New("rate limit exceeded"), want: true},
+		{name: "timeout message", err: errors.New("request timed out"), want: true},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: true},
+		{name: "connection reset message", err: errors.New("read: connection reset by peer"), want: true},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, want: true},
+		{name: "unknown", err: errors.New("invalid argument")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableRPCError(tt.err); got != tt.want {
+				t.Fatalf("isRetryableRPCError(%v) = %v，期望 %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRetryDo 可重试的错误最多尝试 MaxAttempts 次，不可重试的错误只尝试一次；返回最后一次的结果
+func TestRetryDo(t *testing.T) {
+	rateLimited := errors.New("429 Too Many Requests")
+	reverted := errors.New("execution reverted")
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		// errs 每次尝试返回的错误，超出部分返回 nil
+		errs         []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{name: "success", policy: RetryPolicy{MaxAttempts: 3}, wantAttempts: 1},
+		{name: "revert is not retried", policy: RetryPolicy{MaxAttempts: 3}, errs: []error{reverted, reverted}, wantAttempts: 1, wantErr: reverted},
+		{name: "rate limit retried up to max attempts", policy: RetryPolicy{MaxAttempts: 3}, errs: []error{rateLimited, rateLimited, rateLimited, rateLimited}, wantAttempts: 3, wantErr: rateLimited},
+		{name: "timeout retried up to max attempts", policy: RetryPolicy{MaxAttempts: 2}, errs: []error{context.DeadlineExceeded, context.DeadlineExceeded, context.DeadlineExceeded}, wantAttempts: 2, wantErr: context.DeadlineExceeded},
+		{name: "connection error then success", policy: RetryPolicy{MaxAttempts: 3}, errs: []error{io.EOF}, wantAttempts: 2},
+		{name: "retryable then permanent", policy: RetryPolicy{MaxAttempts: 5}, errs: []error{rateLimited, reverted, rateLimited}, wantAttempts: 2, wantErr: reverted},
+		{name: "single attempt policy", policy: RetryPolicy{MaxAttempts: 1}, errs: []error{rateLimited}, wantAttempts: 1, wantErr: rateLimited},
+		{name: "custom classifier", policy: RetryPolicy{MaxAttempts: 3, Retryable: func(error) bool { return true }}, errs: []error{reverted, reverted}, wantAttempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.MinDelay, tt.policy.MaxDelay = time.Millisecond, time.Millisecond
+			attempts := 0
+			err := retryDo(context.Background(), tt.policy, func(ctx context.Context) error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+			if attempts != tt.wantAttempts || !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("尝试 %d 次返回 %v，期望尝试 %d 次返回 %v", attempts, err, tt.wantAttempts, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestRetryDoBackoff 两次尝试之间的等待按退避翻倍增长（带 [d/2, d] 抖动）
+func TestRetryDoBackoff(t *testing.T) {
+	const minDelay = 20 * time.Millisecond
+	var times []time.Time
+	err := retryDo(context.Background(), RetryPolicy{MaxAttempts: 4, MinDelay: minDelay, MaxDelay: time.Second}, func(ctx context.Context) error {
+		times = append(times, time.Now())
+		return io.EOF
+	})
+	if !errors.Is(err, io.EOF) || len(times) != 4 {
+		t.Fatalf("尝试 %d 次返回 %v，期望尝试 4 次返回 EOF", len(times), err)
+	}
+	var gaps []time.Duration
+	for i := 1; i < len(times); i++ {
+		gap := times[i].Sub(times[i-1])
+		// 第 i 次等待的名义值为 minDelay × 2^(i-1)，抖动后不少于其一半
+		if floor := (minDelay << (i - 1)) / 2; gap < floor {
+			t.Fatalf("第 %d 次等待 %v，少于 %v", i, gap, floor)
+		}
+		gaps = append(gaps, gap)
+	}
+	if gaps[len(gaps)-1] <= gaps[0] {
+		t.Fatalf("等待时间 %v 没有增长", gaps)
+	}
+}
+
+// TestRetryDoContext ctx 取消后立即停止重试：退避等待中被取消时不再尝试，fn 内取消时不再等待
+func TestRetryDoContext(t *testing.T) {
+	tests := []struct {
+		name string
+		// cancelInFn 为 true 时在第一次尝试中取消，否则在退避等待期间取消
+		cancelInFn bool
+	}{
+		{name: "cancelled during backoff"},
+		{name: "cancelled during attempt", cancelInFn: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			attempts := 0
+			start := time.Now()
+			if !tt.cancelInFn {
+				time.AfterFunc(20*time.Millisecond, cancel)
+			}
+			err := retryDo(ctx, RetryPolicy{MaxAttempts: 5, MinDelay: time.Hour, MaxDelay: time.Hour}, func(ctx context.Context) error {
+				attempts++
+				if tt.cancelInFn {
+					cancel()
+				}
+				return io.EOF
+			})
+			if attempts != 1 || !errors.Is(err, io.EOF) {
+				t.Fatalf("尝试 %d 次返回 %v，期望尝试 1 次返回最后一次的错误", attempts, err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("取消后 %v 才返回", elapsed)
+			}
+		})
+	}
+}
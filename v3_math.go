@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// 以下为 Uniswap V3 core 中 TickMath / SqrtPriceMath / SwapMath 的 big.Int 移植，
+// 舍入方向与合约保持一致，用于在本地精确复现 swap 的逐 tick 计算
+
+const (
+	// v3MinTick getSqrtRatioAtTick 支持的最小 tick
+	v3MinTick = -887272
+	// v3MaxTick getSqrtRatioAtTick 支持的最大 tick
+	v3MaxTick = 887272
+	// v3FeeDenominator V3 费率单位（1e-6）
+	v3FeeDenominator = 1_000_000
+)
+
+var (
+	v3Q96            = new(big.Int).Lsh(big.NewInt(1), 96)
+	v3MinSqrtRatio   = big.NewInt(4295128739)
+	v3MaxSqrtRatio   = mustBigInt("1461446703485210103287273052203988822378723970342")
+	v3MaxUint256     = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	v3TickRatioMagic = []*big.Int{
+		mustBigHex("fff97272373d413259a46990580e213a"),
+		mustBigHex("fff2e50f5f656932ef12357cf3c7fdcc"),
+		mustBigHex("ffe5caca7e10e4e61c3624eaa0941cd0"),
+		mustBigHex("ffcb9843d60f6159c9db58835c926644"),
+		mustBigHex("ff973b41fa98c081472e6896dfb254c0"),
+		mustBigHex("ff2ea16466c96a3843ec78b326b52861"),
+		mustBigHex("fe5dee046a99a2a811c461f1969c3053"),
+		mustBigHex("fcbe86c7900a88aedcffc83b479aa3a4"),
+		mustBigHex("f987a7253ac413176f2b074cf7815e54"),
+		mustBigHex("f3392b0822b70005940c7a398e4b70f3"),
+		mustBigHex("e7159475a2c29b7443b29c7fa6e889d9"),
+		mustBigHex("d097f3bdfd2022b8845ad8f792aa5825"),
+		mustBigHex("a9f746462d870fdf8a65dc1f90e061e5"),
+		mustBigHex("70d869a156d2a1b890bb3df62baf32f7"),
+		mustBigHex("31be135f97d08fd981231505542fcfa6"),
+		mustBigHex("9aa508b5b7a84e1c677de54f3e99bc9"),
+		mustBigHex("5d6af8dedb81196699c329225ee604"),
+		mustBigHex("2216e584f5fa1ea926041bedfe98"),
+		mustBigHex("48a170391f7dc42444e8fa2"),
+	}
+)
+
+func mustBigInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid big int constant: " + s)
+	}
+	return v
+}
+
+func mustBigHex(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("invalid big hex constant: " + s)
+	}
+	return v
+}
+
+// v3SqrtRatioAtTick 计算 sqrt(1.0001^tick) * 2^96，对应 TickMath.getSqrtRatioAtTick
+func v3SqrtRatioAtTick(tick int) (*big.Int, error) {
+	if tick < v3MinTick || tick > v3MaxTick {
+		return nil, fmt.Errorf("tick %d 超出范围", tick)
+	}
+	absTick := tick
+	if absTick < 0 {
+		absTick = -absTick
+	}
+
+	ratio := new(big.Int).Lsh(big.NewInt(1), 128)
+	if absTick&0x1 != 0 {
+		ratio = mustBigHex("fffcb933bd6fad37aa2d162d1a594001")
+	}
+	for i, magic := range v3TickRatioMagic {
+		if absTick&(0x2<<i) != 0 {
+			ratio.Mul(ratio, magic)
+			ratio.Rsh(ratio, 128)
+		}
+	}
+	if tick > 0 {
+		ratio = new(big.Int).Quo(v3MaxUint256, ratio)
+	}
+
+	// Q128.128 转为 Q64.96，向上取整保证 getTickAtSqrtRatio 的一致性
+	sqrtPrice := new(big.Int).Rsh(ratio, 32)
+	if new(big.Int).And(ratio, big.NewInt(0xffffffff)).Sign() != 0 {
+		sqrtPrice.Add(sqrtPrice, big.NewInt(1))
+	}
+	return sqrtPrice, nil
+}
+
+// mulDiv 计算 floor(a * b / denominator)
+func mulDiv(a, b, denominator *big.Int) *big.Int {
+	product := new(big.Int).Mul(a, b)
+	return product.Quo(product, denominator)
+}
+
+// mulDivRoundingUp 计算 ceil(a * b / denominator)
+func mulDivRoundingUp(a, b, denominator *big.Int) *big.Int {
+	return divRoundingUp(new(big.Int).Mul(a, b), denominator)
+}
+
+// divRoundingUp 计算 ceil(a / b)，a、b 均为非负数
+func divRoundingUp(a, b *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(a, b, new(big.Int))
+	if remainder.Sign() != 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	return quotient
+}
+
+// v3Amount0Delta 两个价格之间 token0 的数量，对应 SqrtPriceMath.getAmount0Delta
+func v3Amount0Delta(sqrtA, sqrtB, liquidity *big.Int, roundUp bool) *big.Int {
+	if sqrtA.Cmp(sqrtB) > 0 {
+		sqrtA, sqrtB = sqrtB, sqrtA
+	}
+	numerator1 := new(big.Int).Lsh(liquidity, 96)
+	numerator2 := new(big.Int).Sub(sqrtB, sqrtA)
+	if roundUp {
+		return divRoundingUp(mulDivRoundingUp(numerator1, numerator2, sqrtB), sqrtA)
+	}
+	return new(big.Int).Quo(mulDiv(numerator1, numerator2, sqrtB), sqrtA)
+}
+
+// v3Amount1Delta 两个价格之间 token1 的数量，对应 SqrtPriceMath.getAmount1Delta
+func v3Amount1Delta(sqrtA, sqrtB, liquidity *big.Int, roundUp bool) *big.Int {
+	if sqrtA.Cmp(sqrtB) > 0 {
+		sqrtA, sqrtB = sqrtB, sqrtA
+	}
+	diff := new(big.Int).Sub(sqrtB, sqrtA)
+	if roundUp {
+		return mulDivRoundingUp(liquidity, diff, v3Q96)
+	}
+	return mulDiv(liquidity, diff, v3Q96)
+}
+
+// v3NextSqrtPriceFromInput 投入 amountIn 后的价格，对应 SqrtPriceMath.getNextSqrtPriceFromInput
+func v3NextSqrtPriceFromInput(sqrtPrice, liquidity, amountIn *big.Int, zeroForOne bool) *big.Int {
+	if zeroForOne {
+		// token0 输入：sqrtP' = L * sqrtP / (L + amount * sqrtP)，向上取整
+		numerator1 := new(big.Int).Lsh(liquidity, 96)
+		denominator := new(big.Int).Add(numerator1, new(big.Int).Mul(amountIn, sqrtPrice))
+		return mulDivRoundingUp(numerator1, sqrtPrice, denominator)
+	}
+	// token1 输入：sqrtP' = sqrtP + amount / L，向下取整
+	quotient := new(big.Int).Quo(new(big.Int).Lsh(amountIn, 96), liquidity)
+	return quotient.Add(quotient, sqrtPrice)
+}
+
+// v3SwapStep 在单个 tick 区间内执行精确输入 swap，对应 SwapMath.computeSwapStep
+// 返回区间内到达的价格、实际消耗的输入（不含手续费）、输出与手续费
+func v3SwapStep(sqrtCurrent, sqrtTarget, liquidity, amountRemaining *big.Int, feePips int64) (sqrtNext, amountIn, amountOut, feeAmount *big.Int) {
+	zeroForOne := sqrtCurrent.Cmp(sqrtTarget) >= 0
+	fee := big.NewInt(feePips)
+	feeComplement := big.NewInt(v3FeeDenominator - feePips)
+
+	amountRemainingLessFee := mulDiv(amountRemaining, feeComplement, big.NewInt(v3FeeDenominator))
+	if zeroForOne {
+		amountIn = v3Amount0Delta(sqrtTarget, sqrtCurrent, liquidity, true)
+	} else {
+		amountIn = v3Amount1Delta(sqrtCurrent, sqrtTarget, liquidity, true)
+	}
+	if amountRemainingLessFee.Cmp(amountIn) >= 0 {
+		sqrtNext = sqrtTarget
+	} else {
+		sqrtNext = v3NextSqrtPriceFromInput(sqrtCurrent, liquidity, amountRemainingLessFee, zeroForOne)
+	}
+
+	reachedTarget := sqrtNext.Cmp(sqrtTarget) == 0
+	if zeroForOne {
+		if !reachedTarget {
+			amountIn = v3Amount0Delta(sqrtNext, sqrtCurrent, liquidity, true)
+		}
+		amountOut = v3Amount1Delta(sqrtNext, sqrtCurrent, liquidity, false)
+	} else {
+		if !reachedTarget {
+			amountIn = v3Amount1Delta(sqrtCurrent, sqrtNext, liquidity, true)
+		}
+		amountOut = v3Amount0Delta(sqrtCurrent, sqrtNext, liquidity, false)
+	}
+
+	if !reachedTarget {
+		// 未到达区间边界说明输入已耗尽，剩余部分全部计为手续费
+		feeAmount = new(big.Int).Sub(amountRemaining, amountIn)
+	} else {
+		feeAmount = mulDivRoundingUp(amountIn, fee, feeComplement)
+	}
+	return sqrtNext, amountIn, amountOut, feeAmount
+}
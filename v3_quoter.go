@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// v3TickBitmapWords 沿 swap 方向加载的 tickBitmap 字数，每个字覆盖 256 × tickSpacing 个 tick
+const v3TickBitmapWords = 8
+
+// errV3TicksExhausted 输入量超出已加载的 tick 范围，精确报价无法给出结果
+var errV3TicksExhausted = errors.New("输入量超出已加载的 tick 范围")
+
+// v3Tick 已初始化 tick 的流动性变化
+type v3Tick struct {
+	Index        int
+	LiquidityNet *big.Int
+}
+
+// v3PoolState V3 池子在单个 swap 方向上的 tick 数据快照
+type v3PoolState struct {
+	SqrtPriceX96 *big.Int
+	Tick         int
+	Liquidity    *big.Int
+	TickSpacing  int
+	// ZeroForOne swap 方向，true 表示输入 token0 换出 token1
+	ZeroForOne bool
+	// Ticks 已加载范围内的已初始化 tick，按 Index 升序
+	Ticks []v3Tick
+	// Boundary 已加载 tick 数据沿 swap 方向的边界，价格越过该边界时数据不足
+	Boundary int
+}
+
+// V3Quoter 读取 V3 池子的 slot0、liquidity 与 tickBitmap/ticks，在本地逐 tick 复现 swap 计算
+// 每个池子需要 3 次批量 RPC，因此只在计算者精算时使用，由 V3_ACCURATE_QUOTE 开启
+type V3Quoter struct {
+	client *ethclient.Client
+	cfg    *AppConfig
+	abi    abi.ABI
+}
+
+// NewV3Quoter 创建 V3 精确报价器
+func NewV3Quoter(client *ethclient.Client, cfg *AppConfig) (*V3Quoter, error) {
+	stateABI, err := abi.JSON(strings.NewReader(UniswapV3StateABIJSON))
+	if err != nil {
+		return nil, fmt.Errorf("解析 V3 状态 ABI 失败: %w", err)
+	}
+	return &V3Quoter{client: client, cfg: cfg, abi: stateABI}, nil
+}
+
+// LoadState 加载池子当前价格、流动性以及沿 swap 方向 v3TickBitmapWords 个字内的已初始化 tick
+func (q *V3Quoter) LoadState(ctx context.Context, pool common.Address, zeroForOne bool) (*v3PoolState, error) {
+	values, err := q.batchCall(ctx, pool, []v3StateCall{
+		{Method: "slot0"},
+		{Method: "liquidity"},
+		{Method: "tickSpacing"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sqrtPrice, ok1 := values[0][0].(*big.Int)
+	tick, ok2 := values[0][1].(*big.Int)
+	liquidity, ok3 := values[1][0].(*big.Int)
+	spacing, ok4 := values[2][0].(*big.Int)
+	if !ok1 || !ok2 || !ok3 || !ok4 || spacing.Sign() <= 0 {
+		return nil, fmt.Errorf("池子 %s 的 slot0/liquidity/tickSpacing 返回值异常", pool.Hex())
+	}
+	state := &v3PoolState{
+		SqrtPriceX96: sqrtPrice,
+		Tick:         int(tick.Int64()),
+		Liquidity:    liquidity,
+		TickSpacing:  int(spacing.Int64()),
+		ZeroForOne:   zeroForOne,
+	}
+
+	// 与 TickBitmap.position 一致：tick 先按 tickSpacing 向负无穷取整压缩，再按 256 分字
+	compressed := state.Tick / state.TickSpacing
+	if state.Tick < 0 && state.Tick%state.TickSpacing != 0 {
+		compressed--
+	}
+	startWord := compressed >> 8
+	words := make([]int, v3TickBitmapWords)
+	for i := range words {
+		if zeroForOne {
+			words[i] = startWord - i
+		} else {
+			words[i] = startWord + i
+		}
+	}
+	if zeroForOne {
+		state.Boundary = words[len(words)-1] * 256 * state.TickSpacing
+	} else {
+		state.Boundary = (words[len(words)-1]*256 + 255) * state.TickSpacing
+	}
+
+	bitmapCalls := make([]v3StateCall, len(words))
+	for i, word := range words {
+		bitmapCalls[i] = v3StateCall{Method: "tickBitmap", Args: []interface{}{int16(word)}}
+	}
+	bitmaps, err := q.batchCall(ctx, pool, bitmapCalls)
+	if err != nil {
+		return nil, err
+	}
+
+	var tickCalls []v3StateCall
+	for i, word := range words {
+		bitmap, ok := bitmaps[i][0].(*big.Int)
+		if !ok {
+			return nil, fmt.Errorf("池子 %s 的 tickBitmap 返回值异常", pool.Hex())
+		}
+		for bit := 0; bit < 256; bit++ {
+			if bitmap.Bit(bit) == 0 {
+				continue
+			}
+			index := (word*256 + bit) * state.TickSpacing
+			tickCalls = append(tickCalls, v3StateCall{Method: "ticks", Args: []interface{}{big.NewInt(int64(index))}})
+		}
+	}
+	if len(tickCalls) == 0 {
+		return state, nil
+	}
+
+	tickValues, err := q.batchCall(ctx, pool, tickCalls)
+	if err != nil {
+		return nil, err
+	}
+	for i, call := range tickCalls {
+		net, ok := tickValues[i][1].(*big.Int)
+		if !ok {
+			return nil, fmt.Errorf("池子 %s 的 ticks 返回值异常", pool.Hex())
+		}
+		state.Ticks = append(state.Ticks, v3Tick{Index: int(call.Args[0].(*big.Int).Int64()), LiquidityNet: net})
+	}
+	sort.Slice(state.Ticks, func(i, j int) bool { return state.Ticks[i].Index < state.Ticks[j].Index })
+	return state, nil
+}
+
+// v3StateCall 批量查询中的单个池子方法调用
+type v3StateCall struct {
+	Method string
+	Args   []interface{}
+}
+
+// batchCall 通过一次 JSON-RPC 批量请求调用池子的多个只读方法，任一调用失败时返回错误
+func (q *V3Quoter) batchCall(ctx context.Context, pool common.Address, calls []v3StateCall) ([][]interface{}, error) {
+	results := make([]hexutil.Bytes, len(calls))
+	batch := make([]rpc.BatchElem, len(calls))
+	for i, call := range calls {
+		data, err := q.abi.Pack(call.Method, call.Args...)
+		if err != nil {
+			return nil, err
+		}
+		batch[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args: []interface{}{
+				map[string]interface{}{"to": pool, "data": hexutil.Bytes(data)},
+				"latest",
+			},
+			Result: &results[i],
+		}
+	}
+
+	callCtx, cancel := withRPCTimeout(ctx, q.cfg.RPCCallTimeout)
+	defer cancel()
+	if err := q.client.Client().BatchCallContext(callCtx, batch); err != nil {
+		return nil, fmt.Errorf("批量查询池子 %s 状态失败: %w", pool.Hex(), err)
+	}
+
+	values := make([][]interface{}, len(calls))
+	for i, elem := range batch {
+		if elem.Error != nil {
+			return nil, fmt.Errorf("调用池子 %s 的 %s 失败: %w", pool.Hex(), calls[i].Method, elem.Error)
+		}
+		unpacked, err := q.abi.Unpack(calls[i].Method, results[i])
+		if err != nil {
+			return nil, fmt.Errorf("解析池子 %s 的 %s 返回值失败: %w", pool.Hex(), calls[i].Method, err)
+		}
+		values[i] = unpacked
+	}
+	return values, nil
+}
+
+// quote 按 UniswapV3Pool.swap 的逐 tick 流程计算精确输入 amount 的输出，feePips 单位 1e-6
+// 价格越过已加载 tick 数据的边界时返回 errV3TicksExhausted
+func (s *v3PoolState) quote(amount float64, feePips int) (float64, error) {
+	amountIn, _ := new(big.Float).SetFloat64(amount).Int(nil)
+	if amountIn.Sign() <= 0 {
+		return 0, nil
+	}
+	amountOut, err := s.quoteExactInput(amountIn, int64(feePips))
+	if err != nil {
+		return 0, err
+	}
+	out, _ := new(big.Float).SetInt(amountOut).Float64()
+	return out, nil
+}
+
+// quoteExactInput 精确输入 swap 的输出，feePips 单位为 1e-6
+func (s *v3PoolState) quoteExactInput(amountIn *big.Int, feePips int64) (*big.Int, error) {
+	sqrtLimit := new(big.Int).Sub(v3MaxSqrtRatio, big.NewInt(1))
+	if s.ZeroForOne {
+		sqrtLimit = new(big.Int).Add(v3MinSqrtRatio, big.NewInt(1))
+	}
+
+	remaining := new(big.Int).Set(amountIn)
+	amountOut := new(big.Int)
+	sqrtPrice := new(big.Int).Set(s.SqrtPriceX96)
+	liquidity := new(big.Int).Set(s.Liquidity)
+	tick := s.Tick
+
+	for remaining.Sign() > 0 && sqrtPrice.Cmp(sqrtLimit) != 0 {
+		tickNext, net := s.nextInitializedTick(tick)
+		if tickNext < v3MinTick {
+			tickNext = v3MinTick
+		} else if tickNext > v3MaxTick {
+			tickNext = v3MaxTick
+		}
+		sqrtNext, err := v3SqrtRatioAtTick(tickNext)
+		if err != nil {
+			return nil, err
+		}
+
+		target := sqrtNext
+		if (s.ZeroForOne && sqrtNext.Cmp(sqrtLimit) < 0) || (!s.ZeroForOne && sqrtNext.Cmp(sqrtLimit) > 0) {
+			target = sqrtLimit
+		}
+
+		var stepIn, stepOut, stepFee *big.Int
+		sqrtPrice, stepIn, stepOut, stepFee = v3SwapStep(sqrtPrice, target, liquidity, remaining, feePips)
+		remaining.Sub(remaining, stepIn)
+		remaining.Sub(remaining, stepFee)
+		amountOut.Add(amountOut, stepOut)
+
+		if sqrtPrice.Cmp(sqrtNext) != 0 {
+			// 未到达下一个 tick，输入已在当前区间内耗尽
+			break
+		}
+		if net == nil {
+			if remaining.Sign() > 0 && tickNext == s.Boundary {
+				return nil, fmt.Errorf("%w（边界 tick %d）", errV3TicksExhausted, s.Boundary)
+			}
+		} else {
+			// 跨越已初始化 tick：向左跨越时 liquidityNet 取反
+			if s.ZeroForOne {
+				liquidity.Sub(liquidity, net)
+			} else {
+				liquidity.Add(liquidity, net)
+			}
+			if liquidity.Sign() < 0 {
+				return nil, fmt.Errorf("跨越 tick %d 后流动性为负", tickNext)
+			}
+		}
+		if s.ZeroForOne {
+			tick = tickNext - 1
+		} else {
+			tick = tickNext
+		}
+	}
+	return amountOut, nil
+}
+
+// nextInitializedTick 返回沿 swap 方向的下一个已初始化 tick 及其 liquidityNet
+// 向左（zeroForOne）查找 <= tick 的最大者，向右查找 > tick 的最小者；已加载范围内没有时返回边界与 nil
+func (s *v3PoolState) nextInitializedTick(tick int) (int, *big.Int) {
+	if s.ZeroForOne {
+		idx := sort.Search(len(s.Ticks), func(i int) bool { return s.Ticks[i].Index > tick }) - 1
+		if idx >= 0 && s.Ticks[idx].Index >= s.Boundary {
+			return s.Ticks[idx].Index, s.Ticks[idx].LiquidityNet
+		}
+		return s.Boundary, nil
+	}
+	idx := sort.Search(len(s.Ticks), func(i int) bool { return s.Ticks[i].Index > tick })
+	if idx < len(s.Ticks) && s.Ticks[idx].Index <= s.Boundary {
+		return s.Ticks[idx].Index, s.Ticks[idx].LiquidityNet
+	}
+	return s.Boundary, nil
+}
+
+// spotPrice 当前价格下每单位输入代币可换得的输出代币（不含手续费）
+func (s *v3PoolState) spotPrice() float64 {
+	ratio := new(big.Float).Quo(new(big.Float).SetInt(s.SqrtPriceX96), new(big.Float).SetInt(v3Q96))
+	price, _ := new(big.Float).Mul(ratio, ratio).Float64()
+	if s.ZeroForOne {
+		return price
+	}
+	if price == 0 {
+		return 0
+	}
+	return 1 / price
+}
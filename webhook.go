@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// webhookSignatureHeader 携带请求体 HMAC-SHA256 签名（十六进制）的请求头
+const webhookSignatureHeader = "X-Signature"
+
+// webhookRetryDelay 两次投递之间的基础等待时间，按重试次数线性增加
+const webhookRetryDelay = 500 * time.Millisecond
+
+// webhookStep 推送给外部的单跳路径信息
+type webhookStep struct {
+	Pool      string `json:"pool"`
+	Protocol  string `json:"protocol"`
+	FromToken string `json:"from_token"`
+	ToToken   string `json:"to_token"`
+	// Fee、FeeBps 由 FeePips 换算，只用于展示
+	Fee    float64 `json:"fee"`
+	FeeBps int     `json:"fee_bps"`
+	// FeePips 精确费率，单位 1e-6，V3/Algebra 的非整基点费率以此为准
+	FeePips int `json:"fee_pips"`
+	// PriceImpact 本跳价格冲击（含手续费），0.01 表示 1%
+	PriceImpact float64 `json:"price_impact"`
+}
+
+// webhookPayload 确认的套利机会推送内容，Event 固定为 opportunity_confirmed
+type webhookPayload struct {
+	Event           string  `json:"event"`
+	StartToken      string  `json:"start_token"`
+	InitialAmount   float64 `json:"initial_amount"`
+	EstimatedReturn float64 `json:"estimated_return"`
+	DetailedReturn  float64 `json:"detailed_return"`
+	NetProfit       float64 `json:"net_profit"`
+	NetProfitUSD    float64 `json:"net_profit_usd"`
+	// ExecutionCostUSD 已从 NetProfitUSD 中扣除的 gas、优先费与贿赂
+	ExecutionCostUSD float64       `json:"execution_cost_usd"`
+	Path             []webhookStep `json:"path"`
+	Timestamp        int64         `json:"timestamp"`
+}
+
+// webhookAlert 运行告警（订阅断开、熔断等）的推送内容
+type webhookAlert struct {
+	Event     string `json:"event"`
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// WebhookNotifier 将确认的套利机会与运行告警以 JSON POST 到外部地址，接收方按 event 字段区分
+// 配置了密钥时使用 HMAC-SHA256 对请求体签名，接收方可据此校验来源
+type WebhookNotifier struct {
+	url     string
+	secret  []byte
+	retries int
+	client  *http.Client
+}
+
+// NewWebhookNotifier 创建 webhook 推送器，未配置 WEBHOOK_URL 时返回 nil
+func NewWebhookNotifier(cfg *AppConfig) *WebhookNotifier {
+	if cfg.WebhookURL == "" {
+		return nil
+	}
+	return &WebhookNotifier{
+		url:     cfg.WebhookURL,
+		secret:  []byte(cfg.WebhookSecret),
+		retries: cfg.WebhookRetries,
+		client:  &http.Client{Timeout: cfg.WebhookTimeout},
+	}
+}
+
+// newWebhookPayload 根据套利机会与精算结果构建推送内容
+func newWebhookPayload(opportunity ArbitrageOpportunity, detailReturn, profitUSD float64) webhookPayload {
+	path := make([]webhookStep, 0, len(opportunity.Path))
+	for _, step := range opportunity.Path {
+		path = append(path, webhookStep{
+			Pool:        step.Pool.Address.Hex(),
+			Protocol:    step.Protocol,
+			FromToken:   step.FromToken,
+			ToToken:     step.ToToken,
+			Fee:         feePipsToPercent(step.FeePips),
+			FeeBps:      feePipsToBps(step.FeePips),
+			FeePips:     step.FeePips,
+			PriceImpact: step.PriceImpact,
+		})
+	}
+	return webhookPayload{
+		Event:            NotifyOpportunityConfirmed,
+		StartToken:       opportunity.StartToken,
+		InitialAmount:    opportunity.InitialAmount,
+		EstimatedReturn:  opportunity.EstimatedReturn,
+		DetailedReturn:   detailReturn,
+		NetProfit:        detailReturn - opportunity.InitialAmount,
+		NetProfitUSD:     profitUSD,
+		ExecutionCostUSD: opportunity.Cost.Total(),
+		Path:             path,
+		Timestamp:        time.Now().Unix(),
+	}
+}
+
+// Notify 投递事件，失败时按配置重试，全部失败后返回最后一次的错误
+// 套利机会事件推送 webhookPayload，其他事件推送 webhookAlert
+func (wn *WebhookNotifier) Notify(ctx context.Context, event NotificationEvent) error {
+	var content any = webhookAlert{Event: event.Kind, Message: event.Message, Timestamp: event.Time.Unix()}
+	if event.Opportunity != nil {
+		content = event.Opportunity
+	}
+	body, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("序列化 webhook 内容失败: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= wn.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * webhookRetryDelay):
+			}
+		}
+		if lastErr = wn.post(ctx, body); lastErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook 投递失败（共尝试 %d 次）: %w", wn.retries+1, lastErr)
+}
+
+// post 发送单次请求，非 2xx 响应视为失败
+func (wn *WebhookNotifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wn.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(wn.secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, signWebhookBody(wn.secret, body))
+	}
+
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signWebhookBody 计算请求体的 HMAC-SHA256 签名（十六进制）
+func signWebhookBody(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,53 @@
+package main
+
+import "github.com/ethereum/go-ethereum/common"
+
+// nativeToken 原生 BNB 在池子代币列表中的表示，与 Uniswap V4 以零地址表示原生币的约定一致
+var nativeToken = common.Address{}
+
+// wrapNativePool 原生 BNB 与包装代币（WRAPPED_NATIVE_ADDRESS，默认 WBNB）之间 1:1 兑换的虚拟池子，地址即包装合约地址
+// 包装/解包没有手续费和滑点，只消耗 EXEC_WRAP_GAS 的 gas；该池子不落库，只在存在原生 BNB 池子时加入枚举索引
+func wrapNativePool(wrapped common.Address) poolDetail {
+	return poolDetail{
+		Address:  wrapped,
+		Tokens:   []common.Address{nativeToken, wrapped},
+		Protocol: ProtocolWrapNative,
+		Active:   true,
+	}
+}
+
+// sameAsset 判断两个代币是否为同一资产，原生 BNB 与其包装代币按 1:1 视为同一资产
+func sameAsset(a, b, wrapped common.Address) bool {
+	if a == b {
+		return true
+	}
+	return (a == nativeToken && b == wrapped) || (a == wrapped && b == nativeToken)
+}
+
+// containsNative 判断池子列表中是否有以原生 BNB 计价的池子
+func containsNative(pools []poolDetail) bool {
+	for _, pool := range pools {
+		if pool.TokenIndex(nativeToken) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapCount 统计执行路径需要的包装/解包次数：经过包装虚拟池子的跳数，
+// 加上首尾一个为原生 BNB、一个为包装代币时换回起始资产所需的一次包装/解包
+func wrapCount(path []graphEdge) int {
+	if len(path) == 0 {
+		return 0
+	}
+	count := 0
+	for _, step := range path {
+		if step.Protocol == ProtocolWrapNative {
+			count++
+		}
+	}
+	if path[0].FromToken != path[len(path)-1].ToToken {
+		count++
+	}
+	return count
+}